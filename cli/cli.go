@@ -11,6 +11,7 @@ import (
 	"github.com/zrepl/zrepl/daemon/logging/trace"
 
 	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/zfs/zfscmd"
 )
 
 var rootArgs struct {
@@ -123,6 +124,7 @@ func (s *Subcommand) tryParseConfig() {
 		}
 	}
 	s.config = config
+	zfscmd.SetCommandWrapper(config.Global.ZFS.CommandWrapper)
 }
 
 func AddSubcommand(s *Subcommand) {
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/config"
+)
+
+var ConfigCmd = &cli.Subcommand{
+	Use:   "config",
+	Short: "config file utilities",
+	SetupSubcommands: func() []*cli.Subcommand {
+		return []*cli.Subcommand{
+			configCmdSchema,
+		}
+	},
+}
+
+var configCmdSchema = &cli.Subcommand{
+	Use:             "schema",
+	Short:           "print the JSON schema of the config file (for editor autocompletion and validation)",
+	NoRequireConfig: true,
+	Run: func(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
+		if len(args) > 0 {
+			return fmt.Errorf("subcommand takes no arguments")
+		}
+		schema, err := config.JSONSchema()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(os.Stdout, "%s\n", schema)
+		return err
+	},
+}
@@ -71,6 +71,17 @@ var ConfigcheckCmd = &cli.Subcommand{
 
 		// further: try to build logging outlets
 		outlets, err := logging.OutletsFromConfig(*subcommand.Config().Global.Logging)
+		if err == nil {
+			for _, jc := range subcommand.Config().Jobs {
+				if jc.Logging() == nil {
+					continue
+				}
+				if _, err = logging.OutletsFromConfig(*jc.Logging()); err != nil {
+					err = errors.Wrapf(err, "job %q", jc.Name())
+					break
+				}
+			}
+		}
 		if err != nil {
 			err := errors.Wrap(err, "cannot build logging from config")
 			if configcheckArgs.what == "logging" {
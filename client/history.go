@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/daemon/history"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+var historyArgs struct {
+	job  string
+	json bool
+}
+
+var HistoryCmd = &cli.Subcommand{
+	Use:   "history [--job JOB] FILESYSTEM[@SNAPSHOT]",
+	Short: "show when the snapshots of FILESYSTEM (or only SNAPSHOT) were replicated, by which job and to where",
+	Run:   runHistoryCmd,
+	SetupFlags: func(f *pflag.FlagSet) {
+		f.StringVar(&historyArgs.job, "job", "", "only show steps replicated by job JOB")
+		f.BoolVar(&historyArgs.json, "json", false, "emit JSON")
+	},
+}
+
+func runHistoryCmd(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected 1 argument: FILESYSTEM[@SNAPSHOT]")
+	}
+	path := subcommand.Config().Global.History.Path
+	if path == "" {
+		return errors.New("the replication history is disabled, see `global.history.path`")
+	}
+
+	fs, snapName := args[0], ""
+	if i := strings.Index(fs, "@"); i != -1 {
+		fs, snapName = fs[:i], fs[i+1:]
+		if snapName == "" {
+			return errors.New("snapshot name must not be empty")
+		}
+	}
+	if _, err := zfs.NewDatasetPath(fs); err != nil {
+		return errors.Wrap(err, "invalid filesystem")
+	}
+
+	entries, corrupt, err := history.Read(path, history.Match(fs, snapName, historyArgs.job))
+	if err != nil {
+		return err
+	}
+	if corrupt > 0 {
+		fmt.Fprintf(os.Stderr, "warning: skipped %d corrupt line(s) in history file %q\n", corrupt, path)
+	}
+
+	if historyArgs.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if entries == nil {
+			entries = []*history.Entry{}
+		}
+		return enc.Encode(entries)
+	}
+
+	if len(entries) == 0 {
+		if snapName != "" {
+			return errors.Errorf("no replication of %s@%s recorded", fs, snapName)
+		}
+		fmt.Printf("no replication of %s recorded\n", fs)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tJOB\tPEER\tFROM\tTO\tTO GUID\tBYTES\tDURATION")
+	for _, e := range entries {
+		from := "(full)"
+		if e.From != nil {
+			from = e.From.Name
+		}
+		duration := "-" // not recorded by older versions
+		if e.Duration > 0 {
+			duration = e.Duration.Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s (%s)\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			e.Time.Format(time.RFC3339), e.Job, e.JobType, e.Peer, from, e.To.Name, e.To.GUID, ByteCountBinary(e.Bytes), duration)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/streamarchive"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+var importArgs struct {
+	dryRun      bool
+	filesystems string
+	s3Endpoint  string
+	s3Region    string
+}
+
+var ImportCmd = &cli.Subcommand{
+	Use:             "import DIR|s3://BUCKET[/PREFIX] ROOT_FS",
+	Short:           "receive the streams exported by a push job with connect type `export` or `s3` into ROOT_FS",
+	Run:             runImportCmd,
+	NoRequireConfig: true,
+	SetupFlags: func(f *pflag.FlagSet) {
+		f.BoolVar(&importArgs.dryRun, "dry-run", false, "list the streams that would be imported, but do not receive them")
+		f.StringVar(&importArgs.filesystems, "fs", "", "only import these archived filesystems: a filesystem name or a comma-separated list of <dataset-pattern>:<ok|!> pairs")
+		f.StringVar(&importArgs.s3Endpoint, "s3-endpoint", "", "endpoint URL of the object storage, credentials are read from $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY")
+		f.StringVar(&importArgs.s3Region, "s3-region", "us-east-1", "region of the object storage")
+	},
+}
+
+func runImportCmd(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
+	if len(args) != 2 {
+		return errors.New("expected 2 arguments: DIR|s3://BUCKET[/PREFIX] ROOT_FS")
+	}
+	root, err := zfs.NewDatasetPath(args[1])
+	if err != nil {
+		return errors.Wrap(err, "invalid root filesystem")
+	}
+	rootState, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, root)
+	if err != nil {
+		return errors.Wrap(err, "cannot determine whether root filesystem exists")
+	}
+	if !rootState.FSExists {
+		return errors.Errorf("root filesystem %q does not exist", root.ToString())
+	}
+
+	opts := streamarchive.ImportOptions{
+		RootFS: root,
+		DryRun: importArgs.dryRun,
+		OnStream: func(fs string, target *zfs.DatasetPath, s *streamarchive.ManifestStream) {
+			fmt.Printf("%s: %s into %s (%s)\n", fs, s, target.ToString(), ByteCountBinary(s.Size))
+		},
+	}
+	if importArgs.filesystems != "" {
+		if opts.Filesystems, err = importParseFilesystems(importArgs.filesystems); err != nil {
+			return errors.Wrap(err, "invalid --fs")
+		}
+	}
+
+	storage, err := importStorage(args[0])
+	if err != nil {
+		return err
+	}
+	if err := storage.Check(ctx); err != nil {
+		return err
+	}
+	if err := streamarchive.Import(ctx, storage, opts); err != nil {
+		return err
+	}
+	if importArgs.dryRun {
+		fmt.Printf("dry run, nothing imported\n")
+	}
+	return nil
+}
+
+func importStorage(archive string) (streamarchive.Storage, error) {
+	if !strings.HasPrefix(archive, "s3://") {
+		return &streamarchive.DirStorage{Path: archive}, nil
+	}
+	bucketPrefix := strings.SplitN(strings.TrimPrefix(archive, "s3://"), "/", 2)
+	if importArgs.s3Endpoint == "" {
+		return nil, errors.New("--s3-endpoint is required for s3:// archives")
+	}
+	endpoint, err := url.Parse(importArgs.s3Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid --s3-endpoint")
+	}
+	s := &streamarchive.S3Storage{
+		Endpoint:        endpoint,
+		Region:          importArgs.s3Region,
+		Bucket:          bucketPrefix[0],
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	}
+	if len(bucketPrefix) == 2 {
+		s.Prefix = bucketPrefix[1]
+	}
+	return s, nil
+}
+
+func importParseFilesystems(s string) (zfs.DatasetFilter, error) {
+	mappings := strings.Split(s, ",")
+	if len(mappings) == 1 && !strings.Contains(mappings[0], ":") {
+		mappings[0] += ":ok"
+	}
+	f := filters.NewDatasetMapFilter(len(mappings), true)
+	for _, m := range mappings {
+		lhsrhs := strings.SplitN(m, ":", 2)
+		if len(lhsrhs) != 2 {
+			return nil, errors.Errorf("expecting comma-separated list of <dataset-pattern>:<ok|!> pairs, got %q", m)
+		}
+		if err := f.Add(lhsrhs[0], lhsrhs[1]); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
@@ -42,6 +42,7 @@ var migrations = []*cli.Subcommand{
 			f.BoolVar(&migrateReplicationCursorArgs.dryRun, "dry-run", false, "dry run")
 		},
 	},
+	migrateFailoverCmd,
 }
 
 var migratePlaceholder0_1Args struct {
@@ -190,7 +191,7 @@ func doMigrateReplicationCursorFS(ctx context.Context, v1CursorJobs []job.Job, f
 		if conf == nil {
 			continue
 		}
-		pass, err := conf.FSF.Filter(fs)
+		pass, err := zfs.FilterContext(ctx, conf.FSF, fs)
 		if err != nil {
 			return errors.Wrapf(err, "filesystem filter error in job %q for fs %q", job.Name(), fs.ToString())
 		}
@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+var migrateFailoverCmd = &cli.Subcommand{
+	Use:   "failover",
+	Short: "swap zrepl's replication abstractions to reverse the replication direction after a failover",
+	SetupSubcommands: func() []*cli.Subcommand {
+		return []*cli.Subcommand{
+			{
+				Use:   "promote OLD_RECEIVING_JOB NEW_SENDING_JOB",
+				Short: "run on the receiving side that becomes the sending side",
+				Run:   doMigrateFailoverPromote,
+				SetupFlags: func(f *pflag.FlagSet) {
+					f.BoolVar(&migrateFailoverArgs.dryRun, "dry-run", false, "dry run")
+				},
+			},
+			{
+				Use:   "demote OLD_SENDING_JOB NEW_RECEIVING_JOB",
+				Short: "run on the sending side that becomes the receiving side",
+				Run:   doMigrateFailoverDemote,
+				SetupFlags: func(f *pflag.FlagSet) {
+					f.BoolVar(&migrateFailoverArgs.dryRun, "dry-run", false, "dry run")
+					f.BoolVar(&migrateFailoverArgs.rollback, "rollback", false, "roll back filesystems to the last replicated snapshot, DESTROYING all newer snapshots and changes")
+				},
+			},
+		}
+	},
+}
+
+var migrateFailoverArgs struct {
+	dryRun   bool
+	rollback bool
+}
+
+// Returns the sender config of the sending job jobName, which must be present in the config.
+func migrateFailoverSenderConfig(cfg *config.Config, jobName string) (*endpoint.SenderConfig, error) {
+	jobs, err := job.JobsFromConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build jobs from config")
+	}
+	for _, j := range jobs {
+		if j.Name() != jobName {
+			continue
+		}
+		sc := j.SenderConfig()
+		if sc == nil {
+			return nil, errors.Errorf("job %q is not a sending job (push or source)", jobName)
+		}
+		return sc, nil
+	}
+	return nil, errors.Errorf("job %q not found in config", jobName)
+}
+
+func doMigrateFailover(ctx context.Context, sc *cli.Subcommand, args []string, sendingJobArg int, doFS func(ctx context.Context, fs *zfs.DatasetPath, oldJob, newJob endpoint.JobID) error) error {
+	if len(args) != 2 {
+		return fmt.Errorf("expected 2 arguments, got %v", args)
+	}
+	oldJob, err := endpoint.MakeJobID(args[0])
+	if err != nil {
+		return errors.Wrap(err, "invalid old job name")
+	}
+	newJob, err := endpoint.MakeJobID(args[1])
+	if err != nil {
+		return errors.Wrap(err, "invalid new job name")
+	}
+	senderConfig, err := migrateFailoverSenderConfig(sc.Config(), args[sendingJobArg])
+	if err != nil {
+		return err
+	}
+
+	fss, err := zfs.ZFSListMapping(ctx, senderConfig.FSF)
+	if err != nil {
+		return errors.Wrap(err, "list filesystems")
+	}
+
+	var hadError bool
+	for _, fs := range fss {
+		bold.Printf("INSPECT FILESYSTEM %q\n", fs.ToString())
+		err := doFS(ctx, fs, oldJob, newJob)
+		if err == migrateReplicationCursorSkipSentinel {
+			bold.Printf("FILESYSTEM SKIPPED\n")
+		} else if err != nil {
+			hadError = true
+			fail.Printf("MIGRATION FAILED: %s\n", err)
+		} else {
+			succ.Printf("FILESYSTEM %q COMPLETE\n", fs.ToString())
+		}
+	}
+
+	if hadError {
+		fail.Printf("\n\none or more filesystems could not be migrated, please inspect output and or re-run migration")
+		return errors.Errorf("")
+	}
+	return nil
+}
+
+func doMigrateFailoverPromote(ctx context.Context, sc *cli.Subcommand, args []string) error {
+	return doMigrateFailover(ctx, sc, args, 1, doMigrateFailoverPromoteFS)
+}
+
+// Converts the last-received-hold of oldJob into a replication cursor of newJob.
+func doMigrateFailoverPromoteFS(ctx context.Context, fs *zfs.DatasetPath, oldJob, newJob endpoint.JobID) error {
+	ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, fs)
+	if err != nil {
+		return errors.Wrap(err, "get placeholder state")
+	}
+	if ph.IsPlaceholder {
+		fmt.Printf("filesystem is a placeholder, it will not be served by sending jobs with `strip_prefix`\n")
+		return migrateReplicationCursorSkipSentinel
+	}
+	token, err := zfs.ZFSGetReceiveResumeTokenOrEmptyStringIfNotSupported(ctx, fs)
+	if err != nil {
+		return errors.Wrap(err, "get receive resume token")
+	}
+	if token != "" {
+		return errors.Errorf("filesystem has partially received state, abort it using `zfs recv -A %s`", fs.ToString())
+	}
+
+	fsName := fs.ToString()
+	holds, absErrs, err := endpoint.ListAbstractions(ctx, endpoint.ListZFSHoldsAndBookmarksQuery{
+		FS:          endpoint.ListZFSHoldsAndBookmarksQueryFilesystemFilter{FS: &fsName},
+		What:        endpoint.AbstractionTypeSet{endpoint.AbstractionLastReceivedHold: true},
+		JobID:       &oldJob,
+		Concurrency: 1,
+	})
+	if err != nil {
+		return errors.Wrap(err, "list last-received-holds")
+	}
+	if len(absErrs) > 0 {
+		return endpoint.ListAbstractionsErrors(absErrs)
+	}
+	if len(holds) == 0 {
+		fmt.Printf("no last-received-hold of job %q found\n", oldJob)
+		return migrateReplicationCursorSkipSentinel
+	}
+	sort.Slice(holds, func(i, j int) bool { return holds[i].GetCreateTXG() < holds[j].GetCreateTXG() })
+	lastReceived := holds[len(holds)-1].GetFilesystemVersion()
+	fmt.Printf("last received snapshot: %s\n", lastReceived.FullPath(fsName))
+
+	if migrateFailoverArgs.dryRun {
+		succ.Printf("DRY RUN: would create replication cursor of job %q and release %d last-received-hold(s) of job %q\n", newJob, len(holds), oldJob)
+		return nil
+	}
+
+	// create the cursor before releasing the hold so that the incremental source is always guarded
+	cursor, err := endpoint.CreateReplicationCursor(ctx, fsName, lastReceived, newJob)
+	if err != nil {
+		return errors.Wrap(err, "create replication cursor")
+	}
+	fmt.Printf("created replication cursor %s\n", cursor)
+	for _, h := range holds {
+		if err := h.Destroy(ctx); err != nil {
+			return errors.Wrapf(err, "release %s", h)
+		}
+		fmt.Printf("released %s\n", h)
+	}
+	return nil
+}
+
+func doMigrateFailoverDemote(ctx context.Context, sc *cli.Subcommand, args []string) error {
+	return doMigrateFailover(ctx, sc, args, 0, doMigrateFailoverDemoteFS)
+}
+
+// Places a last-received-hold of newJob on the snapshot that oldJob's replication cursor points to
+// and (optionally) rolls back the filesystem to that snapshot.
+func doMigrateFailoverDemoteFS(ctx context.Context, fs *zfs.DatasetPath, oldJob, newJob endpoint.JobID) error {
+	fsName := fs.ToString()
+	cursor, err := endpoint.GetMostRecentReplicationCursorOfJob(ctx, fsName, oldJob)
+	if err != nil {
+		return errors.Wrap(err, "get replication cursor")
+	}
+	if cursor == nil {
+		fmt.Printf("no replication cursor of job %q found\n", oldJob)
+		return migrateReplicationCursorSkipSentinel
+	}
+
+	snaps, err := zfs.ZFSListFilesystemVersions(ctx, fs, zfs.ListFilesystemVersionsOptions{Types: zfs.Snapshots})
+	if err != nil {
+		return errors.Wrap(err, "list snapshots")
+	}
+	lastReplicated, newer := migrateFailoverSplitAtGUID(snaps, cursor.Guid)
+	if lastReplicated == nil {
+		return errors.Errorf("snapshot of replication cursor %s no longer exists, a full replication is required", cursor.FullPath(fsName))
+	}
+	fmt.Printf("last replicated snapshot: %s\n", lastReplicated.FullPath(fsName))
+	for _, s := range newer {
+		fmt.Printf("newer snapshot: %s\n", s.FullPath(fsName))
+	}
+	if len(newer) > 0 && !migrateFailoverArgs.rollback {
+		return errors.Errorf("%d snapshots are newer than the last replicated snapshot, use --rollback to destroy them", len(newer))
+	}
+
+	if migrateFailoverArgs.dryRun {
+		succ.Printf("DRY RUN: would roll back=%v and create last-received-hold of job %q\n", migrateFailoverArgs.rollback, newJob)
+		return nil
+	}
+
+	if migrateFailoverArgs.rollback {
+		if err := zfs.ZFSRollback(ctx, fs, *lastReplicated, "-r"); err != nil {
+			return errors.Wrap(err, "rollback")
+		}
+		fmt.Printf("rolled back to %s\n", lastReplicated.FullPath(fsName))
+	}
+	hold, err := endpoint.CreateLastReceivedHold(ctx, fsName, *lastReplicated, newJob)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created %s\n", hold)
+	return nil
+}
+
+// Returns the snapshot with the given guid and the snapshots created after it.
+// Returns nil if no snapshot has the given guid.
+func migrateFailoverSplitAtGUID(snaps []zfs.FilesystemVersion, guid uint64) (at *zfs.FilesystemVersion, newer []zfs.FilesystemVersion) {
+	for i := range snaps {
+		if snaps[i].Guid == guid {
+			at = &snaps[i]
+		}
+	}
+	if at == nil {
+		return nil, nil
+	}
+	for _, s := range snaps {
+		if s.CreateTXG > at.CreateTXG {
+			newer = append(newer, s)
+		}
+	}
+	sort.Slice(newer, func(i, j int) bool { return newer[i].CreateTXG < newer[j].CreateTXG })
+	return at, newer
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestMigrateFailoverSplitAtGUID(t *testing.T) {
+	snaps := []zfs.FilesystemVersion{
+		{Type: zfs.Snapshot, Name: "c", Guid: 3, CreateTXG: 30},
+		{Type: zfs.Snapshot, Name: "a", Guid: 1, CreateTXG: 10},
+		{Type: zfs.Snapshot, Name: "d", Guid: 4, CreateTXG: 40},
+		{Type: zfs.Snapshot, Name: "b", Guid: 2, CreateTXG: 20},
+	}
+
+	at, newer := migrateFailoverSplitAtGUID(snaps, 2)
+	require.NotNil(t, at)
+	assert.Equal(t, "b", at.Name)
+	require.Len(t, newer, 2)
+	assert.Equal(t, "c", newer[0].Name)
+	assert.Equal(t, "d", newer[1].Name)
+
+	at, newer = migrateFailoverSplitAtGUID(snaps, 4)
+	require.NotNil(t, at)
+	assert.Empty(t, newer)
+
+	at, newer = migrateFailoverSplitAtGUID(snaps, 23)
+	assert.Nil(t, at)
+	assert.Nil(t, newer)
+}
@@ -0,0 +1,268 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+var MonitorCmd = &cli.Subcommand{
+	Use:   "monitor",
+	Short: "check the state of zrepl's snapshots, for use as a Nagios / Icinga plugin",
+	SetupSubcommands: func() []*cli.Subcommand {
+		return []*cli.Subcommand{
+			monitorSnapshotsCmd,
+		}
+	},
+}
+
+var monitorSnapshotsFlags struct {
+	job                    string
+	prefix                 string
+	countWarn, countCrit   uint
+	latestWarn, latestCrit time.Duration
+	oldestWarn, oldestCrit time.Duration
+}
+
+var monitorSnapshotsCmd = &cli.Subcommand{
+	Use:   "snapshots --job JOB",
+	Short: "check the number and age of the snapshots of the filesystems of JOB and exit with 0 (OK), 1 (WARNING) or 2 (CRITICAL)",
+	Run:   runMonitorSnapshots,
+	SetupFlags: func(f *pflag.FlagSet) {
+		f.StringVar(&monitorSnapshotsFlags.job, "job", "", "the job whose filesystems are checked (required)")
+		f.StringVar(&monitorSnapshotsFlags.prefix, "prefix", "", "only check snapshots with this name prefix (with the threshold flags)")
+		f.UintVar(&monitorSnapshotsFlags.countWarn, "count-warn", 0, "number of snapshots at which a filesystem is WARNING")
+		f.UintVar(&monitorSnapshotsFlags.countCrit, "count-crit", 0, "number of snapshots at which a filesystem is CRITICAL")
+		f.DurationVar(&monitorSnapshotsFlags.latestWarn, "latest-warn", 0, "age of the newest snapshot at which a filesystem is WARNING")
+		f.DurationVar(&monitorSnapshotsFlags.latestCrit, "latest-crit", 0, "age of the newest snapshot at which a filesystem is CRITICAL")
+		f.DurationVar(&monitorSnapshotsFlags.oldestWarn, "oldest-warn", 0, "age of the oldest snapshot at which a filesystem is WARNING")
+		f.DurationVar(&monitorSnapshotsFlags.oldestCrit, "oldest-crit", 0, "age of the oldest snapshot at which a filesystem is CRITICAL")
+	},
+}
+
+func runMonitorSnapshots(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
+	if len(args) != 0 {
+		return errors.New("this subcommand takes no positional arguments")
+	}
+	os.Exit(int(doMonitorSnapshots(ctx, subcommand.Config(), os.Stdout)))
+	return nil
+}
+
+func doMonitorSnapshots(ctx context.Context, conf *config.Config, w io.Writer) checkSeverity {
+	fail := func(format string, args ...interface{}) checkSeverity {
+		fmt.Fprintf(w, "ZREPL %s - %s\n", checkCritical, fmt.Sprintf(format, args...))
+		return checkCritical
+	}
+	if monitorSnapshotsFlags.job == "" {
+		return fail("--job is required")
+	}
+	jobConf, err := conf.Job(monitorSnapshotsFlags.job)
+	if err != nil {
+		return fail("%s", err)
+	}
+	rules, err := monitorSnapshotsRules(jobConf)
+	if err != nil {
+		return fail("%s", err)
+	}
+	fss, err := monitorSnapshotsListFilesystems(ctx, jobConf)
+	if err != nil {
+		return fail("cannot list filesystems of job %q: %s", monitorSnapshotsFlags.job, err)
+	}
+
+	now := time.Now()
+	severity := checkOK
+	var problems []string
+	checked := 0
+	for _, fs := range fss {
+		snaps, err := zfs.ZFSListFilesystemVersions(ctx, fs, zfs.ListFilesystemVersionsOptions{Types: zfs.Snapshots})
+		if err != nil {
+			severity = checkCritical
+			problems = append(problems, fmt.Sprintf("%s: cannot list snapshots: %s", fs.ToString(), err))
+			continue
+		}
+		if len(snaps) == 0 {
+			// placeholders on the receiving side are expected to have no snapshots
+			ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, fs)
+			if err == nil && ph.IsPlaceholder {
+				continue
+			}
+		}
+		checked++
+		s, fsProblems := checkSnapshots(snaps, rules, now)
+		if s > severity {
+			severity = s
+		}
+		for _, p := range fsProblems {
+			problems = append(problems, fmt.Sprintf("%s: %s", fs.ToString(), p))
+		}
+	}
+	writeCheck(w, severity, fmt.Sprintf("%d filesystem(s)", checked), problems)
+	return severity
+}
+
+// monitorSnapshotsRules returns the rules defined by the CLI flags or, if none are set, the job's `monitor` section.
+func monitorSnapshotsRules(jobConf *config.JobEnum) (*config.MonitorSnapshots, error) {
+	f := monitorSnapshotsFlags
+	var rules *config.MonitorSnapshots
+	if f.countWarn > 0 || f.countCrit > 0 || f.latestWarn > 0 || f.latestCrit > 0 || f.oldestWarn > 0 || f.oldestCrit > 0 {
+		rules = &config.MonitorSnapshots{}
+		if f.countWarn > 0 || f.countCrit > 0 {
+			rules.Count = []config.MonitorSnapshotCount{{Prefix: f.prefix, Warning: f.countWarn, Critical: f.countCrit}}
+		}
+		if f.latestWarn > 0 || f.latestCrit > 0 {
+			rules.Latest = []config.MonitorSnapshotAge{{Prefix: f.prefix, Warning: f.latestWarn, Critical: f.latestCrit}}
+		}
+		if f.oldestWarn > 0 || f.oldestCrit > 0 {
+			rules.Oldest = []config.MonitorSnapshotAge{{Prefix: f.prefix, Warning: f.oldestWarn, Critical: f.oldestCrit}}
+		}
+	} else {
+		rules = jobConf.Monitor()
+		if rules == nil {
+			return nil, errors.Errorf("job %q has no `monitor` section and no thresholds were specified on the command line", jobConf.Name())
+		}
+	}
+	for i, r := range rules.Count {
+		if err := r.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "count rule #%d", i)
+		}
+	}
+	for i, r := range rules.Latest {
+		if err := r.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "latest rule #%d", i)
+		}
+	}
+	for i, r := range rules.Oldest {
+		if err := r.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "oldest rule #%d", i)
+		}
+	}
+	return rules, nil
+}
+
+// monitorSnapshotsListFilesystems returns the local filesystems of the job:
+// the filesystems matched by `filesystems` for jobs that create snapshots,
+// the filesystems below `root_fs` for jobs that receive them.
+func monitorSnapshotsListFilesystems(ctx context.Context, jobConf *config.JobEnum) ([]*zfs.DatasetPath, error) {
+	var fsfConf config.FilesystemsFilter
+	var rootFS string
+	switch j := jobConf.Ret.(type) {
+	case *config.SnapJob:
+		fsfConf = j.Filesystems
+	case *config.PushJob:
+		fsfConf = j.Filesystems
+	case *config.SourceJob:
+		fsfConf = j.Filesystems
+	case *config.PullJob:
+		rootFS = j.RootFS
+	case *config.SinkJob:
+		rootFS = j.RootFS
+	default:
+		return nil, errors.Errorf("job type %T has no local snapshots", j)
+	}
+
+	var filter zfs.DatasetFilter
+	if rootFS != "" {
+		root, err := zfs.NewDatasetPath(rootFS)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid root_fs")
+		}
+		filter = belowRootFSFilter{root}
+	} else {
+		fsf, err := filters.DatasetMapFilterFromConfig(fsfConf)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build filesystem filter")
+		}
+		filter = fsf
+	}
+	fss, err := zfs.ZFSListMapping(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(fss, func(i, j int) bool { return fss[i].ToString() < fss[j].ToString() })
+	return fss, nil
+}
+
+type belowRootFSFilter struct {
+	root *zfs.DatasetPath
+}
+
+func (f belowRootFSFilter) Filter(p *zfs.DatasetPath) (bool, error) {
+	return p.HasPrefix(f.root) && !p.Equal(f.root), nil
+}
+
+// checkSnapshots checks the snapshots of a single filesystem against rules
+// and returns the resulting severity and a description of each violated threshold.
+func checkSnapshots(snaps []zfs.FilesystemVersion, rules *config.MonitorSnapshots, now time.Time) (severity checkSeverity, problems []string) {
+	violation := func(s checkSeverity, format string, args ...interface{}) {
+		if s > severity {
+			severity = s
+		}
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	matching := func(prefix string) (n int, oldest, newest *zfs.FilesystemVersion) {
+		for i := range snaps {
+			s := &snaps[i]
+			if !strings.HasPrefix(s.Name, prefix) {
+				continue
+			}
+			n++
+			if oldest == nil || s.CreateTXG < oldest.CreateTXG {
+				oldest = s
+			}
+			if newest == nil || s.CreateTXG > newest.CreateTXG {
+				newest = s
+			}
+		}
+		return n, oldest, newest
+	}
+	describe := func(prefix string) string {
+		if prefix == "" {
+			return "snapshots"
+		}
+		return fmt.Sprintf("snapshots with prefix %q", prefix)
+	}
+
+	for _, r := range rules.Count {
+		n, _, _ := matching(r.Prefix)
+		if r.Critical > 0 && n >= int(r.Critical) {
+			violation(checkCritical, "%d %s (critical: %d)", n, describe(r.Prefix), r.Critical)
+		} else if r.Warning > 0 && n >= int(r.Warning) {
+			violation(checkWarning, "%d %s (warning: %d)", n, describe(r.Prefix), r.Warning)
+		}
+	}
+	checkAge := func(rules []config.MonitorSnapshotAge, which string, pick func(oldest, newest *zfs.FilesystemVersion) *zfs.FilesystemVersion) {
+		for _, r := range rules {
+			_, oldest, newest := matching(r.Prefix)
+			v := pick(oldest, newest)
+			if v == nil {
+				if which == "newest" && r.Critical > 0 {
+					violation(checkCritical, "no %s", describe(r.Prefix))
+				} else if which == "newest" {
+					violation(checkWarning, "no %s", describe(r.Prefix))
+				}
+				continue
+			}
+			age := now.Sub(v.Creation)
+			if r.Critical > 0 && age >= r.Critical {
+				violation(checkCritical, "%s of %s %s is %s old (critical: %s)", which, describe(r.Prefix), v.Name, age.Round(time.Second), r.Critical)
+			} else if r.Warning > 0 && age >= r.Warning {
+				violation(checkWarning, "%s of %s %s is %s old (warning: %s)", which, describe(r.Prefix), v.Name, age.Round(time.Second), r.Warning)
+			}
+		}
+	}
+	checkAge(rules.Latest, "newest", func(_, newest *zfs.FilesystemVersion) *zfs.FilesystemVersion { return newest })
+	checkAge(rules.Oldest, "oldest", func(oldest, _ *zfs.FilesystemVersion) *zfs.FilesystemVersion { return oldest })
+	return severity, problems
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestCheckSnapshots(t *testing.T) {
+	now := time.Date(2020, 1, 10, 0, 0, 0, 0, time.UTC)
+	snap := func(name string, txg uint64, age time.Duration) zfs.FilesystemVersion {
+		return zfs.FilesystemVersion{Type: zfs.Snapshot, Name: name, CreateTXG: txg, Creation: now.Add(-age)}
+	}
+	snaps := []zfs.FilesystemVersion{
+		snap("zrepl_1", 1, 72*time.Hour),
+		snap("manual", 2, 48*time.Hour),
+		snap("zrepl_2", 3, 3*time.Hour),
+	}
+
+	tcs := []struct {
+		name     string
+		snaps    []zfs.FilesystemVersion
+		rules    config.MonitorSnapshots
+		severity checkSeverity
+		problems int
+	}{
+		{"no_rules", snaps, config.MonitorSnapshots{}, checkOK, 0},
+		{"count_ok", snaps, config.MonitorSnapshots{Count: []config.MonitorSnapshotCount{{Warning: 4, Critical: 5}}}, checkOK, 0},
+		{"count_warn", snaps, config.MonitorSnapshots{Count: []config.MonitorSnapshotCount{{Warning: 3, Critical: 5}}}, checkWarning, 1},
+		{"count_crit_prefix", snaps, config.MonitorSnapshots{Count: []config.MonitorSnapshotCount{{Prefix: "zrepl_", Critical: 2}}}, checkCritical, 1},
+		{"latest_ok", snaps, config.MonitorSnapshots{Latest: []config.MonitorSnapshotAge{{Critical: 4 * time.Hour}}}, checkOK, 0},
+		{"latest_warn", snaps, config.MonitorSnapshots{Latest: []config.MonitorSnapshotAge{{Warning: 2 * time.Hour, Critical: 4 * time.Hour}}}, checkWarning, 1},
+		{"latest_prefix_crit", snaps, config.MonitorSnapshots{Latest: []config.MonitorSnapshotAge{{Prefix: "manual", Critical: 24 * time.Hour}}}, checkCritical, 1},
+		{"latest_missing", snaps, config.MonitorSnapshots{Latest: []config.MonitorSnapshotAge{{Prefix: "other", Critical: time.Hour}}}, checkCritical, 1},
+		{"latest_no_snapshots", nil, config.MonitorSnapshots{Latest: []config.MonitorSnapshotAge{{Critical: time.Hour}}}, checkCritical, 1},
+		{"oldest_crit", snaps, config.MonitorSnapshots{Oldest: []config.MonitorSnapshotAge{{Critical: 48 * time.Hour}}}, checkCritical, 1},
+		{"oldest_missing_ok", nil, config.MonitorSnapshots{Oldest: []config.MonitorSnapshotAge{{Critical: time.Hour}}}, checkOK, 0},
+		{"count_warn_only", snaps, config.MonitorSnapshots{Count: []config.MonitorSnapshotCount{{Warning: 3}}}, checkWarning, 1},
+		{"count_crit_only_ok", snaps, config.MonitorSnapshots{Count: []config.MonitorSnapshotCount{{Critical: 4}}}, checkOK, 0},
+		{"latest_warn_only", snaps, config.MonitorSnapshots{Latest: []config.MonitorSnapshotAge{{Warning: 2 * time.Hour}}}, checkWarning, 1},
+		{"latest_warn_only_missing", nil, config.MonitorSnapshots{Latest: []config.MonitorSnapshotAge{{Warning: 2 * time.Hour}}}, checkWarning, 1},
+		{"worst_wins", snaps, config.MonitorSnapshots{
+			Count:  []config.MonitorSnapshotCount{{Warning: 3, Critical: 5}},
+			Oldest: []config.MonitorSnapshotAge{{Prefix: "zrepl_", Critical: 48 * time.Hour}},
+		}, checkCritical, 2},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			severity, problems := checkSnapshots(tc.snaps, &tc.rules, now)
+			assert.Equal(t, tc.severity, severity)
+			assert.Len(t, problems, tc.problems, "%v", problems)
+		})
+	}
+}
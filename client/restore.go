@@ -0,0 +1,212 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/rpc"
+	"github.com/zrepl/zrepl/transport/fromconfig"
+	"github.com/zrepl/zrepl/util/bytecounter"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+var restoreArgs struct {
+	dryRun bool
+}
+
+var RestoreCmd = &cli.Subcommand{
+	Use:   "restore JOB FILESYSTEM[@SNAPSHOT] TARGET",
+	Short: "restore FILESYSTEM from the backup made by push or pull job JOB into the new local dataset TARGET",
+	Run:   runRestoreCmd,
+	SetupFlags: func(f *pflag.FlagSet) {
+		f.BoolVar(&restoreArgs.dryRun, "dry-run", false, "determine the snapshot to restore and its size, but do not receive it")
+	},
+}
+
+// the subset of the endpoint methods required for restore
+type restoreSource interface {
+	ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error)
+	ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error)
+	Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.ReadCloser, error)
+}
+
+func runRestoreCmd(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
+	if len(args) != 3 {
+		return errors.New("expected 3 arguments: JOB FILESYSTEM[@SNAPSHOT] TARGET")
+	}
+	conf := subcommand.Config()
+
+	fs, snapName := args[1], ""
+	if i := strings.Index(fs, "@"); i != -1 {
+		fs, snapName = fs[:i], fs[i+1:]
+		if snapName == "" {
+			return errors.New("snapshot name must not be empty")
+		}
+	}
+	fsPath, err := zfs.NewDatasetPath(fs)
+	if err != nil {
+		return errors.Wrap(err, "invalid filesystem")
+	}
+	target, err := zfs.NewDatasetPath(args[2])
+	if err != nil {
+		return errors.Wrap(err, "invalid target")
+	}
+
+	source, closeSource, err := restoreSourceFromConfig(ctx, conf, args[0], fsPath, target)
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+
+	// conflict checks
+	targetState, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, target)
+	if err != nil {
+		return errors.Wrap(err, "cannot determine whether target exists")
+	}
+	if targetState.FSExists {
+		return errors.Errorf("target %q exists, refusing to overwrite it (restore into a new dataset and rename it instead)", target.ToString())
+	}
+
+	fss, err := source.ListFilesystems(ctx, &pdu.ListFilesystemReq{})
+	if err != nil {
+		return errors.Wrap(err, "cannot list backed up filesystems")
+	}
+	var found *pdu.Filesystem
+	for _, f := range fss.GetFilesystems() {
+		if f.GetPath() == fs {
+			found = f
+		}
+	}
+	if found == nil {
+		return errors.Errorf("filesystem %q has not been backed up by job %q", fs, args[0])
+	}
+	if found.GetIsPlaceholder() {
+		return errors.Errorf("filesystem %q is a placeholder in the backup, there is nothing to restore", fs)
+	}
+
+	vres, err := source.ListFilesystemVersions(ctx, &pdu.ListFilesystemVersionsReq{Filesystem: fs})
+	if err != nil {
+		return errors.Wrap(err, "cannot list snapshots of backup")
+	}
+	snap, err := restoreSelectSnapshot(vres.GetVersions(), snapName)
+	if err != nil {
+		return err
+	}
+
+	sendReq := &pdu.SendReq{
+		Filesystem: fs,
+		To:         snap,
+		Encrypted:  pdu.Tri_DontCare,
+		DryRun:     true,
+	}
+	dryRes, _, err := source.Send(ctx, sendReq)
+	if err != nil {
+		return errors.Wrap(err, "dry run send failed")
+	}
+	fmt.Printf("restoring %s%s to %s (expected size: %s)\n", fs, snap.RelName(), target.ToString(), ByteCountBinary(dryRes.GetExpectedSize()))
+	if restoreArgs.dryRun {
+		fmt.Printf("dry run, not receiving\n")
+		return nil
+	}
+
+	sendReq.DryRun = false
+	_, stream, err := source.Send(ctx, sendReq)
+	if err != nil {
+		return errors.Wrap(err, "send failed")
+	}
+	if stream == nil {
+		return errors.New("send did not return a stream")
+	}
+	counter := bytecounter.NewReadCloser(stream)
+	defer counter.Close()
+
+	to := &zfs.ZFSSendArgVersion{RelName: snap.GetRelName(), GUID: snap.GetGuid()}
+	if err := zfs.ZFSRecv(ctx, target.ToString(), to, counter, zfs.RecvOptions{}); err != nil {
+		return errors.Wrap(err, "receive failed")
+	}
+	fmt.Printf("restore complete, received %s\n", ByteCountBinary(counter.Count()))
+	return nil
+}
+
+func restoreSourceFromConfig(ctx context.Context, conf *config.Config, jobName string, fs, target *zfs.DatasetPath) (_ restoreSource, close func(), err error) {
+	jobConf, err := conf.Job(jobName)
+	if err != nil {
+		return nil, nil, err
+	}
+	jobID, err := endpoint.MakeJobID(jobName)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid job name")
+	}
+
+	switch j := jobConf.Ret.(type) {
+	case *config.PushJob:
+		// the sink maps fs to its receive-side path based on our client identity
+		fsf, err := filters.DatasetMapFilterFromConfig(j.Filesystems)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "cannot build filesystem filter")
+		}
+		if pass, err := fsf.Filter(fs); err != nil || !pass {
+			return nil, nil, errors.Errorf("filesystem %q is not replicated by job %q", fs.ToString(), jobName)
+		}
+		connecter, err := fromconfig.ConnecterFromConfig(conf.Global, j.Connect)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "cannot build client")
+		}
+		client := rpc.NewClient(connecter, rpc.GetLoggersOrPanic(ctx))
+		return client, client.Close, nil
+
+	case *config.PullJob:
+		// the backup is local, in root_fs
+		rootFS, err := zfs.NewDatasetPath(j.RootFS)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "invalid root_fs")
+		}
+		if target.HasPrefix(rootFS) {
+			return nil, nil, errors.Errorf("target must not be inside root_fs %q of job %q", rootFS.ToString(), jobName)
+		}
+		receiver := endpoint.NewReceiver(endpoint.ReceiverConfig{
+			JobID:                      jobID,
+			RootWithoutClientComponent: rootFS,
+			AppendClientIdentity:       false,
+			AllowRestore:               true,
+		})
+		return receiver, func() {}, nil
+
+	default:
+		return nil, nil, errors.Errorf("job %q is of type %T, restore is only supported for push and pull jobs", jobName, jobConf.Ret)
+	}
+}
+
+// Returns the snapshot named snapName or the most recent snapshot if snapName is empty.
+func restoreSelectSnapshot(versions []*pdu.FilesystemVersion, snapName string) (*pdu.FilesystemVersion, error) {
+	var snaps []*pdu.FilesystemVersion
+	for _, v := range versions {
+		if v.GetType() == pdu.FilesystemVersion_Snapshot {
+			snaps = append(snaps, v)
+		}
+	}
+	if len(snaps) == 0 {
+		return nil, errors.New("backup does not have any snapshots")
+	}
+	if snapName == "" {
+		sort.Slice(snaps, func(i, j int) bool { return snaps[i].GetCreateTXG() < snaps[j].GetCreateTXG() })
+		return snaps[len(snaps)-1], nil
+	}
+	for _, s := range snaps {
+		if s.GetName() == snapName {
+			return s, nil
+		}
+	}
+	return nil, errors.Errorf("snapshot %q does not exist in backup", snapName)
+}
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestRestoreSelectSnapshot(t *testing.T) {
+	vs := []*pdu.FilesystemVersion{
+		{Type: pdu.FilesystemVersion_Snapshot, Name: "b", CreateTXG: 20},
+		{Type: pdu.FilesystemVersion_Bookmark, Name: "c", CreateTXG: 30},
+		{Type: pdu.FilesystemVersion_Snapshot, Name: "a", CreateTXG: 10},
+	}
+
+	v, err := restoreSelectSnapshot(vs, "")
+	require.NoError(t, err)
+	assert.Equal(t, "b", v.Name)
+
+	v, err = restoreSelectSnapshot(vs, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "a", v.Name)
+
+	_, err = restoreSelectSnapshot(vs, "c") // bookmarks cannot be restored
+	assert.Error(t, err)
+
+	_, err = restoreSelectSnapshot(nil, "")
+	assert.Error(t, err)
+}
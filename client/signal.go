@@ -11,16 +11,23 @@ import (
 )
 
 var SignalCmd = &cli.Subcommand{
-	Use:   "signal [wakeup|reset] JOB",
-	Short: "wake up a job from wait state or abort its current invocation",
+	Use:   "signal [wakeup|reset|confirm|override|pause|resume] JOB [TOKEN]",
+	Short: "wake up a job from wait state, abort its current invocation, confirm the replication of new filesystems or a pruning pass (TOKEN), override its guardrails once or pause/resume its replication streams",
 	Run: func(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
 		return runSignalCmd(subcommand.Config(), args)
 	},
 }
 
 func runSignalCmd(config *config.Config, args []string) error {
-	if len(args) != 2 {
-		return errors.Errorf("Expected 2 arguments: [wakeup|reset] JOB")
+	if len(args) == 3 && args[0] != "confirm" {
+		return errors.Errorf("TOKEN is only valid for signal confirm")
+	}
+	if len(args) != 2 && len(args) != 3 {
+		return errors.Errorf("Expected 2 arguments: [wakeup|reset|confirm|override|pause|resume] JOB [TOKEN]")
+	}
+	var token string
+	if len(args) == 3 {
+		token = args[2]
 	}
 
 	httpc, err := controlHttpClient(config.Global.Control.SockPath)
@@ -30,11 +37,13 @@ func runSignalCmd(config *config.Config, args []string) error {
 
 	err = jsonRequestResponse(httpc, daemon.ControlJobEndpointSignal,
 		struct {
-			Name string
-			Op   string
+			Name  string
+			Op    string
+			Token string
 		}{
-			Name: args[1],
-			Op:   args[0],
+			Name:  args[1],
+			Op:    args[0],
+			Token: token,
 		},
 		struct{}{},
 	)
@@ -26,6 +26,7 @@ import (
 
 	"github.com/zrepl/zrepl/cli"
 	"github.com/zrepl/zrepl/daemon"
+	"github.com/zrepl/zrepl/daemon/hooks"
 	"github.com/zrepl/zrepl/daemon/job"
 	"github.com/zrepl/zrepl/daemon/pruner"
 	"github.com/zrepl/zrepl/daemon/snapper"
@@ -81,9 +82,10 @@ type tui struct {
 	x, y   int
 	indent int
 
-	lock   sync.Mutex //For report and error
-	report map[string]*job.Status
-	err    error
+	lock    sync.Mutex //For report and error
+	report  map[string]*job.Status
+	runtime *daemon.RuntimeStatus
+	err     error
 
 	jobFilter string
 
@@ -167,8 +169,11 @@ func (t *tui) addIndent(indent int) {
 }
 
 var statusFlags struct {
-	Raw bool
-	Job string
+	Raw      bool
+	Job      string
+	Check    bool
+	Observer bool
+	checkThresholds
 }
 
 var StatusCmd = &cli.Subcommand{
@@ -177,12 +182,25 @@ var StatusCmd = &cli.Subcommand{
 	SetupFlags: func(f *pflag.FlagSet) {
 		f.BoolVar(&statusFlags.Raw, "raw", false, "dump raw status description from zrepl daemon")
 		f.StringVar(&statusFlags.Job, "job", "", "only dump specified job")
+		f.BoolVar(&statusFlags.Check, "check", false, "check the status of the jobs and exit with 0 (OK), 1 (WARNING) or 2 (CRITICAL), for use as a Nagios / Icinga plugin")
+		f.BoolVar(&statusFlags.Observer, "observer", false, "connect to the read-only observer socket (global.control.observer_sockpath) instead of the control socket")
+		f.IntVar(&statusFlags.WarnErrors, "warn-errors", 1, "with --check: number of errors of a job at which it is WARNING (0 disables)")
+		f.IntVar(&statusFlags.CritErrors, "crit-errors", 0, "with --check: number of errors of a job at which it is CRITICAL (0 disables)")
+		f.DurationVar(&statusFlags.WarnStale, "warn-stale", 0, "with --check: time since the latest replication of a push or pull job finished at which it is WARNING (0 disables)")
+		f.DurationVar(&statusFlags.CritStale, "crit-stale", 0, "with --check: time since the latest replication of a push or pull job finished at which it is CRITICAL (0 disables)")
 	},
 	Run: runStatus,
 }
 
 func runStatus(ctx context.Context, s *cli.Subcommand, args []string) error {
-	httpc, err := controlHttpClient(s.Config().Global.Control.SockPath)
+	sockpath := s.Config().Global.Control.SockPath
+	if statusFlags.Observer {
+		sockpath = s.Config().Global.Control.ObserverSockPath
+		if sockpath == "" {
+			return errors.New("--observer requires global.control.observer_sockpath to be configured")
+		}
+	}
+	httpc, err := controlHttpClient(sockpath)
 	if err != nil {
 		return err
 	}
@@ -207,6 +225,10 @@ func runStatus(ctx context.Context, s *cli.Subcommand, args []string) error {
 		return nil
 	}
 
+	if statusFlags.Check {
+		os.Exit(int(runStatusCheck(httpc, os.Stdout)))
+	}
+
 	t := newTui()
 	t.lock.Lock()
 	t.err = errors.New("Got no report yet")
@@ -230,6 +252,7 @@ func runStatus(ctx context.Context, s *cli.Subcommand, args []string) error {
 		t.lock.Lock()
 		t.err = err2
 		t.report = m.Jobs
+		t.runtime = m.Global.Runtime
 		t.lock.Unlock()
 		t.draw()
 	}
@@ -265,6 +288,28 @@ loop:
 
 }
 
+// runStatusCheck writes the result of checkStatus to w and returns its severity, which is the exit code of `zrepl status --check`.
+func runStatusCheck(httpc http.Client, w io.Writer) checkSeverity {
+	var m daemon.Status
+	err := jsonRequestResponse(httpc, daemon.ControlJobEndpointStatus, struct{}{}, &m)
+	if err != nil {
+		fmt.Fprintf(w, "ZREPL %s - cannot get status from daemon: %s\n", checkCritical, err)
+		return checkCritical
+	}
+	jobs := m.Jobs
+	if statusFlags.Job != "" {
+		s, ok := m.Jobs[statusFlags.Job]
+		if !ok {
+			fmt.Fprintf(w, "ZREPL %s - job %q does not exist\n", checkCritical, statusFlags.Job)
+			return checkCritical
+		}
+		jobs = map[string]*job.Status{statusFlags.Job: s}
+	}
+	res := checkStatus(jobs, time.Now(), statusFlags.checkThresholds)
+	res.write(w)
+	return res.Severity
+}
+
 func (t *tui) getReplicationProgressHistory(jobName string) *bytesProgressHistory {
 	p, ok := t.replicationProgress[jobName]
 	if !ok {
@@ -286,6 +331,11 @@ func (t *tui) draw() {
 	if t.err != nil {
 		t.write(t.err.Error())
 	} else {
+		if t.runtime != nil {
+			t.renderRuntimeStatus(t.runtime)
+			t.newline()
+		}
+
 		//Iterate over map in alphabetical order
 		keys := make([]string, 0, len(t.report))
 		for k := range t.report {
@@ -318,6 +368,18 @@ func (t *tui) draw() {
 			t.printf("Type: %s", v.Type)
 			t.setIndent(1)
 			t.newline()
+			if len(v.WaitingForJobs) > 0 {
+				t.printf("Waiting for jobs: %s", strings.Join(v.WaitingForJobs, ", "))
+				t.newline()
+			}
+			if v.Paused {
+				t.printf("Replication streams are paused, resume with `zrepl signal resume %s`", k)
+				t.newline()
+			}
+			if v.BlackoutUntil != nil {
+				t.printf("In blackout window until %s, not starting new invocations", v.BlackoutUntil.Format(time.RFC3339))
+				t.newline()
+			}
 
 			if v.Type == job.TypePush || v.Type == job.TypePull {
 				activeStatus, ok := v.JobSpecific.(*job.ActiveSideStatus)
@@ -327,10 +389,32 @@ func (t *tui) draw() {
 					continue
 				}
 
+				if activeStatus.InvocationError != "" {
+					t.printfDrawIndentedAndWrappedIfMultiline("Invocation failed: %s", activeStatus.InvocationError)
+					t.newline()
+				}
+
 				t.printf("Replication:")
 				t.newline()
 				t.addIndent(1)
 				t.renderReplicationReport(activeStatus.Replication, t.getReplicationProgressHistory(k))
+				if len(activeStatus.NewFilesystemsAwaitingConfirmation) > 0 {
+					t.printf("New filesystems awaiting confirmation (zrepl signal confirm %s):", k)
+					t.newline()
+					t.addIndent(1)
+					for _, fs := range activeStatus.NewFilesystemsAwaitingConfirmation {
+						t.printf("%s", fs)
+						t.newline()
+					}
+					t.addIndent(-1)
+				}
+				if d := activeStatus.Delta; d != nil && !d.Empty() {
+					t.printf("Changes since previous invocation:")
+					t.newline()
+					t.addIndent(1)
+					t.renderInvocationDelta(d)
+					t.addIndent(-1)
+				}
 				t.addIndent(-1)
 
 				t.printf("Pruning Sender:")
@@ -370,6 +454,30 @@ func (t *tui) draw() {
 				t.addIndent(1)
 				t.renderSnapperReport(snapStatus.Snapshotting)
 				t.addIndent(-1)
+			} else if v.Type == job.TypeVerify {
+				verifyStatus, ok := v.JobSpecific.(*job.VerifyJobStatus)
+				if !ok || verifyStatus == nil {
+					t.printf("VerifyJobStatus is null")
+					t.newline()
+					continue
+				}
+				t.printf("Verification:")
+				t.newline()
+				t.addIndent(1)
+				t.renderVerifyReport(verifyStatus.Report)
+				t.addIndent(-1)
+			} else if v.Type == job.TypeTestRestore {
+				trStatus, ok := v.JobSpecific.(*job.TestRestoreJobStatus)
+				if !ok || trStatus == nil {
+					t.printf("TestRestoreJobStatus is null")
+					t.newline()
+					continue
+				}
+				t.printf("Test Restore:")
+				t.newline()
+				t.addIndent(1)
+				t.renderTestRestoreReport(trStatus.Report)
+				t.addIndent(-1)
 			} else if v.Type == job.TypeSource {
 
 				st := v.JobSpecific.(*job.PassiveStatus)
@@ -396,6 +504,14 @@ func (t *tui) draw() {
 	termbox.Flush()
 }
 
+func (t *tui) renderRuntimeStatus(r *daemon.RuntimeStatus) {
+	t.printf("Daemon: up %s, %d goroutines, heap %s of %s, %d active zfs commands",
+		humanizeDuration(r.Uptime), r.Goroutines,
+		ByteCountBinary(int64(r.HeapAlloc)), ByteCountBinary(int64(r.HeapSys)),
+		r.ActiveZFSCmds)
+	t.newline()
+}
+
 func (t *tui) renderReplicationReport(rep *report.Report, history *bytesProgressHistory) {
 	if rep == nil {
 		t.printf("...\n")
@@ -406,6 +522,11 @@ func (t *tui) renderReplicationReport(rep *report.Report, history *bytesProgress
 		t.printfDrawIndentedAndWrappedIfMultiline("Connectivity: %s", rep.WaitReconnectError)
 		t.newline()
 	}
+	if !rep.WaitServerBusyUntil.IsZero() {
+		t.printfDrawIndentedAndWrappedIfMultiline("Connectivity: server is busy, retrying in %s @ %s",
+			time.Until(rep.WaitServerBusyUntil).Round(time.Second), rep.WaitServerBusyUntil)
+		t.newline()
+	}
 	if !rep.WaitReconnectSince.IsZero() {
 		delta := time.Until(rep.WaitReconnectUntil).Round(time.Second)
 		if rep.WaitReconnectUntil.IsZero() || delta > 0 {
@@ -495,6 +616,29 @@ func (t *tui) renderReplicationReport(rep *report.Report, history *bytesProgress
 			t.printFilesystemStatus(fs, false, maxFSLen) // FIXME bring 'active' flag back
 		}
 
+		if len(latest.OrphanedFilesystems) > 0 {
+			t.newline()
+			t.printf("Orphaned receiver filesystems (no corresponding sender filesystem):\n")
+			t.addIndent(1)
+			var maxOrphanLen int
+			for _, o := range latest.OrphanedFilesystems {
+				if len(o.Name) > maxOrphanLen {
+					maxOrphanLen = len(o.Name)
+				}
+			}
+			for _, o := range latest.OrphanedFilesystems {
+				newest := "newest snapshot n/a"
+				if o.NewestSnapshot != "" {
+					newest = fmt.Sprintf("newest snapshot %s", o.NewestSnapshot)
+					if !o.NewestSnapshotCreation.IsZero() {
+						newest += fmt.Sprintf(" (%s)", o.NewestSnapshotCreation.Format(time.RFC3339))
+					}
+				}
+				t.printf("%s %-9s %s\n", rightPad(o.Name, maxOrphanLen, " "), o.Kind, newest)
+			}
+			t.addIndent(-1)
+		}
+
 	}
 
 }
@@ -607,6 +751,120 @@ func (t *tui) renderPrunerReport(r *pruner.Report) {
 
 }
 
+func (t *tui) renderVerifyReport(r *job.VerifyReport) {
+	if r == nil {
+		t.printf("...\n")
+		return
+	}
+
+	if r.FinishAt.IsZero() {
+		t.printf("Status: running since %s", r.StartAt)
+	} else {
+		t.printf("Status: done (started %s, ran %s)", r.StartAt, r.FinishAt.Sub(r.StartAt).Round(time.Second))
+	}
+	t.newline()
+	if r.Error != "" {
+		t.printf("Error: %s\n", r.Error)
+		return
+	}
+	if mismatches := r.Mismatches(); mismatches > 0 {
+		t.printf("Problem: %d snapshot(s) with mismatching checksums", mismatches)
+		t.newline()
+	}
+
+	var maxFSLen int
+	for _, fs := range r.Filesystems {
+		if len(fs.Filesystem) > maxFSLen {
+			maxFSLen = len(fs.Filesystem)
+		}
+	}
+	for _, fs := range r.Filesystems {
+		t.printf("%s ", rightPad(fs.Filesystem, maxFSLen, " "))
+		if fs.Error != "" {
+			t.printfDrawIndentedAndWrappedIfMultiline("ERROR: %s", fs.Error)
+			t.newline()
+			continue
+		}
+		var mismatching []string
+		for _, v := range fs.Versions {
+			if !v.Match() {
+				mismatching = append(mismatching, v.Version)
+			}
+		}
+		if len(mismatching) > 0 {
+			t.printf("MISMATCH: %s", strings.Join(mismatching, ", "))
+		} else {
+			t.printf("OK (%d snapshot(s) verified)", len(fs.Versions))
+		}
+		t.newline()
+	}
+}
+
+func (t *tui) renderInvocationDelta(d *job.InvocationDelta) {
+	for _, c := range []struct {
+		title string
+		fss   []string
+	}{
+		{"newly failing", d.NewlyFailing},
+		{"recovered", d.Recovered},
+		{"new", d.New},
+		{"vanished", d.Vanished},
+	} {
+		if len(c.fss) == 0 {
+			continue
+		}
+		t.printfDrawIndentedAndWrappedIfMultiline("%s: %s", c.title, strings.Join(c.fss, ", "))
+		t.newline()
+	}
+}
+
+func (t *tui) renderTestRestoreReport(r *job.TestRestoreReport) {
+	if r == nil {
+		t.printf("...\n")
+		return
+	}
+
+	if r.FinishAt.IsZero() {
+		t.printf("Status: running since %s", r.StartAt)
+	} else {
+		t.printf("Status: done (started %s, ran %s)", r.StartAt, r.FinishAt.Sub(r.StartAt).Round(time.Second))
+	}
+	t.newline()
+	if r.Error != "" {
+		t.printf("Error: %s\n", r.Error)
+		return
+	}
+	if failures := r.Failures(); failures > 0 {
+		t.printf("Problem: %d filesystem(s) failed the test restore", failures)
+		t.newline()
+	}
+
+	var maxFSLen int
+	for _, fs := range r.Filesystems {
+		if len(fs.Filesystem) > maxFSLen {
+			maxFSLen = len(fs.Filesystem)
+		}
+	}
+	for _, fs := range r.Filesystems {
+		t.printf("%s ", rightPad(fs.Filesystem, maxFSLen, " "))
+		switch {
+		case fs.Error != "":
+			t.printfDrawIndentedAndWrappedIfMultiline("ERROR: %s", fs.Error)
+			if fs.Output != "" {
+				t.newline()
+				t.addIndent(1)
+				t.printfDrawIndentedAndWrappedIfMultiline("%s", strings.TrimRight(fs.Output, "\n"))
+				t.addIndent(-1)
+			}
+		case fs.Snapshot == "":
+			t.printf("...")
+		default:
+			t.printf("OK (%s)", fs.Snapshot)
+		}
+		t.newline()
+	}
+}
+
 func (t *tui) renderSnapperReport(r *snapper.Report) {
 	if r == nil {
 		t.printf("<snapshot type does not have a report>\n")
@@ -622,6 +880,13 @@ func (t *tui) renderSnapperReport(r *snapper.Report) {
 	if !r.SleepUntil.IsZero() {
 		t.printf("Sleep until: %s\n", r.SleepUntil)
 	}
+	for _, fs := range r.Stalled {
+		t.printf("Stalled: %s (no new snapshot since %s)\n", fs.Path, fs.NewestSnapshot.Round(time.Second))
+	}
+	for _, fs := range r.RateOfChangeExceeded {
+		t.printf("Rate of change: %s@%s wrote %s since previous snapshot (threshold %s)\n",
+			fs.Path, fs.Snapshot, ByteCountBinary(int64(fs.Written)), ByteCountBinary(int64(fs.Threshold)))
+	}
 
 	sort.Slice(r.Progress, func(i, j int) bool {
 		return strings.Compare(r.Progress[i].Path, r.Progress[j].Path) == -1
@@ -635,6 +900,7 @@ func (t *tui) renderSnapperReport(r *snapper.Report) {
 
 	type row struct {
 		path, state, duration, remainder, hookReport string
+		hookFailures                                 []hooks.StepFailure
 	}
 	var widths struct {
 		path, state, duration int
@@ -647,6 +913,7 @@ func (t *tui) renderSnapperReport(r *snapper.Report) {
 		}
 		if fs.HooksHadError {
 			r.hookReport = fs.Hooks // FIXME render here, not in daemon
+			r.hookFailures = fs.HookFailures
 		}
 		switch fs.State {
 		case snapper.SnapPending:
@@ -682,6 +949,7 @@ func (t *tui) renderSnapperReport(r *snapper.Report) {
 		if r.hookReport != "" {
 			t.printfDrawIndentedAndWrappedIfMultiline("%s", r.hookReport)
 		}
+		t.renderHookFailures(r.hookFailures)
 		t.newline()
 	}
 
@@ -694,6 +962,24 @@ func times(str string, n int) (out string) {
 	return
 }
 
+// The hook output can be long, hence it is only shown if a single job is selected.
+func (t *tui) renderHookFailures(failures []hooks.StepFailure) {
+	for _, f := range failures {
+		if f.Output == "" {
+			continue
+		}
+		if t.jobFilter == "" {
+			t.printfDrawIndentedAndWrappedIfMultiline("hook %02d: output available with --job", f.Step)
+			continue
+		}
+		truncated := ""
+		if f.OutputTruncated {
+			truncated = ", truncated"
+		}
+		t.printfDrawIndentedAndWrappedIfMultiline("hook %02d [%s] %s output (stdout+stderr%s):\n%s", f.Step, f.Edge, f.Hook, truncated, strings.TrimRight(f.Output, "\n"))
+	}
+}
+
 func rightPad(str string, length int, pad string) string {
 	if len(str) > length {
 		return str[:length]
@@ -740,6 +1026,16 @@ func (t *tui) printFilesystemStatus(rep *report.FilesystemReport, active bool, m
 		sizeEstimationImpreciseNotice,
 	)
 
+	if rep.State != report.FilesystemDone {
+		if d, ok := rep.PredictedRemaining(); ok && d > 0 {
+			status += fmt.Sprintf(" (predicted: %s)", humanizeDuration(d))
+		}
+	}
+
+	if rep.Info.IsNew {
+		status += " (new filesystem)"
+	}
+
 	activeIndicator := " "
 	if active {
 		activeIndicator = "*"
@@ -752,6 +1048,8 @@ func (t *tui) printFilesystemStatus(rep *report.FilesystemReport, active bool, m
 	next := ""
 	if err := rep.Error(); err != nil {
 		next = err.Err
+	} else if rep.State == report.FilesystemSkipped {
+		next = rep.SkipReason
 	} else if rep.State != report.FilesystemDone {
 		if nextStep := rep.NextStep(); nextStep != nil {
 			if nextStep.IsIncremental() {
@@ -0,0 +1,241 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/daemon/pruner"
+	"github.com/zrepl/zrepl/daemon/snapper"
+	"github.com/zrepl/zrepl/replication/report"
+)
+
+// The severities of `zrepl status --check`, which are also its exit codes
+// (compatible with Nagios / Icinga plugins).
+type checkSeverity int
+
+const (
+	checkOK checkSeverity = iota
+	checkWarning
+	checkCritical
+)
+
+func (s checkSeverity) String() string {
+	switch s {
+	case checkOK:
+		return "OK"
+	case checkWarning:
+		return "WARNING"
+	case checkCritical:
+		return "CRITICAL"
+	default:
+		return fmt.Sprintf("checkSeverity(%d)", int(s))
+	}
+}
+
+type checkThresholds struct {
+	// number of errors per job at which the job is WARNING / CRITICAL, 0 disables the threshold
+	WarnErrors, CritErrors int
+	// age of the latest replication of an active job at which the job is WARNING / CRITICAL, 0 disables the threshold
+	WarnStale, CritStale time.Duration
+}
+
+type checkJobResult struct {
+	Job      string
+	Severity checkSeverity
+	// one entry per error, for the output
+	Errors []string
+	// valid if Severity is caused by the staleness thresholds
+	Stale time.Duration
+}
+
+type checkResult struct {
+	Severity checkSeverity
+	Jobs     []*checkJobResult // sorted by job name
+}
+
+func checkStatus(jobs map[string]*job.Status, now time.Time, th checkThresholds) *checkResult {
+	res := &checkResult{Severity: checkOK}
+	names := make([]string, 0, len(jobs))
+	for name := range jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if jobs[name].Type == job.TypeInternal {
+			continue
+		}
+		jr := checkJob(name, jobs[name], now, th)
+		if jr.Severity > res.Severity {
+			res.Severity = jr.Severity
+		}
+		res.Jobs = append(res.Jobs, jr)
+	}
+	return res
+}
+
+func exceeds(v, threshold int) bool { return threshold > 0 && v >= threshold }
+
+func checkJob(name string, s *job.Status, now time.Time, th checkThresholds) *checkJobResult {
+	jr := &checkJobResult{Job: name, Severity: checkOK}
+	errorf := func(format string, args ...interface{}) {
+		jr.Errors = append(jr.Errors, fmt.Sprintf(format, args...))
+	}
+
+	switch st := s.JobSpecific.(type) {
+	case *job.ActiveSideStatus:
+		if st.InvocationError != "" {
+			errorf("invocation failed: %s", st.InvocationError)
+		}
+		if st.Replication != nil {
+			checkReplication(st.Replication, errorf)
+			if stale, ok := replicationAge(st.Replication, now); ok {
+				if th.CritStale > 0 && stale >= th.CritStale {
+					jr.Severity, jr.Stale = checkCritical, stale
+				} else if th.WarnStale > 0 && stale >= th.WarnStale {
+					jr.Severity, jr.Stale = checkWarning, stale
+				}
+			}
+		}
+		checkPruner("sender", st.PruningSender, errorf)
+		checkPruner("receiver", st.PruningReceiver, errorf)
+		checkSnapper(st.Snapshotting, errorf)
+	case *job.SnapJobStatus:
+		checkPruner("", st.Pruning, errorf)
+		checkSnapper(st.Snapshotting, errorf)
+	case *job.PassiveStatus:
+		checkSnapper(st.Snapper, errorf)
+	case *job.VerifyJobStatus:
+		if r := st.Report; r != nil {
+			if r.Error != "" {
+				errorf("verification failed: %s", r.Error)
+			}
+			for _, fs := range r.Filesystems {
+				if fs.Error != "" {
+					errorf("verification of %s failed: %s", fs.Filesystem, fs.Error)
+				}
+			}
+			if n := r.Mismatches(); n > 0 {
+				errorf("%d version(s) with mismatching checksums", n)
+			}
+		}
+	case *job.TestRestoreJobStatus:
+		if r := st.Report; r != nil {
+			if r.Error != "" {
+				errorf("test restore failed: %s", r.Error)
+			}
+			for _, fs := range r.Filesystems {
+				if fs.Error != "" {
+					errorf("test restore of %s failed: %s", fs.Filesystem, fs.Error)
+				}
+			}
+		}
+	}
+
+	if exceeds(len(jr.Errors), th.CritErrors) {
+		jr.Severity = checkCritical
+	} else if exceeds(len(jr.Errors), th.WarnErrors) && jr.Severity < checkWarning {
+		jr.Severity = checkWarning
+	}
+	return jr
+}
+
+// replicationAge returns the time since the latest replication finished
+// or, if it is still running, since it started.
+func replicationAge(r *report.Report, now time.Time) (time.Duration, bool) {
+	switch {
+	case !r.FinishAt.IsZero():
+		return now.Sub(r.FinishAt), true
+	case !r.StartAt.IsZero():
+		return now.Sub(r.StartAt), true
+	default:
+		return 0, false
+	}
+}
+
+func checkReplication(r *report.Report, errorf func(string, ...interface{})) {
+	if len(r.Attempts) == 0 {
+		return
+	}
+	a := r.Attempts[len(r.Attempts)-1]
+	if a.State == report.AttemptPlanningError {
+		errorf("replication planning failed: %s", a.PlanError)
+		return
+	}
+	for _, fs := range a.Filesystems {
+		if err := fs.Error(); err != nil {
+			errorf("replication of %s failed: %s", fs.Info.Name, err)
+		}
+	}
+}
+
+func checkPruner(side string, r *pruner.Report, errorf func(string, ...interface{})) {
+	if r == nil {
+		return
+	}
+	what := "pruning"
+	if side != "" {
+		what = fmt.Sprintf("pruning %s", side)
+	}
+	if r.Error != "" {
+		errorf("%s failed: %s", what, r.Error)
+	}
+	for _, fss := range [][]pruner.FSReport{r.Pending, r.Completed} {
+		for _, fs := range fss {
+			if fs.LastError != "" {
+				errorf("%s of %s failed: %s", what, fs.Filesystem, fs.LastError)
+			}
+		}
+	}
+}
+
+func checkSnapper(r *snapper.Report, errorf func(string, ...interface{})) {
+	if r == nil {
+		return
+	}
+	if r.Error != "" {
+		errorf("snapshotting failed: %s", r.Error)
+	}
+	for _, fs := range r.Progress {
+		if fs.State == snapper.SnapError {
+			errorf("snapshotting %s failed", fs.Path)
+		}
+	}
+	for _, fs := range r.Stalled {
+		errorf("snapshotting %s stalled, newest snapshot from %s", fs.Path, fs.NewestSnapshot.Format(time.RFC3339))
+	}
+	for _, fs := range r.RateOfChangeExceeded {
+		errorf("snapshot %s@%s exceeds rate of change threshold: %d bytes written, threshold %d bytes", fs.Path, fs.Snapshot, fs.Written, fs.Threshold)
+	}
+}
+
+func (r *checkResult) write(w io.Writer) {
+	var problems []string
+	for _, jr := range r.Jobs {
+		if jr.Severity == checkOK {
+			continue
+		}
+		if jr.Stale > 0 {
+			problems = append(problems, fmt.Sprintf("job %s: latest replication %s ago", jr.Job, jr.Stale.Round(time.Second)))
+		}
+		for _, e := range jr.Errors {
+			problems = append(problems, fmt.Sprintf("job %s: %s", jr.Job, e))
+		}
+	}
+	writeCheck(w, r.Severity, fmt.Sprintf("%d job(s)", len(r.Jobs)), problems)
+}
+
+// writeCheck writes the result of a check in the output format of Nagios plugins:
+// a summary line followed by one line per problem.
+func writeCheck(w io.Writer, s checkSeverity, checked string, problems []string) {
+	if s == checkOK {
+		fmt.Fprintf(w, "ZREPL OK - %s checked\n", checked)
+		return
+	}
+	fmt.Fprintf(w, "ZREPL %s - %d problem(s) in %s\n", s, len(problems), checked)
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+}
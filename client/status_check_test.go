@@ -0,0 +1,98 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/daemon/pruner"
+	"github.com/zrepl/zrepl/daemon/snapper"
+	"github.com/zrepl/zrepl/replication/report"
+)
+
+func TestCheckStatus(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	failedFS := func(name string) *report.FilesystemReport {
+		return &report.FilesystemReport{
+			Info:      &report.FilesystemInfo{Name: name},
+			State:     report.FilesystemSteppingErrored,
+			StepError: report.NewTimedError("step failed", now),
+		}
+	}
+	push := func(finishedAgo time.Duration, failed ...string) *job.Status {
+		a := &report.AttemptReport{State: report.AttemptDone}
+		for _, fs := range failed {
+			a.State = report.AttemptFanOutError
+			a.Filesystems = append(a.Filesystems, failedFS(fs))
+		}
+		return &job.Status{Type: job.TypePush, JobSpecific: &job.ActiveSideStatus{
+			Replication: &report.Report{
+				StartAt:  now.Add(-finishedAgo - time.Minute),
+				FinishAt: now.Add(-finishedAgo),
+				Attempts: []*report.AttemptReport{a},
+			},
+		}}
+	}
+	snap := &job.Status{Type: job.TypeSnap, JobSpecific: &job.SnapJobStatus{
+		Pruning: &pruner.Report{Completed: []pruner.FSReport{{Filesystem: "pool/a", LastError: "destroy failed"}}},
+		Snapshotting: &snapper.Report{
+			Stalled:              []*snapper.ReportStalledFilesystem{{Path: "pool/b", NewestSnapshot: now.Add(-48 * time.Hour)}},
+			RateOfChangeExceeded: []*snapper.ReportRateOfChange{{Path: "pool/c", Snapshot: "zrepl_20200101_000000_000", Written: 2 << 30, Threshold: 1 << 30}},
+		},
+	}}
+	internal := &job.Status{Type: job.TypeInternal}
+
+	defaults := checkThresholds{WarnErrors: 1}
+
+	tcs := []struct {
+		name     string
+		jobs     map[string]*job.Status
+		th       checkThresholds
+		severity checkSeverity
+		errors   map[string]int
+	}{
+		{"ok", map[string]*job.Status{"push": push(time.Minute), "_control": internal}, defaults, checkOK, map[string]int{"push": 0}},
+		{"errors_warn", map[string]*job.Status{"push": push(time.Minute, "pool/a", "pool/b")}, defaults, checkWarning, map[string]int{"push": 2}},
+		{"errors_crit", map[string]*job.Status{"push": push(time.Minute, "pool/a", "pool/b")}, checkThresholds{WarnErrors: 1, CritErrors: 2}, checkCritical, nil},
+		{"errors_below_crit", map[string]*job.Status{"push": push(time.Minute, "pool/a")}, checkThresholds{CritErrors: 2}, checkOK, nil},
+		{"snap_errors", map[string]*job.Status{"snap": snap}, defaults, checkWarning, map[string]int{"snap": 3}},
+		{"stale_warn", map[string]*job.Status{"push": push(2 * time.Hour)}, checkThresholds{WarnStale: time.Hour, CritStale: 3 * time.Hour}, checkWarning, nil},
+		{"stale_crit", map[string]*job.Status{"push": push(4 * time.Hour)}, checkThresholds{WarnStale: time.Hour, CritStale: 3 * time.Hour}, checkCritical, nil},
+		{"stale_disabled", map[string]*job.Status{"push": push(4 * time.Hour)}, defaults, checkOK, nil},
+		{"worst_job_wins", map[string]*job.Status{"ok": push(time.Minute), "crit": push(4 * time.Hour)}, checkThresholds{CritStale: time.Hour}, checkCritical, nil},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			res := checkStatus(tc.jobs, now, tc.th)
+			assert.Equal(t, tc.severity, res.Severity)
+			for job, n := range tc.errors {
+				var jr *checkJobResult
+				for _, r := range res.Jobs {
+					if r.Job == job {
+						jr = r
+					}
+				}
+				require.NotNil(t, jr)
+				assert.Len(t, jr.Errors, n)
+			}
+		})
+	}
+}
+
+func TestCheckResultWrite(t *testing.T) {
+	var buf bytes.Buffer
+	(&checkResult{Severity: checkOK, Jobs: []*checkJobResult{{Job: "a"}}}).write(&buf)
+	assert.Equal(t, "ZREPL OK - 1 job(s) checked\n", buf.String())
+
+	buf.Reset()
+	(&checkResult{Severity: checkCritical, Jobs: []*checkJobResult{
+		{Job: "a"},
+		{Job: "b", Severity: checkCritical, Stale: 2 * time.Hour, Errors: []string{"replication of pool/a failed: foo"}},
+	}}).write(&buf)
+	assert.Equal(t, "ZREPL CRITICAL - 2 problem(s) in 2 job(s)\njob b: latest replication 2h0m0s ago\njob b: replication of pool/a failed: foo\n", buf.String())
+}
@@ -51,22 +51,27 @@ func runTestFilterCmd(ctx context.Context, subcommand *cli.Subcommand, args []st
 	conf := subcommand.Config()
 
 	var confFilter config.FilesystemsFilter
+	var confFilterProperty string
 	job, err := conf.Job(testFilterArgs.job)
 	if err != nil {
 		return err
 	}
 	switch j := job.Ret.(type) {
 	case *config.SourceJob:
-		confFilter = j.Filesystems
+		confFilter, confFilterProperty = j.Filesystems, j.FilesystemsProperty
 	case *config.PushJob:
-		confFilter = j.Filesystems
+		confFilter, confFilterProperty = j.Filesystems, j.FilesystemsProperty
 	case *config.SnapJob:
+		confFilter, confFilterProperty = j.Filesystems, j.FilesystemsProperty
+	case *config.VerifyJob:
+		confFilter = j.Filesystems
+	case *config.TestRestoreJob:
 		confFilter = j.Filesystems
 	default:
 		return fmt.Errorf("job type %T does not have filesystems filter", j)
 	}
 
-	f, err := filters.DatasetMapFilterFromConfig(confFilter)
+	f, err := filters.DatasetFilterFromConfig(confFilter, confFilterProperty)
 	if err != nil {
 		return fmt.Errorf("filter invalid: %s", err)
 	}
@@ -94,11 +99,20 @@ func runTestFilterCmd(ctx context.Context, subcommand *cli.Subcommand, args []st
 		fspaths[i] = path
 	}
 
+	// evaluate all paths with a single zfs command, fall back to individual evaluation for per-path errors
+	allPass, allErr := zfs.FilterAll(ctx, f, fspaths)
+
 	hadFilterErr := false
-	for _, in := range fspaths {
+	for i, in := range fspaths {
 		var res string
 		var errStr string
-		pass, err := f.Filter(in)
+		var pass bool
+		var err error
+		if allErr == nil {
+			pass = allPass[i]
+		} else {
+			pass, err = zfs.FilterContext(ctx, f, in)
+		}
 		if err != nil {
 			res = "ERROR"
 			errStr = err.Error()
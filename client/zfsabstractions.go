@@ -5,6 +5,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
 
 	"github.com/zrepl/zrepl/cli"
@@ -35,6 +36,8 @@ type zabsFilterFlags struct {
 	Job         JobIDFlag
 	Types       AbstractionTypesFlag
 	Concurrency int64
+	// placeholder filesystems are not an endpoint.AbstractionType and thus not part of Query()
+	Placeholders bool
 }
 
 // produce a query from the CLI flags
@@ -45,6 +48,9 @@ func (f zabsFilterFlags) Query() (endpoint.ListZFSHoldsAndBookmarksQuery, error)
 		JobID:       f.Job.FlagValue(),
 		Concurrency: f.Concurrency,
 	}
+	if f.Placeholders && q.JobID != nil {
+		return q, errors.New("placeholder filesystems are not associated with a job, cannot combine --placeholders with --job")
+	}
 	return q, q.Validate()
 }
 
@@ -62,6 +68,7 @@ func (f *zabsFilterFlags) registerZabsFilterFlags(s *pflag.FlagSet, verb string)
 	s.Var(&f.Types, "type", fmt.Sprintf("only %s holds of the specified type [default: all] [comma-separated list of %s]", verb, variantsJoined))
 
 	s.Int64VarP(&f.Concurrency, "concurrency", "p", 1, "number of concurrently queried filesystems")
+	s.BoolVar(&f.Placeholders, "placeholders", false, fmt.Sprintf("also %s placeholder filesystems created by the receiver", verb))
 }
 
 type JobIDFlag struct{ J *endpoint.JobID }
@@ -89,6 +89,27 @@ func doZabsList(ctx context.Context, sc *cli.Subcommand, args []string) error {
 		}
 	}()
 	wg.Wait()
+
+	if zabsListFlags.Filter.Placeholders {
+		placeholders, err := endpoint.ListPlaceholders(ctx, q.FS)
+		if err != nil {
+			errorsSlice = append(errorsSlice, endpoint.ListAbstractionsError{What: "list placeholder filesystems", Err: err})
+			errorColor.Fprintf(os.Stderr, "%s\n", errorsSlice[len(errorsSlice)-1])
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		for _, p := range placeholders {
+			if zabsListFlags.Json {
+				if err := enc.Encode(p); err != nil {
+					panic(err)
+				}
+				fmt.Println()
+			} else {
+				fmt.Printf("placeholder filesystem %s\n", p.FS)
+			}
+		}
+	}
+
 	if len(errorsSlice) > 0 {
 		errorColor.Add(color.Bold).Fprintf(os.Stderr, "there were errors in listing the abstractions")
 		return fmt.Errorf("")
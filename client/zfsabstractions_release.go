@@ -12,6 +12,7 @@ import (
 
 	"github.com/zrepl/zrepl/cli"
 	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/zfs"
 )
 
 // shared between release-all and release-step
@@ -64,7 +65,15 @@ func doZabsReleaseAll(ctx context.Context, sc *cli.Subcommand, args []string) er
 		// proceed anyways with rest of abstractions
 	}
 
-	return doZabsRelease_Common(ctx, abstractions)
+	var placeholders []*zfs.FilesystemPlaceholderState
+	if zabsReleaseFlags.Filter.Placeholders {
+		placeholders, err = endpoint.ListPlaceholders(ctx, q.FS)
+		if err != nil {
+			return errors.Wrap(err, "list placeholder filesystems")
+		}
+	}
+
+	return doZabsRelease_Common(ctx, abstractions, placeholders)
 }
 
 func doZabsReleaseStale(ctx context.Context, sc *cli.Subcommand, args []string) error {
@@ -75,6 +84,10 @@ func doZabsReleaseStale(ctx context.Context, sc *cli.Subcommand, args []string)
 		return errors.New("this subcommand takes no positional arguments")
 	}
 
+	if zabsReleaseFlags.Filter.Placeholders {
+		return errors.New("placeholder filesystems are never stale, use release-all --placeholders instead")
+	}
+
 	q, err := zabsReleaseFlags.Filter.Query()
 	if err != nil {
 		return errors.Wrap(err, "invalid filter specification on command line")
@@ -85,10 +98,11 @@ func doZabsReleaseStale(ctx context.Context, sc *cli.Subcommand, args []string)
 		return err // context clear by invocation of command
 	}
 
-	return doZabsRelease_Common(ctx, stalenessInfo.Stale)
+	return doZabsRelease_Common(ctx, stalenessInfo.Stale, nil)
 }
 
-func doZabsRelease_Common(ctx context.Context, destroy []endpoint.Abstraction) error {
+// Placeholders are released by turning them into regular filesystems, i.e., they and their children are not destroyed.
+func doZabsRelease_Common(ctx context.Context, destroy []endpoint.Abstraction, placeholders []*zfs.FilesystemPlaceholderState) error {
 
 	if zabsReleaseFlags.DryRun {
 		if zabsReleaseFlags.Json {
@@ -100,10 +114,23 @@ func doZabsRelease_Common(ctx context.Context, destroy []endpoint.Abstraction) e
 				panic(err)
 			}
 			fmt.Println()
+			if len(placeholders) > 0 {
+				m, err := json.MarshalIndent(placeholders, "", "  ")
+				if err != nil {
+					panic(err)
+				}
+				if _, err := os.Stdout.Write(m); err != nil {
+					panic(err)
+				}
+				fmt.Println()
+			}
 		} else {
 			for _, a := range destroy {
 				fmt.Printf("would destroy %s\n", a)
 			}
+			for _, p := range placeholders {
+				fmt.Printf("would turn placeholder filesystem %s into a regular filesystem\n", p.FS)
+			}
 		}
 		return nil
 	}
@@ -134,6 +161,30 @@ func doZabsRelease_Common(ctx context.Context, destroy []endpoint.Abstraction) e
 		}
 	}
 
+	for _, p := range placeholders {
+		err := endpoint.ReleasePlaceholder(ctx, p.FS)
+		hadErr = hadErr || err != nil
+		if zabsReleaseFlags.Json {
+			res := struct {
+				Placeholder *zfs.FilesystemPlaceholderState
+				ReleaseErr  string
+			}{Placeholder: p}
+			if err != nil {
+				res.ReleaseErr = err.Error()
+			}
+			if err := enc.Encode(res); err != nil {
+				colorErr.Fprintf(os.Stderr, "cannot marshal there were errors in releasing the placeholders")
+			}
+		} else {
+			printfSection(os.Stdout, "release placeholder filesystem %s ...", p.FS)
+			if err != nil {
+				colorErr.Fprintf(os.Stdout, " failed:\n%s\n", err)
+			} else {
+				printfSuccess(os.Stdout, " OK\n")
+			}
+		}
+	}
+
 	if hadErr {
 		colorErr.Add(color.Bold).Fprintf(os.Stderr, "there were errors in destroying the abstractions")
 		return fmt.Errorf("")
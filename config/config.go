@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"log/syslog"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -45,39 +46,223 @@ func (j JobEnum) Name() string {
 		name = v.Name
 	case *SourceJob:
 		name = v.Name
+	case *VerifyJob:
+		name = v.Name
+	case *TestRestoreJob:
+		name = v.Name
 	default:
 		panic(fmt.Sprintf("unknown job type %T", v))
 	}
 	return name
 }
 
+// Logging returns the job's logging outlets, or nil if the job uses the global logging outlets.
+func (j JobEnum) Logging() *LoggingOutletEnumList {
+	switch v := j.Ret.(type) {
+	case *SnapJob:
+		return v.Logging
+	case *PushJob:
+		return v.Logging
+	case *SinkJob:
+		return v.Logging
+	case *PullJob:
+		return v.Logging
+	case *SourceJob:
+		return v.Logging
+	case *VerifyJob:
+		return v.Logging
+	case *TestRestoreJob:
+		return v.Logging
+	default:
+		panic(fmt.Sprintf("unknown job type %T", v))
+	}
+}
+
+// Labels returns the job's static labels (config field `labels`), nil if it has none.
+func (j JobEnum) Labels() map[string]string {
+	switch v := j.Ret.(type) {
+	case *SnapJob:
+		return v.Labels
+	case *PushJob:
+		return v.Labels
+	case *SinkJob:
+		return v.Labels
+	case *PullJob:
+		return v.Labels
+	case *SourceJob:
+		return v.Labels
+	case *VerifyJob:
+		return v.Labels
+	case *TestRestoreJob:
+		return v.Labels
+	default:
+		panic(fmt.Sprintf("unknown job type %T", v))
+	}
+}
+
+// After returns the names of the jobs that the job is ordered after, nil for job types that cannot be ordered.
+func (j JobEnum) After() JobNameList {
+	switch v := j.Ret.(type) {
+	case *SnapJob:
+		return v.After
+	case *PushJob:
+		return v.After
+	case *PullJob:
+		return v.After
+	case *VerifyJob:
+		return v.After
+	case *TestRestoreJob:
+		return v.After
+	default:
+		return nil
+	}
+}
+
+// Blackout returns the blackout windows of the job, nil if it has none or if the job type does not support them.
+func (j JobEnum) Blackout() *Blackout {
+	switch v := j.Ret.(type) {
+	case *SnapJob:
+		return v.Blackout
+	case *PushJob:
+		return v.Blackout
+	case *PullJob:
+		return v.Blackout
+	case *VerifyJob:
+		return v.Blackout
+	case *TestRestoreJob:
+		return v.Blackout
+	default:
+		return nil
+	}
+}
+
 type ActiveJob struct {
-	Type        string                `yaml:"type"`
-	Name        string                `yaml:"name"`
-	Connect     ConnectEnum           `yaml:"connect"`
-	Pruning     PruningSenderReceiver `yaml:"pruning"`
-	Debug       JobDebugSettings      `yaml:"debug,optional"`
-	Replication *Replication          `yaml:"replication,optional,fromdefaults"`
+	Type        string                 `yaml:"type"`
+	Name        string                 `yaml:"name"`
+	Connect     ConnectEnum            `yaml:"connect"`
+	Pruning     PruningSenderReceiver  `yaml:"pruning"`
+	Debug       JobDebugSettings       `yaml:"debug,optional"`
+	Logging     *LoggingOutletEnumList `yaml:"logging,optional"`
+	Labels      map[string]string      `yaml:"labels,optional"`
+	Replication *Replication           `yaml:"replication,optional,fromdefaults"`
+	After       JobNameList            `yaml:"after,optional"`
+	Blackout    *Blackout              `yaml:"blackout,optional"`
+	Guardrails  *Guardrails            `yaml:"guardrails,optional"`
+	Monitor     *MonitorSnapshots      `yaml:"monitor,optional"`
+	// maximum duration of an invocation, 0 means no limit
+	Timeout time.Duration `yaml:"timeout,optional,zeropositive,default=0s"`
+
+	ProcessPriority ProcessPriority `yaml:"process_priority,optional"`
 }
 
 type PassiveJob struct {
-	Type  string           `yaml:"type"`
-	Name  string           `yaml:"name"`
-	Serve ServeEnum        `yaml:"serve"`
-	Debug JobDebugSettings `yaml:"debug,optional"`
+	Type    string                 `yaml:"type"`
+	Name    string                 `yaml:"name"`
+	Serve   ServeEnumList          `yaml:"serve"`
+	Debug   JobDebugSettings       `yaml:"debug,optional"`
+	Logging *LoggingOutletEnumList `yaml:"logging,optional"`
+	Labels  map[string]string      `yaml:"labels,optional"`
+	Monitor *MonitorSnapshots      `yaml:"monitor,optional"`
+
+	DrainTimeout            time.Duration `yaml:"drain_timeout,zeropositive,default=30s"`
+	MaxConnections          int           `yaml:"max_connections,optional"`
+	MaxConnectionsPerClient int           `yaml:"max_connections_per_client,optional"`
+
+	ProcessPriority ProcessPriority `yaml:"process_priority,optional"`
+}
+
+// Sanity limits that protect against configuration mistakes that would mass-destroy or mass-transfer data.
+type Guardrails struct {
+	// maximum number of snapshots that a single pruning pass may destroy on one side, 0 means no limit
+	MaxDestroyedSnapshots int `yaml:"max_destroyed_snapshots,optional,zeropositive,default=0"`
+	// fraction of the existing snapshots above which a pruning pass on one side awaits confirmation
+	// through `zrepl signal confirm JOB TOKEN`, 0 means no confirmation
+	ConfirmDestroyFraction float64 `yaml:"confirm_destroy_fraction,optional,default=0"`
+	// number of new filesystems whose initial replication (full send) in a single replication attempt
+	// is logged as a warning, 0 means no limit
+	MaxFullSends int `yaml:"max_full_sends,optional,zeropositive,default=0"`
+	// refuse the initial replications instead of warning if max_full_sends is exceeded
+	RefuseFullSends bool `yaml:"refuse_full_sends,optional,default=false"`
+}
+
+// Priority of the zfs send and zfs recv processes of a job.
+type ProcessPriority struct {
+	Nice        int    `yaml:"nice,optional"`
+	IONice      string `yaml:"ionice,optional"` // class[:level]
+	CgroupSlice string `yaml:"cgroup_slice,optional"`
 }
 
 type SnapJob struct {
-	Type         string            `yaml:"type"`
-	Name         string            `yaml:"name"`
-	Pruning      PruningLocal      `yaml:"pruning"`
-	Debug        JobDebugSettings  `yaml:"debug,optional"`
-	Snapshotting SnapshottingEnum  `yaml:"snapshotting"`
-	Filesystems  FilesystemsFilter `yaml:"filesystems"`
+	Type                string                 `yaml:"type"`
+	Name                string                 `yaml:"name"`
+	Pruning             PruningLocal           `yaml:"pruning"`
+	Debug               JobDebugSettings       `yaml:"debug,optional"`
+	Logging             *LoggingOutletEnumList `yaml:"logging,optional"`
+	Labels              map[string]string      `yaml:"labels,optional"`
+	Snapshotting        SnapshottingEnum       `yaml:"snapshotting"`
+	Filesystems         FilesystemsFilter      `yaml:"filesystems"`
+	FilesystemsProperty string                 `yaml:"filesystems_property,optional"`
+	After               JobNameList            `yaml:"after,optional"`
+	Blackout            *Blackout              `yaml:"blackout,optional"`
+	Guardrails          *Guardrails            `yaml:"guardrails,optional"`
+	Monitor             *MonitorSnapshots      `yaml:"monitor,optional"`
+}
+
+type VerifyJob struct {
+	Type        string                   `yaml:"type"`
+	Name        string                   `yaml:"name"`
+	Connect     ConnectEnum              `yaml:"connect"`
+	Debug       JobDebugSettings         `yaml:"debug,optional"`
+	Logging     *LoggingOutletEnumList   `yaml:"logging,optional"`
+	Labels      map[string]string        `yaml:"labels,optional"`
+	Filesystems FilesystemsFilter        `yaml:"filesystems"`
+	Interval    PositiveDurationOrManual `yaml:"interval"`
+	Method      string                   `yaml:"method,optional,default=stream_size"`
+	Versions    int                      `yaml:"versions,optional,default=1"`
+	After       JobNameList              `yaml:"after,optional"`
+	Blackout    *Blackout                `yaml:"blackout,optional"`
+}
+
+type TestRestoreJob struct {
+	Type        string                   `yaml:"type"`
+	Name        string                   `yaml:"name"`
+	Logging     *LoggingOutletEnumList   `yaml:"logging,optional"`
+	Labels      map[string]string        `yaml:"labels,optional"`
+	Filesystems FilesystemsFilter        `yaml:"filesystems"`
+	Interval    PositiveDurationOrManual `yaml:"interval"`
+	// Dataset below which the clones are created, must be in the same pool as the filesystems
+	CloneRoot string `yaml:"clone_root"`
+	// Absolute path of the command that checks a clone
+	Command  string        `yaml:"command"`
+	Timeout  time.Duration `yaml:"timeout,optional,positive,default=1h"`
+	After    JobNameList   `yaml:"after,optional"`
+	Blackout *Blackout     `yaml:"blackout,optional"`
 }
 
 type SendOptions struct {
-	Encrypted bool `yaml:"encrypted,optional,default=false"`
+	Encrypted   bool   `yaml:"encrypted,optional,default=false"`
+	StripPrefix string `yaml:"strip_prefix,optional"`
+	// Command that the send stream is piped through, e.g., for encryption
+	StreamPipe []string `yaml:"stream_pipe,optional"`
+	// In-memory buffer between zfs send and the network
+	Buffer *StreamBuffer `yaml:"buffer,optional"`
+	// List the versions of all filesystems with one zfs list per pool during planning
+	BulkListVersions bool `yaml:"bulk_list_versions,optional,default=false"`
+	// The snapshots are created and destroyed by another tool, the sender never creates or destroys
+	// snapshots, bookmarks or holds, requires snapshotting type manual
+	ExternallyManagedSnapshots bool `yaml:"externally_managed_snapshots,optional,default=false"`
+	// Refuse all requests that would modify the sending side's datasets (destroy snapshots, write properties)
+	ReadonlySender bool `yaml:"readonly_sender,optional,default=false"`
+	// Only list, send and destroy the snapshots and bookmarks that pass the filter
+	VersionFilter *VersionFilter `yaml:"version_filter,optional"`
+	// Bookmark each snapshot before the pruner destroys it
+	BookmarksOnly bool `yaml:"bookmarks_only,optional,default=false"`
+}
+
+// Snapshots and bookmarks whose name (without @ or #) has one of Prefixes or matches one of Regexes pass the filter.
+type VersionFilter struct {
+	Prefixes []string `yaml:"prefixes,optional"`
+	Regexes  []string `yaml:"regexes,optional"`
 }
 
 type RecvOptions struct {
@@ -86,10 +271,82 @@ type RecvOptions struct {
 
 	// Future:
 	// Reencrypt bool `yaml:"reencrypt"`
+
+	// Allow clients to read back received filesystems using `zrepl restore`
+	AllowRestore bool `yaml:"allow_restore,optional,default=false"`
+
+	// Prefix for received snapshot names, may contain ${client_identity}
+	SnapshotPrefix string `yaml:"snapshot_prefix,optional"`
+
+	// Quota of the filesystem below which a client's filesystems are received (0 = no quota)
+	ClientQuota DataSize `yaml:"client_quota,optional"`
+
+	// Command that the received stream is piped through before zfs recv,
+	// the inverse of the sender's stream_pipe
+	StreamPipe []string `yaml:"stream_pipe,optional"`
+	// In-memory buffer between the network and zfs recv
+	Buffer *StreamBuffer `yaml:"buffer,optional"`
+
+	// Rename placeholders that hold data aside instead of overwriting them with zfs recv -F
+	ArchivePlaceholderData bool `yaml:"archive_placeholder_data,optional,default=false"`
+
+	// Allow clients to roll back received filesystems, see replication.rollback_diverged_receivers
+	AllowRollback bool `yaml:"allow_rollback,optional,default=false"`
+	// Refuse all requests that would destroy received snapshots (pruning, rollback)
+	AppendOnly bool `yaml:"append_only,optional,default=false"`
+	// List the versions of all received filesystems with one zfs list during planning
+	BulkListVersions bool `yaml:"bulk_list_versions,optional,default=false"`
+	// Command hooks that run after each successful receive
+	Hooks HookList `yaml:"hooks,optional"`
+	// Whether received filesystems inherit the receiver's ACL properties (inherit)
+	// or are set to the sender's (preserve)
+	ACLProperties string `yaml:"acl_properties,optional,default=inherit"`
+	// Only list, receive and destroy the snapshots and bookmarks that pass the filter
+	VersionFilter *VersionFilter `yaml:"version_filter,optional"`
+	// Allow clients to destroy tombstones, see replication.deleted_filesystems
+	AllowDestroyTombstones bool `yaml:"allow_destroy_tombstones,optional,default=false"`
+}
+
+type StreamBuffer struct {
+	Size DataSize `yaml:"size"`
+	// in percent of size
+	LowWatermark  int `yaml:"low_watermark,optional,zeropositive,default=100"`
+	HighWatermark int `yaml:"high_watermark,optional,zeropositive,default=0"`
 }
 
 type Replication struct {
 	Protection *ReplicationOptionsProtection `yaml:"protection,optional,fromdefaults"`
+	Verify     bool                          `yaml:"verify,optional,default=false"`
+
+	ConfirmNewFilesystems bool `yaml:"confirm_new_filesystems,optional,default=false"`
+	DetectRenames         bool `yaml:"detect_renames,optional,default=false"`
+
+	ArchiveRecreatedFilesystems bool `yaml:"archive_recreated_filesystems,optional,default=false"`
+	// Roll back diverged receiver filesystems to the most recent common snapshot, requires recv.allow_rollback on the receiver
+	RollbackDivergedReceivers bool `yaml:"rollback_diverged_receivers,optional,default=false"`
+
+	AbortStalePartialReceivesAfter time.Duration `yaml:"abort_stale_partial_receives_after,optional,zeropositive,default=0s"`
+	InitialStepSizeLimit           DataSize      `yaml:"initial_step_size_limit,optional"`
+	StepTimeout                    time.Duration `yaml:"step_timeout,optional,zeropositive,default=0s"`
+	Ordering                       string        `yaml:"ordering,optional,default=oldest_snapshot"`
+	// Maximum combined throughput of the job's replication streams per second, 0 means no limit
+	BandwidthLimit DataSize            `yaml:"bandwidth_limit,optional"`
+	Weights        []ReplicationWeight `yaml:"weights,optional"`
+
+	DeletedFilesystems *ReplicationDeletedFilesystems `yaml:"deleted_filesystems,optional,fromdefaults"`
+}
+
+// Handling of receiver filesystems whose sender filesystem no longer exists, see Replication.DeletedFilesystems.
+type ReplicationDeletedFilesystems struct {
+	// keep, rename (to a tombstone) or destroy (rename, then destroy the tombstone after DestroyAfter)
+	Action       string        `yaml:"action,optional,default=keep"`
+	DestroyAfter time.Duration `yaml:"destroy_after,optional,positive,default=720h"`
+}
+
+// The weight of the filesystems matched by Filesystems, see Replication.Weights.
+type ReplicationWeight struct {
+	Filesystems FilesystemsFilter `yaml:"filesystems"`
+	Weight      int               `yaml:"weight,positive"`
 }
 
 type ReplicationOptionsProtection struct {
@@ -98,13 +355,15 @@ type ReplicationOptionsProtection struct {
 }
 
 type PushJob struct {
-	ActiveJob    `yaml:",inline"`
-	Snapshotting SnapshottingEnum  `yaml:"snapshotting"`
-	Filesystems  FilesystemsFilter `yaml:"filesystems"`
-	Send         *SendOptions      `yaml:"send,fromdefaults,optional"`
+	ActiveJob           `yaml:",inline"`
+	Snapshotting        SnapshottingEnum  `yaml:"snapshotting"`
+	Filesystems         FilesystemsFilter `yaml:"filesystems"`
+	FilesystemsProperty string            `yaml:"filesystems_property,optional"`
+	Send                *SendOptions      `yaml:"send,fromdefaults,optional"`
 }
 
 func (j *PushJob) GetFilesystems() FilesystemsFilter { return j.Filesystems }
+func (j *PushJob) GetFilesystemsProperty() string    { return j.FilesystemsProperty }
 func (j *PushJob) GetSendOptions() *SendOptions      { return j.Send }
 
 type PullJob struct {
@@ -160,13 +419,15 @@ func (j *SinkJob) GetAppendClientIdentity() bool { return true }
 func (j *SinkJob) GetRecvOptions() *RecvOptions  { return j.Recv }
 
 type SourceJob struct {
-	PassiveJob   `yaml:",inline"`
-	Snapshotting SnapshottingEnum  `yaml:"snapshotting"`
-	Filesystems  FilesystemsFilter `yaml:"filesystems"`
-	Send         *SendOptions      `yaml:"send,optional,fromdefaults"`
+	PassiveJob          `yaml:",inline"`
+	Snapshotting        SnapshottingEnum  `yaml:"snapshotting"`
+	Filesystems         FilesystemsFilter `yaml:"filesystems"`
+	FilesystemsProperty string            `yaml:"filesystems_property,optional"`
+	Send                *SendOptions      `yaml:"send,optional,fromdefaults"`
 }
 
 func (j *SourceJob) GetFilesystems() FilesystemsFilter { return j.Filesystems }
+func (j *SourceJob) GetFilesystemsProperty() string    { return j.FilesystemsProperty }
 func (j *SourceJob) GetSendOptions() *SendOptions      { return j.Send }
 
 type FilesystemsFilter map[string]bool
@@ -180,6 +441,19 @@ type SnapshottingPeriodic struct {
 	Prefix   string        `yaml:"prefix"`
 	Interval time.Duration `yaml:"interval,positive"`
 	Hooks    HookList      `yaml:"hooks,optional"`
+	// If the newest snapshot of a filesystem is older than this, snapshotting is considered stalled.
+	// Zero means twice the Interval.
+	StallThreshold time.Duration `yaml:"stall_threshold,optional,zeropositive,default=0s"`
+	// Alerting on the data written between consecutive snapshots, disabled if nil.
+	RateOfChange *SnapshottingRateOfChange `yaml:"rate_of_change,optional"`
+}
+
+type SnapshottingRateOfChange struct {
+	// Data written to a filesystem between two consecutive snapshots (the snapshot's `written` property)
+	// above which an alert is raised.
+	Threshold DataSize `yaml:"threshold"`
+	// Command hooks run when a filesystem exceeds the threshold.
+	Hooks HookList `yaml:"hooks,optional"`
 }
 
 type SnapshottingManual struct {
@@ -219,6 +493,24 @@ type Global struct {
 	Monitoring []MonitoringEnum       `yaml:"monitoring,optional"`
 	Control    *GlobalControl         `yaml:"control,optional,fromdefaults"`
 	Serve      *GlobalServe           `yaml:"serve,optional,fromdefaults"`
+	ZFS        *GlobalZFS             `yaml:"zfs,optional,fromdefaults"`
+	// named after the `zrepl zfs-abstraction` subcommand
+	AbstractionsGC *GlobalAbstractionsGC `yaml:"abstractions_gc,optional,fromdefaults"`
+	History        *GlobalHistory        `yaml:"history,optional,fromdefaults"`
+}
+
+type GlobalZFS struct {
+	CommandWrapper []string `yaml:"command_wrapper,optional"`
+}
+
+type GlobalAbstractionsGC struct {
+	Interval time.Duration `yaml:"interval,optional,zeropositive,default=0s"` // 0 disables the GC
+	MinAge   time.Duration `yaml:"min_age,optional,positive,default=168h"`
+	DryRun   bool          `yaml:"dry_run,optional,default=false"`
+}
+
+type GlobalHistory struct {
+	Path string `yaml:"path,optional"` // empty disables the replication history
 }
 
 func Default(i interface{}) {
@@ -238,7 +530,19 @@ type ConnectEnum struct {
 }
 
 type ConnectCommon struct {
-	Type string `yaml:"type"`
+	Type      string           `yaml:"type"`
+	ChunkSize *StreamChunkSize `yaml:"chunk_size,optional"`
+	Multiplex bool             `yaml:"multiplex,optional"`
+}
+
+func (c *ConnectCommon) GetChunkSize() *StreamChunkSize { return c.ChunkSize }
+
+func (c *ConnectCommon) GetMultiplex() bool { return c.Multiplex }
+
+// Limits of the size of the chunks that replication streams are split into, zero means default.
+type StreamChunkSize struct {
+	Min DataSize `yaml:"min,optional"`
+	Max DataSize `yaml:"max,optional"`
 }
 
 type TCPConnect struct {
@@ -248,13 +552,22 @@ type TCPConnect struct {
 }
 
 type TLSConnect struct {
-	ConnectCommon `yaml:",inline"`
-	Address       string        `yaml:"address,hostport"`
-	Ca            string        `yaml:"ca"`
-	Cert          string        `yaml:"cert"`
-	Key           string        `yaml:"key"`
-	ServerCN      string        `yaml:"server_cn"`
-	DialTimeout   time.Duration `yaml:"dial_timeout,zeropositive,default=10s"`
+	ConnectCommon       `yaml:",inline"`
+	TLSPeerVerification `yaml:",inline"`
+	Address             string        `yaml:"address,hostport"`
+	Ca                  string        `yaml:"ca"`
+	Cert                string        `yaml:"cert"`
+	Key                 string        `yaml:"key"`
+	ServerCN            string        `yaml:"server_cn"`
+	DialTimeout         time.Duration `yaml:"dial_timeout,zeropositive,default=10s"`
+	SessionResumption   bool          `yaml:"session_resumption,default=true"`
+}
+
+// Additional checks of the peer certificate of TLS connections, beyond the verification against the CA.
+type TLSPeerVerification struct {
+	CRL              string   `yaml:"crl,optional"`
+	PinnedCertSHA256 []string `yaml:"pinned_cert_sha256,optional"`
+	PinnedSPKISHA256 []string `yaml:"pinned_spki_sha256,optional"`
 }
 
 type SSHStdinserverConnect struct {
@@ -269,6 +582,12 @@ type SSHStdinserverConnect struct {
 	DialTimeout          time.Duration `yaml:"dial_timeout,zeropositive,default=10s"`
 }
 
+type UnixConnect struct {
+	ConnectCommon `yaml:",inline"`
+	Path          string        `yaml:"path"`
+	DialTimeout   time.Duration `yaml:"dial_timeout,zeropositive,default=10s"`
+}
+
 type LocalConnect struct {
 	ConnectCommon  `yaml:",inline"`
 	ListenerName   string        `yaml:"listener_name"`
@@ -276,14 +595,39 @@ type LocalConnect struct {
 	DialTimeout    time.Duration `yaml:"dial_timeout,zeropositive,default=2s"`
 }
 
+// ExportConnect is not a transport: the streams are written to the
+// directory Path instead of being sent to a remote receiver.
+type ExportConnect struct {
+	ConnectCommon `yaml:",inline"`
+	Path          string `yaml:"path"`
+	Compression   string `yaml:"compression,optional,default=none"`
+}
+
+// S3Connect is not a transport: the streams are uploaded to an S3-compatible
+// object storage instead of being sent to a remote receiver.
+type S3Connect struct {
+	ConnectCommon       `yaml:",inline"`
+	Endpoint            string   `yaml:"endpoint"`
+	Region              string   `yaml:"region"`
+	Bucket              string   `yaml:"bucket"`
+	Prefix              string   `yaml:"prefix,optional"`
+	AccessKeyID         string   `yaml:"access_key_id"`
+	SecretAccessKeyFile string   `yaml:"secret_access_key_file"`
+	PartSize            DataSize `yaml:"part_size,optional"`
+	Compression         string   `yaml:"compression,optional,default=none"`
+}
+
 type ServeEnum struct {
 	Ret interface{}
 }
 
 type ServeCommon struct {
-	Type string `yaml:"type"`
+	Type      string           `yaml:"type"`
+	ChunkSize *StreamChunkSize `yaml:"chunk_size,optional"`
 }
 
+func (c *ServeCommon) GetChunkSize() *StreamChunkSize { return c.ChunkSize }
+
 type TCPServe struct {
 	ServeCommon    `yaml:",inline"`
 	Listen         string            `yaml:"listen,hostport"`
@@ -292,14 +636,16 @@ type TCPServe struct {
 }
 
 type TLSServe struct {
-	ServeCommon      `yaml:",inline"`
-	Listen           string        `yaml:"listen,hostport"`
-	ListenFreeBind   bool          `yaml:"listen_freebind,default=false"`
-	Ca               string        `yaml:"ca"`
-	Cert             string        `yaml:"cert"`
-	Key              string        `yaml:"key"`
-	ClientCNs        []string      `yaml:"client_cns"`
-	HandshakeTimeout time.Duration `yaml:"handshake_timeout,zeropositive,default=10s"`
+	ServeCommon         `yaml:",inline"`
+	TLSPeerVerification `yaml:",inline"`
+	Listen              string        `yaml:"listen,hostport"`
+	ListenFreeBind      bool          `yaml:"listen_freebind,default=false"`
+	Ca                  string        `yaml:"ca"`
+	Cert                string        `yaml:"cert"`
+	Key                 string        `yaml:"key"`
+	ClientCNs           []string      `yaml:"client_cns"`
+	HandshakeTimeout    time.Duration `yaml:"handshake_timeout,zeropositive,default=10s"`
+	SessionResumption   bool          `yaml:"session_resumption,default=true"`
 }
 
 type StdinserverServer struct {
@@ -307,6 +653,16 @@ type StdinserverServer struct {
 	ClientIdentities []string `yaml:"client_identities"`
 }
 
+type UnixServe struct {
+	ServeCommon `yaml:",inline"`
+	Path        string `yaml:"path"`
+	// octal permission bits of the socket
+	Mode  string `yaml:"mode,default=0660"`
+	Group string `yaml:"group,optional"`
+	// user name or numeric uid of the peer process => client identity
+	Clients map[string]string `yaml:"clients"`
+}
+
 type LocalServe struct {
 	ServeCommon  `yaml:",inline"`
 	ListenerName string `yaml:"listener_name"`
@@ -327,6 +683,18 @@ type PruneKeepLastN struct {
 	Regex string `yaml:"regex,optional"`
 }
 
+// PruneKeepSanoid keeps snapshots like sanoid's hourly, daily, ... retention counts,
+// see pruning.NewKeepSanoid.
+type PruneKeepSanoid struct {
+	Type    string `yaml:"type"`
+	Regex   string `yaml:"regex"`
+	Hourly  int    `yaml:"hourly,optional,zeropositive,default=0"`
+	Daily   int    `yaml:"daily,optional,zeropositive,default=0"`
+	Weekly  int    `yaml:"weekly,optional,zeropositive,default=0"`
+	Monthly int    `yaml:"monthly,optional,zeropositive,default=0"`
+	Yearly  int    `yaml:"yearly,optional,zeropositive,default=0"`
+}
+
 type PruneKeepRegex struct { // FIXME rename to KeepRegex
 	Type   string `yaml:"type"`
 	Regex  string `yaml:"regex"`
@@ -341,6 +709,8 @@ type LoggingOutletCommon struct {
 	Type   string `yaml:"type"`
 	Level  string `yaml:"level"`
 	Format string `yaml:"format"`
+	// If non-zero, repeated identical warnings and errors are collapsed into one entry per interval.
+	DedupInterval time.Duration `yaml:"dedup_interval,optional,zeropositive,default=0s"`
 }
 
 type StdoutLoggingOutlet struct {
@@ -377,6 +747,27 @@ type PrometheusMonitoring struct {
 	Type           string `yaml:"type"`
 	Listen         string `yaml:"listen,hostport"`
 	ListenFreeBind bool   `yaml:"listen_freebind,default=false"`
+	// Serve the read-only web UI at /ui/
+	WebUI bool `yaml:"web_ui,optional,default=false"`
+	// Serve the read-only REST API at /api/v1/
+	API bool `yaml:"api,optional,default=false"`
+	// If set, the web UI and the API require one of the tokens, and the API serves the signal endpoint
+	Tokens []MonitoringToken `yaml:"tokens,optional"`
+}
+
+type MonitoringToken struct {
+	Name  string `yaml:"name"` // logged instead of the token
+	Token string `yaml:"token"`
+	// read: the web UI and the read-only API endpoints; signal: the API's signal endpoint
+	Scopes []string `yaml:"scopes"`
+}
+
+type OTLPMonitoring struct {
+	Type        string            `yaml:"type"`
+	Endpoint    string            `yaml:"endpoint"`
+	Headers     map[string]string `yaml:"headers,optional"`
+	ServiceName string            `yaml:"service_name,optional,default=zrepl"`
+	Interval    time.Duration     `yaml:"interval,optional,positive,default=5s"`
 }
 
 type SyslogFacility syslog.Priority
@@ -389,6 +780,13 @@ var _ yaml.Defaulter = (*SyslogFacility)(nil)
 
 type GlobalControl struct {
 	SockPath string `yaml:"sockpath,default=/var/run/zrepl/control"`
+	// octal permission bits and owning group of the socket, empty leaves them as created
+	Mode  string `yaml:"mode,optional"`
+	Group string `yaml:"group,optional"`
+	// socket that only serves the read-only endpoints (status, version), empty disables it
+	ObserverSockPath string `yaml:"observer_sockpath,optional"`
+	ObserverMode     string `yaml:"observer_mode,optional"`
+	ObserverGroup    string `yaml:"observer_group,optional"`
 }
 
 type GlobalServe struct {
@@ -434,9 +832,38 @@ type HookMySQLLockTables struct {
 	Filesystems        FilesystemsFilter `yaml:"filesystems"`
 }
 
+type HookFsFreeze struct {
+	HookSettingsCommon `yaml:",inline"`
+	Mountpoints        []string          `yaml:"mountpoints"`
+	Command            string            `yaml:"command,optional,default=fsfreeze"`
+	Timeout            time.Duration     `yaml:"timeout,optional,positive,default=10s"`
+	MaxFrozen          time.Duration     `yaml:"max_frozen,optional,positive,default=1m"`
+	Filesystems        FilesystemsFilter `yaml:"filesystems"` // required, freezing is only useful for the filesystems that back the mountpoints
+}
+
+type HookLibvirtFsFreeze struct {
+	HookSettingsCommon `yaml:",inline"`
+	URI                string               `yaml:"uri,optional,default=qemu:///system"`
+	Virsh              string               `yaml:"virsh,optional,default=virsh"`
+	Domains            []*HookLibvirtDomain `yaml:"domains,optional"` // empty means discover the running domains whose disks are zvols of the filesystem
+	Timeout            time.Duration        `yaml:"timeout,optional,positive,default=30s"`
+	OnFailure          string               `yaml:"on_failure,optional,default=fail"`
+	MaxFrozen          time.Duration        `yaml:"max_frozen,optional,positive,default=2m"`
+	Filesystems        FilesystemsFilter    `yaml:"filesystems"`
+}
+
+// Zero values mean the value of the hook.
+type HookLibvirtDomain struct {
+	Name      string        `yaml:"name"`
+	Timeout   time.Duration `yaml:"timeout,optional,zeropositive"`
+	OnFailure string        `yaml:"on_failure,optional"`
+}
+
 type HookSettingsCommon struct {
 	Type       string `yaml:"type"`
 	ErrIsFatal bool   `yaml:"err_is_fatal,optional,default=false"`
+	// Hooks with lower order run their pre-edge first, ties are broken by configuration order.
+	Order int `yaml:"order,optional,default=0"`
 }
 
 func enumUnmarshal(u func(interface{}, bool) error, types map[string]interface{}) (interface{}, error) {
@@ -460,68 +887,145 @@ func enumUnmarshal(u func(interface{}, bool) error, types map[string]interface{}
 	return v, nil
 }
 
+func jobEnumTypes() map[string]interface{} {
+	return map[string]interface{}{
+		"snap":         &SnapJob{},
+		"push":         &PushJob{},
+		"sink":         &SinkJob{},
+		"pull":         &PullJob{},
+		"source":       &SourceJob{},
+		"verify":       &VerifyJob{},
+		"test-restore": &TestRestoreJob{},
+	}
+}
+
 func (t *JobEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
-	t.Ret, err = enumUnmarshal(u, map[string]interface{}{
-		"snap":   &SnapJob{},
-		"push":   &PushJob{},
-		"sink":   &SinkJob{},
-		"pull":   &PullJob{},
-		"source": &SourceJob{},
-	})
+	t.Ret, err = enumUnmarshal(u, jobEnumTypes())
 	return
 }
 
-func (t *ConnectEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
-	t.Ret, err = enumUnmarshal(u, map[string]interface{}{
+func connectEnumTypes() map[string]interface{} {
+	return map[string]interface{}{
 		"tcp":             &TCPConnect{},
 		"tls":             &TLSConnect{},
 		"ssh+stdinserver": &SSHStdinserverConnect{},
 		"local":           &LocalConnect{},
-	})
+		"unix":            &UnixConnect{},
+		"export":          &ExportConnect{},
+		"s3":              &S3Connect{},
+	}
+}
+
+func (t *ConnectEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	t.Ret, err = enumUnmarshal(u, connectEnumTypes())
 	return
 }
 
-func (t *ServeEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
-	t.Ret, err = enumUnmarshal(u, map[string]interface{}{
+func serveEnumTypes() map[string]interface{} {
+	return map[string]interface{}{
 		"tcp":         &TCPServe{},
 		"tls":         &TLSServe{},
 		"stdinserver": &StdinserverServer{},
 		"local":       &LocalServe{},
-	})
+		"unix":        &UnixServe{},
+	}
+}
+
+func (t *ServeEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	t.Ret, err = enumUnmarshal(u, serveEnumTypes())
 	return
 }
 
-func (t *PruningEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
-	t.Ret, err = enumUnmarshal(u, map[string]interface{}{
+// ServeEnumList is a single serve stanza or a list of serve stanzas.
+type ServeEnumList []ServeEnum
+
+func (l *ServeEnumList) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	var seq []interface{}
+	if u(&seq, true) != nil {
+		var single ServeEnum
+		if err := u(&single, false); err != nil {
+			return err
+		}
+		*l = ServeEnumList{single}
+		return nil
+	}
+	var list []ServeEnum
+	if err := u(&list, false); err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return &yaml.TypeError{Errors: []string{"must specify at least one serve stanza"}}
+	}
+	*l = list
+	return nil
+}
+
+// JobNameList is a single job name or a list of job names.
+type JobNameList []string
+
+func (l *JobNameList) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	var single string
+	if u(&single, true) == nil {
+		*l = JobNameList{single}
+		return nil
+	}
+	var list []string
+	if err := u(&list, true); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+func pruningEnumTypes() map[string]interface{} {
+	return map[string]interface{}{
 		"not_replicated": &PruneKeepNotReplicated{},
 		"last_n":         &PruneKeepLastN{},
 		"grid":           &PruneGrid{},
 		"regex":          &PruneKeepRegex{},
-	})
+		"sanoid":         &PruneKeepSanoid{},
+	}
+}
+
+func (t *PruningEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	t.Ret, err = enumUnmarshal(u, pruningEnumTypes())
 	return
 }
 
-func (t *SnapshottingEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
-	t.Ret, err = enumUnmarshal(u, map[string]interface{}{
+func snapshottingEnumTypes() map[string]interface{} {
+	return map[string]interface{}{
 		"periodic": &SnapshottingPeriodic{},
 		"manual":   &SnapshottingManual{},
-	})
+	}
+}
+
+func (t *SnapshottingEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	t.Ret, err = enumUnmarshal(u, snapshottingEnumTypes())
 	return
 }
 
-func (t *LoggingOutletEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
-	t.Ret, err = enumUnmarshal(u, map[string]interface{}{
+func loggingOutletEnumTypes() map[string]interface{} {
+	return map[string]interface{}{
 		"stdout": &StdoutLoggingOutlet{},
 		"syslog": &SyslogLoggingOutlet{},
 		"tcp":    &TCPLoggingOutlet{},
-	})
+	}
+}
+
+func (t *LoggingOutletEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	t.Ret, err = enumUnmarshal(u, loggingOutletEnumTypes())
 	return
 }
 
-func (t *MonitoringEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
-	t.Ret, err = enumUnmarshal(u, map[string]interface{}{
+func monitoringEnumTypes() map[string]interface{} {
+	return map[string]interface{}{
 		"prometheus": &PrometheusMonitoring{},
-	})
+		"otlp":       &OTLPMonitoring{},
+	}
+}
+
+func (t *MonitoringEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	t.Ret, err = enumUnmarshal(u, monitoringEnumTypes())
 	return
 }
 
@@ -579,12 +1083,18 @@ func (t *SyslogFacility) UnmarshalYAML(u func(interface{}, bool) error) (err err
 	return nil
 }
 
-func (t *HookEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
-	t.Ret, err = enumUnmarshal(u, map[string]interface{}{
+func hookEnumTypes() map[string]interface{} {
+	return map[string]interface{}{
 		"command":             &HookCommand{},
 		"postgres-checkpoint": &HookPostgresCheckpoint{},
 		"mysql-lock-tables":   &HookMySQLLockTables{},
-	})
+		"fsfreeze":            &HookFsFreeze{},
+		"libvirt-fsfreeze":    &HookLibvirtFsFreeze{},
+	}
+}
+
+func (t *HookEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	t.Ret, err = enumUnmarshal(u, hookEnumTypes())
 	return
 }
 
@@ -617,13 +1127,22 @@ func ParseConfig(path string) (i *Config, err error) {
 		return
 	}
 
-	return ParseConfigBytes(bytes)
+	return parseConfigBytes(bytes, filepath.Dir(path))
 }
 
+// Relative paths in `include` are relative to the current working directory.
 func ParseConfigBytes(bytes []byte) (*Config, error) {
+	return parseConfigBytes(bytes, ".")
+}
+
+func parseConfigBytes(bytes []byte, dir string) (*Config, error) {
+	bytes, expanded, err := expandIncludesAndTemplates(bytes, dir)
+	if err != nil {
+		return nil, err
+	}
 	var c *Config
 	if err := yaml.UnmarshalStrict(bytes, &c); err != nil {
-		return nil, err
+		return nil, improveParseErrors(err, bytes, expanded)
 	}
 	if c == nil {
 		return nil, fmt.Errorf("config is empty or only consists of comments")
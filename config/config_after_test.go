@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobAfter(t *testing.T) {
+	tmpl := `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"pool<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep:
+    - type: last_n
+      count: 10
+%s
+`
+	c := testValidConfig(t, fmt.Sprintf(tmpl, ""))
+	assert.Nil(t, c.Jobs[0].After())
+
+	c = testValidConfig(t, fmt.Sprintf(tmpl, "  after: other"))
+	assert.Equal(t, JobNameList{"other"}, c.Jobs[0].After())
+
+	c = testValidConfig(t, fmt.Sprintf(tmpl, "  after: [other, third]"))
+	assert.Equal(t, JobNameList{"other", "third"}, c.Jobs[0].After())
+
+	_, err := testConfig(t, fmt.Sprintf(tmpl, "  after: {name: other}"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Blackout configures the windows during which a job does not start new invocations.
+type Blackout struct {
+	Windows []BlackoutWindow `yaml:"windows"`
+	// Pause the replication streams of invocations that are still running when a window begins.
+	PauseStreams bool `yaml:"pause_streams,optional,default=false"`
+}
+
+// BlackoutWindow is a recurring window in local time.
+// In YAML, it is specified as an optional list of weekdays or weekday ranges and a time range,
+// e.g. `mon-fri 08:00-18:00`, `sat,sun 00:00-24:00` or `22:00-06:00` (every day).
+// If the end is not after the start, the window extends into the next day.
+type BlackoutWindow struct {
+	days [7]bool // indexed by time.Weekday
+	// minutes since midnight of the day on which the window starts, start < end <= 2*24*60
+	start, end int
+}
+
+// Weekday reports whether the window starts on day d.
+func (w *BlackoutWindow) Weekday(d time.Weekday) bool {
+	return w.days[d]
+}
+
+// Start returns the offset of the window's start from midnight of the day on which it starts.
+func (w *BlackoutWindow) Start() time.Duration {
+	return time.Duration(w.start) * time.Minute
+}
+
+// End returns the offset of the window's end from midnight of the day on which it starts,
+// which is more than 24h if the window extends into the next day.
+func (w *BlackoutWindow) End() time.Duration {
+	return time.Duration(w.end) * time.Minute
+}
+
+var blackoutWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+var blackoutTimeRangeRegex = regexp.MustCompile(`^(\d{1,2}):(\d{2})-(\d{1,2}):(\d{2})$`)
+
+func parseBlackoutWeekday(s string) (time.Weekday, error) {
+	d, ok := blackoutWeekdays[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("invalid weekday %q: must be one of mon, tue, wed, thu, fri, sat, sun", s)
+	}
+	return d, nil
+}
+
+func parseBlackoutMinutes(hh, mm string) (int, error) {
+	h, err := strconv.Atoi(hh)
+	if err != nil {
+		return 0, err
+	}
+	m, err := strconv.Atoi(mm)
+	if err != nil {
+		return 0, err
+	}
+	if m >= 60 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time of day %s:%s", hh, mm)
+	}
+	return h*60 + m, nil
+}
+
+func ParseBlackoutWindow(s string) (w BlackoutWindow, err error) {
+	fields := strings.Fields(s)
+	var daySpec, timeSpec string
+	switch len(fields) {
+	case 1:
+		daySpec, timeSpec = "", fields[0]
+	case 2:
+		daySpec, timeSpec = fields[0], fields[1]
+	default:
+		return w, fmt.Errorf("invalid blackout window %q: must be `[DAYS] HH:MM-HH:MM`", s)
+	}
+
+	if daySpec == "" {
+		for d := range w.days {
+			w.days[d] = true
+		}
+	} else {
+		for _, r := range strings.Split(daySpec, ",") {
+			bounds := strings.SplitN(r, "-", 2)
+			first, err := parseBlackoutWeekday(bounds[0])
+			if err != nil {
+				return w, fmt.Errorf("invalid blackout window %q: %s", s, err)
+			}
+			last := first
+			if len(bounds) == 2 {
+				if last, err = parseBlackoutWeekday(bounds[1]); err != nil {
+					return w, fmt.Errorf("invalid blackout window %q: %s", s, err)
+				}
+			}
+			// ranges may wrap around the end of the week, e.g. fri-mon
+			for d := first; ; d = (d + 1) % 7 {
+				w.days[d] = true
+				if d == last {
+					break
+				}
+			}
+		}
+	}
+
+	comps := blackoutTimeRangeRegex.FindStringSubmatch(timeSpec)
+	if comps == nil {
+		return w, fmt.Errorf("invalid blackout window %q: time range must be HH:MM-HH:MM", s)
+	}
+	if w.start, err = parseBlackoutMinutes(comps[1], comps[2]); err != nil {
+		return w, fmt.Errorf("invalid blackout window %q: %s", s, err)
+	}
+	if w.end, err = parseBlackoutMinutes(comps[3], comps[4]); err != nil {
+		return w, fmt.Errorf("invalid blackout window %q: %s", s, err)
+	}
+	if w.start == 24*60 {
+		return w, fmt.Errorf("invalid blackout window %q: cannot start at 24:00", s)
+	}
+	if w.start == w.end {
+		return w, fmt.Errorf("invalid blackout window %q: start and end must differ", s)
+	}
+	if w.end < w.start {
+		w.end += 24 * 60
+	}
+	return w, nil
+}
+
+func (w *BlackoutWindow) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	var in string
+	if err := u(&in, true); err != nil {
+		return err
+	}
+	*w, err = ParseBlackoutWindow(in)
+	return err
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBlackoutWindow(t *testing.T) {
+	w, err := ParseBlackoutWindow("mon-fri 08:00-18:30")
+	require.NoError(t, err)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		assert.Equal(t, d != time.Saturday && d != time.Sunday, w.Weekday(d), "%s", d)
+	}
+	assert.Equal(t, 8*time.Hour, w.Start())
+	assert.Equal(t, 18*time.Hour+30*time.Minute, w.End())
+
+	w, err = ParseBlackoutWindow("22:00-06:00")
+	require.NoError(t, err)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		assert.True(t, w.Weekday(d))
+	}
+	assert.Equal(t, 22*time.Hour, w.Start())
+	assert.Equal(t, 30*time.Hour, w.End())
+
+	w, err = ParseBlackoutWindow("fri-mon,Wed 00:00-24:00")
+	require.NoError(t, err)
+	assert.Equal(t, [7]bool{true, true, false, true, false, true, true}, w.days)
+	assert.Equal(t, 24*time.Hour, w.End())
+
+	for _, invalid := range []string{
+		"",
+		"08:00",
+		"mon-fri",
+		"mon 8-18",
+		"mo 08:00-18:00",
+		"mon fri 08:00-18:00",
+		"mon 08:00-08:00",
+		"mon 08:60-09:00",
+		"mon 24:00-06:00",
+		"mon 08:00-24:30",
+	} {
+		_, err := ParseBlackoutWindow(invalid)
+		assert.Error(t, err, "%q", invalid)
+	}
+}
+
+func TestJobBlackout(t *testing.T) {
+	tmpl := `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"pool<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep:
+    - type: last_n
+      count: 10
+%s
+`
+	c := testValidConfig(t, fmt.Sprintf(tmpl, ""))
+	assert.Nil(t, c.Jobs[0].Blackout())
+
+	c = testValidConfig(t, fmt.Sprintf(tmpl, `  blackout:
+    windows: ["mon-fri 08:00-18:00", "22:00-02:00"]
+    pause_streams: true`))
+	b := c.Jobs[0].Blackout()
+	require.NotNil(t, b)
+	assert.Len(t, b.Windows, 2)
+	assert.True(t, b.PauseStreams)
+
+	_, err := testConfig(t, fmt.Sprintf(tmpl, `  blackout:
+    windows: ["mon-fri 8-18"]`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DataSize is an amount of data in bytes.
+// In YAML, it is specified as a non-negative number with an optional unit,
+// either decimal (B, kB, MB, GB, TB) or binary (KiB, MiB, GiB, TiB), e.g. `100 GiB` or `1.5TB`.
+type DataSize uint64
+
+var dataSizeRegex = regexp.MustCompile(`^\s*(\d+(?:\.\d+)?)\s*([a-zA-Z]*)\s*$`)
+
+var dataSizeUnits = map[string]uint64{
+	"":    1,
+	"B":   1,
+	"kB":  1000,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"TB":  1000 * 1000 * 1000 * 1000,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+func ParseDataSize(s string) (DataSize, error) {
+	comps := dataSizeRegex.FindStringSubmatch(s)
+	if comps == nil {
+		return 0, fmt.Errorf("invalid data size %q: must be a number with optional unit", s)
+	}
+	unit, ok := dataSizeUnits[comps[2]]
+	if !ok {
+		return 0, fmt.Errorf("invalid data size %q: unknown unit %q", s, comps[2])
+	}
+	if !strings.Contains(comps[1], ".") {
+		n, err := strconv.ParseUint(comps[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid data size %q: %s", s, err)
+		}
+		return DataSize(n * unit), nil
+	}
+	f, err := strconv.ParseFloat(comps[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid data size %q: %s", s, err)
+	}
+	return DataSize(f * float64(unit)), nil
+}
+
+func (s *DataSize) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	var in string
+	if err := u(&in, true); err != nil {
+		return err
+	}
+	*s, err = ParseDataSize(in)
+	return err
+}
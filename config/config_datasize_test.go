@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zrepl/yaml-config"
+)
+
+func TestDataSize(t *testing.T) {
+	cases := []struct {
+		Comment, Input string
+		Result         *DataSize
+	}{
+		{"empty is error", `""`, nil},
+		{"negative is error", "-1", nil},
+		{"unknown unit is error", "1 XB", nil},
+		{"garbage is error", "foo", nil},
+		{"unitless", "23", dataSizePtr(23)},
+		{"bytes", "23B", dataSizePtr(23)},
+		{"decimal", "2 GB", dataSizePtr(2 * 1000 * 1000 * 1000)},
+		{"binary", "2GiB", dataSizePtr(2 * 1024 * 1024 * 1024)},
+		{"fraction", "1.5 KiB", dataSizePtr(1536)},
+		{"zero", "0", dataSizePtr(0)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Comment, func(t *testing.T) {
+			var out struct {
+				FieldName DataSize `yaml:"fieldname,optional"`
+			}
+			input := fmt.Sprintf("\nfieldname: %s\n", tc.Input)
+			err := yaml.UnmarshalStrict([]byte(input), &out)
+			if tc.Result == nil {
+				assert.Error(t, err)
+				t.Logf("%#v", out)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, *tc.Result, out.FieldName)
+			}
+		})
+	}
+}
+
+func dataSizePtr(s DataSize) *DataSize { return &s }
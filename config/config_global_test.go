@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/syslog"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -57,6 +58,22 @@ global:
 	assert.NotNil(t, (*conf.Global.Logging)[3].Ret.(*TCPLoggingOutlet).TLS)
 }
 
+func TestOutletDedupInterval(t *testing.T) {
+	conf := testValidGlobalSection(t, `
+global:
+  logging:
+  - type: stdout
+    level: info
+    format: human
+  - type: syslog
+    level: warn
+    format: human
+    dedup_interval: 10m
+`)
+	assert.Equal(t, time.Duration(0), (*conf.Global.Logging)[0].Ret.(*StdoutLoggingOutlet).DedupInterval)
+	assert.Equal(t, 10*time.Minute, (*conf.Global.Logging)[1].Ret.(*SyslogLoggingOutlet).DedupInterval)
+}
+
 func TestDefaultLoggingOutlet(t *testing.T) {
 	conf := testValidGlobalSection(t, "")
 	assert.Equal(t, 1, len(*conf.Global.Logging))
@@ -75,6 +92,35 @@ global:
 	assert.Equal(t, ":9091", conf.Global.Monitoring[0].Ret.(*PrometheusMonitoring).Listen)
 }
 
+func TestOTLPMonitoring(t *testing.T) {
+	conf := testValidGlobalSection(t, `
+global:
+  monitoring:
+    - type: otlp
+      endpoint: http://localhost:4318/v1/traces
+`)
+	o := conf.Global.Monitoring[0].Ret.(*OTLPMonitoring)
+	assert.Equal(t, "http://localhost:4318/v1/traces", o.Endpoint)
+	assert.Equal(t, "zrepl", o.ServiceName)
+	assert.Equal(t, 5*time.Second, o.Interval)
+	assert.Empty(t, o.Headers)
+
+	conf = testValidGlobalSection(t, `
+global:
+  monitoring:
+    - type: otlp
+      endpoint: https://tempo.example.com/v1/traces
+      headers:
+        Authorization: "Basic Zm9vOmJhcg=="
+      service_name: zrepl-backup
+      interval: 30s
+`)
+	o = conf.Global.Monitoring[0].Ret.(*OTLPMonitoring)
+	assert.Equal(t, map[string]string{"Authorization": "Basic Zm9vOmJhcg=="}, o.Headers)
+	assert.Equal(t, "zrepl-backup", o.ServiceName)
+	assert.Equal(t, 30*time.Second, o.Interval)
+}
+
 func TestSyslogLoggingOutletFacility(t *testing.T) {
 	type SyslogFacilityPriority struct {
 		Facility string
@@ -113,3 +159,72 @@ func TestLoggingOutletEnumList_SetDefaults(t *testing.T) {
 		assert.Equal(t, "warn", (*e)[0].Ret.(*StdoutLoggingOutlet).Level)
 	})
 }
+
+func TestGlobalZFSCommandWrapper(t *testing.T) {
+	conf := testValidGlobalSection(t, "")
+	assert.Empty(t, conf.Global.ZFS.CommandWrapper)
+
+	conf = testValidGlobalSection(t, `
+global:
+  zfs:
+    command_wrapper: ["sudo", "-n"]
+`)
+	assert.Equal(t, []string{"sudo", "-n"}, conf.Global.ZFS.CommandWrapper)
+}
+
+func TestGlobalAbstractionsGC(t *testing.T) {
+	conf := testValidGlobalSection(t, "")
+	assert.Equal(t, time.Duration(0), conf.Global.AbstractionsGC.Interval)
+	assert.Equal(t, 7*24*time.Hour, conf.Global.AbstractionsGC.MinAge)
+	assert.False(t, conf.Global.AbstractionsGC.DryRun)
+
+	conf = testValidGlobalSection(t, `
+global:
+  abstractions_gc:
+    interval: 24h
+    min_age: 48h
+    dry_run: true
+`)
+	assert.Equal(t, 24*time.Hour, conf.Global.AbstractionsGC.Interval)
+	assert.Equal(t, 48*time.Hour, conf.Global.AbstractionsGC.MinAge)
+	assert.True(t, conf.Global.AbstractionsGC.DryRun)
+}
+
+func TestGlobalHistory(t *testing.T) {
+	conf := testValidGlobalSection(t, "")
+	assert.Equal(t, "", conf.Global.History.Path)
+
+	conf = testValidGlobalSection(t, `
+global:
+  history:
+    path: /var/lib/zrepl/history.jsonl
+`)
+	assert.Equal(t, "/var/lib/zrepl/history.jsonl", conf.Global.History.Path)
+}
+
+func TestJobLogging(t *testing.T) {
+	conf := testValidGlobalSection(t, "")
+	assert.Nil(t, conf.Jobs[0].Logging())
+
+	conf = testValidConfig(t, `
+jobs:
+- name: dummyjob
+  type: sink
+  serve:
+    type: tcp
+    listen: ":2342"
+    clients: {
+      "10.0.0.1":"foo"
+    }
+  root_fs: zroot/foo
+  logging:
+  - type: stdout
+    level: debug
+    format: human
+`)
+	l := conf.Jobs[0].Logging()
+	require.NotNil(t, l)
+	require.Len(t, *l, 1)
+	assert.Equal(t, "debug", (*l)[0].Ret.(*StdoutLoggingOutlet).Level)
+	assert.Equal(t, "warn", (*conf.Global.Logging)[0].Ret.(*StdoutLoggingOutlet).Level)
+}
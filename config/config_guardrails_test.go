@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuardrails(t *testing.T) {
+	tmpl := `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"pool<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep:
+    - type: last_n
+      count: 10
+%s
+`
+	c := testValidConfig(t, fmt.Sprintf(tmpl, ""))
+	assert.Nil(t, c.Jobs[0].Ret.(*SnapJob).Guardrails)
+
+	c = testValidConfig(t, fmt.Sprintf(tmpl, `  guardrails:
+    max_destroyed_snapshots: 100`))
+	g := c.Jobs[0].Ret.(*SnapJob).Guardrails
+	require.NotNil(t, g)
+	assert.Equal(t, 100, g.MaxDestroyedSnapshots)
+	assert.Equal(t, 0, g.MaxFullSends)
+	assert.False(t, g.RefuseFullSends)
+
+	c = testValidConfig(t, fmt.Sprintf(tmpl, `  guardrails:
+    max_full_sends: 10
+    refuse_full_sends: true`))
+	assert.True(t, c.Jobs[0].Ret.(*SnapJob).Guardrails.RefuseFullSends)
+
+	_, err := testConfig(t, fmt.Sprintf(tmpl, `  guardrails:
+    override: true`))
+	assert.Error(t, err, "the override is a signal, not a config field")
+
+	c = testValidConfig(t, fmt.Sprintf(tmpl, `  guardrails:
+    confirm_destroy_fraction: 0.25`))
+	assert.Equal(t, 0.25, c.Jobs[0].Ret.(*SnapJob).Guardrails.ConfirmDestroyFraction)
+
+	_, err = testConfig(t, fmt.Sprintf(tmpl, `  guardrails:
+    max_destroyed_snapshots: -1`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/zrepl/yaml-config"
+)
+
+// Top-level keys and job keys that are expanded before the config is parsed into a Config.
+const (
+	configKeyInclude   = "include"
+	configKeyTemplates = "templates"
+	configKeyJobs      = "jobs"
+	jobKeyTemplate     = "template"
+)
+
+type yamlMap = map[interface{}]interface{}
+
+// Expands `include` and job `template` directives of the config document in bytes.
+// Relative include paths are relative to dir.
+// If the document does not use these directives, it is returned unmodified (expanded == false)
+// so that parser errors refer to the original line numbers.
+func expandIncludesAndTemplates(bytes []byte, dir string) (out []byte, expanded bool, err error) {
+	var doc yamlMap
+	if err := yaml.Unmarshal(bytes, &doc); err != nil {
+		return nil, false, err
+	}
+	_, hasInclude := doc[configKeyInclude]
+	_, hasTemplates := doc[configKeyTemplates]
+	if !hasInclude && !hasTemplates {
+		return bytes, false, nil
+	}
+
+	templates, jobs, err := collectIncludes(doc, dir, nil, map[string]bool{})
+	if err != nil {
+		return nil, false, err
+	}
+	jobs, err = applyTemplates(templates, jobs)
+	if err != nil {
+		return nil, false, err
+	}
+	delete(doc, configKeyInclude)
+	delete(doc, configKeyTemplates)
+	doc[configKeyJobs] = jobs
+	out, err = yaml.Marshal(doc)
+	return out, true, err
+}
+
+// Returns the templates and jobs of doc, with those of included files first.
+// stack holds the files that (transitively) include doc, it is empty for the main config file.
+// A file that is included more than once, e.g., by two files that are both included, is only read the first time,
+// included holds the files that have been read so far.
+func collectIncludes(doc yamlMap, dir string, stack []string, included map[string]bool) (templates, jobs []interface{}, err error) {
+	isMain := len(stack) == 0
+	for k := range doc {
+		switch k {
+		case configKeyInclude, configKeyTemplates, configKeyJobs:
+		default:
+			if !isMain {
+				return nil, nil, fmt.Errorf("included files may only contain %q, %q and %q, got %q", configKeyInclude, configKeyTemplates, configKeyJobs, k)
+			}
+		}
+	}
+
+	var patterns []string
+	if err := convertYAML(doc[configKeyInclude], &patterns); err != nil {
+		return nil, nil, fmt.Errorf("%q must be a list of file paths: %s", configKeyInclude, err)
+	}
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid include pattern %q: %s", pattern, err)
+		}
+		if len(paths) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, nil, fmt.Errorf("included file %q does not exist", pattern)
+		}
+		for _, path := range paths {
+			for _, s := range stack {
+				if s == path {
+					return nil, nil, fmt.Errorf("include cycle: %s -> %s", strings.Join(stack, " -> "), path)
+				}
+			}
+			if included[path] {
+				continue
+			}
+			included[path] = true
+			bytes, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			var incDoc yamlMap
+			if err := yaml.Unmarshal(bytes, &incDoc); err != nil {
+				return nil, nil, fmt.Errorf("included file %q: %s", path, err)
+			}
+			incTemplates, incJobs, err := collectIncludes(incDoc, filepath.Dir(path), append(stack, path), included)
+			if err != nil {
+				return nil, nil, fmt.Errorf("included file %q: %s", path, err)
+			}
+			templates = append(templates, incTemplates...)
+			jobs = append(jobs, incJobs...)
+		}
+	}
+
+	var ownTemplates, ownJobs []interface{}
+	if err := convertYAML(doc[configKeyTemplates], &ownTemplates); err != nil {
+		return nil, nil, fmt.Errorf("%q must be a list: %s", configKeyTemplates, err)
+	}
+	if err := convertYAML(doc[configKeyJobs], &ownJobs); err != nil {
+		return nil, nil, fmt.Errorf("%q must be a list: %s", configKeyJobs, err)
+	}
+	return append(templates, ownTemplates...), append(jobs, ownJobs...), nil
+}
+
+// Replaces the `template` key of each job with the contents of the named template.
+// Values of the job take precedence over those of the template, maps are merged recursively.
+// Templates can use other templates.
+func applyTemplates(templateList, jobs []interface{}) ([]interface{}, error) {
+	templates := make(map[string]yamlMap, len(templateList))
+	for i, t := range templateList {
+		m, ok := t.(yamlMap)
+		if !ok {
+			return nil, fmt.Errorf("template #%d must be a map", i)
+		}
+		name, ok := m["name"].(string)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("template #%d must have a name", i)
+		}
+		if _, ok := templates[name]; ok {
+			return nil, fmt.Errorf("duplicate template name %q", name)
+		}
+		t := copyYAMLMap(m)
+		delete(t, "name")
+		templates[name] = t
+	}
+
+	var expand func(m yamlMap, stack []string) (yamlMap, error)
+	expand = func(m yamlMap, stack []string) (yamlMap, error) {
+		tv, ok := m[jobKeyTemplate]
+		if !ok {
+			return m, nil
+		}
+		name, ok := tv.(string)
+		if !ok {
+			return nil, fmt.Errorf("%q must be a template name", jobKeyTemplate)
+		}
+		for _, s := range stack {
+			if s == name {
+				return nil, fmt.Errorf("template cycle: %s -> %s", strings.Join(stack, " -> "), name)
+			}
+		}
+		t, ok := templates[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown template %q", name)
+		}
+		base, err := expand(t, append(stack, name))
+		if err != nil {
+			return nil, err
+		}
+		override := copyYAMLMap(m)
+		delete(override, jobKeyTemplate)
+		return mergeYAMLMaps(base, override), nil
+	}
+
+	expanded := make([]interface{}, len(jobs))
+	for i, j := range jobs {
+		m, ok := j.(yamlMap)
+		if !ok {
+			expanded[i] = j // let the parser report the error
+			continue
+		}
+		e, err := expand(m, nil)
+		if err != nil {
+			return nil, fmt.Errorf("job %v: %s", m["name"], err)
+		}
+		expanded[i] = e
+	}
+	return expanded, nil
+}
+
+func copyYAMLMap(m yamlMap) yamlMap {
+	c := make(yamlMap, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// Returns a new map with the values of override taking precedence over those of base.
+func mergeYAMLMaps(base, override yamlMap) yamlMap {
+	merged := copyYAMLMap(base)
+	for k, v := range override {
+		bm, bok := merged[k].(yamlMap)
+		om, ook := v.(yamlMap)
+		if bok && ook {
+			merged[k] = mergeYAMLMaps(bm, om)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// Converts a generic YAML value into out, nil is left as is.
+func convertYAML(in interface{}, out interface{}) error {
+	if in == nil {
+		return nil
+	}
+	bytes, err := yaml.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return yaml.UnmarshalStrict(bytes, out)
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const templatesTestJobTemplate = `
+templates:
+- name: offsite
+  type: push
+  connect:
+    type: tcp
+    address: "backup.example.com:8888"
+  snapshotting:
+    type: periodic
+    prefix: zrepl_
+    interval: 10m
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    keep_receiver:
+    - type: last_n
+      count: 10
+`
+
+func TestTemplates(t *testing.T) {
+	conf := testValidConfig(t, templatesTestJobTemplate+`
+jobs:
+- name: a
+  template: offsite
+  filesystems: {"pool/a<": true}
+- name: b
+  template: offsite
+  filesystems: {"pool/b<": true}
+  snapshotting:
+    interval: 1h
+`)
+	require.Len(t, conf.Jobs, 2)
+
+	a := conf.Jobs[0].Ret.(*PushJob)
+	assert.Equal(t, "a", a.Name)
+	assert.Equal(t, "backup.example.com:8888", a.Connect.Ret.(*TCPConnect).Address)
+	assert.Equal(t, 10*time.Minute, a.Snapshotting.Ret.(*SnapshottingPeriodic).Interval)
+
+	b := conf.Jobs[1].Ret.(*PushJob)
+	assert.Equal(t, map[string]bool{"pool/b<": true}, map[string]bool(b.Filesystems))
+	// maps are merged
+	assert.Equal(t, time.Hour, b.Snapshotting.Ret.(*SnapshottingPeriodic).Interval)
+	assert.Equal(t, "zrepl_", b.Snapshotting.Ret.(*SnapshottingPeriodic).Prefix)
+}
+
+func TestTemplatesErrors(t *testing.T) {
+	_, err := testConfig(t, templatesTestJobTemplate+`
+jobs:
+- name: a
+  template: doesnotexist
+  filesystems: {"pool/a<": true}
+`)
+	assert.Error(t, err)
+
+	_, err = testConfig(t, `
+templates:
+- name: x
+  template: y
+- name: y
+  template: x
+jobs:
+- name: a
+  template: x
+`)
+	assert.Error(t, err)
+
+	_, err = testConfig(t, templatesTestJobTemplate+templatesTestJobTemplate[len("\ntemplates:"):]+`
+jobs: []
+`)
+	assert.Error(t, err, "duplicate template names")
+}
+
+func TestInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-config-include-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0700))
+		require.NoError(t, ioutil.WriteFile(p, []byte(content), 0600))
+		return p
+	}
+
+	write("templates/offsite.yml", templatesTestJobTemplate)
+	write("jobs.d/a.yml", `
+jobs:
+- name: a
+  template: offsite
+  filesystems: {"pool/a<": true}
+`)
+	write("jobs.d/b.yml", `
+jobs:
+- name: b
+  template: offsite
+  filesystems: {"pool/b<": true}
+`)
+	main := write("zrepl.yml", `
+include:
+- templates/offsite.yml
+- jobs.d/*.yml
+global:
+  logging:
+  - type: stdout
+    level: info
+    format: human
+jobs:
+- name: c
+  template: offsite
+  filesystems: {"pool/c<": true}
+`)
+
+	conf, err := ParseConfig(main)
+	require.NoError(t, err)
+	var names []string
+	for _, j := range conf.Jobs {
+		names = append(names, j.Name())
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+
+	// included files must not contain global settings
+	write("bad.yml", `
+global: {}
+`)
+	main = write("zrepl-bad.yml", `
+include: [bad.yml]
+jobs: []
+`)
+	_, err = ParseConfig(main)
+	assert.Error(t, err)
+
+	// include cycles are detected
+	write("cycle.yml", `
+include: [cycle.yml]
+`)
+	main = write("zrepl-cycle.yml", `
+include: [cycle.yml]
+jobs: []
+`)
+	_, err = ParseConfig(main)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "include cycle")
+
+	// a file that is included by two included files (diamond) is no cycle and is read once
+	write("diamond/d.yml", templatesTestJobTemplate)
+	write("diamond/b.yml", `
+include: [d.yml]
+jobs:
+- name: b
+  template: offsite
+  filesystems: {"pool/b<": true}
+`)
+	write("diamond/c.yml", `
+include: [d.yml]
+jobs:
+- name: c
+  template: offsite
+  filesystems: {"pool/c<": true}
+`)
+	main = write("zrepl-diamond.yml", `
+include: [diamond/b.yml, diamond/c.yml]
+jobs: []
+`)
+	conf, err = ParseConfig(main)
+	require.NoError(t, err)
+	names = nil
+	for _, j := range conf.Jobs {
+		names = append(names, j.Name())
+	}
+	assert.Equal(t, []string{"b", "c"}, names)
+
+	// non-glob includes must exist
+	main = write("zrepl-missing.yml", `
+include: [missing.yml]
+jobs: []
+`)
+	_, err = ParseConfig(main)
+	assert.Error(t, err)
+}
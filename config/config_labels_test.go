@@ -0,0 +1,26 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobLabels(t *testing.T) {
+	tmpl := `
+jobs:
+- name: sink
+  type: sink
+  serve:
+    type: local
+    listener_name: localsink
+  root_fs: "pool/sink"
+%s
+`
+	c := testValidConfig(t, fmt.Sprintf(tmpl, ""))
+	assert.Nil(t, c.Jobs[0].Labels())
+
+	c = testValidConfig(t, fmt.Sprintf(tmpl, "  labels: {customer: acme, tier: gold}"))
+	assert.Equal(t, map[string]string{"customer": "acme", "tier": "gold"}, c.Jobs[0].Labels())
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// MonitorSnapshots configures the thresholds checked by `zrepl monitor snapshots`.
+// Each rule applies to the snapshots whose name starts with Prefix (all snapshots if empty).
+type MonitorSnapshots struct {
+	Count  []MonitorSnapshotCount `yaml:"count,optional"`
+	Latest []MonitorSnapshotAge   `yaml:"latest,optional"`
+	Oldest []MonitorSnapshotAge   `yaml:"oldest,optional"`
+}
+
+// MonitorSnapshotCount is a threshold on the number of snapshots per filesystem.
+// 0 disables Warning or Critical, at least one of them must be set.
+type MonitorSnapshotCount struct {
+	Prefix   string `yaml:"prefix,optional"`
+	Warning  uint   `yaml:"warning,optional"`
+	Critical uint   `yaml:"critical,optional"`
+}
+
+// MonitorSnapshotAge is a threshold on the age of the newest or oldest snapshot per filesystem.
+// 0 disables Warning or Critical, at least one of them must be set.
+type MonitorSnapshotAge struct {
+	Prefix   string        `yaml:"prefix,optional"`
+	Warning  time.Duration `yaml:"warning,optional,zeropositive"`
+	Critical time.Duration `yaml:"critical,optional,zeropositive"`
+}
+
+// Monitor returns the snapshot monitoring configuration of the job, nil if it has none or if the job type does not support it.
+func (j JobEnum) Monitor() *MonitorSnapshots {
+	switch v := j.Ret.(type) {
+	case *SnapJob:
+		return v.Monitor
+	case *PushJob:
+		return v.Monitor
+	case *PullJob:
+		return v.Monitor
+	case *SinkJob:
+		return v.Monitor
+	case *SourceJob:
+		return v.Monitor
+	default:
+		return nil
+	}
+}
+
+func (c MonitorSnapshotCount) Validate() error {
+	if c.Warning == 0 && c.Critical == 0 {
+		return fmt.Errorf("`warning` or `critical` must be positive")
+	}
+	if c.Critical > 0 && c.Warning > c.Critical {
+		return fmt.Errorf("`warning` must not be greater than `critical`")
+	}
+	return nil
+}
+
+func (a MonitorSnapshotAge) Validate() error {
+	if a.Warning <= 0 && a.Critical <= 0 {
+		return fmt.Errorf("`warning` or `critical` must be positive")
+	}
+	if a.Critical > 0 && a.Warning > a.Critical {
+		return fmt.Errorf("`warning` must not be greater than `critical`")
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitor(t *testing.T) {
+	tmpl := `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"pool<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep:
+    - type: last_n
+      count: 10
+%s
+`
+	c := testValidConfig(t, fmt.Sprintf(tmpl, ""))
+	assert.Nil(t, c.Jobs[0].Monitor())
+
+	c = testValidConfig(t, fmt.Sprintf(tmpl, `  monitor:
+    count:
+    - prefix: zrepl_
+      warning: 20
+      critical: 30
+    latest:
+    - critical: 2h
+    oldest:
+    - prefix: zrepl_
+      warning: 24h
+      critical: 48h`))
+	m := c.Jobs[0].Monitor()
+	require.NotNil(t, m)
+	assert.Equal(t, []MonitorSnapshotCount{{Prefix: "zrepl_", Warning: 20, Critical: 30}}, m.Count)
+	assert.Equal(t, []MonitorSnapshotAge{{Critical: 2 * time.Hour}}, m.Latest)
+	assert.Equal(t, []MonitorSnapshotAge{{Prefix: "zrepl_", Warning: 24 * time.Hour, Critical: 48 * time.Hour}}, m.Oldest)
+	assert.NoError(t, m.Count[0].Validate())
+	assert.NoError(t, m.Oldest[0].Validate())
+
+	// a rule without thresholds parses, but does not validate
+	c = testValidConfig(t, fmt.Sprintf(tmpl, `  monitor:
+    latest:
+    - prefix: zrepl_`))
+	assert.Error(t, c.Jobs[0].Monitor().Latest[0].Validate())
+
+	assert.Error(t, MonitorSnapshotCount{Warning: 2, Critical: 1}.Validate())
+	assert.Error(t, MonitorSnapshotCount{}.Validate())
+	assert.Error(t, MonitorSnapshotAge{Warning: 2 * time.Hour, Critical: time.Hour}.Validate())
+	assert.Error(t, MonitorSnapshotAge{}.Validate())
+	// each threshold is optional on its own
+	assert.NoError(t, MonitorSnapshotCount{Warning: 2}.Validate())
+	assert.NoError(t, MonitorSnapshotCount{Critical: 2}.Validate())
+	assert.NoError(t, MonitorSnapshotAge{Warning: time.Hour}.Validate())
+	assert.NoError(t, MonitorSnapshotAge{Critical: time.Hour}.Validate())
+}
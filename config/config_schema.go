@@ -0,0 +1,215 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+type jsonSchema = map[string]interface{}
+
+// The variants of the config's enum types, see enumUnmarshal.
+var enumTypes = map[reflect.Type]func() map[string]interface{}{
+	reflect.TypeOf(JobEnum{}):           jobEnumTypes,
+	reflect.TypeOf(ConnectEnum{}):       connectEnumTypes,
+	reflect.TypeOf(ServeEnum{}):         serveEnumTypes,
+	reflect.TypeOf(PruningEnum{}):       pruningEnumTypes,
+	reflect.TypeOf(SnapshottingEnum{}):  snapshottingEnumTypes,
+	reflect.TypeOf(LoggingOutletEnum{}): loggingOutletEnumTypes,
+	reflect.TypeOf(MonitoringEnum{}):    monitoringEnumTypes,
+	reflect.TypeOf(HookEnum{}):          hookEnumTypes,
+}
+
+// Schemas of the types that are parsed from scalars by a custom UnmarshalYAML.
+var scalarTypeSchemas = map[reflect.Type]jsonSchema{
+	reflect.TypeOf(time.Duration(0)):           {"type": "string", "description": "duration, e.g. 10m"},
+	reflect.TypeOf(PositiveDurationOrManual{}): {"type": "string", "description": "positive duration or 'manual'"},
+	reflect.TypeOf(DataSize(0)):                {"type": []string{"string", "integer"}, "description": "size in bytes, e.g. 10GiB"},
+	reflect.TypeOf(RetentionIntervalList{}):    {"type": "string", "description": "retention grid, e.g. 1x1h(keep=all) | 24x1h"},
+	reflect.TypeOf(SyslogFacility(0)):          {"type": "string", "description": "syslog facility, e.g. local0"},
+	reflect.TypeOf(BlackoutWindow{}):           {"type": "string", "description": "blackout window in local time, e.g. mon-fri 08:00-18:00"},
+}
+
+type yamlField struct {
+	Key      string
+	Type     reflect.Type
+	Required bool
+}
+
+// Returns the fields of struct type t as seen by the yaml decoder,
+// i.e., including the fields of inline structs.
+func yamlFields(t reflect.Type) []yamlField {
+	var fields []yamlField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		comps := strings.Split(tag, ",")
+		required := true
+		inline := false
+		for _, flag := range comps[1:] {
+			switch {
+			case flag == "optional", strings.HasPrefix(flag, "default="):
+				required = false
+			case flag == "inline":
+				inline = true
+			}
+		}
+		if inline {
+			fields = append(fields, yamlFields(f.Type)...)
+			continue
+		}
+		key := comps[0]
+		if key == "" {
+			key = strings.ToLower(f.Name)
+		}
+		fields = append(fields, yamlField{Key: key, Type: f.Type, Required: required})
+	}
+	return fields
+}
+
+type schemaGenerator struct {
+	definitions jsonSchema
+}
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) jsonSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if s, ok := scalarTypeSchemas[t]; ok {
+		return s
+	}
+	if variants, ok := enumTypes[t]; ok {
+		return g.definition(t, func() jsonSchema { return g.enumSchema(variants()) })
+	}
+	if t == reflect.TypeOf(ServeEnumList{}) {
+		item := g.schemaOf(reflect.TypeOf(ServeEnum{}))
+		return jsonSchema{"oneOf": []interface{}{item, jsonSchema{"type": "array", "items": item, "minItems": 1}}}
+	}
+	if t == reflect.TypeOf(JobNameList{}) {
+		return jsonSchema{"oneOf": []interface{}{jsonSchema{"type": "string"}, jsonSchema{"type": "array", "items": jsonSchema{"type": "string"}}}}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return jsonSchema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jsonSchema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return jsonSchema{"type": "number"}
+	case reflect.String:
+		return jsonSchema{"type": "string"}
+	case reflect.Slice:
+		return jsonSchema{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return jsonSchema{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return g.definition(t, func() jsonSchema { return g.structSchema(t) })
+	default:
+		return jsonSchema{}
+	}
+}
+
+// Adds the schema of t to the definitions (if it is not defined yet) and returns a reference to it.
+func (g *schemaGenerator) definition(t reflect.Type, build func() jsonSchema) jsonSchema {
+	name := t.Name()
+	if _, ok := g.definitions[name]; !ok {
+		g.definitions[name] = jsonSchema{} // placeholder for recursive types
+		g.definitions[name] = build()
+	}
+	return jsonSchema{"$ref": "#/definitions/" + name}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) jsonSchema {
+	properties := jsonSchema{}
+	required := []string{}
+	for _, f := range yamlFields(t) {
+		properties[f.Key] = g.schemaOf(f.Type)
+		if f.Required {
+			required = append(required, f.Key)
+		}
+	}
+	s := jsonSchema{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func (g *schemaGenerator) enumSchema(variants map[string]interface{}) jsonSchema {
+	names := make([]string, 0, len(variants))
+	for name := range variants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	conditions := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		conditions = append(conditions, jsonSchema{
+			"if":   jsonSchema{"properties": jsonSchema{"type": jsonSchema{"const": name}}},
+			"then": g.schemaOf(reflect.TypeOf(variants[name])),
+		})
+	}
+	return jsonSchema{
+		"type":       "object",
+		"required":   []string{"type"},
+		"properties": jsonSchema{"type": jsonSchema{"enum": names}},
+		"allOf":      conditions,
+	}
+}
+
+// JSONSchema returns a JSON schema (draft-07) of the config file.
+// It is derived from the config types and can be used for editor autocompletion
+// or for validating config files in CI.
+func JSONSchema() ([]byte, error) {
+	g := &schemaGenerator{definitions: jsonSchema{}}
+	root := g.structSchema(reflect.TypeOf(Config{}))
+
+	// jobs that use a template are only complete after the template has been applied
+	properties := root["properties"].(jsonSchema)
+	properties[configKeyJobs] = jsonSchema{
+		"type": "array",
+		"items": jsonSchema{
+			"if":   jsonSchema{"required": []string{jobKeyTemplate}},
+			"then": jsonSchema{"type": "object", "required": []string{jobKeyTemplate}},
+			"else": g.schemaOf(reflect.TypeOf(JobEnum{})),
+		},
+	}
+	properties[configKeyTemplates] = jsonSchema{
+		"type":  "array",
+		"items": jsonSchema{"type": "object", "required": []string{"name"}},
+	}
+	properties[configKeyInclude] = jsonSchema{
+		"type":  "array",
+		"items": jsonSchema{"type": "string"},
+	}
+	// the jobs may be defined in included files
+	if required, ok := root["required"]; ok {
+		delete(root, "required")
+		root["if"] = jsonSchema{"required": []string{configKeyInclude}}
+		root["else"] = jsonSchema{"required": required}
+	}
+
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	root["title"] = "zrepl configuration"
+	root["definitions"] = g.definitions
+	out, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal config schema: %s", err)
+	}
+	return out, nil
+}
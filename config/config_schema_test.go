@@ -0,0 +1,34 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSchema(t *testing.T) {
+	out, err := JSONSchema()
+	require.NoError(t, err)
+
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal(out, &schema))
+
+	defs := schema["definitions"].(map[string]interface{})
+	for _, name := range []string{"JobEnum", "PushJob", "SnapshottingPeriodic", "TLSConnect", "HookCommand"} {
+		assert.Contains(t, defs, name)
+	}
+
+	push := defs["PushJob"].(map[string]interface{})
+	assert.Equal(t, false, push["additionalProperties"])
+	props := push["properties"].(map[string]interface{})
+	assert.Contains(t, props, "connect") // inline ActiveJob
+	assert.Contains(t, props, "filesystems")
+	assert.Contains(t, push["required"], "snapshotting")
+	assert.NotContains(t, push["required"], "filesystems_property")
+
+	jobs := defs["JobEnum"].(map[string]interface{})
+	typeEnum := jobs["properties"].(map[string]interface{})["type"].(map[string]interface{})["enum"]
+	assert.Equal(t, []interface{}{"pull", "push", "sink", "snap", "source", "test-restore", "verify"}, typeEnum)
+}
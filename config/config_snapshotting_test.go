@@ -49,6 +49,7 @@ jobs:
     - type: command
       path: /tmp/path/to/command
       filesystems: { "zroot<": true, "<": false }
+      order: -1
     - type: postgres-checkpoint
       dsn: "host=localhost port=5432 user=postgres sslmode=disable"
       filesystems: {
@@ -59,6 +60,19 @@ jobs:
       filesystems: {
         "tank/mysql": true
       }
+    - type: fsfreeze
+      mountpoints: [ /mnt/vm1 ]
+      filesystems: {
+        "tank/vm1": true
+      }
+    - type: libvirt-fsfreeze
+      domains:
+      - name: vm2
+        timeout: 5s
+        on_failure: warn
+      filesystems: {
+        "tank/vm2": true
+      }
 `
 
 	fillSnapshotting := func(s string) string { return fmt.Sprintf(tmpl, s) }
@@ -83,8 +97,20 @@ jobs:
 		hs := c.Jobs[0].Ret.(*PushJob).Snapshotting.Ret.(*SnapshottingPeriodic).Hooks
 		assert.Equal(t, hs[0].Ret.(*HookCommand).Filesystems["<"], true)
 		assert.Equal(t, hs[1].Ret.(*HookCommand).Filesystems["zroot<"], true)
+		assert.Equal(t, 0, hs[0].Ret.(*HookCommand).Order)
+		assert.Equal(t, -1, hs[1].Ret.(*HookCommand).Order)
 		assert.Equal(t, hs[2].Ret.(*HookPostgresCheckpoint).Filesystems["tank/postgres/data11"], true)
 		assert.Equal(t, hs[3].Ret.(*HookMySQLLockTables).Filesystems["tank/mysql"], true)
+		ff := hs[4].Ret.(*HookFsFreeze)
+		assert.Equal(t, []string{"/mnt/vm1"}, ff.Mountpoints)
+		assert.Equal(t, "fsfreeze", ff.Command)
+		assert.Equal(t, 10*time.Second, ff.Timeout)
+		assert.Equal(t, time.Minute, ff.MaxFrozen)
+		lf := hs[5].Ret.(*HookLibvirtFsFreeze)
+		assert.Equal(t, "qemu:///system", lf.URI)
+		assert.Equal(t, "fail", lf.OnFailure)
+		assert.Equal(t, 30*time.Second, lf.Timeout)
+		assert.Equal(t, &HookLibvirtDomain{Name: "vm2", Timeout: 5 * time.Second, OnFailure: "warn"}, lf.Domains[0])
 	})
 
 }
@@ -55,6 +55,21 @@ jobs:
 			server_cn: "server1"
 			`,
 		},
+		{
+			Name:        "tls_with_crl_and_pins",
+			ExpectError: false,
+			Connect: `
+			type: tls
+			address: "server1.foo.bar:8888"
+			ca:   /etc/zrepl/ca.crt
+			cert: /etc/zrepl/backupserver.fullchain
+			key:  /etc/zrepl/backupserver.key
+			server_cn: "server1"
+			crl: /etc/zrepl/ca.crl
+			pinned_cert_sha256: ["3F:9B"]
+			pinned_spki_sha256: ["Y7CeOX4h0kCWjMpy3hfJ+kRY8zX5ekCtrahdsOFhKX0="]
+			`,
+		},
 		{
 			Name:        "tcp_without_port",
 			ExpectError: true,
@@ -97,3 +112,41 @@ jobs:
 	}
 
 }
+
+func TestServeList(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: sink
+  root_fs: "pool/backup"
+  serve:
+%s
+`
+	single := testValidConfig(t, fmt.Sprintf(tmpl, `
+    type: tcp
+    listen: ":8888"
+    clients: {"10.0.0.1": "foo"}
+`))
+	serve := single.Jobs[0].Ret.(*SinkJob).Serve
+	require.Len(t, serve, 1)
+	require.IsType(t, &TCPServe{}, serve[0].Ret)
+
+	multi := testValidConfig(t, fmt.Sprintf(tmpl, `
+    - type: tcp
+      listen: ":8888"
+      clients: {"10.0.0.1": "foo"}
+    - type: stdinserver
+      client_identities: ["foo"]
+`))
+	serve = multi.Jobs[0].Ret.(*SinkJob).Serve
+	require.Len(t, serve, 2)
+	require.IsType(t, &TCPServe{}, serve[0].Ret)
+	require.IsType(t, &StdinserverServer{}, serve[1].Ret)
+
+	_, err := testConfig(t, fmt.Sprintf(tmpl, "    []"))
+	require.Error(t, err)
+	_, err = testConfig(t, fmt.Sprintf(tmpl, `
+    - type: nonexistent
+`))
+	require.Error(t, err)
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zrepl/yaml-config"
+)
+
+// Matches the yaml decoder's error message for unknown fields.
+var unknownFieldErrorRegex = regexp.MustCompile(`^line (\d+): field (\S+) not found in type (.+)$`)
+
+var yamlErrorLineRegex = regexp.MustCompile(`^line (\d+): `)
+
+// Improves the parser's error messages:
+// unknown fields get a suggestion for the closest known field (e.g. `interval` for `intervall`),
+// and for configs that were expanded from includes and templates,
+// the error is attributed to the job it occurred in because the line numbers refer to the expanded config.
+func improveParseErrors(err error, doc []byte, expanded bool) error {
+	terr, ok := err.(*yaml.TypeError)
+	if !ok {
+		return err
+	}
+	var jobAtLine func(line int) (string, bool)
+	if expanded {
+		jobAtLine = expandedJobAtLine(doc)
+	}
+	types := knownStructTypes()
+	errs := make([]string, len(terr.Errors))
+	for i, e := range terr.Errors {
+		if m := unknownFieldErrorRegex.FindStringSubmatch(e); m != nil {
+			if t, ok := types[m[3]]; ok {
+				if s := suggestField(m[2], t); s != "" {
+					e = fmt.Sprintf("%s (did you mean %q?)", e, s)
+				}
+			}
+		}
+		if jobAtLine != nil {
+			if m := yamlErrorLineRegex.FindStringSubmatch(e); m != nil {
+				line, _ := strconv.Atoi(m[1])
+				prefix := fmt.Sprintf("line %d of expanded config", line)
+				if job, ok := jobAtLine(line); ok {
+					prefix += fmt.Sprintf(" (job %s)", job)
+				}
+				e = prefix + ": " + strings.TrimPrefix(e, m[0])
+			}
+		}
+		errs[i] = e
+	}
+	return &yaml.TypeError{Errors: errs}
+}
+
+// Returns the struct types that can occur in the config, by their name in the yaml decoder's error messages.
+func knownStructTypes() map[string]reflect.Type {
+	types := make(map[string]reflect.Type)
+	var visit func(t reflect.Type)
+	visit = func(t reflect.Type) {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if variants, ok := enumTypes[t]; ok {
+			for _, v := range variants() {
+				visit(reflect.TypeOf(v))
+			}
+			return
+		}
+		if _, ok := scalarTypeSchemas[t]; ok || t.Kind() != reflect.Struct {
+			return
+		}
+		if _, ok := types[t.String()]; ok {
+			return
+		}
+		types[t.String()] = t
+		for _, f := range yamlFields(t) {
+			visit(f.Type)
+		}
+	}
+	visit(reflect.TypeOf(Config{}))
+	return types
+}
+
+// Returns the field of struct type t that is closest to the unknown field,
+// or "" if no field is close enough to be a likely typo.
+func suggestField(unknown string, t reflect.Type) (suggestion string) {
+	best := -1
+	for _, f := range yamlFields(t) {
+		d := editDistance(unknown, f.Key)
+		if d > 2 || d >= len(f.Key) {
+			continue
+		}
+		if best == -1 || d < best {
+			best, suggestion = d, f.Key
+		}
+	}
+	return suggestion
+}
+
+// Levenshtein distance
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if d := prev[j] + 1; d < cur[j] {
+				cur[j] = d
+			}
+			if d := cur[j-1] + 1; d < cur[j] {
+				cur[j] = d
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// Returns a function that maps a line of the expanded config to the job it belongs to.
+// Relies on the layout produced by yaml.Marshal, i.e., the top-level key `jobs:`
+// followed by list items at column 0.
+func expandedJobAtLine(doc []byte) func(line int) (string, bool) {
+	var parsed struct {
+		Jobs []struct {
+			Name string `yaml:"name"`
+		} `yaml:"jobs"`
+	}
+	_ = yaml.Unmarshal(doc, &parsed)
+
+	var jobStarts []int // line numbers of the first line of each job
+	inJobs := false
+	s := bufio.NewScanner(bytes.NewReader(doc))
+	for line := 1; s.Scan(); line++ {
+		l := s.Text()
+		switch {
+		case l == configKeyJobs+":":
+			inJobs = true
+		case strings.HasPrefix(l, "- ") && inJobs:
+			jobStarts = append(jobStarts, line)
+		case inJobs && l != "" && l[0] != ' ' && l[0] != '-':
+			inJobs = false
+			jobStarts = append(jobStarts, line) // end of the last job
+		}
+	}
+
+	return func(line int) (string, bool) {
+		job := -1
+		for i, start := range jobStarts {
+			if start > line {
+				break
+			}
+			job = i
+		}
+		if job < 0 || job >= len(parsed.Jobs) {
+			return "", false
+		}
+		return strconv.Quote(parsed.Jobs[job].Name), true
+	}
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnknownFieldSuggestion(t *testing.T) {
+	_, err := testConfig(t, `
+jobs:
+- name: foo
+  type: snap
+  filesystems: {"<": true}
+  snapshotting:
+    type: periodic
+    prefix: zrepl_
+    intervall: 10m
+  pruning:
+    keep:
+    - type: last_n
+      count: 1
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `line 9: field intervall not found in type config.SnapshottingPeriodic (did you mean "interval"?)`)
+
+	_, err = testConfig(t, `
+global:
+  zfs:
+    foobar: baz
+jobs: []
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field foobar not found in type config.GlobalZFS")
+	assert.NotContains(t, err.Error(), "did you mean")
+}
+
+func TestUnknownFieldInExpandedConfig(t *testing.T) {
+	_, err := testConfig(t, templatesTestJobTemplate+`
+jobs:
+- name: a
+  template: offsite
+  filesystems: {"pool/a<": true}
+- name: b
+  template: offsite
+  filesystemz: {"pool/b<": true}
+`)
+	require.Error(t, err)
+	assert.Regexp(t, `line \d+ of expanded config \(job "b"\): field filesystemz not found in type config.PushJob \(did you mean "filesystems"\?\)`, err.Error())
+}
+
+func TestEditDistance(t *testing.T) {
+	tcs := []struct {
+		a, b string
+		d    int
+	}{
+		{"", "", 0},
+		{"interval", "interval", 0},
+		{"intervall", "interval", 1},
+		{"prefx", "prefix", 1},
+		{"filesytems", "filesystems", 1},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+	}
+	for _, tc := range tcs {
+		assert.Equal(t, tc.d, editDistance(tc.a, tc.b), "%q %q", tc.a, tc.b)
+	}
+}
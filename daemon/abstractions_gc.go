@@ -0,0 +1,309 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// abstractionsGCJob periodically destroys the zrepl abstractions (step holds, last-received-holds
+// and replication cursor bookmarks) that belong to jobs that no longer exist in the config
+// or to filesystems that are no longer handled by their job.
+//
+// Abstractions of existing jobs and filesystems are never touched by the GC:
+// their staleness is handled by the jobs themselves.
+type abstractionsGCJob struct {
+	interval time.Duration
+	minAge   time.Duration
+	dryRun   bool
+	jobs     []gcJobInfo
+
+	// when each orphaned abstraction (by Abstraction.String()) was first found to be orphaned
+	orphanedSince map[string]time.Time
+
+	// endpoint.ListAbstractions, replaced in tests
+	listAbstractions func(context.Context, endpoint.ListZFSHoldsAndBookmarksQuery) ([]endpoint.Abstraction, []endpoint.ListAbstractionsError, error)
+
+	promDestroyed *prometheus.CounterVec
+}
+
+// the information about a configured job that the GC needs to decide whether an abstraction is orphaned
+type gcJobInfo struct {
+	jobID endpoint.JobID
+	// nil if the job is not a sender
+	senderFSF zfs.DatasetFilter
+	// nil if the job is not a receiver
+	receiverRoot *zfs.DatasetPath
+}
+
+func newAbstractionsGCJob(in *config.GlobalAbstractionsGC, jobs []job.Job) (*abstractionsGCJob, error) {
+	j := &abstractionsGCJob{
+		interval: in.Interval,
+		minAge:   in.MinAge,
+		dryRun:   in.DryRun,
+
+		orphanedSince: make(map[string]time.Time),
+
+		listAbstractions: endpoint.ListAbstractions,
+	}
+	for _, cj := range jobs {
+		jobID, err := endpoint.MakeJobID(cj.Name())
+		if err != nil {
+			return nil, errors.Wrapf(err, "job %q", cj.Name())
+		}
+		info := gcJobInfo{jobID: jobID}
+		if sc := cj.SenderConfig(); sc != nil {
+			info.senderFSF = sc.FSF
+		}
+		if root, ok := cj.OwnedDatasetSubtreeRoot(); ok {
+			info.receiverRoot = root
+		}
+		j.jobs = append(j.jobs, info)
+	}
+	return j, nil
+}
+
+func (j *abstractionsGCJob) Name() string { return jobNameAbstractionsGC }
+
+func (j *abstractionsGCJob) Status() *job.Status { return &job.Status{Type: job.TypeInternal} }
+
+func (j *abstractionsGCJob) OwnedDatasetSubtreeRoot() (p *zfs.DatasetPath, ok bool) {
+	return nil, false
+}
+
+func (j *abstractionsGCJob) SenderConfig() *endpoint.SenderConfig { return nil }
+
+func (j *abstractionsGCJob) RegisterMetrics(registerer prometheus.Registerer) {
+	j.promDestroyed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zrepl",
+		Subsystem: "abstractions_gc",
+		Name:      "destroyed",
+		Help:      "number of orphaned abstractions destroyed by the GC",
+	}, []string{"type", "outcome"})
+	registerer.MustRegister(j.promDestroyed)
+}
+
+func (j *abstractionsGCJob) Run(ctx context.Context) {
+	log := job.GetLogger(ctx)
+	log.WithField("interval", j.interval).
+		WithField("min_age", j.minAge).
+		WithField("dry_run", j.dryRun).
+		Info("starting abstractions GC")
+
+	t := time.NewTicker(j.interval)
+	defer t.Stop()
+	for {
+		if err := j.collect(ctx, time.Now()); err != nil {
+			log.WithError(err).Error("abstractions GC failed")
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (j *abstractionsGCJob) collect(ctx context.Context, now time.Time) error {
+	log := job.GetLogger(ctx)
+
+	// Scan all filesystems, not only those handled by the configured jobs:
+	// the abstractions of removed jobs and of filesystems that are no longer handled by their job
+	// are usually on filesystems that no job handles anymore.
+	q := endpoint.ListZFSHoldsAndBookmarksQuery{
+		FS:          endpoint.ListZFSHoldsAndBookmarksQueryFilesystemFilter{Filter: zfs.NoFilter()},
+		What:        endpoint.AbstractionTypesAll,
+		Concurrency: 1,
+	}
+	abs, listErrs, err := j.listAbstractions(ctx, q)
+	if err != nil {
+		return errors.Wrap(err, "list abstractions")
+	}
+	for _, e := range listErrs {
+		// the GC only considers abstractions that could be listed, so it is safe to continue
+		log.WithError(e).Warn("cannot list abstractions")
+	}
+
+	senderHandles, err := gcSenderHandles(ctx, abs, j.jobs)
+	if err != nil {
+		return err
+	}
+	orphaned, err := gcOrphanedAbstractions(abs, j.jobs, senderHandles)
+	if err != nil {
+		return err
+	}
+	orphaned = gcOrphanedForAtLeast(j.orphanedSince, orphaned, now, j.minAge)
+	if len(orphaned) == 0 {
+		log.Debug("no orphaned abstractions")
+		return nil
+	}
+
+	destroy := make([]endpoint.Abstraction, len(orphaned))
+	reasons := make(map[string]string, len(orphaned)) // by Abstraction.String()
+	for i, o := range orphaned {
+		destroy[i] = o.Abstraction
+		reasons[o.String()] = o.Reason
+	}
+
+	if j.dryRun {
+		for _, a := range destroy {
+			gcAuditLog(ctx, a, reasons[a.String()]).Info("dry run: would destroy orphaned abstraction")
+		}
+		return nil
+	}
+
+	var failed int
+	for res := range endpoint.BatchDestroy(ctx, destroy) {
+		l := gcAuditLog(ctx, res.Abstraction, reasons[res.Abstraction.String()])
+		outcome := "ok"
+		if res.DestroyErr != nil {
+			outcome = "error"
+			failed++
+			l.WithError(res.DestroyErr).Error("cannot destroy orphaned abstraction")
+		} else {
+			l.Info("destroyed orphaned abstraction")
+		}
+		if j.promDestroyed != nil {
+			j.promDestroyed.WithLabelValues(string(res.GetType()), outcome).Inc()
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("cannot destroy %d of %d orphaned abstractions", failed, len(destroy))
+	}
+	return nil
+}
+
+func gcAuditLog(ctx context.Context, a endpoint.Abstraction, reason string) job.Logger {
+	l := job.GetLogger(ctx).
+		WithField("type", a.GetType()).
+		WithField("fs", a.GetFS()).
+		WithField("name", a.GetName()).
+		WithField("reason", reason)
+	if jobID := a.GetJobID(); jobID != nil {
+		l = l.WithField("abstraction_job", jobID.String())
+	}
+	return l
+}
+
+type gcOrphanedAbstraction struct {
+	endpoint.Abstraction
+	Reason string
+}
+
+// gcSenderHandles evaluates the filesystem filter of each sending job for the filesystems of abs,
+// using a single zfs command per job for property-based filters.
+// The result is indexed by job and filesystem name.
+func gcSenderHandles(ctx context.Context, abs []endpoint.Abstraction, jobs []gcJobInfo) (map[endpoint.JobID]map[string]bool, error) {
+	var fss []*zfs.DatasetPath
+	seen := make(map[string]bool)
+	for _, a := range abs {
+		if seen[a.GetFS()] {
+			continue
+		}
+		seen[a.GetFS()] = true
+		fs, err := zfs.NewDatasetPath(a.GetFS())
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid filesystem name %q", a.GetFS())
+		}
+		fss = append(fss, fs)
+	}
+
+	handles := make(map[endpoint.JobID]map[string]bool, len(jobs))
+	for _, j := range jobs {
+		if j.senderFSF == nil || len(fss) == 0 {
+			continue
+		}
+		pass, err := zfs.FilterAll(ctx, j.senderFSF, fss)
+		if err != nil {
+			return nil, errors.Wrapf(err, "evaluate filesystem filter of job %q", j.jobID.String())
+		}
+		handles[j.jobID] = make(map[string]bool, len(fss))
+		for i, fs := range fss {
+			handles[j.jobID][fs.ToString()] = pass[i]
+		}
+	}
+	return handles, nil
+}
+
+// Returns the abstractions in abs that belong to a job that is not in jobs
+// or to a filesystem that is not handled by its job.
+// senderHandles is the result of gcSenderHandles for abs and jobs.
+// Abstractions without job ID (legacy replication cursors) are never considered orphaned.
+func gcOrphanedAbstractions(abs []endpoint.Abstraction, jobs []gcJobInfo, senderHandles map[endpoint.JobID]map[string]bool) ([]gcOrphanedAbstraction, error) {
+	byID := make(map[endpoint.JobID]gcJobInfo, len(jobs))
+	for _, j := range jobs {
+		byID[j.jobID] = j
+	}
+
+	var orphaned []gcOrphanedAbstraction
+	for _, a := range abs {
+		jobID := a.GetJobID()
+		if jobID == nil {
+			continue
+		}
+
+		j, ok := byID[*jobID]
+		if !ok {
+			orphaned = append(orphaned, gcOrphanedAbstraction{a, fmt.Sprintf("job %q does not exist", jobID.String())})
+			continue
+		}
+		if j.senderFSF == nil && j.receiverRoot == nil {
+			// the job does not create abstractions, so it's not our business to decide what they are
+			continue
+		}
+
+		fs, err := zfs.NewDatasetPath(a.GetFS())
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid filesystem name %q", a.GetFS())
+		}
+		handled := false
+		if j.senderFSF != nil {
+			handled = senderHandles[j.jobID][a.GetFS()]
+		}
+		if j.receiverRoot != nil {
+			handled = handled || fs.HasPrefix(j.receiverRoot)
+		}
+		if !handled {
+			orphaned = append(orphaned, gcOrphanedAbstraction{a, fmt.Sprintf("filesystem is not handled by job %q", jobID.String())})
+		}
+	}
+	return orphaned, nil
+}
+
+// gcOrphanedForAtLeast returns the abstractions in orphaned that have been found orphaned
+// for at least minAge, based on orphanedSince, which it updates with the current orphans:
+// abstractions are recorded when they are first found orphaned and forgotten once they are no longer orphaned.
+//
+// The age of an abstraction itself is not usable: holds and bookmarks are often created long after
+// their snapshot, and bookmarks inherit the creation time of their snapshot.
+// Since orphanedSince is only kept in memory, the GC does not destroy anything within minAge of a daemon restart.
+func gcOrphanedForAtLeast(orphanedSince map[string]time.Time, orphaned []gcOrphanedAbstraction, now time.Time, minAge time.Duration) []gcOrphanedAbstraction {
+	current := make(map[string]bool, len(orphaned))
+	var aged []gcOrphanedAbstraction
+	for _, o := range orphaned {
+		key := o.String()
+		current[key] = true
+		since, ok := orphanedSince[key]
+		if !ok {
+			since = now
+			orphanedSince[key] = since
+		}
+		if now.Sub(since) >= minAge {
+			aged = append(aged, o)
+		}
+	}
+	for key := range orphanedSince {
+		if !current[key] {
+			delete(orphanedSince, key)
+		}
+	}
+	return aged
+}
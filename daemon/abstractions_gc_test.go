@@ -0,0 +1,129 @@
+package daemon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestGCOrphanedAbstractions(t *testing.T) {
+	stepHold := func(fs, job string) endpoint.Abstraction {
+		tag, err := endpoint.StepHoldTag(endpoint.MustMakeJobID(job))
+		require.NoError(t, err)
+		v := zfs.FilesystemVersion{Type: zfs.Snapshot, Name: "snap", Guid: 1, CreateTXG: 1, Creation: time.Now()}
+		a := endpoint.StepHoldExtractor(mustDatasetPath(t, fs), v, tag)
+		require.NotNil(t, a)
+		return a
+	}
+
+	senderFSF := filters.NewDatasetMapFilter(1, true)
+	require.NoError(t, senderFSF.Add("pool/data<", "ok"))
+	jobs := []gcJobInfo{
+		{jobID: endpoint.MustMakeJobID("push"), senderFSF: senderFSF},
+		{jobID: endpoint.MustMakeJobID("sink"), receiverRoot: mustDatasetPath(t, "pool/backups")},
+		{jobID: endpoint.MustMakeJobID("snap")},
+	}
+
+	tcs := []struct {
+		name     string
+		a        endpoint.Abstraction
+		orphaned bool
+	}{
+		{"handled by sender", stepHold("pool/data/a", "push"), false},
+		{"no longer handled by sender", stepHold("pool/other", "push"), true},
+		{"handled by receiver", stepHold("pool/backups/client/a", "sink"), false},
+		{"outside receiver root", stepHold("pool/elsewhere", "sink"), true},
+		{"job removed", stepHold("pool/data/a", "removed"), true},
+		{"job without abstractions", stepHold("pool/data/a", "snap"), false},
+	}
+
+	abs := make([]endpoint.Abstraction, len(tcs))
+	for i := range tcs {
+		abs[i] = tcs[i].a
+	}
+	senderHandles, err := gcSenderHandles(context.Background(), abs, jobs)
+	require.NoError(t, err)
+	orphaned, err := gcOrphanedAbstractions(abs, jobs, senderHandles)
+	require.NoError(t, err)
+	isOrphaned := make(map[endpoint.Abstraction]bool)
+	for _, o := range orphaned {
+		assert.NotEmpty(t, o.Reason)
+		isOrphaned[o.Abstraction] = true
+	}
+	for _, tc := range tcs {
+		assert.Equal(t, tc.orphaned, isOrphaned[tc.a], tc.name)
+	}
+}
+
+func TestGCCollectScansFilesystemsNoJobHandles(t *testing.T) {
+	stepHold := func(fs, job string) endpoint.Abstraction {
+		tag, err := endpoint.StepHoldTag(endpoint.MustMakeJobID(job))
+		require.NoError(t, err)
+		v := zfs.FilesystemVersion{Type: zfs.Snapshot, Name: "snap", Guid: 1, CreateTXG: 1, Creation: time.Now()}
+		return endpoint.StepHoldExtractor(mustDatasetPath(t, fs), v, tag)
+	}
+	handled := stepHold("pool/data/a", "push")
+	noLongerHandled := stepHold("pool/other", "push")
+	jobRemoved := stepHold("otherpool/fs", "removed")
+
+	senderFSF := filters.NewDatasetMapFilter(1, true)
+	require.NoError(t, senderFSF.Add("pool/data<", "ok"))
+	j := &abstractionsGCJob{
+		minAge:        time.Hour,
+		dryRun:        true,
+		jobs:          []gcJobInfo{{jobID: endpoint.MustMakeJobID("push"), senderFSF: senderFSF}},
+		orphanedSince: make(map[string]time.Time),
+		listAbstractions: func(ctx context.Context, q endpoint.ListZFSHoldsAndBookmarksQuery) ([]endpoint.Abstraction, []endpoint.ListAbstractionsError, error) {
+			var abs []endpoint.Abstraction
+			for _, a := range []endpoint.Abstraction{handled, noLongerHandled, jobRemoved} {
+				pass, err := q.FS.Filter.Filter(mustDatasetPath(t, a.GetFS()))
+				require.NoError(t, err)
+				if pass {
+					abs = append(abs, a)
+				}
+			}
+			return abs, nil, nil
+		},
+	}
+
+	require.NoError(t, j.collect(context.Background(), time.Now()))
+	assert.Contains(t, j.orphanedSince, noLongerHandled.String())
+	assert.Contains(t, j.orphanedSince, jobRemoved.String())
+	assert.NotContains(t, j.orphanedSince, handled.String())
+}
+
+func TestGCOrphanedForAtLeast(t *testing.T) {
+	t0 := time.Date(2020, 1, 10, 0, 0, 0, 0, time.UTC)
+	minAge := 24 * time.Hour
+
+	// the creation time of the snapshot is irrelevant, only the time since the abstraction was first found orphaned counts
+	hold := func(job string) gcOrphanedAbstraction {
+		tag, err := endpoint.StepHoldTag(endpoint.MustMakeJobID(job))
+		require.NoError(t, err)
+		v := zfs.FilesystemVersion{Type: zfs.Snapshot, Name: "snap", Guid: 1, CreateTXG: 1, Creation: t0.Add(-365 * minAge)}
+		return gcOrphanedAbstraction{endpoint.StepHoldExtractor(mustDatasetPath(t, "pool/data"), v, tag), "test"}
+	}
+	a, b := hold("a"), hold("b")
+
+	since := make(map[string]time.Time)
+	assert.Empty(t, gcOrphanedForAtLeast(since, []gcOrphanedAbstraction{a}, t0, minAge))
+	assert.Empty(t, gcOrphanedForAtLeast(since, []gcOrphanedAbstraction{a, b}, t0.Add(minAge/2), minAge))
+	assert.Equal(t, []gcOrphanedAbstraction{a}, gcOrphanedForAtLeast(since, []gcOrphanedAbstraction{a, b}, t0.Add(minAge), minAge))
+
+	// b is no longer orphaned (e.g., its job was re-added), so its age starts over when it is orphaned again
+	assert.Equal(t, []gcOrphanedAbstraction{a}, gcOrphanedForAtLeast(since, []gcOrphanedAbstraction{a}, t0.Add(2*minAge), minAge))
+	assert.Equal(t, []gcOrphanedAbstraction{a}, gcOrphanedForAtLeast(since, []gcOrphanedAbstraction{a, b}, t0.Add(3*minAge), minAge))
+}
+
+func mustDatasetPath(t *testing.T, fs string) *zfs.DatasetPath {
+	p, err := zfs.NewDatasetPath(fs)
+	require.NoError(t, err)
+	return p
+}
@@ -8,11 +8,13 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/daemon/job"
 	"github.com/zrepl/zrepl/daemon/nethelpers"
 	"github.com/zrepl/zrepl/endpoint"
@@ -20,22 +22,44 @@ import (
 	"github.com/zrepl/zrepl/util/envconst"
 	"github.com/zrepl/zrepl/version"
 	"github.com/zrepl/zrepl/zfs"
-	"github.com/zrepl/zrepl/zfs/zfscmd"
 )
 
 type controlJob struct {
 	sockaddr *net.UnixAddr
-	jobs     *jobs
+	perms    nethelpers.SocketPermissions
+	// nil if disabled, serves only the read-only endpoints (status, version)
+	observerSockaddr *net.UnixAddr
+	observerPerms    nethelpers.SocketPermissions
+	jobs             *jobs
 }
 
-func newControlJob(sockpath string, jobs *jobs) (j *controlJob, err error) {
+func newControlJob(conf *config.GlobalControl, jobs *jobs) (j *controlJob, err error) {
 	j = &controlJob{jobs: jobs}
 
-	j.sockaddr, err = net.ResolveUnixAddr("unix", sockpath)
+	j.sockaddr, err = net.ResolveUnixAddr("unix", conf.SockPath)
 	if err != nil {
 		err = errors.Wrap(err, "cannot resolve unix address")
 		return
 	}
+	j.perms, err = nethelpers.SocketPermissionsFromConfig(conf.Mode, conf.Group)
+	if err != nil {
+		return nil, errors.Wrap(err, "control socket")
+	}
+
+	if conf.ObserverSockPath != "" {
+		if conf.ObserverSockPath == conf.SockPath {
+			return nil, errors.New("observer socket path must differ from control socket path")
+		}
+		j.observerSockaddr, err = net.ResolveUnixAddr("unix", conf.ObserverSockPath)
+		if err != nil {
+			err = errors.Wrap(err, "cannot resolve observer unix address")
+			return
+		}
+		j.observerPerms, err = nethelpers.SocketPermissionsFromConfig(conf.ObserverMode, conf.ObserverGroup)
+		if err != nil {
+			return nil, errors.Wrap(err, "observer socket")
+		}
+	}
 
 	return
 }
@@ -84,11 +108,20 @@ func (j *controlJob) Run(ctx context.Context) {
 	log := job.GetLogger(ctx)
 	defer log.Info("control job finished")
 
-	l, err := nethelpers.ListenUnixPrivate(j.sockaddr)
+	l, err := nethelpers.ListenUnixPrivateWithPermissions(j.sockaddr, j.perms)
 	if err != nil {
 		log.WithError(err).Error("error listening")
 		return
 	}
+	var observerL *net.UnixListener
+	if j.observerSockaddr != nil {
+		observerL, err = nethelpers.ListenUnixPrivateWithPermissions(j.observerSockaddr, j.observerPerms)
+		if err != nil {
+			log.WithError(err).Error("error listening on observer socket")
+			l.Close()
+			return
+		}
+	}
 
 	pprofServer := NewPProfServer(ctx)
 	if listen := envconst.String("ZREPL_DAEMON_AUTOSTART_PPROF_SERVER", ""); listen != "" {
@@ -110,51 +143,96 @@ func (j *controlJob) Run(ctx context.Context) {
 			return struct{}{}, nil
 		}}})
 
-	mux.Handle(ControlJobEndpointVersion,
-		requestLogger{log: log, handler: jsonResponder{log, func() (interface{}, error) {
-			return version.NewZreplVersionInformation(), nil
-		}}})
-
-	mux.Handle(ControlJobEndpointStatus,
-		// don't log requests to status endpoint, too spammy
-		jsonResponder{log, func() (interface{}, error) {
-			jobs := j.jobs.status()
-			globalZFS := zfscmd.GetReport()
-			envconstReport := envconst.GetReport()
-			s := Status{
-				Jobs: jobs,
-				Global: GlobalStatus{
-					ZFSCmds:  globalZFS,
-					Envconst: envconstReport,
-				}}
-			return s, nil
-		}})
+	j.handleReadOnly(mux, log)
 
 	mux.Handle(ControlJobEndpointSignal,
 		requestLogger{log: log, handler: jsonRequestResponder{log, func(decoder jsonDecoder) (interface{}, error) {
 			type reqT struct {
-				Name string
-				Op   string
+				Name  string
+				Op    string
+				Token string // only for Op == "confirm"
 			}
 			var req reqT
 			if decoder(&req) != nil {
 				return nil, errors.Errorf("decode failed")
 			}
+			return struct{}{}, j.jobs.signal(log, req.Name, req.Op, req.Token)
+		}}})
+	// if serving on one socket fails, stop serving on the other
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	if observerL != nil {
+		observerMux := http.NewServeMux()
+		j.handleReadOnly(observerMux, log)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			serveControl(ctx, log.WithField("socket", "observer"), observerL, observerMux)
+		}()
+	}
+	serveControl(ctx, log, l, mux)
+	cancel()
+	wg.Wait()
+}
 
-			var err error
-			switch req.Op {
-			case "wakeup":
-				err = j.jobs.wakeup(req.Name)
-			case "reset":
-				err = j.jobs.reset(req.Name)
-			default:
-				err = fmt.Errorf("operation %q is invalid", req.Op)
+// signal performs operation op of the control socket's signal endpoint on job name.
+// token is the confirmation token of op "confirm", see confirmDestroy.
+func (s *jobs) signal(log Logger, name, op, token string) (err error) {
+	switch op {
+	case "wakeup":
+		err = s.wakeup(name)
+	case "reset":
+		err = s.reset(name)
+	case "pause":
+		if err = s.pause(name); err == nil {
+			log.WithField("job", name).Info("paused replication streams")
+		}
+	case "resume":
+		if err = s.resume(name); err == nil {
+			log.WithField("job", name).Info("resumed replication streams")
+		}
+	case "override":
+		if err = s.overrideGuardrails(name); err == nil {
+			log.WithField("job", name).Info("armed one-shot guardrails override")
+		}
+	case "confirm":
+		if token != "" {
+			var side string
+			if side, err = s.confirmDestroy(name, token); err == nil {
+				log.WithField("job", name).WithField("prune_side", side).Info("confirmed pruning pass")
 			}
+			break
+		}
+		var confirmed []string
+		if confirmed, err = s.confirmNewFilesystems(name); err == nil {
+			log.WithField("job", name).WithField("filesystems", confirmed).Info("confirmed initial replication of new filesystems")
+		}
+	default:
+		err = fmt.Errorf("operation %q is invalid", op)
+	}
+	return err
+}
 
-			return struct{}{}, err
+// handleReadOnly registers the endpoints that do not change the daemon's state,
+// i.e., the endpoints of the observer socket.
+func (j *controlJob) handleReadOnly(mux *http.ServeMux, log Logger) {
+	mux.Handle(ControlJobEndpointVersion,
+		requestLogger{log: log, handler: jsonResponder{log, func() (interface{}, error) {
+			return version.NewZreplVersionInformation(), nil
 		}}})
+
+	mux.Handle(ControlJobEndpointStatus,
+		// don't log requests to status endpoint, too spammy
+		jsonResponder{log, func() (interface{}, error) {
+			return j.jobs.daemonStatus(), nil
+		}})
+}
+
+func serveControl(ctx context.Context, log Logger, l net.Listener, handler http.Handler) {
 	server := http.Server{
-		Handler: mux,
+		Handler: handler,
 		// control socket is local, 1s timeout should be more than sufficient, even on a loaded system
 		WriteTimeout: 1 * time.Second,
 		ReadTimeout:  1 * time.Second,
@@ -177,7 +255,7 @@ outer:
 				log.WithError(err).Error("cannot shutdown server")
 			}
 			break outer
-		case err = <-served:
+		case err := <-served:
 			if err != nil {
 				log.WithError(err).Error("error serving")
 				break outer
@@ -0,0 +1,40 @@
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/logger"
+)
+
+func TestObserverSocketIsReadOnly(t *testing.T) {
+	j, err := newControlJob(&config.GlobalControl{SockPath: "/tmp/zrepl-test/control", ObserverSockPath: "/tmp/zrepl-test-observer/control"}, newJobs())
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	j.handleReadOnly(mux, logger.NewNullLogger())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+ControlJobEndpointStatus, "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	for _, ep := range []string{ControlJobEndpointSignal, ControlJobEndpointPProf} {
+		resp, err := http.Post(srv.URL+ep, "application/json", strings.NewReader(`{"Name":"foo","Op":"reset"}`))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, ep)
+	}
+
+	_, err = newControlJob(&config.GlobalControl{SockPath: "/tmp/zrepl-test/control", ObserverSockPath: "/tmp/zrepl-test/control"}, newJobs())
+	assert.Error(t, err)
+	_, err = newControlJob(&config.GlobalControl{SockPath: "/tmp/zrepl-test/control", Mode: "0888"}, newJobs())
+	assert.Error(t, err)
+}
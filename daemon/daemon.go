@@ -18,11 +18,18 @@ import (
 	"github.com/zrepl/zrepl/util/envconst"
 
 	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/history"
 	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/daemon/job/activity"
+	"github.com/zrepl/zrepl/daemon/job/blackout"
+	"github.com/zrepl/zrepl/daemon/job/guardrails"
+	"github.com/zrepl/zrepl/daemon/job/pause"
 	"github.com/zrepl/zrepl/daemon/job/reset"
 	"github.com/zrepl/zrepl/daemon/job/wakeup"
 	"github.com/zrepl/zrepl/daemon/logging"
 	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/tlsconf"
+	"github.com/zrepl/zrepl/util/sdnotify"
 	"github.com/zrepl/zrepl/version"
 	"github.com/zrepl/zrepl/zfs/zfscmd"
 )
@@ -49,6 +56,16 @@ func Run(ctx context.Context, conf *config.Config) error {
 		return errors.Wrap(err, "cannot build jobs from config")
 	}
 
+	jobLoggers, err := jobLoggersFromConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	jobLabels, err := job.LabelsFromConfig(conf.Jobs)
+	if err != nil {
+		return err
+	}
+
 	log := logger.NewLogger(outlets, 1*time.Second)
 	log.Info(version.NewZreplVersionInformation().String())
 
@@ -72,9 +89,9 @@ func Run(ctx context.Context, conf *config.Config) error {
 	jobs := newJobs()
 
 	// start control socket
-	controlJob, err := newControlJob(conf.Global.Control.SockPath, jobs)
+	controlJob, err := newControlJob(conf.Global.Control, jobs)
 	if err != nil {
-		panic(err) // FIXME
+		return errors.Wrap(err, "cannot build control socket from config")
 	}
 	jobs.start(ctx, controlJob, true)
 
@@ -85,7 +102,9 @@ func Run(ctx context.Context, conf *config.Config) error {
 		)
 		switch v := jc.Ret.(type) {
 		case *config.PrometheusMonitoring:
-			job, err = newPrometheusJobFromConfig(v)
+			job, err = newPrometheusJobFromConfig(v, jobs, conf.Global.History.Path)
+		case *config.OTLPMonitoring:
+			job, err = newOTLPJobFromConfig(v)
 		default:
 			return errors.Errorf("unknown monitoring job #%d (type %T)", i, v)
 		}
@@ -95,47 +114,155 @@ func Run(ctx context.Context, conf *config.Config) error {
 		jobs.start(ctx, job, true)
 	}
 
+	if conf.Global.AbstractionsGC.Interval > 0 {
+		gcJob, err := newAbstractionsGCJob(conf.Global.AbstractionsGC, confJobs)
+		if err != nil {
+			return errors.Wrap(err, "cannot build abstractions GC job")
+		}
+		jobs.start(ctx, gcJob, true)
+	}
+
 	// register global (=non job-local) metrics
 	version.PrometheusRegister(prometheus.DefaultRegisterer)
 	zfscmd.RegisterMetrics(prometheus.DefaultRegisterer)
 	trace.RegisterMetrics(prometheus.DefaultRegisterer)
 	endpoint.RegisterMetrics(prometheus.DefaultRegisterer)
+	registerJobLabelsMetric(prometheus.DefaultRegisterer, jobLabels)
+
+	var historyDB *history.DB
+	if conf.Global.History.Path != "" {
+		historyDB, err = history.Open(conf.Global.History.Path)
+		if err != nil {
+			return errors.Wrap(err, "cannot open replication history")
+		}
+		defer historyDB.Close()
+	}
 
 	log.Info("starting daemon")
 
+	go reloadCertificatesOnSIGHUP(ctx, log)
+
 	// start regular jobs
+	after := make(map[string]config.JobNameList, len(conf.Jobs))
+	blackouts := make(map[string]*blackout.Schedule, len(conf.Jobs))
+	for _, jc := range conf.Jobs {
+		after[jc.Name()] = jc.After()
+		blackouts[jc.Name()] = blackout.FromConfig(jc.Blackout())
+	}
 	for _, j := range confJobs {
-		jobs.start(ctx, j, false)
+		jctx := ctx
+		if loggers, ok := jobLoggers[j.Name()]; ok {
+			jctx = logging.WithLoggers(ctx, loggers)
+		}
+		jctx = activity.WithDependencies(jctx, jobs.dependencies(after[j.Name()]))
+		jctx = blackout.Context(jctx, blackouts[j.Name()])
+		jctx = withJobLabels(jctx, jobLabels.ByJob[j.Name()])
+		if historyDB != nil {
+			jctx = history.Context(jctx, historyDB)
+		}
+		jobs.start(jctx, j, false)
 	}
 
+	notifySystemd(log, sdnotify.Ready)
+	// the status of all jobs is a proxy for their health: it requires their locks
+	go systemdWatchdog(ctx, log, func() { jobs.status() })
+
 	select {
 	case <-jobs.wait():
 		log.Info("all jobs finished")
 	case <-ctx.Done():
 		log.WithError(ctx.Err()).Info("context finished")
 	}
+	notifySystemd(log, sdnotify.Stopping)
 	log.Info("waiting for jobs to finish")
 	<-jobs.wait()
 	log.Info("daemon exiting")
 	return nil
 }
 
+// Reloads the TLS certificates used by the jobs' transports whenever the daemon receives SIGHUP.
+// Connections that are already established are not affected.
+func reloadCertificatesOnSIGHUP(ctx context.Context, log logger.Logger) {
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	defer signal.Stop(hupChan)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hupChan:
+		}
+		reloaded, err := tlsconf.ReloadAll()
+		if err != nil {
+			log.WithError(err).WithField("reloaded", reloaded).Error("cannot reload all TLS certificates, continuing to use the previous ones")
+			continue
+		}
+		log.WithField("reloaded", reloaded).Info("reloaded TLS certificates")
+	}
+}
+
+// Builds the loggers of the jobs that override the global logging outlets, by job name.
+func jobLoggersFromConfig(conf *config.Config) (map[string]logging.SubsystemLoggers, error) {
+	loggers := make(map[string]logging.SubsystemLoggers)
+	for _, jc := range conf.Jobs {
+		if jc.Logging() == nil {
+			continue
+		}
+		outlets, err := logging.OutletsFromConfig(*jc.Logging())
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot build logging of job %q", jc.Name())
+		}
+		outlets.Add(newPrometheusLogOutlet(), logger.Debug)
+		loggers[jc.Name()] = logging.SubsystemLoggersWithUniversalLogger(logger.NewLogger(outlets, 1*time.Second))
+	}
+	return loggers, nil
+}
+
 type jobs struct {
 	wg sync.WaitGroup
 
 	// m protects all fields below it
-	m       sync.RWMutex
-	wakeups map[string]wakeup.Func // by Job.Name
-	resets  map[string]reset.Func  // by Job.Name
-	jobs    map[string]job.Job
+	m          sync.RWMutex
+	wakeups    map[string]wakeup.Func          // by Job.Name
+	resets     map[string]reset.Func           // by Job.Name
+	activities map[string]*activity.Tracker    // by Job.Name
+	pauses     map[string]*pause.Gate          // by Job.Name
+	overrides  map[string]*guardrails.Override // by Job.Name
+	blackouts  map[string]*blackout.Schedule   // by Job.Name
+	jobs       map[string]job.Job
 }
 
 func newJobs() *jobs {
 	return &jobs{
-		wakeups: make(map[string]wakeup.Func),
-		resets:  make(map[string]reset.Func),
-		jobs:    make(map[string]job.Job),
+		wakeups:    make(map[string]wakeup.Func),
+		resets:     make(map[string]reset.Func),
+		activities: make(map[string]*activity.Tracker),
+		pauses:     make(map[string]*pause.Gate),
+		overrides:  make(map[string]*guardrails.Override),
+		blackouts:  make(map[string]*blackout.Schedule),
+		jobs:       make(map[string]job.Job),
+	}
+}
+
+// caller must hold s.m
+func (s *jobs) activityLocked(job string) *activity.Tracker {
+	t, ok := s.activities[job]
+	if !ok {
+		t = activity.NewTracker()
+		s.activities[job] = t
+	}
+	return t
+}
+
+// dependencies returns the activity.Dependency for each job in names, which need not be started yet.
+func (s *jobs) dependencies(names []string) []activity.Dependency {
+	s.m.Lock()
+	defer s.m.Unlock()
+	deps := make([]activity.Dependency, len(names))
+	for i, name := range names {
+		deps[i] = activity.Dependency{Name: name, Tracker: s.activityLocked(name)}
 	}
+	return deps
 }
 
 func (s *jobs) wait() <-chan struct{} {
@@ -155,6 +282,20 @@ type Status struct {
 type GlobalStatus struct {
 	ZFSCmds  *zfscmd.Report
 	Envconst *envconst.Report
+	Runtime  *RuntimeStatus // nil if the daemon is too old to report it
+}
+
+// daemonStatus returns the status served by the control socket's status endpoint.
+func (s *jobs) daemonStatus() Status {
+	globalZFS := zfscmd.GetReport()
+	return Status{
+		Jobs: s.status(),
+		Global: GlobalStatus{
+			ZFSCmds:  globalZFS,
+			Envconst: envconst.GetReport(),
+			Runtime:  getRuntimeStatus(globalZFS),
+		},
+	}
 }
 
 func (s *jobs) status() map[string]*job.Status {
@@ -169,10 +310,16 @@ func (s *jobs) status() map[string]*job.Status {
 	c := make(chan res, len(s.jobs))
 	for name, j := range s.jobs {
 		wg.Add(1)
-		go func(name string, j job.Job) {
+		go func(name string, j job.Job, t *activity.Tracker, g *pause.Gate, b *blackout.Schedule) {
 			defer wg.Done()
-			c <- res{name: name, status: j.Status()}
-		}(name, j)
+			st := j.Status()
+			st.WaitingForJobs = t.WaitingFor()
+			st.Paused = g.Paused()
+			if active, until := b.Active(time.Now()); active {
+				st.BlackoutUntil = &until
+			}
+			c <- res{name: name, status: st}
+		}(name, j, s.activities[name], s.pauses[name], s.blackouts[name])
 	}
 	wg.Wait()
 	close(c)
@@ -205,9 +352,95 @@ func (s *jobs) reset(job string) error {
 	return wu()
 }
 
+func (s *jobs) pause(job string) error {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	g, ok := s.pauses[job]
+	if !ok {
+		return errors.Errorf("Job %s does not exist", job)
+	}
+	return g.Pause()
+}
+
+func (s *jobs) resume(job string) error {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	g, ok := s.pauses[job]
+	if !ok {
+		return errors.Errorf("Job %s does not exist", job)
+	}
+	return g.Resume()
+}
+
+// overrideGuardrails arms the one-shot guardrails override of job and wakes it up.
+func (s *jobs) overrideGuardrails(job string) error {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	o, ok := s.overrides[job]
+	if !ok {
+		return errors.Errorf("Job %s does not exist", job)
+	}
+	o.Arm()
+	if err := s.wakeups[job](); err != nil {
+		return errors.Wrap(err, "override armed, but cannot wake up job")
+	}
+	return nil
+}
+
+func (s *jobs) confirmNewFilesystems(job string) ([]string, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	j, ok := s.jobs[job]
+	if !ok {
+		return nil, errors.Errorf("Job %s does not exist", job)
+	}
+	c, ok := j.(interface{ ConfirmNewFilesystems() ([]string, error) })
+	if !ok {
+		return nil, errors.Errorf("Job %s does not replicate", job)
+	}
+	confirmed, err := c.ConfirmNewFilesystems()
+	if err != nil {
+		return nil, err
+	}
+	if len(confirmed) > 0 {
+		if err := s.wakeups[job](); err != nil {
+			return confirmed, errors.Wrap(err, "confirmed, but cannot wake up job")
+		}
+	}
+	return confirmed, nil
+}
+
+func (s *jobs) confirmDestroy(job, token string) (side string, _ error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	j, ok := s.jobs[job]
+	if !ok {
+		return "", errors.Errorf("Job %s does not exist", job)
+	}
+	c, ok := j.(interface{ ConfirmDestroy(string) (string, error) })
+	if !ok {
+		return "", errors.Errorf("Job %s does not prune", job)
+	}
+	side, err := c.ConfirmDestroy(token)
+	if err != nil {
+		return "", err
+	}
+	if err := s.wakeups[job](); err != nil {
+		return side, errors.Wrap(err, "confirmed, but cannot wake up job")
+	}
+	return side, nil
+}
+
 const (
-	jobNamePrometheus = "_prometheus"
-	jobNameControl    = "_control"
+	jobNamePrometheus     = "_prometheus"
+	jobNameOTLP           = "_otlp"
+	jobNameAbstractionsGC = "_abstractions_gc"
+	jobNameControl        = "_control"
 )
 
 func IsInternalJobName(s string) bool {
@@ -219,6 +452,7 @@ func (s *jobs) start(ctx context.Context, j job.Job, internal bool) {
 	defer s.m.Unlock()
 
 	ctx = logging.WithInjectedField(ctx, logging.JobField, j.Name())
+	ctx = injectJobLabelFields(ctx)
 
 	jobName := j.Name()
 	if !internal && IsInternalJobName(jobName) {
@@ -231,14 +465,28 @@ func (s *jobs) start(ctx context.Context, j job.Job, internal bool) {
 		panic(fmt.Sprintf("duplicate job name %s", jobName))
 	}
 
-	j.RegisterMetrics(prometheus.DefaultRegisterer)
+	j.RegisterMetrics(jobLabelsRegisterer(ctx, prometheus.DefaultRegisterer))
 
 	s.jobs[jobName] = j
 	ctx = zfscmd.WithJobID(ctx, j.Name())
 	ctx, wakeup := wakeup.Context(ctx)
 	ctx, resetFunc := reset.Context(ctx)
+	ctx = activity.Context(ctx, s.activityLocked(jobName))
+	pauseGate := pause.NewGate()
+	ctx = pause.Context(ctx, pauseGate)
 	s.wakeups[jobName] = wakeup
 	s.resets[jobName] = resetFunc
+	s.pauses[jobName] = pauseGate
+	override := guardrails.NewOverride()
+	ctx = guardrails.Context(ctx, override)
+	s.overrides[jobName] = override
+	s.blackouts[jobName] = blackout.FromContext(ctx)
+	if blackout.FromContext(ctx).PauseStreams() {
+		// separate from pauseGate so that manual pausing and blackout windows do not interfere
+		blackoutGate := pause.NewGate()
+		ctx = pause.Context(ctx, blackoutGate)
+		go blackout.PauseStreams(ctx, blackoutGate)
+	}
 
 	s.wg.Add(1)
 	go func() {
@@ -2,6 +2,8 @@ package filters
 
 import (
 	"fmt"
+	"path"
+	"regexp"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -19,13 +21,27 @@ type DatasetMapFilter struct {
 }
 
 type datasetMapFilterEntry struct {
+	// the pattern as passed to Add()
+	pattern string
+	// exactly one of path, glob and regex is set
 	path *zfs.DatasetPath
+	// path components that may contain glob meta characters (see path.Match)
+	glob []string
+	// always matches the entire path, never a subtree match
+	regex *regexp.Regexp
 	// the mapping. since this datastructure acts as both mapping and filter
 	// we have to convert it to the desired rep dynamically
 	mapping      string
 	subtreeMatch bool
 }
 
+const (
+	// prefix of patterns that are regular expressions
+	RegexPatternPrefix = "~"
+	// characters that make a pattern a glob pattern
+	globMetaChars = "*?["
+)
+
 func NewDatasetMapFilter(capacity int, filterMode bool) *DatasetMapFilter {
 	return &DatasetMapFilter{
 		entries:    make([]datasetMapFilterEntry, 0, capacity),
@@ -41,52 +57,156 @@ func (m *DatasetMapFilter) Add(pathPattern, mapping string) (err error) {
 		}
 	}
 
+	entry := datasetMapFilterEntry{
+		pattern: pathPattern,
+		mapping: mapping,
+	}
+
+	if strings.HasPrefix(pathPattern, RegexPatternPrefix) {
+		if !m.filterMode {
+			return fmt.Errorf("regex patterns are only supported for filters")
+		}
+		entry.regex, err = regexp.Compile("^(?:" + strings.TrimPrefix(pathPattern, RegexPatternPrefix) + ")$")
+		if err != nil {
+			return fmt.Errorf("pattern is not a valid regular expression: %s", err)
+		}
+		return m.addEntry(entry)
+	}
+
 	// assert path glob adheres to spec
 	const SUBTREE_PATTERN string = "<"
 	patternCount := strings.Count(pathPattern, SUBTREE_PATTERN)
 	switch {
 	case patternCount > 1:
+		err = fmt.Errorf("pattern invalid: only one '<' at end of string allowed")
+		return
 	case patternCount == 1 && !strings.HasSuffix(pathPattern, SUBTREE_PATTERN):
 		err = fmt.Errorf("pattern invalid: only one '<' at end of string allowed")
 		return
 	}
+	entry.subtreeMatch = patternCount > 0
 
 	pathStr := strings.TrimSuffix(pathPattern, SUBTREE_PATTERN)
-	path, err := zfs.NewDatasetPath(pathStr)
+	if strings.ContainsAny(pathStr, globMetaChars) {
+		if !m.filterMode {
+			return fmt.Errorf("glob patterns are only supported for filters")
+		}
+		entry.glob = strings.Split(pathStr, "/")
+		for _, c := range entry.glob {
+			if c == "" {
+				return fmt.Errorf("glob pattern must not contain empty path components")
+			}
+			if _, err := path.Match(c, ""); err != nil {
+				return fmt.Errorf("pattern is not a valid glob pattern: %s", err)
+			}
+		}
+		return m.addEntry(entry)
+	}
+
+	entry.path, err = zfs.NewDatasetPath(pathStr)
 	if err != nil {
 		return fmt.Errorf("pattern is not a dataset path: %s", err)
 	}
+	return m.addEntry(entry)
+}
 
-	entry := datasetMapFilterEntry{
-		path:         path,
-		mapping:      mapping,
-		subtreeMatch: patternCount > 0,
+func (m *DatasetMapFilter) addEntry(entry datasetMapFilterEntry) error {
+	// duplicates would make the result depend on the order of Add() calls
+	for _, e := range m.entries {
+		if e.pattern == entry.pattern {
+			return fmt.Errorf("duplicate pattern %q", entry.pattern)
+		}
 	}
 	m.entries = append(m.entries, entry)
-	return
+	return nil
+}
+
+// Lower rank wins over higher rank if two entries match equally specific
+func (e *datasetMapFilterEntry) rank() int {
+	switch {
+	case e.path != nil:
+		return 0
+	case e.glob != nil:
+		return 1
+	default:
+		return 2
+	}
+}
 
+// Returns whether e matches p and the length of the matched prefix.
+// Non-subtree matches always match the entire p.
+func (e *datasetMapFilterEntry) match(p *zfs.DatasetPath) (matches bool, length int) {
+	switch {
+	case e.path != nil:
+		if e.subtreeMatch {
+			return p.HasPrefix(e.path), e.path.Length()
+		}
+		return e.path.Equal(p), p.Length()
+	case e.glob != nil:
+		if len(e.glob) > p.Length() || (!e.subtreeMatch && len(e.glob) != p.Length()) {
+			return false, 0
+		}
+		comps := strings.Split(p.ToString(), "/")
+		for i := range e.glob {
+			if ok, _ := path.Match(e.glob[i], comps[i]); !ok { // pattern validated in Add()
+				return false, 0
+			}
+		}
+		return true, len(e.glob)
+	default:
+		return e.regex.MatchString(p.ToString()), p.Length()
+	}
 }
 
 // find the most specific prefix mapping we have
 //
-// longer prefix wins over shorter prefix, direct wins over glob
-func (m DatasetMapFilter) mostSpecificPrefixMapping(path *zfs.DatasetPath) (idx int, found bool) {
+// longer prefix wins over shorter prefix, direct wins over subtree wildcard.
+// For equally specific matches, plain paths win over glob patterns, which win over regexes.
+// Equally specific glob or regex matches with different mappings are an error.
+func (m DatasetMapFilter) mostSpecificPrefixMapping(path *zfs.DatasetPath) (idx int, found bool, err error) {
 	lcp, lcp_entry_idx := -1, -1
 	direct_idx := -1
+	// returns true if candidate c should replace the current best match cur
+	better := func(cur, c int) (bool, error) {
+		if cur < 0 {
+			return true, nil
+		}
+		cr, ccr := m.entries[cur].rank(), m.entries[c].rank()
+		if cr != ccr {
+			return ccr < cr, nil
+		}
+		if m.entries[cur].mapping != m.entries[c].mapping {
+			return false, fmt.Errorf("patterns %q and %q both match %q with different results",
+				m.entries[cur].pattern, m.entries[c].pattern, path.ToString())
+		}
+		return false, nil
+	}
 	for e := range m.entries {
-		entry := m.entries[e]
-		ep := m.entries[e].path
-		lep := ep.Length()
-
-		switch {
-		case !entry.subtreeMatch && ep.Equal(path):
-			direct_idx = e
+		entry := &m.entries[e]
+		matches, l := entry.match(path)
+		if !matches {
 			continue
-		case entry.subtreeMatch && path.HasPrefix(ep) && lep > lcp:
-			lcp = lep
+		}
+		switch {
+		case !entry.subtreeMatch:
+			b, err := better(direct_idx, e)
+			if err != nil {
+				return -1, false, err
+			}
+			if b {
+				direct_idx = e
+			}
+		case l > lcp:
+			lcp = l
 			lcp_entry_idx = e
-		default:
-			continue
+		case l == lcp:
+			b, err := better(lcp_entry_idx, e)
+			if err != nil {
+				return -1, false, err
+			}
+			if b {
+				lcp_entry_idx = e
+			}
 		}
 	}
 
@@ -110,7 +230,10 @@ func (m DatasetMapFilter) Map(source *zfs.DatasetPath) (target *zfs.DatasetPath,
 		return
 	}
 
-	mi, hasMapping := m.mostSpecificPrefixMapping(source)
+	mi, hasMapping, err := m.mostSpecificPrefixMapping(source)
+	if err != nil {
+		return nil, err
+	}
 	if !hasMapping {
 		return nil, nil
 	}
@@ -150,7 +273,10 @@ func (m DatasetMapFilter) Filter(p *zfs.DatasetPath) (pass bool, err error) {
 		return
 	}
 
-	mi, hasMapping := m.mostSpecificPrefixMapping(p)
+	mi, hasMapping, err := m.mostSpecificPrefixMapping(p)
+	if err != nil {
+		return false, err
+	}
 	if !hasMapping {
 		pass = false
 		return
@@ -54,6 +54,128 @@ func TestDatasetMapFilter(t *testing.T) {
 				"tank/home/bob/downloads": false,
 			},
 		},
+		{
+			"exclude_subtree",
+			map[string]string{
+				"tank/vm<":         "ok",
+				"tank/vm/scratch<": "!",
+			},
+			map[string]bool{
+				"tank":                false,
+				"tank/vm":             true,
+				"tank/vm/a":           true,
+				"tank/vm/scratch":     false,
+				"tank/vm/scratch/a":   false,
+				"tank/vm/scratchpad":  true, // prefix matching is per path component
+				"tank/vm/a/scratch":   true,
+				"tank/vm/a/scratch/b": true,
+				"tank/vmware":         false,
+				"tank/vmware/scratch": false,
+				"tank/vm/scratch/a/b": false,
+			},
+		},
+		{
+			"nested_exclusion_and_reinclusion",
+			map[string]string{
+				"tank<":           "ok",
+				"tank/a<":         "!",
+				"tank/a/b<":       "ok",
+				"tank/a/b/c<":     "!",
+				"tank/a/b/c/keep": "ok",
+			},
+			map[string]bool{
+				"tank":              true,
+				"tank/x":            true,
+				"tank/a":            false,
+				"tank/a/x":          false,
+				"tank/a/b":          true,
+				"tank/a/b/x":        true,
+				"tank/a/b/c":        false,
+				"tank/a/b/c/x":      false,
+				"tank/a/b/c/keep":   true,
+				"tank/a/b/c/keep/x": false,
+			},
+		},
+		{
+			"exclude_subtree_root_only",
+			map[string]string{
+				"tank<": "ok",
+				"tank":  "!",
+			},
+			map[string]bool{
+				"tank":   false,
+				"tank/a": true,
+			},
+		},
+		{
+			"subtree_wildcard_matches_all",
+			map[string]string{
+				"<":        "ok",
+				"tank<":    "!",
+				"zroot":    "!",
+				"zroot/a<": "ok",
+			},
+			map[string]bool{
+				"zroot":   false,
+				"zroot/a": true,
+				"zroot/b": true,
+				"tank":    false,
+				"tank/a":  false,
+				"pool":    true,
+			},
+		},
+		{
+			"glob_in_the_middle_of_the_hierarchy",
+			map[string]string{
+				"tank/jails/*/data":  "ok",
+				"tank/jails/*/logs<": "ok",
+				"tank/jails/b*/logs": "!",
+				"tank/jails/c/logs<": "!",
+			},
+			map[string]bool{
+				"tank/jails":            false,
+				"tank/jails/a":          false,
+				"tank/jails/a/data":     true,
+				"tank/jails/a/data/x":   false,
+				"tank/jails/a/logs":     true,
+				"tank/jails/a/logs/x":   true,
+				"tank/jails/bar/logs":   false, // direct glob wins over subtree glob
+				"tank/jails/bar/logs/x": true,
+				"tank/jails/c/logs":     false, // plain path wins over glob of same length
+				"tank/jails/c/logs/x":   false,
+				"tank/jails/a/b/data":   false,
+			},
+		},
+		{
+			"glob_character_classes",
+			map[string]string{
+				"tank/vm-[0-9]?<": "ok",
+			},
+			map[string]bool{
+				"tank/vm-1a":   true,
+				"tank/vm-1a/x": true,
+				"tank/vm-a1":   false,
+				"tank/vm-1":    false,
+			},
+		},
+		{
+			"regex",
+			map[string]string{
+				"tank<":                        "ok",
+				"tank/home<":                   "!",
+				"~tank/home/[^/]+/(docs|mail)": "ok",
+			},
+			map[string]bool{
+				"tank/home":            false,
+				"tank/home/bob":        false,
+				"tank/home/bob/docs":   true,
+				"tank/home/bob/mail":   true,
+				"tank/home/bob/mail/x": false,
+				"tank/home/bob/docsx":  false, // regexes match the entire path
+				"tank/homes/bob/docs":  true,
+				"tank/home/docs":       false,
+			},
+		},
 	}
 
 	for tc := range tcs {
@@ -87,3 +209,55 @@ func TestDatasetMapFilter(t *testing.T) {
 	}
 
 }
+
+func TestDatasetMapFilterAddRejectsInvalidPatterns(t *testing.T) {
+	f := NewDatasetMapFilter(3, true)
+	if err := f.Add("tank<<", "ok"); err == nil {
+		t.Errorf("expected error for multiple subtree wildcards")
+	}
+	if err := f.Add("tank/vm<", "ok"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := f.Add("tank/vm<", "!"); err == nil {
+		t.Errorf("expected error for duplicate pattern")
+	}
+	if err := f.Add("tank/vm", "!"); err != nil {
+		t.Errorf("direct pattern on same path as subtree pattern must be allowed: %s", err)
+	}
+}
+
+func TestDatasetMapFilterWildcardsAmbiguous(t *testing.T) {
+	f := NewDatasetMapFilter(2, true)
+	if err := f.Add("tank/*/data", "ok"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Add("~tank/a/.*", "!"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Add("tank/a/*", "!"); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := zfs.NewDatasetPath("tank/a/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Filter(p); err == nil {
+		t.Errorf("expected error for equally specific glob patterns with different results")
+	}
+}
+
+func TestDatasetMapFilterWildcardsRejected(t *testing.T) {
+	f := NewDatasetMapFilter(1, true)
+	for _, p := range []string{"tank/[", "~tank/(", "tank//*"} {
+		if err := f.Add(p, "ok"); err == nil {
+			t.Errorf("expected error for pattern %q", p)
+		}
+	}
+	m := NewDatasetMapFilter(1, false)
+	for _, p := range []string{"tank/*", "~tank"} {
+		if err := m.Add(p, "pool/x"); err == nil {
+			t.Errorf("expected error for wildcard pattern %q in mapping mode", p)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package filters
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// PropertyFilter passes the datasets that pass the wrapped filter
+// and whose effective (i.e., possibly inherited) value of a ZFS property matches.
+type PropertyFilter struct {
+	inner    zfs.DatasetFilter
+	property string
+	value    string
+}
+
+var _ zfs.DatasetPropertyFilter = (*PropertyFilter)(nil)
+var _ zfs.DatasetContextFilter = (*PropertyFilter)(nil)
+
+// spec has the form `property=value`, e.g. `com.zrepl:backup=on`
+func NewPropertyFilter(inner zfs.DatasetFilter, spec string) (*PropertyFilter, error) {
+	i := strings.Index(spec, "=")
+	if i <= 0 {
+		return nil, fmt.Errorf("property filter must have the form 'property=value', got %q", spec)
+	}
+	f := &PropertyFilter{
+		inner:    inner,
+		property: spec[:i],
+		value:    spec[i+1:],
+	}
+	if f.property == "name" {
+		return nil, fmt.Errorf("property filter cannot use property 'name', use filesystem patterns instead")
+	}
+	return f, nil
+}
+
+func (f *PropertyFilter) FilterProperties() []string { return []string{f.property} }
+
+func (f *PropertyFilter) FilterWithProperties(p *zfs.DatasetPath, props map[string]string) (pass bool, err error) {
+	if pass, err := f.inner.Filter(p); err != nil || !pass {
+		return false, err
+	}
+	return props[f.property] == f.value, nil
+}
+
+// Filter is used for individual datasets by callers that do not have a context.
+// Callers with a context should use zfs.FilterContext, or zfs.FilterAll for several datasets.
+func (f *PropertyFilter) Filter(p *zfs.DatasetPath) (pass bool, err error) {
+	return f.FilterContext(context.Background(), p)
+}
+
+// FilterContext issues a zfs get for p. Use zfs.ZFSListMapping for listing.
+func (f *PropertyFilter) FilterContext(ctx context.Context, p *zfs.DatasetPath) (pass bool, err error) {
+	if pass, err := f.inner.Filter(p); err != nil || !pass {
+		return false, err
+	}
+	props, err := zfs.ZFSGet(ctx, p, []string{f.property})
+	if err != nil {
+		return false, err
+	}
+	return props.Get(f.property) == f.value, nil
+}
+
+// Builds the filter for a job's `filesystems` and (optional) `filesystems_property` fields.
+func DatasetFilterFromConfig(in map[string]bool, property string) (zfs.DatasetFilter, error) {
+	f, err := DatasetMapFilterFromConfig(in)
+	if err != nil {
+		return nil, err
+	}
+	if property == "" {
+		return f, nil
+	}
+	pf, err := NewPropertyFilter(f, property)
+	if err != nil {
+		return nil, err
+	}
+	return pf, nil
+}
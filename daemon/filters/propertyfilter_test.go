@@ -0,0 +1,48 @@
+package filters
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestNewPropertyFilter(t *testing.T) {
+	for _, spec := range []string{"", "com.zrepl:backup", "=on", "name=tank"} {
+		_, err := NewPropertyFilter(zfs.NoFilter(), spec)
+		assert.Error(t, err, "spec %q", spec)
+	}
+	f, err := NewPropertyFilter(zfs.NoFilter(), "com.zrepl:backup=on")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"com.zrepl:backup"}, f.FilterProperties())
+
+	f, err = NewPropertyFilter(zfs.NoFilter(), "com.zrepl:note=a=b")
+	require.NoError(t, err)
+	assert.Equal(t, "a=b", f.value)
+}
+
+func TestPropertyFilterWithProperties(t *testing.T) {
+	f, err := DatasetFilterFromConfig(map[string]bool{"tank<": true, "tank/tmp<": false}, "com.zrepl:backup=on")
+	require.NoError(t, err)
+	pf := f.(*PropertyFilter)
+
+	check := func(p string, value string) bool {
+		dp, err := zfs.NewDatasetPath(p)
+		require.NoError(t, err)
+		pass, err := pf.FilterWithProperties(dp, map[string]string{"com.zrepl:backup": value})
+		require.NoError(t, err)
+		return pass
+	}
+	assert.True(t, check("tank/a", "on"))
+	assert.False(t, check("tank/a", "off"))
+	assert.False(t, check("tank/a", "-")) // unset
+	assert.False(t, check("tank/tmp/a", "on"))
+	assert.False(t, check("zroot/a", "on"))
+
+	f, err = DatasetFilterFromConfig(map[string]bool{"tank<": true}, "")
+	require.NoError(t, err)
+	_, isPropertyFilter := f.(*PropertyFilter)
+	assert.False(t, isPropertyFilter)
+}
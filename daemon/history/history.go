@@ -0,0 +1,367 @@
+// Package history implements the replication history, an append-only log of
+// the replication steps that completed successfully.
+//
+// The history is stored in a single file with one JSON-encoded Entry per line.
+// Entries are only ever appended, and each append is synced to disk before
+// RecordStep returns, so that the history can serve as evidence that a snapshot
+// was replicated. A line that was not written completely (e.g. due to a crash)
+// is skipped by Read.
+//
+// The file is created with a statedir header line that records the schema version
+// of the entries. Files written by older versions of zrepl have no header.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/daemon/statedir"
+	"github.com/zrepl/zrepl/replication/logic"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// Entry records a single replication step.
+type Entry struct {
+	// the time at which the step completed
+	Time time.Time `json:"time"`
+	// the name and type (push or pull) of the job that replicated the step
+	Job     string `json:"job"`
+	JobType string `json:"job_type"`
+	// the remote side of the job, as configured in its `connect` section
+	Peer string `json:"peer"`
+	// the name of the filesystem on the sending side
+	Filesystem string `json:"filesystem"`
+	// nil for a full send
+	From *Version `json:"from,omitempty"`
+	To   Version  `json:"to"`
+	// the number of bytes transferred by the step
+	Bytes int64 `json:"bytes"`
+	// the time it took to replicate the step, 0 in entries recorded by older versions of zrepl
+	Duration time.Duration `json:"duration_ns,omitempty"`
+}
+
+// Version identifies a snapshot or bookmark.
+type Version struct {
+	Name      string    `json:"name"` // relative name, e.g. @zrepl_20200101_000000_000
+	GUID      uint64    `json:"guid"`
+	CreateTXG uint64    `json:"createtxg"`
+	Creation  time.Time `json:"creation"`
+}
+
+func versionFromPDU(v *pdu.FilesystemVersion) *Version {
+	if v == nil {
+		return nil
+	}
+	creation, _ := v.CreationAsTime() // validated by the RPC layer, zero value is ok otherwise
+	return &Version{
+		Name:      v.RelName(),
+		GUID:      v.GetGuid(),
+		CreateTXG: v.GetCreateTXG(),
+		Creation:  creation,
+	}
+}
+
+// DB is an open history file.
+type DB struct {
+	mtx  sync.Mutex
+	path string
+	f    *os.File
+
+	stats *throughputStats
+}
+
+const (
+	stateKind     = "history"
+	schemaVersion = 1
+)
+
+// Open opens the history file at path for appending, creating it if it does not exist.
+func Open(path string) (*DB, error) {
+	if err := statedir.RemoveStaleTempFiles(path); err != nil {
+		return nil, errors.Wrap(err, "cannot clean up history file directory")
+	}
+	if _, err := statedir.CreateLog(path, statedir.Header{Kind: stateKind, Version: schemaVersion}, 0600); err != nil {
+		return nil, errors.Wrap(err, "cannot create history file")
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open history file")
+	}
+	// terminate an incompletely written last line so that the next entry starts on a new line
+	if fi, err := f.Stat(); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "cannot stat history file")
+	} else if fi.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, fi.Size()-1); err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "cannot read history file")
+		}
+		if last[0] != '\n' {
+			if _, err := f.Write([]byte{'\n'}); err != nil {
+				f.Close()
+				return nil, errors.Wrap(err, "cannot repair history file")
+			}
+		}
+	}
+	stats := newThroughputStats()
+	entries, _, err := Read(path, nil)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	for _, e := range entries {
+		stats.add(e)
+	}
+	return &DB{path: path, f: f, stats: stats}, nil
+}
+
+func (db *DB) Path() string { return db.path }
+
+func (db *DB) Close() error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	return db.f.Close()
+}
+
+// Append appends e to the history file and syncs it to disk.
+func (db *DB) Append(e *Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode history entry")
+	}
+	line = append(line, '\n')
+
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	if _, err := db.f.Write(line); err != nil {
+		return errors.Wrap(err, "cannot write history entry")
+	}
+	if db.stats != nil {
+		db.stats.add(e)
+	}
+	return errors.Wrap(db.f.Sync(), "cannot sync history file")
+}
+
+// Recorder returns a Recorder that appends the steps replicated by the given job to db.
+func (db *DB) Recorder(job, jobType, peer string) *Recorder {
+	return &Recorder{db: db, job: job, jobType: jobType, peer: peer}
+}
+
+// Recorder records the steps of a job and predicts the duration of its steps
+// from the throughput of the filesystem's previous steps.
+type Recorder struct {
+	db                 *DB
+	job, jobType, peer string
+}
+
+var _ logic.StepRecorder = (*Recorder)(nil)
+var _ logic.DurationPredictor = (*Recorder)(nil)
+
+func (r *Recorder) RecordStep(ctx context.Context, fs string, from, to *pdu.FilesystemVersion, bytes int64, duration time.Duration) {
+	e := &Entry{
+		Time:       time.Now(),
+		Job:        r.job,
+		JobType:    r.jobType,
+		Peer:       r.peer,
+		Filesystem: fs,
+		From:       versionFromPDU(from),
+		To:         *versionFromPDU(to),
+		Bytes:      bytes,
+		Duration:   duration,
+	}
+	if err := r.db.Append(e); err != nil {
+		logging.GetLogger(ctx, logging.SubsysReplication).
+			WithError(err).
+			WithField("filesystem", fs).
+			WithField("to", to.RelName()).
+			Error("cannot record replication step in history")
+	}
+}
+
+func (r *Recorder) PredictDuration(fs string, bytes int64) (time.Duration, bool) {
+	if r.db.stats == nil {
+		return 0, false
+	}
+	return r.db.stats.predict(r.job, fs, bytes)
+}
+
+// Read returns the entries of the history file at path for which match returns true,
+// in the order in which they were recorded. If match is nil, all entries are returned.
+// Lines that cannot be decoded are skipped and counted in corrupt.
+// Read fails if the file was written with a newer schema version.
+func Read(path string, match func(e *Entry) bool) (entries []*Entry, corrupt int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "cannot open history file")
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for first := true; ; first = false {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, 0, errors.Wrap(err, "cannot read history file")
+		}
+		line = bytes.TrimSpace(line)
+		if first && !bytes.HasPrefix(line, []byte("{")) && len(line) > 0 {
+			if _, err := statedir.ParseHeader(path, line, stateKind, schemaVersion); err != nil {
+				if _, ok := err.(*statedir.UnsupportedVersionError); ok {
+					return nil, 0, err
+				}
+				corrupt++
+			}
+			line = nil
+		}
+		if len(line) > 0 {
+			var e Entry
+			if json.Unmarshal(line, &e) != nil {
+				corrupt++
+			} else if match == nil || match(&e) {
+				entries = append(entries, &e)
+			}
+		}
+		if err == io.EOF {
+			return entries, corrupt, nil
+		}
+	}
+}
+
+// readNewestChunkSize is the size of the blocks in which readBackwards reads the history file.
+const readNewestChunkSize = 64 << 10
+
+// ReadNewest is like Read, but returns only the limit most recently recorded entries for which match returns true.
+// It reads the file backwards from its end and stops once it has found limit entries,
+// so that queries for recent entries do not read the whole history.
+// Only corrupt lines that were read are counted in corrupt.
+func ReadNewest(path string, match func(e *Entry) bool, limit int) (entries []*Entry, corrupt int, err error) {
+	found := 0
+	return readBackwards(path, func(e *Entry) (keep, stop bool) {
+		if match != nil && !match(e) {
+			return false, false
+		}
+		found++
+		return found <= limit, found >= limit
+	})
+}
+
+// ReadSince is like Read, but returns only the entries recorded at or after since for which match returns true.
+// Like ReadNewest, it reads the file backwards from its end and stops at the first entry recorded before since.
+func ReadSince(path string, match func(e *Entry) bool, since time.Time) (entries []*Entry, corrupt int, err error) {
+	return readBackwards(path, func(e *Entry) (keep, stop bool) {
+		if e.Time.Before(since) {
+			return false, true
+		}
+		return match == nil || match(e), false
+	})
+}
+
+// readBackwards decodes the entries of the history file at path from the most recently recorded one backwards
+// until visit returns stop, and returns the entries for which visit returned keep in the order in which they were recorded.
+func readBackwards(path string, visit func(e *Entry) (keep, stop bool)) (entries []*Entry, corrupt int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "cannot open history file")
+	}
+	defer f.Close()
+
+	first, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, 0, errors.Wrap(err, "cannot read history file")
+	}
+	var start int64 // the offset of the first entry
+	if line := bytes.TrimSpace(first); len(line) > 0 && !bytes.HasPrefix(line, []byte("{")) {
+		if _, err := statedir.ParseHeader(path, line, stateKind, schemaVersion); err != nil {
+			if _, ok := err.(*statedir.UnsupportedVersionError); ok {
+				return nil, 0, err
+			}
+			corrupt++
+		}
+		start = int64(len(first))
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "cannot stat history file")
+	}
+
+	stopped := false
+	decode := func(line []byte) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			return
+		}
+		var e Entry
+		if json.Unmarshal(line, &e) != nil {
+			corrupt++
+			return
+		}
+		keep, stop := visit(&e)
+		if keep {
+			entries = append(entries, &e)
+		}
+		stopped = stop
+	}
+
+	// rest is the part of the file between pos and the lines that were already decoded
+	pos := fi.Size()
+	var rest []byte
+	for !stopped && pos > start {
+		n := int64(readNewestChunkSize)
+		if pos-start < n {
+			n = pos - start
+		}
+		pos -= n
+		chunk := make([]byte, n, n+int64(len(rest)))
+		if _, err := f.ReadAt(chunk, pos); err != nil {
+			return nil, 0, errors.Wrap(err, "cannot read history file")
+		}
+		rest = append(chunk, rest...)
+		// the line before the last newline in rest may continue in the preceding chunk
+		for i := bytes.LastIndexByte(rest, '\n'); i >= 0 && !stopped; i = bytes.LastIndexByte(rest, '\n') {
+			decode(rest[i+1:])
+			rest = rest[:i]
+		}
+	}
+	if !stopped && pos == start {
+		decode(rest)
+	}
+
+	// entries are in reverse order
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, corrupt, nil
+}
+
+// Match returns a match function for Read that selects the entries of filesystem fs,
+// restricted to the snapshot with name snapshot (without @) and to job, unless these are empty.
+func Match(fs, snapshot, job string) func(e *Entry) bool {
+	return func(e *Entry) bool {
+		return e.Filesystem == fs &&
+			(snapshot == "" || e.To.Name == "@"+snapshot) &&
+			(job == "" || e.Job == job)
+	}
+}
+
+type contextKey int
+
+const contextKeyDB contextKey = iota
+
+func Context(ctx context.Context, db *DB) context.Context {
+	return context.WithValue(ctx, contextKeyDB, db)
+}
+
+// FromContext returns the DB of ctx, nil if the history is disabled.
+func FromContext(ctx context.Context) *DB {
+	db, _ := ctx.Value(contextKeyDB).(*DB)
+	return db
+}
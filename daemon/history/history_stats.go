@@ -0,0 +1,64 @@
+package history
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zrepl/zrepl/util/envconst"
+)
+
+// The number of most recent steps per job and filesystem from which the throughput is computed.
+var throughputSamples = envconst.Int("ZREPL_HISTORY_THROUGHPUT_SAMPLES", 10)
+
+type throughputKey struct {
+	job, fs string
+}
+
+type throughputSample struct {
+	bytes    int64
+	duration time.Duration
+}
+
+// throughputStats keeps the sizes and durations of the most recent steps per job and filesystem.
+type throughputStats struct {
+	mtx     sync.Mutex
+	samples map[throughputKey][]throughputSample // oldest first
+}
+
+func newThroughputStats() *throughputStats {
+	return &throughputStats{samples: make(map[throughputKey][]throughputSample)}
+}
+
+func (s *throughputStats) add(e *Entry) {
+	// entries recorded by older versions of zrepl lack the duration
+	if e.Duration <= 0 || e.Bytes <= 0 {
+		return
+	}
+	k := throughputKey{e.Job, e.Filesystem}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	samples := append(s.samples[k], throughputSample{e.Bytes, e.Duration})
+	if len(samples) > throughputSamples {
+		samples = samples[len(samples)-throughputSamples:]
+	}
+	s.samples[k] = samples
+}
+
+// predict returns the duration of a step of fs replicated by job that transfers bytes,
+// based on the throughput of the recent steps, false if there are none.
+func (s *throughputStats) predict(job, fs string, bytes int64) (time.Duration, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	samples := s.samples[throughputKey{job, fs}]
+	if len(samples) == 0 {
+		return 0, false
+	}
+	var sumBytes int64
+	var sumDuration time.Duration
+	for _, smp := range samples {
+		sumBytes += smp.bytes
+		sumDuration += smp.duration
+	}
+	bytesPerSecond := float64(sumBytes) / sumDuration.Seconds()
+	return time.Duration(float64(bytes) / bytesPerSecond * float64(time.Second)), true
+}
@@ -0,0 +1,255 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-history-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	db, err := Open(path)
+	require.NoError(t, err)
+
+	creation := time.Unix(1577836800, 0)
+	a := &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: "a", Guid: 1, CreateTXG: 10, Creation: pdu.FilesystemVersionCreation(creation)}
+	b := &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: "b", Guid: 2, CreateTXG: 20, Creation: pdu.FilesystemVersionCreation(creation)}
+
+	r := db.Recorder("offsite", "push", "backup.example.com:8888")
+	r.RecordStep(context.Background(), "pool/foo", nil, a, 1000, 10*time.Second)
+	r.RecordStep(context.Background(), "pool/bar", nil, a, 2000, 0)
+	r.RecordStep(context.Background(), "pool/foo", a, b, 300, 3*time.Second)
+	require.NoError(t, db.Close())
+
+	entries, corrupt, err := Read(path, Match("pool/foo", "", ""))
+	require.NoError(t, err)
+	assert.Equal(t, 0, corrupt)
+	require.Len(t, entries, 2)
+
+	assert.Nil(t, entries[0].From)
+	assert.Equal(t, "@a", entries[0].To.Name)
+	assert.Equal(t, int64(1000), entries[0].Bytes)
+
+	e := entries[1]
+	assert.Equal(t, "offsite", e.Job)
+	assert.Equal(t, "push", e.JobType)
+	assert.Equal(t, "backup.example.com:8888", e.Peer)
+	require.NotNil(t, e.From)
+	assert.Equal(t, "@a", e.From.Name)
+	assert.Equal(t, uint64(1), e.From.GUID)
+	assert.Equal(t, uint64(10), e.From.CreateTXG)
+	assert.True(t, creation.Equal(e.From.Creation))
+	assert.Equal(t, "@b", e.To.Name)
+	assert.Equal(t, uint64(2), e.To.GUID)
+	assert.Equal(t, int64(300), e.Bytes)
+	assert.Equal(t, 3*time.Second, e.Duration)
+
+	all, _, err := Read(path, nil)
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	snap, _, err := Read(path, Match("pool/foo", "b", ""))
+	require.NoError(t, err)
+	require.Len(t, snap, 1)
+	assert.Equal(t, "@b", snap[0].To.Name)
+	none, _, err := Read(path, Match("pool/foo", "", "otherjob"))
+	require.NoError(t, err)
+	assert.Empty(t, none)
+}
+
+func TestOpenRepairsIncompleteLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-history-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	// simulate a crash during the write of the second entry
+	err = ioutil.WriteFile(path, []byte(`{"filesystem":"pool/foo","to":{"name":"@a"}}`+"\n"+`{"filesystem":"pool/f`), 0600)
+	require.NoError(t, err)
+
+	db, err := Open(path)
+	require.NoError(t, err)
+	require.NoError(t, db.Append(&Entry{Filesystem: "pool/foo", To: Version{Name: "@b"}}))
+	require.NoError(t, db.Close())
+
+	entries, corrupt, err := Read(path, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, corrupt)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "@a", entries[0].To.Name)
+	assert.Equal(t, "@b", entries[1].To.Name)
+}
+
+func TestSchemaVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-history-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// new files start with a header
+	path := filepath.Join(dir, "history.jsonl")
+	db, err := Open(path)
+	require.NoError(t, err)
+	require.NoError(t, db.Append(&Entry{Filesystem: "pool/foo", To: Version{Name: "@a"}}))
+	require.NoError(t, db.Close())
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Regexp(t, "^zrepl-state history v1\n\\{", string(data))
+	entries, corrupt, err := Read(path, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, corrupt)
+	assert.Len(t, entries, 1)
+
+	// files of older versions have none
+	legacy := filepath.Join(dir, "legacy.jsonl")
+	require.NoError(t, ioutil.WriteFile(legacy, []byte(`{"filesystem":"pool/foo","to":{"name":"@a"}}`+"\n"), 0600))
+	entries, corrupt, err = Read(legacy, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, corrupt)
+	assert.Len(t, entries, 1)
+
+	// files of newer versions are refused
+	newer := filepath.Join(dir, "newer.jsonl")
+	require.NoError(t, ioutil.WriteFile(newer, []byte("zrepl-state history v2\n"), 0600))
+	_, _, err = Read(newer, nil)
+	assert.Error(t, err)
+	_, err = Open(newer)
+	assert.Error(t, err)
+}
+
+func TestReadNewest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-history-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	// enough entries to span several chunks
+	db, err := Open(path)
+	require.NoError(t, err)
+	for i := 0; i < 3000; i++ {
+		fs := "pool/foo"
+		if i%3 == 0 {
+			fs = "pool/bar"
+		}
+		require.NoError(t, db.Append(&Entry{Filesystem: fs, To: Version{Name: fmt.Sprintf("@s%d", i)}}))
+	}
+	require.NoError(t, db.Close())
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.True(t, info.Size() > 2*readNewestChunkSize)
+
+	all, _, err := Read(path, Match("pool/bar", "", ""))
+	require.NoError(t, err)
+	for _, limit := range []int{1, 10, 999, 1000, 5000} {
+		entries, corrupt, err := ReadNewest(path, Match("pool/bar", "", ""), limit)
+		require.NoError(t, err)
+		assert.Equal(t, 0, corrupt)
+		if limit > len(all) {
+			limit = len(all)
+		}
+		assert.Equal(t, all[len(all)-limit:], entries, "limit %d", limit)
+	}
+
+	// an incomplete last line
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"filesystem":"pool/b`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	entries, corrupt, err := ReadNewest(path, nil, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, corrupt)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "@s2999", entries[1].To.Name)
+
+	// files of older versions have no header
+	legacy := filepath.Join(dir, "legacy.jsonl")
+	require.NoError(t, ioutil.WriteFile(legacy, []byte(`{"filesystem":"pool/foo","to":{"name":"@a"}}`+"\n"+`{"filesystem":"pool/foo","to":{"name":"@b"}}`), 0600))
+	entries, corrupt, err = ReadNewest(legacy, nil, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 0, corrupt)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "@a", entries[0].To.Name)
+
+	// files of newer versions are refused
+	newer := filepath.Join(dir, "newer.jsonl")
+	require.NoError(t, ioutil.WriteFile(newer, []byte("zrepl-state history v2\n"), 0600))
+	_, _, err = ReadNewest(newer, nil, 1)
+	assert.Error(t, err)
+}
+
+func TestReadSince(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-history-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	// enough entries to span several chunks
+	start := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	db, err := Open(path)
+	require.NoError(t, err)
+	for i := 0; i < 3000; i++ {
+		require.NoError(t, db.Append(&Entry{Time: start.Add(time.Duration(i) * time.Minute), Filesystem: "pool/foo", To: Version{Name: fmt.Sprintf("@s%d", i)}}))
+	}
+	require.NoError(t, db.Close())
+
+	all, _, err := Read(path, nil)
+	require.NoError(t, err)
+	for _, n := range []int{0, 1, 1000, 3000} {
+		entries, corrupt, err := ReadSince(path, nil, start.Add(time.Duration(3000-n)*time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, 0, corrupt)
+		var expect []*Entry // nil if n == 0
+		expect = append(expect, all[3000-n:]...)
+		assert.Equal(t, expect, entries, "n %d", n)
+	}
+	entries, _, err := ReadSince(path, nil, start.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, all, entries)
+}
+
+func TestPredictDuration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-history-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	a := &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: "a", Guid: 1, CreateTXG: 10, Creation: pdu.FilesystemVersionCreation(time.Unix(1577836800, 0))}
+	db, err := Open(path)
+	require.NoError(t, err)
+	r := db.Recorder("offsite", "push", "backup.example.com:8888")
+	_, ok := r.PredictDuration("pool/foo", 1000)
+	assert.False(t, ok, "no prediction without history")
+
+	// 1000 bytes/s on average
+	r.RecordStep(context.Background(), "pool/foo", nil, a, 1000, 2*time.Second)
+	r.RecordStep(context.Background(), "pool/foo", nil, a, 3000, 2*time.Second)
+	r.RecordStep(context.Background(), "pool/foo", nil, a, 500, 0) // older entry format
+	r.RecordStep(context.Background(), "pool/bar", nil, a, 1, time.Second)
+	d, ok := r.PredictDuration("pool/foo", 5000)
+	require.True(t, ok)
+	assert.Equal(t, 5*time.Second, d)
+	_, ok = db.Recorder("other", "push", "").PredictDuration("pool/foo", 5000)
+	assert.False(t, ok, "predictions must be per job")
+	require.NoError(t, db.Close())
+
+	// the statistics are restored from the history file
+	db, err = Open(path)
+	require.NoError(t, err)
+	defer db.Close()
+	d, ok = db.Recorder("offsite", "push", "").PredictDuration("pool/foo", 5000)
+	require.True(t, ok)
+	assert.Equal(t, 5*time.Second, d)
+}
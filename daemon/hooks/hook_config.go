@@ -2,6 +2,7 @@ package hooks
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/zfs"
@@ -17,21 +18,50 @@ func HookFromConfig(in config.HookEnum) (Hook, error) {
 		return PgChkptHookFromConfig(v)
 	case *config.HookMySQLLockTables:
 		return MyLockTablesFromConfig(v)
+	case *config.HookFsFreeze:
+		return FsFreezeFromConfig(v)
+	case *config.HookLibvirtFsFreeze:
+		return LibvirtFsFreezeFromConfig(v)
 	default:
 		return nil, fmt.Errorf("unknown hook type %T", v)
 	}
 }
 
+func hookOrderFromConfig(in config.HookEnum) int {
+	switch v := in.Ret.(type) {
+	case *config.HookCommand:
+		return v.Order
+	case *config.HookPostgresCheckpoint:
+		return v.Order
+	case *config.HookMySQLLockTables:
+		return v.Order
+	case *config.HookFsFreeze:
+		return v.Order
+	case *config.HookLibvirtFsFreeze:
+		return v.Order
+	default:
+		return 0
+	}
+}
+
+// ListFromConfig returns the hooks sorted by their order setting.
+// Hooks with equal order remain in configuration order.
 func ListFromConfig(in *config.HookList) (r *List, err error) {
 	hl := make(List, len(*in))
+	order := make(map[Hook]int, len(*in))
 
 	for i, h := range *in {
 		hl[i], err = HookFromConfig(h)
 		if err != nil {
 			return nil, fmt.Errorf("create hook #%d: %s", i+1, err)
 		}
+		order[hl[i]] = hookOrderFromConfig(h)
 	}
 
+	sort.SliceStable(hl, func(i, j int) bool {
+		return order[hl[i]] < order[hl[j]]
+	})
+
 	return &hl, nil
 }
 
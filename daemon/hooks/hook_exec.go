@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/zrepl/zrepl/util/envconst"
 	"github.com/zrepl/zrepl/zfs"
 )
 
@@ -28,11 +29,23 @@ type Hook interface {
 	String() string
 }
 
+// PanicCleanupHook is implemented by hooks whose pre edge leaves the system in
+// a state that must not outlive a crash of the daemon, e.g., frozen filesystems.
+// If Plan.Run panics after the pre edge of such a hook ran, CleanupAfterPanic is
+// invoked with the step's state before the panic is propagated.
+type PanicCleanupHook interface {
+	Hook
+	CleanupAfterPanic(ctx context.Context, state map[interface{}]interface{})
+}
+
 type Phase string
 
 const (
-	PhaseSnapshot = Phase("snapshot")
-	PhaseTesting  = Phase("testing")
+	PhaseSnapshot     = Phase("snapshot")
+	PhaseReceive      = Phase("receive")
+	PhaseTestRestore  = Phase("test_restore")
+	PhaseRateOfChange = Phase("rate_of_change")
+	PhaseTesting      = Phase("testing")
 )
 
 func (p Phase) String() string {
@@ -183,6 +196,62 @@ func (r PlanReport) HadFatalError() bool {
 	return false
 }
 
+const MAX_HOOK_REPORT_OUTPUT_SIZE_DEFAULT int = 32 << 10
+
+// StepFailure is a serializable summary of a failed step in a PlanReport,
+// used to show the hook failure in the job status.
+type StepFailure struct {
+	Step  int // 1-based position in the PlanReport
+	Edge  string
+	Hook  string
+	Error string
+	// The tail of the combined stdout and stderr of a command hook,
+	// at most ZREPL_MAX_HOOK_REPORT_OUTPUT_SIZE bytes.
+	Output          string
+	OutputTruncated bool
+}
+
+func (r PlanReport) Failures() []StepFailure {
+	maxOutput := envconst.Int("ZREPL_MAX_HOOK_REPORT_OUTPUT_SIZE", MAX_HOOK_REPORT_OUTPUT_SIZE_DEFAULT)
+	var failures []StepFailure
+	for i, e := range r {
+		if e.Status != StepErr {
+			continue
+		}
+		f := StepFailure{
+			Step: i + 1,
+			Edge: e.Edge.String(),
+			Hook: e.Hook.String(),
+		}
+		if e.Report != nil {
+			f.Error = e.Report.Error()
+		}
+		if cr, ok := e.Report.(*CommandHookReport); ok {
+			out := cr.CapturedStdoutStderrCombined
+			if len(out) > maxOutput {
+				out = out[len(out)-maxOutput:]
+				f.OutputTruncated = true
+			}
+			f.Output = string(out)
+		}
+		failures = append(failures, f)
+	}
+	return failures
+}
+
+// Must be called with p.mtx read-locked.
+func (p *Plan) cleanupAfterPanic(ctx context.Context) {
+	for i := len(p.pre) - 1; i >= 0; i-- {
+		pre, post := p.pre[i], p.post[i]
+		h, ok := pre.Hook.(PanicCleanupHook)
+		if !ok || (pre.Status != StepOk && pre.Status != StepExec) || post.Status == StepOk {
+			continue
+		}
+		getLogger(ctx).WithField("hook", h).Error("cleaning up after panic in hook plan")
+		h.CleanupAfterPanic(ctx, pre.state)
+	}
+}
+
 func (r PlanReport) String() string {
 	stepStrings := make([]string, len(r))
 	for i, e := range r {
@@ -194,6 +263,12 @@ func (r PlanReport) String() string {
 func (p *Plan) Run(ctx context.Context, dryRun bool) {
 	p.mtx.RLock()
 	defer p.mtx.RUnlock()
+	defer func() {
+		if r := recover(); r != nil {
+			p.cleanupAfterPanic(ctx)
+			panic(r)
+		}
+	}()
 	w := func(f func()) {
 		p.mtx.RUnlock()
 		defer p.mtx.RLock()
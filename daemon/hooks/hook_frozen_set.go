@@ -0,0 +1,115 @@
+package hooks
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/logger"
+)
+
+// frozenSet tracks the items (mountpoints, VMs, ...) that the pre edge of a
+// freezing hook froze, and thaws them in reverse freeze order.
+// It is safe for concurrent use by the post edge, the max_frozen timer and
+// CleanupAfterPanic, each item is thawed at most once.
+type frozenSet struct {
+	log       logger.Logger
+	itemField string // log field name for an item
+	maxFrozen time.Duration
+	// Thawing must not honor the cancellation of the job's context,
+	// a cancelled job must not leave frozen items behind.
+	thawOne func(item string) error
+
+	mtx     sync.Mutex
+	items   []string // frozen, in freeze order
+	timer   *time.Timer
+	expired bool // the timer thawed the items
+}
+
+func newFrozenSet(log logger.Logger, itemField string, maxFrozen time.Duration, thawOne func(item string) error) *frozenSet {
+	return &frozenSet{
+		log:       log,
+		itemField: itemField,
+		maxFrozen: maxFrozen,
+		thawOne:   thawOne,
+	}
+}
+
+func (f *frozenSet) add(item string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.items = append(f.items, item)
+}
+
+// armTimer thaws the items after d unless the post edge thawed them before.
+func (f *frozenSet) armTimer(d time.Duration) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.timer = time.AfterFunc(d, func() {
+		f.mtx.Lock()
+		defer f.mtx.Unlock()
+		if len(f.items) == 0 {
+			return // the post edge (or a panic) won the race for the thaw
+		}
+		f.expired = true
+		f.log.WithField("max_frozen", f.maxFrozen).Error("post-edge did not run within max_frozen, thawing")
+		if err := f.thawLocked("max_frozen exceeded"); err != nil {
+			f.log.WithError(err).Error("cannot thaw after max_frozen")
+		}
+	})
+}
+
+// thawPost thaws the items for the post edge and returns an error if the
+// timer thawed them before, i.e., the snapshot might not be consistent.
+func (f *frozenSet) thawPost() error {
+	err := f.thaw("post-edge")
+	f.mtx.Lock()
+	expired := f.expired
+	f.mtx.Unlock()
+	if err == nil && expired {
+		return errors.Errorf("thawed after max_frozen (%s) before the snapshot completed, it might not be consistent", f.maxFrozen)
+	}
+	return err
+}
+
+// thawOnPanic must be deferred directly by the pre edge.
+func (f *frozenSet) thawOnPanic() {
+	if r := recover(); r != nil {
+		f.thawAfterPanic()
+		panic(r)
+	}
+}
+
+func (f *frozenSet) thawAfterPanic() {
+	if err := f.thaw("panic"); err != nil {
+		f.log.WithError(err).Error("cannot thaw after panic")
+	}
+}
+
+func (f *frozenSet) thaw(reason string) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.thawLocked(reason)
+}
+
+func (f *frozenSet) thawLocked(reason string) error {
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	var errs []string
+	for i := len(f.items) - 1; i >= 0; i-- {
+		item := f.items[i]
+		f.log.WithField(f.itemField, item).WithField("reason", reason).Debug("thaw")
+		if err := f.thawOne(item); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	f.items = nil
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
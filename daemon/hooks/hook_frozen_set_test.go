@@ -0,0 +1,52 @@
+package hooks
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/logger"
+)
+
+func TestFrozenSetTimerOnlyReportsExpiryIfItThawed(t *testing.T) {
+	var mtx sync.Mutex
+	thawed := 0
+	thawOne := func(string) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		thawed++
+		return nil
+	}
+
+	// the timer fires while the post edge holds the lock
+	f := newFrozenSet(logger.NewNullLogger(), "item", time.Millisecond, thawOne)
+	f.add("a")
+	f.armTimer(time.Hour)
+	f.mtx.Lock()
+	f.timer.Reset(0)
+	time.Sleep(10 * time.Millisecond) // the timer blocks on the lock
+	require.NoError(t, f.thawLocked("post-edge"))
+	f.mtx.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	f.mtx.Lock()
+	assert.False(t, f.expired)
+	f.mtx.Unlock()
+
+	// the timer wins
+	f = newFrozenSet(logger.NewNullLogger(), "item", time.Millisecond, thawOne)
+	f.add("a")
+	f.armTimer(0)
+	require.Eventually(t, func() bool {
+		f.mtx.Lock()
+		defer f.mtx.Unlock()
+		return f.expired
+	}, time.Second, time.Millisecond)
+	assert.Error(t, f.thawPost())
+
+	mtx.Lock()
+	assert.Equal(t, 2, thawed, "each set is thawed exactly once")
+	mtx.Unlock()
+}
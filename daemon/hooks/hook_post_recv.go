@@ -0,0 +1,55 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// PostRecv runs command hooks after each successful receive.
+// Only the post edge of the hooks is invoked, with PhaseReceive.
+type PostRecv struct {
+	hooks List
+}
+
+// PostRecvFromConfig returns nil if in is empty.
+func PostRecvFromConfig(in config.HookList) (*PostRecv, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	for i, h := range in {
+		if _, ok := h.Ret.(*config.HookCommand); !ok {
+			return nil, fmt.Errorf("hook #%d: only hooks of type `command` can run after a receive", i+1)
+		}
+	}
+	l, err := ListFromConfig(&in)
+	if err != nil {
+		return nil, err
+	}
+	return &PostRecv{hooks: *l}, nil
+}
+
+// RunPostRecv runs the hooks whose filter matches fs, in order.
+// Errors are logged and do not affect other hooks.
+func (p *PostRecv) RunPostRecv(ctx context.Context, fs *zfs.DatasetPath, snapshot zfs.FilesystemVersion) {
+	filtered, err := p.hooks.CopyFilteredForFilesystem(fs)
+	if err != nil {
+		getLogger(ctx).WithError(err).WithField("fs", fs.ToString()).Error("cannot filter post-receive hooks")
+		return
+	}
+	env := Env{
+		EnvFS:       fs.ToString(),
+		EnvSnapshot: snapshot.Name,
+	}
+	for _, h := range filtered {
+		l := getLogger(ctx).WithField("fs", fs.ToString()).WithField("hook", h.String())
+		report := h.Run(ctx, Post, PhaseReceive, false, env, make(map[interface{}]interface{}))
+		if report.HadError() {
+			l.WithField("report", report.Error()).Error("post-receive hook failed")
+		} else {
+			l.WithField("report", report.String()).Debug("post-receive hook finished")
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// RateOfChange runs command hooks when the data written to a filesystem
+// between two consecutive snapshots exceeds the snapshotting job's rate_of_change threshold.
+// Only the post edge of the hooks is invoked, with PhaseRateOfChange.
+type RateOfChange struct {
+	hooks List
+}
+
+// RateOfChangeFromConfig returns nil if in is empty.
+func RateOfChangeFromConfig(in config.HookList) (*RateOfChange, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	for i, h := range in {
+		if _, ok := h.Ret.(*config.HookCommand); !ok {
+			return nil, fmt.Errorf("hook #%d: only hooks of type `command` can run on rate of change alerts", i+1)
+		}
+	}
+	l, err := ListFromConfig(&in)
+	if err != nil {
+		return nil, err
+	}
+	return &RateOfChange{hooks: *l}, nil
+}
+
+// RunRateOfChange runs the hooks whose filter matches fs, in order.
+// Errors are logged and do not affect other hooks.
+func (r *RateOfChange) RunRateOfChange(ctx context.Context, fs *zfs.DatasetPath, snapshot string, written, threshold uint64) {
+	filtered, err := r.hooks.CopyFilteredForFilesystem(fs)
+	if err != nil {
+		getLogger(ctx).WithError(err).WithField("fs", fs.ToString()).Error("cannot filter rate of change hooks")
+		return
+	}
+	env := Env{
+		EnvFS:        fs.ToString(),
+		EnvSnapshot:  snapshot,
+		EnvWritten:   fmt.Sprintf("%d", written),
+		EnvThreshold: fmt.Sprintf("%d", threshold),
+	}
+	for _, h := range filtered {
+		l := getLogger(ctx).WithField("fs", fs.ToString()).WithField("hook", h.String())
+		report := h.Run(ctx, Post, PhaseRateOfChange, false, env, make(map[interface{}]interface{}))
+		if report.HadError() {
+			l.WithField("report", report.Error()).Error("rate of change hook failed")
+		} else {
+			l.WithField("report", report.String()).Debug("rate of change hook finished")
+		}
+	}
+}
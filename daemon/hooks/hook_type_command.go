@@ -10,6 +10,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/zrepl/zrepl/config"
@@ -22,11 +23,14 @@ import (
 type HookEnvVar string
 
 const (
-	EnvType     HookEnvVar = "ZREPL_HOOKTYPE"
-	EnvDryRun   HookEnvVar = "ZREPL_DRYRUN"
-	EnvFS       HookEnvVar = "ZREPL_FS"
-	EnvSnapshot HookEnvVar = "ZREPL_SNAPNAME"
-	EnvTimeout  HookEnvVar = "ZREPL_TIMEOUT"
+	EnvType      HookEnvVar = "ZREPL_HOOKTYPE"
+	EnvDryRun    HookEnvVar = "ZREPL_DRYRUN"
+	EnvFS        HookEnvVar = "ZREPL_FS"
+	EnvSnapshot  HookEnvVar = "ZREPL_SNAPNAME"
+	EnvTimeout   HookEnvVar = "ZREPL_TIMEOUT"
+	EnvClone     HookEnvVar = "ZREPL_CLONE"
+	EnvWritten   HookEnvVar = "ZREPL_WRITTEN"
+	EnvThreshold HookEnvVar = "ZREPL_THRESHOLD"
 )
 
 type Env map[HookEnvVar]string
@@ -67,6 +71,7 @@ type CommandHookReport struct {
 	Args                         []string // currently always empty
 	Env                          Env
 	Err                          error
+	TimedOut                     bool // the hook's process group was killed because it exceeded the timeout
 	CapturedStdoutStderrCombined []byte
 }
 
@@ -93,7 +98,11 @@ func (r *CommandHookReport) String() string {
 		cmdLine.WriteString(fmt.Sprintf("%s'%s'", sep, a))
 	}
 
-	return fmt.Sprintf("command hook invocation: \"%s\"", cmdLine.String()) // no %q to make copy-pastable
+	var timedOut string
+	if r.TimedOut {
+		timedOut = " TIMED OUT"
+	}
+	return fmt.Sprintf("command hook invocation: \"%s\"%s", cmdLine.String(), timedOut) // no %q to make copy-pastable
 }
 func (r *CommandHookReport) Error() string {
 	if r.Err == nil {
@@ -141,7 +150,11 @@ func (h *CommandHook) Run(ctx context.Context, edge Edge, phase Phase, dryRun bo
 	cmdCtx, cancel := context.WithTimeout(ctx, h.timeout)
 	defer cancel()
 
-	cmdExec := exec.CommandContext(cmdCtx, h.command)
+	// Run the hook in its own process group so that we can kill the
+	// processes it spawned, too. Otherwise, a child process that
+	// inherited stdout or stderr would keep Wait() from returning.
+	cmdExec := exec.Command(h.command)
+	cmdExec.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
 	hookEnv := NewHookEnv(edge, phase, dryRun, h.timeout, extra)
 	cmdEnv := os.Environ()
@@ -175,15 +188,35 @@ func (h *CommandHook) Run(ctx context.Context, edge Edge, phase Phase, dryRun bo
 		return report
 	}
 
+	waitDone := make(chan struct{})
+	killedProcessGroup := make(chan error, 1)
+	go func() {
+		select {
+		case <-cmdCtx.Done():
+			// the process group ID is the PID of the group leader (Setpgid above)
+			killedProcessGroup <- syscall.Kill(-cmdExec.Process.Pid, syscall.SIGKILL)
+		case <-waitDone:
+			close(killedProcessGroup)
+		}
+	}()
 	err = cmdExec.Wait()
+	close(waitDone)
 	combinedOutputBytes := combinedOutput.Bytes()
 	report.CapturedStdoutStderrCombined = make([]byte, len(combinedOutputBytes))
 	copy(report.CapturedStdoutStderrCombined, combinedOutputBytes)
-	if err != nil {
+	if killErr, killed := <-killedProcessGroup; killed {
+		if killErr != nil && killErr != syscall.ESRCH { // ESRCH: all processes exited in the meantime
+			l.WithError(killErr).Error("cannot kill hook process group")
+		}
 		if cmdCtx.Err() == context.DeadlineExceeded {
-			report.Err = fmt.Errorf("timed out after %s: %s", h.timeout, err)
+			report.TimedOut = true
+			report.Err = fmt.Errorf("timed out after %s, killed process group: %v", h.timeout, err)
 			return report
 		}
+		report.Err = fmt.Errorf("cancelled, killed process group: %v", err)
+		return report
+	}
+	if err != nil {
 		report.Err = err
 		return report
 	}
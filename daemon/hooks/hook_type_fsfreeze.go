@@ -0,0 +1,170 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/filters"
+)
+
+// FsFreeze freezes mountpoints with fsfreeze(8) or xfs_freeze(8) while the
+// snapshot is taken, e.g., filesystems on zvols that are mounted on the host,
+// so that the snapshot contains a clean filesystem instead of one that needs
+// a journal replay.
+//
+// A frozen filesystem blocks all writers, hence FsFreeze thaws
+//   - the mountpoints it already froze if freezing one of them fails,
+//   - all mountpoints after maxFrozen, even if the post edge never runs,
+//   - all mountpoints if the hook plan panics (see PanicCleanupHook).
+type FsFreeze struct {
+	errIsFatal  bool
+	filesystems Filter
+	command     string
+	mountpoints []string
+	timeout     time.Duration
+	maxFrozen   time.Duration
+}
+
+type fsFreezeStateKey int
+
+const (
+	fsFreezeFrozen fsFreezeStateKey = 1 + iota
+)
+
+func FsFreezeFromConfig(in *config.HookFsFreeze) (*FsFreeze, error) {
+	if in.Command == "" {
+		return nil, errors.New("`command` must not be empty")
+	}
+	if len(in.Mountpoints) == 0 {
+		return nil, errors.New("`mountpoints` must not be empty")
+	}
+	seen := make(map[string]bool, len(in.Mountpoints))
+	mountpoints := make([]string, len(in.Mountpoints))
+	for i, mp := range in.Mountpoints {
+		if !filepath.IsAbs(mp) {
+			return nil, errors.Errorf("`mountpoints`: %q is not an absolute path", mp)
+		}
+		mp = filepath.Clean(mp)
+		if seen[mp] {
+			return nil, errors.Errorf("`mountpoints`: %q is specified twice", mp)
+		}
+		seen[mp] = true
+		mountpoints[i] = mp
+	}
+	if in.Timeout*time.Duration(len(mountpoints)) >= in.MaxFrozen {
+		return nil, errors.Errorf("`max_frozen` (%s) must be greater than `timeout` (%s) times the number of mountpoints", in.MaxFrozen, in.Timeout)
+	}
+
+	filesystems, err := filters.DatasetMapFilterFromConfig(in.Filesystems)
+	if err != nil {
+		return nil, errors.Wrap(err, "`filesystems` invalid")
+	}
+
+	return &FsFreeze{
+		errIsFatal:  in.ErrIsFatal,
+		filesystems: filesystems,
+		command:     in.Command,
+		mountpoints: mountpoints,
+		timeout:     in.Timeout,
+		maxFrozen:   in.MaxFrozen,
+	}, nil
+}
+
+func (h *FsFreeze) ErrIsFatal() bool    { return h.errIsFatal }
+func (h *FsFreeze) Filesystems() Filter { return h.filesystems }
+func (h *FsFreeze) String() string {
+	return fmt.Sprintf("%s %s", h.command, strings.Join(h.mountpoints, " "))
+}
+
+type FsFreezeReport struct {
+	What string
+	Err  error
+}
+
+func (r *FsFreezeReport) HadError() bool { return r.Err != nil }
+func (r *FsFreezeReport) Error() string  { return r.String() }
+func (r *FsFreezeReport) String() string {
+	var s strings.Builder
+	s.WriteString(r.What)
+	if r.Err != nil {
+		fmt.Fprintf(&s, ": %s", r.Err)
+	}
+	return s.String()
+}
+
+func (h *FsFreeze) Run(ctx context.Context, edge Edge, phase Phase, dryRun bool, extra Env, state map[interface{}]interface{}) HookReport {
+	if phase != PhaseSnapshot {
+		return &FsFreezeReport{What: fmt.Sprintf("skipped, only applies to phase %s", PhaseSnapshot)}
+	}
+	switch edge {
+	case Pre:
+		if dryRun {
+			return &FsFreezeReport{What: "dry run, not freezing"}
+		}
+		return &FsFreezeReport{"freeze", h.freeze(ctx, state)}
+	case Post:
+		if dryRun {
+			return &FsFreezeReport{What: "dry run, not thawing"}
+		}
+		f, ok := state[fsFreezeFrozen].(*frozenSet)
+		if !ok {
+			return &FsFreezeReport{What: "nothing to thaw"}
+		}
+		return &FsFreezeReport{"thaw", f.thawPost()}
+	}
+	return &FsFreezeReport{What: "skipped this edge"}
+}
+
+// CleanupAfterPanic implements PanicCleanupHook.
+func (h *FsFreeze) CleanupAfterPanic(ctx context.Context, state map[interface{}]interface{}) {
+	if f, ok := state[fsFreezeFrozen].(*frozenSet); ok {
+		f.thawAfterPanic()
+	}
+}
+
+func (h *FsFreeze) freeze(ctx context.Context, state map[interface{}]interface{}) error {
+	begin := time.Now()
+	f := newFrozenSet(getLogger(ctx).WithField("hook", h.String()), "mountpoint", h.maxFrozen, func(mp string) error {
+		return h.exec(context.Background(), "-u", mp)
+	})
+	state[fsFreezeFrozen] = f
+	defer f.thawOnPanic()
+
+	for _, mp := range h.mountpoints {
+		f.log.WithField("mountpoint", mp).Debug("freeze")
+		err := h.exec(ctx, "-f", mp)
+		// a timed out freeze might have frozen mp nonetheless, so thaw it, too
+		f.add(mp)
+		if err != nil {
+			if terr := f.thaw("freezing failed"); terr != nil {
+				f.log.WithError(terr).Error("cannot thaw after failed freeze")
+			}
+			return err
+		}
+	}
+
+	f.armTimer(h.maxFrozen - time.Since(begin))
+	return nil
+}
+
+// exec runs the freeze command with flag (-f or -u) for mountpoint,
+// killing it after h.timeout.
+func (h *FsFreeze) exec(ctx context.Context, flag, mountpoint string) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, h.command, flag, mountpoint).CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.Errorf("%s %s %s timed out after %s", h.command, flag, mountpoint, h.timeout)
+	}
+	if err != nil {
+		return errors.Errorf("%s %s %s: %s: %s", h.command, flag, mountpoint, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
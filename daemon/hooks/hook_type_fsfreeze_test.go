@@ -0,0 +1,175 @@
+package hooks_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/hooks"
+	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+type fsFreezeTest struct {
+	dir string
+	log string
+}
+
+// The fake freeze command logs its arguments and fails for mountpoints named fail*.
+func newFsFreezeTest(t *testing.T) *fsFreezeTest {
+	dir, err := ioutil.TempDir("", "zrepl-fsfreeze-hook-test")
+	require.NoError(t, err)
+	ft := &fsFreezeTest{dir: dir, log: filepath.Join(dir, "log")}
+	script := fmt.Sprintf("#!/bin/sh\necho \"$1 $2\" >> %s\ncase \"$2\" in */fail*) exit 1;; esac\n", ft.log)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "freeze"), []byte(script), 0755))
+	return ft
+}
+
+func (ft *fsFreezeTest) hook(t *testing.T, maxFrozen time.Duration, mountpoints ...string) *hooks.Plan {
+	h, err := hooks.FsFreezeFromConfig(&config.HookFsFreeze{
+		HookSettingsCommon: config.HookSettingsCommon{Type: "fsfreeze", ErrIsFatal: true},
+		Mountpoints:        mountpoints,
+		Command:            filepath.Join(ft.dir, "freeze"),
+		Timeout:            10 * time.Second,
+		MaxFrozen:          maxFrozen,
+		Filesystems:        config.FilesystemsFilter{"<": true},
+	})
+	require.NoError(t, err)
+	return ft.plan(t, h, func(ctx context.Context) error { return nil })
+}
+
+func (ft *fsFreezeTest) plan(t *testing.T, h hooks.Hook, cb hooks.HookJobCallback) *hooks.Plan {
+	fs, err := zfs.NewDatasetPath("pool/vm")
+	require.NoError(t, err)
+	plan, err := hooks.NewPlan(&hooks.List{h}, hooks.PhaseSnapshot, hooks.NewCallbackHookForFilesystem("snapshot", fs, cb), hooks.Env{hooks.EnvFS: fs.ToString()})
+	require.NoError(t, err)
+	return plan
+}
+
+func (ft *fsFreezeTest) invocations(t *testing.T) string {
+	log, err := ioutil.ReadFile(ft.log)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	require.NoError(t, err)
+	return string(log)
+}
+
+func fsFreezeTestContext() (context.Context, trace.DoneFunc) {
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	return logging.WithLoggers(ctx, logging.SubsystemLoggersWithUniversalLogger(logger.NewNullLogger())), end
+}
+
+func TestFsFreezeFromConfig(t *testing.T) {
+	conf := func(mountpoints ...string) *config.HookFsFreeze {
+		return &config.HookFsFreeze{
+			Mountpoints: mountpoints,
+			Command:     "fsfreeze",
+			Timeout:     10 * time.Second,
+			MaxFrozen:   time.Minute,
+			Filesystems: config.FilesystemsFilter{"pool/vm": true},
+		}
+	}
+	h, err := hooks.FsFreezeFromConfig(conf("/mnt/a/", "/mnt/b"))
+	require.NoError(t, err)
+	require.Equal(t, "fsfreeze /mnt/a /mnt/b", h.String())
+
+	_, err = hooks.FsFreezeFromConfig(conf())
+	require.Error(t, err)
+	_, err = hooks.FsFreezeFromConfig(conf("mnt/a"))
+	require.Error(t, err, "relative mountpoint")
+	_, err = hooks.FsFreezeFromConfig(conf("/mnt/a", "/mnt/a/"))
+	require.Error(t, err, "duplicate mountpoint")
+	_, err = hooks.FsFreezeFromConfig(conf("/mnt/1", "/mnt/2", "/mnt/3", "/mnt/4", "/mnt/5", "/mnt/6"))
+	require.Error(t, err, "timeouts exceed max_frozen")
+}
+
+func TestFsFreezeThawsInReverseOrder(t *testing.T) {
+	ft := newFsFreezeTest(t)
+	defer os.RemoveAll(ft.dir)
+	ctx, end := fsFreezeTestContext()
+	defer end()
+
+	plan := ft.hook(t, time.Minute, "/mnt/a", "/mnt/b")
+	plan.Run(ctx, false)
+	require.False(t, plan.Report().HadError())
+	require.Equal(t, "-f /mnt/a\n-f /mnt/b\n-u /mnt/b\n-u /mnt/a\n", ft.invocations(t))
+}
+
+func TestFsFreezeDryRun(t *testing.T) {
+	ft := newFsFreezeTest(t)
+	defer os.RemoveAll(ft.dir)
+	ctx, end := fsFreezeTestContext()
+	defer end()
+
+	plan := ft.hook(t, time.Minute, "/mnt/a")
+	plan.Run(ctx, true)
+	require.False(t, plan.Report().HadError())
+	require.Equal(t, "", ft.invocations(t))
+}
+
+func TestFsFreezeFailureThawsFrozenMountpoints(t *testing.T) {
+	ft := newFsFreezeTest(t)
+	defer os.RemoveAll(ft.dir)
+	ctx, end := fsFreezeTestContext()
+	defer end()
+
+	plan := ft.hook(t, time.Minute, "/mnt/a", "/mnt/fail")
+	plan.Run(ctx, false)
+	report := plan.Report()
+	require.True(t, report.HadFatalError())
+	require.Equal(t, "-f /mnt/a\n-f /mnt/fail\n-u /mnt/fail\n-u /mnt/a\n", ft.invocations(t))
+}
+
+func TestFsFreezeMaxFrozen(t *testing.T) {
+	ft := newFsFreezeTest(t)
+	defer os.RemoveAll(ft.dir)
+	ctx, end := fsFreezeTestContext()
+	defer end()
+
+	h, err := hooks.FsFreezeFromConfig(&config.HookFsFreeze{
+		Mountpoints: []string{"/mnt/a"},
+		Command:     filepath.Join(ft.dir, "freeze"),
+		Timeout:     100 * time.Millisecond,
+		MaxFrozen:   200 * time.Millisecond,
+		Filesystems: config.FilesystemsFilter{"<": true},
+	})
+	require.NoError(t, err)
+	plan := ft.plan(t, h, func(ctx context.Context) error {
+		time.Sleep(time.Second) // a hung snapshot
+		return nil
+	})
+	plan.Run(ctx, false)
+	require.Equal(t, "-f /mnt/a\n-u /mnt/a\n", ft.invocations(t), "the timer thaws, the post-edge does not thaw again")
+	report := plan.Report()
+	require.True(t, report.HadError())
+	require.Contains(t, report[2].Report.Error(), "max_frozen")
+}
+
+func TestFsFreezeThawOnPanic(t *testing.T) {
+	ft := newFsFreezeTest(t)
+	defer os.RemoveAll(ft.dir)
+	ctx, end := fsFreezeTestContext()
+	defer end()
+
+	h, err := hooks.FsFreezeFromConfig(&config.HookFsFreeze{
+		Mountpoints: []string{"/mnt/a"},
+		Command:     filepath.Join(ft.dir, "freeze"),
+		Timeout:     10 * time.Second,
+		MaxFrozen:   time.Minute,
+		Filesystems: config.FilesystemsFilter{"<": true},
+	})
+	require.NoError(t, err)
+	plan := ft.plan(t, h, func(ctx context.Context) error { panic("snapshot panicked") })
+	require.PanicsWithValue(t, "snapshot panicked", func() { plan.Run(ctx, false) })
+	require.Equal(t, "-f /mnt/a\n-u /mnt/a\n", ft.invocations(t))
+}
@@ -0,0 +1,359 @@
+package hooks
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/filters"
+)
+
+// LibvirtFsFreeze freezes the filesystems of libvirt guests through the QEMU
+// guest agent (virsh domfsfreeze) while the snapshot is taken, and thaws them
+// afterwards (virsh domfsthaw), so that the snapshot of the guests' disks
+// contains clean filesystems.
+//
+// The guests are either configured explicitly or discovered: a running guest
+// is frozen if one of its disks is the zvol that is being snapshotted.
+// Like FsFreeze, frozen guests are thawed if freezing fails, after maxFrozen
+// and if the hook plan panics.
+type LibvirtFsFreeze struct {
+	errIsFatal  bool
+	filesystems Filter
+	virsh       string
+	uri         string
+	domains     []libvirtDomain // nil means discover
+	timeout     time.Duration
+	onFailure   libvirtOnFailure
+	maxFrozen   time.Duration
+}
+
+type libvirtDomain struct {
+	name      string
+	timeout   time.Duration
+	onFailure libvirtOnFailure
+}
+
+type libvirtOnFailure string
+
+const (
+	// The pre edge fails and the guests frozen so far are thawed.
+	libvirtOnFailureFail libvirtOnFailure = "fail"
+	// The failure is logged and the guest's disks are snapshotted crash-consistent.
+	libvirtOnFailureWarn libvirtOnFailure = "warn"
+)
+
+func libvirtOnFailureFromConfig(in string) (libvirtOnFailure, error) {
+	switch p := libvirtOnFailure(in); p {
+	case libvirtOnFailureFail, libvirtOnFailureWarn:
+		return p, nil
+	default:
+		return "", errors.Errorf("`on_failure` must be %q or %q, got %q", libvirtOnFailureFail, libvirtOnFailureWarn, in)
+	}
+}
+
+type libvirtFsFreezeStateKey int
+
+const (
+	libvirtFsFreezeFrozen libvirtFsFreezeStateKey = 1 + iota
+)
+
+func LibvirtFsFreezeFromConfig(in *config.HookLibvirtFsFreeze) (*LibvirtFsFreeze, error) {
+	if in.Virsh == "" {
+		return nil, errors.New("`virsh` must not be empty")
+	}
+	if in.URI == "" {
+		return nil, errors.New("`uri` must not be empty")
+	}
+	onFailure, err := libvirtOnFailureFromConfig(in.OnFailure)
+	if err != nil {
+		return nil, err
+	}
+	if in.Timeout >= in.MaxFrozen {
+		return nil, errors.Errorf("`max_frozen` (%s) must be greater than `timeout` (%s)", in.MaxFrozen, in.Timeout)
+	}
+
+	var domains []libvirtDomain
+	var sumTimeouts time.Duration
+	seen := make(map[string]bool, len(in.Domains))
+	for i, d := range in.Domains {
+		if d.Name == "" {
+			return nil, errors.Errorf("`domains`: entry #%d: `name` must not be empty", i+1)
+		}
+		if seen[d.Name] {
+			return nil, errors.Errorf("`domains`: %q is specified twice", d.Name)
+		}
+		seen[d.Name] = true
+		dom := libvirtDomain{name: d.Name, timeout: in.Timeout, onFailure: onFailure}
+		if d.Timeout != 0 {
+			dom.timeout = d.Timeout
+		}
+		if d.OnFailure != "" {
+			if dom.onFailure, err = libvirtOnFailureFromConfig(d.OnFailure); err != nil {
+				return nil, errors.Wrapf(err, "`domains`: %q", d.Name)
+			}
+		}
+		sumTimeouts += dom.timeout
+		domains = append(domains, dom)
+	}
+	if sumTimeouts >= in.MaxFrozen {
+		return nil, errors.Errorf("`max_frozen` (%s) must be greater than the sum of the timeouts of `domains` (%s)", in.MaxFrozen, sumTimeouts)
+	}
+
+	filesystems, err := filters.DatasetMapFilterFromConfig(in.Filesystems)
+	if err != nil {
+		return nil, errors.Wrap(err, "`filesystems` invalid")
+	}
+
+	return &LibvirtFsFreeze{
+		errIsFatal:  in.ErrIsFatal,
+		filesystems: filesystems,
+		virsh:       in.Virsh,
+		uri:         in.URI,
+		domains:     domains,
+		timeout:     in.Timeout,
+		onFailure:   onFailure,
+		maxFrozen:   in.MaxFrozen,
+	}, nil
+}
+
+func (h *LibvirtFsFreeze) ErrIsFatal() bool    { return h.errIsFatal }
+func (h *LibvirtFsFreeze) Filesystems() Filter { return h.filesystems }
+func (h *LibvirtFsFreeze) String() string {
+	if h.domains == nil {
+		return fmt.Sprintf("libvirt fsfreeze of guests on snapshotted zvol (%s)", h.uri)
+	}
+	names := make([]string, len(h.domains))
+	for i, d := range h.domains {
+		names[i] = d.name
+	}
+	return fmt.Sprintf("libvirt fsfreeze of %s (%s)", strings.Join(names, " "), h.uri)
+}
+
+type LibvirtFsFreezeReport struct {
+	What     string
+	Warnings []string // failures of domains with on_failure=warn
+	Err      error
+}
+
+func (r *LibvirtFsFreezeReport) HadError() bool { return r.Err != nil }
+func (r *LibvirtFsFreezeReport) Error() string  { return r.String() }
+func (r *LibvirtFsFreezeReport) String() string {
+	var s strings.Builder
+	s.WriteString(r.What)
+	for _, w := range r.Warnings {
+		fmt.Fprintf(&s, " (warning: %s)", w)
+	}
+	if r.Err != nil {
+		fmt.Fprintf(&s, ": %s", r.Err)
+	}
+	return s.String()
+}
+
+func (h *LibvirtFsFreeze) Run(ctx context.Context, edge Edge, phase Phase, dryRun bool, extra Env, state map[interface{}]interface{}) HookReport {
+	if phase != PhaseSnapshot {
+		return &LibvirtFsFreezeReport{What: fmt.Sprintf("skipped, only applies to phase %s", PhaseSnapshot)}
+	}
+	fs, ok := extra[EnvFS]
+	if !ok {
+		panic(extra)
+	}
+	switch edge {
+	case Pre:
+		return h.freeze(ctx, fs, dryRun, state)
+	case Post:
+		if dryRun {
+			return &LibvirtFsFreezeReport{What: "dry run, not thawing"}
+		}
+		f, ok := state[libvirtFsFreezeFrozen].(*frozenSet)
+		if !ok {
+			return &LibvirtFsFreezeReport{What: "nothing to thaw"}
+		}
+		return &LibvirtFsFreezeReport{What: "thaw", Err: f.thawPost()}
+	}
+	return &LibvirtFsFreezeReport{What: "skipped this edge"}
+}
+
+// CleanupAfterPanic implements PanicCleanupHook.
+func (h *LibvirtFsFreeze) CleanupAfterPanic(ctx context.Context, state map[interface{}]interface{}) {
+	if f, ok := state[libvirtFsFreezeFrozen].(*frozenSet); ok {
+		f.thawAfterPanic()
+	}
+}
+
+func (h *LibvirtFsFreeze) freeze(ctx context.Context, fs string, dryRun bool, state map[interface{}]interface{}) *LibvirtFsFreezeReport {
+	log := getLogger(ctx).WithField("hook", h.String())
+
+	domains := h.domains
+	if domains == nil {
+		var err error
+		if domains, err = h.discover(ctx, fs); err != nil {
+			return &LibvirtFsFreezeReport{What: "discover guests", Err: err}
+		}
+	}
+	names := make([]string, len(domains))
+	byName := make(map[string]libvirtDomain, len(domains))
+	for i, d := range domains {
+		names[i] = d.name
+		byName[d.name] = d
+	}
+	if len(domains) == 0 {
+		log.WithField("fs", fs).Debug("no guests to freeze")
+		return &LibvirtFsFreezeReport{What: "no guests to freeze"}
+	}
+	if dryRun {
+		return &LibvirtFsFreezeReport{What: fmt.Sprintf("dry run, not freezing %s", strings.Join(names, " "))}
+	}
+
+	report := &LibvirtFsFreezeReport{What: fmt.Sprintf("freeze %s", strings.Join(names, " "))}
+	f := newFrozenSet(log, "domain", h.maxFrozen, func(name string) error {
+		return h.run(context.Background(), byName[name].timeout, "domfsthaw", name)
+	})
+	state[libvirtFsFreezeFrozen] = f
+	defer f.thawOnPanic()
+
+	// The guests must not stay frozen for longer than max_frozen in total.
+	// For configured guests, this is checked at config time, but discovered guests
+	// all have the default timeout and their number is only known now.
+	begin := time.Now()
+	for _, d := range domains {
+		l := log.WithField("domain", d.name)
+		if time.Since(begin)+d.timeout >= h.maxFrozen {
+			err := errors.Errorf("not freezing %s, its timeout (%s) would exceed max_frozen (%s) for the guests frozen before", d.name, d.timeout, h.maxFrozen)
+			switch d.onFailure {
+			case libvirtOnFailureWarn:
+				l.WithError(err).Warn("not freezing guest, its disks are snapshotted crash-consistent")
+				report.Warnings = append(report.Warnings, err.Error())
+				continue
+			case libvirtOnFailureFail:
+				if terr := f.thaw("max_frozen exceeded while freezing"); terr != nil {
+					l.WithError(terr).Error("cannot thaw after refusing to freeze")
+				}
+				report.Err = err
+				return report
+			default:
+				panic(fmt.Sprintf("unknown on_failure policy %q", d.onFailure))
+			}
+		}
+		l.Debug("freeze")
+		err := h.run(ctx, d.timeout, "domfsfreeze", d.name)
+		if err == nil {
+			f.add(d.name)
+			continue
+		}
+		// the guest agent might have frozen some of the guest's filesystems before it failed or timed out
+		switch d.onFailure {
+		case libvirtOnFailureWarn:
+			l.WithError(err).Warn("cannot freeze guest, its disks are snapshotted crash-consistent")
+			report.Warnings = append(report.Warnings, err.Error())
+			if terr := h.run(context.Background(), d.timeout, "domfsthaw", d.name); terr != nil {
+				l.WithError(terr).Warn("cannot thaw guest after failed freeze")
+			}
+		case libvirtOnFailureFail:
+			f.add(d.name)
+			if terr := f.thaw("freezing failed"); terr != nil {
+				l.WithError(terr).Error("cannot thaw after failed freeze")
+			}
+			report.Err = err
+			return report
+		default:
+			panic(fmt.Sprintf("unknown on_failure policy %q", d.onFailure))
+		}
+	}
+
+	f.armTimer(h.maxFrozen - time.Since(begin))
+	return report
+}
+
+// discover returns the running domains that have a disk whose source is the zvol fs.
+// Disk image files are not discovered, such domains must be configured explicitly.
+func (h *LibvirtFsFreeze) discover(ctx context.Context, fs string) ([]libvirtDomain, error) {
+	zvol := filepath.Join("/dev/zvol", fs)
+	targets := map[string]bool{zvol: true}
+	if dev, err := filepath.EvalSymlinks(zvol); err == nil {
+		targets[dev] = true // e.g. /dev/zd0 on Linux
+	}
+
+	out, err := h.output(ctx, h.timeout, "list", "--name")
+	if err != nil {
+		return nil, err
+	}
+	var domains []libvirtDomain
+	for _, name := range strings.Split(out, "\n") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		blklist, err := h.output(ctx, h.timeout, "domblklist", "--details", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, src := range parseDomblklistDiskSources(blklist) {
+			resolved, _ := filepath.EvalSymlinks(src)
+			if targets[src] || targets[resolved] {
+				domains = append(domains, libvirtDomain{name: name, timeout: h.timeout, onFailure: h.onFailure})
+				break
+			}
+		}
+	}
+	return domains, nil
+}
+
+// parseDomblklistDiskSources returns the sources of the disks in the output
+// of virsh domblklist --details, which looks as follows:
+//
+//	 Type   Device   Target   Source
+//	------------------------------------------------
+//	 block  disk     vda      /dev/zvol/tank/vm1
+//	 file   cdrom    sda      -
+func parseDomblklistDiskSources(out string) (sources []string) {
+	s := bufio.NewScanner(strings.NewReader(out))
+	header := true
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if header {
+			header = !strings.HasPrefix(line, "---")
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[1] != "disk" {
+			continue
+		}
+		src := strings.Join(fields[3:], " ")
+		if src != "-" {
+			sources = append(sources, src)
+		}
+	}
+	return sources
+}
+
+func (h *LibvirtFsFreeze) run(ctx context.Context, timeout time.Duration, args ...string) error {
+	_, err := h.output(ctx, timeout, args...)
+	return err
+}
+
+// output runs virsh with args, killing it after timeout.
+func (h *LibvirtFsFreeze) output(ctx context.Context, timeout time.Duration, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	args = append([]string{"-c", h.uri}, args...)
+	var stderr strings.Builder
+	cmd := exec.CommandContext(ctx, h.virsh, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	cmdLine := strings.Join(append([]string{h.virsh}, args...), " ")
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", errors.Errorf("%s timed out after %s", cmdLine, timeout)
+	}
+	if err != nil {
+		return "", errors.Errorf("%s: %s: %s", cmdLine, err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
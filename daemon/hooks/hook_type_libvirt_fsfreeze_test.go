@@ -0,0 +1,164 @@
+package hooks_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/hooks"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// The fake virsh logs domfsfreeze and domfsthaw invocations, fails to freeze
+// domains named fail*, takes half a second to freeze domains named slow*, and has
+// the running domains vm1 and vm3 on zvol pool/vm1, vm2 on zvol pool/vm2 and
+// slow1 and slow2 on zvol pool/slow.
+const fakeVirsh = `#!/bin/sh
+[ "$1" = "-c" ] || exit 2
+shift 2
+blklist() {
+	printf ' Type   Device   Target   Source\n------------------------------------------------\n'
+	printf ' block  disk     vda      %%s\n file   cdrom    sda      -\n' "$1"
+}
+case "$1" in
+list) printf 'vm1\nvm2\nvm3\nslow1\nslow2\n\n';;
+domblklist)
+	case "$3" in
+	vm1|vm3) blklist /dev/zvol/pool/vm1;;
+	vm2) blklist /dev/zvol/pool/vm2;;
+	slow1|slow2) blklist /dev/zvol/pool/slow;;
+	*) exit 1;;
+	esac;;
+domfsfreeze|domfsthaw)
+	echo "$1 $2" >> %s
+	case "$1 $2" in
+	"domfsfreeze fail"*) exit 1;;
+	"domfsfreeze slow"*) sleep 0.5;;
+	esac;;
+*) exit 1;;
+esac
+`
+
+func newLibvirtFsFreezeTest(t *testing.T) *fsFreezeTest {
+	dir, err := ioutil.TempDir("", "zrepl-libvirt-fsfreeze-hook-test")
+	require.NoError(t, err)
+	ft := &fsFreezeTest{dir: dir, log: filepath.Join(dir, "log")}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "virsh"), []byte(fmt.Sprintf(fakeVirsh, ft.log)), 0755))
+	return ft
+}
+
+func (ft *fsFreezeTest) libvirtConfig(domains ...*config.HookLibvirtDomain) *config.HookLibvirtFsFreeze {
+	return &config.HookLibvirtFsFreeze{
+		HookSettingsCommon: config.HookSettingsCommon{Type: "libvirt-fsfreeze", ErrIsFatal: true},
+		URI:                "qemu:///system",
+		Virsh:              filepath.Join(ft.dir, "virsh"),
+		Domains:            domains,
+		Timeout:            10 * time.Second,
+		OnFailure:          "fail",
+		MaxFrozen:          time.Minute,
+		Filesystems:        config.FilesystemsFilter{"<": true},
+	}
+}
+
+func TestLibvirtFsFreezeFromConfig(t *testing.T) {
+	ft := &fsFreezeTest{dir: "/nonexistent"}
+	_, err := hooks.LibvirtFsFreezeFromConfig(ft.libvirtConfig())
+	require.NoError(t, err)
+
+	c := ft.libvirtConfig()
+	c.OnFailure = "ignore"
+	_, err = hooks.LibvirtFsFreezeFromConfig(c)
+	require.Error(t, err)
+
+	_, err = hooks.LibvirtFsFreezeFromConfig(ft.libvirtConfig(&config.HookLibvirtDomain{Name: "vm1", OnFailure: "ignore"}))
+	require.Error(t, err, "per-domain policy is validated")
+
+	_, err = hooks.LibvirtFsFreezeFromConfig(ft.libvirtConfig(&config.HookLibvirtDomain{Name: "vm1"}, &config.HookLibvirtDomain{Name: "vm1"}))
+	require.Error(t, err, "duplicate domain")
+
+	_, err = hooks.LibvirtFsFreezeFromConfig(ft.libvirtConfig(&config.HookLibvirtDomain{Name: "vm1", Timeout: 30 * time.Second}, &config.HookLibvirtDomain{Name: "vm2", Timeout: 30 * time.Second}))
+	require.Error(t, err, "timeouts exceed max_frozen")
+}
+
+func TestLibvirtFsFreezeDiscovery(t *testing.T) {
+	ft := newLibvirtFsFreezeTest(t)
+	defer os.RemoveAll(ft.dir)
+	ctx, end := fsFreezeTestContext()
+	defer end()
+
+	h, err := hooks.LibvirtFsFreezeFromConfig(ft.libvirtConfig())
+	require.NoError(t, err)
+	fs, err := zfs.NewDatasetPath("pool/vm1")
+	require.NoError(t, err)
+	plan, err := hooks.NewPlan(&hooks.List{h}, hooks.PhaseSnapshot, hooks.NewCallbackHookForFilesystem("snapshot", fs, func(ctx context.Context) error { return nil }), hooks.Env{hooks.EnvFS: fs.ToString()})
+	require.NoError(t, err)
+	plan.Run(ctx, false)
+	require.False(t, plan.Report().HadError(), "%s", plan.Report())
+	require.Equal(t, "domfsfreeze vm1\ndomfsfreeze vm3\ndomfsthaw vm3\ndomfsthaw vm1\n", ft.invocations(t))
+}
+
+func TestLibvirtFsFreezeDiscoveryBoundsFreezeTime(t *testing.T) {
+	ft := newLibvirtFsFreezeTest(t)
+	defer os.RemoveAll(ft.dir)
+	ctx, end := fsFreezeTestContext()
+	defer end()
+
+	// freezing slow2 would start after half a second and might take another second
+	c := ft.libvirtConfig()
+	c.Timeout = time.Second
+	c.MaxFrozen = 1400 * time.Millisecond
+	h, err := hooks.LibvirtFsFreezeFromConfig(c)
+	require.NoError(t, err)
+	fs, err := zfs.NewDatasetPath("pool/slow")
+	require.NoError(t, err)
+	plan, err := hooks.NewPlan(&hooks.List{h}, hooks.PhaseSnapshot, hooks.NewCallbackHookForFilesystem("snapshot", fs, func(ctx context.Context) error { return nil }), hooks.Env{hooks.EnvFS: fs.ToString()})
+	require.NoError(t, err)
+	plan.Run(ctx, false)
+	require.True(t, plan.Report().HadFatalError())
+	require.Contains(t, plan.Report()[0].Report.String(), "max_frozen")
+	require.Equal(t, "domfsfreeze slow1\ndomfsthaw slow1\n", ft.invocations(t))
+}
+
+func TestLibvirtFsFreezeOnFailure(t *testing.T) {
+	ctx, end := fsFreezeTestContext()
+	defer end()
+
+	t.Run("warn", func(t *testing.T) {
+		ft := newLibvirtFsFreezeTest(t)
+		defer os.RemoveAll(ft.dir)
+		h, err := hooks.LibvirtFsFreezeFromConfig(ft.libvirtConfig(
+			&config.HookLibvirtDomain{Name: "vm1"},
+			&config.HookLibvirtDomain{Name: "fail-noagent", OnFailure: "warn"},
+			&config.HookLibvirtDomain{Name: "vm2"},
+		))
+		require.NoError(t, err)
+		plan := ft.plan(t, h, func(ctx context.Context) error { return nil })
+		plan.Run(ctx, false)
+		report := plan.Report()
+		require.False(t, report.HadError())
+		require.Contains(t, report[0].Report.String(), "warning")
+		require.Equal(t, "domfsfreeze vm1\ndomfsfreeze fail-noagent\ndomfsthaw fail-noagent\ndomfsfreeze vm2\ndomfsthaw vm2\ndomfsthaw vm1\n", ft.invocations(t))
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		ft := newLibvirtFsFreezeTest(t)
+		defer os.RemoveAll(ft.dir)
+		h, err := hooks.LibvirtFsFreezeFromConfig(ft.libvirtConfig(
+			&config.HookLibvirtDomain{Name: "vm1"},
+			&config.HookLibvirtDomain{Name: "fail-noagent"},
+			&config.HookLibvirtDomain{Name: "vm2"},
+		))
+		require.NoError(t, err)
+		plan := ft.plan(t, h, func(ctx context.Context) error { return nil })
+		plan.Run(ctx, false)
+		require.True(t, plan.Report().HadFatalError())
+		require.Equal(t, "domfsfreeze vm1\ndomfsfreeze fail-noagent\ndomfsthaw fail-noagent\ndomfsthaw vm1\n", ft.invocations(t))
+	})
+}
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"regexp"
+	"strings"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -40,6 +43,7 @@ type testCase struct {
 	ExpectHadFatalErr     bool
 	ExpectHadError        bool
 	ExpectStepReports     []expectStep
+	ExpectMaxDuration     time.Duration // zero means no limit
 }
 
 func curryLeft(f comparisonAssertionFunc, expected interface{}) valueAssertionFunc {
@@ -132,6 +136,26 @@ jobs:
 				},
 			},
 		},
+		testCase{
+			Name:              "timeout_kills_process_group",
+			IsSlow:            true,
+			ExpectHadError:    true,
+			ExpectMaxDuration: 10 * time.Second,
+			Config:            []string{`{type: command, path: {{.WorkDir}}/test/test-timeout-child.sh, timeout: 2s}`},
+			ExpectStepReports: []expectStep{
+				expectStep{
+					ExpectedEdge: hooks.Pre,
+					ExpectStatus: hooks.StepErr,
+					OutputTest:   containsTest(fmt.Sprintf("TEST pre_testing %s@%s ZREPL_TIMEOUT=2", testFSName, testSnapshotName)),
+					ErrorTest:    regexpTest(`TIMED OUT FAILED with error: timed out after 2(.\d+)?s, killed process group`),
+				},
+				expectStep{ExpectedEdge: hooks.Callback, ExpectStatus: hooks.StepOk},
+				expectStep{
+					ExpectedEdge: hooks.Post,
+					ExpectStatus: hooks.StepSkippedDueToPreErr,
+				},
+			},
+		},
 		testCase{
 			Name:           "check_env",
 			Config:         []string{`{type: command, path: {{.WorkDir}}/test/test-report-env.sh}`},
@@ -427,7 +451,9 @@ jobs:
 			if testing.Verbose() && !tt.SuppressOutput {
 				ctx = logging.WithLoggers(ctx, logging.SubsystemLoggersWithUniversalLogger(log))
 			}
+			runStart := time.Now()
 			plan.Run(ctx, false)
+			runDuration := time.Since(runStart)
 			report := plan.Report()
 
 			t.Logf("REPORT POST EXECUTION:\n%s", report)
@@ -436,6 +462,10 @@ jobs:
 			 * TEST ASSERTIONS
 			 */
 
+			if tt.ExpectMaxDuration != 0 {
+				require.True(t, runDuration < tt.ExpectMaxDuration, "plan ran for %s, expected less than %s", runDuration, tt.ExpectMaxDuration)
+			}
+
 			t.Logf("len(runReports)=%v", len(report))
 			t.Logf("len(tt.ExpectStepReports)=%v", len(tt.ExpectStepReports))
 			require.Equal(t, len(tt.ExpectStepReports), len(report), "ExpectStepReports must be same length as expected number of hook runs, excluding possible Callback")
@@ -487,3 +517,94 @@ jobs:
 		})
 	}
 }
+
+func TestListFromConfigOrder(t *testing.T) {
+	cmd := func(path string, order int) config.HookEnum {
+		return config.HookEnum{Ret: &config.HookCommand{
+			Path:               path,
+			Filesystems:        config.FilesystemsFilter{"<": true},
+			HookSettingsCommon: config.HookSettingsCommon{Type: "command", Order: order},
+		}}
+	}
+	in := config.HookList{
+		cmd("/bin/a", 10),
+		cmd("/bin/b", 0),
+		cmd("/bin/c", -5),
+		cmd("/bin/d", 0),
+	}
+	l, err := hooks.ListFromConfig(&in)
+	require.NoError(t, err)
+
+	var paths []string
+	for _, h := range *l {
+		paths = append(paths, h.String())
+	}
+	require.Equal(t, []string{"/bin/c", "/bin/b", "/bin/d", "/bin/a"}, paths, "ties must keep configuration order")
+}
+
+func TestPlanReportFailures(t *testing.T) {
+	h, err := hooks.NewCommandHook(&config.HookCommand{Path: "/bin/false", Filesystems: config.FilesystemsFilter{"<": true}})
+	require.NoError(t, err)
+
+	largeOutput := bytes.Repeat([]byte("x"), hooks.MAX_HOOK_REPORT_OUTPUT_SIZE_DEFAULT+1)
+	largeOutput[len(largeOutput)-1] = 'y'
+
+	report := hooks.PlanReport{
+		{Hook: h, Edge: hooks.Pre, Status: hooks.StepOk, Report: &hooks.CommandHookReport{CapturedStdoutStderrCombined: []byte("ok")}},
+		{Hook: h, Edge: hooks.Pre, Status: hooks.StepErr, Report: &hooks.CommandHookReport{Err: fmt.Errorf("exit status 1"), CapturedStdoutStderrCombined: []byte("some error\n")}},
+		{Hook: h, Edge: hooks.Post, Status: hooks.StepErr, Report: &hooks.CommandHookReport{Err: fmt.Errorf("exit status 2"), CapturedStdoutStderrCombined: largeOutput}},
+	}
+	failures := report.Failures()
+	require.Len(t, failures, 2)
+
+	require.Equal(t, 2, failures[0].Step)
+	require.Equal(t, "/bin/false", failures[0].Hook)
+	require.Contains(t, failures[0].Error, "exit status 1")
+	require.Equal(t, "some error\n", failures[0].Output)
+	require.False(t, failures[0].OutputTruncated)
+
+	require.Equal(t, 3, failures[1].Step)
+	require.True(t, failures[1].OutputTruncated)
+	require.Len(t, failures[1].Output, hooks.MAX_HOOK_REPORT_OUTPUT_SIZE_DEFAULT)
+	require.True(t, strings.HasSuffix(failures[1].Output, "y"), "the tail of the output is kept")
+}
+
+func TestPostRecv(t *testing.T) {
+	p, err := hooks.PostRecvFromConfig(nil)
+	require.NoError(t, err)
+	require.Nil(t, p)
+
+	_, err = hooks.PostRecvFromConfig(config.HookList{{Ret: &config.HookPostgresCheckpoint{}}})
+	require.Error(t, err, "only command hooks make sense after a receive")
+
+	dir, err := ioutil.TempDir("", "zrepl-post-recv-hook-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	out := dir + "/env"
+	script := dir + "/hook.sh"
+	require.NoError(t, ioutil.WriteFile(script, []byte(fmt.Sprintf("#!/bin/sh\necho \"$ZREPL_HOOKTYPE $ZREPL_FS $ZREPL_SNAPNAME\" >> %s\n", out)), 0755))
+	cmd := func(filter config.FilesystemsFilter) config.HookEnum {
+		return config.HookEnum{Ret: &config.HookCommand{
+			Path:               script,
+			Timeout:            10 * time.Second,
+			Filesystems:        filter,
+			HookSettingsCommon: config.HookSettingsCommon{Type: "command"},
+		}}
+	}
+	p, err = hooks.PostRecvFromConfig(config.HookList{
+		cmd(config.FilesystemsFilter{"<": true}),
+		cmd(config.FilesystemsFilter{"pool/sink/other<": true}),
+	})
+	require.NoError(t, err)
+
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	defer end()
+	ctx = logging.WithLoggers(ctx, logging.SubsystemLoggersWithUniversalLogger(logger.NewNullLogger()))
+	fs, err := zfs.NewDatasetPath("pool/sink/client/a")
+	require.NoError(t, err)
+	p.RunPostRecv(ctx, fs, zfs.FilesystemVersion{Type: zfs.Snapshot, Name: "zrepl_1"})
+
+	env, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "post_receive pool/sink/client/a zrepl_1\n", string(env), "only the matching hook runs")
+}
@@ -0,0 +1,7 @@
+#!/bin/sh -eu
+
+echo "TEST $ZREPL_HOOKTYPE $ZREPL_FS@$ZREPL_SNAPNAME ZREPL_TIMEOUT=$ZREPL_TIMEOUT"
+
+# the child inherits stdout and would keep the hook alive if only this shell was killed
+sleep $(($ZREPL_TIMEOUT + 60)) &
+wait
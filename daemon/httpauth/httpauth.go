@@ -0,0 +1,161 @@
+// Package httpauth implements the static bearer tokens of the prometheus monitoring job's
+// web UI and API (`tokens`).
+package httpauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+type Scope string
+
+const (
+	// The web UI and the read-only endpoints of the API.
+	ScopeRead Scope = "read"
+	// The API's signal endpoint.
+	ScopeSignal Scope = "signal"
+)
+
+func ScopeFromConfig(in string) (Scope, error) {
+	switch s := Scope(in); s {
+	case ScopeRead, ScopeSignal:
+		return s, nil
+	default:
+		return "", errors.Errorf("%q is not in read, signal", in)
+	}
+}
+
+// Tokens too short to withstand guessing are rejected.
+const MinTokenLength = 16
+
+type token struct {
+	name   string
+	token  []byte
+	scopes map[Scope]bool
+}
+
+// Tokens authorizes requests that carry one of the configured tokens.
+// A nil *Tokens authorizes all requests.
+type Tokens struct {
+	tokens []*token
+}
+
+// TokensFromConfig returns nil if in is empty.
+func TokensFromConfig(in []config.MonitoringToken) (*Tokens, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	t := &Tokens{}
+	names := make(map[string]bool, len(in))
+	for i, c := range in {
+		if c.Name == "" {
+			return nil, errors.Errorf("token #%d: name must not be empty", i+1)
+		}
+		if names[c.Name] {
+			return nil, errors.Errorf("token %q: name is not unique", c.Name)
+		}
+		names[c.Name] = true
+		if len(c.Token) < MinTokenLength {
+			return nil, errors.Errorf("token %q: token must be at least %d characters long", c.Name, MinTokenLength)
+		}
+		for _, o := range t.tokens {
+			if string(o.token) == c.Token {
+				return nil, errors.Errorf("token %q: token is identical to token %q", c.Name, o.name)
+			}
+		}
+		if len(c.Scopes) == 0 {
+			return nil, errors.Errorf("token %q: scopes must not be empty", c.Name)
+		}
+		scopes := make(map[Scope]bool, len(c.Scopes))
+		for _, s := range c.Scopes {
+			scope, err := ScopeFromConfig(s)
+			if err != nil {
+				return nil, errors.Wrapf(err, "token %q: invalid scope", c.Name)
+			}
+			scopes[scope] = true
+		}
+		t.tokens = append(t.tokens, &token{name: c.Name, token: []byte(c.Token), scopes: scopes})
+	}
+	return t, nil
+}
+
+// requestToken returns the token of the request's Authorization header,
+// either as a bearer token or, if basic is set, as the password of basic authentication (for browsers).
+func requestToken(r *http.Request, basic bool) (string, bool) {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password, basic
+	}
+	const bearer = "Bearer "
+	h := r.Header.Get("Authorization")
+	if len(h) > len(bearer) && strings.EqualFold(h[:len(bearer)], bearer) {
+		return strings.TrimSpace(h[len(bearer):]), true
+	}
+	return "", false
+}
+
+// authorize returns the name of the token presented in r, and whether the token has scope.
+// It compares against all tokens in constant time to not leak how much of a token is correct.
+//
+// ScopeSignal only accepts bearer tokens: browsers cache the basic authentication credentials
+// of the web UI and would attach them to cross-site requests to the signal endpoint.
+func (t *Tokens) authorize(r *http.Request, scope Scope) (name string, authenticated, authorized bool) {
+	presented, ok := requestToken(r, scope != ScopeSignal)
+	if !ok {
+		return "", false, false
+	}
+	var match *token
+	for _, tok := range t.tokens {
+		if subtle.ConstantTimeCompare([]byte(presented), tok.token) == 1 {
+			match = tok
+		}
+	}
+	if match == nil {
+		return "", false, false
+	}
+	return match.name, true, match.scopes[scope]
+}
+
+// Require returns a handler that serves h if the request carries a token with scope,
+// and responds with 401 (no or unknown token) or 403 (insufficient scope) otherwise.
+// If t is nil, it returns h.
+// The name of the token is available to h through TokenName.
+// basic selects the challenge of 401 responses: a browser prompts for credentials if it is set.
+func (t *Tokens) Require(scope Scope, basic bool, h http.Handler) http.Handler {
+	if t == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, authenticated, authorized := t.authorize(r, scope)
+		if !authenticated {
+			if basic {
+				w.Header().Set("WWW-Authenticate", `Basic realm="zrepl"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="zrepl"`)
+			}
+			http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+			return
+		}
+		if !authorized {
+			http.Error(w, fmt.Sprintf("token %q lacks scope %q", name, scope), http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKeyTokenName, name)))
+	})
+}
+
+type contextKey int
+
+const contextKeyTokenName contextKey = 1 + iota
+
+// TokenName returns the name of the token that Require authorized r with, empty if r was not authorized by Require.
+func TokenName(r *http.Request) string {
+	name, _ := r.Context().Value(contextKeyTokenName).(string)
+	return name
+}
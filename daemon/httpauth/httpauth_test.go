@@ -0,0 +1,102 @@
+package httpauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+const (
+	readToken   = "read-0123456789abcdef"
+	signalToken = "signal-0123456789abcdef"
+)
+
+func TestTokensFromConfig(t *testing.T) {
+	tokens, err := TokensFromConfig(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, tokens)
+
+	valid := config.MonitoringToken{Name: "dashboard", Token: readToken, Scopes: []string{"read"}}
+	_, err = TokensFromConfig([]config.MonitoringToken{valid})
+	assert.NoError(t, err)
+
+	invalid := map[string][]config.MonitoringToken{
+		"no_name":         {{Token: readToken, Scopes: []string{"read"}}},
+		"short":           {{Name: "a", Token: "short", Scopes: []string{"read"}}},
+		"no_scopes":       {{Name: "a", Token: readToken}},
+		"invalid_scope":   {{Name: "a", Token: readToken, Scopes: []string{"write"}}},
+		"duplicate_name":  {valid, {Name: "dashboard", Token: signalToken, Scopes: []string{"read"}}},
+		"duplicate_token": {valid, {Name: "other", Token: readToken, Scopes: []string{"signal"}}},
+	}
+	for name, in := range invalid {
+		_, err := TokensFromConfig(in)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	tokens, err := TokensFromConfig([]config.MonitoringToken{
+		{Name: "dashboard", Token: readToken, Scopes: []string{"read"}},
+		{Name: "automation", Token: signalToken, Scopes: []string{"read", "signal"}},
+	})
+	require.NoError(t, err)
+
+	var servedName string
+	h := tokens.Require(ScopeSignal, false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		servedName = TokenName(r)
+	}))
+	do := func(h http.Handler, setAuth func(r *http.Request)) *httptest.ResponseRecorder {
+		servedName = ""
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if setAuth != nil {
+			setAuth(r)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	bearer := func(token string) func(r *http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+
+	w := do(h, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer realm="zrepl"`, w.Header().Get("WWW-Authenticate"))
+
+	w = do(h, bearer("wrong-0123456789abcdef"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = do(h, bearer(readToken))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, servedName)
+
+	w = do(h, bearer(signalToken))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "automation", servedName)
+
+	// browsers use basic authentication, with the token as password
+	basic := tokens.Require(ScopeRead, true, h)
+	w = do(basic, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Basic realm="zrepl"`, w.Header().Get("WWW-Authenticate"))
+	w = do(tokens.Require(ScopeRead, true, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		servedName = TokenName(r)
+	})), func(r *http.Request) { r.SetBasicAuth("anyuser", readToken) })
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "dashboard", servedName)
+
+	// basic authentication is not accepted for the signal scope (cross-site requests from browsers)
+	w = do(h, func(r *http.Request) { r.SetBasicAuth("anyuser", signalToken) })
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, servedName)
+
+	// no tokens configured
+	var none *Tokens
+	w = do(none.Require(ScopeSignal, false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
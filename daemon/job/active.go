@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/log"
@@ -13,8 +14,10 @@ import (
 	"github.com/zrepl/zrepl/daemon/logging/trace"
 
 	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/history"
 	"github.com/zrepl/zrepl/daemon/job/reset"
 	"github.com/zrepl/zrepl/daemon/job/wakeup"
+	"github.com/zrepl/zrepl/daemon/logging"
 	"github.com/zrepl/zrepl/daemon/pruner"
 	"github.com/zrepl/zrepl/daemon/snapper"
 	"github.com/zrepl/zrepl/endpoint"
@@ -23,15 +26,23 @@ import (
 	"github.com/zrepl/zrepl/replication/logic"
 	"github.com/zrepl/zrepl/replication/report"
 	"github.com/zrepl/zrepl/rpc"
+	"github.com/zrepl/zrepl/rpc/dataconn/stream"
+	"github.com/zrepl/zrepl/streamarchive"
 	"github.com/zrepl/zrepl/transport"
 	"github.com/zrepl/zrepl/transport/fromconfig"
 	"github.com/zrepl/zrepl/zfs"
+	"github.com/zrepl/zrepl/zfs/zfscmd"
 )
 
 type ActiveSide struct {
 	mode      activeMode
 	name      endpoint.JobID
 	connecter transport.Connecter
+	// configured transport type, for metric labels
+	transportType string
+	chunkSize     stream.ChunkSizeLimits
+	// configured peer, for the replication history
+	peerName string
 
 	prunerFactory *pruner.PrunerFactory
 
@@ -39,6 +50,13 @@ type ActiveSide struct {
 	promPruneSecs         *prometheus.HistogramVec // labels: prune_side
 	promBytesReplicated   *prometheus.CounterVec   // labels: filesystem
 	promReplicationErrors prometheus.Gauge
+	rpo                   *rpoCollector
+	delta                 deltaTracker
+
+	zfsCmdPriority *zfscmd.Priority // may be nil
+
+	// maximum duration of an invocation, 0 means no limit
+	timeout time.Duration
 
 	tasksMtx sync.Mutex
 	tasks    activeSideTasks
@@ -66,6 +84,9 @@ type activeSideTasks struct {
 
 	// valid for state ActiveSidePruneReceiver, ActiveSideDone
 	prunerSenderCancel, prunerReceiverCancel context.CancelFunc
+
+	// set if the invocation was aborted because it exceeded the job's timeout
+	invocationErr string
 }
 
 func (a *ActiveSide) updateTasks(u func(*activeSideTasks)) activeSideTasks {
@@ -95,9 +116,12 @@ type modePush struct {
 	setupMtx      sync.Mutex
 	sender        *endpoint.Sender
 	receiver      *rpc.Client
+	archive       *streamarchive.Receiver // non-nil if the job exports to a stream archive
 	senderConfig  *endpoint.SenderConfig
 	plannerPolicy *logic.PlannerPolicy
 	snapper       *snapper.PeriodicOrManual
+	// the receiver's versions known from previous invocations
+	receiverVersions *rpc.VersionsCache
 }
 
 func (m *modePush) ConnectEndpoints(ctx context.Context, connecter transport.Connecter) {
@@ -107,13 +131,18 @@ func (m *modePush) ConnectEndpoints(ctx context.Context, connecter transport.Con
 		panic("inconsistent use of ConnectEndpoints and DisconnectEndpoints")
 	}
 	m.sender = endpoint.NewSender(*m.senderConfig)
-	m.receiver = rpc.NewClient(connecter, rpc.GetLoggersOrPanic(ctx))
+	if m.archive == nil {
+		m.receiver = rpc.NewClient(connecter, rpc.GetLoggersOrPanic(ctx))
+		m.receiver.SetVersionsCache(m.receiverVersions)
+	}
 }
 
 func (m *modePush) DisconnectEndpoints() {
 	m.setupMtx.Lock()
 	defer m.setupMtx.Unlock()
-	m.receiver.Close()
+	if m.receiver != nil {
+		m.receiver.Close()
+	}
 	m.sender = nil
 	m.receiver = nil
 }
@@ -121,7 +150,14 @@ func (m *modePush) DisconnectEndpoints() {
 func (m *modePush) SenderReceiver() (logic.Sender, logic.Receiver) {
 	m.setupMtx.Lock()
 	defer m.setupMtx.Unlock()
-	return m.sender, m.receiver
+	var sender logic.Sender = m.sender
+	if m.senderConfig.ReadOnly {
+		sender = endpoint.ReadOnlySender{Sender: m.sender}
+	}
+	if m.archive != nil {
+		return sender, m.archive
+	}
+	return sender, m.receiver
 }
 
 func (m *modePush) Type() Type { return TypePush }
@@ -145,14 +181,19 @@ func (m *modePush) ResetConnectBackoff() {
 }
 
 func modePushFromConfig(g *config.Global, in *config.PushJob, jobID endpoint.JobID) (*modePush, error) {
-	m := &modePush{}
+	m := &modePush{receiverVersions: rpc.NewVersionsCache()}
 	var err error
 
 	m.senderConfig, err = buildSenderConfig(in, jobID)
 	if err != nil {
 		return nil, errors.Wrap(err, "sender config")
 	}
-
+	if err := checkExternallyManagedSnapshotting(in.Send, in.Snapshotting); err != nil {
+		return nil, err
+	}
+	if err := checkBookmarksOnlyPruning(in.Send, in.Pruning); err != nil {
+		return nil, err
+	}
 	replicationConfig, err := logic.ReplicationConfigFromConfig(in.Replication)
 	if err != nil {
 		return nil, errors.Wrap(err, "field `replication`")
@@ -161,12 +202,44 @@ func modePushFromConfig(g *config.Global, in *config.PushJob, jobID endpoint.Job
 	m.plannerPolicy = &logic.PlannerPolicy{
 		EncryptedSend:     logic.TriFromBool(in.Send.Encrypted),
 		ReplicationConfig: *replicationConfig,
+		Verify:            in.Replication.Verify,
+		DetectRenames:     in.Replication.DetectRenames,
+
+		ArchiveRecreatedFilesystems:    in.Replication.ArchiveRecreatedFilesystems,
+		RollbackDivergedReceivers:      in.Replication.RollbackDivergedReceivers,
+		AbortStalePartialReceivesAfter: in.Replication.AbortStalePartialReceivesAfter,
+		PartialReceiveAges:             logic.NewPartialReceiveAges(),
+		OrphanNewestSnapshots:          logic.NewOrphanNewestSnapshots(),
+		InitialStepSizeLimit:           int64(in.Replication.InitialStepSizeLimit),
+		StepTimeout:                    in.Replication.StepTimeout,
+
+		SenderSnapshotsExternallyManaged: in.Send.ExternallyManagedSnapshots,
+	}
+	if in.Guardrails != nil {
+		m.plannerPolicy.MaxFullSends = in.Guardrails.MaxFullSends
+		m.plannerPolicy.RefuseFullSends = in.Guardrails.RefuseFullSends
+	}
+	if in.Replication.ConfirmNewFilesystems {
+		m.plannerPolicy.NewFilesystemConfirmation = logic.NewNewFilesystemConfirmation()
+	}
+	if err := setPlannerPolicyScheduling(m.plannerPolicy, in.Replication); err != nil {
+		return nil, errors.Wrap(err, "field `replication`")
+	}
+	if err := setPlannerPolicyDeletedFilesystems(m.plannerPolicy, in.Replication.DeletedFilesystems); err != nil {
+		return nil, errors.Wrap(err, "field `replication`")
 	}
 
-	if m.snapper, err = snapper.FromConfig(g, m.senderConfig.FSF, in.Snapshotting); err != nil {
+	if m.snapper, err = snapper.FromConfig(g, jobID.String(), m.senderConfig.FSF, in.Snapshotting); err != nil {
 		return nil, errors.Wrap(err, "cannot build snapper")
 	}
 
+	if streamarchive.IsArchiveConnect(in.Connect) {
+		m.archive, err = streamarchive.ReceiverFromConfig(in.Connect)
+		if err != nil {
+			return nil, errors.Wrap(err, "field `connect`")
+		}
+	}
+
 	return m, nil
 }
 
@@ -177,6 +250,8 @@ type modePull struct {
 	sender         *rpc.Client
 	plannerPolicy  *logic.PlannerPolicy
 	interval       config.PositiveDurationOrManual
+	// the sender's versions known from previous invocations
+	senderVersions *rpc.VersionsCache
 }
 
 func (m *modePull) ConnectEndpoints(ctx context.Context, connecter transport.Connecter) {
@@ -187,6 +262,7 @@ func (m *modePull) ConnectEndpoints(ctx context.Context, connecter transport.Con
 	}
 	m.receiver = endpoint.NewReceiver(m.receiverConfig)
 	m.sender = rpc.NewClient(connecter, rpc.GetLoggersOrPanic(ctx))
+	m.sender.SetVersionsCache(m.senderVersions)
 }
 
 func (m *modePull) DisconnectEndpoints() {
@@ -245,7 +321,7 @@ func (m *modePull) ResetConnectBackoff() {
 }
 
 func modePullFromConfig(g *config.Global, in *config.PullJob, jobID endpoint.JobID) (m *modePull, err error) {
-	m = &modePull{}
+	m = &modePull{senderVersions: rpc.NewVersionsCache()}
 	m.interval = in.Interval
 
 	replicationConfig, err := logic.ReplicationConfigFromConfig(in.Replication)
@@ -256,12 +332,43 @@ func modePullFromConfig(g *config.Global, in *config.PullJob, jobID endpoint.Job
 	m.plannerPolicy = &logic.PlannerPolicy{
 		EncryptedSend:     logic.DontCare,
 		ReplicationConfig: *replicationConfig,
+		Verify:            in.Replication.Verify,
+		DetectRenames:     in.Replication.DetectRenames,
+
+		ArchiveRecreatedFilesystems:    in.Replication.ArchiveRecreatedFilesystems,
+		RollbackDivergedReceivers:      in.Replication.RollbackDivergedReceivers,
+		AbortStalePartialReceivesAfter: in.Replication.AbortStalePartialReceivesAfter,
+		PartialReceiveAges:             logic.NewPartialReceiveAges(),
+		OrphanNewestSnapshots:          logic.NewOrphanNewestSnapshots(),
+		InitialStepSizeLimit:           int64(in.Replication.InitialStepSizeLimit),
+		StepTimeout:                    in.Replication.StepTimeout,
+	}
+	if in.Guardrails != nil {
+		m.plannerPolicy.MaxFullSends = in.Guardrails.MaxFullSends
+		m.plannerPolicy.RefuseFullSends = in.Guardrails.RefuseFullSends
+	}
+	if in.Replication.ConfirmNewFilesystems {
+		m.plannerPolicy.NewFilesystemConfirmation = logic.NewNewFilesystemConfirmation()
+	}
+	if err := setPlannerPolicyScheduling(m.plannerPolicy, in.Replication); err != nil {
+		return nil, errors.Wrap(err, "field `replication`")
+	}
+	if err := setPlannerPolicyDeletedFilesystems(m.plannerPolicy, in.Replication.DeletedFilesystems); err != nil {
+		return nil, errors.Wrap(err, "field `replication`")
 	}
 
 	m.receiverConfig, err = buildReceiverConfig(in, jobID)
 	if err != nil {
 		return nil, err
 	}
+	if m.plannerPolicy.DeletedFilesystems == logic.DeletedFilesystemsDestroy &&
+		(!m.receiverConfig.AllowDestroyTombstones || m.receiverConfig.AppendOnly) {
+		return nil, errors.New("field `replication.deleted_filesystems.action`: `destroy` requires `recv.allow_destroy_tombstones` and must not be combined with `recv.append_only`")
+	}
+
+	if streamarchive.IsArchiveConnect(in.Connect) {
+		return nil, errors.Errorf("field `connect`: type %q is only supported by push jobs", fromconfig.ConnectTypeName(in.Connect))
+	}
 
 	return m, nil
 }
@@ -286,6 +393,11 @@ func activeSide(g *config.Global, in *config.ActiveJob, configJob interface{}) (
 		return nil, err // no wrapping required
 	}
 
+	if j.zfsCmdPriority, err = buildZFSCmdPriority(in.ProcessPriority); err != nil {
+		return nil, errors.Wrap(err, "field `process_priority`")
+	}
+	j.timeout = in.Timeout
+
 	j.promRepStateSecs = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace:   "zrepl",
 		Subsystem:   "replication",
@@ -309,9 +421,18 @@ func activeSide(g *config.Global, in *config.ActiveJob, configJob interface{}) (
 		ConstLabels: prometheus.Labels{"zrepl_job": j.name.String()},
 	})
 
-	j.connecter, err = fromconfig.ConnecterFromConfig(g, in.Connect)
-	if err != nil {
-		return nil, errors.Wrap(err, "cannot build client")
+	j.rpo = newRPOCollector(j.name.String())
+
+	if !streamarchive.IsArchiveConnect(in.Connect) {
+		j.connecter, err = fromconfig.ConnecterFromConfig(g, in.Connect)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build client")
+		}
+	}
+	j.transportType = fromconfig.ConnectTypeName(in.Connect)
+	j.peerName = fromconfig.ConnectPeerName(in.Connect)
+	if j.chunkSize, err = fromconfig.ChunkSizeLimitsFromConfig(in.Connect.Ret); err != nil {
+		return nil, errors.Wrap(err, "field `connect`")
 	}
 
 	j.promPruneSecs = prometheus.NewHistogramVec(prometheus.HistogramOpts{
@@ -321,7 +442,7 @@ func activeSide(g *config.Global, in *config.ActiveJob, configJob interface{}) (
 		Help:        "seconds spent in pruner",
 		ConstLabels: prometheus.Labels{"zrepl_job": j.name.String()},
 	}, []string{"prune_side"})
-	j.prunerFactory, err = pruner.NewPrunerFactory(in.Pruning, j.promPruneSecs)
+	j.prunerFactory, err = pruner.NewPrunerFactory(in.Pruning, in.Guardrails, j.promPruneSecs)
 	if err != nil {
 		return nil, err
 	}
@@ -334,6 +455,7 @@ func (j *ActiveSide) RegisterMetrics(registerer prometheus.Registerer) {
 	registerer.MustRegister(j.promPruneSecs)
 	registerer.MustRegister(j.promBytesReplicated)
 	registerer.MustRegister(j.promReplicationErrors)
+	registerer.MustRegister(j.rpo)
 }
 
 func (j *ActiveSide) Name() string { return j.name.String() }
@@ -342,6 +464,12 @@ type ActiveSideStatus struct {
 	Replication                    *report.Report
 	PruningSender, PruningReceiver *pruner.Report
 	Snapshotting                   *snapper.Report
+	// new filesystems whose initial replication awaits confirmation (replication.confirm_new_filesystems)
+	NewFilesystemsAwaitingConfirmation []string
+	// set if the most recent invocation was aborted because it exceeded the job's timeout
+	InvocationError string `json:",omitempty"`
+	// changes of the replication outcome since the previous invocation, nil until two invocations have replicated
+	Delta *InvocationDelta `json:",omitempty"`
 }
 
 func (j *ActiveSide) Status() *Status {
@@ -359,9 +487,36 @@ func (j *ActiveSide) Status() *Status {
 		s.PruningReceiver = tasks.prunerReceiver.Report()
 	}
 	s.Snapshotting = j.mode.SnapperReport()
+	s.InvocationError = tasks.invocationErr
+	s.Delta = j.delta.get()
+	if c := j.mode.PlannerPolicy().NewFilesystemConfirmation; c != nil {
+		s.NewFilesystemsAwaitingConfirmation = c.Pending()
+	}
 	return &Status{Type: t, JobSpecific: s}
 }
 
+// ConfirmNewFilesystems confirms the initial replication of all new filesystems
+// that were found to await confirmation and returns them.
+// The caller should wake up the job afterwards.
+func (j *ActiveSide) ConfirmNewFilesystems() ([]string, error) {
+	c := j.mode.PlannerPolicy().NewFilesystemConfirmation
+	if c == nil {
+		return nil, errors.New("job does not require confirmation of new filesystems (replication.confirm_new_filesystems)")
+	}
+	return c.ConfirmPending(), nil
+}
+
+// ConfirmDestroy confirms the pruning pass that awaits confirmation with token
+// (guardrails.confirm_destroy_fraction) and returns its side.
+// The caller should wake up the job afterwards.
+func (j *ActiveSide) ConfirmDestroy(token string) (side string, _ error) {
+	c := j.prunerFactory.DestroyConfirmation()
+	if c == nil {
+		return "", errors.New("job does not require confirmation of pruning passes (guardrails.confirm_destroy_fraction)")
+	}
+	return c.Confirm(token)
+}
+
 func (j *ActiveSide) OwnedDatasetSubtreeRoot() (rfs *zfs.DatasetPath, ok bool) {
 	pull, ok := j.mode.(*modePull)
 	if !ok {
@@ -394,6 +549,11 @@ func (j *ActiveSide) Run(ctx context.Context) {
 	defer endTask()
 
 	ctx = context.WithValue(ctx, endpoint.ClientIdentityKey, FakeActiveSideDirectMethodInvocationClientIdentity(j.name))
+	if j.zfsCmdPriority != nil {
+		ctx = zfscmd.WithPriority(ctx, j.zfsCmdPriority)
+	}
+	ctx = stream.WithMetricLabels(ctx, j.Name(), j.transportType)
+	ctx = stream.WithChunkSizeLimits(ctx, j.chunkSize)
 
 	log := GetLogger(ctx)
 
@@ -419,10 +579,18 @@ outer:
 			j.mode.ResetConnectBackoff()
 		case <-periodicDone:
 		}
+		endInvocation, err := beginInvocation(ctx)
+		if err != nil {
+			log.WithError(err).Info("context")
+			break outer
+		}
 		invocationCount++
-		invocationCtx, endSpan := trace.WithSpan(ctx, fmt.Sprintf("invocation-%d", invocationCount))
+		invocationCtx, endSpan := trace.WithSpan(trace.WithNewTrace(ctx), fmt.Sprintf("invocation-%d", invocationCount))
+		// the invocation ID is propagated to the peer's logs by package rpc
+		invocationCtx = logging.WithInvocationID(invocationCtx, uuid.New().String())
 		j.do(invocationCtx)
 		endSpan()
+		endInvocation()
 	}
 }
 
@@ -434,6 +602,20 @@ func (j *ActiveSide) do(ctx context.Context) {
 	// allow cancellation of an invocation (this function)
 	ctx, cancelThisRun := context.WithCancel(ctx)
 	defer cancelThisRun()
+	j.updateTasks(func(tasks *activeSideTasks) {
+		tasks.invocationErr = ""
+	})
+	if j.timeout > 0 {
+		// cancelling ctx also kills the zfs processes of the invocation
+		timer := time.AfterFunc(j.timeout, func() {
+			GetLogger(ctx).WithField("timeout", j.timeout).Error("invocation exceeded timeout, aborting it")
+			j.updateTasks(func(tasks *activeSideTasks) {
+				tasks.invocationErr = fmt.Sprintf("invocation aborted after exceeding the timeout of %s", j.timeout)
+			})
+			cancelThisRun()
+		})
+		defer timer.Stop()
+	}
 	go func() {
 		select {
 		case <-reset.Wait(ctx):
@@ -445,6 +627,7 @@ func (j *ActiveSide) do(ctx context.Context) {
 
 	sender, receiver := j.mode.SenderReceiver()
 
+	var planner *logic.Planner
 	{
 		select {
 		case <-ctx.Done():
@@ -454,13 +637,18 @@ func (j *ActiveSide) do(ctx context.Context) {
 		ctx, endSpan := trace.WithSpan(ctx, "replication")
 		ctx, repCancel := context.WithCancel(ctx)
 		var repWait driver.WaitFunc
+		policy := j.mode.PlannerPolicy()
+		if db := history.FromContext(ctx); db != nil {
+			recorder := db.Recorder(j.name.String(), string(j.mode.Type()), j.peerName)
+			policy.StepRecorder, policy.DurationPredictor = recorder, recorder
+		}
+		policy.ReplicatedSnapshotObserver = j.rpo
 		j.updateTasks(func(tasks *activeSideTasks) {
-			// reset it
-			*tasks = activeSideTasks{}
+			// reset it, but keep the error of this invocation
+			*tasks = activeSideTasks{invocationErr: tasks.invocationErr}
 			tasks.replicationCancel = func() { repCancel(); endSpan() }
-			tasks.replicationReport, repWait = replication.Do(
-				ctx, logic.NewPlanner(j.promRepStateSecs, j.promBytesReplicated, sender, receiver, j.mode.PlannerPolicy()),
-			)
+			planner = logic.NewPlanner(j.promRepStateSecs, j.promBytesReplicated, sender, receiver, policy)
+			tasks.replicationReport, repWait = replication.Do(ctx, planner)
 			tasks.state = ActiveSideReplicating
 		})
 		GetLogger(ctx).Info("start replication")
@@ -469,11 +657,29 @@ func (j *ActiveSide) do(ctx context.Context) {
 
 		replicationReport := j.tasks.replicationReport()
 		j.promReplicationErrors.Set(float64(replicationReport.GetFailedFilesystemsCountInLatestAttempt()))
+		if n := len(replicationReport.Attempts); n > 0 && replicationReport.Attempts[n-1].State != report.AttemptPlanningError {
+			fss := make([]string, 0, len(replicationReport.Attempts[n-1].Filesystems))
+			for _, fs := range replicationReport.Attempts[n-1].Filesystems {
+				fss = append(fss, fs.Info.Name)
+			}
+			j.rpo.retain(fss)
+		}
+		j.delta.update(ctx, replicationReport)
 
 		endSpan()
 	}
 
-	{
+	// The sender neither destroys externally managed snapshots nor has a replication cursor:
+	// skip pruning the sender and consider all of the receiver's snapshots replicated.
+	// Pull jobs only learn this from the sender's filesystem listing during replication planning.
+	externallyManaged := j.mode.PlannerPolicy().SenderSnapshotsExternallyManaged
+	if planner != nil {
+		externallyManaged = planner.SenderSnapshotsExternallyManaged()
+	}
+	if externallyManaged {
+		GetLogger(ctx).Info("sender snapshots are externally managed, not pruning sender")
+	}
+	if !externallyManaged {
 		select {
 		case <-ctx.Done():
 			return
@@ -501,7 +707,11 @@ func (j *ActiveSide) do(ctx context.Context) {
 		ctx, endSpan := trace.WithSpan(ctx, "prune_recever")
 		ctx, receiverCancel := context.WithCancel(ctx)
 		tasks := j.updateTasks(func(tasks *activeSideTasks) {
-			tasks.prunerReceiver = j.prunerFactory.BuildReceiverPruner(ctx, receiver, sender)
+			var history pruner.History = sender
+			if externallyManaged {
+				history = alwaysUpToDateReplicationCursorHistory{receiver}
+			}
+			tasks.prunerReceiver = j.prunerFactory.BuildReceiverPruner(ctx, receiver, history)
 			tasks.prunerReceiverCancel = func() { receiverCancel(); endSpan() }
 			tasks.state = ActiveSidePruneReceiver
 		})
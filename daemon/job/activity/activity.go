@@ -0,0 +1,169 @@
+// Package activity tracks whether jobs are active, i.e., snapshotting or running an invocation,
+// so that jobs that are ordered after other jobs (config field `after`) can wait for them.
+package activity
+
+import (
+	"context"
+	"sync"
+)
+
+type contextKey int
+
+const (
+	contextKeyTracker contextKey = iota
+	contextKeyDependencies
+)
+
+// Tracker tracks whether a single job is active and how often it has completed an activity,
+// i.e., gone from active to idle.
+type Tracker struct {
+	mtx        sync.Mutex
+	active     int
+	completed  uint64
+	changed    chan struct{} // closed and replaced whenever active or completed changes
+	waitingFor []string
+	// the dependencies' completed counts at the job's last call to WaitForDependencies, by Dependency.Name
+	seen map[string]uint64
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		changed: make(chan struct{}),
+		seen:    make(map[string]uint64),
+	}
+}
+
+// caller must hold t.mtx
+func (t *Tracker) notifyLocked() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// Begin marks the job as active until the returned func is called.
+// Begin may be called again before the returned func is called,
+// the job is active until all returned funcs have been called.
+func (t *Tracker) Begin() (end func()) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.active++
+	if t.active == 1 {
+		t.notifyLocked()
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mtx.Lock()
+			defer t.mtx.Unlock()
+			t.active--
+			if t.active == 0 {
+				t.completed++
+				t.notifyLocked()
+			}
+		})
+	}
+}
+
+// state returns whether the job is idle, the number of completed activities,
+// and a channel that is closed once either of them changes.
+func (t *Tracker) state() (idle bool, completed uint64, changed <-chan struct{}) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.active == 0, t.completed, t.changed
+}
+
+// WaitingFor returns the names of the dependencies that the job is currently waiting for.
+func (t *Tracker) WaitingFor() []string {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return append([]string(nil), t.waitingFor...)
+}
+
+func (t *Tracker) setWaitingFor(names []string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.waitingFor = names
+}
+
+// Context returns a context for the job tracked by t.
+func Context(ctx context.Context, t *Tracker) context.Context {
+	return context.WithValue(ctx, contextKeyTracker, t)
+}
+
+// Begin marks the job of ctx as active until the returned func is called,
+// see Tracker.Begin. It is a no-op if ctx has no Tracker.
+func Begin(ctx context.Context) (end func()) {
+	t, ok := ctx.Value(contextKeyTracker).(*Tracker)
+	if !ok {
+		return func() {}
+	}
+	return t.Begin()
+}
+
+// Dependency is a job that another job is ordered after.
+type Dependency struct {
+	Name    string
+	Tracker *Tracker
+}
+
+// WithDependencies returns a context for a job that is ordered after deps.
+func WithDependencies(ctx context.Context, deps []Dependency) context.Context {
+	return context.WithValue(ctx, contextKeyDependencies, deps)
+}
+
+// WaitForDependencies blocks until each dependency of the job of ctx has completed an activity
+// since the job's previous commit (or since the dependency's Tracker was created)
+// and all dependencies are idle at the same time, or until ctx is done, in which case it returns ctx.Err().
+// For example, a push job that is ordered after a snap job does not replicate before the snap job
+// has taken the snapshots of its current period.
+// While it blocks, the Tracker of the job of ctx reports the dependencies that it is still waiting for.
+//
+// The completed activities are only consumed once the returned commit func is called,
+// so that a caller that decides not to start its invocation after all does not lose them.
+func WaitForDependencies(ctx context.Context) (commit func(), err error) {
+	deps, _ := ctx.Value(contextKeyDependencies).([]Dependency)
+	t, _ := ctx.Value(contextKeyTracker).(*Tracker)
+	if t == nil {
+		// the completed activities that have been seen are tracked per job
+		t = NewTracker()
+	}
+	defer t.setWaitingFor(nil)
+	for {
+		var waitingFor []string
+		var changed []<-chan struct{}
+		completed := make(map[string]uint64, len(deps))
+		for _, dep := range deps {
+			idle, c, ch := dep.Tracker.state()
+			completed[dep.Name] = c
+			if !idle || c <= t.lastSeen(dep.Name) {
+				waitingFor = append(waitingFor, dep.Name)
+				changed = append(changed, ch)
+			}
+		}
+		if len(waitingFor) == 0 {
+			return func() { t.setSeen(completed) }, nil
+		}
+		t.setWaitingFor(waitingFor)
+		for _, ch := range changed {
+			select {
+			case <-ch:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		// dependencies that were idle may have become active in the meantime => re-check
+	}
+}
+
+func (t *Tracker) lastSeen(dep string) uint64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.seen[dep]
+}
+
+func (t *Tracker) setSeen(completed map[string]uint64) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for dep, c := range completed {
+		t.seen[dep] = c
+	}
+}
@@ -0,0 +1,94 @@
+package activity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForDependencies(t *testing.T) {
+	a, b, own := NewTracker(), NewTracker(), NewTracker()
+	ctx := Context(context.Background(), own)
+	ctx = WithDependencies(ctx, []Dependency{{"a", a}, {"b", b}})
+
+	wait := func() <-chan error {
+		done := make(chan error)
+		go func() {
+			commit, err := WaitForDependencies(ctx)
+			if err == nil {
+				commit()
+			}
+			done <- err
+		}()
+		return done
+	}
+	assertBlocked := func(done <-chan error, msg string) {
+		select {
+		case <-done:
+			t.Fatal(msg)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// idle dependencies that have not completed an activity yet block, e.g., a snap job that has not taken snapshots yet
+	done := wait()
+	require.Eventually(t, func() bool { return len(own.WaitingFor()) == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"a", "b"}, own.WaitingFor())
+
+	endA := a.Begin()
+	endB := b.Begin()
+	endB2 := b.Begin()
+	endA()
+	endB()
+	endA() // calling end twice has no effect
+	assertBlocked(done, "b is still active")
+	endB2()
+	require.NoError(t, <-done)
+	assert.Empty(t, own.WaitingFor())
+
+	// the completed activities have been consumed by the previous call
+	done = wait()
+	assertBlocked(done, "a and b have not completed an activity since the previous call")
+	a.Begin()()
+	assertBlocked(done, "b has not completed an activity since the previous call")
+	endB = b.Begin()
+	assertBlocked(done, "b is active")
+	endB()
+	require.NoError(t, <-done)
+
+	endA = a.Begin()
+	defer endA()
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err := WaitForDependencies(ctx)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestWaitForDependenciesWithoutCommit(t *testing.T) {
+	a, own := NewTracker(), NewTracker()
+	ctx := Context(context.Background(), own)
+	ctx = WithDependencies(ctx, []Dependency{{"a", a}})
+	a.Begin()()
+
+	// the completed activity is not consumed without commit
+	_, err := WaitForDependencies(ctx)
+	require.NoError(t, err)
+	commit, err := WaitForDependencies(ctx)
+	require.NoError(t, err)
+	commit()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = WaitForDependencies(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestBeginWithoutTracker(t *testing.T) {
+	Begin(context.Background())()
+	commit, err := WaitForDependencies(context.Background())
+	require.NoError(t, err)
+	commit()
+}
@@ -0,0 +1,161 @@
+// Package blackout implements scheduled blackout windows (config field `blackout`)
+// during which a job does not start new invocations and, optionally, pauses its replication streams.
+package blackout
+
+import (
+	"context"
+	"time"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/job/pause"
+	"github.com/zrepl/zrepl/daemon/logging"
+)
+
+type contextKey int
+
+const contextKeySchedule contextKey = iota
+
+// Schedule is the set of blackout windows of a single job.
+// The nil Schedule has no windows.
+type Schedule struct {
+	windows      []config.BlackoutWindow
+	pauseStreams bool
+}
+
+// FromConfig returns the Schedule for in, nil if in is nil or has no windows.
+func FromConfig(in *config.Blackout) *Schedule {
+	if in == nil || len(in.Windows) == 0 {
+		return nil
+	}
+	return &Schedule{windows: in.Windows, pauseStreams: in.PauseStreams}
+}
+
+// PauseStreams reports whether replication streams shall be paused during blackout windows.
+func (s *Schedule) PauseStreams() bool {
+	return s != nil && s.pauseStreams
+}
+
+// instances calls f for each instance of s's windows that starts between the day before t and a week after t.
+func (s *Schedule) instances(t time.Time, f func(start, end time.Time)) {
+	y, m, d := t.Date()
+	for day := -1; day <= 7; day++ {
+		midnight := time.Date(y, m, d+day, 0, 0, 0, 0, t.Location())
+		for i := range s.windows {
+			w := &s.windows[i]
+			if !w.Weekday(midnight.Weekday()) {
+				continue
+			}
+			// use time.Date instead of midnight.Add so that DST changes are accounted for
+			start := time.Date(y, m, d+day, 0, int(w.Start()/time.Minute), 0, 0, t.Location())
+			end := time.Date(y, m, d+day, 0, int(w.End()/time.Minute), 0, 0, t.Location())
+			f(start, end)
+		}
+	}
+}
+
+// containing returns the latest end of the window instances that contain t.
+func (s *Schedule) containing(t time.Time) (end time.Time, ok bool) {
+	s.instances(t, func(wstart, wend time.Time) {
+		if !t.Before(wstart) && t.Before(wend) && wend.After(end) {
+			end, ok = wend, true
+		}
+	})
+	return end, ok
+}
+
+// Active reports whether now is in a blackout window and, if so, when the blackout ends.
+// Adjacent or overlapping windows are treated as a single blackout.
+func (s *Schedule) Active(now time.Time) (active bool, end time.Time) {
+	if s == nil {
+		return false, time.Time{}
+	}
+	end, active = s.containing(now)
+	if !active {
+		return false, time.Time{}
+	}
+	// bounded because windows may cover the entire week
+	for i := 0; i < 2*7*len(s.windows); i++ {
+		next, ok := s.containing(end)
+		if !ok {
+			break
+		}
+		end = next
+	}
+	return true, end
+}
+
+// NextStart returns the start of the next blackout window after now, the zero time if there is none.
+func (s *Schedule) NextStart(now time.Time) (next time.Time) {
+	if s == nil {
+		return time.Time{}
+	}
+	s.instances(now, func(start, _ time.Time) {
+		if start.After(now) && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	})
+	return next
+}
+
+// Context returns a context for the job whose blackout windows are s.
+func Context(ctx context.Context, s *Schedule) context.Context {
+	return context.WithValue(ctx, contextKeySchedule, s)
+}
+
+// FromContext returns the Schedule of the job of ctx, nil if it has none.
+func FromContext(ctx context.Context) *Schedule {
+	s, _ := ctx.Value(contextKeySchedule).(*Schedule)
+	return s
+}
+
+// Wait blocks while the job of ctx is in a blackout window,
+// or until ctx is done, in which case it returns ctx.Err().
+func Wait(ctx context.Context) error {
+	s := FromContext(ctx)
+	for {
+		active, end := s.Active(time.Now())
+		if !active {
+			return nil
+		}
+		t := time.NewTimer(time.Until(end))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// PauseStreams pauses g while the job of ctx is in a blackout window and resumes it afterwards.
+// It returns once ctx is done, leaving g resumed.
+func PauseStreams(ctx context.Context, g *pause.Gate) {
+	log := logging.GetLogger(ctx, logging.SubsysJob)
+	s := FromContext(ctx)
+	defer func() { _ = g.Resume() }()
+	for {
+		now := time.Now()
+		active, next := s.Active(now)
+		if active {
+			if g.Pause() == nil {
+				log.WithField("until", next).Info("blackout window began, pausing replication streams")
+			}
+		} else {
+			if g.Resume() == nil {
+				log.Info("blackout window ended, resuming replication streams")
+			}
+			next = s.NextStart(now)
+		}
+		if next.IsZero() {
+			<-ctx.Done()
+			return
+		}
+		t := time.NewTimer(next.Sub(now))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return
+		}
+	}
+}
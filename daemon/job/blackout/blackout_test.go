@@ -0,0 +1,117 @@
+package blackout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func schedule(t *testing.T, windows ...string) *Schedule {
+	var c config.Blackout
+	for _, s := range windows {
+		w, err := config.ParseBlackoutWindow(s)
+		require.NoError(t, err)
+		c.Windows = append(c.Windows, w)
+	}
+	return FromConfig(&c)
+}
+
+func TestScheduleActive(t *testing.T) {
+	at := func(day, hour, min int) time.Time {
+		// 2020-06-01 is a Monday
+		return time.Date(2020, 6, day, hour, min, 0, 0, time.UTC)
+	}
+
+	type tc struct {
+		now    time.Time
+		active bool
+		end    time.Time
+	}
+	tcs := []struct {
+		windows []string
+		cases   []tc
+	}{
+		{
+			windows: []string{"mon-fri 08:00-18:00"},
+			cases: []tc{
+				{now: at(1, 7, 59)},
+				{now: at(1, 8, 0), active: true, end: at(1, 18, 0)},
+				{now: at(5, 17, 59), active: true, end: at(5, 18, 0)},
+				{now: at(1, 18, 0)},
+				{now: at(6, 12, 0)}, // saturday
+			},
+		},
+		{
+			windows: []string{"fri 22:00-06:00"},
+			cases: []tc{
+				{now: at(5, 21, 0)},
+				{now: at(5, 23, 0), active: true, end: at(6, 6, 0)},
+				{now: at(6, 5, 0), active: true, end: at(6, 6, 0)},
+				{now: at(2, 5, 0)}, // tuesday, window only starts on fridays
+			},
+		},
+		{
+			// chained windows are a single blackout
+			windows: []string{"mon-fri 08:00-18:00", "mon-fri 17:00-20:00", "fri 20:00-24:00", "sat,sun 00:00-24:00"},
+			cases: []tc{
+				{now: at(1, 9, 0), active: true, end: at(1, 20, 0)},
+				{now: at(1, 21, 0)},
+				{now: at(5, 9, 0), active: true, end: at(8, 0, 0)},
+			},
+		},
+		{
+			windows: []string{"00:00-24:00"},
+			cases: []tc{
+				{now: at(3, 12, 0), active: true},
+			},
+		},
+	}
+	for _, c := range tcs {
+		s := schedule(t, c.windows...)
+		for _, tc := range c.cases {
+			active, end := s.Active(tc.now)
+			assert.Equal(t, tc.active, active, "%v at %s", c.windows, tc.now)
+			if tc.active && !tc.end.IsZero() {
+				assert.Equal(t, tc.end, end, "%v at %s", c.windows, tc.now)
+			}
+			if tc.active {
+				assert.True(t, end.After(tc.now))
+			}
+		}
+	}
+}
+
+func TestScheduleNextStart(t *testing.T) {
+	s := schedule(t, "mon-fri 08:00-18:00")
+	// 2020-06-05 is a Friday
+	assert.Equal(t, time.Date(2020, 6, 8, 8, 0, 0, 0, time.UTC), s.NextStart(time.Date(2020, 6, 5, 9, 0, 0, 0, time.UTC)))
+	assert.Equal(t, time.Date(2020, 6, 5, 8, 0, 0, 0, time.UTC), s.NextStart(time.Date(2020, 6, 5, 7, 0, 0, 0, time.UTC)))
+}
+
+func TestScheduleDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database not available: %s", err)
+	}
+	s := schedule(t, "sun 01:00-04:00")
+	// clocks are set forward from 02:00 to 03:00 on 2020-03-29, the window is one hour shorter
+	active, end := s.Active(time.Date(2020, 3, 29, 1, 30, 0, 0, loc))
+	assert.True(t, active)
+	assert.Equal(t, time.Date(2020, 3, 29, 4, 0, 0, 0, loc), end)
+}
+
+func TestNilSchedule(t *testing.T) {
+	var s *Schedule
+	active, _ := s.Active(time.Now())
+	assert.False(t, active)
+	assert.True(t, s.NextStart(time.Now()).IsZero())
+	assert.False(t, s.PauseStreams())
+	assert.Nil(t, FromConfig(nil))
+	assert.Nil(t, FromConfig(&config.Blackout{}))
+	assert.NoError(t, Wait(context.Background()))
+}
@@ -23,6 +23,14 @@ func JobsFromConfig(c *config.Config) ([]Job, error) {
 		js[i] = j
 	}
 
+	if err := validateJobDependencies(c.Jobs); err != nil {
+		return nil, err
+	}
+
+	if _, err := LabelsFromConfig(c.Jobs); err != nil {
+		return nil, err
+	}
+
 	// receiving-side root filesystems must not overlap
 	{
 		rfss := make([]string, 0, len(js))
@@ -72,6 +80,16 @@ func buildJob(c *config.Global, in config.JobEnum) (j Job, err error) {
 		if err != nil {
 			return cannotBuildJob(err, v.Name)
 		}
+	case *config.VerifyJob:
+		j, err = verifyJobFromConfig(c, v)
+		if err != nil {
+			return cannotBuildJob(err, v.Name)
+		}
+	case *config.TestRestoreJob:
+		j, err = testRestoreJobFromConfig(c, v)
+		if err != nil {
+			return cannotBuildJob(err, v.Name)
+		}
 	default:
 		panic(fmt.Sprintf("implementation error: unknown job type %T", v))
 	}
@@ -107,3 +125,66 @@ func validateReceivingSidesDoNotOverlap(receivingRootFSs []string) error {
 	}
 	return nil
 }
+
+// validateJobDependencies checks that the jobs that each job is ordered after (field `after`)
+// exist and that there are no cycles.
+func validateJobDependencies(jobs []config.JobEnum) error {
+	byName := make(map[string]config.JobEnum, len(jobs))
+	for _, j := range jobs {
+		byName[j.Name()] = j
+	}
+	for _, j := range jobs {
+		for _, dep := range j.After() {
+			d, ok := byName[dep]
+			if !ok {
+				return errors.Errorf("job %q: field `after`: job %q does not exist", j.Name(), dep)
+			}
+			if _, ok := d.Ret.(*config.SinkJob); ok {
+				return errors.Errorf("job %q: field `after`: job %q is a sink job, which is never active", j.Name(), dep)
+			}
+			if src, ok := d.Ret.(*config.SourceJob); ok {
+				if _, periodic := src.Snapshotting.Ret.(*config.SnapshottingPeriodic); !periodic {
+					return errors.Errorf("job %q: field `after`: job %q is a source job without periodic snapshotting, which is never active", j.Name(), dep)
+				}
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(jobs))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i := range path {
+				if path[i] == name {
+					return errors.Errorf("field `after`: jobs are ordered in a cycle: %s -> %s", strings.Join(path[i:], " -> "), name)
+				}
+			}
+			panic("implementation error: visiting job not on path")
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range byName[name].After() {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, j := range jobs {
+		if err := visit(j.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
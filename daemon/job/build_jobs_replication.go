@@ -0,0 +1,70 @@
+package job
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/replication/logic"
+	"github.com/zrepl/zrepl/util/bandwidth"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// setPlannerPolicyScheduling sets the ordering, bandwidth limit and filesystem weights of p.
+func setPlannerPolicyScheduling(p *logic.PlannerPolicy, in *config.Replication) error {
+	ordering, err := logic.OrderingFromConfig(in.Ordering)
+	if err != nil {
+		return errors.Wrap(err, "field `ordering`")
+	}
+	p.Ordering = ordering
+	if in.BandwidthLimit > 0 {
+		p.BandwidthLimiter = bandwidth.NewLimiter(int64(in.BandwidthLimit))
+	}
+	if len(in.Weights) > 0 {
+		w, err := filesystemWeightsFromConfig(in.Weights)
+		if err != nil {
+			return errors.Wrap(err, "field `weights`")
+		}
+		p.Weights = w
+	}
+	return nil
+}
+
+func setPlannerPolicyDeletedFilesystems(p *logic.PlannerPolicy, in *config.ReplicationDeletedFilesystems) error {
+	action, err := logic.DeletedFilesystemsActionFromConfig(in.Action)
+	if err != nil {
+		return errors.Wrap(err, "field `deleted_filesystems.action`")
+	}
+	p.DeletedFilesystems = action
+	p.DestroyTombstonesAfter = in.DestroyAfter
+	return nil
+}
+
+// filesystemWeightsFromConfig returns the weight of the first entry of in whose filter matches a filesystem,
+// or 1 if none matches.
+func filesystemWeightsFromConfig(in []config.ReplicationWeight) (logic.FilesystemWeights, error) {
+	type entry struct {
+		filter zfs.DatasetFilter
+		weight int
+	}
+	entries := make([]entry, len(in))
+	for i, w := range in {
+		f, err := filters.DatasetMapFilterFromConfig(w.Filesystems)
+		if err != nil {
+			return nil, errors.Wrapf(err, "entry #%d: cannot build filesystem filter", i+1)
+		}
+		entries[i] = entry{f, w.Weight}
+	}
+	return func(fs string) int {
+		p, err := zfs.NewDatasetPath(fs)
+		if err != nil {
+			return 1
+		}
+		for _, e := range entries {
+			if pass, err := e.filter.Filter(p); err == nil && pass {
+				return e.weight
+			}
+		}
+		return 1
+	}, nil
+}
@@ -0,0 +1,29 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func TestFilesystemWeightsFromConfig(t *testing.T) {
+	w, err := filesystemWeightsFromConfig([]config.ReplicationWeight{
+		{Filesystems: config.FilesystemsFilter{"pool/db<": true, "pool/db/scratch": false}, Weight: 10},
+		{Filesystems: config.FilesystemsFilter{"pool/db/scratch": true, "pool/media<": true}, Weight: 2},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 10, w("pool/db"))
+	assert.Equal(t, 10, w("pool/db/wal"))
+	assert.Equal(t, 2, w("pool/db/scratch"), "the first matching entry determines the weight")
+	assert.Equal(t, 2, w("pool/media/movies"))
+	assert.Equal(t, 1, w("pool/home"), "filesystems that match no entry have weight 1")
+
+	_, err = filesystemWeightsFromConfig([]config.ReplicationWeight{
+		{Filesystems: config.FilesystemsFilter{"pool/invalid@": true}, Weight: 1},
+	})
+	assert.Error(t, err)
+}
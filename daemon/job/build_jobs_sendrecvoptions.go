@@ -5,27 +5,82 @@ import (
 
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/daemon/hooks"
 	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/util/streambuffer"
 	"github.com/zrepl/zrepl/zfs"
+	"github.com/zrepl/zrepl/zfs/zfscmd"
 )
 
 type SendingJobConfig interface {
 	GetFilesystems() config.FilesystemsFilter
+	GetFilesystemsProperty() string
 	GetSendOptions() *config.SendOptions // must not be nil
 }
 
 func buildSenderConfig(in SendingJobConfig, jobID endpoint.JobID) (*endpoint.SenderConfig, error) {
 
-	fsf, err := filters.DatasetMapFilterFromConfig(in.GetFilesystems())
+	fsf, err := filters.DatasetFilterFromConfig(in.GetFilesystems(), in.GetFilesystemsProperty())
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot build filesystem filter")
 	}
 
-	return &endpoint.SenderConfig{
+	sc := &endpoint.SenderConfig{
 		FSF:     fsf,
 		Encrypt: &zfs.NilBool{B: in.GetSendOptions().Encrypted},
 		JobID:   jobID,
-	}, nil
+
+		StreamPipe:       in.GetSendOptions().StreamPipe,
+		BulkListVersions: in.GetSendOptions().BulkListVersions,
+
+		ExternallyManagedSnapshots: in.GetSendOptions().ExternallyManagedSnapshots,
+		ReadOnly:                   in.GetSendOptions().ReadonlySender,
+		BookmarksOnly:              in.GetSendOptions().BookmarksOnly,
+	}
+	if prefix := in.GetSendOptions().StripPrefix; prefix != "" {
+		if sc.StripPrefix, err = zfs.NewDatasetPath(prefix); err != nil {
+			return nil, errors.Wrap(err, "strip_prefix is not a valid zfs filesystem path")
+		}
+	}
+	if sc.Buffer, err = buildStreamBufferConfig(in.GetSendOptions().Buffer); err != nil {
+		return nil, errors.Wrap(err, "field `send.buffer`")
+	}
+	if sc.VersionFilter, err = buildVersionFilter(in.GetSendOptions().VersionFilter); err != nil {
+		return nil, errors.Wrap(err, "field `send.version_filter`")
+	}
+	if sc.BookmarksOnly && (sc.ExternallyManagedSnapshots || sc.ReadOnly) {
+		return nil, errors.New("field `send.bookmarks_only`: cannot be combined with `send.externally_managed_snapshots` or `send.readonly_sender`, which do not destroy snapshots")
+	}
+	if err := sc.Validate(); err != nil {
+		return nil, errors.Wrap(err, "cannot build sender config")
+	}
+
+	return sc, nil
+}
+
+// A sender whose snapshots are externally managed must not create snapshots either.
+func checkExternallyManagedSnapshotting(send *config.SendOptions, snapshotting config.SnapshottingEnum) error {
+	if !send.ExternallyManagedSnapshots {
+		return nil
+	}
+	if _, ok := snapshotting.Ret.(*config.SnapshottingManual); !ok {
+		return errors.New("field `snapshotting`: type must be `manual` if `send.externally_managed_snapshots` is set")
+	}
+	return nil
+}
+
+// A bookmarks-only sender must not convert snapshots that have not been replicated yet.
+// Only checked for push jobs, the keep_sender rules of a source job's sender are configured in the pull job.
+func checkBookmarksOnlyPruning(send *config.SendOptions, pruning config.PruningSenderReceiver) error {
+	if !send.BookmarksOnly {
+		return nil
+	}
+	for _, rule := range pruning.KeepSender {
+		if _, ok := rule.Ret.(*config.PruneKeepNotReplicated); ok {
+			return nil
+		}
+	}
+	return errors.New("field `pruning.keep_sender`: must contain a `not_replicated` rule if `send.bookmarks_only` is set")
 }
 
 type ReceivingJobConfig interface {
@@ -47,6 +102,31 @@ func buildReceiverConfig(in ReceivingJobConfig, jobID endpoint.JobID) (rc endpoi
 		JobID:                      jobID,
 		RootWithoutClientComponent: rootFs,
 		AppendClientIdentity:       in.GetAppendClientIdentity(),
+		AllowRestore:               in.GetRecvOptions().AllowRestore,
+		SnapshotPrefix:             in.GetRecvOptions().SnapshotPrefix,
+		ClientQuota:                uint64(in.GetRecvOptions().ClientQuota),
+		StreamPipe:                 in.GetRecvOptions().StreamPipe,
+		ArchivePlaceholderData:     in.GetRecvOptions().ArchivePlaceholderData,
+		AllowRollback:              in.GetRecvOptions().AllowRollback,
+		AppendOnly:                 in.GetRecvOptions().AppendOnly,
+		AllowDestroyTombstones:     in.GetRecvOptions().AllowDestroyTombstones,
+		BulkListVersions:           in.GetRecvOptions().BulkListVersions,
+	}
+	if rc.Buffer, err = buildStreamBufferConfig(in.GetRecvOptions().Buffer); err != nil {
+		return rc, errors.Wrap(err, "field `recv.buffer`")
+	}
+	if rc.PreserveACLProperties, err = buildPreserveACLProperties(in.GetRecvOptions().ACLProperties); err != nil {
+		return rc, errors.Wrap(err, "field `recv.acl_properties`")
+	}
+	if rc.VersionFilter, err = buildVersionFilter(in.GetRecvOptions().VersionFilter); err != nil {
+		return rc, errors.Wrap(err, "field `recv.version_filter`")
+	}
+	postRecvHooks, err := hooks.PostRecvFromConfig(in.GetRecvOptions().Hooks)
+	if err != nil {
+		return rc, errors.Wrap(err, "field `recv.hooks`")
+	}
+	if postRecvHooks != nil {
+		rc.PostRecvHooks = postRecvHooks
 	}
 	if err := rc.Validate(); err != nil {
 		return rc, errors.Wrap(err, "cannot build receiver config")
@@ -54,3 +134,63 @@ func buildReceiverConfig(in ReceivingJobConfig, jobID endpoint.JobID) (rc endpoi
 
 	return rc, nil
 }
+
+func buildPreserveACLProperties(in string) (bool, error) {
+	switch in {
+	case "inherit":
+		return false, nil
+	case "preserve":
+		return true, nil
+	default:
+		return false, errors.Errorf("invalid value %q, must be one of `inherit`, `preserve`", in)
+	}
+}
+
+// Returns nil if no filter is configured.
+func buildVersionFilter(in *config.VersionFilter) (*endpoint.FilesystemVersionFilter, error) {
+	if in == nil {
+		return nil, nil
+	}
+	return endpoint.NewFilesystemVersionFilter(in.Prefixes, in.Regexes)
+}
+
+// Returns nil if no buffer is configured.
+func buildStreamBufferConfig(in *config.StreamBuffer) (*streambuffer.Config, error) {
+	if in == nil {
+		return nil, nil
+	}
+	if in.LowWatermark > 100 || in.HighWatermark > 100 {
+		return nil, errors.New("watermarks are percentages and must not exceed 100")
+	}
+	percent := func(p int) int { return int(uint64(in.Size) * uint64(p) / 100) }
+	c := &streambuffer.Config{
+		Size:          int(in.Size),
+		LowWatermark:  percent(in.LowWatermark),
+		HighWatermark: percent(in.HighWatermark),
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Returns nil if in does not change the priority.
+func buildZFSCmdPriority(in config.ProcessPriority) (*zfscmd.Priority, error) {
+	p := &zfscmd.Priority{
+		Nice:  in.Nice,
+		Slice: in.CgroupSlice,
+	}
+	if in.IONice != "" {
+		var err error
+		if p.IONiceClass, p.IONiceLevel, err = zfscmd.ParseIONice(in.IONice); err != nil {
+			return nil, errors.Wrap(err, "field `ionice`")
+		}
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if *p == (zfscmd.Priority{}) {
+		return nil, nil
+	}
+	return p, nil
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/transport/tls"
+	"github.com/zrepl/zrepl/util/streambuffer"
 )
 
 func TestValidateReceivingSidesDoNotOverlap(t *testing.T) {
@@ -144,3 +145,239 @@ func TestSampleConfigsAreBuiltWithoutErrors(t *testing.T) {
 	}
 
 }
+
+func TestBuildStreamBufferConfig(t *testing.T) {
+	c, err := buildStreamBufferConfig(nil)
+	require.NoError(t, err)
+	assert.Nil(t, c)
+
+	c, err = buildStreamBufferConfig(&config.StreamBuffer{Size: 1000, LowWatermark: 25, HighWatermark: 80})
+	require.NoError(t, err)
+	assert.Equal(t, &streambuffer.Config{Size: 1000, LowWatermark: 250, HighWatermark: 800}, c)
+
+	_, err = buildStreamBufferConfig(&config.StreamBuffer{Size: 1000, HighWatermark: 101})
+	assert.Error(t, err)
+	_, err = buildStreamBufferConfig(&config.StreamBuffer{Size: 0})
+	assert.Error(t, err)
+}
+
+func TestBuildPreserveACLProperties(t *testing.T) {
+	preserve, err := buildPreserveACLProperties("inherit")
+	require.NoError(t, err)
+	assert.False(t, preserve)
+	preserve, err = buildPreserveACLProperties("preserve")
+	require.NoError(t, err)
+	assert.True(t, preserve)
+	_, err = buildPreserveACLProperties("keep")
+	assert.Error(t, err)
+}
+
+func TestValidateJobDependencies(t *testing.T) {
+	snap := func(name string, after ...string) config.JobEnum {
+		return config.JobEnum{Ret: &config.SnapJob{Name: name, After: after}}
+	}
+	sink := config.JobEnum{Ret: &config.SinkJob{PassiveJob: config.PassiveJob{Name: "sink"}}}
+	source := func(name string, snapshotting interface{}) config.JobEnum {
+		return config.JobEnum{Ret: &config.SourceJob{PassiveJob: config.PassiveJob{Name: name}, Snapshotting: config.SnapshottingEnum{Ret: snapshotting}}}
+	}
+
+	tcs := []struct {
+		jobs []config.JobEnum
+		err  string
+	}{
+		{[]config.JobEnum{snap("a"), snap("b", "a"), snap("c", "a", "b")}, ""},
+		{[]config.JobEnum{snap("a", "nonexistent")}, `job "nonexistent" does not exist`},
+		{[]config.JobEnum{sink, snap("a", "sink")}, "sink job"},
+		{[]config.JobEnum{source("src", &config.SnapshottingManual{}), snap("a", "src")}, "source job without periodic snapshotting"},
+		{[]config.JobEnum{source("src", &config.SnapshottingPeriodic{}), snap("a", "src")}, ""},
+		{[]config.JobEnum{snap("a", "a")}, "cycle: a -> a"},
+		{[]config.JobEnum{snap("a", "c"), snap("b", "a"), snap("c", "b")}, "cycle: a -> c -> b -> a"},
+		{[]config.JobEnum{snap("x"), snap("a", "x", "b"), snap("b", "a")}, "cycle: a -> b -> a"},
+	}
+	for i, tc := range tcs {
+		err := validateJobDependencies(tc.jobs)
+		if tc.err == "" {
+			assert.NoError(t, err, "test case %d", i)
+		} else if assert.Error(t, err, "test case %d", i) {
+			assert.Contains(t, err.Error(), tc.err, "test case %d", i)
+		}
+	}
+}
+
+func TestExternallyManagedSnapshotsConfig(t *testing.T) {
+	tmpl := `
+jobs:
+- name: push
+  type: push
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  filesystems: {"<": true}
+  send:
+    externally_managed_snapshots: true
+  snapshotting:
+%s
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    keep_receiver:
+    - type: last_n
+      count: 10
+`
+	tcs := []struct {
+		snapshotting string
+		err          string
+	}{
+		{"    type: manual", ""},
+		{"    type: periodic\n    prefix: zrepl_\n    interval: 10m", "type must be `manual`"},
+	}
+	for i, tc := range tcs {
+		conf, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, tc.snapshotting)))
+		require.NoError(t, err, "test case %d", i)
+		jobs, err := JobsFromConfig(conf)
+		if tc.err == "" {
+			require.NoError(t, err, "test case %d", i)
+			push := jobs[0].(*ActiveSide).mode.(*modePush)
+			assert.True(t, push.senderConfig.ExternallyManagedSnapshots)
+			assert.True(t, push.plannerPolicy.SenderSnapshotsExternallyManaged)
+		} else if assert.Error(t, err, "test case %d", i) {
+			assert.Contains(t, err.Error(), tc.err, "test case %d", i)
+		}
+	}
+}
+
+func TestVersionFilterConfig(t *testing.T) {
+	tmpl := `
+jobs:
+- name: push
+  type: push
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  filesystems: {"<": true}
+  send:
+    version_filter:
+%s
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    keep_receiver:
+    - type: last_n
+      count: 10
+`
+	tcs := []struct {
+		filter string
+		err    string
+	}{
+		{"      prefixes: [zrepl_]\n      regexes: ['^auto-']", ""},
+		{"      prefixes: []", "at least one prefix or regex"},
+		{"      regexes: ['(']", "invalid regex"},
+	}
+	for i, tc := range tcs {
+		conf, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, tc.filter)))
+		require.NoError(t, err, "test case %d", i)
+		jobs, err := JobsFromConfig(conf)
+		if tc.err == "" {
+			require.NoError(t, err, "test case %d", i)
+			push := jobs[0].(*ActiveSide).mode.(*modePush)
+			assert.NotNil(t, push.senderConfig.VersionFilter)
+		} else if assert.Error(t, err, "test case %d", i) {
+			assert.Contains(t, err.Error(), tc.err, "test case %d", i)
+			assert.Contains(t, err.Error(), "send.version_filter", "test case %d", i)
+		}
+	}
+}
+
+func TestBookmarksOnlyConfig(t *testing.T) {
+	tmpl := `
+jobs:
+- name: push
+  type: push
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  filesystems: {"<": true}
+  send:
+    bookmarks_only: true
+%s
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+%s
+    keep_receiver:
+    - type: last_n
+      count: 10
+`
+	notReplicated := "    - type: not_replicated\n      keep_snapshot_at_cursor: false"
+	tcs := []struct {
+		send, keepSender string
+		err              string
+	}{
+		{"", notReplicated, ""},
+		{"", "    - type: last_n\n      count: 1", "must contain a `not_replicated` rule"},
+		{"    readonly_sender: true", notReplicated, "cannot be combined"},
+		{"    externally_managed_snapshots: true", notReplicated, "cannot be combined"},
+	}
+	for i, tc := range tcs {
+		conf, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, tc.send, tc.keepSender)))
+		require.NoError(t, err, "test case %d", i)
+		jobs, err := JobsFromConfig(conf)
+		if tc.err == "" {
+			require.NoError(t, err, "test case %d", i)
+			push := jobs[0].(*ActiveSide).mode.(*modePush)
+			assert.True(t, push.senderConfig.BookmarksOnly)
+		} else if assert.Error(t, err, "test case %d", i) {
+			assert.Contains(t, err.Error(), tc.err, "test case %d", i)
+		}
+	}
+}
+
+func TestDeletedFilesystemsConfig(t *testing.T) {
+	tmpl := `
+jobs:
+- name: pull
+  type: pull
+  connect:
+    type: tcp
+    address: "server:8888"
+  root_fs: pool/backup
+  interval: manual
+  recv:
+%s
+  replication:
+    deleted_filesystems:
+%s
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    keep_receiver:
+    - type: last_n
+      count: 10
+`
+	tcs := []struct {
+		recv, deleted string
+		err           string
+	}{
+		{"    allow_destroy_tombstones: true", "      action: destroy\n      destroy_after: 24h", ""},
+		{"    allow_destroy_tombstones: false", "      action: rename", ""},
+		{"    allow_destroy_tombstones: false", "      action: destroy", "requires `recv.allow_destroy_tombstones`"},
+		{"    allow_destroy_tombstones: true\n    append_only: true", "      action: destroy", "requires `recv.allow_destroy_tombstones`"},
+		{"    allow_destroy_tombstones: false", "      action: purge", "deleted_filesystems.action"},
+	}
+	for i, tc := range tcs {
+		conf, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, tc.recv, tc.deleted)))
+		require.NoError(t, err, "test case %d", i)
+		_, err = JobsFromConfig(conf)
+		if tc.err == "" {
+			assert.NoError(t, err, "test case %d", i)
+		} else if assert.Error(t, err, "test case %d", i) {
+			assert.Contains(t, err.Error(), tc.err, "test case %d", i)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package job
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/zrepl/zrepl/replication/report"
+)
+
+// InvocationDelta describes how the replication outcome of an active job's
+// most recent invocation differs from the invocation before it,
+// so that operators see changes rather than the full, mostly unchanged state.
+type InvocationDelta struct {
+	// filesystems whose replication failed after it had succeeded in the previous invocation
+	NewlyFailing []string `json:",omitempty"`
+	// filesystems whose replication succeeded after it had failed in the previous invocation
+	Recovered []string `json:",omitempty"`
+	// filesystems that were not part of the previous invocation
+	New []string `json:",omitempty"`
+	// filesystems that were part of the previous invocation but no longer are,
+	// e.g., because they were destroyed or are no longer matched by the filter
+	Vanished []string `json:",omitempty"`
+}
+
+func (d *InvocationDelta) Empty() bool {
+	return len(d.NewlyFailing) == 0 && len(d.Recovered) == 0 && len(d.New) == 0 && len(d.Vanished) == 0
+}
+
+type fsOutcome int
+
+const (
+	fsOutcomeUnknown fsOutcome = iota // e.g., the invocation was cancelled before the filesystem was replicated
+	fsOutcomeOK
+	fsOutcomeFailed
+)
+
+// invocationOutcome maps the filesystems of an invocation to their replication outcome.
+type invocationOutcome map[string]fsOutcome
+
+// invocationOutcomeFromReport returns nil if r does not list the job's filesystems,
+// e.g., because planning failed.
+func invocationOutcomeFromReport(r *report.Report) invocationOutcome {
+	if r == nil || len(r.Attempts) == 0 {
+		return nil
+	}
+	latest := r.Attempts[len(r.Attempts)-1]
+	if latest.State == report.AttemptPlanningError {
+		return nil
+	}
+	o := make(invocationOutcome, len(latest.Filesystems))
+	for _, fs := range latest.Filesystems {
+		switch fs.State {
+		case report.FilesystemDone:
+			o[fs.Info.Name] = fsOutcomeOK
+		case report.FilesystemPlanningErrored, report.FilesystemSteppingErrored, report.FilesystemVerifyErrored:
+			o[fs.Info.Name] = fsOutcomeFailed
+		default:
+			o[fs.Info.Name] = fsOutcomeUnknown
+		}
+	}
+	return o
+}
+
+// diffInvocationOutcomes computes the delta from prev to cur.
+// Filesystems with an unknown outcome in cur inherit their outcome from prev (in place).
+func diffInvocationOutcomes(prev, cur invocationOutcome) *InvocationDelta {
+	d := &InvocationDelta{}
+	for fs, c := range cur {
+		p, ok := prev[fs]
+		if !ok {
+			d.New = append(d.New, fs)
+			continue
+		}
+		if c == fsOutcomeUnknown {
+			cur[fs] = p
+			continue
+		}
+		switch {
+		case p == fsOutcomeOK && c == fsOutcomeFailed:
+			d.NewlyFailing = append(d.NewlyFailing, fs)
+		case p == fsOutcomeFailed && c == fsOutcomeOK:
+			d.Recovered = append(d.Recovered, fs)
+		}
+	}
+	for fs := range prev {
+		if _, ok := cur[fs]; !ok {
+			d.Vanished = append(d.Vanished, fs)
+		}
+	}
+	for _, l := range [][]string{d.NewlyFailing, d.Recovered, d.New, d.Vanished} {
+		sort.Strings(l)
+	}
+	return d
+}
+
+// deltaTracker keeps the outcome of an active job's previous invocation
+// across invocations and computes the InvocationDelta of each new one.
+type deltaTracker struct {
+	mtx   sync.Mutex
+	prev  invocationOutcome // nil until the first invocation that listed the filesystems
+	delta *InvocationDelta  // nil until two such invocations have completed
+}
+
+// update records the outcome of the replication report r of the invocation that just completed.
+func (t *deltaTracker) update(ctx context.Context, r *report.Report) {
+	cur := invocationOutcomeFromReport(r)
+	if cur == nil {
+		return
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.prev == nil {
+		t.prev = cur
+		return
+	}
+	d := diffInvocationOutcomes(t.prev, cur)
+	t.prev, t.delta = cur, d
+
+	log := GetLogger(ctx)
+	for _, fs := range d.NewlyFailing {
+		log.WithField("filesystem", fs).Warn("replication of filesystem started failing")
+	}
+	for _, fs := range d.Recovered {
+		log.WithField("filesystem", fs).Info("replication of filesystem recovered")
+	}
+	for _, fs := range d.New {
+		log.WithField("filesystem", fs).Info("new filesystem discovered")
+	}
+	for _, fs := range d.Vanished {
+		log.WithField("filesystem", fs).Info("filesystem no longer replicated")
+	}
+}
+
+func (t *deltaTracker) get() *InvocationDelta {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.delta
+}
@@ -0,0 +1,68 @@
+package job
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/report"
+)
+
+func TestDiffInvocationOutcomes(t *testing.T) {
+	prev := invocationOutcome{
+		"pool/ok":        fsOutcomeOK,
+		"pool/breaks":    fsOutcomeOK,
+		"pool/recovers":  fsOutcomeFailed,
+		"pool/broken":    fsOutcomeFailed,
+		"pool/cancelled": fsOutcomeFailed,
+		"pool/gone":      fsOutcomeOK,
+	}
+	cur := invocationOutcome{
+		"pool/ok":        fsOutcomeOK,
+		"pool/breaks":    fsOutcomeFailed,
+		"pool/recovers":  fsOutcomeOK,
+		"pool/broken":    fsOutcomeFailed,
+		"pool/cancelled": fsOutcomeUnknown,
+		"pool/new":       fsOutcomeOK,
+	}
+	d := diffInvocationOutcomes(prev, cur)
+	assert.Equal(t, []string{"pool/breaks"}, d.NewlyFailing)
+	assert.Equal(t, []string{"pool/recovers"}, d.Recovered)
+	assert.Equal(t, []string{"pool/new"}, d.New)
+	assert.Equal(t, []string{"pool/gone"}, d.Vanished)
+	assert.Equal(t, fsOutcomeFailed, cur["pool/cancelled"], "unknown outcomes must inherit the previous outcome")
+
+	assert.True(t, diffInvocationOutcomes(cur, invocationOutcome{
+		"pool/ok": fsOutcomeOK, "pool/breaks": fsOutcomeFailed, "pool/recovers": fsOutcomeOK,
+		"pool/broken": fsOutcomeFailed, "pool/cancelled": fsOutcomeFailed, "pool/new": fsOutcomeOK,
+	}).Empty())
+}
+
+func TestDeltaTracker(t *testing.T) {
+	rep := func(states map[string]report.FilesystemState) *report.Report {
+		a := &report.AttemptReport{State: report.AttemptDone}
+		for fs, s := range states {
+			a.Filesystems = append(a.Filesystems, &report.FilesystemReport{Info: &report.FilesystemInfo{Name: fs}, State: s})
+		}
+		return &report.Report{Attempts: []*report.AttemptReport{a}}
+	}
+	ctx := context.Background()
+
+	var tr deltaTracker
+	tr.update(ctx, rep(map[string]report.FilesystemState{"pool/a": report.FilesystemDone}))
+	assert.Nil(t, tr.get(), "the first invocation has nothing to compare to")
+
+	tr.update(ctx, &report.Report{Attempts: []*report.AttemptReport{{State: report.AttemptPlanningError}}})
+	assert.Nil(t, tr.get(), "invocations that did not list the filesystems must be ignored")
+
+	tr.update(ctx, rep(map[string]report.FilesystemState{
+		"pool/a": report.FilesystemSteppingErrored,
+		"pool/b": report.FilesystemDone,
+	}))
+	d := tr.get()
+	require.NotNil(t, d)
+	assert.Equal(t, []string{"pool/a"}, d.NewlyFailing)
+	assert.Equal(t, []string{"pool/b"}, d.New)
+}
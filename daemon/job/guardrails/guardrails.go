@@ -0,0 +1,65 @@
+// Package guardrails implements the one-shot override of a job's guardrails (`zrepl signal override JOB`).
+//
+// An armed Override lets the next pruning pass or replication attempt that exceeds a guardrail proceed
+// and is disarmed by it, i.e., every intended mass-destruction or mass-transfer must be overridden explicitly.
+package guardrails
+
+import (
+	"context"
+	"sync"
+)
+
+type contextKey int
+
+const contextKeyOverride contextKey = iota
+
+// Override is the override state of a single job.
+type Override struct {
+	mtx   sync.Mutex
+	armed bool
+}
+
+func NewOverride() *Override {
+	return &Override{}
+}
+
+// Arm arms o until the next call to Consume.
+func (o *Override) Arm() {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.armed = true
+}
+
+func (o *Override) Armed() bool {
+	if o == nil {
+		return false
+	}
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.armed
+}
+
+// Consume returns true and disarms o if o is armed.
+// It returns false if o is nil.
+func (o *Override) Consume() bool {
+	if o == nil {
+		return false
+	}
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	armed := o.armed
+	o.armed = false
+	return armed
+}
+
+// Context returns a context for a job whose guardrails are overridden by o.
+func Context(ctx context.Context, o *Override) context.Context {
+	return context.WithValue(ctx, contextKeyOverride, o)
+}
+
+// FromContext returns the Override of the job of ctx, or nil if ctx has none.
+// The methods of Override are safe to call on nil.
+func FromContext(ctx context.Context) *Override {
+	o, _ := ctx.Value(contextKeyOverride).(*Override)
+	return o
+}
@@ -0,0 +1,25 @@
+package guardrails
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverride(t *testing.T) {
+	o := NewOverride()
+	assert.False(t, o.Consume())
+	o.Arm()
+	o.Arm()
+	assert.True(t, o.Armed())
+	assert.True(t, o.Consume())
+	assert.False(t, o.Armed())
+	assert.False(t, o.Consume(), "the override is single-use")
+
+	assert.Same(t, o, FromContext(Context(context.Background(), o)))
+	none := FromContext(context.Background())
+	assert.Nil(t, none)
+	assert.False(t, none.Armed())
+	assert.False(t, none.Consume())
+}
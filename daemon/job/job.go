@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/zrepl/zrepl/daemon/job/activity"
+	"github.com/zrepl/zrepl/daemon/job/blackout"
 	"github.com/zrepl/zrepl/daemon/logging"
 	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/logger"
@@ -19,6 +22,38 @@ func GetLogger(ctx context.Context) Logger {
 	return logging.GetLogger(ctx, logging.SubsysJob)
 }
 
+// beginInvocation waits until the job of ctx is outside of its blackout windows (config field `blackout`)
+// and the jobs that it is ordered after (config field `after`) have completed an activity since its
+// previous invocation and are idle (see activity.WaitForDependencies),
+// and then marks the job as active until the returned func is called.
+// It returns ctx.Err() if ctx is done while waiting.
+func beginInvocation(ctx context.Context) (end func(), err error) {
+	return beginInvocationAt(ctx, time.Now)
+}
+
+func beginInvocationAt(ctx context.Context, now func() time.Time) (end func(), err error) {
+	schedule := blackout.FromContext(ctx)
+	for {
+		if active, until := schedule.Active(now()); active {
+			GetLogger(ctx).WithField("until", until).Info("in blackout window, wait before starting invocation")
+			if err := blackout.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		GetLogger(ctx).Debug("wait for jobs that this job is ordered after")
+		commit, err := activity.WaitForDependencies(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// a blackout window may have begun while waiting for the dependencies,
+		// their completed activities are then left for the next iteration
+		if active, _ := schedule.Active(now()); !active {
+			commit()
+			return activity.Begin(ctx), nil
+		}
+	}
+}
+
 type Job interface {
 	Name() string
 	Run(ctx context.Context)
@@ -33,17 +68,25 @@ type Job interface {
 type Type string
 
 const (
-	TypeInternal Type = "internal"
-	TypeSnap     Type = "snap"
-	TypePush     Type = "push"
-	TypeSink     Type = "sink"
-	TypePull     Type = "pull"
-	TypeSource   Type = "source"
+	TypeInternal    Type = "internal"
+	TypeSnap        Type = "snap"
+	TypePush        Type = "push"
+	TypeSink        Type = "sink"
+	TypePull        Type = "pull"
+	TypeSource      Type = "source"
+	TypeVerify      Type = "verify"
+	TypeTestRestore Type = "test-restore"
 )
 
 type Status struct {
 	Type        Type
 	JobSpecific interface{}
+	// The jobs that the job is ordered after and currently waits for, see package activity.
+	WaitingForJobs []string
+	// Whether the job's replication streams are paused, see package pause.
+	Paused bool
+	// The end of the blackout window that the job is currently in, nil if it is not in one, see package blackout.
+	BlackoutUntil *time.Time
 }
 
 func (s *Status) MarshalJSON() ([]byte, error) {
@@ -59,6 +102,21 @@ func (s *Status) MarshalJSON() ([]byte, error) {
 		"type":         typeJson,
 		string(s.Type): jobJSON,
 	}
+	if len(s.WaitingForJobs) > 0 {
+		if m["waiting_for_jobs"], err = json.Marshal(s.WaitingForJobs); err != nil {
+			return nil, err
+		}
+	}
+	if s.Paused {
+		if m["paused"], err = json.Marshal(s.Paused); err != nil {
+			return nil, err
+		}
+	}
+	if s.BlackoutUntil != nil {
+		if m["blackout_until"], err = json.Marshal(s.BlackoutUntil); err != nil {
+			return nil, err
+		}
+	}
 	return json.Marshal(m)
 }
 
@@ -74,6 +132,21 @@ func (s *Status) UnmarshalJSON(in []byte) (err error) {
 	if err := json.Unmarshal(tJSON, &s.Type); err != nil {
 		return err
 	}
+	if waitingJSON, ok := m["waiting_for_jobs"]; ok {
+		if err := json.Unmarshal(waitingJSON, &s.WaitingForJobs); err != nil {
+			return err
+		}
+	}
+	if pausedJSON, ok := m["paused"]; ok {
+		if err := json.Unmarshal(pausedJSON, &s.Paused); err != nil {
+			return err
+		}
+	}
+	if blackoutJSON, ok := m["blackout_until"]; ok {
+		if err := json.Unmarshal(blackoutJSON, &s.BlackoutUntil); err != nil {
+			return err
+		}
+	}
 	key := string(s.Type)
 	jobJSON, ok := m[key]
 	if !ok {
@@ -99,6 +172,16 @@ func (s *Status) UnmarshalJSON(in []byte) (err error) {
 		err = json.Unmarshal(jobJSON, &st)
 		s.JobSpecific = &st
 
+	case TypeVerify:
+		var st VerifyJobStatus
+		err = json.Unmarshal(jobJSON, &st)
+		s.JobSpecific = &st
+
+	case TypeTestRestore:
+		var st TestRestoreJobStatus
+		err = json.Unmarshal(jobJSON, &st)
+		s.JobSpecific = &st
+
 	case TypeInternal:
 		// internal jobs do not report specifics
 	default:
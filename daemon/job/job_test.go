@@ -0,0 +1,57 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/job/activity"
+	"github.com/zrepl/zrepl/daemon/job/blackout"
+)
+
+func TestBeginInvocationBlackoutAfterDependencies(t *testing.T) {
+	// a one-minute blackout window half a day from now, so that blackout.Wait does not block
+	inBlackout := time.Now().Add(12 * time.Hour).Truncate(time.Minute)
+	start := inBlackout.Hour()*60 + inBlackout.Minute()
+	window, err := config.ParseBlackoutWindow(fmt.Sprintf("%s %02d:%02d-%02d:%02d",
+		strings.ToLower(inBlackout.Weekday().String()[:3]),
+		start/60, start%60, (start+1)/60, (start+1)%60))
+	require.NoError(t, err)
+	schedule := blackout.FromConfig(&config.Blackout{Windows: []config.BlackoutWindow{window}})
+
+	dep, own := activity.NewTracker(), activity.NewTracker()
+	ctx := activity.Context(context.Background(), own)
+	ctx = activity.WithDependencies(ctx, []activity.Dependency{{Name: "dep", Tracker: dep}})
+	ctx = blackout.Context(ctx, schedule)
+
+	// the blackout begins after the first check, i.e., while waiting for the dependency
+	calls := 0
+	now := func() time.Time {
+		calls++
+		if calls == 2 {
+			return inBlackout
+		}
+		return time.Now()
+	}
+
+	dep.Begin()()
+	// must not wait for another activity of dep: its completed activity was not consumed by the first iteration
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	end, err := beginInvocationAt(ctx, now)
+	require.NoError(t, err)
+	end()
+	assert.Equal(t, 4, calls)
+
+	// the completed activity has been consumed by the invocation
+	waitCtx, waitCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer waitCancel()
+	_, err = activity.WaitForDependencies(waitCtx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
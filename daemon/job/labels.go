@@ -0,0 +1,74 @@
+package job
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+// Labels are the static labels of the jobs (config field `labels`), e.g., the
+// datacenter or customer, which are attached to the jobs' metrics and log entries.
+//
+// All metrics with the same name must have the same label names, hence every
+// job has a value for each label name that is used by any job.
+// The value is empty if the job does not set the label, which Prometheus
+// treats like an absent label.
+type Labels struct {
+	Names []string                     // sorted
+	ByJob map[string]prometheus.Labels // by job name, each has a value for all Names
+}
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// The label names used by the metrics of the jobs.
+// Static labels with these names would make the registration of the metrics fail.
+var reservedLabelNames = []string{"filesystem", "state", "prune_side", "side", "type", "outcome", "level", "transport"}
+
+func validateLabelName(name string) error {
+	if !labelNameRegexp.MatchString(name) {
+		return errors.Errorf("label name %q is invalid, must match %s", name, labelNameRegexp)
+	}
+	if strings.HasPrefix(name, "__") || strings.HasPrefix(name, "zrepl_") {
+		return errors.Errorf("label name %q is reserved, must not start with `__` or `zrepl_`", name)
+	}
+	for _, r := range reservedLabelNames {
+		if name == r {
+			return errors.Errorf("label name %q is reserved for zrepl's metrics", name)
+		}
+	}
+	return nil
+}
+
+func LabelsFromConfig(jobs []config.JobEnum) (*Labels, error) {
+	names := make(map[string]bool)
+	for _, j := range jobs {
+		for name := range j.Labels() {
+			if err := validateLabelName(name); err != nil {
+				return nil, errors.Wrapf(err, "job %q: field `labels`", j.Name())
+			}
+			names[name] = true
+		}
+	}
+
+	l := &Labels{
+		Names: make([]string, 0, len(names)),
+		ByJob: make(map[string]prometheus.Labels, len(jobs)),
+	}
+	for name := range names {
+		l.Names = append(l.Names, name)
+	}
+	sort.Strings(l.Names)
+	for _, j := range jobs {
+		labels := make(prometheus.Labels, len(l.Names))
+		for _, name := range l.Names {
+			labels[name] = j.Labels()[name]
+		}
+		l.ByJob[j.Name()] = labels
+	}
+	return l, nil
+}
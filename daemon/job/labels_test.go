@@ -0,0 +1,34 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func TestLabelsFromConfig(t *testing.T) {
+	snap := func(name string, labels map[string]string) config.JobEnum {
+		return config.JobEnum{Ret: &config.SnapJob{Name: name, Labels: labels}}
+	}
+	sink := config.JobEnum{Ret: &config.SinkJob{PassiveJob: config.PassiveJob{Name: "sink", Labels: map[string]string{"tier": "backup"}}}}
+
+	l, err := LabelsFromConfig([]config.JobEnum{
+		snap("a", map[string]string{"customer": "acme", "datacenter": "fra1"}),
+		snap("b", nil),
+		sink,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"customer", "datacenter", "tier"}, l.Names)
+	assert.Equal(t, prometheus.Labels{"customer": "acme", "datacenter": "fra1", "tier": ""}, l.ByJob["a"])
+	assert.Equal(t, prometheus.Labels{"customer": "", "datacenter": "", "tier": ""}, l.ByJob["b"])
+	assert.Equal(t, prometheus.Labels{"customer": "", "datacenter": "", "tier": "backup"}, l.ByJob["sink"])
+
+	for _, name := range []string{"", "1abc", "with-dash", "__internal", "zrepl_job", "filesystem"} {
+		_, err := LabelsFromConfig([]config.JobEnum{snap("a", map[string]string{name: "x"})})
+		assert.Error(t, err, "label name %q", name)
+	}
+}
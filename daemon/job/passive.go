@@ -3,6 +3,8 @@ package job
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -14,15 +16,23 @@ import (
 	"github.com/zrepl/zrepl/daemon/snapper"
 	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/rpc"
+	"github.com/zrepl/zrepl/rpc/dataconn/stream"
 	"github.com/zrepl/zrepl/transport"
 	"github.com/zrepl/zrepl/transport/fromconfig"
 	"github.com/zrepl/zrepl/zfs"
+	"github.com/zrepl/zrepl/zfs/zfscmd"
 )
 
 type PassiveSide struct {
-	mode   passiveMode
-	name   endpoint.JobID
-	listen transport.AuthenticatedListenerFactory
+	mode           passiveMode
+	name           endpoint.JobID
+	listen         transport.AuthenticatedListenerFactory
+	transportType  string
+	chunkSize      stream.ChunkSizeLimits
+	zfsCmdPriority *zfscmd.Priority // may be nil
+	drainTimeout   time.Duration
+
+	maxConnections, maxConnectionsPerClient int // zero means unlimited
 }
 
 type passiveMode interface {
@@ -70,7 +80,10 @@ func modeSourceFromConfig(g *config.Global, in *config.SourceJob, jobID endpoint
 		return nil, errors.Wrap(err, "send options")
 	}
 
-	if m.snapper, err = snapper.FromConfig(g, m.senderConfig.FSF, in.Snapshotting); err != nil {
+	if err := checkExternallyManagedSnapshotting(in.Send, in.Snapshotting); err != nil {
+		return nil, err
+	}
+	if m.snapper, err = snapper.FromConfig(g, jobID.String(), m.senderConfig.FSF, in.Snapshotting); err != nil {
 		return nil, errors.Wrap(err, "cannot build snapper")
 	}
 
@@ -80,7 +93,11 @@ func modeSourceFromConfig(g *config.Global, in *config.SourceJob, jobID endpoint
 func (m *modeSource) Type() Type { return TypeSource }
 
 func (m *modeSource) Handler() rpc.Handler {
-	return endpoint.NewSender(*m.senderConfig)
+	sender := endpoint.NewSender(*m.senderConfig)
+	if m.senderConfig.ReadOnly {
+		return endpoint.ReadOnlySender{Sender: sender}
+	}
+	return sender
 }
 
 func (m *modeSource) RunPeriodic(ctx context.Context) {
@@ -110,9 +127,43 @@ func passiveSideFromConfig(g *config.Global, in *config.PassiveJob, configJob in
 		return nil, err // no wrapping necessary
 	}
 
-	if s.listen, err = fromconfig.ListenerFactoryFromConfig(g, in.Serve); err != nil {
-		return nil, errors.Wrap(err, "cannot build listener factory")
+	var (
+		factories      []transport.AuthenticatedListenerFactory
+		transportTypes []string
+	)
+	for i, serve := range in.Serve {
+		lf, err := fromconfig.ListenerFactoryFromConfig(g, serve)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot build listener factory for serve #%d", i)
+		}
+		factories = append(factories, lf)
+		transportTypes = append(transportTypes, fromconfig.ServeTypeName(serve))
+
+		// the chunk size is a property of the job's handler, not of the individual connection
+		chunkSize, err := fromconfig.ChunkSizeLimitsFromConfig(serve.Ret)
+		if err != nil {
+			return nil, errors.Wrapf(err, "field `serve` #%d", i)
+		}
+		if i > 0 && chunkSize != s.chunkSize {
+			return nil, errors.New("field `serve`: all serve stanzas must use the same `chunk_size`")
+		}
+		s.chunkSize = chunkSize
+	}
+	s.listen = transport.MultiListenerFactory(factories)
+	s.transportType = strings.Join(transportTypes, ",")
+
+	if s.zfsCmdPriority, err = buildZFSCmdPriority(in.ProcessPriority); err != nil {
+		return nil, errors.Wrap(err, "field `process_priority`")
 	}
+	s.drainTimeout = in.DrainTimeout
+
+	if in.MaxConnections < 0 {
+		return nil, errors.New("field `max_connections` must not be negative")
+	}
+	if in.MaxConnectionsPerClient < 0 {
+		return nil, errors.New("field `max_connections_per_client` must not be negative")
+	}
+	s.maxConnections, s.maxConnectionsPerClient = in.MaxConnections, in.MaxConnectionsPerClient
 
 	return s, nil
 }
@@ -172,14 +223,23 @@ func (j *PassiveSide) Run(ctx context.Context) {
 		// the handlerCtx is clean => need to inherit logging and tracing config from job context
 		handlerCtx = logging.WithInherit(handlerCtx, ctx)
 		handlerCtx = trace.WithInherit(handlerCtx, ctx)
-
-		handlerCtx, endTask := trace.WithTaskAndSpan(handlerCtx, "handler", fmt.Sprintf("job=%q client=%q method=%q", j.Name(), info.ClientIdentity(), info.FullMethod()))
+		if j.zfsCmdPriority != nil {
+			handlerCtx = zfscmd.WithPriority(handlerCtx, j.zfsCmdPriority)
+		}
+		handlerCtx = stream.WithMetricLabels(handlerCtx, j.Name(), j.transportType)
+		handlerCtx = stream.WithChunkSizeLimits(handlerCtx, j.chunkSize)
+		if id := info.InvocationID(); id != "" {
+			handlerCtx = logging.WithInvocationID(handlerCtx, id)
+		}
+
+		handlerCtx, endTask := trace.WithTaskAndSpan(trace.WithNewTrace(handlerCtx), "handler", fmt.Sprintf("job=%q client=%q method=%q", j.Name(), info.ClientIdentity(), info.FullMethod()))
 		defer endTask()
 		handler(handlerCtx)
 	}
 
 	rpcLoggers := rpc.GetLoggersOrPanic(ctx) // WithSubsystemLoggers above
-	server := rpc.NewServer(handler, rpcLoggers, ctxInterceptor)
+	server := rpc.NewServer(handler, rpcLoggers, ctxInterceptor, j.drainTimeout)
+	server.SetConnectionLimits(j.maxConnections, j.maxConnectionsPerClient)
 
 	listener, err := j.listen()
 	if err != nil {
@@ -0,0 +1,109 @@
+// Package pause implements pausing of a job's replication streams (`zrepl signal pause|resume JOB`).
+//
+// A paused stream is not read from, which propagates backpressure to zfs send through the pipes
+// and the network connection, but neither the connection nor the zfs processes are torn down.
+package pause
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+type contextKey int
+
+const contextKeyGate contextKey = iota
+
+// Gate is the pause state of a single job.
+type Gate struct {
+	mtx     sync.Mutex
+	paused  bool
+	resumed chan struct{} // closed iff !paused
+}
+
+func NewGate() *Gate {
+	resumed := make(chan struct{})
+	close(resumed)
+	return &Gate{resumed: resumed}
+}
+
+var (
+	AlreadyPaused = errors.New("already paused")
+	NotPaused     = errors.New("not paused")
+)
+
+func (g *Gate) Pause() error {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if g.paused {
+		return AlreadyPaused
+	}
+	g.paused = true
+	g.resumed = make(chan struct{})
+	return nil
+}
+
+func (g *Gate) Resume() error {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if !g.paused {
+		return NotPaused
+	}
+	g.paused = false
+	close(g.resumed)
+	return nil
+}
+
+func (g *Gate) Paused() bool {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.paused
+}
+
+// Wait blocks while g is paused or until ctx is done, in which case it returns ctx.Err().
+func (g *Gate) Wait(ctx context.Context) error {
+	g.mtx.Lock()
+	resumed := g.resumed
+	g.mtx.Unlock()
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Context returns a context for a job that is paused while g is paused.
+// A job may have multiple Gates, e.g., one for manual pausing and one for blackout windows,
+// it is paused while any of them is paused.
+func Context(ctx context.Context, g *Gate) context.Context {
+	gates, _ := ctx.Value(contextKeyGate).([]*Gate)
+	gates = append(gates[:len(gates):len(gates)], g)
+	return context.WithValue(ctx, contextKeyGate, gates)
+}
+
+type readCloser struct {
+	ctx   context.Context
+	gates []*Gate
+	io.ReadCloser
+}
+
+func (r *readCloser) Read(p []byte) (int, error) {
+	for _, g := range r.gates {
+		if err := g.Wait(r.ctx); err != nil {
+			return 0, err
+		}
+	}
+	return r.ReadCloser.Read(p)
+}
+
+// ReadCloser returns a wrapper around stream whose reads block while the job of ctx is paused.
+// It returns stream as is if ctx has no Gate.
+func ReadCloser(ctx context.Context, stream io.ReadCloser) io.ReadCloser {
+	gates, _ := ctx.Value(contextKeyGate).([]*Gate)
+	if len(gates) == 0 {
+		return stream
+	}
+	return &readCloser{ctx, gates, stream}
+}
@@ -0,0 +1,71 @@
+package pause
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCloser(t *testing.T) {
+	g := NewGate()
+	ctx := Context(context.Background(), g)
+	r := ReadCloser(ctx, ioutil.NopCloser(strings.NewReader("foo")))
+
+	require.NoError(t, g.Pause())
+	assert.Equal(t, AlreadyPaused, g.Pause())
+	assert.True(t, g.Paused())
+
+	read := make(chan string)
+	go func() {
+		b, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		read <- string(b)
+	}()
+	select {
+	case <-read:
+		t.Fatal("reads must block while paused")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	require.NoError(t, g.Resume())
+	assert.Equal(t, NotPaused, g.Resume())
+	assert.Equal(t, "foo", <-read)
+
+	require.NoError(t, g.Pause())
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err := ReadCloser(ctx, ioutil.NopCloser(strings.NewReader("bar"))).Read(make([]byte, 3))
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestReadCloserMultipleGates(t *testing.T) {
+	manual, scheduled := NewGate(), NewGate()
+	ctx := Context(Context(context.Background(), manual), scheduled)
+	require.NoError(t, manual.Pause())
+	require.NoError(t, scheduled.Pause())
+
+	read := make(chan struct{})
+	go func() {
+		_, err := ReadCloser(ctx, ioutil.NopCloser(strings.NewReader("foo"))).Read(make([]byte, 3))
+		assert.NoError(t, err)
+		close(read)
+	}()
+	require.NoError(t, manual.Resume())
+	select {
+	case <-read:
+		t.Fatal("reads must block while any gate is paused")
+	case <-time.After(10 * time.Millisecond):
+	}
+	require.NoError(t, scheduled.Resume())
+	<-read
+}
+
+func TestReadCloserWithoutGate(t *testing.T) {
+	stream := ioutil.NopCloser(strings.NewReader("foo"))
+	assert.Equal(t, stream, ReadCloser(context.Background(), stream))
+}
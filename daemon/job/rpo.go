@@ -0,0 +1,88 @@
+package job
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/replication/logic"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// rpoCollector exports the effective recovery point objective (RPO) of an active job,
+// i.e., the age of the newest snapshot that has been replicated to the receiver,
+// per filesystem and for the job as a whole (the maximum over its filesystems).
+//
+// The RPO is computed when the metrics are collected, so it grows between replication attempts.
+type rpoCollector struct {
+	fsDesc, jobDesc *prometheus.Desc
+
+	mtx    sync.Mutex
+	newest map[string]time.Time // by filesystem
+}
+
+var _ logic.ReplicatedSnapshotObserver = (*rpoCollector)(nil)
+var _ prometheus.Collector = (*rpoCollector)(nil)
+
+func newRPOCollector(jobName string) *rpoCollector {
+	constLabels := prometheus.Labels{"zrepl_job": jobName}
+	return &rpoCollector{
+		fsDesc: prometheus.NewDesc("zrepl_replication_rpo_seconds",
+			"seconds since the creation of the newest snapshot of the filesystem that has been replicated to the receiver",
+			[]string{"filesystem"}, constLabels),
+		jobDesc: prometheus.NewDesc("zrepl_replication_job_rpo_seconds",
+			"maximum of zrepl_replication_rpo_seconds over the filesystems of the job",
+			nil, constLabels),
+		newest: make(map[string]time.Time),
+	}
+}
+
+func (c *rpoCollector) ObserveReplicatedSnapshot(fs string, newest *pdu.FilesystemVersion) {
+	creation, err := newest.CreationAsTime()
+	if err != nil {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.newest[fs] = creation
+}
+
+// retain forgets the filesystems that are not in fss, e.g. because they
+// are no longer matched by the job's filesystem filter.
+func (c *rpoCollector) retain(fss []string) {
+	keep := make(map[string]bool, len(fss))
+	for _, fs := range fss {
+		keep[fs] = true
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for fs := range c.newest {
+		if !keep[fs] {
+			delete(c.newest, fs)
+		}
+	}
+}
+
+func (c *rpoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.fsDesc
+	ch <- c.jobDesc
+}
+
+func (c *rpoCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if len(c.newest) == 0 {
+		return
+	}
+	now := time.Now()
+	var max float64
+	for fs, creation := range c.newest {
+		rpo := now.Sub(creation).Seconds()
+		if rpo > max {
+			max = rpo
+		}
+		ch <- prometheus.MustNewConstMetric(c.fsDesc, prometheus.GaugeValue, rpo, fs)
+	}
+	ch <- prometheus.MustNewConstMetric(c.jobDesc, prometheus.GaugeValue, max)
+}
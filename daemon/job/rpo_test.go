@@ -0,0 +1,62 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func collectRPO(t *testing.T, c *rpoCollector) (fss map[string]float64, job *float64) {
+	ch := make(chan prometheus.Metric, 10)
+	c.Collect(ch)
+	close(ch)
+	fss = make(map[string]float64)
+	for m := range ch {
+		var pb dto.Metric
+		require.NoError(t, m.Write(&pb))
+		v := pb.GetGauge().GetValue()
+		if m.Desc() == c.jobDesc {
+			job = &v
+			continue
+		}
+		for _, l := range pb.GetLabel() {
+			if l.GetName() == "filesystem" {
+				fss[l.GetValue()] = v
+			}
+		}
+	}
+	return fss, job
+}
+
+func TestRPOCollector(t *testing.T) {
+	c := newRPOCollector("job")
+
+	fss, job := collectRPO(t, c)
+	assert.Empty(t, fss)
+	assert.Nil(t, job)
+
+	snap := func(age time.Duration) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: "s", Creation: pdu.FilesystemVersionCreation(time.Now().Add(-age))}
+	}
+	c.ObserveReplicatedSnapshot("pool/a", snap(time.Hour))
+	c.ObserveReplicatedSnapshot("pool/b", snap(2*time.Hour))
+	c.ObserveReplicatedSnapshot("pool/b", snap(10*time.Minute))
+
+	fss, job = collectRPO(t, c)
+	require.Len(t, fss, 2)
+	assert.InDelta(t, 3600, fss["pool/a"], 5)
+	assert.InDelta(t, 600, fss["pool/b"], 5)
+	require.NotNil(t, job)
+	assert.Equal(t, fss["pool/a"], *job)
+
+	c.retain([]string{"pool/b"})
+	fss, job = collectRPO(t, c)
+	assert.Len(t, fss, 1)
+	assert.Equal(t, fss["pool/b"], *job)
+}
@@ -38,19 +38,19 @@ func (j *SnapJob) Type() Type { return TypeSnap }
 
 func snapJobFromConfig(g *config.Global, in *config.SnapJob) (j *SnapJob, err error) {
 	j = &SnapJob{}
-	fsf, err := filters.DatasetMapFilterFromConfig(in.Filesystems)
+	fsf, err := filters.DatasetFilterFromConfig(in.Filesystems, in.FilesystemsProperty)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot build filesystem filter")
 	}
 	j.fsfilter = fsf
 
-	if j.snapper, err = snapper.FromConfig(g, fsf, in.Snapshotting); err != nil {
-		return nil, errors.Wrap(err, "cannot build snapper")
-	}
 	j.name, err = endpoint.MakeJobID(in.Name)
 	if err != nil {
 		return nil, errors.Wrap(err, "invalid job name")
 	}
+	if j.snapper, err = snapper.FromConfig(g, j.name.String(), fsf, in.Snapshotting); err != nil {
+		return nil, errors.Wrap(err, "cannot build snapper")
+	}
 	j.promPruneSecs = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace:   "zrepl",
 		Subsystem:   "pruning",
@@ -58,7 +58,7 @@ func snapJobFromConfig(g *config.Global, in *config.SnapJob) (j *SnapJob, err er
 		Help:        "seconds spent in pruner",
 		ConstLabels: prometheus.Labels{"zrepl_job": j.name.String()},
 	}, []string{"prune_side"})
-	j.prunerFactory, err = pruner.NewLocalPrunerFactory(in.Pruning, j.promPruneSecs)
+	j.prunerFactory, err = pruner.NewLocalPrunerFactory(in.Pruning, in.Guardrails, j.promPruneSecs)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot build snapjob pruning rules")
 	}
@@ -84,6 +84,17 @@ func (j *SnapJob) Status() *Status {
 	return &Status{Type: t, JobSpecific: s}
 }
 
+// ConfirmDestroy confirms the pruning pass that awaits confirmation with token
+// (guardrails.confirm_destroy_fraction) and returns its side.
+// The caller should wake up the job afterwards.
+func (j *SnapJob) ConfirmDestroy(token string) (side string, _ error) {
+	c := j.prunerFactory.DestroyConfirmation()
+	if c == nil {
+		return "", errors.New("job does not require confirmation of pruning passes (guardrails.confirm_destroy_fraction)")
+	}
+	return c.Confirm(token)
+}
+
 func (j *SnapJob) OwnedDatasetSubtreeRoot() (rfs *zfs.DatasetPath, ok bool) {
 	return nil, false
 }
@@ -116,11 +127,17 @@ outer:
 		case <-wakeup.Wait(ctx):
 		case <-periodicDone:
 		}
+		endInvocation, err := beginInvocation(ctx)
+		if err != nil {
+			log.WithError(err).Info("context")
+			break outer
+		}
 		invocationCount++
 
-		invocationCtx, endSpan := trace.WithSpan(ctx, fmt.Sprintf("invocation-%d", invocationCount))
+		invocationCtx, endSpan := trace.WithSpan(trace.WithNewTrace(ctx), fmt.Sprintf("invocation-%d", invocationCount))
 		j.doPrune(invocationCtx)
 		endSpan()
+		endInvocation()
 	}
 }
 
@@ -136,8 +153,10 @@ outer:
 // But the pruner.Pruner gives up on an FS if no replication
 // cursor is present, which is why this pruner returns the
 // most recent filesystem version.
+// ActiveSide uses it for the same reason for the receiver pruner if the
+// sender's snapshots are externally managed (no replication cursor).
 type alwaysUpToDateReplicationCursorHistory struct {
-	// the Target passed as Target to BuildLocalPruner
+	// the Target passed as Target to BuildLocalPruner or BuildReceiverPruner
 	target pruner.Target
 }
 
@@ -0,0 +1,327 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/daemon/hooks"
+	"github.com/zrepl/zrepl/daemon/job/wakeup"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/util/envconst"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// TestRestoreJob periodically clones the most recent snapshot of each local filesystem,
+// runs a user command against the clone and destroys the clone afterwards.
+type TestRestoreJob struct {
+	name      endpoint.JobID
+	fsfilter  zfs.DatasetFilter
+	cloneRoot *zfs.DatasetPath
+	interval  config.PositiveDurationOrManual
+	command   *hooks.CommandHook
+
+	promFailures prometheus.Gauge
+
+	reportMtx sync.Mutex
+	report    *TestRestoreReport
+}
+
+type TestRestoreJobStatus struct {
+	Report *TestRestoreReport // nil if no test restore has been started yet
+}
+
+type TestRestoreReport struct {
+	StartAt, FinishAt time.Time
+	// Set if the invocation failed before the filesystems could be tested
+	Error       string
+	Filesystems []*TestRestoreFilesystemReport
+}
+
+type TestRestoreFilesystemReport struct {
+	Filesystem string
+	// Empty until determined
+	Snapshot, Clone string
+	// Set if the clone could not be created, checked or destroyed
+	Error string
+	// The tail of the combined stdout and stderr of a failed command,
+	// at most ZREPL_MAX_HOOK_REPORT_OUTPUT_SIZE bytes.
+	Output string
+}
+
+// Returns the number of filesystems whose test restore failed.
+func (r *TestRestoreReport) Failures() (n int) {
+	for _, fs := range r.Filesystems {
+		if fs.Error != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func testRestoreJobFromConfig(g *config.Global, in *config.TestRestoreJob) (j *TestRestoreJob, err error) {
+	j = &TestRestoreJob{
+		interval: in.Interval,
+	}
+	j.name, err = endpoint.MakeJobID(in.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid job name")
+	}
+	if j.fsfilter, err = filters.DatasetMapFilterFromConfig(in.Filesystems); err != nil {
+		return nil, errors.Wrap(err, "cannot build filesystem filter")
+	}
+	if j.cloneRoot, err = zfs.NewDatasetPath(in.CloneRoot); err != nil {
+		return nil, errors.Wrap(err, "field `clone_root`")
+	}
+	if j.cloneRoot.Empty() {
+		return nil, errors.New("field `clone_root` must not be empty")
+	}
+	if !filepath.IsAbs(in.Command) {
+		return nil, errors.Errorf("field `command` must be an absolute path, got %q", in.Command)
+	}
+	j.command, err = hooks.NewCommandHook(&config.HookCommand{
+		HookSettingsCommon: config.HookSettingsCommon{Type: "command"},
+		Path:               in.Command,
+		Timeout:            in.Timeout,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "field `command`")
+	}
+	j.promFailures = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "zrepl",
+		Subsystem:   "test_restore",
+		Name:        "failures",
+		Help:        "number of filesystems whose test restore failed in the latest invocation",
+		ConstLabels: prometheus.Labels{"zrepl_job": j.name.String()},
+	})
+	return j, nil
+}
+
+func (j *TestRestoreJob) Name() string { return j.name.String() }
+
+func (j *TestRestoreJob) RegisterMetrics(registerer prometheus.Registerer) {
+	registerer.MustRegister(j.promFailures)
+}
+
+func (j *TestRestoreJob) Status() *Status {
+	j.reportMtx.Lock()
+	defer j.reportMtx.Unlock()
+	return &Status{Type: TypeTestRestore, JobSpecific: &TestRestoreJobStatus{Report: j.report}}
+}
+
+func (j *TestRestoreJob) OwnedDatasetSubtreeRoot() (rfs *zfs.DatasetPath, ok bool) { return nil, false }
+
+func (j *TestRestoreJob) SenderConfig() *endpoint.SenderConfig { return nil }
+
+func (j *TestRestoreJob) Run(ctx context.Context) {
+	ctx, endTask := trace.WithTaskAndSpan(ctx, "test-restore-job", j.Name())
+	defer endTask()
+	log := GetLogger(ctx)
+
+	defer log.Info("job exiting")
+
+	var tick <-chan time.Time
+	if j.interval.Manual {
+		log.Info("manual test restore configured, periodic test restore disabled")
+	} else {
+		t := time.NewTicker(j.interval.Interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	invocationCount := 0
+outer:
+	for {
+		log.Info("wait for wakeups")
+		select {
+		case <-ctx.Done():
+			log.WithError(ctx.Err()).Info("context")
+			break outer
+		case <-wakeup.Wait(ctx):
+		case <-tick:
+		}
+		endInvocation, err := beginInvocation(ctx)
+		if err != nil {
+			log.WithError(err).Info("context")
+			break outer
+		}
+		invocationCount++
+		invocationCtx, endSpan := trace.WithSpan(ctx, fmt.Sprintf("invocation-%d", invocationCount))
+		j.do(invocationCtx)
+		endSpan()
+		endInvocation()
+	}
+}
+
+func (j *TestRestoreJob) updateReport(f func(r *TestRestoreReport)) {
+	j.reportMtx.Lock()
+	defer j.reportMtx.Unlock()
+	f(j.report)
+}
+
+func (j *TestRestoreJob) do(ctx context.Context) {
+	log := GetLogger(ctx)
+
+	j.reportMtx.Lock()
+	j.report = &TestRestoreReport{StartAt: time.Now()}
+	j.reportMtx.Unlock()
+	defer j.updateReport(func(r *TestRestoreReport) {
+		r.FinishAt = time.Now()
+		j.promFailures.Set(float64(r.Failures()))
+	})
+
+	fss, err := zfs.ZFSListMapping(ctx, j.fsfilter)
+	if err != nil {
+		err = errors.Wrap(err, "cannot list filesystems")
+		log.WithError(err).Error("test restore failed")
+		j.updateReport(func(r *TestRestoreReport) { r.Error = err.Error() })
+		return
+	}
+	sort.Slice(fss, func(i, k int) bool { return fss[i].ToString() < fss[k].ToString() })
+
+	for _, fs := range fss {
+		if fs.HasPrefix(j.cloneRoot) {
+			continue // our own clones
+		}
+		ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, fs)
+		if err != nil {
+			log.WithField("filesystem", fs.ToString()).WithError(err).Error("cannot determine placeholder state")
+			continue
+		}
+		if ph.IsPlaceholder {
+			log.WithField("filesystem", fs.ToString()).Debug("skipping placeholder filesystem")
+			continue
+		}
+		fsr := &TestRestoreFilesystemReport{Filesystem: fs.ToString()}
+		j.updateReport(func(r *TestRestoreReport) { r.Filesystems = append(r.Filesystems, fsr) })
+		if err := j.testFilesystem(ctx, fs, fsr); err != nil {
+			log.WithField("filesystem", fs.ToString()).WithError(err).Error("test restore failed")
+			j.updateReport(func(r *TestRestoreReport) { fsr.Error = err.Error() })
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+	log.Info("test restore finished")
+}
+
+// testRestoreCloneName returns the name of the clone of fs below cloneRoot.
+//
+// The clone is a direct child of cloneRoot because `zfs clone -p` would create
+// the intermediate filesystems as regular filesystems, which would collide with
+// the clones of parent filesystems in later invocations.
+// Name collisions (e.g. pool/a_b and pool/a/b) are harmless because
+// each clone is destroyed before the next filesystem is tested.
+func testRestoreCloneName(cloneRoot, fs *zfs.DatasetPath) (*zfs.DatasetPath, error) {
+	return zfs.NewDatasetPath(cloneRoot.ToString() + "/" + strings.Replace(fs.ToString(), "/", "_", -1))
+}
+
+// Fills fsr.Snapshot, fsr.Clone and fsr.Output, must only be called from TestRestoreJob.do
+func (j *TestRestoreJob) testFilesystem(ctx context.Context, fs *zfs.DatasetPath, fsr *TestRestoreFilesystemReport) (err error) {
+	clone, err := testRestoreCloneName(j.cloneRoot, fs)
+	if err != nil {
+		return errors.Wrap(err, "invalid clone name")
+	}
+	j.updateReport(func(r *TestRestoreReport) { fsr.Clone = clone.ToString() })
+	log := GetLogger(ctx).WithField("filesystem", fsr.Filesystem).WithField("clone", fsr.Clone)
+
+	fsPool, err := fs.Pool()
+	if err != nil {
+		return err
+	}
+	clonePool, err := j.cloneRoot.Pool()
+	if err != nil {
+		return err
+	}
+	if fsPool != clonePool {
+		return errors.Errorf("clone_root %q is not in the same pool as the filesystem", j.cloneRoot.ToString())
+	}
+
+	snaps, err := zfs.ZFSListFilesystemVersions(ctx, fs, zfs.ListFilesystemVersionsOptions{Types: zfs.Snapshots})
+	if err != nil {
+		return errors.Wrap(err, "cannot list snapshots")
+	}
+	if len(snaps) == 0 {
+		return errors.New("filesystem has no snapshots")
+	}
+	newest := snaps[0]
+	for _, s := range snaps[1:] {
+		if s.CreateTXG > newest.CreateTXG {
+			newest = s
+		}
+	}
+	j.updateReport(func(r *TestRestoreReport) { fsr.Snapshot = newest.RelName() })
+
+	if err := destroyStaleTestRestoreClone(ctx, clone); err != nil {
+		return err
+	}
+
+	props := zfs.NewZFSProperties()
+	props.Set("readonly", "on")
+	if err := zfs.ZFSClone(ctx, newest.ToAbsPath(fs), clone, props); err != nil {
+		// the clone might have been created but not mounted
+		if derr := zfs.ZFSDestroyIdempotent(ctx, clone.ToString()); derr != nil {
+			log.WithError(derr).Error("cannot destroy clone")
+		}
+		return errors.Wrap(err, "cannot create clone")
+	}
+	defer func() {
+		if derr := zfs.ZFSDestroy(ctx, clone.ToString()); derr != nil {
+			log.WithError(derr).Error("cannot destroy clone")
+			if err == nil {
+				err = errors.Wrap(derr, "cannot destroy clone")
+			}
+		}
+	}()
+
+	log.WithField("snapshot", fsr.Snapshot).Info("run command against clone")
+	env := hooks.Env{
+		hooks.EnvFS:       fsr.Filesystem,
+		hooks.EnvSnapshot: newest.Name,
+		hooks.EnvClone:    clone.ToString(),
+	}
+	report := j.command.Run(ctx, hooks.Post, hooks.PhaseTestRestore, false, env, make(map[interface{}]interface{}))
+	if !report.HadError() {
+		log.WithField("report", report.String()).Debug("command succeeded")
+		return nil
+	}
+	if cr, ok := report.(*hooks.CommandHookReport); ok {
+		maxOutput := envconst.Int("ZREPL_MAX_HOOK_REPORT_OUTPUT_SIZE", hooks.MAX_HOOK_REPORT_OUTPUT_SIZE_DEFAULT)
+		out := cr.CapturedStdoutStderrCombined
+		if len(out) > maxOutput {
+			out = out[len(out)-maxOutput:]
+		}
+		j.updateReport(func(r *TestRestoreReport) { fsr.Output = string(out) })
+	}
+	return errors.New(report.Error())
+}
+
+// destroyStaleTestRestoreClone destroys a clone that a previous invocation left behind,
+// e.g., because the daemon was stopped while the command ran.
+// It refuses to destroy a dataset that is not a clone.
+func destroyStaleTestRestoreClone(ctx context.Context, clone *zfs.DatasetPath) error {
+	props, err := zfs.ZFSGet(ctx, clone, []string{"origin"})
+	if _, ok := err.(*zfs.DatasetDoesNotExist); ok {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "cannot check for stale clone")
+	}
+	if props.Get("origin") == "-" {
+		return errors.Errorf("dataset %q exists and is not a clone, refusing to destroy it", clone.ToString())
+	}
+	GetLogger(ctx).WithField("clone", clone.ToString()).Info("destroy stale clone")
+	if err := zfs.ZFSDestroy(ctx, clone.ToString()); err != nil {
+		return errors.Wrap(err, "cannot destroy stale clone")
+	}
+	return nil
+}
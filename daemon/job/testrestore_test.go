@@ -0,0 +1,46 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestTestRestoreCloneName(t *testing.T) {
+	root, err := zfs.NewDatasetPath("pool/restore")
+	require.NoError(t, err)
+	fs, err := zfs.NewDatasetPath("pool/sink/host/data")
+	require.NoError(t, err)
+
+	clone, err := testRestoreCloneName(root, fs)
+	require.NoError(t, err)
+	assert.Equal(t, "pool/restore/pool_sink_host_data", clone.ToString())
+	assert.Equal(t, root.Length()+1, clone.Length(), "clones must be direct children of clone_root")
+}
+
+func TestTestRestoreJobFromConfig(t *testing.T) {
+	conf := func(cloneRoot, command string) *config.TestRestoreJob {
+		return &config.TestRestoreJob{
+			Type:        "test-restore",
+			Name:        "tr",
+			Filesystems: config.FilesystemsFilter{"pool/sink<": true},
+			Interval:    config.PositiveDurationOrManual{Manual: true},
+			CloneRoot:   cloneRoot,
+			Command:     command,
+		}
+	}
+
+	j, err := testRestoreJobFromConfig(nil, conf("pool/restore", "/usr/local/bin/check"))
+	require.NoError(t, err)
+	assert.Equal(t, "pool/restore", j.cloneRoot.ToString())
+
+	_, err = testRestoreJobFromConfig(nil, conf("pool/restore", "check"))
+	assert.Error(t, err, "relative command paths must be rejected")
+
+	_, err = testRestoreJobFromConfig(nil, conf("", "/usr/local/bin/check"))
+	assert.Error(t, err, "empty clone_root must be rejected")
+}
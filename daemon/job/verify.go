@@ -0,0 +1,312 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/daemon/job/wakeup"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/rpc"
+	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/transport/fromconfig"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// VerifyJob periodically compares checksums of the most recent snapshots
+// that the local filesystems (sending side) and the remote sink have in common.
+type VerifyJob struct {
+	name      endpoint.JobID
+	connecter transport.Connecter
+	fsfilter  zfs.DatasetFilter
+	interval  config.PositiveDurationOrManual
+	method    pdu.ChecksumMethod
+	versions  int
+
+	promMismatches prometheus.Gauge
+
+	reportMtx sync.Mutex
+	report    *VerifyReport
+}
+
+type VerifyJobStatus struct {
+	Report *VerifyReport // nil if no verification has been started yet
+}
+
+type VerifyReport struct {
+	StartAt, FinishAt time.Time
+	// Set if the invocation failed before the filesystems could be verified
+	Error       string
+	Filesystems []*VerifyFilesystemReport
+}
+
+type VerifyFilesystemReport struct {
+	Filesystem string
+	// Set if the filesystem could not be verified
+	Error    string
+	Versions []*VerifyVersionReport
+}
+
+type VerifyVersionReport struct {
+	Version                          string
+	SenderChecksum, ReceiverChecksum string
+}
+
+func (r *VerifyVersionReport) Match() bool {
+	return r.SenderChecksum == r.ReceiverChecksum
+}
+
+// Returns the number of versions with mismatching checksums.
+func (r *VerifyReport) Mismatches() (n int) {
+	for _, fs := range r.Filesystems {
+		for _, v := range fs.Versions {
+			if !v.Match() {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func verifyJobFromConfig(g *config.Global, in *config.VerifyJob) (j *VerifyJob, err error) {
+	j = &VerifyJob{
+		interval: in.Interval,
+		versions: in.Versions,
+	}
+	j.name, err = endpoint.MakeJobID(in.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid job name")
+	}
+	if j.fsfilter, err = filters.DatasetMapFilterFromConfig(in.Filesystems); err != nil {
+		return nil, errors.Wrap(err, "cannot build filesystem filter")
+	}
+	method, err := zfs.ChecksumMethodFromString(in.Method)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `method`")
+	}
+	switch method {
+	case zfs.ChecksumMethodStreamSize:
+		j.method = pdu.ChecksumMethod_ChecksumMethodStreamSize
+	case zfs.ChecksumMethodStreamSHA256:
+		j.method = pdu.ChecksumMethod_ChecksumMethodStreamSHA256
+	}
+	if j.versions < 1 {
+		return nil, errors.Errorf("field `versions` must be positive, got %d", in.Versions)
+	}
+	if j.connecter, err = fromconfig.ConnecterFromConfig(g, in.Connect); err != nil {
+		return nil, errors.Wrap(err, "cannot build client")
+	}
+	j.promMismatches = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "zrepl",
+		Subsystem:   "verify",
+		Name:        "mismatches",
+		Help:        "number of snapshots whose checksums differ between sender and receiver in the latest verification",
+		ConstLabels: prometheus.Labels{"zrepl_job": j.name.String()},
+	})
+	return j, nil
+}
+
+func (j *VerifyJob) Name() string { return j.name.String() }
+
+func (j *VerifyJob) RegisterMetrics(registerer prometheus.Registerer) {
+	registerer.MustRegister(j.promMismatches)
+}
+
+func (j *VerifyJob) Status() *Status {
+	j.reportMtx.Lock()
+	defer j.reportMtx.Unlock()
+	return &Status{Type: TypeVerify, JobSpecific: &VerifyJobStatus{Report: j.report}}
+}
+
+func (j *VerifyJob) OwnedDatasetSubtreeRoot() (rfs *zfs.DatasetPath, ok bool) { return nil, false }
+
+func (j *VerifyJob) SenderConfig() *endpoint.SenderConfig { return nil }
+
+func (j *VerifyJob) Run(ctx context.Context) {
+	ctx, endTask := trace.WithTaskAndSpan(ctx, "verify-job", j.Name())
+	defer endTask()
+	log := GetLogger(ctx)
+
+	defer log.Info("job exiting")
+
+	var tick <-chan time.Time
+	if j.interval.Manual {
+		log.Info("manual verification configured, periodic verification disabled")
+	} else {
+		t := time.NewTicker(j.interval.Interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	invocationCount := 0
+outer:
+	for {
+		log.Info("wait for wakeups")
+		select {
+		case <-ctx.Done():
+			log.WithError(ctx.Err()).Info("context")
+			break outer
+		case <-wakeup.Wait(ctx):
+		case <-tick:
+		}
+		endInvocation, err := beginInvocation(ctx)
+		if err != nil {
+			log.WithError(err).Info("context")
+			break outer
+		}
+		invocationCount++
+		invocationCtx, endSpan := trace.WithSpan(ctx, fmt.Sprintf("invocation-%d", invocationCount))
+		j.do(invocationCtx)
+		endSpan()
+		endInvocation()
+	}
+}
+
+func (j *VerifyJob) updateReport(f func(r *VerifyReport)) {
+	j.reportMtx.Lock()
+	defer j.reportMtx.Unlock()
+	f(j.report)
+}
+
+func (j *VerifyJob) do(ctx context.Context) {
+	log := GetLogger(ctx)
+
+	j.reportMtx.Lock()
+	j.report = &VerifyReport{StartAt: time.Now()}
+	j.reportMtx.Unlock()
+	defer j.updateReport(func(r *VerifyReport) {
+		r.FinishAt = time.Now()
+		j.promMismatches.Set(float64(r.Mismatches()))
+	})
+
+	sender := endpoint.NewSender(endpoint.SenderConfig{
+		JobID: j.name,
+		FSF:   j.fsfilter,
+		// encryption setting is irrelevant because the endpoint is not used for Send
+		Encrypt: &zfs.NilBool{B: false},
+	})
+	receiver := rpc.NewClient(j.connecter, rpc.GetLoggersOrPanic(ctx))
+	defer receiver.Close()
+
+	fail := func(err error) {
+		log.WithError(err).Error("verification failed")
+		j.updateReport(func(r *VerifyReport) { r.Error = err.Error() })
+	}
+
+	sfss, err := sender.ListFilesystems(ctx, &pdu.ListFilesystemReq{})
+	if err != nil {
+		fail(errors.Wrap(err, "cannot list sender filesystems"))
+		return
+	}
+	rfss, err := receiver.ListFilesystems(ctx, &pdu.ListFilesystemReq{})
+	if err != nil {
+		fail(errors.Wrap(err, "cannot list receiver filesystems"))
+		return
+	}
+	onReceiver := make(map[string]bool, len(rfss.GetFilesystems()))
+	for _, rfs := range rfss.GetFilesystems() {
+		onReceiver[rfs.GetPath()] = !rfs.GetIsPlaceholder()
+	}
+
+	fss := sfss.GetFilesystems()
+	sort.Slice(fss, func(i, k int) bool { return fss[i].GetPath() < fss[k].GetPath() })
+	for _, fs := range fss {
+		if !onReceiver[fs.GetPath()] {
+			log.WithField("filesystem", fs.GetPath()).Info("filesystem not present on receiver, skipping")
+			continue
+		}
+		fsr := &VerifyFilesystemReport{Filesystem: fs.GetPath()}
+		j.updateReport(func(r *VerifyReport) { r.Filesystems = append(r.Filesystems, fsr) })
+		if err := j.verifyFilesystem(ctx, sender, receiver, fsr); err != nil {
+			log.WithField("filesystem", fs.GetPath()).WithError(err).Error("cannot verify filesystem")
+			j.updateReport(func(r *VerifyReport) { fsr.Error = err.Error() })
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+	log.Info("verification finished")
+}
+
+// Fills fsr.Versions, must only be called from VerifyJob.do
+func (j *VerifyJob) verifyFilesystem(ctx context.Context, sender *endpoint.Sender, receiver *rpc.Client, fsr *VerifyFilesystemReport) error {
+	log := GetLogger(ctx).WithField("filesystem", fsr.Filesystem)
+
+	sres, err := sender.ListFilesystemVersions(ctx, &pdu.ListFilesystemVersionsReq{Filesystem: fsr.Filesystem})
+	if err != nil {
+		return errors.Wrap(err, "cannot list sender versions")
+	}
+	rres, err := receiver.ListFilesystemVersions(ctx, &pdu.ListFilesystemVersionsReq{Filesystem: fsr.Filesystem})
+	if err != nil {
+		return errors.Wrap(err, "cannot list receiver versions")
+	}
+
+	common := mostRecentCommonSnapshots(sres.GetVersions(), rres.GetVersions(), j.versions)
+	if len(common) == 0 {
+		return errors.New("sender and receiver have no snapshots in common")
+	}
+
+	for _, v := range common {
+		req := &pdu.ChecksumVersionReq{
+			Filesystem: fsr.Filesystem,
+			Version:    v,
+			Method:     j.method,
+		}
+		scs, err := sender.ChecksumVersion(ctx, req)
+		if err != nil {
+			return errors.Wrapf(err, "cannot compute sender checksum of %s", v.RelName())
+		}
+		rcs, err := receiver.ChecksumVersion(ctx, req)
+		if err != nil {
+			return errors.Wrapf(err, "cannot compute receiver checksum of %s", v.RelName())
+		}
+		vr := &VerifyVersionReport{
+			Version:          v.RelName(),
+			SenderChecksum:   scs.GetChecksum(),
+			ReceiverChecksum: rcs.GetChecksum(),
+		}
+		j.updateReport(func(r *VerifyReport) { fsr.Versions = append(fsr.Versions, vr) })
+		if !vr.Match() {
+			log.WithField("version", vr.Version).
+				WithField("sender_checksum", vr.SenderChecksum).
+				WithField("receiver_checksum", vr.ReceiverChecksum).
+				Error("checksum mismatch")
+		} else {
+			log.WithField("version", vr.Version).Debug("checksums match")
+		}
+	}
+	return nil
+}
+
+// Returns up to n snapshots that are present on both sides (by GUID),
+// most recent last. The returned versions are taken from sender.
+func mostRecentCommonSnapshots(sender, receiver []*pdu.FilesystemVersion, n int) []*pdu.FilesystemVersion {
+	onReceiver := make(map[uint64]bool, len(receiver))
+	for _, v := range receiver {
+		if v.GetType() == pdu.FilesystemVersion_Snapshot {
+			onReceiver[v.GetGuid()] = true
+		}
+	}
+	var common []*pdu.FilesystemVersion
+	for _, v := range sender {
+		if v.GetType() == pdu.FilesystemVersion_Snapshot && onReceiver[v.GetGuid()] {
+			common = append(common, v)
+		}
+	}
+	sort.Slice(common, func(i, k int) bool {
+		return common[i].GetCreateTXG() < common[k].GetCreateTXG()
+	})
+	if len(common) > n {
+		common = common[len(common)-n:]
+	}
+	return common
+}
@@ -0,0 +1,46 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestMostRecentCommonSnapshots(t *testing.T) {
+
+	snap := func(name string, guid, txg uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: name, Guid: guid, CreateTXG: txg}
+	}
+	book := func(name string, guid, txg uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Bookmark, Name: name, Guid: guid, CreateTXG: txg}
+	}
+
+	sender := []*pdu.FilesystemVersion{
+		snap("c", 3, 30),
+		snap("a", 1, 10),
+		book("b", 2, 20),
+		snap("d", 4, 40),
+		snap("e", 5, 50),
+	}
+	receiver := []*pdu.FilesystemVersion{
+		snap("a", 1, 100),
+		snap("b", 2, 200),
+		snap("c", 3, 300),
+		snap("d_renamed", 4, 400),
+	}
+
+	names := func(vs []*pdu.FilesystemVersion) (ns []string) {
+		for _, v := range vs {
+			ns = append(ns, v.Name)
+		}
+		return ns
+	}
+
+	// bookmark b is skipped, e is not on the receiver, d is matched by GUID and sorted by sender txg
+	assert.Equal(t, []string{"a", "c", "d"}, names(mostRecentCommonSnapshots(sender, receiver, 10)))
+	assert.Equal(t, []string{"c", "d"}, names(mostRecentCommonSnapshots(sender, receiver, 2)))
+	assert.Equal(t, []string{"d"}, names(mostRecentCommonSnapshots(sender, receiver, 1)))
+	assert.Empty(t, mostRecentCommonSnapshots(sender, nil, 1))
+}
@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"context"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/daemon/logging"
+)
+
+type contextKey int
+
+const (
+	contextKeyJobLabels contextKey = 1 + iota
+)
+
+// withJobLabels sets the static labels of the job that is started with ctx (see job.Labels).
+func withJobLabels(ctx context.Context, labels prometheus.Labels) context.Context {
+	return context.WithValue(ctx, contextKeyJobLabels, labels)
+}
+
+func jobLabelsFromContext(ctx context.Context) prometheus.Labels {
+	labels, _ := ctx.Value(contextKeyJobLabels).(prometheus.Labels)
+	return labels
+}
+
+// jobLabelsRegisterer returns a registerer that attaches the job's static labels
+// to the metrics that the job registers.
+func jobLabelsRegisterer(ctx context.Context, r prometheus.Registerer) prometheus.Registerer {
+	labels := jobLabelsFromContext(ctx)
+	if len(labels) == 0 {
+		return r
+	}
+	return prometheus.WrapRegistererWith(labels, r)
+}
+
+// The log field of a static label is the label name prefixed with this prefix.
+const jobLabelFieldPrefix = "label."
+
+// injectJobLabelFields injects the job's non-empty static labels into its log entries.
+func injectJobLabelFields(ctx context.Context) context.Context {
+	labels := jobLabelsFromContext(ctx)
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if labels[name] != "" {
+			ctx = logging.WithInjectedField(ctx, jobLabelFieldPrefix+name, labels[name])
+		}
+	}
+	return ctx
+}
+
+// registerJobLabelsMetric registers the info metric zrepl_job_labels, which maps
+// zrepl_job to the job's static labels, for metrics that are labeled with
+// zrepl_job but not registered by the job itself, e.g., the zfs command metrics.
+// They can be joined with it in PromQL, e.g.,
+// `... * on(zrepl_job) group_left(customer) zrepl_job_labels`.
+func registerJobLabelsMetric(r prometheus.Registerer, labels *job.Labels) {
+	if len(labels.Names) == 0 {
+		return
+	}
+	info := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "zrepl",
+		Name:      "job_labels",
+		Help:      "static labels of the job (config field `labels`), always 1",
+	}, append([]string{"zrepl_job"}, labels.Names...))
+	for jobName, jobLabels := range labels.ByJob {
+		values := prometheus.Labels{"zrepl_job": jobName}
+		for name, value := range jobLabels {
+			values[name] = value
+		}
+		info.With(values).Set(1)
+	}
+	r.MustRegister(info)
+}
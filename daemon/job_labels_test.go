@@ -0,0 +1,58 @@
+package daemon
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/job"
+)
+
+func TestJobLabelsMetrics(t *testing.T) {
+	labels := &job.Labels{
+		Names: []string{"customer"},
+		ByJob: map[string]prometheus.Labels{
+			"a": {"customer": "acme"},
+			"b": {"customer": ""},
+		},
+	}
+	reg := prometheus.NewRegistry()
+
+	// jobs with different label values register metrics with the same name
+	for _, name := range []string{"a", "b"} {
+		ctx := withJobLabels(context.Background(), labels.ByJob[name])
+		g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", ConstLabels: prometheus.Labels{"zrepl_job": name}})
+		require.NoError(t, jobLabelsRegisterer(ctx, reg).Register(g))
+	}
+	registerJobLabelsMetric(reg, labels)
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	series := make(map[string][]map[string]string)
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			ls := make(map[string]string)
+			for _, lp := range m.GetLabel() {
+				ls[lp.GetName()] = lp.GetValue()
+			}
+			series[mf.GetName()] = append(series[mf.GetName()], ls)
+		}
+	}
+	assert.ElementsMatch(t, []map[string]string{
+		{"zrepl_job": "a", "customer": "acme"},
+		{"zrepl_job": "b", "customer": ""},
+	}, series["test_gauge"])
+	assert.ElementsMatch(t, series["test_gauge"], series["zrepl_job_labels"])
+}
+
+func TestJobLabelsWithoutLabels(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	assert.Equal(t, prometheus.Registerer(reg), jobLabelsRegisterer(context.Background(), reg))
+	registerJobLabelsMetric(reg, &job.Labels{})
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	assert.Empty(t, mfs, "no info metric without labels")
+}
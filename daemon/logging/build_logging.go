@@ -43,6 +43,10 @@ func OutletsFromConfig(in config.LoggingOutletEnumList) (*logger.Outlets, error)
 			stdoutOutlets++
 		}
 
+		if d := outletCommon(le).DedupInterval; d > 0 {
+			outlet = NewDedupOutlet(outlet, d)
+		}
+
 		outlets.Add(outlet, minLevel)
 
 	}
@@ -73,6 +77,7 @@ const (
 	SubsysRPC          Subsystem = "rpc"
 	SubsysRPCControl   Subsystem = "rpc.ctrl"
 	SubsysRPCData      Subsystem = "rpc.data"
+	SubsysZFS          Subsystem = "zfs"
 	SubsysZFSCmd       Subsystem = "zfs.cmd"
 	SubsysTraceData    Subsystem = "trace.data"
 	SubsysPlatformtest Subsystem = "platformtest"
@@ -91,6 +96,7 @@ var AllSubsystems = []Subsystem{
 	SubsysRPC,
 	SubsysRPCControl,
 	SubsysRPCData,
+	SubsysZFS,
 	SubsysZFSCmd,
 	SubsysTraceData,
 	SubsysPlatformtest,
@@ -195,6 +201,19 @@ func parseLogFormat(i interface{}) (f EntryFormatter, err error) {
 
 }
 
+func outletCommon(in config.LoggingOutletEnum) config.LoggingOutletCommon {
+	switch v := in.Ret.(type) {
+	case *config.StdoutLoggingOutlet:
+		return v.LoggingOutletCommon
+	case *config.TCPLoggingOutlet:
+		return v.LoggingOutletCommon
+	case *config.SyslogLoggingOutlet:
+		return v.LoggingOutletCommon
+	default:
+		panic(v)
+	}
+}
+
 func ParseOutlet(in config.LoggingOutletEnum) (o logger.Outlet, level logger.Level, err error) {
 
 	parseCommon := func(common config.LoggingOutletCommon) (logger.Level, EntryFormatter, error) {
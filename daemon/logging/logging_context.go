@@ -7,11 +7,13 @@ type contextKey int
 const (
 	contextKeyLoggers contextKey = 1 + iota
 	contextKeyInjectedField
+	contextKeyInvocationID
 )
 
 var contextKeys = []contextKey{
 	contextKeyLoggers,
 	contextKeyInjectedField,
+	contextKeyInvocationID,
 }
 
 func WithInherit(ctx, inheritFrom context.Context) context.Context {
@@ -22,3 +24,18 @@ func WithInherit(ctx, inheritFrom context.Context) context.Context {
 	}
 	return ctx
 }
+
+// WithInvocationID associates ctx with the job invocation identified by id.
+// The id is added to all log entries produced from ctx (field InvocationField)
+// and propagated to the peer by package rpc so that the logs of both sides
+// of a replication can be correlated.
+func WithInvocationID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, contextKeyInvocationID, id)
+	return WithInjectedField(ctx, InvocationField, id)
+}
+
+// GetInvocationID returns the id passed to WithInvocationID, or "" if there is none.
+func GetInvocationID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKeyInvocationID).(string)
+	return id
+}
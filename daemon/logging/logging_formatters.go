@@ -23,6 +23,8 @@ const (
 	JobField    string = "job"
 	SubsysField string = "subsystem"
 	SpanField   string = "span"
+
+	InvocationField string = "invocation"
 )
 
 type MetadataFlags int64
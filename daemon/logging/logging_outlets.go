@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"fmt"
 	"io"
 	"log/syslog"
 	"net"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -172,3 +176,91 @@ func (o *SyslogOutlet) WriteEntry(entry logger.Entry) error {
 	}
 
 }
+
+// DedupOutlet collapses repeated identical warnings and errors,
+// e.g., when a filesystem fails the same way on every retry during an extended outage.
+//
+// The first occurrence of an entry is passed through to Outlet.
+// Identical entries that occur within Interval after it are suppressed and counted.
+// At the end of the interval, a single entry with the count is written instead.
+// Entries are identical if level, message and fields are equal,
+// ignoring fields that differ between job invocations (span, invocation ID).
+// Entries with a level below Warn are always passed through.
+type DedupOutlet struct {
+	Outlet   logger.Outlet
+	Interval time.Duration
+
+	mtx        sync.Mutex
+	suppressed map[string]*dedupState
+}
+
+type dedupState struct {
+	count int
+	last  logger.Entry
+}
+
+func NewDedupOutlet(outlet logger.Outlet, interval time.Duration) *DedupOutlet {
+	return &DedupOutlet{
+		Outlet:     outlet,
+		Interval:   interval,
+		suppressed: make(map[string]*dedupState),
+	}
+}
+
+func (o *DedupOutlet) String() string { return fmt.Sprintf("dedup(%s)", o.Outlet) }
+
+func dedupKey(e *logger.Entry) string {
+	var key strings.Builder
+	fmt.Fprintf(&key, "%d %q", e.Level, e.Message)
+	fields := make([]string, 0, len(e.Fields))
+	for f := range e.Fields {
+		if f == SpanField || f == InvocationField {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	for _, f := range fields {
+		fmt.Fprintf(&key, " %q=%q", f, fmt.Sprint(e.Fields[f]))
+	}
+	return key.String()
+}
+
+func (o *DedupOutlet) WriteEntry(entry logger.Entry) error {
+	if entry.Level < logger.Warn {
+		return o.Outlet.WriteEntry(entry)
+	}
+	key := dedupKey(&entry)
+
+	// Entries are written while holding mtx so that the first entry of an interval,
+	// the summary of the suppressed entries, and the state update for key stay in order.
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	if s, ok := o.suppressed[key]; ok {
+		s.count++
+		s.last = entry
+		return nil
+	}
+	o.suppressed[key] = &dedupState{}
+	time.AfterFunc(o.Interval, func() { o.endInterval(key) })
+	return o.Outlet.WriteEntry(entry)
+}
+
+// Writes the summary entry for the suppressed entries of key
+// and keeps suppressing for another interval if there were any.
+func (o *DedupOutlet) endInterval(key string) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	s := o.suppressed[key]
+	if s.count == 0 {
+		delete(o.suppressed, key)
+		return
+	}
+	summary := s.last
+	summary.Message = fmt.Sprintf("%s (repeated %d times in the last %s)", s.last.Message, s.count, o.Interval)
+	summary.Time = time.Now()
+	o.suppressed[key] = &dedupState{}
+	time.AfterFunc(o.Interval, func() { o.endInterval(key) })
+	// there is no logger to report the error to (same as logger's outlet error handling)
+	_ = o.Outlet.WriteEntry(summary)
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/logger"
+)
+
+type recordingOutlet struct {
+	mtx     sync.Mutex
+	entries []logger.Entry
+}
+
+func (o *recordingOutlet) WriteEntry(e logger.Entry) error {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.entries = append(o.entries, e)
+	return nil
+}
+
+func (o *recordingOutlet) messages() []string {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	var msgs []string
+	for _, e := range o.entries {
+		msgs = append(msgs, e.Message)
+	}
+	return msgs
+}
+
+func TestDedupOutlet(t *testing.T) {
+	rec := &recordingOutlet{}
+	interval := 100 * time.Millisecond
+	o := NewDedupOutlet(rec, interval)
+
+	entry := func(level logger.Level, msg, fs string, invocation int) logger.Entry {
+		return logger.Entry{
+			Level:   level,
+			Message: msg,
+			Time:    time.Now(),
+			Fields: logger.Fields{
+				"filesystem":    fs,
+				SpanField:       fmt.Sprintf("span-%d", invocation),
+				InvocationField: fmt.Sprintf("invocation-%d", invocation),
+			},
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, o.WriteEntry(entry(logger.Error, "replication failed", "pool/a", i)))
+		require.NoError(t, o.WriteEntry(entry(logger.Error, "replication failed", "pool/b", i)))
+		require.NoError(t, o.WriteEntry(entry(logger.Info, "starting", "pool/a", i)))
+	}
+	assert.Equal(t, []string{
+		"replication failed", "replication failed",
+		"starting", "starting", "starting", "starting", "starting",
+	}, rec.messages())
+
+	summary := fmt.Sprintf("replication failed (repeated 4 times in the last %s)", interval)
+	require.Eventually(t, func() bool { return len(rec.messages()) == 9 }, 10*interval, interval/10)
+	assert.Equal(t, []string{summary, summary}, rec.messages()[7:])
+	assert.Equal(t, logger.Error, rec.entries[7].Level)
+	assert.Equal(t, "invocation-4", rec.entries[7].Fields[InvocationField], "summary carries the fields of the last occurrence")
+
+	// no repetitions in the last interval => the next occurrence is passed through
+	time.Sleep(2 * interval)
+	require.NoError(t, o.WriteEntry(entry(logger.Error, "replication failed", "pool/a", 5)))
+	assert.Len(t, rec.messages(), 10)
+	assert.Equal(t, "replication failed", rec.messages()[9])
+}
@@ -106,7 +106,8 @@ import (
 )
 
 var metrics struct {
-	activeTasks prometheus.Gauge
+	activeTasks      prometheus.Gauge
+	otlpDroppedSpans prometheus.Counter
 }
 var taskNamer *uniqueConcurrentTaskNamer = newUniqueTaskNamer()
 
@@ -117,10 +118,17 @@ func init() {
 		Name:      "active_tasks",
 		Help:      "number of active (tracing-level) tasks in the daemon",
 	})
+	metrics.otlpDroppedSpans = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "zrepl",
+		Subsystem: "trace",
+		Name:      "otlp_dropped_spans",
+		Help:      "number of tasks and spans that could not be exported via OTLP (queue full or export error)",
+	})
 }
 
 func RegisterMetrics(r prometheus.Registerer) {
 	r.MustRegister(metrics.activeTasks)
+	r.MustRegister(metrics.otlpDroppedSpans)
 }
 
 type traceNode struct {
@@ -140,6 +148,8 @@ type traceNode struct {
 
 	startedAt time.Time
 	endedAt   time.Time
+
+	otlp otlpIDs // zero if the node is not exported
 }
 
 func (s *traceNode) StartedAt() time.Time { return s.startedAt }
@@ -173,10 +183,11 @@ var ErrTaskStillHasActiveChildTasks = fmt.Errorf("end task: task still has activ
 // a unique suffix is appended to uniquely identify the task opened with this function.
 func WithTask(ctx context.Context, taskName string) (context.Context, DoneFunc) {
 
-	var parentTask *traceNode
+	var parentTask, ctxNode *traceNode
 	nodeI := ctx.Value(contextKeyTraceNode)
 	if nodeI != nil {
 		node := nodeI.(*traceNode)
+		ctxNode = node
 		if node.parentSpan != nil {
 			parentTask = node.parentTask
 		} else {
@@ -225,6 +236,7 @@ func WithTask(ctx context.Context, taskName string) (context.Context, DoneFunc)
 		parentTask.mtx.Unlock()
 	}
 
+	ctx = otlpBeginNode(ctx, this, ctxNode)
 	ctx = context.WithValue(ctx, contextKeyTraceNode, this)
 
 	chrometraceBeginTask(this)
@@ -275,6 +287,7 @@ func WithTask(ctx context.Context, taskName string) (context.Context, DoneFunc)
 		}
 
 		chrometraceEndTask(this)
+		otlpEndNode(this, true)
 
 		metrics.activeTasks.Dec()
 
@@ -325,6 +338,7 @@ func WithSpan(ctx context.Context, annotation string) (context.Context, DoneFunc
 		parentSpan.activeChildSpan = this
 	})
 
+	ctx = otlpBeginNode(ctx, this, parentSpan)
 	ctx = context.WithValue(ctx, contextKeyTraceNode, this)
 	chrometraceBeginSpan(this)
 	callbackEndSpan := callbackBeginSpan(ctx)
@@ -349,6 +363,7 @@ func WithSpan(ctx context.Context, annotation string) (context.Context, DoneFunc
 		this.endedAt = time.Now()
 
 		chrometraceEndSpan(this)
+		otlpEndNode(this, false)
 		callbackEndSpan(this)
 	}
 
@@ -6,6 +6,7 @@ type contextKey int
 
 const (
 	contextKeyTraceNode contextKey = 1 + iota
+	contextKeyNewTrace
 )
 
 var contextKeys = []contextKey{
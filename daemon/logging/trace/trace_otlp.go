@@ -0,0 +1,278 @@
+package trace
+
+// The functions in this file export tasks and spans as OpenTelemetry spans
+// using the OTLP/HTTP protocol with JSON encoding:
+//   https://github.com/open-telemetry/opentelemetry-proto/blob/main/docs/specification.md
+//
+// Both tasks and spans are exported as OTLP spans.
+// The OTLP parent of a task is the span (or task) that was active in the context passed to WithTask.
+// By default, all tasks and spans in the daemon belong to the same trace.
+// Use WithNewTrace to start a separate trace, e.g., for each replication invocation.
+//
+// Only tasks and spans that start while an exporter is running are exported.
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type otlpIDs struct {
+	traceID      [16]byte
+	spanID       [8]byte
+	parentSpanID [8]byte // zero if the node is the root of its trace
+}
+
+func (ids *otlpIDs) valid() bool { return ids.spanID != [8]byte{} }
+
+var otlpRand struct {
+	mtx sync.Mutex
+	rnd *rand.Rand
+}
+
+func init() {
+	otlpRand.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+func otlpRandomBytes(b []byte) {
+	otlpRand.mtx.Lock()
+	defer otlpRand.mtx.Unlock()
+	otlpRand.rnd.Read(b)
+}
+
+// WithNewTrace makes the next task or span created from ctx the root of a new trace.
+// Tasks and spans created below that root belong to the new trace.
+func WithNewTrace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKeyNewTrace, true)
+}
+
+// Initializes the OTLP identifiers of a node that is created in ctx.
+// parent is the node that is active in ctx (nil for the root task).
+// The returned context must be used as the context of the node.
+func otlpBeginNode(ctx context.Context, this, parent *traceNode) context.Context {
+	newTrace, _ := ctx.Value(contextKeyNewTrace).(bool)
+	if newTrace {
+		ctx = context.WithValue(ctx, contextKeyNewTrace, false)
+	}
+	if atomic.LoadInt32(&otlpExporterRunning) == 0 {
+		return ctx
+	}
+	otlpRandomBytes(this.otlp.spanID[:])
+	if parent != nil && parent.otlp.valid() && !newTrace {
+		this.otlp.traceID = parent.otlp.traceID
+		this.otlp.parentSpanID = parent.otlp.spanID
+	} else {
+		otlpRandomBytes(this.otlp.traceID[:])
+	}
+	return ctx
+}
+
+func otlpEndNode(n *traceNode, isTask bool) {
+	if !n.otlp.valid() || atomic.LoadInt32(&otlpExporterRunning) == 0 {
+		return
+	}
+	kind := "span"
+	if isTask {
+		kind = "task"
+	}
+	s := otlpSpan{
+		TraceID:           hex.EncodeToString(n.otlp.traceID[:]),
+		SpanID:            hex.EncodeToString(n.otlp.spanID[:]),
+		Name:              n.annotation,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(n.startedAt.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(n.endedAt.UnixNano(), 10),
+		Attributes: []otlpKeyValue{
+			otlpStringAttribute("zrepl.task", n.TaskName()),
+			otlpStringAttribute("zrepl.kind", kind),
+		},
+	}
+	if n.otlp.parentSpanID != [8]byte{} {
+		s.ParentSpanID = hex.EncodeToString(n.otlp.parentSpanID[:])
+	}
+	select {
+	case otlpQueue <- s:
+	default:
+		metrics.otlpDroppedSpans.Inc()
+	}
+}
+
+// OTLP/JSON data model, see opentelemetry-proto/opentelemetry/proto/trace/v1/trace.proto
+
+const otlpSpanKindInternal = 1
+
+type otlpExportTraceServiceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string          `json:"key"`
+	Value otlpStringValue `json:"value"`
+}
+
+type otlpStringValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func otlpStringAttribute(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpStringValue{StringValue: value}}
+}
+
+type OTLPExporterConfig struct {
+	// URL of the OTLP/HTTP traces endpoint, e.g. http://localhost:4318/v1/traces
+	Endpoint string
+	// Additional HTTP headers, e.g. for authentication
+	Headers     map[string]string
+	ServiceName string
+	// Interval at which finished spans are sent to Endpoint
+	Interval time.Duration
+}
+
+const (
+	otlpQueueSize    = 1 << 14
+	otlpMaxBatchSize = 1 << 10
+)
+
+var (
+	otlpExporterRunning int32
+	otlpQueue           = make(chan otlpSpan, otlpQueueSize)
+)
+
+// RunOTLPExporter exports the tasks and spans that end while it is running
+// to the OTLP/HTTP endpoint in config until ctx is done.
+// Export errors are reported to onError and do not stop the exporter.
+// Only one exporter can run at a time.
+func RunOTLPExporter(ctx context.Context, config OTLPExporterConfig, onError func(error)) error {
+	if config.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if !atomic.CompareAndSwapInt32(&otlpExporterRunning, 0, 1) {
+		return fmt.Errorf("an OTLP exporter is already running")
+	}
+	defer atomic.StoreInt32(&otlpExporterRunning, 0)
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("cannot get hostname: %s", err)
+	}
+	resource := otlpResource{Attributes: []otlpKeyValue{
+		otlpStringAttribute("service.name", config.ServiceName),
+		otlpStringAttribute("host.name", hostname),
+	}}
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	var batch []otlpSpan
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := otlpExport(client, config, resource, batch); err != nil {
+			metrics.otlpDroppedSpans.Add(float64(len(batch)))
+			onError(err)
+		}
+		batch = nil
+	}
+
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// export what has been queued so far
+			for {
+				select {
+				case s := <-otlpQueue:
+					batch = append(batch, s)
+					if len(batch) >= otlpMaxBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return nil
+				}
+			}
+		case s := <-otlpQueue:
+			batch = append(batch, s)
+			if len(batch) >= otlpMaxBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func otlpExport(client *http.Client, config OTLPExporterConfig, resource otlpResource, spans []otlpSpan) error {
+	req := otlpExportTraceServiceRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: resource,
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/zrepl/zrepl/daemon/logging/trace"},
+				Spans: spans,
+			}},
+		}},
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	hreq, err := http.NewRequest(http.MethodPost, config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	for k, v := range config.Headers {
+		hreq.Header.Set(k, v)
+	}
+	res, err := client.Do(hreq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return fmt.Errorf("OTLP endpoint returned %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	return nil
+}
@@ -0,0 +1,85 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	var mtx sync.Mutex
+	var spans []otlpSpan
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("Authorization"))
+		var req otlpExportTraceServiceRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mtx.Lock()
+		defer mtx.Unlock()
+		for _, rs := range req.ResourceSpans {
+			assert.Contains(t, rs.Resource.Attributes, otlpStringAttribute("service.name", "zrepl-test"))
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	exporterCtx, stopExporter := context.WithCancel(context.Background())
+	exporterDone := make(chan error)
+	go func() {
+		exporterDone <- RunOTLPExporter(exporterCtx, OTLPExporterConfig{
+			Endpoint:    srv.URL,
+			Headers:     map[string]string{"Authorization": "secret"},
+			ServiceName: "zrepl-test",
+			Interval:    time.Hour,
+		}, func(err error) { t.Errorf("export error: %s", err) })
+	}()
+	for atomic.LoadInt32(&otlpExporterRunning) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	root, endRoot := WithTask(context.Background(), "root")
+	invocation, endInvocation := WithSpan(WithNewTrace(root), "invocation")
+	child, endChild := WithTask(invocation, "child")
+	_, endChildSpan := WithSpan(child, "child-span")
+	endChildSpan()
+	endChild()
+	endInvocation()
+	endRoot()
+
+	stopExporter()
+	require.NoError(t, <-exporterDone)
+
+	byName := make(map[string]otlpSpan)
+	for _, s := range spans {
+		byName[strings.SplitN(s.Name, "#", 2)[0]] = s // strip the unique task name suffix
+	}
+	require.Len(t, byName, 4)
+
+	assert.Empty(t, byName["root"].ParentSpanID)
+	assert.Empty(t, byName["invocation"].ParentSpanID, "WithNewTrace starts a new trace")
+	assert.NotEqual(t, byName["root"].TraceID, byName["invocation"].TraceID)
+
+	assert.Equal(t, byName["invocation"].TraceID, byName["child"].TraceID)
+	assert.Equal(t, byName["invocation"].SpanID, byName["child"].ParentSpanID)
+	assert.Equal(t, byName["invocation"].TraceID, byName["child-span"].TraceID)
+	assert.Equal(t, byName["child"].SpanID, byName["child-span"].ParentSpanID)
+	assert.Contains(t, byName["child-span"].Attributes, otlpStringAttribute("zrepl.kind", "span"))
+	assert.Contains(t, byName["child"].Attributes, otlpStringAttribute("zrepl.kind", "task"))
+}
+
+func TestOTLPExporterNotRunning(t *testing.T) {
+	root, endRoot := WithTask(context.Background(), "root")
+	endRoot()
+	assert.False(t, root.Value(contextKeyTraceNode).(*traceNode).otlp.valid())
+}
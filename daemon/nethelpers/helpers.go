@@ -3,7 +3,9 @@ package nethelpers
 import (
 	"net"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
 
 	"github.com/pkg/errors"
 )
@@ -48,3 +50,65 @@ func ListenUnixPrivate(sockaddr *net.UnixAddr) (*net.UnixListener, error) {
 
 	return net.ListenUnix("unix", sockaddr)
 }
+
+// SocketPermissions are applied to a socket after it has been created.
+type SocketPermissions struct {
+	Mode os.FileMode // 0 leaves the mode as created, i.e., as determined by the umask
+	GID  int         // -1 leaves the group as created
+}
+
+// SocketPermissionsFromConfig parses mode (octal permission bits) and group
+// (name or numeric gid). Empty strings leave the respective setting as created.
+func SocketPermissionsFromConfig(mode, group string) (p SocketPermissions, err error) {
+	p.GID = -1
+	if mode != "" {
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || m&^0777 != 0 || m == 0 {
+			return p, errors.Errorf("mode must be non-zero octal permission bits, got %q", mode)
+		}
+		p.Mode = os.FileMode(m)
+	}
+	if group != "" {
+		gid, err := strconv.ParseUint(group, 10, 32)
+		if err != nil {
+			g, lerr := user.LookupGroup(group)
+			if lerr != nil {
+				return p, errors.Wrapf(lerr, "cannot resolve group %q", group)
+			}
+			if gid, err = strconv.ParseUint(g.Gid, 10, 32); err != nil {
+				return p, errors.Errorf("non-numeric gid %q of group %q", g.Gid, group)
+			}
+		}
+		p.GID = int(gid)
+	}
+	return p, nil
+}
+
+func (p SocketPermissions) apply(path string) error {
+	if p.Mode != 0 {
+		if err := os.Chmod(path, p.Mode); err != nil {
+			return errors.Wrap(err, "cannot set socket permissions")
+		}
+	}
+	if p.GID != -1 {
+		if err := os.Chown(path, -1, p.GID); err != nil {
+			return errors.Wrap(err, "cannot set socket group")
+		}
+	}
+	return nil
+}
+
+// ListenUnixPrivateWithPermissions is ListenUnixPrivate followed by applying perms to the socket.
+// Since the socket directory must not be world-accessible, perms can only grant access
+// to the socket's group, which also requires the directory to be accessible to the group.
+func ListenUnixPrivateWithPermissions(sockaddr *net.UnixAddr, perms SocketPermissions) (*net.UnixListener, error) {
+	l, err := ListenUnixPrivate(sockaddr)
+	if err != nil {
+		return nil, err
+	}
+	if err := perms.apply(sockaddr.Name); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
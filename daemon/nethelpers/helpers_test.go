@@ -0,0 +1,48 @@
+package nethelpers
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocketPermissionsFromConfig(t *testing.T) {
+	p, err := SocketPermissionsFromConfig("", "")
+	require.NoError(t, err)
+	assert.Equal(t, SocketPermissions{Mode: 0, GID: -1}, p)
+
+	p, err = SocketPermissionsFromConfig("0660", "1234")
+	require.NoError(t, err)
+	assert.Equal(t, SocketPermissions{Mode: 0660, GID: 1234}, p)
+
+	for _, mode := range []string{"660x", "01777", "0", "rw-rw----"} {
+		_, err = SocketPermissionsFromConfig(mode, "")
+		assert.Error(t, err, mode)
+	}
+	_, err = SocketPermissionsFromConfig("", "zrepl-test-group-that-does-not-exist")
+	assert.Error(t, err)
+}
+
+func TestListenUnixPrivateWithPermissions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-nethelpers-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Chmod(dir, 0750))
+
+	path := filepath.Join(dir, "control")
+	perms, err := SocketPermissionsFromConfig("0660", strconv.Itoa(os.Getgid()))
+	require.NoError(t, err)
+	l, err := ListenUnixPrivateWithPermissions(&net.UnixAddr{Name: path, Net: "unix"}, perms)
+	require.NoError(t, err)
+	defer l.Close()
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), fi.Mode().Perm())
+}
@@ -0,0 +1,56 @@
+package daemon
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// otlpJob exports the daemon's trace tasks and spans to an OpenTelemetry collector.
+type otlpJob struct {
+	config trace.OTLPExporterConfig
+}
+
+func newOTLPJobFromConfig(in *config.OTLPMonitoring) (*otlpJob, error) {
+	u, err := url.Parse(in.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse endpoint")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("endpoint must be an http:// or https:// URL, got %q", in.Endpoint)
+	}
+	return &otlpJob{trace.OTLPExporterConfig{
+		Endpoint:    in.Endpoint,
+		Headers:     in.Headers,
+		ServiceName: in.ServiceName,
+		Interval:    in.Interval,
+	}}, nil
+}
+
+func (j *otlpJob) Name() string { return jobNameOTLP }
+
+func (j *otlpJob) Status() *job.Status { return &job.Status{Type: job.TypeInternal} }
+
+func (j *otlpJob) OwnedDatasetSubtreeRoot() (p *zfs.DatasetPath, ok bool) { return nil, false }
+
+func (j *otlpJob) SenderConfig() *endpoint.SenderConfig { return nil }
+
+func (j *otlpJob) RegisterMetrics(registerer prometheus.Registerer) {}
+
+func (j *otlpJob) Run(ctx context.Context) {
+	log := job.GetLogger(ctx)
+	err := trace.RunOTLPExporter(ctx, j.config, func(err error) {
+		log.WithError(err).Warn("cannot export spans")
+	})
+	if err != nil {
+		log.WithError(err).Error("cannot run OTLP exporter")
+	}
+}
@@ -5,15 +5,21 @@ import (
 	"net"
 	"net/http"
 
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/httpauth"
 	"github.com/zrepl/zrepl/daemon/job"
 	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/daemon/restapi"
+	"github.com/zrepl/zrepl/daemon/snapper"
+	"github.com/zrepl/zrepl/daemon/webui"
 	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/logger"
 	"github.com/zrepl/zrepl/rpc/dataconn/frameconn"
+	"github.com/zrepl/zrepl/rpc/dataconn/stream"
 	"github.com/zrepl/zrepl/util/tcpsock"
 	"github.com/zrepl/zrepl/zfs"
 )
@@ -21,13 +27,47 @@ import (
 type prometheusJob struct {
 	listen   string
 	freeBind bool
+	webUI    bool
+	api      bool
+	// for the web UI and the API
+	jobs        *jobs
+	historyPath string
+	tokens      *httpauth.Tokens
 }
 
-func newPrometheusJobFromConfig(in *config.PrometheusMonitoring) (*prometheusJob, error) {
-	if _, _, err := net.SplitHostPort(in.Listen); err != nil {
+func newPrometheusJobFromConfig(in *config.PrometheusMonitoring, jobs *jobs, historyPath string) (*prometheusJob, error) {
+	host, _, err := net.SplitHostPort(in.Listen)
+	if err != nil {
 		return nil, err
 	}
-	return &prometheusJob{in.Listen, in.ListenFreeBind}, nil
+	tokens, err := httpauth.TokensFromConfig(in.Tokens)
+	if err != nil {
+		return nil, errors.Wrap(err, "tokens")
+	}
+	if tokens != nil && !in.WebUI && !in.API {
+		return nil, errors.New("tokens require web_ui or api to be enabled")
+	}
+	if (in.WebUI || in.API) && tokens == nil && !isLoopbackHost(host) {
+		return nil, errors.New("web_ui and api without tokens require a loopback listen address, e.g. 127.0.0.1:9091")
+	}
+	return &prometheusJob{
+		listen:      in.Listen,
+		freeBind:    in.ListenFreeBind,
+		webUI:       in.WebUI,
+		api:         in.API,
+		jobs:        jobs,
+		historyPath: historyPath,
+		tokens:      tokens,
+	}, nil
+}
+
+// isLoopbackHost returns true if host (from a listen address) only accepts connections from the local host.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
 
 var prom struct {
@@ -64,8 +104,21 @@ func (j *prometheusJob) Run(ctx context.Context) {
 		panic(err)
 	}
 
+	if err := stream.PrometheusRegister(prometheus.DefaultRegisterer); err != nil {
+		panic(err)
+	}
+
+	if err := snapper.PrometheusRegister(prometheus.DefaultRegisterer); err != nil {
+		panic(err)
+	}
+
 	log := job.GetLogger(ctx)
 
+	if host, _, _ := net.SplitHostPort(j.listen); j.tokens != nil && !isLoopbackHost(host) {
+		log.WithField("listen", j.listen).
+			Warn("tokens are sent in clear text, restrict listen to a loopback address behind a reverse proxy that terminates TLS")
+	}
+
 	l, err := tcpsock.Listen(j.listen, j.freeBind)
 	if err != nil {
 		log.WithError(err).Error("cannot listen")
@@ -78,6 +131,21 @@ func (j *prometheusJob) Run(ctx context.Context) {
 
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
+	status := func() interface{} { return j.jobs.daemonStatus() }
+	if j.webUI {
+		mux.Handle(webUIPrefix+"/", http.StripPrefix(webUIPrefix, webui.Handler(log, status, j.historyPath, j.tokens)))
+	}
+	if j.api {
+		mux.Handle(restapi.PathPrefix+"/", http.StripPrefix(restapi.PathPrefix, restapi.Handler(log, restapi.Sources{
+			Status:      status,
+			Jobs:        j.jobs.status,
+			HistoryPath: j.historyPath,
+			Tokens:      j.tokens,
+			Signal: func(log restapi.Logger, name, op string) error {
+				return j.jobs.signal(log, name, op, "")
+			},
+		})))
+	}
 
 	err = http.Serve(l, mux)
 	if err != nil && ctx.Err() == nil {
@@ -86,6 +154,8 @@ func (j *prometheusJob) Run(ctx context.Context) {
 
 }
 
+const webUIPrefix = "/ui"
+
 type prometheusJobOutlet struct {
 }
 
@@ -0,0 +1,35 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func TestPrometheusWebUIAndAPIWithoutTokensRequireLoopback(t *testing.T) {
+	tokens := []config.MonitoringToken{{Name: "dashboard", Token: "cD8kT2xv9yQm4Lw1RzNf", Scopes: []string{"read"}}}
+	tcs := []struct {
+		listen string
+		tokens []config.MonitoringToken
+		ok     bool
+	}{
+		{"127.0.0.1:9091", nil, true},
+		{"[::1]:9091", nil, true},
+		{"localhost:9091", nil, true},
+		{":9091", nil, false},
+		{"0.0.0.0:9091", nil, false},
+		{"192.168.1.1:9091", nil, false},
+		{":9091", tokens, true},
+	}
+	for _, tc := range tcs {
+		_, err := newPrometheusJobFromConfig(&config.PrometheusMonitoring{Listen: tc.listen, API: true, Tokens: tc.tokens}, nil, "")
+		assert.Equal(t, tc.ok, err == nil, "api %s tokens=%v: %v", tc.listen, tc.tokens != nil, err)
+		_, err = newPrometheusJobFromConfig(&config.PrometheusMonitoring{Listen: tc.listen, WebUI: true, Tokens: tc.tokens}, nil, "")
+		assert.Equal(t, tc.ok, err == nil, "web_ui %s tokens=%v: %v", tc.listen, tc.tokens != nil, err)
+	}
+
+	_, err := newPrometheusJobFromConfig(&config.PrometheusMonitoring{Listen: ":9091"}, nil, "")
+	assert.NoError(t, err, "without web_ui and api, the listener is unrestricted")
+}
@@ -53,6 +53,8 @@ type args struct {
 	retryWait                      time.Duration
 	considerSnapAtCursorReplicated bool
 	promPruneSecs                  prometheus.Observer
+	guardrails                     config.Guardrails
+	confirmation                   *DestroyConfirmation // nil if guardrails.confirm_destroy_fraction is not set
 }
 
 type Pruner struct {
@@ -75,15 +77,20 @@ type PrunerFactory struct {
 	retryWait                      time.Duration
 	considerSnapAtCursorReplicated bool
 	promPruneSecs                  *prometheus.HistogramVec
+	guardrails                     config.Guardrails
+	confirmation                   *DestroyConfirmation
 }
 
 type LocalPrunerFactory struct {
 	keepRules     []pruning.KeepRule
 	retryWait     time.Duration
 	promPruneSecs *prometheus.HistogramVec
+	guardrails    config.Guardrails
+	confirmation  *DestroyConfirmation
 }
 
-func NewLocalPrunerFactory(in config.PruningLocal, promPruneSecs *prometheus.HistogramVec) (*LocalPrunerFactory, error) {
+// guardrails may be nil
+func NewLocalPrunerFactory(in config.PruningLocal, guardrails *config.Guardrails, promPruneSecs *prometheus.HistogramVec) (*LocalPrunerFactory, error) {
 	rules, err := pruning.RulesFromConfig(in.Keep)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot build pruning rules")
@@ -100,10 +107,17 @@ func NewLocalPrunerFactory(in config.PruningLocal, promPruneSecs *prometheus.His
 		retryWait:     envconst.Duration("ZREPL_PRUNER_RETRY_INTERVAL", 10*time.Second),
 		promPruneSecs: promPruneSecs,
 	}
+	if guardrails != nil {
+		f.guardrails = *guardrails
+	}
+	if f.confirmation, err = newDestroyConfirmation(f.guardrails); err != nil {
+		return nil, err
+	}
 	return f, nil
 }
 
-func NewPrunerFactory(in config.PruningSenderReceiver, promPruneSecs *prometheus.HistogramVec) (*PrunerFactory, error) {
+// guardrails may be nil
+func NewPrunerFactory(in config.PruningSenderReceiver, guardrails *config.Guardrails, promPruneSecs *prometheus.HistogramVec) (*PrunerFactory, error) {
 	keepRulesReceiver, err := pruning.RulesFromConfig(in.KeepReceiver)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot build receiver pruning rules")
@@ -129,9 +143,21 @@ func NewPrunerFactory(in config.PruningSenderReceiver, promPruneSecs *prometheus
 		considerSnapAtCursorReplicated: considerSnapAtCursorReplicated,
 		promPruneSecs:                  promPruneSecs,
 	}
+	if guardrails != nil {
+		f.guardrails = *guardrails
+	}
+	if f.confirmation, err = newDestroyConfirmation(f.guardrails); err != nil {
+		return nil, err
+	}
 	return f, nil
 }
 
+// DestroyConfirmation returns nil if the factory's pruners do not require confirmation of pruning passes.
+func (f *PrunerFactory) DestroyConfirmation() *DestroyConfirmation { return f.confirmation }
+
+// DestroyConfirmation returns nil if the factory's pruners do not require confirmation of pruning passes.
+func (f *LocalPrunerFactory) DestroyConfirmation() *DestroyConfirmation { return f.confirmation }
+
 func (f *PrunerFactory) BuildSenderPruner(ctx context.Context, target Target, receiver History) *Pruner {
 	p := &Pruner{
 		args: args{
@@ -142,6 +168,8 @@ func (f *PrunerFactory) BuildSenderPruner(ctx context.Context, target Target, re
 			f.retryWait,
 			f.considerSnapAtCursorReplicated,
 			f.promPruneSecs.WithLabelValues("sender"),
+			f.guardrails,
+			f.confirmation,
 		},
 		state: Plan,
 	}
@@ -158,6 +186,8 @@ func (f *PrunerFactory) BuildReceiverPruner(ctx context.Context, target Target,
 			f.retryWait,
 			false, // senseless here anyways
 			f.promPruneSecs.WithLabelValues("receiver"),
+			f.guardrails,
+			f.confirmation,
 		},
 		state: Plan,
 	}
@@ -174,6 +204,8 @@ func (f *LocalPrunerFactory) BuildLocalPruner(ctx context.Context, target Target
 			f.retryWait,
 			false, // considerSnapAtCursorReplicated is not relevant for local pruning
 			f.promPruneSecs.WithLabelValues("local"),
+			f.guardrails,
+			f.confirmation,
 		},
 		state: Plan,
 	}
@@ -464,6 +496,15 @@ tfss_loop:
 		pfs.destroyList = pruning.PruneSnapshots(pfs.snaps, a.rules)
 	}
 
+	err = checkGuardrails(a, pfss)
+	if err != nil {
+		u(func(p *Pruner) {
+			p.state = PlanErr
+			p.err = err
+		})
+		return
+	}
+
 	u(func(pruner *Pruner) {
 		pruner.execQueue = newExecQueue(len(pfss))
 		for _, pfs := range pfss {
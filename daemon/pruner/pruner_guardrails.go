@@ -0,0 +1,206 @@
+package pruner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/job/guardrails"
+)
+
+// DestroyLimitExceededError is the error of a pruning pass that was refused because it would have destroyed
+// more snapshots than permitted by config field guardrails.max_destroyed_snapshots.
+type DestroyLimitExceededError struct {
+	Destroy, Limit int
+}
+
+func (e *DestroyLimitExceededError) Error() string {
+	return fmt.Sprintf("refusing to destroy %d snapshots in a single pruning pass, the limit is %d (guardrails.max_destroyed_snapshots): "+
+		"check the pruning rules, or run `zrepl signal override JOB` if the destruction is intended", e.Destroy, e.Limit)
+}
+
+// checkGuardrails returns the error of checkDestroyLimit or checkDestroyFraction if either of them refuses the pass.
+// The guardrails override is only consumed if the pass proceeds, i.e., if checkDestroyFraction does not refuse it.
+func checkGuardrails(a *args, pfss []*fs) error {
+	overrideLimit, err := checkDestroyLimit(a, pfss)
+	if err != nil {
+		return err
+	}
+	if err := checkDestroyFraction(a, pfss); err != nil {
+		return err
+	}
+	if overrideLimit {
+		if !guardrails.FromContext(a.ctx).Consume() {
+			// disarmed in the meantime
+			err := &DestroyLimitExceededError{Destroy: destroyCount(pfss), Limit: a.guardrails.MaxDestroyedSnapshots}
+			GetLogger(a.ctx).WithError(err).Error("refusing pruning pass")
+			return err
+		}
+		GetLogger(a.ctx).WithField("destroy", destroyCount(pfss)).WithField("limit", a.guardrails.MaxDestroyedSnapshots).
+			Warn("pruning pass exceeds guardrails.max_destroyed_snapshots, proceeding because the guardrails were overridden (the override is consumed)")
+	}
+	return nil
+}
+
+func destroyCount(pfss []*fs) (destroy int) {
+	for _, pfs := range pfss {
+		destroy += len(pfs.destroyList)
+	}
+	return destroy
+}
+
+// checkDestroyLimit returns a *DestroyLimitExceededError if the destroy lists of pfss
+// exceed the limit of a.guardrails, unless the job's guardrails override is armed,
+// in which case it returns override = true. It does not consume the override, see checkGuardrails.
+func checkDestroyLimit(a *args, pfss []*fs) (override bool, err error) {
+	limit := a.guardrails.MaxDestroyedSnapshots
+	if limit <= 0 {
+		return false, nil
+	}
+	destroy := destroyCount(pfss)
+	if destroy <= limit {
+		return false, nil
+	}
+	if guardrails.FromContext(a.ctx).Armed() {
+		return true, nil
+	}
+	err = &DestroyLimitExceededError{Destroy: destroy, Limit: limit}
+	GetLogger(a.ctx).WithError(err).Error("refusing pruning pass")
+	return false, err
+}
+
+// DestroyConfirmationRequiredError is the error of a pruning pass that was skipped because it would have destroyed
+// a larger fraction of the existing snapshots than permitted by config field guardrails.confirm_destroy_fraction
+// and has not been confirmed.
+type DestroyConfirmationRequiredError struct {
+	Destroy, Total int
+	Token          string
+}
+
+func (e *DestroyConfirmationRequiredError) Error() string {
+	return fmt.Sprintf("pruning pass would destroy %d of %d snapshots, more than guardrails.confirm_destroy_fraction permits: "+
+		"skipped until confirmed with `zrepl signal confirm JOB %s`", e.Destroy, e.Total, e.Token)
+}
+
+func newDestroyConfirmation(g config.Guardrails) (*DestroyConfirmation, error) {
+	if g.ConfirmDestroyFraction < 0 || g.ConfirmDestroyFraction >= 1 {
+		return nil, errors.Errorf("guardrails.confirm_destroy_fraction must be in [0, 1), got %v", g.ConfirmDestroyFraction)
+	}
+	if g.ConfirmDestroyFraction == 0 {
+		return nil, nil
+	}
+	return NewDestroyConfirmation(), nil
+}
+
+// DestroyConfirmation tracks the pruning passes that await confirmation
+// because they would destroy a larger fraction of the existing snapshots than permitted.
+// Each side (sender, receiver, local) has at most one pending pass, identified by a token
+// that is derived from the pass's destroy list (see destroyListToken).
+// A confirmation permits a single pass on that side with exactly the confirmed destroy list:
+// if the destroy list changes before the next pass, the confirmation is void.
+type DestroyConfirmation struct {
+	mtx       sync.Mutex
+	pending   map[string]string // side => token
+	confirmed map[string]string // side => token
+}
+
+func NewDestroyConfirmation() *DestroyConfirmation {
+	return &DestroyConfirmation{
+		pending:   make(map[string]string),
+		confirmed: make(map[string]string),
+	}
+}
+
+// destroyListToken identifies the destroy lists of pfss on side.
+// It only depends on the set of snapshots to be destroyed, not on their order.
+func destroyListToken(side string, pfss []*fs) string {
+	var snaps []string
+	for _, pfs := range pfss {
+		for _, s := range pfs.destroyList {
+			snaps = append(snaps, fmt.Sprintf("%s@%s %d", pfs.path, s.Name(), s.(snapshot).fsv.GetGuid()))
+		}
+	}
+	sort.Strings(snaps)
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", side)
+	for _, s := range snaps {
+		fmt.Fprintf(h, "%s\n", s)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:4])
+}
+
+// Returns true and consumes the confirmation if the pass on side with token has been confirmed,
+// otherwise records it as the pending pass of side, replacing a previous pending or confirmed pass.
+func (c *DestroyConfirmation) confirmedOrPending(side, token string) (confirmed bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.confirmed[side] == token {
+		delete(c.confirmed, side)
+		delete(c.pending, side)
+		return true
+	}
+	delete(c.confirmed, side)
+	c.pending[side] = token
+	return false
+}
+
+// Drops the pending pass of side, if any, because it no longer needs confirmation.
+func (c *DestroyConfirmation) clear(side string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.pending, side)
+	delete(c.confirmed, side)
+}
+
+// Confirm confirms the pending pruning pass identified by token and returns its side.
+func (c *DestroyConfirmation) Confirm(token string) (side string, _ error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for s, t := range c.pending {
+		if t == token {
+			delete(c.pending, s)
+			c.confirmed[s] = token
+			return s, nil
+		}
+	}
+	return "", errors.Errorf("no pruning pass awaits confirmation with token %q", token)
+}
+
+// checkDestroyFraction returns a *DestroyConfirmationRequiredError if the destroy lists of pfss exceed
+// the fraction of the existing snapshots permitted by a.guardrails and the pass has not been confirmed.
+func checkDestroyFraction(a *args, pfss []*fs) error {
+	if a.confirmation == nil {
+		return nil
+	}
+	side := a.ctx.Value(contextKeyPruneSide).(string)
+	destroy, total := 0, 0
+	for _, pfs := range pfss {
+		destroy += len(pfs.destroyList)
+		total += len(pfs.snaps)
+	}
+	fraction := a.guardrails.ConfirmDestroyFraction
+	if total == 0 || float64(destroy) <= fraction*float64(total) {
+		a.confirmation.clear(side)
+		return nil
+	}
+	log := GetLogger(a.ctx).WithField("destroy", destroy).WithField("total", total).WithField("fraction", fraction)
+	token := destroyListToken(side, pfss)
+	if a.confirmation.confirmedOrPending(side, token) {
+		log.Warn("pruning pass exceeds guardrails.confirm_destroy_fraction, proceeding because it was confirmed")
+		return nil
+	}
+	err := &DestroyConfirmationRequiredError{Destroy: destroy, Total: total, Token: token}
+	perFS := make(map[string]int)
+	for _, pfs := range pfss {
+		if len(pfs.destroyList) > 0 {
+			perFS[pfs.path] = len(pfs.destroyList)
+		}
+	}
+	log.WithField("token", token).WithField("destroy_per_fs", perFS).WithError(err).Error("pruning pass awaits confirmation")
+	return err
+}
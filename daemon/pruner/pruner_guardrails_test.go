@@ -0,0 +1,101 @@
+package pruner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/job/guardrails"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func destroyListFS(path string, names ...string) *fs {
+	pfs := &fs{path: path}
+	for i, n := range names {
+		fsv := &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: n, Guid: uint64(i + 1)}
+		pfs.destroyList = append(pfs.destroyList, snapshot{fsv: fsv})
+	}
+	return pfs
+}
+
+func TestDestroyListToken(t *testing.T) {
+	a := destroyListToken("sender", []*fs{destroyListFS("pool/a", "s1", "s2"), destroyListFS("pool/b", "s1")})
+	b := destroyListToken("sender", []*fs{destroyListFS("pool/b", "s1"), destroyListFS("pool/a", "s1", "s2")})
+	assert.Equal(t, a, b, "token must not depend on the order of the filesystems")
+	assert.NotEqual(t, a, destroyListToken("receiver", []*fs{destroyListFS("pool/a", "s1", "s2"), destroyListFS("pool/b", "s1")}))
+	assert.NotEqual(t, a, destroyListToken("sender", []*fs{destroyListFS("pool/a", "s1", "s2")}))
+}
+
+func TestDestroyConfirmation(t *testing.T) {
+	c := NewDestroyConfirmation()
+
+	assert.False(t, c.confirmedOrPending("sender", "aaaa"))
+	assert.False(t, c.confirmedOrPending("sender", "aaaa"))
+
+	_, err := c.Confirm("wrong")
+	assert.Error(t, err)
+	side, err := c.Confirm("aaaa")
+	require.NoError(t, err)
+	assert.Equal(t, "sender", side)
+	_, err = c.Confirm("aaaa")
+	assert.Error(t, err, "the pass is no longer pending")
+
+	// the confirmation is consumed by the next pass with the same destroy list
+	assert.True(t, c.confirmedOrPending("sender", "aaaa"))
+	assert.False(t, c.confirmedOrPending("sender", "aaaa"))
+
+	// a changed destroy list voids the confirmation
+	_, err = c.Confirm("aaaa")
+	require.NoError(t, err)
+	assert.False(t, c.confirmedOrPending("sender", "bbbb"))
+	assert.False(t, c.confirmedOrPending("sender", "aaaa"))
+	_, err = c.Confirm("bbbb")
+	assert.Error(t, err, "the pending pass was replaced")
+
+	c.clear("sender")
+	_, err = c.Confirm("aaaa")
+	assert.Error(t, err)
+}
+
+func TestNewDestroyConfirmation(t *testing.T) {
+	c, err := newDestroyConfirmation(config.Guardrails{})
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+	c, err = newDestroyConfirmation(config.Guardrails{ConfirmDestroyFraction: 0.5})
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+	_, err = newDestroyConfirmation(config.Guardrails{ConfirmDestroyFraction: 1})
+	assert.Error(t, err)
+}
+
+func TestCheckGuardrailsConsumesOverrideOnlyIfPassProceeds(t *testing.T) {
+	override := guardrails.NewOverride()
+	override.Arm()
+	ctx := guardrails.Context(context.WithValue(context.Background(), contextKeyPruneSide, "sender"), override)
+	a := &args{
+		ctx:          ctx,
+		guardrails:   config.Guardrails{MaxDestroyedSnapshots: 1, ConfirmDestroyFraction: 0.5},
+		confirmation: NewDestroyConfirmation(),
+	}
+	pfs := destroyListFS("pool/a", "s1", "s2", "s3")
+	pfs.snaps = append(pfs.snaps, pfs.destroyList...)
+	pfss := []*fs{pfs}
+
+	// the limit is overridden, but the fraction check refuses
+	err := checkGuardrails(a, pfss)
+	require.IsType(t, &DestroyConfirmationRequiredError{}, err)
+	assert.True(t, override.Armed(), "the override must not be consumed by a refused pass")
+
+	_, err = a.confirmation.Confirm(err.(*DestroyConfirmationRequiredError).Token)
+	require.NoError(t, err)
+	assert.NoError(t, checkGuardrails(a, pfss))
+	assert.False(t, override.Armed(), "the override is consumed by the pass that proceeds")
+
+	// the limit refuses without override, the fraction check is not reached
+	err = checkGuardrails(a, pfss)
+	assert.IsType(t, &DestroyLimitExceededError{}, err)
+	assert.Empty(t, a.confirmation.pending)
+}
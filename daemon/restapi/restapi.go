@@ -0,0 +1,228 @@
+// Package restapi implements the REST API that the prometheus monitoring job
+// serves if `api` is enabled.
+//
+// The API mirrors the read-only endpoints of the control socket and the `zrepl history` command
+// as JSON over HTTP, so that dashboards and automation on other hosts can query the daemon
+// without access to the control socket.
+// If tokens are configured (package httpauth), the API also mirrors the wakeup, reset, pause and resume operations of the control socket's signal endpoint.
+// The listener does not terminate TLS, so the signal endpoint is only safe behind a reverse proxy that does.
+// The API is versioned through its path prefix; incompatible changes require a new version.
+package restapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zrepl/zrepl/daemon/history"
+	"github.com/zrepl/zrepl/daemon/httpauth"
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/version"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// The path prefix of the current API version.
+const PathPrefix = "/api/v1"
+
+// Endpoints relative to PathPrefix.
+const (
+	EndpointVersion = "/version"
+	EndpointStatus  = "/status"
+	EndpointJobs    = "/jobs"    // list of jobs, EndpointJobs/NAME is the status of job NAME
+	EndpointHistory = "/history" // query parameters: filesystem (required), snapshot, job, limit
+	// EndpointJobs/NAME/EndpointSignal, POST a SignalRequest
+	EndpointSignal = "/signal"
+)
+
+// The number of entries returned by EndpointHistory if the limit query parameter is absent,
+// and the maximum value of the limit query parameter.
+const (
+	HistoryDefaultLimit = 100
+	HistoryMaxLimit     = 10000
+)
+
+type Logger = logger.Logger
+
+type Sources struct {
+	// Returns the value of the control socket's status endpoint.
+	Status func() interface{}
+	// Returns the status of all jobs, by name.
+	Jobs func() map[string]*job.Status
+	// The path of the replication history file, empty if the history is disabled.
+	HistoryPath string
+	// nil if no tokens are configured, see httpauth.Tokens.
+	Tokens *httpauth.Tokens
+	// Performs an operation of the control socket's signal endpoint, one of SignalOps.
+	// The signal endpoint is only served if Signal and Tokens are not nil.
+	Signal func(log Logger, job, op string) error
+}
+
+// SignalOps are the operations of `zrepl signal` that the signal endpoint permits.
+// override and confirm approve destroys and initial replications,
+// so they are only available on the local control socket.
+var SignalOps = map[string]bool{"wakeup": true, "reset": true, "pause": true, "resume": true}
+
+// SignalRequest is the body of a request to the signal endpoint.
+type SignalRequest struct {
+	// one of SignalOps, like `zrepl signal`
+	Op string `json:"op"`
+}
+
+// Error is the body of all responses with a status code other than 200.
+type Error struct {
+	Error string `json:"error"`
+}
+
+// JobListEntry is an element of the response of EndpointJobs.
+type JobListEntry struct {
+	Name string   `json:"name"`
+	Type job.Type `json:"type"`
+}
+
+// Handler returns the handler for the API's endpoints, relative to PathPrefix.
+func Handler(log Logger, src Sources) http.Handler {
+	mux := http.NewServeMux()
+	read := func(h func(r *http.Request) (interface{}, int, error)) http.Handler {
+		return src.Tokens.Require(httpauth.ScopeRead, false, endpoint{log, http.MethodGet, h})
+	}
+	handle := func(pattern string, h func(r *http.Request) (interface{}, int, error)) {
+		mux.Handle(pattern, read(h))
+	}
+
+	handle(EndpointVersion, func(r *http.Request) (interface{}, int, error) {
+		return version.NewZreplVersionInformation(), http.StatusOK, nil
+	})
+	handle(EndpointStatus, func(r *http.Request) (interface{}, int, error) {
+		return src.Status(), http.StatusOK, nil
+	})
+	handle(EndpointJobs, func(r *http.Request) (interface{}, int, error) {
+		jobs := src.Jobs()
+		l := make([]JobListEntry, 0, len(jobs))
+		for name, s := range jobs {
+			l = append(l, JobListEntry{Name: name, Type: s.Type})
+		}
+		sort.Slice(l, func(i, j int) bool { return l[i].Name < l[j].Name })
+		return l, http.StatusOK, nil
+	})
+	jobStatus := read(func(r *http.Request) (interface{}, int, error) {
+		name := strings.TrimPrefix(r.URL.Path, EndpointJobs+"/")
+		s, ok := src.Jobs()[name]
+		if !ok {
+			return nil, http.StatusNotFound, fmt.Errorf("job %q does not exist", name)
+		}
+		return s, http.StatusOK, nil
+	})
+	var signal http.Handler
+	if src.Tokens != nil && src.Signal != nil {
+		signal = src.Tokens.Require(httpauth.ScopeSignal, false, endpoint{log, http.MethodPost, func(r *http.Request) (interface{}, int, error) {
+			name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, EndpointJobs+"/"), EndpointSignal)
+			if _, ok := src.Jobs()[name]; !ok {
+				return nil, http.StatusNotFound, fmt.Errorf("job %q does not exist", name)
+			}
+			// a cross-site form POST cannot set this content type without a CORS preflight
+			if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != "application/json" {
+				return nil, http.StatusUnsupportedMediaType, fmt.Errorf("content type must be application/json")
+			}
+			var req SignalRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				return nil, http.StatusBadRequest, fmt.Errorf("cannot decode request: %s", err)
+			}
+			if !SignalOps[req.Op] {
+				return nil, http.StatusBadRequest, fmt.Errorf("operation %q is not permitted, only wakeup, reset, pause and resume are", req.Op)
+			}
+			l := log.WithField("token", httpauth.TokenName(r))
+			l.WithField("job", name).WithField("op", req.Op).Info("api signal request")
+			if err := src.Signal(l, name, req.Op); err != nil {
+				return nil, http.StatusBadRequest, err
+			}
+			return struct{}{}, http.StatusOK, nil
+		}})
+	}
+	mux.Handle(EndpointJobs+"/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if signal != nil && strings.HasSuffix(r.URL.Path, EndpointSignal) {
+			signal.ServeHTTP(w, r)
+			return
+		}
+		jobStatus.ServeHTTP(w, r)
+	}))
+	handle(EndpointHistory, func(r *http.Request) (interface{}, int, error) {
+		if src.HistoryPath == "" {
+			return nil, http.StatusNotFound, fmt.Errorf("the replication history is disabled, see `global.history.path`")
+		}
+		q := r.URL.Query()
+		fs := q.Get("filesystem")
+		if _, err := zfs.NewDatasetPath(fs); err != nil || fs == "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("query parameter `filesystem` must be a valid filesystem name")
+		}
+		limit := HistoryDefaultLimit
+		if l := q.Get("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > HistoryMaxLimit {
+				return nil, http.StatusBadRequest, fmt.Errorf("query parameter `limit` must be a number between 1 and %d", HistoryMaxLimit)
+			}
+		}
+		entries, corrupt, err := history.ReadNewest(src.HistoryPath, history.Match(fs, q.Get("snapshot"), q.Get("job")), limit)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		if corrupt > 0 {
+			log.WithField("corrupt", corrupt).Warn("skipped corrupt lines in history file")
+		}
+		if entries == nil {
+			entries = []*history.Entry{}
+		}
+		return entries, http.StatusOK, nil
+	})
+	mux.Handle("/", endpoint{log, http.MethodGet, func(r *http.Request) (interface{}, int, error) {
+		return nil, http.StatusNotFound, fmt.Errorf("no such endpoint: %s", r.URL.Path)
+	}})
+	return mux
+}
+
+// endpoint serves the JSON encoding of the value or the Error returned by h, for requests with method
+// (GET includes HEAD).
+type endpoint struct {
+	log    Logger
+	method string
+	h      func(r *http.Request) (v interface{}, statusCode int, err error)
+}
+
+func (h endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		v          interface{}
+		statusCode int
+		err        error
+	)
+	if r.Method != h.method && !(h.method == http.MethodGet && r.Method == http.MethodHead) {
+		allow := h.method
+		if h.method == http.MethodGet {
+			allow = "GET, HEAD"
+		}
+		w.Header().Set("Allow", allow)
+		v, statusCode = &Error{fmt.Sprintf("method %s not allowed", r.Method)}, http.StatusMethodNotAllowed
+	} else if v, statusCode, err = h.h(r); err != nil {
+		if statusCode == http.StatusInternalServerError {
+			h.log.WithError(err).WithField("path", r.URL.Path).Error("api request failed")
+		}
+		v = &Error{err.Error()}
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		h.log.WithError(err).Error("api json marshal error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if _, err := io.Copy(w, &buf); err != nil {
+		h.log.WithError(err).Error("api io error")
+	}
+}
@@ -0,0 +1,216 @@
+package restapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/history"
+	"github.com/zrepl/zrepl/daemon/httpauth"
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/logger"
+)
+
+func TestHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-restapi-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	historyPath := filepath.Join(dir, "history.jsonl")
+	db, err := history.Open(historyPath)
+	require.NoError(t, err)
+	now := time.Now()
+	require.NoError(t, db.Append(&history.Entry{Time: now, Job: "offsite", Filesystem: "pool/a", To: history.Version{Name: "@s1"}}))
+	require.NoError(t, db.Append(&history.Entry{Time: now, Job: "offsite", Filesystem: "pool/b", To: history.Version{Name: "@s1"}}))
+	require.NoError(t, db.Append(&history.Entry{Time: now, Job: "offsite", Filesystem: "pool/b", To: history.Version{Name: "@s2"}}))
+	require.NoError(t, db.Close())
+
+	jobs := map[string]*job.Status{
+		"snap":    {Type: job.TypeSnap, JobSpecific: &job.SnapJobStatus{}},
+		"offsite": {Type: job.TypePush, JobSpecific: &job.ActiveSideStatus{}},
+	}
+	src := Sources{
+		Status:      func() interface{} { return map[string]interface{}{"Jobs": jobs} },
+		Jobs:        func() map[string]*job.Status { return jobs },
+		HistoryPath: historyPath,
+	}
+	srv := httptest.NewServer(http.StripPrefix(PathPrefix, Handler(logger.NewNullLogger(), src)))
+	defer srv.Close()
+
+	do := func(method, path string) (int, string) {
+		req, err := http.NewRequest(method, srv.URL+PathPrefix+path, nil)
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(body)
+	}
+	get := func(path string) (int, string) { return do(http.MethodGet, path) }
+
+	code, body := get("/version")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "RuntimeGo")
+
+	code, body = get("/jobs")
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `[{"name": "offsite", "type": "push"}, {"name": "snap", "type": "snap"}]`, body)
+
+	code, body = get("/jobs/snap")
+	assert.Equal(t, http.StatusOK, code)
+	var s job.Status
+	require.NoError(t, json.Unmarshal([]byte(body), &s))
+	assert.Equal(t, job.TypeSnap, s.Type)
+
+	code, body = get("/jobs/nonexistent")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Contains(t, body, `"error"`)
+
+	code, body = get("/status")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"offsite"`)
+
+	code, body = get("/history?filesystem=pool/a")
+	assert.Equal(t, http.StatusOK, code)
+	var entries []*history.Entry
+	require.NoError(t, json.Unmarshal([]byte(body), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "pool/a", entries[0].Filesystem)
+
+	code, body = get("/history?filesystem=pool/a&job=other")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "[]", strings.TrimSpace(body))
+
+	code, body = get("/history?filesystem=pool/b&limit=1")
+	assert.Equal(t, http.StatusOK, code)
+	entries = nil
+	require.NoError(t, json.Unmarshal([]byte(body), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "@s2", entries[0].To.Name)
+
+	code, _ = get("/history")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = get("/history?filesystem=pool/b&limit=0")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = get("/nonexistent")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = do(http.MethodPost, "/status")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	srv := httptest.NewServer(Handler(logger.NewNullLogger(), Sources{}))
+	defer srv.Close()
+	res, err := http.Get(srv.URL + EndpointHistory + "?filesystem=pool/a")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestSignal(t *testing.T) {
+	jobs := map[string]*job.Status{"offsite": {Type: job.TypePush, JobSpecific: &job.ActiveSideStatus{}}}
+	tokens, err := httpauth.TokensFromConfig([]config.MonitoringToken{
+		{Name: "dashboard", Token: "read-0123456789abcdef", Scopes: []string{"read"}},
+		{Name: "automation", Token: "signal-0123456789abcdef", Scopes: []string{"signal"}},
+	})
+	require.NoError(t, err)
+	var signalled []string
+	src := Sources{
+		Jobs:   func() map[string]*job.Status { return jobs },
+		Tokens: tokens,
+		Signal: func(log Logger, job, op string) error {
+			if op == "pause" {
+				return fmt.Errorf("job %q cannot be paused", job)
+			}
+			signalled = append(signalled, job+" "+op)
+			return nil
+		},
+	}
+	srv := httptest.NewServer(Handler(logger.NewNullLogger(), src))
+	defer srv.Close()
+
+	doContentType := func(method, path, token, contentType, body string) int {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	do := func(method, path, token, body string) int {
+		return doContentType(method, path, token, "application/json", body)
+	}
+	signal := EndpointJobs + "/offsite" + EndpointSignal
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, signal, "", `{"op": "wakeup"}`))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, signal, "read-0123456789abcdef", `{"op": "wakeup"}`))
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodGet, signal, "signal-0123456789abcdef", ""))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, signal, "signal-0123456789abcdef", `{"op": "wakeup"}`))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, signal, "signal-0123456789abcdef", `{"op": "reset"}`))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, signal, "signal-0123456789abcdef", `{"op": "pause"}`))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, signal, "signal-0123456789abcdef", `{"op": "destroy"}`))
+	// approving destroys and initial replications is only possible on the control socket
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, signal, "signal-0123456789abcdef", `{"op": "confirm", "confirm_token": "abc"}`))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, signal, "signal-0123456789abcdef", `{"op": "confirm"}`))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, signal, "signal-0123456789abcdef", `{"op": "override"}`))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, signal, "signal-0123456789abcdef", `not json`))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, EndpointJobs+"/nonexistent"+EndpointSignal, "signal-0123456789abcdef", `{"op": "wakeup"}`))
+	assert.Equal(t, http.StatusOK, doContentType(http.MethodPost, signal, "signal-0123456789abcdef", "application/json; charset=utf-8", `{"op": "wakeup"}`))
+
+	// what a cross-site form POST can send
+	assert.Equal(t, http.StatusUnsupportedMediaType, doContentType(http.MethodPost, signal, "signal-0123456789abcdef", "", `{"op": "wakeup"}`))
+	assert.Equal(t, http.StatusUnsupportedMediaType, doContentType(http.MethodPost, signal, "signal-0123456789abcdef", "text/plain", `{"op": "wakeup"}`))
+	assert.Equal(t, http.StatusUnsupportedMediaType, doContentType(http.MethodPost, signal, "signal-0123456789abcdef", "application/x-www-form-urlencoded", `op=wakeup`))
+	basicAuth := func() int {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+signal, strings.NewReader(`{"op": "wakeup"}`))
+		require.NoError(t, err)
+		req.SetBasicAuth("anyuser", "signal-0123456789abcdef")
+		req.Header.Set("Content-Type", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	assert.Equal(t, http.StatusUnauthorized, basicAuth())
+
+	assert.Equal(t, []string{"offsite wakeup", "offsite reset", "offsite wakeup"}, signalled)
+
+	// the read scope does not include signal, and vice versa
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, EndpointJobs+"/offsite", "read-0123456789abcdef", ""))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, EndpointJobs+"/offsite", "signal-0123456789abcdef", ""))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, EndpointStatus, "", ""))
+}
+
+func TestSignalRequiresTokens(t *testing.T) {
+	jobs := map[string]*job.Status{"offsite": {Type: job.TypePush, JobSpecific: &job.ActiveSideStatus{}}}
+	src := Sources{
+		Jobs:   func() map[string]*job.Status { return jobs },
+		Signal: func(log Logger, job, op string) error { panic("must not be called") },
+	}
+	srv := httptest.NewServer(Handler(logger.NewNullLogger(), src))
+	defer srv.Close()
+	res, err := http.Post(srv.URL+EndpointJobs+"/offsite"+EndpointSignal, "application/json", strings.NewReader(`{"op": "wakeup"}`))
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.NotEqual(t, http.StatusOK, res.StatusCode)
+}
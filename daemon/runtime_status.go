@@ -0,0 +1,39 @@
+package daemon
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/zrepl/zrepl/zfs/zfscmd"
+)
+
+// RuntimeStatus is a lightweight summary of the daemon's resource usage,
+// meant for spotting leaks without attaching pprof.
+type RuntimeStatus struct {
+	StartedAt  time.Time
+	Uptime     time.Duration
+	Goroutines int
+	// HeapAlloc is the size of allocated heap objects, HeapSys the heap memory
+	// obtained from the OS, both in bytes, see runtime.MemStats.
+	HeapAlloc uint64
+	HeapSys   uint64
+	NumGC     uint32
+	// The number of zfs child processes that have not exited yet.
+	ActiveZFSCmds int
+}
+
+var processStartedAt = time.Now()
+
+func getRuntimeStatus(zfsCmds *zfscmd.Report) *RuntimeStatus {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return &RuntimeStatus{
+		StartedAt:     processStartedAt,
+		Uptime:        time.Since(processStartedAt),
+		Goroutines:    runtime.NumGoroutine(),
+		HeapAlloc:     m.HeapAlloc,
+		HeapSys:       m.HeapSys,
+		NumGC:         m.NumGC,
+		ActiveZFSCmds: len(zfsCmds.Active),
+	}
+}
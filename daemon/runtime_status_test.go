@@ -0,0 +1,21 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/zfs/zfscmd"
+)
+
+func TestGetRuntimeStatus(t *testing.T) {
+	zfsCmds := &zfscmd.Report{Active: []zfscmd.ActiveCommand{{Path: "zfs"}, {Path: "zfs"}}}
+	s := getRuntimeStatus(zfsCmds)
+	assert.Equal(t, 2, s.ActiveZFSCmds)
+	assert.True(t, s.Goroutines > 0)
+	assert.True(t, s.HeapAlloc > 0)
+	assert.True(t, s.HeapSys >= s.HeapAlloc)
+	assert.True(t, s.Uptime > 0)
+	assert.WithinDuration(t, time.Now(), s.StartedAt.Add(s.Uptime), time.Second)
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/daemon/hooks"
+	"github.com/zrepl/zrepl/daemon/job/activity"
 	"github.com/zrepl/zrepl/daemon/logging"
 	"github.com/zrepl/zrepl/logger"
 	"github.com/zrepl/zrepl/util/envconst"
@@ -53,10 +54,12 @@ type args struct {
 	snapshotsTaken chan<- struct{}
 	hooks          *hooks.List
 	dryRun         bool
+	rateOfChange   *rateOfChange // nil if disabled
 }
 
 type Snapper struct {
-	args args
+	args     args
+	watchdog *watchdog
 
 	mtx   sync.Mutex
 	state State
@@ -109,7 +112,7 @@ func getLogger(ctx context.Context) Logger {
 	return logging.GetLogger(ctx, logging.SubsysSnapshot)
 }
 
-func PeriodicFromConfig(g *config.Global, fsf zfs.DatasetFilter, in *config.SnapshottingPeriodic) (*Snapper, error) {
+func PeriodicFromConfig(g *config.Global, jobName string, fsf zfs.DatasetFilter, in *config.SnapshottingPeriodic) (*Snapper, error) {
 	if in.Prefix == "" {
 		return nil, errors.New("prefix must not be empty")
 	}
@@ -117,20 +120,38 @@ func PeriodicFromConfig(g *config.Global, fsf zfs.DatasetFilter, in *config.Snap
 		return nil, errors.New("interval must be positive")
 	}
 
+	stallThreshold := in.StallThreshold
+	if stallThreshold == 0 {
+		stallThreshold = 2 * in.Interval
+	}
+
 	hookList, err := hooks.ListFromConfig(&in.Hooks)
 	if err != nil {
 		return nil, errors.Wrap(err, "hook config error")
 	}
 
+	var roc *rateOfChange
+	if in.RateOfChange != nil {
+		roc, err = rateOfChangeFromConfig(jobName, in.RateOfChange)
+		if err != nil {
+			return nil, errors.Wrap(err, "rate_of_change")
+		}
+	}
+
 	args := args{
-		prefix:   in.Prefix,
-		interval: in.Interval,
-		fsf:      fsf,
-		hooks:    hookList,
+		prefix:       in.Prefix,
+		interval:     in.Interval,
+		fsf:          fsf,
+		hooks:        hookList,
+		rateOfChange: roc,
 		// ctx and log is set in Run()
 	}
 
-	return &Snapper{state: SyncUp, args: args}, nil
+	return &Snapper{
+		state:    SyncUp,
+		args:     args,
+		watchdog: newWatchdog(jobName, in.Prefix, fsf, stallThreshold),
+	}, nil
 }
 
 func (s *Snapper) Run(ctx context.Context, snapshotsTaken chan<- struct{}) {
@@ -142,6 +163,20 @@ func (s *Snapper) Run(ctx context.Context, snapshotsTaken chan<- struct{}) {
 	s.args.ctx = ctx
 	s.args.dryRun = false // for future expansion
 
+	watchdogCtx, stopWatchdog := context.WithCancel(ctx)
+	watchdogDone := make(chan struct{})
+	go func() {
+		defer close(watchdogDone)
+		s.watchdog.run(watchdogCtx)
+	}()
+	defer func() {
+		stopWatchdog()
+		<-watchdogDone
+	}()
+	if s.args.rateOfChange != nil {
+		defer s.args.rateOfChange.deleteMetrics()
+	}
+
 	u := func(u func(*Snapper)) State {
 		s.mtx.Lock()
 		defer s.mtx.Unlock()
@@ -153,10 +188,24 @@ func (s *Snapper) Run(ctx context.Context, snapshotsTaken chan<- struct{}) {
 
 	var st state = syncUp
 
+	// jobs that are ordered after this job wait while snapshots are being taken
+	var endActivity func()
+	defer func() {
+		if endActivity != nil {
+			endActivity()
+		}
+	}()
+
 	for st != nil {
 		pre := u(nil)
 		st = st(s.args, u)
 		post := u(nil)
+		if active := post == Planning || post == Snapshotting; active && endActivity == nil {
+			endActivity = activity.Begin(ctx)
+		} else if !active && endActivity != nil {
+			endActivity()
+			endActivity = nil
+		}
 		getLogger(ctx).
 			WithField("transition", fmt.Sprintf("%s=>%s", pre, post)).
 			Debug("state transition")
@@ -223,6 +272,9 @@ func plan(a args, u updater) state {
 	if err != nil {
 		return onErr(err, u)
 	}
+	if a.rateOfChange != nil {
+		a.rateOfChange.prune(fss)
+	}
 
 	plan := make(map[*zfs.DatasetPath]*snapProgress, len(fss))
 	for _, fs := range fss {
@@ -261,6 +313,7 @@ func snapshot(a args, u updater) state {
 			hooks.EnvSnapshot: snapname,
 		}
 
+		snapshotCreated := false
 		jobCallback := hooks.NewCallbackHookForFilesystem("snapshot", fs, func(ctx context.Context) (err error) {
 			l := getLogger(ctx)
 			l.Debug("create snapshot")
@@ -268,6 +321,7 @@ func snapshot(a args, u updater) state {
 			if err != nil {
 				l.WithError(err).Error("cannot create snapshot")
 			}
+			snapshotCreated = err == nil
 			return
 		})
 
@@ -310,6 +364,10 @@ func snapshot(a args, u updater) state {
 			} else {
 				getLogger(ctx).WithField("report", planReport.String()).Info("end run job plan successful")
 			}
+			// after the post-snapshot hooks, which may, e.g., thaw the filesystem
+			if snapshotCreated && a.rateOfChange != nil {
+				a.rateOfChange.observe(ctx, fs, snapname)
+			}
 		}
 
 	updateFSState:
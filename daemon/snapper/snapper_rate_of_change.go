@@ -0,0 +1,173 @@
+package snapper
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/hooks"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// rateOfChange raises an alert if the data written to a filesystem between two consecutive snapshots
+// (the `written` property of the newer snapshot) exceeds the threshold, e.g., because of ransomware encrypting
+// the filesystem's contents or runaway logs.
+// The alert is logged, reflected in the metrics and the report, and the hooks are run once
+// when a filesystem starts to exceed the threshold.
+// It ends with the filesystem's next snapshot below the threshold,
+// or when the filesystem is no longer in the snapper's filesystem list.
+type rateOfChange struct {
+	jobName   string
+	threshold uint64
+	hooks     *hooks.RateOfChange // nil if no hooks are configured
+
+	mtx sync.Mutex
+	// filesystems that have a snapshot other than the one just taken, see hasPreviousSnapshot
+	hadPrevious map[string]bool
+	// filesystems for which prom.writtenBytes has a value
+	known map[string]bool
+	// filesystem => the snapshot that exceeded the threshold, for filesystems whose newest snapshot did
+	exceeded map[string]*ReportRateOfChange
+}
+
+func rateOfChangeFromConfig(jobName string, in *config.SnapshottingRateOfChange) (*rateOfChange, error) {
+	if in.Threshold == 0 {
+		return nil, errors.New("threshold must be positive")
+	}
+	h, err := hooks.RateOfChangeFromConfig(in.Hooks)
+	if err != nil {
+		return nil, errors.Wrap(err, "hook config error")
+	}
+	return &rateOfChange{
+		jobName:     jobName,
+		threshold:   uint64(in.Threshold),
+		hooks:       h,
+		hadPrevious: make(map[string]bool),
+		known:       make(map[string]bool),
+		exceeded:    make(map[string]*ReportRateOfChange),
+	}, nil
+}
+
+// observe checks the data written between fs@snapshot, which has just been taken, and its predecessor.
+func (r *rateOfChange) observe(ctx context.Context, fs *zfs.DatasetPath, snapshot string) {
+	l := getLogger(ctx)
+
+	// The written property of a filesystem's first snapshot is all of its data.
+	r.mtx.Lock()
+	hadPrevious := r.hadPrevious[fs.ToString()]
+	r.mtx.Unlock()
+	if !hadPrevious {
+		fsvs, err := zfs.ZFSListFilesystemVersions(ctx, fs, zfs.ListFilesystemVersionsOptions{Types: zfs.Snapshots})
+		if err != nil {
+			l.WithError(err).Error("rate of change: cannot list snapshots")
+			return
+		}
+		if len(fsvs) < 2 {
+			l.Debug("rate of change: first snapshot of filesystem, nothing to compare to")
+			return
+		}
+		r.mtx.Lock()
+		r.hadPrevious[fs.ToString()] = true
+		r.mtx.Unlock()
+	}
+
+	written, err := zfs.ZFSGetSnapshotWritten(ctx, fs.ToString(), snapshot)
+	if err != nil {
+		l.WithError(err).Error("rate of change: cannot get data written since previous snapshot")
+		return
+	}
+
+	r.mtx.Lock()
+	alert := r.update(ctx, fs.ToString(), snapshot, written)
+	r.mtx.Unlock()
+
+	if alert && r.hooks != nil {
+		r.hooks.RunRateOfChange(ctx, fs, snapshot, written, r.threshold)
+	}
+}
+
+// update records the data written to fs between snapshot and its predecessor
+// and returns true if fs starts to exceed the threshold with snapshot.
+// Caller must hold r.mtx.
+func (r *rateOfChange) update(ctx context.Context, fs, snapshot string, written uint64) (alert bool) {
+	prom.writtenBytes.WithLabelValues(r.jobName, fs).Set(float64(written))
+	r.known[fs] = true
+
+	l := getLogger(ctx).WithField("fs", fs).WithField("snap", snapshot).WithField("written", written).WithField("threshold", r.threshold)
+	_, wasExceeded := r.exceeded[fs]
+	if written > r.threshold {
+		if !wasExceeded {
+			l.Error("rate of change: data written since previous snapshot exceeds threshold")
+			alert = true
+		}
+		r.exceeded[fs] = &ReportRateOfChange{Path: fs, Snapshot: snapshot, Written: written, Threshold: r.threshold}
+	} else if wasExceeded {
+		l.Info("rate of change: data written since previous snapshot is back below threshold")
+		delete(r.exceeded, fs)
+	}
+	prom.rateOfChangeExceeded.WithLabelValues(r.jobName).Set(float64(len(r.exceeded)))
+	return alert
+}
+
+// prune forgets the filesystems that are not in fss, the snapper's current filesystem list,
+// i.e., filesystems that were destroyed or no longer match the filter.
+func (r *rateOfChange) prune(fss []*zfs.DatasetPath) {
+	current := make(map[string]bool, len(fss))
+	for _, fs := range fss {
+		current[fs.ToString()] = true
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for fs := range r.known {
+		if !current[fs] {
+			prom.writtenBytes.DeleteLabelValues(r.jobName, fs)
+			delete(r.known, fs)
+		}
+	}
+	for fs := range r.exceeded {
+		if !current[fs] {
+			delete(r.exceeded, fs)
+		}
+	}
+	for fs := range r.hadPrevious {
+		if !current[fs] {
+			delete(r.hadPrevious, fs)
+		}
+	}
+	prom.rateOfChangeExceeded.WithLabelValues(r.jobName).Set(float64(len(r.exceeded)))
+}
+
+func (r *rateOfChange) deleteMetrics() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for fs := range r.known {
+		prom.writtenBytes.DeleteLabelValues(r.jobName, fs)
+	}
+	prom.rateOfChangeExceeded.DeleteLabelValues(r.jobName)
+}
+
+type ReportRateOfChange struct {
+	Path string
+	// the newest snapshot of Path, whose predecessor it exceeded the threshold with
+	Snapshot  string
+	Written   uint64
+	Threshold uint64
+}
+
+func (r *rateOfChange) report() []*ReportRateOfChange {
+	if r == nil {
+		return nil
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	rep := make([]*ReportRateOfChange, 0, len(r.exceeded))
+	for _, e := range r.exceeded {
+		c := *e
+		rep = append(rep, &c)
+	}
+	sort.Slice(rep, func(i, j int) bool { return rep[i].Path < rep[j].Path })
+	return rep
+}
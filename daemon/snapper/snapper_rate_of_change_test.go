@@ -0,0 +1,79 @@
+package snapper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestRateOfChangeUpdate(t *testing.T) {
+	ctx := context.Background()
+	r, err := rateOfChangeFromConfig("testjob", &config.SnapshottingRateOfChange{Threshold: 1000})
+	require.NoError(t, err)
+	exceeded := func() (paths []string) {
+		for _, fs := range r.report() {
+			paths = append(paths, fs.Path)
+		}
+		return paths
+	}
+
+	assert.False(t, r.update(ctx, "pool/a", "s1", 100))
+	assert.False(t, r.update(ctx, "pool/b", "s1", 1000)) // not above the threshold
+	assert.Empty(t, exceeded())
+	assert.Equal(t, 100.0, testutil.ToFloat64(prom.writtenBytes.WithLabelValues("testjob", "pool/a")))
+
+	// the alert is raised once
+	assert.True(t, r.update(ctx, "pool/a", "s2", 5000))
+	assert.Equal(t, []string{"pool/a"}, exceeded())
+	assert.Equal(t, 1.0, testutil.ToFloat64(prom.rateOfChangeExceeded.WithLabelValues("testjob")))
+	assert.False(t, r.update(ctx, "pool/a", "s3", 6000))
+	assert.Equal(t, "s3", r.report()[0].Snapshot)
+
+	// and ends with the next snapshot below the threshold
+	assert.False(t, r.update(ctx, "pool/a", "s4", 10))
+	assert.Empty(t, exceeded())
+	assert.Equal(t, 0.0, testutil.ToFloat64(prom.rateOfChangeExceeded.WithLabelValues("testjob")))
+	assert.True(t, r.update(ctx, "pool/a", "s5", 5000))
+
+	r.deleteMetrics()
+}
+
+func TestRateOfChangePrune(t *testing.T) {
+	ctx := context.Background()
+	r, err := rateOfChangeFromConfig("testjob", &config.SnapshottingRateOfChange{Threshold: 1000})
+	require.NoError(t, err)
+	defer r.deleteMetrics()
+
+	assert.True(t, r.update(ctx, "pool/a", "s1", 5000))
+	assert.True(t, r.update(ctx, "pool/b", "s1", 5000))
+	assert.Len(t, r.report(), 2)
+
+	// pool/a was destroyed or no longer matches the filter
+	r.prune([]*zfs.DatasetPath{mustDatasetPath(t, "pool/b")})
+	require.Len(t, r.report(), 1)
+	assert.Equal(t, "pool/b", r.report()[0].Path)
+	assert.Equal(t, 1.0, testutil.ToFloat64(prom.rateOfChangeExceeded.WithLabelValues("testjob")))
+	assert.Equal(t, map[string]bool{"pool/b": true}, r.known)
+
+	r.prune(nil)
+	assert.Empty(t, r.report())
+	assert.Empty(t, r.known)
+	assert.Equal(t, 0.0, testutil.ToFloat64(prom.rateOfChangeExceeded.WithLabelValues("testjob")))
+}
+
+func mustDatasetPath(t *testing.T, s string) *zfs.DatasetPath {
+	p, err := zfs.NewDatasetPath(s)
+	require.NoError(t, err)
+	return p
+}
+
+func TestRateOfChangeFromConfig(t *testing.T) {
+	_, err := rateOfChangeFromConfig("testjob", &config.SnapshottingRateOfChange{})
+	assert.Error(t, err)
+}
@@ -17,6 +17,10 @@ type Report struct {
 	Error string
 	// valid in state Snapshotting
 	Progress []*ReportFilesystem
+	// filesystems whose newest snapshot is older than the stall threshold, in any state
+	Stalled []*ReportStalledFilesystem
+	// filesystems whose newest snapshot exceeded the rate_of_change threshold
+	RateOfChangeExceeded []*ReportRateOfChange `json:",omitempty"`
 }
 
 type ReportFilesystem struct {
@@ -28,6 +32,8 @@ type ReportFilesystem struct {
 	StartAt       time.Time
 	Hooks         string
 	HooksHadError bool
+	// Valid if HooksHadError
+	HookFailures []hooks.StepFailure
 
 	// Valid in SnapDone | SnapError
 	DoneAt time.Time
@@ -48,8 +54,10 @@ func (s *Snapper) Report() *Report {
 	for fs, p := range s.plan {
 		var hooksStr string
 		var hooksHadError bool
+		var hookFailures []hooks.StepFailure
 		if p.hookPlan != nil {
 			hr := p.hookPlan.Report()
+			hookFailures = hr.Failures()
 			// FIXME: technically this belongs into client
 			// but we can't serialize hooks.Step ATM
 			rightPad := func(str string, length int, pad string) string {
@@ -100,6 +108,7 @@ func (s *Snapper) Report() *Report {
 			DoneAt:        p.doneAt,
 			Hooks:         hooksStr,
 			HooksHadError: hooksHadError,
+			HookFailures:  hookFailures,
 		})
 	}
 
@@ -112,6 +121,9 @@ func (s *Snapper) Report() *Report {
 		SleepUntil: s.sleepUntil,
 		Error:      errOrEmptyString(s.err),
 		Progress:   pReps,
+		Stalled:    s.watchdog.report(),
+
+		RateOfChangeExceeded: s.args.rateOfChange.report(),
 	}
 
 	return r
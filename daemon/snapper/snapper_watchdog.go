@@ -0,0 +1,213 @@
+package snapper
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/util/envconst"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+var prom struct {
+	newestSnapshotAge  *prometheus.GaugeVec
+	stalledFilesystems *prometheus.GaugeVec
+
+	writtenBytes         *prometheus.GaugeVec
+	rateOfChangeExceeded *prometheus.GaugeVec
+}
+
+func init() {
+	prom.newestSnapshotAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "zrepl",
+		Subsystem: "snapshotting",
+		Name:      "newest_snapshot_age_seconds",
+		Help:      "age of the newest snapshot created by the snapshotter, per filesystem (counted from daemon start if older)",
+	}, []string{"zrepl_job", "filesystem"})
+	prom.stalledFilesystems = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "zrepl",
+		Subsystem: "snapshotting",
+		Name:      "stalled_filesystems",
+		Help:      "number of filesystems whose newest snapshot is older than the stall threshold",
+	}, []string{"zrepl_job"})
+	prom.writtenBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "zrepl",
+		Subsystem: "snapshotting",
+		Name:      "written_bytes",
+		Help:      "data written to the filesystem between its two newest snapshots, per filesystem (only with rate_of_change)",
+	}, []string{"zrepl_job", "filesystem"})
+	prom.rateOfChangeExceeded = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "zrepl",
+		Subsystem: "snapshotting",
+		Name:      "rate_of_change_exceeded_filesystems",
+		Help:      "number of filesystems whose newest snapshot exceeded the rate_of_change threshold",
+	}, []string{"zrepl_job"})
+}
+
+func PrometheusRegister(registry prometheus.Registerer) error {
+	if err := registry.Register(prom.newestSnapshotAge); err != nil {
+		return err
+	}
+	if err := registry.Register(prom.stalledFilesystems); err != nil {
+		return err
+	}
+	if err := registry.Register(prom.writtenBytes); err != nil {
+		return err
+	}
+	if err := registry.Register(prom.rateOfChangeExceeded); err != nil {
+		return err
+	}
+	return nil
+}
+
+// The watchdog detects that snapshotting stalls silently, e.g., because a hook hangs,
+// by periodically comparing the age of the newest snapshot of each filesystem against the threshold.
+// It works independently of the snapper's state machine so that it detects stalls in any state.
+type watchdog struct {
+	jobName   string
+	prefix    string
+	fsf       zfs.DatasetFilter
+	threshold time.Duration
+
+	mtx       sync.Mutex
+	startedAt time.Time
+	// filesystem => newest snapshot (or startedAt) of the filesystems that are currently stalled
+	stalled map[string]time.Time
+	// filesystems for which prom.newestSnapshotAge has a value
+	known map[string]bool
+}
+
+func newWatchdog(jobName, prefix string, fsf zfs.DatasetFilter, threshold time.Duration) *watchdog {
+	return &watchdog{
+		jobName:   jobName,
+		prefix:    prefix,
+		fsf:       fsf,
+		threshold: threshold,
+		stalled:   make(map[string]time.Time),
+		known:     make(map[string]bool),
+	}
+}
+
+func (w *watchdog) run(ctx context.Context) {
+	w.mtx.Lock()
+	w.startedAt = time.Now()
+	w.mtx.Unlock()
+
+	defer func() {
+		for fs := range w.known {
+			prom.newestSnapshotAge.DeleteLabelValues(w.jobName, fs)
+		}
+		prom.stalledFilesystems.DeleteLabelValues(w.jobName)
+	}()
+
+	t := time.NewTicker(w.checkInterval())
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := w.check(ctx, time.Now()); err != nil {
+				getLogger(ctx).WithError(err).Error("snapshot watchdog cannot check for stalled snapshotting")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+var watchdogMinCheckInterval = envconst.Duration("ZREPL_SNAPPER_WATCHDOG_MIN_CHECK_INTERVAL", 1*time.Second)
+
+// checkInterval is half the threshold, but at least watchdogMinCheckInterval
+// so that tiny thresholds (e.g., derived from a tiny snapshotting interval) neither panic the ticker nor spin.
+func (w *watchdog) checkInterval() time.Duration {
+	if i := w.threshold / 2; i > watchdogMinCheckInterval {
+		return i
+	}
+	return watchdogMinCheckInterval
+}
+
+func (w *watchdog) check(ctx context.Context, now time.Time) error {
+	fss, err := listFSes(ctx, w.fsf)
+	if err != nil {
+		return errors.Wrap(err, "list filesystems")
+	}
+
+	newest := make(map[string]time.Time, len(fss))
+	for _, fs := range fss {
+		fsvs, err := zfs.ZFSListFilesystemVersions(ctx, fs, zfs.ListFilesystemVersionsOptions{
+			Types:           zfs.Snapshots,
+			ShortnamePrefix: w.prefix,
+		})
+		if err != nil {
+			getLogger(ctx).WithField("fs", fs.ToString()).WithError(err).Error("snapshot watchdog cannot list snapshots")
+			continue
+		}
+		var n time.Time
+		for _, v := range fsvs {
+			if v.Creation.After(n) {
+				n = v.Creation
+			}
+		}
+		newest[fs.ToString()] = n
+	}
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.update(ctx, now, newest)
+	return nil
+}
+
+// newest maps a filesystem to the creation time of its newest snapshot (zero if none).
+// Caller must hold w.mtx.
+func (w *watchdog) update(ctx context.Context, now time.Time, newest map[string]time.Time) {
+	for fs := range w.known {
+		if _, ok := newest[fs]; !ok {
+			prom.newestSnapshotAge.DeleteLabelValues(w.jobName, fs)
+			delete(w.known, fs)
+			delete(w.stalled, fs)
+		}
+	}
+
+	for fs, n := range newest {
+		// Old snapshots, e.g., after the daemon was down for a while, do not count as a stall.
+		if n.Before(w.startedAt) {
+			n = w.startedAt
+		}
+		age := now.Sub(n)
+		prom.newestSnapshotAge.WithLabelValues(w.jobName, fs).Set(age.Seconds())
+		w.known[fs] = true
+
+		l := getLogger(ctx).WithField("fs", fs).WithField("newest_snapshot_age", age.Round(time.Second)).WithField("stall_threshold", w.threshold)
+		_, wasStalled := w.stalled[fs]
+		if age > w.threshold {
+			if !wasStalled {
+				l.Error("snapshotting stalled: no new snapshot within stall threshold")
+			}
+			w.stalled[fs] = n
+		} else if wasStalled {
+			l.Info("snapshotting recovered from stall")
+			delete(w.stalled, fs)
+		}
+	}
+	prom.stalledFilesystems.WithLabelValues(w.jobName).Set(float64(len(w.stalled)))
+}
+
+type ReportStalledFilesystem struct {
+	Path string
+	// creation time of the newest snapshot, or the time the daemon started if that is later
+	NewestSnapshot time.Time
+}
+
+func (w *watchdog) report() []*ReportStalledFilesystem {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	r := make([]*ReportStalledFilesystem, 0, len(w.stalled))
+	for fs, n := range w.stalled {
+		r = append(r, &ReportStalledFilesystem{Path: fs, NewestSnapshot: n})
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Path < r[j].Path })
+	return r
+}
@@ -0,0 +1,66 @@
+package snapper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchdogUpdate(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := newWatchdog("testjob", "zrepl_", nil, 20*time.Minute)
+	w.startedAt = start
+	stalled := func() (paths []string) {
+		for _, fs := range w.report() {
+			paths = append(paths, fs.Path)
+		}
+		return paths
+	}
+
+	// snapshots from before the start and filesystems without snapshots count from the start
+	w.update(ctx, start.Add(10*time.Minute), map[string]time.Time{
+		"pool/a": start.Add(-24 * time.Hour),
+		"pool/b": {},
+	})
+	assert.Empty(t, stalled())
+	assert.Equal(t, 600.0, testutil.ToFloat64(prom.newestSnapshotAge.WithLabelValues("testjob", "pool/a")))
+
+	// pool/b gets snapshotted, pool/a stalls
+	w.update(ctx, start.Add(30*time.Minute), map[string]time.Time{
+		"pool/a": start.Add(-24 * time.Hour),
+		"pool/b": start.Add(25 * time.Minute),
+	})
+	assert.Equal(t, []string{"pool/a"}, stalled())
+	assert.Equal(t, 1.0, testutil.ToFloat64(prom.stalledFilesystems.WithLabelValues("testjob")))
+
+	// pool/a recovers
+	w.update(ctx, start.Add(40*time.Minute), map[string]time.Time{
+		"pool/a": start.Add(35 * time.Minute),
+		"pool/b": start.Add(35 * time.Minute),
+	})
+	assert.Empty(t, stalled())
+	assert.Equal(t, 0.0, testutil.ToFloat64(prom.stalledFilesystems.WithLabelValues("testjob")))
+
+	// a stalled filesystem that no longer matches the filter is forgotten
+	w.update(ctx, start.Add(80*time.Minute), map[string]time.Time{
+		"pool/a": start.Add(35 * time.Minute),
+		"pool/b": start.Add(75 * time.Minute),
+	})
+	assert.Equal(t, []string{"pool/a"}, stalled())
+	w.update(ctx, start.Add(85*time.Minute), map[string]time.Time{
+		"pool/b": start.Add(75 * time.Minute),
+	})
+	assert.Empty(t, stalled())
+	assert.False(t, w.known["pool/a"])
+}
+
+func TestWatchdogCheckInterval(t *testing.T) {
+	assert.Equal(t, 10*time.Minute, newWatchdog("testjob", "zrepl_", nil, 20*time.Minute).checkInterval())
+	for _, threshold := range []time.Duration{0, 1, 1 * time.Millisecond} {
+		assert.Equal(t, watchdogMinCheckInterval, newWatchdog("testjob", "zrepl_", nil, threshold).checkInterval())
+	}
+}
@@ -0,0 +1,182 @@
+// Package statedir implements crash-safe append-only logs for the daemon's bookkeeping,
+// e.g., the replication history.
+//
+// Each log starts with a header line that identifies the kind of log and the
+// version of its schema, so that a zrepl version refuses logs written by a newer
+// version with an incompatible schema instead of misinterpreting them.
+//
+// Logs are created atomically (CreateLog): the header is written to a temporary file
+// in the same directory, synced to disk, and renamed to the log's path,
+// followed by a sync of the directory. Hence, after a crash or power loss, the
+// log either does not exist or has a complete header.
+// Their entries must be self-delimiting, e.g., JSON lines.
+//
+// Note that the replication cursors, step holds and resume tokens are stored in
+// ZFS and are thus not affected by this package.
+package statedir
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The first field of the header line.
+// This is a file format constant, changing it breaks existing files.
+const magic = "zrepl-state"
+
+// Header is the first line of a log of this package.
+type Header struct {
+	Kind    string // e.g. "history", must not contain whitespace
+	Version uint   // the version of the schema of the file's content
+}
+
+func (h Header) validate() error {
+	if h.Kind == "" || strings.ContainsAny(h.Kind, " \t\r\n") {
+		return errors.Errorf("invalid state file kind %q", h.Kind)
+	}
+	if h.Version == 0 {
+		return errors.New("state file schema version must be positive")
+	}
+	return nil
+}
+
+// Line returns the header line of an append-only log, including the trailing newline.
+func (h Header) Line() []byte {
+	return []byte(fmt.Sprintf("%s %s v%d\n", magic, h.Kind, h.Version))
+}
+
+// CorruptError is returned if a log's header is corrupt.
+type CorruptError struct {
+	Path   string
+	Reason string
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("state file %q is corrupt: %s", e.Path, e.Reason)
+}
+
+// UnsupportedVersionError is returned if a log's schema version is newer than
+// the version that the caller supports, i.e., it was written by a newer zrepl version.
+type UnsupportedVersionError struct {
+	Path             string
+	Kind             string
+	Version          uint
+	SupportedVersion uint
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("%s file %q has schema version %d, this version of zrepl supports up to version %d (downgrade after upgrade?)",
+		e.Kind, e.Path, e.Version, e.SupportedVersion)
+}
+
+// ParseHeader parses the header line of the log at path (for error messages),
+// without the trailing newline, and checks that it has the given kind and at most
+// version maxVersion.
+func ParseHeader(path string, line []byte, kind string, maxVersion uint) (h Header, err error) {
+	fields := strings.Fields(string(line))
+	if len(fields) != 3 || fields[0] != magic {
+		return h, &CorruptError{path, "missing header"}
+	}
+	h.Kind = fields[1]
+	if h.Kind != kind {
+		return h, &CorruptError{path, fmt.Sprintf("expected a %s file, got %s", kind, h.Kind)}
+	}
+	v, err := strconv.ParseUint(strings.TrimPrefix(fields[2], "v"), 10, 32)
+	if err != nil || !strings.HasPrefix(fields[2], "v") || v == 0 {
+		return h, &CorruptError{path, fmt.Sprintf("invalid schema version %q", fields[2])}
+	}
+	h.Version = uint(v)
+	if h.Version > maxVersion {
+		return h, &UnsupportedVersionError{path, kind, h.Version, maxVersion}
+	}
+	return h, nil
+}
+
+const tempSuffix = ".tmp"
+
+// CreateLog atomically creates the append-only log at path with h's header line
+// if it does not exist. It returns true if it created the file.
+// The file and its directory are synced to disk before CreateLog returns.
+func CreateLog(path string, h Header, perm os.FileMode) (created bool, err error) {
+	if err := h.validate(); err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return false, nil
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+	// concurrent creation is not a concern, the daemon is the only writer
+	return true, writeAtomic(path, h.Line(), perm)
+}
+
+func writeAtomic(path string, data []byte, perm os.FileMode) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, "."+name+".*"+tempSuffix)
+	if err != nil {
+		return errors.Wrap(err, "cannot create temporary file")
+	}
+	tmp := f.Name()
+	defer func() {
+		if tmp != "" {
+			os.Remove(tmp)
+		}
+	}()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "cannot write temporary file %q", tmp)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Wrap(err, "cannot rename temporary file")
+	}
+	tmp = ""
+	return SyncDir(dir)
+}
+
+// SyncDir syncs the directory dir to disk, making the creation, removal and
+// renaming of its entries durable.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrap(err, "cannot open directory for sync")
+	}
+	defer d.Close()
+	return errors.Wrapf(d.Sync(), "cannot sync directory %q", dir)
+}
+
+// RemoveStaleTempFiles removes the temporary files that CreateLog
+// left behind for path when it was interrupted by a crash.
+func RemoveStaleTempFiles(path string) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	stale, err := filepath.Glob(filepath.Join(dir, "."+name+".*"+tempSuffix))
+	if err != nil {
+		return err
+	}
+	for _, s := range stale {
+		if err := os.Remove(s); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "cannot remove stale temporary file")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package statedir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "zrepl-statedir-test")
+	require.NoError(t, err)
+	return dir
+}
+
+func TestCreateLog(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log")
+
+	created, err := CreateLog(path, Header{Kind: "test", Version: 3}, 0600)
+	require.NoError(t, err)
+	assert.True(t, created)
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "zrepl-state test v3\n", string(data))
+
+	h, err := ParseHeader(path, data[:len(data)-1], "test", 3)
+	require.NoError(t, err)
+	assert.Equal(t, Header{Kind: "test", Version: 3}, h)
+	_, err = ParseHeader(path, data[:len(data)-1], "other", 3)
+	assert.IsType(t, &CorruptError{}, err)
+	_, err = ParseHeader(path, data[:len(data)-1], "test", 2)
+	assert.IsType(t, &UnsupportedVersionError{}, err)
+	for _, corrupt := range []string{"", "entries", "zrepl-state test", "zrepl-state test 3", "zrepl-state test v0", "zrepl-state test v3 x"} {
+		_, err = ParseHeader(path, []byte(corrupt), "test", 3)
+		assert.IsType(t, &CorruptError{}, err, corrupt)
+	}
+
+	// an existing log is not touched
+	require.NoError(t, ioutil.WriteFile(path, []byte("entries\n"), 0600))
+	created, err = CreateLog(path, Header{Kind: "test", Version: 3}, 0600)
+	require.NoError(t, err)
+	assert.False(t, created)
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "entries\n", string(data))
+}
+
+func TestRemoveStaleTempFiles(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state")
+	other := filepath.Join(dir, ".other.123.tmp")
+	stale := filepath.Join(dir, ".state.123.tmp")
+	for _, p := range []string{path, other, stale} {
+		require.NoError(t, ioutil.WriteFile(p, nil, 0600))
+	}
+	require.NoError(t, RemoveStaleTempFiles(path))
+	_, err := os.Stat(stale)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+	_, err = os.Stat(other)
+	assert.NoError(t, err)
+}
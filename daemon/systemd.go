@@ -0,0 +1,65 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/util/sdnotify"
+)
+
+// notifySystemd sends state to systemd if the daemon runs as a Type=notify service.
+func notifySystemd(log logger.Logger, state string) {
+	sent, err := sdnotify.Notify(state)
+	if err != nil {
+		log.WithError(err).WithField("state", state).Error("cannot notify systemd")
+	} else if sent {
+		log.WithField("state", state).Debug("notified systemd")
+	}
+}
+
+// systemdWatchdog pings the systemd watchdog at half the interval configured
+// with WatchdogSec= as long as healthy returns within that time, so that systemd
+// restarts a daemon that is wedged, e.g., because of a deadlock.
+// It returns immediately if the watchdog is not enabled.
+func systemdWatchdog(ctx context.Context, log logger.Logger, healthy func()) {
+	interval, err := sdnotify.WatchdogInterval()
+	if err != nil {
+		log.WithError(err).Error("cannot determine systemd watchdog interval, watchdog disabled")
+		return
+	}
+	if interval == 0 {
+		return
+	}
+	period := interval / 2
+	log.WithField("interval", interval).Info("pinging systemd watchdog")
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		done := make(chan struct{})
+		go func() {
+			healthy()
+			close(done)
+		}()
+		select {
+		case <-done:
+			notifySystemd(log, sdnotify.Watchdog)
+		case <-time.After(period):
+			// don't start another check while the stuck one is pending, systemd will restart us
+			log.WithField("timeout", period).Error("daemon health check did not complete, not pinging systemd watchdog")
+			select {
+			case <-done:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
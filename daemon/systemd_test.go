@@ -0,0 +1,56 @@
+package daemon
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/logger"
+)
+
+func TestSystemdWatchdog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-systemd-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", path)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	os.Setenv("WATCHDOG_USEC", "100000") // 100ms
+	defer os.Unsetenv("WATCHDOG_USEC")
+
+	pings := func(healthy func()) (n int) {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		go systemdWatchdog(ctx, logger.NewNullLogger(), healthy)
+		buf := make([]byte, 64)
+		for {
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(600*time.Millisecond)))
+			m, err := conn.Read(buf)
+			if err != nil {
+				return n
+			}
+			assert.Equal(t, "WATCHDOG=1", string(buf[:m]))
+			n++
+			if ctx.Err() != nil {
+				return n
+			}
+		}
+	}
+
+	assert.True(t, pings(func() {}) >= 3)
+
+	wedged := make(chan struct{})
+	defer close(wedged)
+	assert.Equal(t, 0, pings(func() { <-wedged }))
+}
@@ -0,0 +1,361 @@
+package webui
+
+// indexHTML is the complete UI: markup, style and script in a single file without external dependencies.
+// It renders the JSON of EndpointStatus and EndpointHistory, which it fetches relative to its own URL.
+// The error drill-down mirrors the problems that `zrepl status --check` counts.
+const indexHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>zrepl status</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+h1 { font-size: 1.4em; }
+h2 { font-size: 1.2em; margin-top: 1.5em; border-bottom: 1px solid #ccc; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.2em 0.8em 0.2em 0; vertical-align: top; }
+.ok { color: #2a7a2a; }
+.err { color: #b00020; }
+.muted { color: #777; }
+.bar { display: inline-block; width: 12em; height: 0.8em; background: #eee; vertical-align: middle; }
+.bar > span { display: block; height: 100%; background: #4a90d9; }
+svg.spark { vertical-align: middle; }
+svg.spark polyline { fill: none; stroke: #4a90d9; stroke-width: 1.5; }
+details { margin: 0.3em 0; }
+pre { background: #f6f6f6; padding: 0.5em; overflow-x: auto; }
+</style>
+</head>
+<body>
+<h1>zrepl status</h1>
+<p class="muted" id="updated"></p>
+<div id="content"></div>
+<script>
+(function() {
+"use strict";
+
+// see snapper.State and snapper.SnapState
+var snapperStates = {1: "SyncUp", 2: "SyncUpErrWait", 4: "Planning", 8: "Snapshotting", 16: "Waiting", 32: "ErrorWait", 64: "Stopped"};
+var snapErr = 8;
+
+var historySummary = null;
+// data-key of details element => open, survives re-rendering
+var detailsOpen = {};
+
+function el(tag, attrs, children) {
+	var e = document.createElement(tag);
+	for (var k in (attrs || {})) {
+		e.setAttribute(k, attrs[k]);
+	}
+	(children || []).forEach(function(c) {
+		e.appendChild(typeof c === "string" ? document.createTextNode(c) : c);
+	});
+	return e;
+}
+
+function details(key, defaultOpen, summary, body) {
+	var open = key in detailsOpen ? detailsOpen[key] : defaultOpen;
+	var d = el("details", open ? {"data-key": key, open: ""} : {"data-key": key}, [summary, body]);
+	d.addEventListener("toggle", function() {
+		detailsOpen[key] = d.open;
+	});
+	return d;
+}
+
+function bytes(n) {
+	var units = ["B", "KiB", "MiB", "GiB", "TiB", "PiB"];
+	var i = 0;
+	while (n >= 1024 && i < units.length - 1) {
+		n /= 1024;
+		i++;
+	}
+	return n.toFixed(i === 0 ? 0 : 1) + " " + units[i];
+}
+
+function isZeroTime(t) {
+	return !t || t.indexOf("0001-01-01") === 0;
+}
+
+function errString(e) {
+	return e ? e.Err : "";
+}
+
+function lastAttempt(r) {
+	return r && r.Attempts && r.Attempts.length > 0 ? r.Attempts[r.Attempts.length - 1] : null;
+}
+
+function fsError(fs) {
+	return errString(fs.PlanError) || errString(fs.StepError) || errString(fs.VerifyError);
+}
+
+function prunerErrors(side, r, errs) {
+	if (!r) {
+		return;
+	}
+	var what = side ? "pruning " + side : "pruning";
+	if (r.Error) {
+		errs.push(what + " failed: " + r.Error);
+	}
+	[r.Pending || [], r.Completed || []].forEach(function(fss) {
+		fss.forEach(function(fs) {
+			if (fs.LastError) {
+				errs.push(what + " of " + fs.Filesystem + " failed: " + fs.LastError);
+			}
+		});
+	});
+}
+
+function snapperErrors(r, errs) {
+	if (!r) {
+		return;
+	}
+	if (r.Error) {
+		errs.push("snapshotting failed: " + r.Error);
+	}
+	(r.Progress || []).forEach(function(fs) {
+		if (fs.State === snapErr) {
+			errs.push("snapshotting " + fs.Path + " failed");
+		}
+	});
+	(r.Stalled || []).forEach(function(fs) {
+		errs.push("snapshotting " + fs.Path + " stalled, newest snapshot from " + fs.NewestSnapshot);
+	});
+	(r.RateOfChangeExceeded || []).forEach(function(fs) {
+		errs.push("snapshot " + fs.Path + "@" + fs.Snapshot + " exceeds rate of change threshold: " +
+			bytes(fs.Written) + " written, threshold " + bytes(fs.Threshold));
+	});
+}
+
+function jobErrors(s) {
+	var errs = [];
+	var st = s[s.type] || {};
+	switch (s.type) {
+	case "push":
+	case "pull":
+		if (st.InvocationError) {
+			errs.push("invocation failed: " + st.InvocationError);
+		}
+		var a = lastAttempt(st.Replication);
+		if (a && a.State === "planning-error") {
+			errs.push("replication planning failed: " + errString(a.PlanError));
+		} else if (a) {
+			(a.Filesystems || []).forEach(function(fs) {
+				var e = fsError(fs);
+				if (e) {
+					errs.push("replication of " + fs.Info.Name + " failed: " + e);
+				}
+			});
+		}
+		prunerErrors("sender", st.PruningSender, errs);
+		prunerErrors("receiver", st.PruningReceiver, errs);
+		snapperErrors(st.Snapshotting, errs);
+		break;
+	case "snap":
+		prunerErrors("", st.Pruning, errs);
+		snapperErrors(st.Snapshotting, errs);
+		break;
+	case "sink":
+	case "source":
+		snapperErrors(st.Snapper, errs);
+		break;
+	case "verify":
+	case "test-restore":
+		var what = s.type === "verify" ? "verification" : "test restore";
+		var r = st.Report;
+		if (r) {
+			if (r.Error) {
+				errs.push(what + " failed: " + r.Error);
+			}
+			(r.Filesystems || []).forEach(function(fs) {
+				if (fs.Error) {
+					errs.push(what + " of " + fs.Filesystem + " failed: " + fs.Error);
+				}
+				(fs.Versions || []).forEach(function(v) {
+					if (v.SenderChecksum !== v.ReceiverChecksum) {
+						errs.push("checksum mismatch of " + fs.Filesystem + v.Version);
+					}
+				});
+			});
+		}
+		break;
+	}
+	return errs;
+}
+
+function jobState(s) {
+	var st = s[s.type] || {};
+	var parts = [];
+	if (s.paused) {
+		parts.push("paused");
+	}
+	if (s.blackout_until) {
+		parts.push("blackout until " + s.blackout_until);
+	}
+	if (s.waiting_for_jobs && s.waiting_for_jobs.length > 0) {
+		parts.push("waiting for " + s.waiting_for_jobs.join(", "));
+	}
+	var a = lastAttempt(st.Replication);
+	if (a) {
+		parts.push("replication: " + a.State);
+	}
+	var snap = st.Snapshotting || st.Snapper;
+	if (snap) {
+		parts.push("snapshotting: " + (snapperStates[snap.State] || snap.State));
+	}
+	if (st.Pruning) {
+		parts.push("pruning: " + st.Pruning.State);
+	}
+	return parts.join(", ");
+}
+
+function sparkline(values) {
+	var w = 150, h = 24;
+	var max = Math.max.apply(null, values.concat([1]));
+	var points = values.map(function(v, i) {
+		var x = values.length > 1 ? i * w / (values.length - 1) : 0;
+		var y = h - 1 - v / max * (h - 2);
+		return x.toFixed(1) + "," + y.toFixed(1);
+	}).join(" ");
+	var svg = document.createElementNS("http://www.w3.org/2000/svg", "svg");
+	svg.setAttribute("class", "spark");
+	svg.setAttribute("width", w);
+	svg.setAttribute("height", h);
+	var pl = document.createElementNS("http://www.w3.org/2000/svg", "polyline");
+	pl.setAttribute("points", points);
+	svg.appendChild(pl);
+	var total = values.reduce(function(a, b) { return a + b; }, 0);
+	var title = document.createElementNS("http://www.w3.org/2000/svg", "title");
+	title.textContent = bytes(total) + " replicated in the last " + values.length + " buckets";
+	svg.appendChild(title);
+	return svg;
+}
+
+function historyCell(name) {
+	if (!historySummary || !historySummary.Enabled) {
+		return el("td", {"class": "muted"}, ["-"]);
+	}
+	var values = historySummary.Jobs[name];
+	if (!values) {
+		return el("td", {"class": "muted"}, ["no replication"]);
+	}
+	return el("td", {}, [sparkline(values)]);
+}
+
+function progressBar(replicated, expected) {
+	var pct = expected > 0 ? Math.min(100, replicated / expected * 100) : 0;
+	return el("span", {"class": "bar"}, [el("span", {style: "width: " + pct.toFixed(1) + "%"})]);
+}
+
+function filesystemTable(a) {
+	var rows = [el("tr", {}, [el("th", {}, ["filesystem"]), el("th", {}, ["state"]), el("th", {}, ["step"]), el("th", {}, ["progress"])])];
+	(a.Filesystems || []).forEach(function(fs) {
+		var steps = fs.Steps || [];
+		var replicated = 0, expected = 0;
+		steps.forEach(function(s) {
+			replicated += s.Info.BytesReplicated;
+			expected += s.Info.BytesExpected;
+		});
+		var e = fsError(fs);
+		rows.push(el("tr", {}, [
+			el("td", {}, [fs.Info.Name + (fs.Info.IsNew ? " (new)" : "")]),
+			el("td", e ? {"class": "err"} : {"title": fs.SkipReason || ""}, [fs.State]),
+			el("td", {}, [steps.length > 0 ? Math.min(fs.CurrentStep + 1, steps.length) + "/" + steps.length : "-"]),
+			el("td", {}, [progressBar(replicated, expected), " " + bytes(replicated) + " / " + bytes(expected)]),
+		]));
+	});
+	return el("table", {}, rows);
+}
+
+function render(status) {
+	var content = document.getElementById("content");
+	content.innerHTML = "";
+
+	var names = Object.keys(status.Jobs).filter(function(n) {
+		return status.Jobs[n].type !== "internal";
+	}).sort();
+
+	var overview = [el("tr", {}, [el("th", {}, ["job"]), el("th", {}, ["type"]), el("th", {}, ["state"]), el("th", {}, ["problems"]), el("th", {}, ["replicated (48h)"])])];
+	names.forEach(function(name) {
+		var s = status.Jobs[name];
+		var errs = jobErrors(s);
+		overview.push(el("tr", {}, [
+			el("td", {}, [el("a", {href: "#job-" + name}, [name])]),
+			el("td", {}, [s.type]),
+			el("td", {}, [jobState(s)]),
+			el("td", {"class": errs.length > 0 ? "err" : "ok"}, [errs.length > 0 ? errs.length + " error(s)" : "ok"]),
+			historyCell(name),
+		]));
+	});
+	content.appendChild(el("table", {}, overview));
+
+	names.forEach(function(name) {
+		var s = status.Jobs[name];
+		var st = s[s.type] || {};
+		content.appendChild(el("h2", {id: "job-" + name}, [name + " (" + s.type + ")"]));
+
+		var a = lastAttempt(st.Replication);
+		if (a) {
+			var r = st.Replication;
+			var when = isZeroTime(r.FinishAt) ? "started " + r.StartAt : "finished " + r.FinishAt;
+			content.appendChild(el("p", {}, ["Replication " + a.State + ", " + when]));
+			if ((a.Filesystems || []).length > 0) {
+				content.appendChild(filesystemTable(a));
+			}
+			if ((a.OrphanedFilesystems || []).length > 0) {
+				content.appendChild(details(name + "/orphans", false,
+					el("summary", {}, [a.OrphanedFilesystems.length + " orphaned receiver filesystem(s)"]),
+					el("ul", {}, a.OrphanedFilesystems.map(function(o) {
+						return el("li", {}, [o.Name + " (" + o.Kind + ")" + (o.NewestSnapshot ? ", newest snapshot " + o.NewestSnapshot : "")]);
+					}))));
+			}
+		}
+
+		var errs = jobErrors(s);
+		if (errs.length > 0) {
+			content.appendChild(details(name + "/errors", true,
+				el("summary", {"class": "err"}, [errs.length + " error(s)"]),
+				el("ul", {}, errs.map(function(e) { return el("li", {}, [e]); }))));
+		}
+		content.appendChild(details(name + "/raw", false,
+			el("summary", {}, ["raw status"]),
+			el("pre", {}, [JSON.stringify(s, null, 2)])));
+	});
+}
+
+function get(url, cb) {
+	var req = new XMLHttpRequest();
+	req.onload = function() {
+		if (req.status !== 200) {
+			document.getElementById("updated").textContent = url + ": " + req.status + " " + req.responseText;
+			return;
+		}
+		cb(JSON.parse(req.responseText));
+	};
+	req.onerror = function() {
+		document.getElementById("updated").textContent = "cannot reach daemon";
+	};
+	req.open("GET", url);
+	req.send();
+}
+
+function refreshStatus() {
+	get("status.json", function(status) {
+		render(status);
+		document.getElementById("updated").textContent = "updated " + new Date().toLocaleTimeString();
+	});
+}
+
+function refreshHistory() {
+	get("history.json", function(s) {
+		historySummary = s;
+	});
+}
+
+refreshHistory();
+refreshStatus();
+setInterval(refreshStatus, 2000);
+setInterval(refreshHistory, 60000);
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,136 @@
+// Package webui implements the read-only web UI that the prometheus monitoring job
+// serves if `web_ui` is enabled.
+//
+// The UI is a single static HTML page (bundle.go) that periodically fetches
+// the daemon status, i.e., the same data that `zrepl status` renders, and a summary
+// of the replication history, and renders them in the browser.
+package webui
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/zrepl/zrepl/daemon/history"
+	"github.com/zrepl/zrepl/daemon/httpauth"
+	"github.com/zrepl/zrepl/logger"
+)
+
+const (
+	EndpointIndex   = "/"
+	EndpointStatus  = "/status.json"
+	EndpointHistory = "/history.json"
+)
+
+// The history sparklines cover HistoryBuckets buckets of HistoryBucketWidth each, ending now.
+const (
+	HistoryBuckets     = 48
+	HistoryBucketWidth = time.Hour
+)
+
+type Logger = logger.Logger
+
+// Handler returns the handler for the UI's endpoints, relative to the path it is mounted at.
+// status must return a value that encodes to the JSON returned by the control socket's status endpoint.
+// historyPath is the path of the replication history file, empty if the history is disabled.
+// If tokens is not nil, all endpoints require a token with httpauth.ScopeRead.
+func Handler(log Logger, status func() interface{}, historyPath string, tokens *httpauth.Tokens) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(EndpointIndex, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != EndpointIndex {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, err := io.WriteString(w, indexHTML)
+		logIoErr(log, err)
+	})
+	mux.HandleFunc(EndpointStatus, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(log, w, status())
+	})
+	mux.HandleFunc(EndpointHistory, func(w http.ResponseWriter, r *http.Request) {
+		if historyPath == "" {
+			writeJSON(log, w, &HistorySummary{Enabled: false})
+			return
+		}
+		s, err := readHistorySummary(historyPath, time.Now())
+		if err != nil {
+			log.WithError(err).Error("web ui: cannot read replication history")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(log, w, s)
+	})
+	return tokens.Require(httpauth.ScopeRead, true, mux)
+}
+
+// HistorySummary is the response of EndpointHistory.
+type HistorySummary struct {
+	Enabled bool
+	// the end of the most recent bucket
+	End         time.Time
+	BucketWidth time.Duration
+	// job name => bytes replicated per bucket, oldest first
+	Jobs map[string][]int64
+	// the number of lines of the history file that could not be parsed
+	Corrupt int
+}
+
+func readHistorySummary(path string, now time.Time) (*HistorySummary, error) {
+	start := now.Add(-HistoryBuckets * HistoryBucketWidth)
+	entries, corrupt, err := history.ReadSince(path, func(e *history.Entry) bool {
+		return e.Time.After(start) && !e.Time.After(now)
+	}, start)
+	if err != nil {
+		return nil, err
+	}
+	s := summarizeHistory(entries, now, HistoryBuckets, HistoryBucketWidth)
+	s.Corrupt = corrupt
+	return s, nil
+}
+
+// summarizeHistory sums up the bytes replicated by each job in each of the buckets of width
+// that end at end. Entries outside of the buckets are ignored.
+func summarizeHistory(entries []*history.Entry, end time.Time, buckets int, width time.Duration) *HistorySummary {
+	s := &HistorySummary{
+		Enabled:     true,
+		End:         end,
+		BucketWidth: width,
+		Jobs:        make(map[string][]int64),
+	}
+	start := end.Add(-time.Duration(buckets) * width)
+	for _, e := range entries {
+		if !e.Time.After(start) || e.Time.After(end) {
+			continue
+		}
+		b := int(e.Time.Sub(start) / width)
+		if b == buckets { // e.Time == end
+			b--
+		}
+		if _, ok := s.Jobs[e.Job]; !ok {
+			s.Jobs[e.Job] = make([]int64, buckets)
+		}
+		s.Jobs[e.Job][b] += e.Bytes
+	}
+	return s
+}
+
+func writeJSON(log Logger, w http.ResponseWriter, v interface{}) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		log.WithError(err).Error("web ui: json marshal error")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err := io.Copy(w, &buf)
+	logIoErr(log, err)
+}
+
+func logIoErr(log Logger, err error) {
+	if err != nil {
+		log.WithError(err).Error("web ui: io error")
+	}
+}
@@ -0,0 +1,72 @@
+package webui
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/history"
+	"github.com/zrepl/zrepl/logger"
+)
+
+func TestSummarizeHistory(t *testing.T) {
+	end := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	entry := func(job string, ago time.Duration, bytes int64) *history.Entry {
+		return &history.Entry{Job: job, Time: end.Add(-ago), Bytes: bytes}
+	}
+	s := summarizeHistory([]*history.Entry{
+		entry("a", 0, 1),                       // newest bucket
+		entry("a", 30*time.Minute, 2),          // newest bucket
+		entry("a", 90*time.Minute, 4),          // second newest bucket
+		entry("a", 4*time.Hour-time.Second, 8), // oldest bucket
+		entry("a", 4*time.Hour, 16),            // too old
+		entry("a", -time.Minute, 32),           // in the future
+		entry("b", time.Hour+time.Minute, 64),
+	}, end, 4, time.Hour)
+
+	assert.True(t, s.Enabled)
+	assert.Equal(t, end, s.End)
+	assert.Equal(t, map[string][]int64{
+		"a": {8, 0, 4, 3},
+		"b": {0, 0, 64, 0},
+	}, s.Jobs)
+}
+
+func TestHandler(t *testing.T) {
+	status := func() interface{} { return map[string]string{"foo": "bar"} }
+	srv := httptest.NewServer(http.StripPrefix("/ui", Handler(logger.NewNullLogger(), status, "", nil)))
+	defer srv.Close()
+
+	get := func(path string) (*http.Response, string) {
+		res, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(body)
+	}
+
+	res, body := get("/ui/")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, res.Header.Get("Content-Type"), "text/html")
+	assert.Contains(t, body, "<title>zrepl status</title>")
+
+	res, _ = get("/ui/nonexistent")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, body = get("/ui/status.json")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `{"foo": "bar"}`, body)
+
+	res, body = get("/ui/history.json")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	var h HistorySummary
+	require.NoError(t, json.Unmarshal([]byte(body), &h))
+	assert.False(t, h.Enabled)
+}
@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"io"
 	"path"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/kr/pretty"
 	"github.com/pkg/errors"
@@ -18,6 +21,8 @@ import (
 	"github.com/zrepl/zrepl/util/chainlock"
 	"github.com/zrepl/zrepl/util/envconst"
 	"github.com/zrepl/zrepl/util/semaphore"
+	"github.com/zrepl/zrepl/util/streambuffer"
+	"github.com/zrepl/zrepl/util/streampipe"
 	"github.com/zrepl/zrepl/zfs"
 )
 
@@ -25,6 +30,35 @@ type SenderConfig struct {
 	FSF     zfs.DatasetFilter
 	Encrypt *zfs.NilBool
 	JobID   JobID
+
+	// If not nil, filesystems are presented to the receiver relative to StripPrefix.
+	// Filesystems that are not below StripPrefix and placeholders are not served.
+	StripPrefix *zfs.DatasetPath
+
+	// If not empty, the command that send streams are piped through.
+	StreamPipe []string
+
+	// If not nil, send streams are buffered in memory before they are sent.
+	Buffer *streambuffer.Config
+
+	// If true, ListFilesystemVersions is served from a single `zfs list` per pool
+	// that is issued after ListFilesystems, see versionsCache.
+	BulkListVersions bool
+
+	// If true, the snapshots are managed by another tool and the sender never modifies the sending side:
+	// it creates no holds or bookmarks (regardless of the requested replication guarantees),
+	// thus no replication cursor, and refuses DestroySnapshots.
+	ExternallyManagedSnapshots bool
+
+	// If true, the job serves the sender wrapped in a ReadOnlySender.
+	ReadOnly bool
+
+	// If not nil, only the versions that pass the filter are listed, sent and destroyed.
+	VersionFilter *FilesystemVersionFilter
+
+	// If true, DestroySnapshots creates a bookmark with the snapshot's name before it destroys the snapshot,
+	// so that the bookmark can serve as the incremental source of the next replication.
+	BookmarksOnly bool
 }
 
 func (c *SenderConfig) Validate() error {
@@ -35,28 +69,63 @@ func (c *SenderConfig) Validate() error {
 	if _, err := StepHoldTag(c.JobID); err != nil {
 		return fmt.Errorf("JobID cannot be used for hold tag: %s", err)
 	}
+	if c.StripPrefix != nil && c.StripPrefix.Empty() {
+		return errors.New("`StripPrefix` must not be empty")
+	}
+	if c.Buffer != nil {
+		if err := c.Buffer.Validate(); err != nil {
+			return errors.Wrap(err, "`Buffer` invalid")
+		}
+	}
+	if c.BookmarksOnly && c.ExternallyManagedSnapshots {
+		return errors.New("`BookmarksOnly` and `ExternallyManagedSnapshots` are mutually exclusive")
+	}
+	if c.BookmarksOnly && c.ReadOnly {
+		return errors.New("`BookmarksOnly` and `ReadOnly` are mutually exclusive")
+	}
 	return nil
 }
 
 // Sender implements replication.ReplicationEndpoint for a sending side
 type Sender struct {
-	FSFilter zfs.DatasetFilter
-	encrypt  *zfs.NilBool
-	jobId    JobID
+	FSFilter    zfs.DatasetFilter
+	encrypt     *zfs.NilBool
+	jobId       JobID
+	stripPrefix *zfs.DatasetPath
+	streamPipe  []string
+	buffer      *streambuffer.Config
+	versions    *versionsCache // nil if !SenderConfig.BulkListVersions
+	listings    listingsCache
+
+	externallyManagedSnapshots bool
+	versionFilter              *FilesystemVersionFilter
+	bookmarksOnly              bool
 }
 
 func NewSender(conf SenderConfig) *Sender {
 	if err := conf.Validate(); err != nil {
 		panic("invalid config" + err.Error())
 	}
-	return &Sender{
-		FSFilter: conf.FSF,
-		encrypt:  conf.Encrypt,
-		jobId:    conf.JobID,
+	s := &Sender{
+		FSFilter:    conf.FSF,
+		encrypt:     conf.Encrypt,
+		jobId:       conf.JobID,
+		stripPrefix: conf.StripPrefix,
+		streamPipe:  conf.StreamPipe,
+		buffer:      conf.Buffer,
+
+		externallyManagedSnapshots: conf.ExternallyManagedSnapshots,
+		versionFilter:              conf.VersionFilter,
+		bookmarksOnly:              conf.BookmarksOnly,
 	}
+	if conf.BulkListVersions {
+		s.versions = &versionsCache{}
+	}
+	return s
 }
 
-func (s *Sender) filterCheckFS(fs string) (*zfs.DatasetPath, error) {
+// maps fs as presented to the receiver to the local filesystem
+func (s *Sender) filterCheckFS(ctx context.Context, fs string) (*zfs.DatasetPath, error) {
 	dp, err := zfs.NewDatasetPath(fs)
 	if err != nil {
 		return nil, err
@@ -64,7 +133,12 @@ func (s *Sender) filterCheckFS(fs string) (*zfs.DatasetPath, error) {
 	if dp.Length() == 0 {
 		return nil, errors.New("empty filesystem not allowed")
 	}
-	pass, err := s.FSFilter.Filter(dp)
+	if s.stripPrefix != nil {
+		lp := s.stripPrefix.Copy()
+		lp.Extend(dp)
+		dp = lp
+	}
+	pass, err := zfs.FilterContext(ctx, s.FSFilter, dp)
 	if err != nil {
 		return nil, err
 	}
@@ -77,35 +151,76 @@ func (s *Sender) filterCheckFS(fs string) (*zfs.DatasetPath, error) {
 func (s *Sender) ListFilesystems(ctx context.Context, r *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
 
-	fss, err := zfs.ZFSListMapping(ctx, s.FSFilter)
-	if err != nil {
-		return nil, err
+	fss, cached := s.listings.take("", r.GetPageToken(), time.Now())
+	if !cached {
+		var err error
+		fss, err = zfs.ZFSListMapping(ctx, s.FSFilter)
+		if err != nil {
+			return nil, err
+		}
+		if s.stripPrefix != nil {
+			below := fss[:0]
+			for _, fs := range fss {
+				if fs.HasPrefix(s.stripPrefix) && fs.Length() > s.stripPrefix.Length() {
+					below = append(below, fs)
+				}
+			}
+			fss = below
+		}
+		if s.versions != nil && r.GetPageToken() == "" {
+			roots, err := bulkListRoots(fss)
+			if err != nil {
+				return nil, err
+			}
+			s.versions.arm(roots)
+		}
 	}
-	rfss := make([]*pdu.Filesystem, len(fss))
-	for i := range fss {
-		encEnabled, err := zfs.ZFSGetEncryptionEnabled(ctx, fss[i].ToString())
+	fss, rest, nextPageToken := listFilesystemsPage(fss, s.stripPrefix, r)
+	s.listings.put("", nextPageToken, rest, time.Now())
+
+	rfss := make([]*pdu.Filesystem, 0, len(fss))
+	for _, fs := range fss {
+		if s.stripPrefix != nil {
+			// we are serving received filesystems, don't serve the placeholders created by the receiver
+			ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, fs)
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot get placeholder state")
+			}
+			if ph.IsPlaceholder {
+				continue
+			}
+		}
+		encEnabled, err := zfs.ZFSGetEncryptionEnabled(ctx, fs.ToString())
 		if err != nil {
 			return nil, errors.Wrap(err, "cannot get filesystem encryption status")
 		}
-		rfss[i] = &pdu.Filesystem{
-			Path: fss[i].ToString(),
+		if s.stripPrefix != nil {
+			fs.TrimPrefix(s.stripPrefix)
+		}
+		rfss = append(rfss, &pdu.Filesystem{
+			Path: fs.ToString(),
 			// ResumeToken does not make sense from Sender
 			IsPlaceholder: false, // sender FSs are never placeholders
 			IsEncrypted:   encEnabled,
-		}
+		})
 	}
-	res := &pdu.ListFilesystemRes{Filesystems: rfss}
+	res := &pdu.ListFilesystemRes{Filesystems: rfss, NextPageToken: nextPageToken, SnapshotsExternallyManaged: s.externallyManagedSnapshots}
 	return res, nil
 }
 
 func (s *Sender) ListFilesystemVersions(ctx context.Context, r *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
 
-	lp, err := s.filterCheckFS(r.GetFilesystem())
+	lp, err := s.filterCheckFS(ctx, r.GetFilesystem())
 	if err != nil {
 		return nil, err
 	}
-	fsvs, err := zfs.ZFSListFilesystemVersions(ctx, lp, zfs.ListFilesystemVersionsOptions{})
+	var fsvs []zfs.FilesystemVersion
+	if s.versions != nil {
+		fsvs, err = s.versions.list(ctx, lp)
+	} else {
+		fsvs, err = zfs.ZFSListFilesystemVersions(ctx, lp, zfs.ListFilesystemVersionsOptions{})
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -113,14 +228,32 @@ func (s *Sender) ListFilesystemVersions(ctx context.Context, r *pdu.ListFilesyst
 	for i := range fsvs {
 		rfsvs[i] = pdu.FilesystemVersionFromZFS(&fsvs[i])
 	}
-	res := &pdu.ListFilesystemVersionsRes{Versions: rfsvs}
-	return res, nil
+	rfsvs = s.versionFilter.filter(lp.ToString(), rfsvs)
+	return pdu.NewListFilesystemVersionsRes(rfsvs, r.GetSince()), nil
 
 }
 
 var maxConcurrentZFSSend = envconst.Int64("ZREPL_ENDPOINT_MAX_CONCURRENT_SEND", 10)
 var maxConcurrentZFSSendSemaphore = semaphore.New(maxConcurrentZFSSend)
 
+// weight of a full send or receive in the concurrency budget of maxConcurrentZFSSendSemaphore
+// and maxConcurrentZFSRecvSemaphore, incremental ones weigh 1
+var fullStreamSemaphoreWeight = envconst.Int64("ZREPL_ENDPOINT_FULL_STREAM_WEIGHT", 2)
+
+// acquireStreamSemaphore acquires sem for a send or receive.
+// Dry runs only estimate the size of a send, which is cheap and blocks replication planning,
+// hence they are served before queued sends and receives.
+func acquireStreamSemaphore(ctx context.Context, sem *semaphore.S, full, dryRun bool) (*semaphore.AcquireGuard, error) {
+	if dryRun {
+		return sem.AcquireWeighted(ctx, 1, semaphore.PriorityHigh)
+	}
+	weight := int64(1)
+	if full {
+		weight = fullStreamSemaphoreWeight
+	}
+	return sem.AcquireWeighted(ctx, weight, semaphore.PriorityNormal)
+}
+
 func uncheckedSendArgsFromPDU(fsv *pdu.FilesystemVersion) *zfs.ZFSSendArgVersion {
 	if fsv == nil {
 		return nil
@@ -140,10 +273,25 @@ func sendArgsFromPDUAndValidateExistsAndGetVersion(ctx context.Context, fs strin
 	return version, nil
 }
 
+// The protocol says 0 means no estimate, but si uses -1 for no estimate.
+func sendResFromDrySendInfo(si *zfs.DrySendInfo) *pdu.SendRes {
+	noEstimateToZero := func(size int64) int64 {
+		if size < 0 {
+			return 0
+		}
+		return size
+	}
+	return &pdu.SendRes{
+		ExpectedSize:         noEstimateToZero(si.SizeEstimate),
+		ExpectedLogicalSize:  noEstimateToZero(si.LogicalSizeEstimate),
+		ExpectedPhysicalSize: noEstimateToZero(si.PhysicalSizeEstimate),
+	}
+}
+
 func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.ReadCloser, error) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
 
-	_, err := s.filterCheckFS(r.Filesystem)
+	lp, err := s.filterCheckFS(ctx, r.Filesystem)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -164,9 +312,15 @@ func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.Rea
 	default:
 		return nil, nil, fmt.Errorf("unknown pdu.Tri variant %q", r.Encrypted)
 	}
+	if err := s.versionFilter.check(lp.ToString(), r.GetFrom()); err != nil {
+		return nil, nil, errors.Wrap(err, "`From` invalid")
+	}
+	if err := s.versionFilter.check(lp.ToString(), r.GetTo()); err != nil {
+		return nil, nil, errors.Wrap(err, "`To` invalid")
+	}
 
 	sendArgsUnvalidated := zfs.ZFSSendArgsUnvalidated{
-		FS:          r.Filesystem,
+		FS:          lp.ToString(),
 		From:        uncheckedSendArgsFromPDU(r.GetFrom()), // validated by zfs.ZFSSendDry / zfs.ZFSSend
 		To:          uncheckedSendArgsFromPDU(r.GetTo()),   // validated by zfs.ZFSSendDry / zfs.ZFSSend
 		Encrypted:   s.encrypt,
@@ -182,7 +336,7 @@ func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.Rea
 	// TODO use try-acquire and fail with resource-exhaustion rpc status
 	// => would require handling on the client-side
 	// => this is a dataconn endpoint, doesn't have the status code semantics of gRPC
-	guard, err := maxConcurrentZFSSendSemaphore.Acquire(ctx)
+	guard, err := acquireStreamSemaphore(ctx, maxConcurrentZFSSendSemaphore, sendArgs.From == nil, r.DryRun)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -196,19 +350,22 @@ func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.Rea
 	// From now on, assume that sendArgs has been validated by ZFSSendDry
 	// (because validation involves shelling out, it's actually a little expensive)
 
-	var expSize int64 = 0      // protocol says 0 means no estimate
-	if si.SizeEstimate != -1 { // but si returns -1 for no size estimate
-		expSize = si.SizeEstimate
-	}
-	res := &pdu.SendRes{
-		ExpectedSize:    expSize,
-		UsedResumeToken: r.ResumeToken != "",
-	}
+	res := sendResFromDrySendInfo(si)
+	res.UsedResumeToken = r.ResumeToken != ""
 
 	if r.DryRun {
 		return res, nil, nil
 	}
 
+	if r.GetACLProperties() {
+		res.ACLProperties = senderACLProperties(ctx, sendArgs.FS)
+	}
+
+	if s.externallyManagedSnapshots {
+		getLogger(ctx).Debug("snapshots are externally managed, not creating holds or bookmarks")
+		return s.sendStream(ctx, res, sendArgs)
+	}
+
 	// create holds or bookmarks of `From` and `To` to guarantee one of the following:
 	// - that the replication step can always be resumed (`holds`),
 	// - that the replication step can be interrupted and a future replication
@@ -294,25 +451,50 @@ func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.Rea
 		abstractionsCacheSingleton.TryBatchDestroy(ctx, s.jobId, sendArgs.FS, destroyTypes, keep, check)
 	}()
 
+	return s.sendStream(ctx, res, sendArgs)
+}
+
+func (s *Sender) sendStream(ctx context.Context, res *pdu.SendRes, sendArgs zfs.ZFSSendArgsValidated) (*pdu.SendRes, io.ReadCloser, error) {
 	sendStream, err := zfs.ZFSSend(ctx, sendArgs)
 	if err != nil {
 		// it's ok to not destroy the abstractions we just created here, a new send attempt will take care of it
 		return nil, nil, errors.Wrap(err, "zfs send failed")
 	}
 
-	return res, sendStream, nil
+	var stream io.ReadCloser = sendStream
+	if len(s.streamPipe) > 0 {
+		if stream, err = streampipe.Run(ctx, s.streamPipe, stream); err != nil {
+			sendStream.Close()
+			return nil, nil, err
+		}
+	}
+	if s.buffer != nil {
+		buffered, err := streambuffer.New(stream, *s.buffer, streamBufferMetrics("send"))
+		if err != nil {
+			stream.Close()
+			return nil, nil, err
+		}
+		stream = buffered
+	}
+
+	return res, stream, nil
 }
 
 func (p *Sender) SendCompleted(ctx context.Context, r *pdu.SendCompletedReq) (*pdu.SendCompletedRes, error) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
 
 	orig := r.GetOriginalReq() // may be nil, always use proto getters
-	fsp, err := p.filterCheckFS(orig.GetFilesystem())
+	fsp, err := p.filterCheckFS(ctx, orig.GetFilesystem())
 	if err != nil {
 		return nil, err
 	}
 	fs := fsp.ToString()
 
+	if p.externallyManagedSnapshots {
+		// no replication cursor to move, and no step holds or tentative cursors to release
+		return &pdu.SendCompletedRes{}, nil
+	}
+
 	var from *zfs.FilesystemVersion
 	if orig.GetFrom() != nil {
 		f, err := sendArgsFromPDUAndValidateExistsAndGetVersion(ctx, fs, orig.GetFrom()) // no shadow
@@ -360,10 +542,21 @@ func (p *Sender) SendCompleted(ctx context.Context, r *pdu.SendCompletedReq) (*p
 func (p *Sender) DestroySnapshots(ctx context.Context, req *pdu.DestroySnapshotsReq) (*pdu.DestroySnapshotsRes, error) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
 
-	dp, err := p.filterCheckFS(req.Filesystem)
+	dp, err := p.filterCheckFS(ctx, req.Filesystem)
 	if err != nil {
 		return nil, err
 	}
+	if p.externallyManagedSnapshots {
+		return nil, errors.New("sender does not destroy snapshots, they are externally managed (send.externally_managed_snapshots)")
+	}
+	for _, snap := range req.GetSnapshots() {
+		if err := p.versionFilter.check(dp.ToString(), snap); err != nil {
+			return nil, err
+		}
+	}
+	if p.bookmarksOnly {
+		return doBookmarkAndDestroySnapshots(ctx, dp, req.Snapshots)
+	}
 	return doDestroySnapshots(ctx, dp, req.Snapshots)
 }
 
@@ -391,7 +584,7 @@ func (p *Sender) WaitForConnectivity(ctx context.Context) error {
 func (p *Sender) ReplicationCursor(ctx context.Context, req *pdu.ReplicationCursorReq) (*pdu.ReplicationCursorRes, error) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
 
-	dp, err := p.filterCheckFS(req.Filesystem)
+	dp, err := p.filterCheckFS(ctx, req.Filesystem)
 	if err != nil {
 		return nil, err
 	}
@@ -406,10 +599,32 @@ func (p *Sender) ReplicationCursor(ctx context.Context, req *pdu.ReplicationCurs
 	return &pdu.ReplicationCursorRes{Result: &pdu.ReplicationCursorRes_Guid{Guid: cursor.Guid}}, nil
 }
 
+func (p *Sender) ChecksumVersion(ctx context.Context, req *pdu.ChecksumVersionReq) (*pdu.ChecksumVersionRes, error) {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+
+	dp, err := p.filterCheckFS(ctx, req.Filesystem)
+	if err != nil {
+		return nil, err
+	}
+	return doChecksumVersion(ctx, dp, req)
+}
+
 func (p *Sender) Receive(ctx context.Context, r *pdu.ReceiveReq, _ io.ReadCloser) (*pdu.ReceiveRes, error) {
 	return nil, fmt.Errorf("sender does not implement Receive()")
 }
 
+func (p *Sender) RenameFilesystem(ctx context.Context, r *pdu.RenameFilesystemReq) (*pdu.RenameFilesystemRes, error) {
+	return nil, fmt.Errorf("sender does not implement RenameFilesystem()")
+}
+
+func (p *Sender) Rollback(ctx context.Context, r *pdu.RollbackReq) (*pdu.RollbackRes, error) {
+	return nil, fmt.Errorf("sender does not implement Rollback()")
+}
+
+func (p *Sender) DestroyFilesystem(ctx context.Context, r *pdu.DestroyFilesystemReq) (*pdu.DestroyFilesystemRes, error) {
+	return nil, fmt.Errorf("sender does not implement DestroyFilesystem()")
+}
+
 type FSFilter interface { // FIXME unused
 	Filter(path *zfs.DatasetPath) (pass bool, err error)
 }
@@ -427,6 +642,59 @@ type ReceiverConfig struct {
 
 	RootWithoutClientComponent *zfs.DatasetPath // TODO use
 	AppendClientIdentity       bool
+
+	// Allow the client to restore received filesystems via Send
+	AllowRestore bool
+
+	// Prefix for the names of received snapshots.
+	// The prefix is not visible to the client. See SnapshotPrefixClientIdentityPlaceholder.
+	SnapshotPrefix string
+
+	// If not zero, the quota of the client root filesystem, i.e., of all filesystems received from a client.
+	ClientQuota uint64
+
+	// If not empty, the command that received streams are piped through before they are passed to zfs recv.
+	StreamPipe []string
+
+	// If not nil, received streams are buffered in memory before they are passed to zfs recv.
+	Buffer *streambuffer.Config
+
+	// If true, a placeholder filesystem that holds data is renamed aside instead of being overwritten
+	// by the forced receive (zfs recv -F) of an incoming full send.
+	ArchivePlaceholderData bool
+
+	// Allow the client to roll back received filesystems to one of their snapshots via Rollback.
+	AllowRollback bool
+
+	// If true, the receiver refuses all requests that would destroy received snapshots,
+	// i.e., DestroySnapshots, Rollback and DestroyFilesystem, regardless of AllowRollback and AllowDestroyTombstones.
+	AppendOnly bool
+
+	// Allow the client to destroy tombstones, i.e., received filesystems whose sender filesystem was destroyed,
+	// via DestroyFilesystem.
+	AllowDestroyTombstones bool
+
+	// If true, ListFilesystemVersions is served from a single `zfs list` of the client root filesystem
+	// that is issued after ListFilesystems, see versionsCache.
+	BulkListVersions bool
+
+	// If true, the ACL properties of received filesystems (zfs.ACLProperties) are set to the
+	// sender's values after each receive. Otherwise, they are inherited from the receiver.
+	PreserveACLProperties bool
+
+	// If not nil, invoked after each successful receive.
+	PostRecvHooks PostRecvHooks
+
+	// If not nil, only the versions that pass the filter are listed, received and destroyed.
+	// The filter applies to the names as presented to the client, i.e., without SnapshotPrefix.
+	VersionFilter *FilesystemVersionFilter
+}
+
+// PostRecvHooks is implemented by hooks.PostRecv.
+type PostRecvHooks interface {
+	// RunPostRecv is called after snapshot was received into fs.
+	// Receive waits for it to return.
+	RunPostRecv(ctx context.Context, fs *zfs.DatasetPath, snapshot zfs.FilesystemVersion)
 }
 
 func (c *ReceiverConfig) copyIn() {
@@ -438,6 +706,14 @@ func (c *ReceiverConfig) Validate() error {
 	if c.RootWithoutClientComponent.Length() <= 0 {
 		return errors.New("RootWithoutClientComponent must not be an empty dataset path")
 	}
+	if err := validateSnapshotPrefix(c.SnapshotPrefix, c.AppendClientIdentity); err != nil {
+		return errors.Wrap(err, "`SnapshotPrefix` invalid")
+	}
+	if c.Buffer != nil {
+		if err := c.Buffer.Validate(); err != nil {
+			return errors.Wrap(err, "`Buffer` invalid")
+		}
+	}
 	return nil
 }
 
@@ -446,6 +722,14 @@ type Receiver struct {
 	conf ReceiverConfig // validated
 
 	recvParentCreationMtx *chainlock.L
+	// Number of in-flight receives below each filesystem, by filesystem name.
+	// Protected by recvParentCreationMtx, see createPlaceholderParents.
+	recvParentUsers map[string]int
+
+	listings listingsCache
+
+	versionsMtx sync.Mutex
+	versions    map[string]*versionsCache // by client root, nil if !ReceiverConfig.BulkListVersions
 }
 
 func NewReceiver(config ReceiverConfig) *Receiver {
@@ -453,10 +737,30 @@ func NewReceiver(config ReceiverConfig) *Receiver {
 	if err := config.Validate(); err != nil {
 		panic(err)
 	}
-	return &Receiver{
+	r := &Receiver{
 		conf:                  config,
 		recvParentCreationMtx: chainlock.New(),
+		recvParentUsers:       make(map[string]int),
 	}
+	if config.BulkListVersions {
+		r.versions = make(map[string]*versionsCache)
+	}
+	return r
+}
+
+// versionsCache returns the cache for the client root, or nil if bulk listing is disabled.
+func (s *Receiver) versionsCache(root *zfs.DatasetPath) *versionsCache {
+	if s.versions == nil {
+		return nil
+	}
+	s.versionsMtx.Lock()
+	defer s.versionsMtx.Unlock()
+	c, ok := s.versions[root.ToString()]
+	if !ok {
+		c = &versionsCache{}
+		s.versions[root.ToString()] = c
+	}
+	return c
 }
 
 func TestClientIdentity(rootFS *zfs.DatasetPath, clientIdentity string) error {
@@ -529,10 +833,23 @@ func (s *Receiver) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemR
 	}
 
 	root := s.clientRootFromCtx(ctx)
-	filtered, err := zfs.ZFSListMapping(ctx, subroot{root})
-	if err != nil {
-		return nil, err
+	filtered, cached := s.listings.take(root.ToString(), req.GetPageToken(), time.Now())
+	if !cached {
+		var err error
+		filtered, err = zfs.ZFSListMapping(ctx, subroot{root})
+		if err != nil {
+			return nil, err
+		}
+		if c := s.versionsCache(root); c != nil && req.GetPageToken() == "" {
+			if len(filtered) > 0 {
+				c.arm([]*zfs.DatasetPath{root})
+			} else {
+				c.arm(nil) // the client root might not exist yet
+			}
+		}
 	}
+	filtered, rest, nextPageToken := listFilesystemsPage(filtered, root, req)
+	s.listings.put(root.ToString(), nextPageToken, rest, time.Now())
 	// present filesystem without the root_fs prefix
 	fss := make([]*pdu.Filesystem, 0, len(filtered))
 	for _, a := range filtered {
@@ -572,9 +889,9 @@ func (s *Receiver) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemR
 	}
 	if len(fss) == 0 {
 		getLogger(ctx).Debug("no filesystems found")
-		return &pdu.ListFilesystemRes{}, nil
+		return &pdu.ListFilesystemRes{NextPageToken: nextPageToken, PreservesACLProperties: s.conf.PreserveACLProperties}, nil
 	}
-	return &pdu.ListFilesystemRes{Filesystems: fss}, nil
+	return &pdu.ListFilesystemRes{Filesystems: fss, NextPageToken: nextPageToken, PreservesACLProperties: s.conf.PreserveACLProperties}, nil
 }
 
 func (s *Receiver) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
@@ -587,7 +904,12 @@ func (s *Receiver) ListFilesystemVersions(ctx context.Context, req *pdu.ListFile
 	}
 	// TODO share following code with sender
 
-	fsvs, err := zfs.ZFSListFilesystemVersions(ctx, lp, zfs.ListFilesystemVersionsOptions{})
+	var fsvs []zfs.FilesystemVersion
+	if c := s.versionsCache(root); c != nil {
+		fsvs, err = c.list(ctx, lp)
+	} else {
+		fsvs, err = zfs.ZFSListFilesystemVersions(ctx, lp, zfs.ListFilesystemVersionsOptions{})
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -596,8 +918,10 @@ func (s *Receiver) ListFilesystemVersions(ctx context.Context, req *pdu.ListFile
 	for i := range fsvs {
 		rfsvs[i] = pdu.FilesystemVersionFromZFS(&fsvs[i])
 	}
+	versionsToPresented(s.snapshotPrefix(ctx), rfsvs)
+	rfsvs = s.conf.VersionFilter.filter(req.GetFilesystem(), rfsvs)
 
-	return &pdu.ListFilesystemVersionsRes{Versions: rfsvs}, nil
+	return pdu.NewListFilesystemVersionsRes(rfsvs, req.GetSince()), nil
 }
 
 func (s *Receiver) Ping(ctx context.Context, req *pdu.PingReq) (*pdu.PingRes, error) {
@@ -624,93 +948,258 @@ func (s *Receiver) ReplicationCursor(ctx context.Context, _ *pdu.ReplicationCurs
 	return nil, fmt.Errorf("ReplicationCursor not implemented for Receiver")
 }
 
+// Send is only supported for restores, i.e., if ReceiverConfig.AllowRestore is set.
+// Only full sends of snapshots are supported.
+// No zrepl abstractions (holds, bookmarks) are created.
 func (s *Receiver) Send(ctx context.Context, req *pdu.SendReq) (*pdu.SendRes, io.ReadCloser, error) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
-	return nil, nil, fmt.Errorf("receiver does not implement Send()")
-}
 
-var maxConcurrentZFSRecvSemaphore = semaphore.New(envconst.Int64("ZREPL_ENDPOINT_MAX_CONCURRENT_RECV", 10))
+	if !s.conf.AllowRestore {
+		return nil, nil, fmt.Errorf("receiver does not implement Send() unless restores are allowed")
+	}
 
-func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.ReadCloser) (*pdu.ReceiveRes, error) {
-	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+	root := s.clientRootFromCtx(ctx)
+	lp, err := subroot{root}.MapToLocal(req.GetFilesystem())
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.GetFrom() != nil || req.GetResumeToken() != "" {
+		return nil, nil, errors.New("restore only supports full sends")
+	}
+	if req.GetTo().GetType() != pdu.FilesystemVersion_Snapshot {
+		return nil, nil, errors.New("`To` must be a snapshot")
+	}
+	ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, lp)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot get placeholder state")
+	}
+	if !ph.FSExists {
+		return nil, nil, errors.Errorf("filesystem %q does not exist", req.GetFilesystem())
+	}
+	if ph.IsPlaceholder {
+		return nil, nil, errors.Errorf("filesystem %q is a placeholder", req.GetFilesystem())
+	}
+	// raw send if the received filesystem is encrypted, plain send otherwise
+	encrypted, err := zfs.ZFSGetEncryptionEnabled(ctx, lp.ToString())
+	if err != nil {
+		return nil, nil, err
+	}
 
-	getLogger(ctx).Debug("incoming Receive")
-	defer receive.Close()
+	to, err := s.versionsToLocal(ctx, lp, []*pdu.FilesystemVersion{req.GetTo()})
+	if err != nil {
+		return nil, nil, err
+	}
 
-	root := s.clientRootFromCtx(ctx)
-	lp, err := subroot{root}.MapToLocal(req.Filesystem)
+	sendArgsUnvalidated := zfs.ZFSSendArgsUnvalidated{
+		FS:        lp.ToString(),
+		To:        uncheckedSendArgsFromPDU(to[0]), // validated below
+		Encrypted: &zfs.NilBool{B: encrypted},
+	}
+	sendArgs, err := sendArgsUnvalidated.Validate(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "`Filesystem` invalid")
+		return nil, nil, errors.Wrap(err, "validate send arguments")
 	}
 
-	to := uncheckedSendArgsFromPDU(req.GetTo())
-	if to == nil {
-		return nil, errors.New("`To` must not be nil")
+	guard, err := acquireStreamSemaphore(ctx, maxConcurrentZFSSendSemaphore, true, req.GetDryRun())
+	if err != nil {
+		return nil, nil, err
 	}
-	if !to.IsSnapshot() {
-		return nil, errors.New("`To` must be a snapshot")
+	defer guard.Release()
+
+	si, err := zfs.ZFSSendDry(ctx, sendArgs)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "zfs send dry failed")
+	}
+	res := sendResFromDrySendInfo(si)
+	if req.GetDryRun() {
+		return res, nil, nil
 	}
 
+	getLogger(ctx).WithField("fs", lp.ToString()).WithField("to", req.GetTo().RelName()).Info("serving restore")
+	sendStream, err := zfs.ZFSSend(ctx, sendArgs)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "zfs send failed")
+	}
+	return res, sendStream, nil
+}
+
+// Creates placeholder filesystems for the non-existent parents of lp
+// and returns the created placeholders, outermost first.
+//
+// If the creation of a placeholder fails, the placeholders that were already
+// created are removed again, i.e., either all missing parents are created or none.
+// (ZFS channel programs cannot create filesystems, so we cannot do this in a single ZFS transaction.)
+//
+// On success, the parents of lp are registered as in use by the caller,
+// which must call releasePlaceholderParents once it is done with lp.
+func (s *Receiver) createPlaceholderParents(ctx context.Context, lp *zfs.DatasetPath) (created []*zfs.DatasetPath, err error) {
 	// create placeholder parent filesystems as appropriate
 	//
 	// Manipulating the ZFS dataset hierarchy must happen exclusively.
 	// TODO: Use fine-grained locking to allow separate clients / requests to pass
 	// 		 through the following section concurrently when operating on disjoint
 	//       ZFS dataset hierarchy subtrees.
+	getLogger(ctx).Debug("begin acquire recvParentCreationMtx")
+	defer s.recvParentCreationMtx.Lock().Unlock()
+	getLogger(ctx).Debug("end acquire recvParentCreationMtx")
+	defer getLogger(ctx).Debug("release recvParentCreationMtx")
+
 	var visitErr error
-	func() {
-		getLogger(ctx).Debug("begin acquire recvParentCreationMtx")
-		defer s.recvParentCreationMtx.Lock().Unlock()
-		getLogger(ctx).Debug("end acquire recvParentCreationMtx")
-		defer getLogger(ctx).Debug("release recvParentCreationMtx")
-
-		f := zfs.NewDatasetPathForest()
-		f.Add(lp)
-		getLogger(ctx).Debug("begin tree-walk")
-		f.WalkTopDown(func(v *zfs.DatasetPathVisit) (visitChildTree bool) {
-			if v.Path.Equal(lp) {
+	var parents []string
+	f := zfs.NewDatasetPathForest()
+	f.Add(lp)
+	getLogger(ctx).Debug("begin tree-walk")
+	f.WalkTopDown(func(v *zfs.DatasetPathVisit) (visitChildTree bool) {
+		if v.Path.Equal(lp) {
+			return false
+		}
+		parents = append(parents, v.Path.ToString())
+		ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, v.Path)
+		getLogger(ctx).
+			WithField("fs", v.Path.ToString()).
+			WithField("placeholder_state", fmt.Sprintf("%#v", ph)).
+			WithField("err", fmt.Sprintf("%s", err)).
+			WithField("errType", fmt.Sprintf("%T", err)).
+			Debug("placeholder state for filesystem")
+		if err != nil {
+			visitErr = err
+			return false
+		}
+
+		if !ph.FSExists {
+			if s.conf.RootWithoutClientComponent.HasPrefix(v.Path) {
+				if v.Path.Length() == 1 {
+					visitErr = fmt.Errorf("pool %q not imported", v.Path.ToString())
+				} else {
+					visitErr = fmt.Errorf("root_fs %q does not exist", s.conf.RootWithoutClientComponent.ToString())
+				}
+				getLogger(ctx).WithError(visitErr).Error("placeholders are only created automatically below root_fs")
 				return false
 			}
-			ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, v.Path)
-			getLogger(ctx).
-				WithField("fs", v.Path.ToString()).
-				WithField("placeholder_state", fmt.Sprintf("%#v", ph)).
-				WithField("err", fmt.Sprintf("%s", err)).
-				WithField("errType", fmt.Sprintf("%T", err)).
-				Debug("placeholder state for filesystem")
+			l := getLogger(ctx).WithField("placeholder_fs", v.Path)
+			l.Debug("create placeholder filesystem")
+			err := zfs.ZFSCreatePlaceholderFilesystem(ctx, v.Path, v.Parent.Path)
 			if err != nil {
+				l.WithError(err).Error("cannot create placeholder filesystem")
 				visitErr = err
 				return false
 			}
-
-			if !ph.FSExists {
-				if s.conf.RootWithoutClientComponent.HasPrefix(v.Path) {
-					if v.Path.Length() == 1 {
-						visitErr = fmt.Errorf("pool %q not imported", v.Path.ToString())
-					} else {
-						visitErr = fmt.Errorf("root_fs %q does not exist", s.conf.RootWithoutClientComponent.ToString())
-					}
-					getLogger(ctx).WithError(visitErr).Error("placeholders are only created automatically below root_fs")
-					return false
-				}
-				l := getLogger(ctx).WithField("placeholder_fs", v.Path)
-				l.Debug("create placeholder filesystem")
-				err := zfs.ZFSCreatePlaceholderFilesystem(ctx, v.Path, v.Parent.Path)
-				if err != nil {
-					l.WithError(err).Error("cannot create placeholder filesystem")
-					visitErr = err
-					return false
-				}
-				return true
-			}
-			getLogger(ctx).WithField("filesystem", v.Path.ToString()).Debug("exists")
-			return true // leave this fs as is
-		})
-	}()
+			created = append(created, v.Path.Copy())
+			return true
+		}
+		getLogger(ctx).WithField("filesystem", v.Path.ToString()).Debug("exists")
+		return true // leave this fs as is
+	})
 	getLogger(ctx).WithField("visitErr", visitErr).Debug("complete tree-walk")
 	if visitErr != nil {
+		s.removePlaceholdersLocked(ctx, created)
 		return nil, visitErr
 	}
+	for _, p := range parents {
+		s.recvParentUsers[p]++
+	}
+	return created, nil
+}
+
+// Releases the parents of lp registered by createPlaceholderParents.
+// If remove is true, the placeholders created for lp are removed, innermost first,
+// to avoid leaving behind empty placeholder hierarchies if the operation
+// for which they were created fails.
+//
+// The removal is best-effort: the placeholders are destroyed non-recursively and
+// only if they are still placeholders and no other in-flight receive is below them,
+// so that a placeholder that another receive depends on or that has since
+// gained children is left as is.
+func (s *Receiver) releasePlaceholderParents(ctx context.Context, lp *zfs.DatasetPath, created []*zfs.DatasetPath, remove bool) {
+	defer s.recvParentCreationMtx.Lock().Unlock()
+	name := lp.ToString()
+	for i := strings.LastIndex(name, "/"); i > 0; i = strings.LastIndex(name, "/") {
+		name = name[:i]
+		if s.recvParentUsers[name]--; s.recvParentUsers[name] <= 0 {
+			delete(s.recvParentUsers, name)
+		}
+	}
+	if remove {
+		s.removePlaceholdersLocked(ctx, created)
+	}
+}
+
+func (s *Receiver) removePlaceholdersLocked(ctx context.Context, created []*zfs.DatasetPath) {
+	for i := len(created) - 1; i >= 0; i-- {
+		l := getLogger(ctx).WithField("placeholder_fs", created[i].ToString())
+		if n := s.recvParentUsers[created[i].ToString()]; n > 0 {
+			l.WithField("receives", n).Info("placeholder filesystem is in use by other receives, not removing it")
+			return
+		}
+		ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, created[i])
+		if err != nil {
+			l.WithError(err).Warn("cannot get placeholder state, not removing placeholder filesystem")
+			return
+		}
+		if !ph.FSExists {
+			continue
+		}
+		if !ph.IsPlaceholder {
+			l.Warn("filesystem is no longer a placeholder, not removing it")
+			return
+		}
+		l.Info("remove placeholder filesystem created for failed operation")
+		if err := zfs.ZFSDestroy(ctx, created[i].ToString()); err != nil {
+			l.WithError(err).Warn("cannot remove placeholder filesystem")
+			return
+		}
+	}
+}
+
+var maxConcurrentZFSRecvSemaphore = semaphore.New(envconst.Int64("ZREPL_ENDPOINT_MAX_CONCURRENT_RECV", 10))
+
+// filesystems for which the lack of resumable recv support has already been logged at warning level,
+// subsequent receives log it at debug level
+var resumeRecvUnsupportedWarned sync.Map
+
+func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.ReadCloser) (*pdu.ReceiveRes, error) {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+
+	getLogger(ctx).Debug("incoming Receive")
+	defer receive.Close()
+
+	root := s.clientRootFromCtx(ctx)
+	lp, err := subroot{root}.MapToLocal(req.Filesystem)
+	if err != nil {
+		return nil, errors.Wrap(err, "`Filesystem` invalid")
+	}
+
+	to := uncheckedSendArgsFromPDU(req.GetTo())
+	if to == nil {
+		return nil, errors.New("`To` must not be nil")
+	}
+	if !to.IsSnapshot() {
+		return nil, errors.New("`To` must be a snapshot")
+	}
+	if err := s.conf.VersionFilter.check(req.GetFilesystem(), req.GetTo()); err != nil {
+		return nil, errors.Wrap(err, "`To` invalid")
+	}
+	if prefix := s.snapshotPrefix(ctx); prefix != "" {
+		to.RelName = "@" + prefix + req.GetTo().GetName()
+	}
+
+	createdPlaceholders, err := s.createPlaceholderParents(ctx, lp)
+	if err != nil {
+		return nil, err
+	}
+	// If we fail before zfs recv has created lp, remove the placeholders created above
+	// so that failed initial receives don't litter the receiver with empty hierarchies.
+	lpCreated := false
+	defer func() {
+		s.releasePlaceholderParents(ctx, lp, createdPlaceholders, !lpCreated)
+	}()
+
+	if s.conf.ClientQuota > 0 {
+		if err := s.enforceClientQuota(ctx, root); err != nil {
+			getLogger(ctx).WithError(err).Error("refusing receive")
+			return nil, err
+		}
+	}
 
 	log := getLogger(ctx).WithField("proto_fs", req.GetFilesystem()).WithField("local_fs", lp.ToString())
 
@@ -722,10 +1211,20 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.
 		return nil, errors.Wrap(err, "cannot get placeholder state")
 	}
 	log.WithField("placeholder_state", fmt.Sprintf("%#v", ph)).Debug("placeholder state")
+	if ph.FSExists && ph.IsPlaceholder && s.conf.ArchivePlaceholderData {
+		archived, err := s.archivePlaceholderData(ctx, lp)
+		if err != nil {
+			return nil, err
+		}
+		if archived {
+			ph = &zfs.FilesystemPlaceholderState{FS: lp.ToString()} // receive into a new filesystem
+		}
+	}
 	if ph.FSExists && ph.IsPlaceholder {
 		recvOpts.RollbackAndForceRecv = true
 		clearPlaceholderProperty = true
 	}
+	fullRecv := !ph.FSExists || ph.IsPlaceholder
 
 	if clearPlaceholderProperty {
 		log.Info("clearing placeholder property")
@@ -745,17 +1244,42 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot determine whether we can use resumable send & recv")
 	}
+	if !recvOpts.SavePartialRecvState {
+		const msg = "resumable recv not supported by ZFS or pool, an interrupted receive will have to start over"
+		if _, warned := resumeRecvUnsupportedWarned.LoadOrStore(lp.ToString(), true); warned {
+			log.Debug(msg)
+		} else {
+			log.Warn(msg)
+		}
+	}
 
 	log.Debug("acquire concurrent recv semaphore")
 	// TODO use try-acquire and fail with resource-exhaustion rpc status
 	// => would require handling on the client-side
 	// => this is a dataconn endpoint, doesn't have the status code semantics of gRPC
-	guard, err := maxConcurrentZFSRecvSemaphore.Acquire(ctx)
+	guard, err := acquireStreamSemaphore(ctx, maxConcurrentZFSRecvSemaphore, fullRecv, false)
 	if err != nil {
 		return nil, err
 	}
 	defer guard.Release()
 
+	if s.conf.Buffer != nil {
+		buffered, err := streambuffer.New(receive, *s.conf.Buffer, streamBufferMetrics("recv"))
+		if err != nil {
+			return nil, err
+		}
+		defer buffered.Close()
+		receive = buffered
+	}
+	if len(s.conf.StreamPipe) > 0 {
+		piped, err := streampipe.Run(ctx, s.conf.StreamPipe, receive)
+		if err != nil {
+			return nil, err
+		}
+		defer piped.Close()
+		receive = piped
+	}
+
 	var peek bytes.Buffer
 	var MaxPeek = envconst.Int64("ZREPL_ENDPOINT_RECV_PEEK_SIZE", 1<<20)
 	log.WithField("max_peek_bytes", MaxPeek).Info("peeking incoming stream")
@@ -774,6 +1298,7 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.
 
 		// best-effort rollback of placeholder state if the recv didn't start
 		_, resumableStatePresent := err.(*zfs.RecvFailedWithResumeTokenErr)
+		lpCreated = resumableStatePresent
 		disablePlaceholderRestoration := envconst.Bool("ZREPL_ENDPOINT_DISABLE_PLACEHOLDER_RESTORATION", false)
 		placeholderRestored := !ph.IsPlaceholder
 		if !disablePlaceholderRestoration && !resumableStatePresent && recvOpts.RollbackAndForceRecv && ph.FSExists && ph.IsPlaceholder && clearPlaceholderProperty {
@@ -839,8 +1364,12 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.
 			WithField("opts", fmt.Sprintf("%#v", recvOpts)).
 			Error("zfs receive failed")
 
+		if s.conf.ClientQuota > 0 && isZFSQuotaExceededErr(err) {
+			return nil, &ClientQuotaExceededError{ClientRoot: root.ToString(), Quota: s.conf.ClientQuota, Cause: err}
+		}
 		return nil, err
 	}
+	lpCreated = true
 
 	// validate that we actually received what the sender claimed
 	toRecvd, err := to.ValidateExistsAndGetVersion(ctx, lp.ToString())
@@ -884,18 +1413,117 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.
 	}
 	abstractionsCacheSingleton.TryBatchDestroy(ctx, s.conf.JobID, lp.ToString(), destroyTypes, keep, check)
 
+	if s.conf.PreserveACLProperties {
+		// the stream has been received, so failing the receive would only cause a pointless retry
+		if err := s.preserveACLProperties(ctx, lp, req.GetACLProperties()); err != nil {
+			log.WithError(err).Warn("cannot preserve ACL properties of sender, keeping those of the receiver")
+		}
+	}
+
+	if s.conf.PostRecvHooks != nil {
+		s.conf.PostRecvHooks.RunPostRecv(ctx, lp, toRecvd)
+	}
+
 	return &pdu.ReceiveRes{}, nil
 }
 
 func (s *Receiver) DestroySnapshots(ctx context.Context, req *pdu.DestroySnapshotsReq) (*pdu.DestroySnapshotsRes, error) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
 
+	if s.conf.AppendOnly {
+		res := &pdu.DestroySnapshotsRes{}
+		for _, snap := range req.GetSnapshots() {
+			res.Results = append(res.Results, &pdu.DestroySnapshotRes{
+				Snapshot: snap,
+				Error:    "receiver is append-only (recv.append_only), configure keep_receiver to keep all snapshots",
+			})
+		}
+		return res, nil
+	}
+
 	root := s.clientRootFromCtx(ctx)
 	lp, err := subroot{root}.MapToLocal(req.Filesystem)
 	if err != nil {
 		return nil, err
 	}
-	return doDestroySnapshots(ctx, lp, req.Snapshots)
+	for _, snap := range req.GetSnapshots() {
+		if err := s.conf.VersionFilter.check(req.GetFilesystem(), snap); err != nil {
+			return nil, err
+		}
+	}
+	snaps, err := s.versionsToLocal(ctx, lp, req.Snapshots)
+	if err != nil {
+		return nil, err
+	}
+	res, err := doDestroySnapshots(ctx, lp, snaps)
+	if err != nil {
+		return nil, err
+	}
+	for i := range res.Results {
+		res.Results[i].Snapshot = req.Snapshots[i] // report the snapshots as requested
+	}
+	return res, nil
+}
+
+// RenameFilesystem renames a received filesystem, e.g., to follow a rename on the sending side.
+// Missing parents of the new name are created as placeholders.
+func (s *Receiver) RenameFilesystem(ctx context.Context, req *pdu.RenameFilesystemReq) (*pdu.RenameFilesystemRes, error) {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+
+	root := s.clientRootFromCtx(ctx)
+	from, err := subroot{root}.MapToLocal(req.GetFilesystem())
+	if err != nil {
+		return nil, errors.Wrap(err, "`Filesystem` invalid")
+	}
+	to, err := subroot{root}.MapToLocal(req.GetNewFilesystem())
+	if err != nil {
+		return nil, errors.Wrap(err, "`NewFilesystem` invalid")
+	}
+	if to.HasPrefix(from) {
+		return nil, errors.Errorf("cannot rename %q to %q: new name is within the filesystem", from.ToString(), to.ToString())
+	}
+
+	fromPh, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, from)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get placeholder state")
+	}
+	if !fromPh.FSExists {
+		return nil, errors.Errorf("filesystem %q does not exist", req.GetFilesystem())
+	}
+	if fromPh.IsPlaceholder {
+		return nil, errors.Errorf("filesystem %q is a placeholder", req.GetFilesystem())
+	}
+	toPh, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, to)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get placeholder state")
+	}
+	if toPh.FSExists {
+		return nil, errors.Errorf("filesystem %q already exists", req.GetNewFilesystem())
+	}
+
+	createdPlaceholders, err := s.createPlaceholderParents(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	getLogger(ctx).WithField("from", from.ToString()).WithField("to", to.ToString()).Info("rename filesystem")
+	if err := zfs.ZFSRename(ctx, from, to); err != nil {
+		s.releasePlaceholderParents(ctx, to, createdPlaceholders, true)
+		return nil, err
+	}
+	s.releasePlaceholderParents(ctx, to, createdPlaceholders, false)
+
+	// mark tombstones so that DestroyFilesystem can tell them apart from filesystems that only have a tombstone name,
+	// and unmark them if they are renamed back (detect_renames)
+	if orig, _, ok := pdu.ParseTombstoneName(req.GetNewFilesystem()); ok && orig == req.GetFilesystem() {
+		if err := zfs.ZFSSetTombstone(ctx, to, true); err != nil {
+			return nil, errors.Wrap(err, "cannot mark filesystem as tombstone")
+		}
+	} else if _, _, ok := pdu.ParseTombstoneName(req.GetFilesystem()); ok {
+		if err := zfs.ZFSSetTombstone(ctx, to, false); err != nil {
+			return nil, errors.Wrap(err, "cannot unmark former tombstone")
+		}
+	}
+	return &pdu.RenameFilesystemRes{}, nil
 }
 
 func (p *Receiver) SendCompleted(ctx context.Context, _ *pdu.SendCompletedReq) (*pdu.SendCompletedRes, error) {
@@ -904,6 +1532,52 @@ func (p *Receiver) SendCompleted(ctx context.Context, _ *pdu.SendCompletedReq) (
 	return &pdu.SendCompletedRes{}, nil
 }
 
+func (s *Receiver) ChecksumVersion(ctx context.Context, req *pdu.ChecksumVersionReq) (*pdu.ChecksumVersionRes, error) {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+
+	root := s.clientRootFromCtx(ctx)
+	lp, err := subroot{root}.MapToLocal(req.Filesystem)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetVersion() != nil {
+		versions, err := s.versionsToLocal(ctx, lp, []*pdu.FilesystemVersion{req.GetVersion()})
+		if err != nil {
+			return nil, err
+		}
+		req = &pdu.ChecksumVersionReq{
+			Filesystem: req.GetFilesystem(),
+			Version:    versions[0],
+			Method:     req.GetMethod(),
+		}
+	}
+	return doChecksumVersion(ctx, lp, req)
+}
+
+func doChecksumVersion(ctx context.Context, lp *zfs.DatasetPath, req *pdu.ChecksumVersionReq) (*pdu.ChecksumVersionRes, error) {
+	var method zfs.ChecksumMethod
+	switch req.GetMethod() {
+	case pdu.ChecksumMethod_ChecksumMethodStreamSize:
+		method = zfs.ChecksumMethodStreamSize
+	case pdu.ChecksumMethod_ChecksumMethodStreamSHA256:
+		method = zfs.ChecksumMethodStreamSHA256
+	default:
+		return nil, fmt.Errorf("unknown checksum method %q", req.GetMethod())
+	}
+	if req.GetVersion().GetType() != pdu.FilesystemVersion_Snapshot {
+		return nil, fmt.Errorf("version %q is not a snapshot", req.GetVersion().GetName())
+	}
+	version, err := sendArgsFromPDUAndValidateExistsAndGetVersion(ctx, lp.ToString(), req.GetVersion())
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := zfs.ZFSChecksumVersion(ctx, lp.ToString(), version, method)
+	if err != nil {
+		return nil, err
+	}
+	return &pdu.ChecksumVersionRes{Checksum: checksum}, nil
+}
+
 func doDestroySnapshots(ctx context.Context, lp *zfs.DatasetPath, snaps []*pdu.FilesystemVersion) (*pdu.DestroySnapshotsRes, error) {
 	reqs := make([]*zfs.DestroySnapOp, len(snaps))
 	ress := make([]*pdu.DestroySnapshotRes, len(snaps))
@@ -0,0 +1,91 @@
+package endpoint
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// Returns the values of fs's zfs.ACLProperties for SendRes.ACLProperties.
+// Errors are logged and result in no properties, the receiver then keeps its own.
+func senderACLProperties(ctx context.Context, fs string) []*pdu.Property {
+	m, err := zfs.ZFSGetACLProperties(ctx, fs)
+	if err != nil {
+		getLogger(ctx).WithError(err).WithField("fs", fs).Warn("cannot get ACL properties, receiver will not be able to preserve them")
+		return nil
+	}
+	props := make([]*pdu.Property, 0, len(m))
+	for _, name := range zfs.ACLProperties {
+		if val, ok := m[name]; ok {
+			props = append(props, &pdu.Property{Name: name, Value: val})
+		}
+	}
+	return props
+}
+
+var aclPropertyValueRegexp = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Returns the properties of sent whose values differ from current, in the order of sent.
+// sent is controlled by the client, hence only zfs.ACLProperties with plain values are accepted.
+func aclPropertiesToSet(sent []*pdu.Property, current map[string]string) ([]*pdu.Property, error) {
+	var set []*pdu.Property
+	seen := make(map[string]bool, len(sent))
+	for _, p := range sent {
+		known := false
+		for _, name := range zfs.ACLProperties {
+			known = known || p.GetName() == name
+		}
+		if !known {
+			return nil, errors.Errorf("%q is not an ACL property", p.GetName())
+		}
+		if seen[p.GetName()] {
+			return nil, errors.Errorf("ACL property %q sent twice", p.GetName())
+		}
+		seen[p.GetName()] = true
+		if !aclPropertyValueRegexp.MatchString(p.GetValue()) {
+			return nil, errors.Errorf("invalid value %q for ACL property %q", p.GetValue(), p.GetName())
+		}
+		if current[p.GetName()] != p.GetValue() {
+			set = append(set, p)
+		}
+	}
+	return set, nil
+}
+
+// Sets the ACL properties of the received filesystem lp to the sender's values
+// (ReceiverConfig.PreserveACLProperties).
+// Properties or values that are not supported by the receiver's platform, e.g.,
+// acltype=posix on FreeBSD, are logged and skipped, they do not fail the receive.
+func (s *Receiver) preserveACLProperties(ctx context.Context, lp *zfs.DatasetPath, sent []*pdu.Property) error {
+	log := getLogger(ctx).WithField("local_fs", lp.ToString())
+	if len(sent) == 0 {
+		log.Debug("sender did not send ACL properties, keeping those of the receiver")
+		return nil
+	}
+	current, err := zfs.ZFSGetACLProperties(ctx, lp.ToString())
+	if err != nil {
+		return errors.Wrap(err, "cannot get ACL properties of received filesystem")
+	}
+	set, err := aclPropertiesToSet(sent, current)
+	if err != nil {
+		return errors.Wrap(err, "`ACLProperties` invalid")
+	}
+	for _, p := range set {
+		log := log.WithField("property", p.GetName()).WithField("value", p.GetValue()).WithField("current_value", current[p.GetName()])
+		if _, ok := current[p.GetName()]; !ok {
+			log.Warn("ACL property of sender is not supported by receiver, skipping")
+			continue
+		}
+		log.Info("setting ACL property to sender's value")
+		props := zfs.NewZFSProperties()
+		props.Set(p.GetName(), p.GetValue())
+		if err := zfs.ZFSSet(ctx, lp, props); err != nil {
+			log.WithError(err).Warn("cannot set ACL property to sender's value, skipping")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package endpoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestACLPropertiesToSet(t *testing.T) {
+	sent := []*pdu.Property{
+		{Name: "acltype", Value: "posix"},
+		{Name: "aclinherit", Value: "restricted"},
+	}
+	current := map[string]string{"acltype": "nfsv4", "aclinherit": "restricted", "aclmode": "discard"}
+	set, err := aclPropertiesToSet(sent, current)
+	require.NoError(t, err)
+	assert.Equal(t, []*pdu.Property{{Name: "acltype", Value: "posix"}}, set)
+
+	set, err = aclPropertiesToSet(nil, current)
+	require.NoError(t, err)
+	assert.Empty(t, set)
+
+	// the client must not be able to set arbitrary properties
+	_, err = aclPropertiesToSet([]*pdu.Property{{Name: "mountpoint", Value: "/etc"}}, current)
+	assert.Error(t, err)
+	_, err = aclPropertiesToSet([]*pdu.Property{{Name: "acltype", Value: "off aclmode=x"}}, current)
+	assert.Error(t, err)
+	_, err = aclPropertiesToSet([]*pdu.Property{{Name: "acltype", Value: "off"}, {Name: "acltype", Value: "posix"}}, current)
+	assert.Error(t, err)
+}
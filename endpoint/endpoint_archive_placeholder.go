@@ -0,0 +1,54 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/util/envconst"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// archivePlaceholderData renames the existing placeholder filesystem lp to <lp>_old_<timestamp>
+// if a forced receive (zfs recv -F) into it would discard data, and returns whether it did so.
+// If lp holds data but cannot be renamed because it has children, the receive is refused.
+func (s *Receiver) archivePlaceholderData(ctx context.Context, lp *zfs.DatasetPath) (archived bool, _ error) {
+	contents, err := zfs.ZFSGetPlaceholderContents(ctx, lp)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot determine contents of placeholder filesystem")
+	}
+	threshold := uint64(envconst.Int64("ZREPL_ENDPOINT_PLACEHOLDER_DATA_THRESHOLD", 1<<20))
+	if !contents.HoldsData(threshold) {
+		return false, nil
+	}
+
+	log := getLogger(ctx).
+		WithField("local_fs", lp.ToString()).
+		WithField("snapshots", contents.Snapshots).
+		WithField("usedbydataset", contents.UsedByDataset)
+
+	if contents.Children > 0 {
+		err := errors.Errorf("refusing to overwrite placeholder filesystem %q with incoming full send: "+
+			"it holds data (%d snapshots, %d bytes) that cannot be archived automatically because the filesystem has children, "+
+			"move the data aside or clear the placeholder manually", lp.ToString(), contents.Snapshots, contents.UsedByDataset)
+		log.WithError(err).Error("cannot archive placeholder filesystem")
+		return false, err
+	}
+
+	archive, err := zfs.NewDatasetPath(fmt.Sprintf("%s_old_%s", lp.ToString(), time.Now().UTC().Format("20060102_150405")))
+	if err != nil {
+		return false, errors.Wrap(err, "cannot determine archive name for placeholder filesystem")
+	}
+	log.WithField("archive", archive.ToString()).
+		Warn("placeholder filesystem holds data, archiving it instead of overwriting it with incoming full send")
+	if err := zfs.ZFSRename(ctx, lp, archive); err != nil {
+		return false, errors.Wrap(err, "cannot archive placeholder filesystem")
+	}
+	// the archive is regular data now and must not be overwritten or hidden as a placeholder
+	if err := zfs.ZFSSetPlaceholder(ctx, archive, false); err != nil {
+		return true, errors.Wrapf(err, "cannot clear placeholder property of archived filesystem %q", archive.ToString())
+	}
+	return true, nil
+}
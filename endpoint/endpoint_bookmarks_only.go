@@ -0,0 +1,72 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// doBookmarkAndDestroySnapshots implements DestroySnapshots for SenderConfig.BookmarksOnly:
+// each snapshot is only destroyed if a bookmark with the snapshot's name exists
+// or could be created, i.e., the pruner converts the snapshots to bookmarks.
+func doBookmarkAndDestroySnapshots(ctx context.Context, lp *zfs.DatasetPath, snaps []*pdu.FilesystemVersion) (*pdu.DestroySnapshotsRes, error) {
+	return bookmarkAndDestroySnapshots(ctx, lp, snaps, bookmarkSnapshot, doDestroySnapshots)
+}
+
+type destroySnapshotsFunc func(ctx context.Context, lp *zfs.DatasetPath, snaps []*pdu.FilesystemVersion) (*pdu.DestroySnapshotsRes, error)
+
+func bookmarkAndDestroySnapshots(ctx context.Context, lp *zfs.DatasetPath, snaps []*pdu.FilesystemVersion,
+	bookmark func(ctx context.Context, fs string, snap *pdu.FilesystemVersion) error, destroy destroySnapshotsFunc) (*pdu.DestroySnapshotsRes, error) {
+
+	ress := make([]*pdu.DestroySnapshotRes, len(snaps))
+	bookmarked := make([]*pdu.FilesystemVersion, 0, len(snaps))
+	for i, fsv := range snaps {
+		if fsv.Type != pdu.FilesystemVersion_Snapshot {
+			return nil, fmt.Errorf("version %q is not a snapshot", fsv.Name)
+		}
+		ress[i] = &pdu.DestroySnapshotRes{Snapshot: fsv}
+		if err := bookmark(ctx, lp.ToString(), fsv); err != nil {
+			getLogger(ctx).WithError(err).WithField("fs", lp.ToString()).WithField("snap", fsv.Name).
+				Error("cannot bookmark snapshot, not destroying it")
+			ress[i].Error = fmt.Sprintf("cannot bookmark snapshot before destroying it: %s", err)
+			continue
+		}
+		bookmarked = append(bookmarked, fsv)
+	}
+	if len(bookmarked) == 0 {
+		return &pdu.DestroySnapshotsRes{Results: ress}, nil
+	}
+
+	res, err := destroy(ctx, lp, bookmarked)
+	if err != nil {
+		return nil, err
+	}
+	destroyResults := make(map[string]*pdu.DestroySnapshotRes, len(res.Results))
+	for _, r := range res.Results {
+		destroyResults[r.Snapshot.GetName()] = r
+	}
+	for i := range ress {
+		if r, ok := destroyResults[ress[i].Snapshot.GetName()]; ok {
+			ress[i] = r
+		}
+	}
+	return &pdu.DestroySnapshotsRes{Results: ress}, nil
+}
+
+// bookmarkSnapshot idempotently creates fs#name for fs@name.
+// It fails if the snapshot's guid does not match the guid of snap.
+func bookmarkSnapshot(ctx context.Context, fs string, snap *pdu.FilesystemVersion) error {
+	v, err := zfs.ZFSGetFilesystemVersion(ctx, fmt.Sprintf("%s@%s", fs, snap.GetName()))
+	if err != nil {
+		return err
+	}
+	if v.Guid != snap.GetGuid() {
+		return errors.Errorf("snapshot guid %d does not match the requested guid %d", v.Guid, snap.GetGuid())
+	}
+	_, err = zfs.ZFSBookmark(ctx, fs, v, v.Name)
+	return err
+}
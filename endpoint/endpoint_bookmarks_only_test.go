@@ -0,0 +1,62 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestBookmarkAndDestroySnapshots(t *testing.T) {
+	ctx := context.Background()
+	lp, err := zfs.NewDatasetPath("pool/data")
+	require.NoError(t, err)
+
+	snaps := []*pdu.FilesystemVersion{
+		{Type: pdu.FilesystemVersion_Snapshot, Name: "a", Guid: 1},
+		{Type: pdu.FilesystemVersion_Snapshot, Name: "b", Guid: 2},
+		{Type: pdu.FilesystemVersion_Snapshot, Name: "c", Guid: 3},
+	}
+	var bookmarked []string
+	bookmark := func(ctx context.Context, fs string, snap *pdu.FilesystemVersion) error {
+		assert.Equal(t, "pool/data", fs)
+		if snap.Name == "b" {
+			return errors.New("bookmark exists")
+		}
+		bookmarked = append(bookmarked, snap.Name)
+		return nil
+	}
+	var destroyed []string
+	destroy := func(ctx context.Context, lp *zfs.DatasetPath, snaps []*pdu.FilesystemVersion) (*pdu.DestroySnapshotsRes, error) {
+		res := &pdu.DestroySnapshotsRes{}
+		for _, s := range snaps {
+			destroyed = append(destroyed, s.Name)
+			r := &pdu.DestroySnapshotRes{Snapshot: s}
+			if s.Name == "c" {
+				r.Error = "dataset is busy"
+			}
+			res.Results = append(res.Results, r)
+		}
+		return res, nil
+	}
+
+	res, err := bookmarkAndDestroySnapshots(ctx, lp, snaps, bookmark, destroy)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, bookmarked)
+	assert.Equal(t, []string{"a", "c"}, destroyed, "snapshots that could not be bookmarked must not be destroyed")
+	require.Len(t, res.Results, 3)
+	for i, r := range res.Results {
+		assert.Equal(t, snaps[i], r.Snapshot)
+	}
+	assert.Empty(t, res.Results[0].Error)
+	assert.Contains(t, res.Results[1].Error, "cannot bookmark snapshot")
+	assert.Equal(t, "dataset is busy", res.Results[2].Error)
+
+	_, err = bookmarkAndDestroySnapshots(ctx, lp, []*pdu.FilesystemVersion{{Type: pdu.FilesystemVersion_Bookmark, Name: "a"}}, bookmark, destroy)
+	assert.Error(t, err)
+}
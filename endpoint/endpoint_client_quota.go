@@ -0,0 +1,74 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// ClientQuotaExceededError is returned by Receiver.Receive if the client root filesystem
+// has reached its quota (ReceiverConfig.ClientQuota) or if zfs recv failed because of it.
+//
+// The error message is forwarded to the sender as is and starts with ClientQuotaExceededErrorPrefix
+// so that it can be recognized in the sender's replication status.
+type ClientQuotaExceededError struct {
+	ClientRoot string
+	Quota      uint64
+	Used       uint64 // zero if unknown
+	Cause      error  // the zfs recv error, if any
+}
+
+const ClientQuotaExceededErrorPrefix = "client quota exceeded"
+
+func (e *ClientQuotaExceededError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: quota of %q is %d bytes: %s", ClientQuotaExceededErrorPrefix, e.ClientRoot, e.Quota, e.Cause)
+	}
+	return fmt.Sprintf("%s: %q uses %d of %d bytes", ClientQuotaExceededErrorPrefix, e.ClientRoot, e.Used, e.Quota)
+}
+
+// Sets the quota of the client root filesystem to the configured value
+// and refuses the receive if it has already been used up.
+// The client root must exist.
+func (s *Receiver) enforceClientQuota(ctx context.Context, clientRoot *zfs.DatasetPath) error {
+	quota := s.conf.ClientQuota
+	props, err := zfs.ZFSGet(ctx, clientRoot, []string{"quota", "used"})
+	if err != nil {
+		return errors.Wrap(err, "cannot get quota of client root filesystem")
+	}
+	currentQuota, err := strconv.ParseUint(props.Get("quota"), 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "cannot parse quota of client root filesystem")
+	}
+	used, err := strconv.ParseUint(props.Get("used"), 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "cannot parse used space of client root filesystem")
+	}
+
+	if currentQuota != quota {
+		getLogger(ctx).
+			WithField("client_root", clientRoot.ToString()).
+			WithField("current_quota", currentQuota).
+			WithField("quota", quota).
+			Info("setting quota of client root filesystem")
+		setProps := zfs.NewZFSProperties()
+		setProps.Set("quota", strconv.FormatUint(quota, 10))
+		if err := zfs.ZFSSet(ctx, clientRoot, setProps); err != nil {
+			return errors.Wrap(err, "cannot set quota of client root filesystem")
+		}
+	}
+
+	if used >= quota {
+		return &ClientQuotaExceededError{ClientRoot: clientRoot.ToString(), Quota: quota, Used: used}
+	}
+	return nil
+}
+
+func isZFSQuotaExceededErr(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "quota exceeded")
+}
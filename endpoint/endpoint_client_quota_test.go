@@ -0,0 +1,20 @@
+package endpoint
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientQuotaExceededError(t *testing.T) {
+	err := &ClientQuotaExceededError{ClientRoot: "pool/sink/client1", Quota: 1 << 30, Used: 1 << 30}
+	assert.Equal(t, `client quota exceeded: "pool/sink/client1" uses 1073741824 of 1073741824 bytes`, err.Error())
+
+	recvErr := errors.New("cannot receive incremental stream: disk quota exceeded")
+	assert.True(t, isZFSQuotaExceededErr(recvErr))
+	assert.False(t, isZFSQuotaExceededErr(errors.New("cannot receive incremental stream: destination has been modified")))
+
+	err = &ClientQuotaExceededError{ClientRoot: "pool/sink/client1", Quota: 1 << 30, Cause: recvErr}
+	assert.Regexp(t, "^"+ClientQuotaExceededErrorPrefix+`: .*disk quota exceeded$`, err.Error())
+}
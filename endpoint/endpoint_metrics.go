@@ -1,7 +1,40 @@
 package endpoint
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/util/streambuffer"
+)
 
 func RegisterMetrics(r prometheus.Registerer) {
 	r.MustRegister(abstractionsCacheMetrics.count)
+	r.MustRegister(streamBufferMetricsVecs.buffered)
+	r.MustRegister(streamBufferMetricsVecs.capacity)
+}
+
+var streamBufferMetricsVecs struct {
+	buffered, capacity *prometheus.GaugeVec
+}
+
+func init() {
+	streamBufferMetricsVecs.buffered = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "zrepl",
+		Subsystem: "endpoint",
+		Name:      "stream_buffer_bytes",
+		Help:      "number of bytes held in the send or recv stream buffers",
+	}, []string{"side"})
+	streamBufferMetricsVecs.capacity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "zrepl",
+		Subsystem: "endpoint",
+		Name:      "stream_buffer_capacity_bytes",
+		Help:      "total capacity of the send or recv stream buffers in use",
+	}, []string{"side"})
+}
+
+// side is either send or recv
+func streamBufferMetrics(side string) streambuffer.Metrics {
+	return streambuffer.Metrics{
+		Buffered: streamBufferMetricsVecs.buffered.WithLabelValues(side),
+		Capacity: streamBufferMetricsVecs.capacity.WithLabelValues(side),
+	}
 }
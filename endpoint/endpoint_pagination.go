@@ -0,0 +1,96 @@
+package endpoint
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/util/envconst"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// listFilesystemsPage returns the filesystems of the page requested by r, the filesystems after it
+// and the token for the next page.
+// root is the prefix that is trimmed from fss to present them to the client, or nil.
+// fss is sorted in place.
+func listFilesystemsPage(fss []*zfs.DatasetPath, root *zfs.DatasetPath, r *pdu.ListFilesystemReq) (page, rest []*zfs.DatasetPath, nextPageToken string) {
+	if r.GetPageSize() == 0 && r.GetPageToken() == "" {
+		return fss, nil, ""
+	}
+	presented := func(fs *zfs.DatasetPath) string {
+		if root == nil {
+			return fs.ToString()
+		}
+		p := fs.Copy()
+		p.TrimPrefix(root)
+		return p.ToString()
+	}
+	sort.Slice(fss, func(i, j int) bool { return presented(fss[i]) < presented(fss[j]) })
+	start := sort.Search(len(fss), func(i int) bool { return presented(fss[i]) > r.GetPageToken() })
+	page = fss[start:]
+	if r.GetPageSize() > 0 && uint64(len(page)) > uint64(r.GetPageSize()) {
+		page, rest = page[:r.GetPageSize()], page[r.GetPageSize():]
+		nextPageToken = presented(page[len(page)-1])
+	}
+	return page, rest, nextPageToken
+}
+
+var listingsCacheMaxAge = envconst.Duration("ZREPL_ENDPOINT_LIST_FILESYSTEMS_PAGE_MAX_AGE", 1*time.Minute)
+
+// listingsCache keeps the remainder of a paginated ListFilesystems listing
+// so that the request for the next page does not list all filesystems again.
+//
+// Entries are keyed by the client root and the next page token, are served at most once
+// and expire after listingsCacheMaxAge. A request whose token is not in the cache,
+// e.g., after a daemon restart, lists the filesystems again and continues after the token.
+//
+// The zero value is ready to use.
+type listingsCache struct {
+	mtx     sync.Mutex
+	entries map[listingsCacheKey]listingsCacheEntry
+}
+
+type listingsCacheKey struct {
+	root, token string
+}
+
+type listingsCacheEntry struct {
+	rest    []*zfs.DatasetPath
+	expires time.Time
+}
+
+func (c *listingsCache) put(root, token string, rest []*zfs.DatasetPath, now time.Time) {
+	if token == "" {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[listingsCacheKey]listingsCacheEntry)
+	}
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[listingsCacheKey{root, token}] = listingsCacheEntry{rest, now.Add(listingsCacheMaxAge)}
+}
+
+func (c *listingsCache) take(root, token string, now time.Time) (rest []*zfs.DatasetPath, ok bool) {
+	if token == "" {
+		return nil, false
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	k := listingsCacheKey{root, token}
+	e, ok := c.entries[k]
+	if !ok {
+		return nil, false
+	}
+	delete(c.entries, k)
+	if now.After(e.expires) {
+		return nil, false
+	}
+	return e.rest, true
+}
@@ -0,0 +1,77 @@
+package endpoint
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestListFilesystemsPage(t *testing.T) {
+	root, err := zfs.NewDatasetPath("pool/sink/client")
+	require.NoError(t, err)
+	var fss []*zfs.DatasetPath
+	for _, p := range []string{"c", "a", "a/b", "b"} {
+		fs, err := zfs.NewDatasetPath("pool/sink/client/" + p)
+		require.NoError(t, err)
+		fss = append(fss, fs)
+	}
+	names := func(page []*zfs.DatasetPath) (ns []string) {
+		for _, fs := range page {
+			ns = append(ns, fs.ToString())
+		}
+		return ns
+	}
+
+	page, rest, next := listFilesystemsPage(fss, root, &pdu.ListFilesystemReq{})
+	assert.Len(t, page, 4)
+	assert.Empty(t, rest)
+	assert.Empty(t, next)
+
+	page, rest, next = listFilesystemsPage(fss, root, &pdu.ListFilesystemReq{PageSize: 2})
+	assert.Equal(t, []string{"pool/sink/client/a", "pool/sink/client/a/b"}, names(page))
+	assert.Equal(t, []string{"pool/sink/client/b", "pool/sink/client/c"}, names(rest))
+	assert.Equal(t, "a/b", next)
+
+	// continuing from the rest yields the same page as continuing from the full listing
+	restPage, _, restNext := listFilesystemsPage(rest, root, &pdu.ListFilesystemReq{PageSize: 2, PageToken: next})
+	page, rest, next = listFilesystemsPage(fss, root, &pdu.ListFilesystemReq{PageSize: 2, PageToken: next})
+	assert.Equal(t, []string{"pool/sink/client/b", "pool/sink/client/c"}, names(page))
+	assert.Equal(t, names(page), names(restPage))
+	assert.Empty(t, rest)
+	assert.Empty(t, next)
+	assert.Empty(t, restNext)
+
+	page, _, next = listFilesystemsPage(fss, root, &pdu.ListFilesystemReq{PageSize: 2, PageToken: "c"})
+	assert.Empty(t, page)
+	assert.Empty(t, next)
+}
+
+func TestListingsCache(t *testing.T) {
+	var c listingsCache
+	fs, err := zfs.NewDatasetPath("pool/a")
+	require.NoError(t, err)
+	rest := []*zfs.DatasetPath{fs}
+	now := time.Now()
+
+	c.put("pool", "", rest, now)
+	_, ok := c.take("pool", "", now)
+	assert.False(t, ok, "the first page is never cached")
+
+	c.put("pool", "x", rest, now)
+	_, ok = c.take("other", "x", now)
+	assert.False(t, ok, "entries are per client root")
+	got, ok := c.take("pool", "x", now)
+	assert.True(t, ok)
+	assert.Equal(t, rest, got)
+	_, ok = c.take("pool", "x", now)
+	assert.False(t, ok, "entries are served at most once")
+
+	c.put("pool", "x", rest, now)
+	_, ok = c.take("pool", "x", now.Add(listingsCacheMaxAge+time.Second))
+	assert.False(t, ok, "expired entries are not served")
+}
@@ -0,0 +1,34 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/util/chainlock"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestReleasePlaceholderParentsKeepsPlaceholdersInUse(t *testing.T) {
+	ctx := context.Background()
+	// two in-flight receives below pool/a, which was created as a placeholder for the first one
+	s := &Receiver{
+		recvParentCreationMtx: chainlock.New(),
+		recvParentUsers:       map[string]int{"pool": 2, "pool/a": 2},
+	}
+	first, err := zfs.NewDatasetPath("pool/a/x")
+	require.NoError(t, err)
+	second, err := zfs.NewDatasetPath("pool/a/y")
+	require.NoError(t, err)
+	created, err := zfs.NewDatasetPath("pool/a")
+	require.NoError(t, err)
+
+	// the failed first receive must not remove pool/a (which would require zfs) because the second one depends on it
+	s.releasePlaceholderParents(ctx, first, []*zfs.DatasetPath{created}, true)
+	assert.Equal(t, map[string]int{"pool": 1, "pool/a": 1}, s.recvParentUsers)
+
+	s.releasePlaceholderParents(ctx, second, nil, false)
+	assert.Empty(t, s.recvParentUsers)
+}
@@ -0,0 +1,63 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// ReadOnlySender is the Handler of a sender with SenderConfig.ReadOnly set.
+//
+// It refuses every request that would modify the sending side's datasets,
+// i.e., destroy snapshots or write properties, before it reaches the Sender,
+// so that the guarantee does not depend on the Sender's implementation of these requests.
+// Refused requests are logged as warnings.
+//
+// zrepl's own holds and bookmarks (replication cursors) are still created and destroyed
+// as required by the replication guarantees.
+type ReadOnlySender struct {
+	*Sender
+}
+
+const readOnlySenderRefusal = "sender is read-only (send.readonly_sender)"
+
+func refuseReadOnly(ctx context.Context, rpc, fs string) error {
+	getLogger(ctx).WithField("rpc", rpc).WithField("filesystem", fs).
+		Warn("refusing request that would modify the read-only sender")
+	return fmt.Errorf("%s, refusing %s of %q", readOnlySenderRefusal, rpc, fs)
+}
+
+// DestroySnapshots refuses the destruction of each snapshot individually
+// so that the pruner reports them, configure keep_sender to keep all snapshots.
+func (s ReadOnlySender) DestroySnapshots(ctx context.Context, req *pdu.DestroySnapshotsReq) (*pdu.DestroySnapshotsRes, error) {
+	err := refuseReadOnly(ctx, "DestroySnapshots", req.GetFilesystem())
+	res := &pdu.DestroySnapshotsRes{}
+	for _, snap := range req.GetSnapshots() {
+		res.Results = append(res.Results, &pdu.DestroySnapshotRes{
+			Snapshot: snap,
+			Error:    err.Error() + ", configure keep_sender to keep all snapshots",
+		})
+	}
+	return res, nil
+}
+
+func (s ReadOnlySender) Receive(ctx context.Context, r *pdu.ReceiveReq, receive io.ReadCloser) (*pdu.ReceiveRes, error) {
+	if receive != nil {
+		receive.Close()
+	}
+	return nil, refuseReadOnly(ctx, "Receive", r.GetFilesystem())
+}
+
+func (s ReadOnlySender) RenameFilesystem(ctx context.Context, r *pdu.RenameFilesystemReq) (*pdu.RenameFilesystemRes, error) {
+	return nil, refuseReadOnly(ctx, "RenameFilesystem", r.GetFilesystem())
+}
+
+func (s ReadOnlySender) Rollback(ctx context.Context, r *pdu.RollbackReq) (*pdu.RollbackRes, error) {
+	return nil, refuseReadOnly(ctx, "Rollback", r.GetFilesystem())
+}
+
+func (s ReadOnlySender) DestroyFilesystem(ctx context.Context, r *pdu.DestroyFilesystemReq) (*pdu.DestroyFilesystemRes, error) {
+	return nil, refuseReadOnly(ctx, "DestroyFilesystem", r.GetFilesystem())
+}
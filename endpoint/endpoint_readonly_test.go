@@ -0,0 +1,38 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestReadOnlySenderRefusesModifications(t *testing.T) {
+	ctx := context.Background()
+	// the refusals must not reach the Sender
+	s := ReadOnlySender{Sender: nil}
+
+	snaps := []*pdu.FilesystemVersion{
+		{Type: pdu.FilesystemVersion_Snapshot, Name: "a"},
+		{Type: pdu.FilesystemVersion_Snapshot, Name: "b"},
+	}
+	res, err := s.DestroySnapshots(ctx, &pdu.DestroySnapshotsReq{Filesystem: "pool/data", Snapshots: snaps})
+	require.NoError(t, err)
+	require.Len(t, res.Results, 2)
+	for i, r := range res.Results {
+		assert.Equal(t, snaps[i], r.Snapshot)
+		assert.Contains(t, r.Error, "read-only")
+	}
+
+	_, err = s.Receive(ctx, &pdu.ReceiveReq{Filesystem: "pool/data"}, nil)
+	assert.Error(t, err)
+	_, err = s.RenameFilesystem(ctx, &pdu.RenameFilesystemReq{Filesystem: "pool/data", NewFilesystem: "pool/other"})
+	assert.Error(t, err)
+	_, err = s.Rollback(ctx, &pdu.RollbackReq{Filesystem: "pool/data"})
+	assert.Error(t, err)
+	_, err = s.DestroyFilesystem(ctx, &pdu.DestroyFilesystemReq{Filesystem: "pool/data_deleted_20200101_000000"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,101 @@
+package endpoint
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// Rollback rolls a received filesystem back to one of its snapshots, destroying all later snapshots and bookmarks.
+// It is only permitted if ReceiverConfig.AllowRollback is set and ReceiverConfig.AppendOnly is not.
+//
+// The last-received-hold is moved to the snapshot before the rollback,
+// other holds on the snapshots that would be destroyed make the rollback fail,
+// as do snapshots that would be destroyed but are excluded by ReceiverConfig.VersionFilter.
+func (s *Receiver) Rollback(ctx context.Context, req *pdu.RollbackReq) (*pdu.RollbackRes, error) {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+
+	if s.conf.AppendOnly {
+		return nil, errors.New("receiver is append-only (recv.append_only), rollback is not permitted")
+	}
+	if !s.conf.AllowRollback {
+		return nil, errors.New("receiver does not permit rollback (recv.allow_rollback)")
+	}
+
+	root := s.clientRootFromCtx(ctx)
+	lp, err := subroot{root}.MapToLocal(req.GetFilesystem())
+	if err != nil {
+		return nil, errors.Wrap(err, "`Filesystem` invalid")
+	}
+	if req.GetSnapshot() == nil || req.GetSnapshot().GetType() != pdu.FilesystemVersion_Snapshot {
+		return nil, errors.New("`Snapshot` must be a snapshot")
+	}
+	if err := s.conf.VersionFilter.check(req.GetFilesystem(), req.GetSnapshot()); err != nil {
+		return nil, errors.Wrap(err, "`Snapshot` invalid")
+	}
+
+	ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, lp)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get placeholder state")
+	}
+	if !ph.FSExists {
+		return nil, errors.Errorf("filesystem %q does not exist", req.GetFilesystem())
+	}
+	if ph.IsPlaceholder {
+		return nil, errors.Errorf("filesystem %q is a placeholder", req.GetFilesystem())
+	}
+
+	// identify the snapshot by GUID since its local name may have a snapshot prefix
+	snaps, err := zfs.ZFSListFilesystemVersions(ctx, lp, zfs.ListFilesystemVersionsOptions{Types: zfs.Snapshots})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot list snapshots")
+	}
+	var target *zfs.FilesystemVersion
+	for i := range snaps {
+		if snaps[i].Guid == req.GetSnapshot().GetGuid() {
+			target = &snaps[i]
+		}
+	}
+	if target == nil {
+		return nil, errors.Errorf("snapshot %q does not exist on the receiver", req.GetSnapshot().RelName())
+	}
+	var destroyed []string
+	var destroyedPresented []*pdu.FilesystemVersion
+	for i := range snaps {
+		if snaps[i].CreateTXG > target.CreateTXG {
+			destroyed = append(destroyed, snaps[i].RelName())
+			destroyedPresented = append(destroyedPresented, pdu.FilesystemVersionFromZFS(&snaps[i]))
+		}
+	}
+	// the rollback must not destroy snapshots that the version filter hides from the client
+	versionsToPresented(s.snapshotPrefix(ctx), destroyedPresented)
+	for _, v := range destroyedPresented {
+		if err := s.conf.VersionFilter.check(req.GetFilesystem(), v); err != nil {
+			return nil, errors.Wrap(err, "rollback would destroy a snapshot")
+		}
+	}
+
+	log := getLogger(ctx).WithField("fs", lp.ToString()).WithField("snapshot", target.RelName())
+
+	// we never want to be without a last-received-hold
+	// => hold the rollback target before releasing the holds on the snapshots that the rollback destroys
+	hold, err := CreateLastReceivedHold(ctx, lp.ToString(), *target, s.conf.JobID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot move last-received-hold to rollback target")
+	}
+	abstractionsCacheSingleton.Put(hold)
+	keep := func(a Abstraction) bool { return AbstractionEquals(a, hold) }
+	check := func(obsoleteAbs []Abstraction) {}
+	abstractionsCacheSingleton.TryBatchDestroy(ctx, s.conf.JobID, lp.ToString(), AbstractionTypeSet{AbstractionLastReceivedHold: true}, keep, check)
+
+	log.WithField("destroyed", destroyed).Warn("rolling back filesystem, destroying later snapshots and bookmarks")
+	if err := zfs.ZFSRollback(ctx, lp, *target, "-r"); err != nil {
+		log.WithError(err).Error("cannot roll back filesystem")
+		return nil, err
+	}
+	return &pdu.RollbackRes{}, nil
+}
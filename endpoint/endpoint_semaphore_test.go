@@ -0,0 +1,56 @@
+package endpoint
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/util/semaphore"
+)
+
+func TestAcquireStreamSemaphoreDryRunOvertakesQueuedSends(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	sem := semaphore.New(fullStreamSemaphoreWeight)
+	running, err := acquireStreamSemaphore(ctx, sem, true, false)
+	require.NoError(t, err)
+
+	var mtx sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	acquire := func(name string, full, dryRun bool) {
+		ctx, end := trace.WithTaskFromStack(ctx)
+		defer end()
+		defer wg.Done()
+		g, err := acquireStreamSemaphore(ctx, sem, full, dryRun)
+		require.NoError(t, err)
+		mtx.Lock()
+		order = append(order, name)
+		mtx.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		g.Release()
+	}
+	// enqueue one after another so that the order of the queued sends is defined
+	for _, a := range []struct {
+		name         string
+		full, dryRun bool
+	}{
+		{"full send", true, false},
+		{"incremental send", false, false},
+		{"size estimate", true, true},
+	} {
+		wg.Add(1)
+		go acquire(a.name, a.full, a.dryRun)
+		time.Sleep(10 * time.Millisecond)
+	}
+	running.Release()
+	wg.Wait()
+
+	assert.Equal(t, []string{"size estimate", "full send", "incremental send"}, order)
+}
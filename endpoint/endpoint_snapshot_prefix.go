@@ -0,0 +1,97 @@
+package endpoint
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// Occurrences in ReceiverConfig.SnapshotPrefix are replaced with the client identity.
+const SnapshotPrefixClientIdentityPlaceholder = "${client_identity}"
+
+func validateSnapshotPrefix(prefix string, appendClientIdentity bool) error {
+	if prefix == "" {
+		return nil
+	}
+	if strings.Contains(prefix, SnapshotPrefixClientIdentityPlaceholder) {
+		if !appendClientIdentity {
+			return errors.Errorf("%s can only be used if the client identity is known", SnapshotPrefixClientIdentityPlaceholder)
+		}
+		prefix = strings.Replace(prefix, SnapshotPrefixClientIdentityPlaceholder, "client", -1)
+	}
+	if err := zfs.EntityNamecheck("pool@"+prefix+"snap", zfs.EntityTypeSnapshot); err != nil {
+		return errors.Wrap(err, "invalid snapshot prefix")
+	}
+	return nil
+}
+
+func (s *Receiver) snapshotPrefix(ctx context.Context) string {
+	prefix := s.conf.SnapshotPrefix
+	if s.conf.AppendClientIdentity && strings.Contains(prefix, SnapshotPrefixClientIdentityPlaceholder) {
+		clientIdentity, ok := ctx.Value(ClientIdentityKey).(string)
+		if !ok {
+			panic("ClientIdentityKey context value must be set")
+		}
+		prefix = strings.Replace(prefix, SnapshotPrefixClientIdentityPlaceholder, clientIdentity, -1)
+	}
+	return prefix
+}
+
+// Presents local snapshots with prefix without it. Bookmarks and snapshots without the prefix are presented as is.
+func versionsToPresented(prefix string, local []*pdu.FilesystemVersion) {
+	if prefix == "" {
+		return
+	}
+	for _, v := range local {
+		if v.GetType() == pdu.FilesystemVersion_Snapshot && strings.HasPrefix(v.GetName(), prefix) && len(v.GetName()) > len(prefix) {
+			v.Name = strings.TrimPrefix(v.GetName(), prefix)
+		}
+	}
+}
+
+// Maps presented snapshots to the local snapshots with the same GUID, or, if there is none, to the prefixed name.
+// The input is not modified.
+func versionsToLocal(prefix string, presented []*pdu.FilesystemVersion, local []zfs.FilesystemVersion) []*pdu.FilesystemVersion {
+	localByGUID := make(map[uint64]string, len(local))
+	for _, l := range local {
+		if l.Type == zfs.Snapshot {
+			localByGUID[l.Guid] = l.Name
+		}
+	}
+	out := make([]*pdu.FilesystemVersion, len(presented))
+	for i, v := range presented {
+		if v.GetType() != pdu.FilesystemVersion_Snapshot {
+			out[i] = v
+			continue
+		}
+		name, ok := localByGUID[v.GetGuid()]
+		if !ok {
+			name = prefix + v.GetName()
+		}
+		out[i] = &pdu.FilesystemVersion{
+			Type:      v.GetType(),
+			Name:      name,
+			Guid:      v.GetGuid(),
+			CreateTXG: v.GetCreateTXG(),
+			Creation:  v.GetCreation(),
+		}
+	}
+	return out
+}
+
+// Like versionsToLocal, but lists the snapshots of lp if a snapshot prefix is configured.
+func (s *Receiver) versionsToLocal(ctx context.Context, lp *zfs.DatasetPath, presented []*pdu.FilesystemVersion) ([]*pdu.FilesystemVersion, error) {
+	prefix := s.snapshotPrefix(ctx)
+	if prefix == "" {
+		return presented, nil
+	}
+	local, err := zfs.ZFSListFilesystemVersions(ctx, lp, zfs.ListFilesystemVersionsOptions{Types: zfs.Snapshots})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot list snapshots for snapshot prefix translation")
+	}
+	return versionsToLocal(prefix, presented, local), nil
+}
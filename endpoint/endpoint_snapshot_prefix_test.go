@@ -0,0 +1,51 @@
+package endpoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestValidateSnapshotPrefix(t *testing.T) {
+	assert.NoError(t, validateSnapshotPrefix("", false))
+	assert.NoError(t, validateSnapshotPrefix("clientA_", false))
+	assert.NoError(t, validateSnapshotPrefix("${client_identity}_", true))
+	assert.Error(t, validateSnapshotPrefix("${client_identity}_", false))
+	assert.Error(t, validateSnapshotPrefix("a@b", false))
+	assert.Error(t, validateSnapshotPrefix("a/b", false))
+}
+
+func TestSnapshotPrefixTranslation(t *testing.T) {
+	snap := func(name string, guid uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: name, Guid: guid}
+	}
+
+	listed := []*pdu.FilesystemVersion{
+		snap("clientA_zrepl_1", 1),
+		snap("manual", 2),
+		snap("clientA_", 3),
+		{Type: pdu.FilesystemVersion_Bookmark, Name: "clientA_book", Guid: 4},
+	}
+	versionsToPresented("clientA_", listed)
+	names := make([]string, len(listed))
+	for i := range listed {
+		names[i] = listed[i].Name
+	}
+	assert.Equal(t, []string{"zrepl_1", "manual", "clientA_", "clientA_book"}, names)
+
+	local := []zfs.FilesystemVersion{
+		{Type: zfs.Snapshot, Name: "clientA_zrepl_1", Guid: 1},
+		{Type: zfs.Snapshot, Name: "manual", Guid: 2},
+	}
+	presented := []*pdu.FilesystemVersion{snap("zrepl_1", 1), snap("manual", 2), snap("zrepl_5", 5)}
+	mapped := versionsToLocal("clientA_", presented, local)
+	require.Len(t, mapped, 3)
+	assert.Equal(t, "clientA_zrepl_1", mapped[0].Name)
+	assert.Equal(t, "manual", mapped[1].Name)
+	assert.Equal(t, "clientA_zrepl_5", mapped[2].Name) // not present locally, use prefixed name
+	assert.Equal(t, "zrepl_1", presented[0].Name, "input must not be modified")
+}
@@ -0,0 +1,88 @@
+package endpoint
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// DestroyFilesystem destroys a tombstone (see pdu.TombstoneName), i.e., a received filesystem
+// that the client renamed after its sender filesystem was destroyed, along with its children.
+// It is only permitted if ReceiverConfig.AllowDestroyTombstones is set and ReceiverConfig.AppendOnly is not,
+// and refuses filesystems that RenameFilesystem did not rename to a tombstone (see zfs.TombstonePropertyName).
+//
+// The last-received-holds of all jobs on the tombstone's snapshots are released before, other holds make it fail.
+func (s *Receiver) DestroyFilesystem(ctx context.Context, req *pdu.DestroyFilesystemReq) (*pdu.DestroyFilesystemRes, error) {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+
+	if s.conf.AppendOnly {
+		return nil, errors.New("receiver is append-only (recv.append_only), destroying filesystems is not permitted")
+	}
+	if !s.conf.AllowDestroyTombstones {
+		return nil, errors.New("receiver does not permit destroying tombstones (recv.allow_destroy_tombstones)")
+	}
+	if _, _, ok := pdu.ParseTombstoneName(req.GetFilesystem()); !ok {
+		return nil, errors.Errorf("filesystem %q is not a tombstone", req.GetFilesystem())
+	}
+
+	root := s.clientRootFromCtx(ctx)
+	lp, err := subroot{root}.MapToLocal(req.GetFilesystem())
+	if err != nil {
+		return nil, errors.Wrap(err, "`Filesystem` invalid")
+	}
+	isTombstone, err := zfs.ZFSIsTombstone(ctx, lp)
+	if _, ok := err.(*zfs.DatasetDoesNotExist); ok {
+		return nil, errors.Errorf("filesystem %q does not exist", req.GetFilesystem())
+	} else if err != nil {
+		return nil, errors.Wrap(err, "cannot get tombstone state")
+	}
+	if !isTombstone {
+		return nil, errors.Errorf("filesystem %q was not renamed to a tombstone by zrepl", req.GetFilesystem())
+	}
+
+	log := getLogger(ctx).WithField("fs", lp.ToString())
+
+	holds, listErrs, err := ListAbstractions(ctx, ListZFSHoldsAndBookmarksQuery{
+		FS:          ListZFSHoldsAndBookmarksQueryFilesystemFilter{Filter: datasetSubtree{lp}},
+		What:        AbstractionTypeSet{AbstractionLastReceivedHold: true},
+		Concurrency: 1,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot list last-received-holds")
+	}
+	if len(listErrs) > 0 {
+		return nil, errors.Wrap(listErrs[0], "cannot list last-received-holds")
+	}
+	var releaseErr error
+	for res := range BatchDestroy(ctx, holds) {
+		if res.DestroyErr != nil && releaseErr == nil {
+			releaseErr = errors.Wrapf(res.DestroyErr, "cannot release %s", res.Abstraction)
+		}
+	}
+	abstractionsCacheSingleton.InvalidateFSCache(lp.ToString())
+	if releaseErr != nil {
+		return nil, releaseErr
+	}
+
+	log.Warn("destroying tombstone filesystem")
+	if err := zfs.ZFSDestroyFilesystemRecursive(ctx, lp); err != nil {
+		log.WithError(err).Error("cannot destroy tombstone filesystem")
+		return nil, err
+	}
+	return &pdu.DestroyFilesystemRes{}, nil
+}
+
+// datasetSubtree passes root and its descendants
+type datasetSubtree struct {
+	root *zfs.DatasetPath
+}
+
+var _ zfs.DatasetFilter = datasetSubtree{}
+
+func (f datasetSubtree) Filter(p *zfs.DatasetPath) (pass bool, err error) {
+	return p.HasPrefix(f.root), nil
+}
@@ -0,0 +1,99 @@
+package endpoint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// FilesystemVersionFilter restricts the snapshots and bookmarks that an endpoint presents
+// to the other side, the planner and the pruner (ListFilesystemVersions) and operates on
+// (Send, Receive, DestroySnapshots, Rollback) to those whose name has one of the Prefixes
+// or matches one of the Regexes.
+// The other versions are ignored entirely, i.e., they are neither replicated nor pruned.
+//
+// zrepl's replication cursor bookmarks always match.
+//
+// A nil *FilesystemVersionFilter matches all versions.
+type FilesystemVersionFilter struct {
+	prefixes []string
+	regexes  []*regexp.Regexp
+}
+
+func NewFilesystemVersionFilter(prefixes, regexes []string) (*FilesystemVersionFilter, error) {
+	if len(prefixes) == 0 && len(regexes) == 0 {
+		return nil, errors.New("at least one prefix or regex is required")
+	}
+	f := &FilesystemVersionFilter{}
+	for _, p := range prefixes {
+		if p == "" {
+			return nil, errors.New("prefix must not be empty")
+		}
+		f.prefixes = append(f.prefixes, p)
+	}
+	for _, r := range regexes {
+		re, err := regexp.Compile(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid regex %q", r)
+		}
+		f.regexes = append(f.regexes, re)
+	}
+	return f, nil
+}
+
+// Matches reports whether the version of fs with the given type and name (without @ or #) passes the filter.
+func (f *FilesystemVersionFilter) Matches(fs string, typ zfs.VersionType, name string) bool {
+	if f == nil {
+		return true
+	}
+	if typ == zfs.Bookmark && isReplicationCursorBookmark(fs, name) {
+		return true
+	}
+	for _, p := range f.prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	for _, re := range f.regexes {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func isReplicationCursorBookmark(fs, name string) bool {
+	fullname := fmt.Sprintf("%s#%s", fs, name)
+	if _, _, err := ParseReplicationCursorBookmarkName(fullname); err == nil || err == ErrV1ReplicationCursor {
+		return true
+	}
+	_, _, err := ParseTentativeReplicationCursorBookmarkName(fullname)
+	return err == nil
+}
+
+func (f *FilesystemVersionFilter) filter(fs string, in []*pdu.FilesystemVersion) []*pdu.FilesystemVersion {
+	if f == nil {
+		return in
+	}
+	out := make([]*pdu.FilesystemVersion, 0, len(in))
+	for _, v := range in {
+		if f.Matches(fs, v.GetType().ZFSVersionType(), v.GetName()) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// check returns an error if v is not nil and does not pass the filter.
+func (f *FilesystemVersionFilter) check(fs string, v *pdu.FilesystemVersion) error {
+	if v == nil || f.Matches(fs, v.GetType().ZFSVersionType(), v.GetName()) {
+		return nil
+	}
+	typ := v.GetType().ZFSVersionType()
+	return errors.Errorf("version %q of filesystem %q is excluded by the endpoint's version filter", typ.DelimiterChar()+v.GetName(), fs)
+}
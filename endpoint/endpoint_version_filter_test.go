@@ -0,0 +1,64 @@
+package endpoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestFilesystemVersionFilter(t *testing.T) {
+	_, err := NewFilesystemVersionFilter(nil, nil)
+	assert.Error(t, err)
+	_, err = NewFilesystemVersionFilter([]string{""}, nil)
+	assert.Error(t, err)
+	_, err = NewFilesystemVersionFilter(nil, []string{"("})
+	assert.Error(t, err)
+
+	f, err := NewFilesystemVersionFilter([]string{"zrepl_", "auto-"}, []string{`^daily_\d+$`})
+	require.NoError(t, err)
+
+	assert.True(t, f.Matches("pool/fs", zfs.Snapshot, "zrepl_20200101_000000_000"))
+	assert.True(t, f.Matches("pool/fs", zfs.Snapshot, "auto-2020-01-01"))
+	assert.True(t, f.Matches("pool/fs", zfs.Bookmark, "auto-2020-01-01"))
+	assert.True(t, f.Matches("pool/fs", zfs.Snapshot, "daily_7"))
+	assert.False(t, f.Matches("pool/fs", zfs.Snapshot, "daily_7_manual"))
+	assert.False(t, f.Matches("pool/fs", zfs.Snapshot, "manual"))
+	assert.False(t, f.Matches("pool/fs", zfs.Bookmark, "manual"))
+
+	// zrepl's own bookmarks are never filtered
+	jobID, err := MakeJobID("push")
+	require.NoError(t, err)
+	cursor, err := ReplicationCursorBookmarkName("pool/fs", 0x1234, jobID)
+	require.NoError(t, err)
+	tentative, err := TentativeReplicationCursorBookmarkName("pool/fs", 0x1234, jobID)
+	require.NoError(t, err)
+	auto, err := NewFilesystemVersionFilter([]string{"auto-"}, nil)
+	require.NoError(t, err)
+	for _, name := range []string{cursor, tentative} {
+		assert.True(t, auto.Matches("pool/fs", zfs.Bookmark, name), "%s", name)
+		assert.False(t, auto.Matches("pool/fs", zfs.Snapshot, name), "%s", name)
+	}
+
+	var none *FilesystemVersionFilter
+	assert.True(t, none.Matches("pool/fs", zfs.Snapshot, "manual"))
+}
+
+func TestFilesystemVersionFilterPDU(t *testing.T) {
+	f, err := NewFilesystemVersionFilter([]string{"zrepl_"}, nil)
+	require.NoError(t, err)
+	zrepl := &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: "zrepl_1"}
+	foreign := &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: "manual"}
+
+	assert.Equal(t, []*pdu.FilesystemVersion{zrepl}, f.filter("pool/fs", []*pdu.FilesystemVersion{foreign, zrepl}))
+	assert.NoError(t, f.check("pool/fs", zrepl))
+	assert.NoError(t, f.check("pool/fs", nil))
+	assert.Error(t, f.check("pool/fs", foreign))
+
+	var none *FilesystemVersionFilter
+	assert.Len(t, none.filter("pool/fs", []*pdu.FilesystemVersion{foreign, zrepl}), 2)
+	assert.NoError(t, none.check("pool/fs", foreign))
+}
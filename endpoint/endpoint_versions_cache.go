@@ -0,0 +1,102 @@
+package endpoint
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zrepl/zrepl/util/envconst"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+var versionsCacheMaxAge = envconst.Duration("ZREPL_ENDPOINT_BULK_LIST_VERSIONS_MAX_AGE", 1*time.Minute)
+
+// versionsCache serves ListFilesystemVersions from a single recursive `zfs list` per root
+// instead of one `zfs list` per filesystem.
+//
+// The cache is armed by ListFilesystems, which starts every planning attempt,
+// and filled by the first lookup after that.
+// Each filesystem's entry is served at most once: later lookups of the same filesystem,
+// e.g., to verify a step, list it individually and thereby observe the effects of the replication.
+// The same applies to filesystems that are not below any of the roots and to lookups
+// after versionsCacheMaxAge has passed since the cache was filled.
+type versionsCache struct {
+	mtx      sync.Mutex
+	roots    []*zfs.DatasetPath // nil if not armed
+	filledAt time.Time
+	byFS     map[string][]zfs.FilesystemVersion // nil if not filled
+}
+
+func (c *versionsCache) arm(roots []*zfs.DatasetPath) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.roots = roots
+	c.byFS = nil
+}
+
+func (c *versionsCache) disarm() {
+	c.roots = nil
+	c.byFS = nil
+}
+
+func (c *versionsCache) list(ctx context.Context, fs *zfs.DatasetPath) ([]zfs.FilesystemVersion, error) {
+	if fsvs, ok := c.lookup(ctx, fs); ok {
+		return fsvs, nil
+	}
+	return zfs.ZFSListFilesystemVersions(ctx, fs, zfs.ListFilesystemVersionsOptions{})
+}
+
+func (c *versionsCache) lookup(ctx context.Context, fs *zfs.DatasetPath) ([]zfs.FilesystemVersion, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.roots == nil {
+		return nil, false
+	}
+	if c.byFS != nil && time.Since(c.filledAt) > versionsCacheMaxAge {
+		c.disarm()
+		return nil, false
+	}
+	if c.byFS == nil {
+		byFS := make(map[string][]zfs.FilesystemVersion)
+		for _, root := range c.roots {
+			rootFSVs, err := zfs.ZFSListFilesystemVersionsRecursive(ctx, root, zfs.ListFilesystemVersionsOptions{})
+			if err != nil {
+				getLogger(ctx).WithError(err).WithField("root", root.ToString()).
+					Warn("cannot list versions in bulk, falling back to listing per filesystem")
+				c.disarm()
+				return nil, false
+			}
+			for fs, fsvs := range rootFSVs {
+				byFS[fs] = fsvs
+			}
+		}
+		c.byFS, c.filledAt = byFS, time.Now()
+	}
+	fsvs, ok := c.byFS[fs.ToString()]
+	if ok {
+		delete(c.byFS, fs.ToString())
+	}
+	return fsvs, ok
+}
+
+// bulkListRoots returns the pools of fss, which are the roots of the versionsCache of a Sender.
+func bulkListRoots(fss []*zfs.DatasetPath) ([]*zfs.DatasetPath, error) {
+	seen := make(map[string]bool)
+	var roots []*zfs.DatasetPath
+	for _, fs := range fss {
+		pool, err := fs.Pool()
+		if err != nil {
+			return nil, err
+		}
+		if seen[pool] {
+			continue
+		}
+		seen[pool] = true
+		root, err := zfs.NewDatasetPath(pool)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
@@ -0,0 +1,62 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestVersionsCacheServesOnce(t *testing.T) {
+	ctx := context.Background()
+	fs, err := zfs.NewDatasetPath("pool/a")
+	require.NoError(t, err)
+	other, err := zfs.NewDatasetPath("pool/b")
+	require.NoError(t, err)
+
+	// pretend that the bulk listing has already happened
+	c := &versionsCache{}
+	c.arm([]*zfs.DatasetPath{fs})
+	c.byFS = map[string][]zfs.FilesystemVersion{"pool/a": {{Type: zfs.Snapshot, Name: "s1"}}}
+	c.filledAt = time.Now()
+
+	_, ok := c.lookup(ctx, other)
+	assert.False(t, ok, "filesystems that were not listed must be listed individually")
+
+	fsvs, ok := c.lookup(ctx, fs)
+	require.True(t, ok)
+	assert.Len(t, fsvs, 1)
+
+	_, ok = c.lookup(ctx, fs)
+	assert.False(t, ok, "entries must only be served once")
+
+	c.byFS = map[string][]zfs.FilesystemVersion{"pool/a": {}}
+	c.filledAt = time.Now().Add(-versionsCacheMaxAge - time.Second)
+	_, ok = c.lookup(ctx, fs)
+	assert.False(t, ok, "expired cache must not be used")
+	assert.Nil(t, c.roots, "expired cache must be disarmed")
+}
+
+func TestBulkListRoots(t *testing.T) {
+	var fss []*zfs.DatasetPath
+	for _, p := range []string{"pool/a", "pool/a/b", "tank/c", "pool/d"} {
+		fs, err := zfs.NewDatasetPath(p)
+		require.NoError(t, err)
+		fss = append(fss, fs)
+	}
+	roots, err := bulkListRoots(fss)
+	require.NoError(t, err)
+	var names []string
+	for _, r := range roots {
+		names = append(names, r.ToString())
+	}
+	assert.Equal(t, []string{"pool", "tank"}, names)
+
+	roots, err = bulkListRoots(nil)
+	require.NoError(t, err)
+	assert.Nil(t, roots)
+}
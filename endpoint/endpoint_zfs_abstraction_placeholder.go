@@ -0,0 +1,49 @@
+package endpoint
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// Placeholder filesystems are created by the receiver for the missing parents of received filesystems.
+// Unlike the other abstractions, they are not associated with a job and not tied to a filesystem version,
+// which is why they are not an AbstractionType.
+
+// ListPlaceholders returns the placeholder state of those filesystems matched by f that are placeholders.
+func ListPlaceholders(ctx context.Context, f ListZFSHoldsAndBookmarksQueryFilesystemFilter) ([]*zfs.FilesystemPlaceholderState, error) {
+	if err := f.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid filesystem filter")
+	}
+	fss, err := f.Filesystems(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "list filesystems")
+	}
+	var placeholders []*zfs.FilesystemPlaceholderState
+	for _, fs := range fss {
+		dp, err := zfs.NewDatasetPath(fs)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid filesystem name %q", fs)
+		}
+		st, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, dp)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get placeholder state of %q", fs)
+		}
+		if st.FSExists && st.IsPlaceholder {
+			placeholders = append(placeholders, st)
+		}
+	}
+	return placeholders, nil
+}
+
+// ReleasePlaceholder turns the placeholder filesystem fs into a regular filesystem.
+// The filesystem and its children are not modified otherwise.
+func ReleasePlaceholder(ctx context.Context, fs string) error {
+	dp, err := zfs.NewDatasetPath(fs)
+	if err != nil {
+		return errors.Wrapf(err, "invalid filesystem name %q", fs)
+	}
+	return zfs.ZFSSetPlaceholder(ctx, dp, false)
+}
@@ -13,11 +13,16 @@ func init() {
 	cli.AddSubcommand(client.SignalCmd)
 	cli.AddSubcommand(client.StdinserverCmd)
 	cli.AddSubcommand(client.ConfigcheckCmd)
+	cli.AddSubcommand(client.ConfigCmd)
 	cli.AddSubcommand(client.VersionCmd)
 	cli.AddSubcommand(client.PprofCmd)
 	cli.AddSubcommand(client.TestCmd)
 	cli.AddSubcommand(client.MigrateCmd)
 	cli.AddSubcommand(client.ZFSAbstractionsCmd)
+	cli.AddSubcommand(client.RestoreCmd)
+	cli.AddSubcommand(client.ImportCmd)
+	cli.AddSubcommand(client.HistoryCmd)
+	cli.AddSubcommand(client.MonitorCmd)
 }
 
 func main() {
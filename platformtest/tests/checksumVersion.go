@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/platformtest"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func ChecksumVersionDifferentDatasetNames(ctx *platformtest.Context) {
+
+	platformtest.Run(ctx, platformtest.PanicErr, ctx.RootDataset, `
+		DESTROYROOT
+		CREATEROOT
+		+  "sender"
+		+  "receiver"
+	`)
+
+	sfs := fmt.Sprintf("%s/sender", ctx.RootDataset)
+	rfs := fmt.Sprintf("%s/receiver/mapped fs", ctx.RootDataset)
+
+	sfsMount, err := zfs.ZFSGetMountpoint(ctx, sfs)
+	require.NoError(ctx, err)
+	require.True(ctx, sfsMount.Mounted)
+	writeDummyData(path.Join(sfsMount.Mountpoint, "dummy_data"), 1<<20)
+	mustSnapshot(ctx, sfs+"@1")
+	sfsSnap1 := sendArgVersion(ctx, sfs, "@1")
+
+	sendArgs, err := zfs.ZFSSendArgsUnvalidated{
+		FS:        sfs,
+		Encrypted: &zfs.NilBool{B: false},
+		From:      nil,
+		To:        &sfsSnap1,
+	}.Validate(ctx)
+	require.NoError(ctx, err)
+	sendStream, err := zfs.ZFSSend(ctx, sendArgs)
+	require.NoError(ctx, err)
+	err = zfs.ZFSRecv(ctx, rfs, &zfs.ZFSSendArgVersion{RelName: "@1", GUID: sfsSnap1.GUID}, sendStream, zfs.RecvOptions{})
+	require.NoError(ctx, err)
+
+	for _, method := range []zfs.ChecksumMethod{zfs.ChecksumMethodStreamSize, zfs.ChecksumMethodStreamSHA256} {
+		sum, err := zfs.ZFSChecksumVersion(ctx, sfs, fsversion(ctx, sfs, "@1"), method)
+		require.NoError(ctx, err)
+		rsum, err := zfs.ZFSChecksumVersion(ctx, rfs, fsversion(ctx, rfs, "@1"), method)
+		require.NoError(ctx, err)
+		assert.Equal(ctx, sum, rsum, "method %s", method)
+	}
+}
@@ -3,6 +3,7 @@
 package tests
 
 var Cases = []Case{BatchDestroy,
+	ChecksumVersionDifferentDatasetNames,
 	CreateReplicationCursor,
 	GetNonexistent,
 	HoldsWork,
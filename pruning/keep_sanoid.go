@@ -0,0 +1,81 @@
+package pruning
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+// KeepSanoid emulates sanoid's retention counts, e.g., hourly=36 daily=30,
+// for users migrating from sanoid.
+//
+// Each non-zero count compiles down to a KeepGrid with one bucket per period,
+// e.g., hourly=36 becomes the grid 36x1h. Like in sanoid, the periods overlap,
+// i.e., all of them start at the youngest snapshot that matches the regex,
+// and a snapshot is kept if any of the grids keeps it.
+type KeepSanoid struct {
+	grids []KeepRule
+}
+
+var sanoidPeriods = []struct {
+	name     string
+	duration string // in the syntax of config.ParseRetentionIntervalSpec
+	count    func(*config.PruneKeepSanoid) int
+}{
+	{"hourly", "1h", func(c *config.PruneKeepSanoid) int { return c.Hourly }},
+	{"daily", "1d", func(c *config.PruneKeepSanoid) int { return c.Daily }},
+	{"weekly", "1w", func(c *config.PruneKeepSanoid) int { return c.Weekly }},
+	{"monthly", "30d", func(c *config.PruneKeepSanoid) int { return c.Monthly }},
+	{"yearly", "365d", func(c *config.PruneKeepSanoid) int { return c.Yearly }},
+}
+
+func NewKeepSanoid(in *config.PruneKeepSanoid) (*KeepSanoid, error) {
+	if in.Regex == "" {
+		return nil, fmt.Errorf("Regex must not be empty")
+	}
+	re, err := regexp.Compile(in.Regex)
+	if err != nil {
+		return nil, errors.Wrap(err, "Regex is invalid")
+	}
+
+	k := &KeepSanoid{}
+	for _, p := range sanoidPeriods {
+		count := p.count(in)
+		if count < 0 {
+			return nil, errors.Errorf("%s count must not be negative, got %d", p.name, count)
+		}
+		if count == 0 {
+			continue
+		}
+		intervals, err := config.ParseRetentionIntervalSpec(fmt.Sprintf("%dx%s", count, p.duration))
+		if err != nil {
+			panic(fmt.Sprintf("implementation error: cannot build grid for %s count %d: %s", p.name, count, err))
+		}
+		grid, err := newKeepGrid(re, intervals)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot build grid for %s count", p.name)
+		}
+		k.grids = append(k.grids, grid)
+	}
+	if len(k.grids) == 0 {
+		return nil, errors.New("at least one of hourly, daily, weekly, monthly, yearly must be positive")
+	}
+	return k, nil
+}
+
+func (k *KeepSanoid) KeepRule(snaps []Snapshot) (destroyList []Snapshot) {
+	destroy := make(map[Snapshot]bool, len(snaps))
+	for _, s := range PruneSnapshots(snaps, k.grids) {
+		destroy[s] = true
+	}
+	// preserve the order of snaps
+	for _, s := range snaps {
+		if destroy[s] {
+			destroyList = append(destroyList, s)
+		}
+	}
+	return destroyList
+}
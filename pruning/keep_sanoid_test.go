@@ -0,0 +1,74 @@
+package pruning
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func TestKeepSanoid(t *testing.T) {
+
+	o := func(hours int) time.Time {
+		return time.Unix(123, 0).Add(time.Duration(hours) * time.Hour)
+	}
+
+	// hourly snapshots for three days, the youngest is zrepl_71
+	var hourly []Snapshot
+	for h := 0; h < 72; h++ {
+		hourly = append(hourly, stubSnap{name: fmt.Sprintf("zrepl_%02d", h), date: o(h)})
+	}
+	hourly = append(hourly, stubSnap{name: "manual_1", date: o(30)})
+
+	destroyAllExcept := func(keep ...string) map[string]bool {
+		m := make(map[string]bool)
+		for _, s := range hourly {
+			m[s.Name()] = true
+		}
+		for _, k := range keep {
+			delete(m, k)
+		}
+		return m
+	}
+
+	mustKeepSanoid := func(c config.PruneKeepSanoid) *KeepSanoid {
+		k, err := NewKeepSanoid(&c)
+		if err != nil {
+			panic(err)
+		}
+		return k
+	}
+
+	tcs := map[string]testCase{
+		"hourly": {
+			inputs:     hourly,
+			rules:      []KeepRule{mustKeepSanoid(config.PruneKeepSanoid{Regex: "^zrepl_", Hourly: 3})},
+			expDestroy: destroyAllExcept("zrepl_71", "zrepl_70", "zrepl_69"),
+		},
+		"periodsOverlap": {
+			// the daily buckets (47h,71h] and (23h,47h] keep their oldest snapshot
+			inputs:     hourly,
+			rules:      []KeepRule{mustKeepSanoid(config.PruneKeepSanoid{Regex: "^zrepl_", Hourly: 3, Daily: 2})},
+			expDestroy: destroyAllExcept("zrepl_71", "zrepl_70", "zrepl_69", "zrepl_48", "zrepl_24"),
+		},
+		"emptyInput": {
+			inputs:     []Snapshot{},
+			rules:      []KeepRule{mustKeepSanoid(config.PruneKeepSanoid{Regex: "^zrepl_", Yearly: 1})},
+			expDestroy: map[string]bool{},
+		},
+	}
+
+	testTable(tcs, t)
+}
+
+func TestNewKeepSanoidErrors(t *testing.T) {
+	_, err := NewKeepSanoid(&config.PruneKeepSanoid{Regex: "^zrepl_"})
+	assert.Error(t, err, "all counts zero")
+	_, err = NewKeepSanoid(&config.PruneKeepSanoid{Hourly: 1})
+	assert.Error(t, err, "empty regex")
+	_, err = NewKeepSanoid(&config.PruneKeepSanoid{Regex: "(", Hourly: 1})
+	assert.Error(t, err, "invalid regex")
+}
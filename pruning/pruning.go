@@ -65,6 +65,8 @@ func RuleFromConfig(in config.PruningEnum) (KeepRule, error) {
 		return NewKeepRegex(v.Regex, v.Negate)
 	case *config.PruneGrid:
 		return NewKeepGrid(v)
+	case *config.PruneKeepSanoid:
+		return NewKeepSanoid(v)
 	default:
 		return nil, fmt.Errorf("unknown keep rule type %T", v)
 	}
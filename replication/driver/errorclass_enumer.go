@@ -7,9 +7,9 @@ import (
 	"fmt"
 )
 
-const _errorClassName = "errorClassPermanenterrorClassTemporaryConnectivityRelated"
+const _errorClassName = "errorClassPermanenterrorClassTemporaryConnectivityRelatederrorClassTemporaryServerBusy"
 
-var _errorClassIndex = [...]uint8{0, 19, 57}
+var _errorClassIndex = [...]uint8{0, 19, 57, 86}
 
 func (i errorClass) String() string {
 	if i < 0 || i >= errorClass(len(_errorClassIndex)-1) {
@@ -18,11 +18,12 @@ func (i errorClass) String() string {
 	return _errorClassName[_errorClassIndex[i]:_errorClassIndex[i+1]]
 }
 
-var _errorClassValues = []errorClass{0, 1}
+var _errorClassValues = []errorClass{0, 1, 2}
 
 var _errorClassNameToValueMap = map[string]errorClass{
 	_errorClassName[0:19]:  0,
 	_errorClassName[19:57]: 1,
+	_errorClassName[57:86]: 2,
 }
 
 // errorClassString retrieves an enum value from the enum constants string name.
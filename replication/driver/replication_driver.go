@@ -3,6 +3,7 @@ package driver
 import (
 	"context"
 	"fmt"
+	"math"
 	"net"
 	"sort"
 	"strings"
@@ -70,6 +71,8 @@ type run struct {
 	waitReconnect      interval
 	waitReconnectError *timedError
 
+	waitServerBusy interval
+
 	// the attempts attempted so far:
 	// All but the last in this slice must have finished with some errors.
 	// The last attempt may not be finished and may not have errors.
@@ -81,6 +84,14 @@ type Planner interface {
 	WaitForConnectivity(context.Context) error
 }
 
+// A Planner that implements OrphanReportingPlanner is asked for the receiver filesystems
+// that have no corresponding sender filesystem after each successful call to Plan.
+type OrphanReportingPlanner interface {
+	Planner
+	// Returns the orphaned filesystems found by the most recent call to Plan.
+	OrphanedFilesystems() []*report.OrphanedFilesystemReport
+}
+
 // an attempt represents a single planning & execution of fs replications
 type attempt struct {
 	planner Planner
@@ -93,6 +104,7 @@ type attempt struct {
 	// if both are nil, it must be assumed that Planner.Plan is active
 	planErr *timedError
 	fss     []*fs
+	orphans []*report.OrphanedFilesystemReport // see OrphanReportingPlanner
 }
 
 type timedError struct {
@@ -117,6 +129,13 @@ func (e *timedError) IntoReportError() *report.TimedError {
 	return report.NewTimedError(e.Err.Error(), e.Time)
 }
 
+// skipFSError is implemented by errors of FS.PlanFS that do not indicate a failure
+// but that the filesystem shall not be replicated in this attempt, e.g., because it awaits confirmation.
+// Such filesystems are reported in state report.FilesystemSkipped and do not cause a retry of the attempt.
+type skipFSError interface {
+	SkipFS() bool
+}
+
 type FS interface {
 	// Returns true if this FS and fs refer to the same filesystem returned
 	// by Planner.Plan in a previous attempt.
@@ -127,6 +146,33 @@ type FS interface {
 	ReportInfo() *report.FilesystemInfo
 }
 
+// An FS that implements VerifiableFS is asked to verify the replication
+// result after all of its planned steps have completed successfully.
+type VerifiableFS interface {
+	FS
+	// steps are the steps that were executed in this attempt.
+	// Returns nil, nil if verification is disabled for this FS.
+	// A non-nil error fails the filesystem's replication.
+	Verify(ctx context.Context, steps []Step) (*report.FilesystemVerificationReport, error)
+}
+
+// An FS that implements WeightedFS is replicated before FSs with a lower weight.
+// FSs that do not implement WeightedFS have weight 1.
+type WeightedFS interface {
+	FS
+	Weight() int
+}
+
+// An FS that implements OrderedFS determines the order of its steps relative to the steps of other FSs
+// with the same weight: the steps of the FS with the smaller OrderKey are started first.
+// The steps of FSs with the same OrderKey are ordered by their TargetDate.
+// FSs that do not implement OrderedFS have OrderKey 0.
+type OrderedFS interface {
+	FS
+	// Only called after PlanFS has returned.
+	OrderKey() int64
+}
+
 type Step interface {
 	// Returns true iff the target snapshot is the same for this Step and other.
 	// We do not use TargetDate to avoid problems with wrong system time on
@@ -159,6 +205,9 @@ type fs struct {
 	planning struct {
 		done bool
 		err  *timedError
+		// if != "", PlanFS skipped the filesystem (see skipFSError) and the field contains the reason,
+		// planning.done is true and there are no planned steps
+		skipped string
 	}
 
 	// valid iff planning.done && planning.err == nil
@@ -171,6 +220,12 @@ type fs struct {
 		// if step >= len(steps), no more work needs to be done
 		step int
 	}
+
+	// valid iff all planned steps completed successfully
+	verification struct {
+		err    *timedError
+		report *report.FilesystemVerificationReport
+	}
 }
 
 type step struct {
@@ -183,6 +238,8 @@ type WaitFunc func(block bool) (done bool)
 
 var maxAttempts = envconst.Int64("ZREPL_REPLICATION_MAX_ATTEMPTS", 3)
 var reconnectHardFailTimeout = envconst.Duration("ZREPL_REPLICATION_RECONNECT_HARD_FAIL_TIMEOUT", 10*time.Minute)
+var serverBusyRetryInterval = envconst.Duration("ZREPL_REPLICATION_SERVER_BUSY_RETRY_INTERVAL", 30*time.Second)
+var serverBusyHardFailTimeout = envconst.Duration("ZREPL_REPLICATION_SERVER_BUSY_HARD_FAIL_TIMEOUT", 1*time.Hour)
 
 func Do(ctx context.Context, planner Planner) (ReportFunc, WaitFunc) {
 	log := getLog(ctx)
@@ -201,12 +258,16 @@ func Do(ctx context.Context, planner Planner) (ReportFunc, WaitFunc) {
 		defer log.Debug("run ended")
 		var prev *attempt
 		mainLog := log
-		for ano := 0; ano < int(maxAttempts) || maxAttempts == 0; ano++ {
+		// attempts that fail because the server is busy do not count towards maxAttempts
+		var busyAttempts int
+		var busySince time.Time
+		for ano := 0; ano-busyAttempts < int(maxAttempts) || maxAttempts == 0; ano++ {
 			log := mainLog.WithField("attempt_number", ano)
 			log.Debug("start attempt")
 
 			run.waitReconnect.SetZero()
 			run.waitReconnectError = nil
+			run.waitServerBusy.SetZero()
 
 			// do current attempt
 			cur := &attempt{
@@ -245,6 +306,33 @@ func Do(ctx context.Context, planner Planner) (ReportFunc, WaitFunc) {
 				break
 			}
 			log.WithError(mostRecentErr.Err).Error("most recent error in this attempt")
+			if mostRecentErrClass == errorClassTemporaryServerBusy {
+				if busySince.IsZero() {
+					busySince = time.Now()
+				}
+				if time.Since(busySince) > serverBusyHardFailTimeout {
+					log.WithField("busy_since", busySince).Error("server is still busy after hard-fail timeout, aborting run")
+					return
+				}
+				retryAfter := errRep.serverBusyRetryAfter()
+				if retryAfter == 0 {
+					retryAfter = serverBusyRetryInterval
+				}
+				run.waitServerBusy.Set(time.Now(), retryAfter)
+				log.WithField("retry_at", run.waitServerBusy.End()).Error("server is busy, retrying later")
+				run.l.DropWhile(func() {
+					ctx, cancel := run.waitServerBusy.ContextWithDeadlineAtEnd(ctx)
+					defer cancel()
+					<-ctx.Done()
+				})
+				if ctx.Err() != nil {
+					log.WithError(ctx.Err()).Info("context error")
+					return
+				}
+				busyAttempts++
+				continue
+			}
+			busySince = time.Time{}
 			shouldReconnect := mostRecentErrClass == errorClassTemporaryConnectivityRelated
 			log.WithField("reconnect_decision", shouldReconnect).Debug("reconnect decision made")
 			if shouldReconnect {
@@ -307,6 +395,10 @@ func (a *attempt) doGlobalPlanning(ctx context.Context, prev *attempt) map[*fs]*
 	defer endSpan()
 	pfss, err := a.planner.Plan(ctx)
 	errTime := time.Now()
+	var orphans []*report.OrphanedFilesystemReport
+	if op, ok := a.planner.(OrphanReportingPlanner); ok && err == nil {
+		orphans = op.OrphanedFilesystems()
+	}
 	defer a.l.Lock().Unlock()
 	if err != nil {
 		a.planErr = newTimedError(err, errTime)
@@ -314,6 +406,7 @@ func (a *attempt) doGlobalPlanning(ctx context.Context, prev *attempt) map[*fs]*
 		a.finishedAt = time.Now()
 		return nil
 	}
+	a.orphans = orphans
 
 	// a.fss != nil indicates that there was no planning error (see doc comment)
 	a.fss = make([]*fs, 0)
@@ -439,6 +532,20 @@ func (a *attempt) doFilesystems(ctx context.Context, prevs map[*fs]*fs) {
 	a.finishedAt = time.Now()
 }
 
+func (f *fs) weight() int {
+	if wfs, ok := f.fs.(WeightedFS); ok {
+		return wfs.Weight()
+	}
+	return 1
+}
+
+func (f *fs) orderKey() int64 {
+	if ofs, ok := f.fs.(OrderedFS); ok {
+		return ofs.OrderKey()
+	}
+	return 0
+}
+
 func (f *fs) debug(format string, args ...interface{}) {
 	debugPrefix("fs=%s", f.fs.ReportInfo().Name)(format, args...)
 }
@@ -471,12 +578,18 @@ func (f *fs) do(ctx context.Context, pq *stepQueue, prev *fs) {
 	var err error
 	f.l.DropWhile(func() {
 		// TODO hacky
-		// choose target time that is earlier than any snapshot, so fs planning is always prioritized
+		// choose target time that is earlier than any snapshot and the maximum weight, so fs planning is always prioritized
 		targetDate := time.Unix(0, 0)
-		defer pq.WaitReady(ctx, f, targetDate)()
+		defer pq.WaitReadyOrdered(ctx, f, math.MaxInt32, math.MinInt64, targetDate)()
 		psteps, err = f.fs.PlanFS(ctx) // no shadow
 		errTime = time.Now()           // no shadow
 	})
+	if skip, ok := errors.Cause(err).(skipFSError); ok && skip.SkipFS() {
+		f.debug("skipped: %s", err)
+		f.planning.skipped = err.Error()
+		f.planning.done = true
+		return
+	}
 	if err != nil {
 		f.planning.err = newTimedError(err, errTime)
 		return
@@ -554,11 +667,17 @@ func (f *fs) do(ctx context.Context, pq *stepQueue, prev *fs) {
 	}
 	f.debug("wait for parents %s", parents)
 	for {
-		var initialReplicatingParentsWithErrors []string
+		var initialReplicatingParentsWithErrors, skippedParents []string
 		allParentsPresentOnReceiver := true
 		f.l.DropWhile(func() {
 			for _, p := range f.initialRepOrd.parents {
 				p.l.HoldWhile(func() {
+					if p.planning.skipped != "" {
+						// only new filesystems are skipped, i.e., the parent is not present on the receiver
+						allParentsPresentOnReceiver = false
+						skippedParents = append(skippedParents, p.fs.ReportInfo().Name)
+						return
+					}
 					// (get the preconditions that allow us to inspect p.planned)
 					parentHasPlanningDone := p.planning.done && p.planning.err == nil
 					if !parentHasPlanningDone {
@@ -601,6 +720,13 @@ func (f *fs) do(ctx context.Context, pq *stepQueue, prev *fs) {
 			}
 		})
 
+		if len(skippedParents) > 0 {
+			f.planning.skipped = fmt.Sprintf("parent(s) skipped initial replication: %s", skippedParents)
+			f.planned.steps = nil
+			f.initialRepOrdWakeupChildren()
+			return
+		}
+
 		if len(initialReplicatingParentsWithErrors) > 0 {
 			f.planned.stepErr = newTimedError(fmt.Errorf("parent(s) failed during initial replication: %s", initialReplicatingParentsWithErrors), time.Now())
 			return
@@ -634,7 +760,7 @@ func (f *fs) do(ctx context.Context, pq *stepQueue, prev *fs) {
 		f.l.DropWhile(func() {
 			// wait for parallel replication
 			targetDate := s.step.TargetDate()
-			defer pq.WaitReady(ctx, f, targetDate)()
+			defer pq.WaitReadyOrdered(ctx, f, f.weight(), f.orderKey(), targetDate)()
 			// do the step
 			ctx, endSpan := trace.WithSpan(ctx, fmt.Sprintf("%#v", s.step.ReportInfo()))
 			defer endSpan()
@@ -650,17 +776,39 @@ func (f *fs) do(ctx context.Context, pq *stepQueue, prev *fs) {
 		f.initialRepOrdWakeupChildren()
 	}
 
+	if f.planned.stepErr != nil {
+		return
+	}
+	if vfs, ok := f.fs.(VerifiableFS); ok {
+		steps := make([]Step, len(f.planned.steps))
+		for i := range f.planned.steps {
+			steps[i] = f.planned.steps[i].step
+		}
+		var rep *report.FilesystemVerificationReport
+		f.l.DropWhile(func() {
+			ctx, endSpan := trace.WithSpan(ctx, "verify")
+			defer endSpan()
+			rep, err = vfs.Verify(ctx, steps) // no shadow
+			errTime = time.Now()              // no shadow
+		})
+		f.verification.report = rep
+		if err != nil {
+			f.verification.err = newTimedError(err, errTime)
+		}
+	}
+
 }
 
 // caller must hold lock l
 func (r *run) report() *report.Report {
 	report := &report.Report{
-		Attempts:           make([]*report.AttemptReport, len(r.attempts)),
-		StartAt:            r.startedAt,
-		FinishAt:           r.finishedAt,
-		WaitReconnectSince: r.waitReconnect.begin,
-		WaitReconnectUntil: r.waitReconnect.end,
-		WaitReconnectError: r.waitReconnectError.IntoReportError(),
+		Attempts:            make([]*report.AttemptReport, len(r.attempts)),
+		StartAt:             r.startedAt,
+		FinishAt:            r.finishedAt,
+		WaitReconnectSince:  r.waitReconnect.begin,
+		WaitReconnectUntil:  r.waitReconnect.end,
+		WaitReconnectError:  r.waitReconnectError.IntoReportError(),
+		WaitServerBusyUntil: r.waitServerBusy.end,
 	}
 	for i := range report.Attempts {
 		report.Attempts[i] = r.attempts[i].report()
@@ -677,6 +825,8 @@ func (a *attempt) report() *report.AttemptReport {
 		StartAt:     a.startedAt,
 		FinishAt:    a.finishedAt,
 		PlanError:   a.planErr.IntoReportError(),
+
+		OrphanedFilesystems: a.orphans,
 	}
 
 	for i := range r.Filesystems {
@@ -713,11 +863,15 @@ func (a *attempt) report() *report.AttemptReport {
 func (f *fs) report() *report.FilesystemReport {
 	state := report.FilesystemPlanningErrored
 	if f.planning.err == nil {
-		if f.planning.done {
+		if f.planning.skipped != "" {
+			state = report.FilesystemSkipped
+		} else if f.planning.done {
 			if f.planned.stepErr != nil {
 				state = report.FilesystemSteppingErrored
 			} else if f.planned.step < len(f.planned.steps) {
 				state = report.FilesystemStepping
+			} else if f.verification.err != nil {
+				state = report.FilesystemVerifyErrored
 			} else {
 				state = report.FilesystemDone
 			}
@@ -726,12 +880,15 @@ func (f *fs) report() *report.FilesystemReport {
 		}
 	}
 	r := &report.FilesystemReport{
-		Info:        f.fs.ReportInfo(),
-		State:       state,
-		PlanError:   f.planning.err.IntoReportError(),
-		StepError:   f.planned.stepErr.IntoReportError(),
-		Steps:       make([]*report.StepReport, len(f.planned.steps)),
-		CurrentStep: f.planned.step,
+		Info:         f.fs.ReportInfo(),
+		State:        state,
+		PlanError:    f.planning.err.IntoReportError(),
+		StepError:    f.planned.stepErr.IntoReportError(),
+		VerifyError:  f.verification.err.IntoReportError(),
+		SkipReason:   f.planning.skipped,
+		Steps:        make([]*report.StepReport, len(f.planned.steps)),
+		CurrentStep:  f.planned.step,
+		Verification: f.verification.report,
 	}
 	for i := range r.Steps {
 		r.Steps[i] = f.planned.steps[i].report()
@@ -753,8 +910,17 @@ type errorClass int
 const (
 	errorClassPermanent errorClass = iota
 	errorClassTemporaryConnectivityRelated
+	errorClassTemporaryServerBusy
 )
 
+// serverBusyError is implemented by errors of endpoints that reject a request
+// because they are at their connection limits, e.g., dataconn.ServerBusyError.
+type serverBusyError interface {
+	ServerBusy() bool
+	// RetryAfter returns the time after which the endpoint suggests to retry, or zero for no suggestion.
+	RetryAfter() time.Duration
+}
+
 type errorReport struct {
 	flattened []*timedError
 	// sorted DESCending by err time
@@ -772,6 +938,8 @@ func (a *attempt) errorReport() *errorReport {
 			r.flattened = append(r.flattened, fs.planning.err)
 		} else if fs.planning.done && fs.planned.stepErr != nil {
 			r.flattened = append(r.flattened, fs.planned.stepErr)
+		} else if fs.planning.done && fs.verification.err != nil {
+			r.flattened = append(r.flattened, fs.verification.err)
 		}
 	}
 
@@ -784,6 +952,10 @@ func (a *attempt) errorReport() *errorReport {
 			r.byClass[class] = errs
 		}
 		for _, err := range r.flattened {
+			if busyErr, ok := errors.Cause(err.Err).(serverBusyError); ok && busyErr.ServerBusy() {
+				putClass(err, errorClassTemporaryServerBusy)
+				continue
+			}
 			if neterr, ok := err.Err.(net.Error); ok && neterr.Temporary() {
 				putClass(err, errorClassTemporaryConnectivityRelated)
 				continue
@@ -816,6 +988,17 @@ func (r *errorReport) AnyError() *timedError {
 	return nil
 }
 
+// serverBusyRetryAfter returns the longest retry-after hint of the errors of class errorClassTemporaryServerBusy,
+// or zero if there are none.
+func (r *errorReport) serverBusyRetryAfter() (retryAfter time.Duration) {
+	for _, err := range r.byClass[errorClassTemporaryServerBusy] {
+		if d := errors.Cause(err.Err).(serverBusyError).RetryAfter(); d > retryAfter {
+			retryAfter = d
+		}
+	}
+	return retryAfter
+}
+
 func (r *errorReport) MostRecent() (err *timedError, errClass errorClass) {
 	for class, errs := range r.byClass {
 		// errs are sorted descendingly during construction
@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 
 	"github.com/zrepl/zrepl/daemon/logging/trace"
@@ -217,3 +218,86 @@ func TestReplication(t *testing.T) {
 	}
 
 }
+
+type mockServerBusyError struct{ retryAfter time.Duration }
+
+func (mockServerBusyError) Error() string               { return "server busy" }
+func (mockServerBusyError) ServerBusy() bool            { return true }
+func (e mockServerBusyError) RetryAfter() time.Duration { return e.retryAfter }
+
+func TestErrorReportClassifiesServerBusy(t *testing.T) {
+	a := &attempt{planErr: newTimedError(errors.Wrap(mockServerBusyError{}, "receive"), time.Now())}
+	err, class := a.errorReport().MostRecent()
+	require.NotNil(t, err)
+	assert.Equal(t, errorClassTemporaryServerBusy, class)
+	assert.Equal(t, time.Duration(0), a.errorReport().serverBusyRetryAfter())
+
+	for _, retryAfter := range []time.Duration{2 * time.Minute, time.Minute} {
+		f := &fs{}
+		f.planning.done = true
+		f.planning.err = newTimedError(mockServerBusyError{retryAfter}, time.Now())
+		a.fss = append(a.fss, f)
+	}
+	assert.Equal(t, 2*time.Minute, a.errorReport().serverBusyRetryAfter())
+}
+
+type mockSkipFSError struct{}
+
+func (mockSkipFSError) Error() string { return "awaits confirmation" }
+func (mockSkipFSError) SkipFS() bool  { return true }
+
+type skipTestPlanner struct{ fss []FS }
+
+func (p *skipTestPlanner) Plan(ctx context.Context) ([]FS, error)    { return p.fss, nil }
+func (p *skipTestPlanner) WaitForConnectivity(context.Context) error { return nil }
+
+type skipTestFS struct {
+	name string
+	skip bool
+}
+
+func (f *skipTestFS) EqualToPreviousAttempt(other FS) bool { return f.name == other.(*skipTestFS).name }
+func (f *skipTestFS) ReportInfo() *report.FilesystemInfo {
+	return &report.FilesystemInfo{Name: f.name, IsNew: true}
+}
+func (f *skipTestFS) PlanFS(ctx context.Context) ([]Step, error) {
+	if f.skip {
+		return nil, errors.Wrap(mockSkipFSError{}, "planning")
+	}
+	var counter uint32
+	return []Step{&mockStep{fs: &mockFS{globalStepCounter: &counter, name: f.name}, ident: "a", targetDate: time.Unix(1, 0)}}, nil
+}
+
+func TestSkippedFilesystemIsNotAnError(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	getReport, wait := Do(ctx, &skipTestPlanner{fss: []FS{
+		&skipTestFS{name: "zroot/new", skip: true},
+		&skipTestFS{name: "zroot/new/child"},
+		&skipTestFS{name: "zroot/other"},
+	}})
+	wait(true)
+
+	r := getReport()
+	require.Len(t, r.Attempts, 1, "skipped filesystems must not cause a retry")
+	a := r.Attempts[0]
+	assert.Equal(t, report.AttemptDone, a.State)
+	states := make(map[string]report.FilesystemState)
+	for _, fs := range a.Filesystems {
+		states[fs.Info.Name] = fs.State
+		assert.Nil(t, fs.Error(), fs.Info.Name)
+		switch fs.Info.Name {
+		case "zroot/new":
+			assert.Equal(t, "planning: awaits confirmation", fs.SkipReason)
+		case "zroot/new/child":
+			assert.Equal(t, "parent(s) skipped initial replication: [zroot/new]", fs.SkipReason)
+			assert.Empty(t, fs.Steps)
+		}
+	}
+	assert.Equal(t, map[string]report.FilesystemState{
+		"zroot/new":       report.FilesystemSkipped,
+		"zroot/new/child": report.FilesystemSkipped,
+		"zroot/other":     report.FilesystemDone,
+	}, states)
+}
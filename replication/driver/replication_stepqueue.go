@@ -11,6 +11,8 @@ import (
 
 type stepQueueRec struct {
 	ident      interface{}
+	weight     int
+	orderKey   int64
 	targetDate time.Time
 	wakeup     chan StepCompletedFunc
 }
@@ -27,6 +29,12 @@ type stepQueueHeapItem struct {
 type stepQueueHeap []*stepQueueHeapItem
 
 func (h stepQueueHeap) Less(i, j int) bool {
+	if h[i].req.weight != h[j].req.weight {
+		return h[i].req.weight > h[j].req.weight
+	}
+	if h[i].req.orderKey != h[j].req.orderKey {
+		return h[i].req.orderKey < h[j].req.orderKey
+	}
 	return h[i].req.targetDate.Before(h[j].req.targetDate)
 }
 
@@ -146,9 +154,11 @@ func (q *stepQueue) Start(concurrency int) (done func()) {
 
 type StepCompletedFunc func()
 
-func (q *stepQueue) sendAndWaitForWakeup(ident interface{}, targetDate time.Time) StepCompletedFunc {
+func (q *stepQueue) sendAndWaitForWakeup(ident interface{}, weight int, orderKey int64, targetDate time.Time) StepCompletedFunc {
 	req := stepQueueRec{
 		ident,
+		weight,
+		orderKey,
 		targetDate,
 		make(chan StepCompletedFunc),
 	}
@@ -158,9 +168,16 @@ func (q *stepQueue) sendAndWaitForWakeup(ident interface{}, targetDate time.Time
 
 // Wait for the ident with targetDate to be selected to run.
 func (q *stepQueue) WaitReady(ctx context.Context, ident interface{}, targetDate time.Time) StepCompletedFunc {
+	return q.WaitReadyOrdered(ctx, ident, 1, 0, targetDate)
+}
+
+// Like WaitReady, but idents with a higher weight are selected before idents with a lower weight,
+// and among idents of the same weight, those with a smaller orderKey are selected first.
+// targetDate only orders idents with the same weight and orderKey.
+func (q *stepQueue) WaitReadyOrdered(ctx context.Context, ident interface{}, weight int, orderKey int64, targetDate time.Time) StepCompletedFunc {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
 	if targetDate.IsZero() {
 		panic("targetDate of zero is reserved for marking Done")
 	}
-	return q.sendAndWaitForWakeup(ident, targetDate)
+	return q.sendAndWaitForWakeup(ident, weight, orderKey, targetDate)
 }
@@ -192,3 +192,40 @@ func TestPqConcurrent(t *testing.T) {
 	}
 
 }
+
+func TestPqWeightsAndOrderKeys(t *testing.T) {
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	defer end()
+
+	q := newStepQueue()
+	defer q.Start(1)()
+
+	// occupy the only slot while the other idents queue up
+	release := q.WaitReady(ctx, "busy", time.Unix(1, 0))
+
+	var mtx sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	enqueue := func(ident string, weight int, orderKey int64, targetDate time.Time) {
+		wg.Add(1)
+		go func() {
+			ctx, end := trace.WithTaskFromStack(ctx)
+			defer end()
+			defer wg.Done()
+			defer q.WaitReadyOrdered(ctx, ident, weight, orderKey, targetDate)()
+			mtx.Lock()
+			order = append(order, ident)
+			mtx.Unlock()
+		}()
+	}
+	enqueue("old-light", 1, 0, time.Unix(2, 0))
+	enqueue("new-heavy", 5, 0, time.Unix(9, 0))
+	enqueue("old-heavy", 5, 0, time.Unix(3, 0))
+	enqueue("heavy-key-1", 5, 1, time.Unix(1, 0))
+	enqueue("heavy-key-minus-1", 5, -1, time.Unix(10, 0))
+	time.Sleep(500 * time.Millisecond) // FIXME timing, see TestPqNotconcurrent
+	release()
+	wg.Wait()
+
+	assert.Equal(t, []string{"heavy-key-minus-1", "old-heavy", "new-heavy", "heavy-key-1", "old-light"}, order)
+}
@@ -104,6 +104,17 @@ func TestIncrementalPath_SnapshotsOnly(t *testing.T) {
 		assert.Nil(t, conflict)
 	})
 
+	// common ancestor is determined by guid, not by name (e.g. snapshots renamed or prefixed on one side)
+	doTest(l("@recv_a,1", "@recv_b,2"), l("@a,1", "@b,2", "@c,3"), func(path []*FilesystemVersion, conflict error) {
+		assert.Nil(t, conflict)
+		assert.Equal(t, l("@b,2", "@c,3"), path)
+	})
+	doTest(l("@a,1", "@b,2"), l("@a,3", "@b,4"), func(path []*FilesystemVersion, conflict error) {
+		assert.Nil(t, path)
+		_, ok := conflict.(*ConflictNoCommonAncestor)
+		assert.True(t, ok, "equal names with different guids must not be considered a common ancestor")
+	})
+
 }
 
 func TestIncrementalPath_BookmarkSupport(t *testing.T) {
@@ -127,4 +138,11 @@ func TestIncrementalPath_BookmarkSupport(t *testing.T) {
 		assert.Equal(t, l("@a,1", "@b,2"), path)
 	})
 
+	// the receiver's latest snapshot was pruned on the sender,
+	// a bookmark with the same guid but a different name (e.g. the replication cursor) is the incremental source
+	doTest(l("@a,1", "@b,2"), l("@a,1", "#zrepl_CURSOR,2", "@c,3"), func(path []*FilesystemVersion, conflict error) {
+		assert.NoError(t, conflict)
+		assert.Equal(t, l("#zrepl_CURSOR,2", "@c,3"), path)
+	})
+
 }
@@ -46,7 +46,7 @@ func (x Tri) String() string {
 	return proto.EnumName(Tri_name, int32(x))
 }
 func (Tri) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{0}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{0}
 }
 
 type ReplicationGuaranteeKind int32
@@ -75,7 +75,35 @@ func (x ReplicationGuaranteeKind) String() string {
 	return proto.EnumName(ReplicationGuaranteeKind_name, int32(x))
 }
 func (ReplicationGuaranteeKind) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{1}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{1}
+}
+
+type ChecksumMethod int32
+
+const (
+	ChecksumMethod_ChecksumMethodInvalid ChecksumMethod = 0
+	// Size of a full send stream as estimated by `zfs send -nvP`
+	ChecksumMethod_ChecksumMethodStreamSize ChecksumMethod = 1
+	// SHA256 of the full send stream, requires reading the entire snapshot
+	ChecksumMethod_ChecksumMethodStreamSHA256 ChecksumMethod = 2
+)
+
+var ChecksumMethod_name = map[int32]string{
+	0: "ChecksumMethodInvalid",
+	1: "ChecksumMethodStreamSize",
+	2: "ChecksumMethodStreamSHA256",
+}
+var ChecksumMethod_value = map[string]int32{
+	"ChecksumMethodInvalid":      0,
+	"ChecksumMethodStreamSize":   1,
+	"ChecksumMethodStreamSHA256": 2,
+}
+
+func (x ChecksumMethod) String() string {
+	return proto.EnumName(ChecksumMethod_name, int32(x))
+}
+func (ChecksumMethod) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_0155b27082b2220f, []int{2}
 }
 
 type FilesystemVersion_VersionType int32
@@ -98,10 +126,16 @@ func (x FilesystemVersion_VersionType) String() string {
 	return proto.EnumName(FilesystemVersion_VersionType_name, int32(x))
 }
 func (FilesystemVersion_VersionType) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{5, 0}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{6, 0}
 }
 
 type ListFilesystemReq struct {
+	// If not zero, the server returns at most PageSize filesystems,
+	// starting after the filesystem named by PageToken.
+	// Servers that do not support pagination return all filesystems.
+	PageSize uint32 `protobuf:"varint,1,opt,name=PageSize,proto3" json:"PageSize,omitempty"`
+	// Empty for the first page, ListFilesystemRes.NextPageToken otherwise.
+	PageToken            string   `protobuf:"bytes,2,opt,name=PageToken,proto3" json:"PageToken,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -111,7 +145,7 @@ func (m *ListFilesystemReq) Reset()         { *m = ListFilesystemReq{} }
 func (m *ListFilesystemReq) String() string { return proto.CompactTextString(m) }
 func (*ListFilesystemReq) ProtoMessage()    {}
 func (*ListFilesystemReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{0}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{0}
 }
 func (m *ListFilesystemReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ListFilesystemReq.Unmarshal(m, b)
@@ -131,18 +165,43 @@ func (m *ListFilesystemReq) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_ListFilesystemReq proto.InternalMessageInfo
 
+func (m *ListFilesystemReq) GetPageSize() uint32 {
+	if m != nil {
+		return m.PageSize
+	}
+	return 0
+}
+
+func (m *ListFilesystemReq) GetPageToken() string {
+	if m != nil {
+		return m.PageToken
+	}
+	return ""
+}
+
 type ListFilesystemRes struct {
-	Filesystems          []*Filesystem `protobuf:"bytes,1,rep,name=Filesystems,proto3" json:"Filesystems,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
-	XXX_unrecognized     []byte        `json:"-"`
-	XXX_sizecache        int32         `json:"-"`
+	Filesystems []*Filesystem `protobuf:"bytes,1,rep,name=Filesystems,proto3" json:"Filesystems,omitempty"`
+	// If not empty, there are more filesystems, to be requested with
+	// ListFilesystemReq.PageToken = NextPageToken.
+	// A page may contain fewer than PageSize filesystems, even none.
+	NextPageToken string `protobuf:"bytes,2,opt,name=NextPageToken,proto3" json:"NextPageToken,omitempty"`
+	// Set by receivers that set the ACL properties of received filesystems to the
+	// sender's values (recv.acl_properties: preserve), see SendReq.ACLProperties.
+	PreservesACLProperties bool `protobuf:"varint,3,opt,name=PreservesACLProperties,proto3" json:"PreservesACLProperties,omitempty"`
+	// Set by senders whose snapshots are managed by another tool
+	// (send.externally_managed_snapshots): they neither create nor destroy
+	// snapshots, holds or replication cursors.
+	SnapshotsExternallyManaged bool     `protobuf:"varint,4,opt,name=SnapshotsExternallyManaged,proto3" json:"SnapshotsExternallyManaged,omitempty"`
+	XXX_NoUnkeyedLiteral       struct{} `json:"-"`
+	XXX_unrecognized           []byte   `json:"-"`
+	XXX_sizecache              int32    `json:"-"`
 }
 
 func (m *ListFilesystemRes) Reset()         { *m = ListFilesystemRes{} }
 func (m *ListFilesystemRes) String() string { return proto.CompactTextString(m) }
 func (*ListFilesystemRes) ProtoMessage()    {}
 func (*ListFilesystemRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{1}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{1}
 }
 func (m *ListFilesystemRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ListFilesystemRes.Unmarshal(m, b)
@@ -169,6 +228,27 @@ func (m *ListFilesystemRes) GetFilesystems() []*Filesystem {
 	return nil
 }
 
+func (m *ListFilesystemRes) GetNextPageToken() string {
+	if m != nil {
+		return m.NextPageToken
+	}
+	return ""
+}
+
+func (m *ListFilesystemRes) GetPreservesACLProperties() bool {
+	if m != nil {
+		return m.PreservesACLProperties
+	}
+	return false
+}
+
+func (m *ListFilesystemRes) GetSnapshotsExternallyManaged() bool {
+	if m != nil {
+		return m.SnapshotsExternallyManaged
+	}
+	return false
+}
+
 type Filesystem struct {
 	Path                 string   `protobuf:"bytes,1,opt,name=Path,proto3" json:"Path,omitempty"`
 	ResumeToken          string   `protobuf:"bytes,2,opt,name=ResumeToken,proto3" json:"ResumeToken,omitempty"`
@@ -183,7 +263,7 @@ func (m *Filesystem) Reset()         { *m = Filesystem{} }
 func (m *Filesystem) String() string { return proto.CompactTextString(m) }
 func (*Filesystem) ProtoMessage()    {}
 func (*Filesystem) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{2}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{2}
 }
 func (m *Filesystem) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Filesystem.Unmarshal(m, b)
@@ -232,17 +312,21 @@ func (m *Filesystem) GetIsEncrypted() bool {
 }
 
 type ListFilesystemVersionsReq struct {
-	Filesystem           string   `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Filesystem string `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
+	// If set, the client already knows the versions of Filesystem up to and
+	// including Since.CreateTXG and only needs the newer ones, see
+	// ListFilesystemVersionsRes.Incremental.
+	Since                *ListFilesystemVersionsSince `protobuf:"bytes,2,opt,name=Since,proto3" json:"Since,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                     `json:"-"`
+	XXX_unrecognized     []byte                       `json:"-"`
+	XXX_sizecache        int32                        `json:"-"`
 }
 
 func (m *ListFilesystemVersionsReq) Reset()         { *m = ListFilesystemVersionsReq{} }
 func (m *ListFilesystemVersionsReq) String() string { return proto.CompactTextString(m) }
 func (*ListFilesystemVersionsReq) ProtoMessage()    {}
 func (*ListFilesystemVersionsReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{3}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{3}
 }
 func (m *ListFilesystemVersionsReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ListFilesystemVersionsReq.Unmarshal(m, b)
@@ -269,18 +353,79 @@ func (m *ListFilesystemVersionsReq) GetFilesystem() string {
 	return ""
 }
 
+func (m *ListFilesystemVersionsReq) GetSince() *ListFilesystemVersionsSince {
+	if m != nil {
+		return m.Since
+	}
+	return nil
+}
+
+type ListFilesystemVersionsSince struct {
+	CreateTXG uint64 `protobuf:"varint,1,opt,name=CreateTXG,proto3" json:"CreateTXG,omitempty"`
+	// FilesystemVersionsDigest of the versions known to the client,
+	// all of which have a createtxg <= CreateTXG.
+	Digest               []byte   `protobuf:"bytes,2,opt,name=Digest,proto3" json:"Digest,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListFilesystemVersionsSince) Reset()         { *m = ListFilesystemVersionsSince{} }
+func (m *ListFilesystemVersionsSince) String() string { return proto.CompactTextString(m) }
+func (*ListFilesystemVersionsSince) ProtoMessage()    {}
+func (*ListFilesystemVersionsSince) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_0155b27082b2220f, []int{4}
+}
+func (m *ListFilesystemVersionsSince) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListFilesystemVersionsSince.Unmarshal(m, b)
+}
+func (m *ListFilesystemVersionsSince) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListFilesystemVersionsSince.Marshal(b, m, deterministic)
+}
+func (dst *ListFilesystemVersionsSince) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListFilesystemVersionsSince.Merge(dst, src)
+}
+func (m *ListFilesystemVersionsSince) XXX_Size() int {
+	return xxx_messageInfo_ListFilesystemVersionsSince.Size(m)
+}
+func (m *ListFilesystemVersionsSince) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListFilesystemVersionsSince.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListFilesystemVersionsSince proto.InternalMessageInfo
+
+func (m *ListFilesystemVersionsSince) GetCreateTXG() uint64 {
+	if m != nil {
+		return m.CreateTXG
+	}
+	return 0
+}
+
+func (m *ListFilesystemVersionsSince) GetDigest() []byte {
+	if m != nil {
+		return m.Digest
+	}
+	return nil
+}
+
 type ListFilesystemVersionsRes struct {
-	Versions             []*FilesystemVersion `protobuf:"bytes,1,rep,name=Versions,proto3" json:"Versions,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
-	XXX_unrecognized     []byte               `json:"-"`
-	XXX_sizecache        int32                `json:"-"`
+	Versions []*FilesystemVersion `protobuf:"bytes,1,rep,name=Versions,proto3" json:"Versions,omitempty"`
+	// If true, Versions only contains the versions with a createtxg greater than
+	// ListFilesystemVersionsReq.Since.CreateTXG, and the versions with a smaller
+	// or equal createtxg are those known to the client.
+	// Servers that do not support ListFilesystemVersionsReq.Since always return
+	// all versions with Incremental = false.
+	Incremental          bool     `protobuf:"varint,2,opt,name=Incremental,proto3" json:"Incremental,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *ListFilesystemVersionsRes) Reset()         { *m = ListFilesystemVersionsRes{} }
 func (m *ListFilesystemVersionsRes) String() string { return proto.CompactTextString(m) }
 func (*ListFilesystemVersionsRes) ProtoMessage()    {}
 func (*ListFilesystemVersionsRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{4}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{5}
 }
 func (m *ListFilesystemVersionsRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ListFilesystemVersionsRes.Unmarshal(m, b)
@@ -307,6 +452,13 @@ func (m *ListFilesystemVersionsRes) GetVersions() []*FilesystemVersion {
 	return nil
 }
 
+func (m *ListFilesystemVersionsRes) GetIncremental() bool {
+	if m != nil {
+		return m.Incremental
+	}
+	return false
+}
+
 type FilesystemVersion struct {
 	Type                 FilesystemVersion_VersionType `protobuf:"varint,1,opt,name=Type,proto3,enum=FilesystemVersion_VersionType" json:"Type,omitempty"`
 	Name                 string                        `protobuf:"bytes,2,opt,name=Name,proto3" json:"Name,omitempty"`
@@ -322,7 +474,7 @@ func (m *FilesystemVersion) Reset()         { *m = FilesystemVersion{} }
 func (m *FilesystemVersion) String() string { return proto.CompactTextString(m) }
 func (*FilesystemVersion) ProtoMessage()    {}
 func (*FilesystemVersion) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{5}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{6}
 }
 func (m *FilesystemVersion) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_FilesystemVersion.Unmarshal(m, b)
@@ -388,20 +540,23 @@ type SendReq struct {
 	// SHOULD clear the resume token on their side and use From and To instead If
 	// ResumeToken is not empty, the GUIDs of From and To MUST correspond to those
 	// encoded in the ResumeToken. Otherwise, the Sender MUST return an error.
-	ResumeToken          string             `protobuf:"bytes,4,opt,name=ResumeToken,proto3" json:"ResumeToken,omitempty"`
-	Encrypted            Tri                `protobuf:"varint,5,opt,name=Encrypted,proto3,enum=Tri" json:"Encrypted,omitempty"`
-	DryRun               bool               `protobuf:"varint,6,opt,name=DryRun,proto3" json:"DryRun,omitempty"`
-	ReplicationConfig    *ReplicationConfig `protobuf:"bytes,7,opt,name=ReplicationConfig,proto3" json:"ReplicationConfig,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
-	XXX_unrecognized     []byte             `json:"-"`
-	XXX_sizecache        int32              `json:"-"`
+	ResumeToken       string             `protobuf:"bytes,4,opt,name=ResumeToken,proto3" json:"ResumeToken,omitempty"`
+	Encrypted         Tri                `protobuf:"varint,5,opt,name=Encrypted,proto3,enum=Tri" json:"Encrypted,omitempty"`
+	DryRun            bool               `protobuf:"varint,6,opt,name=DryRun,proto3" json:"DryRun,omitempty"`
+	ReplicationConfig *ReplicationConfig `protobuf:"bytes,7,opt,name=ReplicationConfig,proto3" json:"ReplicationConfig,omitempty"`
+	// If true, the sender reports the values of the ACL properties of Filesystem
+	// in SendRes.ACLProperties.
+	ACLProperties        bool     `protobuf:"varint,8,opt,name=ACLProperties,proto3" json:"ACLProperties,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *SendReq) Reset()         { *m = SendReq{} }
 func (m *SendReq) String() string { return proto.CompactTextString(m) }
 func (*SendReq) ProtoMessage()    {}
 func (*SendReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{6}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{7}
 }
 func (m *SendReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SendReq.Unmarshal(m, b)
@@ -470,6 +625,13 @@ func (m *SendReq) GetReplicationConfig() *ReplicationConfig {
 	return nil
 }
 
+func (m *SendReq) GetACLProperties() bool {
+	if m != nil {
+		return m.ACLProperties
+	}
+	return false
+}
+
 type ReplicationConfig struct {
 	Protection           *ReplicationConfigProtection `protobuf:"bytes,1,opt,name=protection,proto3" json:"protection,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}                     `json:"-"`
@@ -481,7 +643,7 @@ func (m *ReplicationConfig) Reset()         { *m = ReplicationConfig{} }
 func (m *ReplicationConfig) String() string { return proto.CompactTextString(m) }
 func (*ReplicationConfig) ProtoMessage()    {}
 func (*ReplicationConfig) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{7}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{8}
 }
 func (m *ReplicationConfig) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReplicationConfig.Unmarshal(m, b)
@@ -520,7 +682,7 @@ func (m *ReplicationConfigProtection) Reset()         { *m = ReplicationConfigPr
 func (m *ReplicationConfigProtection) String() string { return proto.CompactTextString(m) }
 func (*ReplicationConfigProtection) ProtoMessage()    {}
 func (*ReplicationConfigProtection) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{8}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{9}
 }
 func (m *ReplicationConfigProtection) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReplicationConfigProtection.Unmarshal(m, b)
@@ -566,7 +728,7 @@ func (m *Property) Reset()         { *m = Property{} }
 func (m *Property) String() string { return proto.CompactTextString(m) }
 func (*Property) ProtoMessage()    {}
 func (*Property) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{9}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{10}
 }
 func (m *Property) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Property.Unmarshal(m, b)
@@ -606,8 +768,18 @@ type SendRes struct {
 	UsedResumeToken bool `protobuf:"varint,2,opt,name=UsedResumeToken,proto3" json:"UsedResumeToken,omitempty"`
 	// Expected stream size determined by dry run, not exact.
 	// 0 indicates that for the given SendReq, no size estimate could be made.
-	ExpectedSize         int64       `protobuf:"varint,3,opt,name=ExpectedSize,proto3" json:"ExpectedSize,omitempty"`
-	Properties           []*Property `protobuf:"bytes,4,rep,name=Properties,proto3" json:"Properties,omitempty"`
+	ExpectedSize int64       `protobuf:"varint,3,opt,name=ExpectedSize,proto3" json:"ExpectedSize,omitempty"`
+	Properties   []*Property `protobuf:"bytes,4,rep,name=Properties,proto3" json:"Properties,omitempty"`
+	// Expected size of the sent data uncompressed (logical) and as stored on the
+	// sender with compression (physical), derived from ExpectedSize and the
+	// compression ratio of To. Raw sends transfer physical data, other sends
+	// transfer logical data. 0 indicates that no estimate could be made.
+	ExpectedLogicalSize  int64 `protobuf:"varint,5,opt,name=ExpectedLogicalSize,proto3" json:"ExpectedLogicalSize,omitempty"`
+	ExpectedPhysicalSize int64 `protobuf:"varint,6,opt,name=ExpectedPhysicalSize,proto3" json:"ExpectedPhysicalSize,omitempty"`
+	// The sender's values of the properties that govern the interpretation of
+	// file ownership and ACLs (acltype, aclinherit, aclmode), omitting those
+	// that the sender's platform does not support. Only set for non-dry-run sends.
+	ACLProperties        []*Property `protobuf:"bytes,7,rep,name=ACLProperties,proto3" json:"ACLProperties,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
 	XXX_unrecognized     []byte      `json:"-"`
 	XXX_sizecache        int32       `json:"-"`
@@ -617,7 +789,7 @@ func (m *SendRes) Reset()         { *m = SendRes{} }
 func (m *SendRes) String() string { return proto.CompactTextString(m) }
 func (*SendRes) ProtoMessage()    {}
 func (*SendRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{10}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{11}
 }
 func (m *SendRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SendRes.Unmarshal(m, b)
@@ -658,6 +830,27 @@ func (m *SendRes) GetProperties() []*Property {
 	return nil
 }
 
+func (m *SendRes) GetExpectedLogicalSize() int64 {
+	if m != nil {
+		return m.ExpectedLogicalSize
+	}
+	return 0
+}
+
+func (m *SendRes) GetExpectedPhysicalSize() int64 {
+	if m != nil {
+		return m.ExpectedPhysicalSize
+	}
+	return 0
+}
+
+func (m *SendRes) GetACLProperties() []*Property {
+	if m != nil {
+		return m.ACLProperties
+	}
+	return nil
+}
+
 type SendCompletedReq struct {
 	OriginalReq          *SendReq `protobuf:"bytes,2,opt,name=OriginalReq,proto3" json:"OriginalReq,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -669,7 +862,7 @@ func (m *SendCompletedReq) Reset()         { *m = SendCompletedReq{} }
 func (m *SendCompletedReq) String() string { return proto.CompactTextString(m) }
 func (*SendCompletedReq) ProtoMessage()    {}
 func (*SendCompletedReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{11}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{12}
 }
 func (m *SendCompletedReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SendCompletedReq.Unmarshal(m, b)
@@ -706,7 +899,7 @@ func (m *SendCompletedRes) Reset()         { *m = SendCompletedRes{} }
 func (m *SendCompletedRes) String() string { return proto.CompactTextString(m) }
 func (*SendCompletedRes) ProtoMessage()    {}
 func (*SendCompletedRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{12}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{13}
 }
 func (m *SendCompletedRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SendCompletedRes.Unmarshal(m, b)
@@ -731,18 +924,21 @@ type ReceiveReq struct {
 	To         *FilesystemVersion `protobuf:"bytes,2,opt,name=To,proto3" json:"To,omitempty"`
 	// If true, the receiver should clear the resume token before performing the
 	// zfs recv of the stream in the request
-	ClearResumeToken     bool               `protobuf:"varint,3,opt,name=ClearResumeToken,proto3" json:"ClearResumeToken,omitempty"`
-	ReplicationConfig    *ReplicationConfig `protobuf:"bytes,4,opt,name=ReplicationConfig,proto3" json:"ReplicationConfig,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
-	XXX_unrecognized     []byte             `json:"-"`
-	XXX_sizecache        int32              `json:"-"`
+	ClearResumeToken  bool               `protobuf:"varint,3,opt,name=ClearResumeToken,proto3" json:"ClearResumeToken,omitempty"`
+	ReplicationConfig *ReplicationConfig `protobuf:"bytes,4,opt,name=ReplicationConfig,proto3" json:"ReplicationConfig,omitempty"`
+	// SendRes.ACLProperties of the send whose stream is received.
+	// The receiver applies them if it is configured to preserve them.
+	ACLProperties        []*Property `protobuf:"bytes,5,rep,name=ACLProperties,proto3" json:"ACLProperties,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
 }
 
 func (m *ReceiveReq) Reset()         { *m = ReceiveReq{} }
 func (m *ReceiveReq) String() string { return proto.CompactTextString(m) }
 func (*ReceiveReq) ProtoMessage()    {}
 func (*ReceiveReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{13}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{14}
 }
 func (m *ReceiveReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReceiveReq.Unmarshal(m, b)
@@ -790,6 +986,13 @@ func (m *ReceiveReq) GetReplicationConfig() *ReplicationConfig {
 	return nil
 }
 
+func (m *ReceiveReq) GetACLProperties() []*Property {
+	if m != nil {
+		return m.ACLProperties
+	}
+	return nil
+}
+
 type ReceiveRes struct {
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -800,7 +1003,7 @@ func (m *ReceiveRes) Reset()         { *m = ReceiveRes{} }
 func (m *ReceiveRes) String() string { return proto.CompactTextString(m) }
 func (*ReceiveRes) ProtoMessage()    {}
 func (*ReceiveRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{14}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{15}
 }
 func (m *ReceiveRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReceiveRes.Unmarshal(m, b)
@@ -833,7 +1036,7 @@ func (m *DestroySnapshotsReq) Reset()         { *m = DestroySnapshotsReq{} }
 func (m *DestroySnapshotsReq) String() string { return proto.CompactTextString(m) }
 func (*DestroySnapshotsReq) ProtoMessage()    {}
 func (*DestroySnapshotsReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{15}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{16}
 }
 func (m *DestroySnapshotsReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DestroySnapshotsReq.Unmarshal(m, b)
@@ -879,7 +1082,7 @@ func (m *DestroySnapshotRes) Reset()         { *m = DestroySnapshotRes{} }
 func (m *DestroySnapshotRes) String() string { return proto.CompactTextString(m) }
 func (*DestroySnapshotRes) ProtoMessage()    {}
 func (*DestroySnapshotRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{16}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{17}
 }
 func (m *DestroySnapshotRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DestroySnapshotRes.Unmarshal(m, b)
@@ -924,7 +1127,7 @@ func (m *DestroySnapshotsRes) Reset()         { *m = DestroySnapshotsRes{} }
 func (m *DestroySnapshotsRes) String() string { return proto.CompactTextString(m) }
 func (*DestroySnapshotsRes) ProtoMessage()    {}
 func (*DestroySnapshotsRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{17}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{18}
 }
 func (m *DestroySnapshotsRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DestroySnapshotsRes.Unmarshal(m, b)
@@ -962,7 +1165,7 @@ func (m *ReplicationCursorReq) Reset()         { *m = ReplicationCursorReq{} }
 func (m *ReplicationCursorReq) String() string { return proto.CompactTextString(m) }
 func (*ReplicationCursorReq) ProtoMessage()    {}
 func (*ReplicationCursorReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{18}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{19}
 }
 func (m *ReplicationCursorReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReplicationCursorReq.Unmarshal(m, b)
@@ -1003,7 +1206,7 @@ func (m *ReplicationCursorRes) Reset()         { *m = ReplicationCursorRes{} }
 func (m *ReplicationCursorRes) String() string { return proto.CompactTextString(m) }
 func (*ReplicationCursorRes) ProtoMessage()    {}
 func (*ReplicationCursorRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{19}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{20}
 }
 func (m *ReplicationCursorRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReplicationCursorRes.Unmarshal(m, b)
@@ -1128,6 +1331,323 @@ func _ReplicationCursorRes_OneofSizer(msg proto.Message) (n int) {
 	return n
 }
 
+type ChecksumVersionReq struct {
+	Filesystem string `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
+	// Must be a snapshot
+	Version              *FilesystemVersion `protobuf:"bytes,2,opt,name=Version,proto3" json:"Version,omitempty"`
+	Method               ChecksumMethod     `protobuf:"varint,3,opt,name=Method,proto3,enum=ChecksumMethod" json:"Method,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *ChecksumVersionReq) Reset()         { *m = ChecksumVersionReq{} }
+func (m *ChecksumVersionReq) String() string { return proto.CompactTextString(m) }
+func (*ChecksumVersionReq) ProtoMessage()    {}
+func (*ChecksumVersionReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_0155b27082b2220f, []int{21}
+}
+func (m *ChecksumVersionReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ChecksumVersionReq.Unmarshal(m, b)
+}
+func (m *ChecksumVersionReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ChecksumVersionReq.Marshal(b, m, deterministic)
+}
+func (dst *ChecksumVersionReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ChecksumVersionReq.Merge(dst, src)
+}
+func (m *ChecksumVersionReq) XXX_Size() int {
+	return xxx_messageInfo_ChecksumVersionReq.Size(m)
+}
+func (m *ChecksumVersionReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_ChecksumVersionReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ChecksumVersionReq proto.InternalMessageInfo
+
+func (m *ChecksumVersionReq) GetFilesystem() string {
+	if m != nil {
+		return m.Filesystem
+	}
+	return ""
+}
+
+func (m *ChecksumVersionReq) GetVersion() *FilesystemVersion {
+	if m != nil {
+		return m.Version
+	}
+	return nil
+}
+
+func (m *ChecksumVersionReq) GetMethod() ChecksumMethod {
+	if m != nil {
+		return m.Method
+	}
+	return ChecksumMethod_ChecksumMethodInvalid
+}
+
+type ChecksumVersionRes struct {
+	Checksum             string   `protobuf:"bytes,1,opt,name=Checksum,proto3" json:"Checksum,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ChecksumVersionRes) Reset()         { *m = ChecksumVersionRes{} }
+func (m *ChecksumVersionRes) String() string { return proto.CompactTextString(m) }
+func (*ChecksumVersionRes) ProtoMessage()    {}
+func (*ChecksumVersionRes) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_0155b27082b2220f, []int{22}
+}
+func (m *ChecksumVersionRes) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ChecksumVersionRes.Unmarshal(m, b)
+}
+func (m *ChecksumVersionRes) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ChecksumVersionRes.Marshal(b, m, deterministic)
+}
+func (dst *ChecksumVersionRes) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ChecksumVersionRes.Merge(dst, src)
+}
+func (m *ChecksumVersionRes) XXX_Size() int {
+	return xxx_messageInfo_ChecksumVersionRes.Size(m)
+}
+func (m *ChecksumVersionRes) XXX_DiscardUnknown() {
+	xxx_messageInfo_ChecksumVersionRes.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ChecksumVersionRes proto.InternalMessageInfo
+
+func (m *ChecksumVersionRes) GetChecksum() string {
+	if m != nil {
+		return m.Checksum
+	}
+	return ""
+}
+
+type RenameFilesystemReq struct {
+	Filesystem           string   `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
+	NewFilesystem        string   `protobuf:"bytes,2,opt,name=NewFilesystem,proto3" json:"NewFilesystem,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RenameFilesystemReq) Reset()         { *m = RenameFilesystemReq{} }
+func (m *RenameFilesystemReq) String() string { return proto.CompactTextString(m) }
+func (*RenameFilesystemReq) ProtoMessage()    {}
+func (*RenameFilesystemReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_0155b27082b2220f, []int{23}
+}
+func (m *RenameFilesystemReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RenameFilesystemReq.Unmarshal(m, b)
+}
+func (m *RenameFilesystemReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RenameFilesystemReq.Marshal(b, m, deterministic)
+}
+func (dst *RenameFilesystemReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RenameFilesystemReq.Merge(dst, src)
+}
+func (m *RenameFilesystemReq) XXX_Size() int {
+	return xxx_messageInfo_RenameFilesystemReq.Size(m)
+}
+func (m *RenameFilesystemReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_RenameFilesystemReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RenameFilesystemReq proto.InternalMessageInfo
+
+func (m *RenameFilesystemReq) GetFilesystem() string {
+	if m != nil {
+		return m.Filesystem
+	}
+	return ""
+}
+
+func (m *RenameFilesystemReq) GetNewFilesystem() string {
+	if m != nil {
+		return m.NewFilesystem
+	}
+	return ""
+}
+
+type RenameFilesystemRes struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RenameFilesystemRes) Reset()         { *m = RenameFilesystemRes{} }
+func (m *RenameFilesystemRes) String() string { return proto.CompactTextString(m) }
+func (*RenameFilesystemRes) ProtoMessage()    {}
+func (*RenameFilesystemRes) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_0155b27082b2220f, []int{24}
+}
+func (m *RenameFilesystemRes) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RenameFilesystemRes.Unmarshal(m, b)
+}
+func (m *RenameFilesystemRes) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RenameFilesystemRes.Marshal(b, m, deterministic)
+}
+func (dst *RenameFilesystemRes) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RenameFilesystemRes.Merge(dst, src)
+}
+func (m *RenameFilesystemRes) XXX_Size() int {
+	return xxx_messageInfo_RenameFilesystemRes.Size(m)
+}
+func (m *RenameFilesystemRes) XXX_DiscardUnknown() {
+	xxx_messageInfo_RenameFilesystemRes.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RenameFilesystemRes proto.InternalMessageInfo
+
+type RollbackReq struct {
+	Filesystem string `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
+	// The receiver's snapshot to roll back to, identified by its GUID.
+	// All later snapshots and bookmarks of Filesystem are destroyed.
+	Snapshot             *FilesystemVersion `protobuf:"bytes,2,opt,name=Snapshot,proto3" json:"Snapshot,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *RollbackReq) Reset()         { *m = RollbackReq{} }
+func (m *RollbackReq) String() string { return proto.CompactTextString(m) }
+func (*RollbackReq) ProtoMessage()    {}
+func (*RollbackReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_0155b27082b2220f, []int{25}
+}
+func (m *RollbackReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RollbackReq.Unmarshal(m, b)
+}
+func (m *RollbackReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RollbackReq.Marshal(b, m, deterministic)
+}
+func (dst *RollbackReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RollbackReq.Merge(dst, src)
+}
+func (m *RollbackReq) XXX_Size() int {
+	return xxx_messageInfo_RollbackReq.Size(m)
+}
+func (m *RollbackReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_RollbackReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RollbackReq proto.InternalMessageInfo
+
+func (m *RollbackReq) GetFilesystem() string {
+	if m != nil {
+		return m.Filesystem
+	}
+	return ""
+}
+
+func (m *RollbackReq) GetSnapshot() *FilesystemVersion {
+	if m != nil {
+		return m.Snapshot
+	}
+	return nil
+}
+
+type RollbackRes struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RollbackRes) Reset()         { *m = RollbackRes{} }
+func (m *RollbackRes) String() string { return proto.CompactTextString(m) }
+func (*RollbackRes) ProtoMessage()    {}
+func (*RollbackRes) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_0155b27082b2220f, []int{26}
+}
+func (m *RollbackRes) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RollbackRes.Unmarshal(m, b)
+}
+func (m *RollbackRes) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RollbackRes.Marshal(b, m, deterministic)
+}
+func (dst *RollbackRes) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RollbackRes.Merge(dst, src)
+}
+func (m *RollbackRes) XXX_Size() int {
+	return xxx_messageInfo_RollbackRes.Size(m)
+}
+func (m *RollbackRes) XXX_DiscardUnknown() {
+	xxx_messageInfo_RollbackRes.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RollbackRes proto.InternalMessageInfo
+
+type DestroyFilesystemReq struct {
+	// Must be a tombstone, i.e., a receiver filesystem that was renamed
+	// after its sender filesystem was destroyed.
+	Filesystem           string   `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DestroyFilesystemReq) Reset()         { *m = DestroyFilesystemReq{} }
+func (m *DestroyFilesystemReq) String() string { return proto.CompactTextString(m) }
+func (*DestroyFilesystemReq) ProtoMessage()    {}
+func (*DestroyFilesystemReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_0155b27082b2220f, []int{27}
+}
+func (m *DestroyFilesystemReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DestroyFilesystemReq.Unmarshal(m, b)
+}
+func (m *DestroyFilesystemReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DestroyFilesystemReq.Marshal(b, m, deterministic)
+}
+func (dst *DestroyFilesystemReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DestroyFilesystemReq.Merge(dst, src)
+}
+func (m *DestroyFilesystemReq) XXX_Size() int {
+	return xxx_messageInfo_DestroyFilesystemReq.Size(m)
+}
+func (m *DestroyFilesystemReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_DestroyFilesystemReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DestroyFilesystemReq proto.InternalMessageInfo
+
+func (m *DestroyFilesystemReq) GetFilesystem() string {
+	if m != nil {
+		return m.Filesystem
+	}
+	return ""
+}
+
+type DestroyFilesystemRes struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DestroyFilesystemRes) Reset()         { *m = DestroyFilesystemRes{} }
+func (m *DestroyFilesystemRes) String() string { return proto.CompactTextString(m) }
+func (*DestroyFilesystemRes) ProtoMessage()    {}
+func (*DestroyFilesystemRes) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_0155b27082b2220f, []int{28}
+}
+func (m *DestroyFilesystemRes) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DestroyFilesystemRes.Unmarshal(m, b)
+}
+func (m *DestroyFilesystemRes) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DestroyFilesystemRes.Marshal(b, m, deterministic)
+}
+func (dst *DestroyFilesystemRes) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DestroyFilesystemRes.Merge(dst, src)
+}
+func (m *DestroyFilesystemRes) XXX_Size() int {
+	return xxx_messageInfo_DestroyFilesystemRes.Size(m)
+}
+func (m *DestroyFilesystemRes) XXX_DiscardUnknown() {
+	xxx_messageInfo_DestroyFilesystemRes.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DestroyFilesystemRes proto.InternalMessageInfo
+
 type PingReq struct {
 	Message              string   `protobuf:"bytes,1,opt,name=Message,proto3" json:"Message,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -1139,7 +1659,7 @@ func (m *PingReq) Reset()         { *m = PingReq{} }
 func (m *PingReq) String() string { return proto.CompactTextString(m) }
 func (*PingReq) ProtoMessage()    {}
 func (*PingReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{20}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{29}
 }
 func (m *PingReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PingReq.Unmarshal(m, b)
@@ -1178,7 +1698,7 @@ func (m *PingRes) Reset()         { *m = PingRes{} }
 func (m *PingRes) String() string { return proto.CompactTextString(m) }
 func (*PingRes) ProtoMessage()    {}
 func (*PingRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_616c27178643eca4, []int{21}
+	return fileDescriptor_pdu_0155b27082b2220f, []int{30}
 }
 func (m *PingRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PingRes.Unmarshal(m, b)
@@ -1205,11 +1725,56 @@ func (m *PingRes) GetEcho() string {
 	return ""
 }
 
+// The dataconn client appends the encoded DataconnRequestMetadata to the
+// encoded request message (SendReq, ReceiveReq, PingReq). Since concatenated
+// protobuf messages are merged on decoding, and unknown fields are ignored,
+// servers that do not know about DataconnRequestMetadata ignore it.
+// Hence, its field numbers must be reserved in the request messages.
+type DataconnRequestMetadata struct {
+	// Identifies the job invocation on the client that made the request.
+	InvocationID         string   `protobuf:"bytes,100,opt,name=InvocationID,proto3" json:"InvocationID,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DataconnRequestMetadata) Reset()         { *m = DataconnRequestMetadata{} }
+func (m *DataconnRequestMetadata) String() string { return proto.CompactTextString(m) }
+func (*DataconnRequestMetadata) ProtoMessage()    {}
+func (*DataconnRequestMetadata) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_0155b27082b2220f, []int{31}
+}
+func (m *DataconnRequestMetadata) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DataconnRequestMetadata.Unmarshal(m, b)
+}
+func (m *DataconnRequestMetadata) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DataconnRequestMetadata.Marshal(b, m, deterministic)
+}
+func (dst *DataconnRequestMetadata) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DataconnRequestMetadata.Merge(dst, src)
+}
+func (m *DataconnRequestMetadata) XXX_Size() int {
+	return xxx_messageInfo_DataconnRequestMetadata.Size(m)
+}
+func (m *DataconnRequestMetadata) XXX_DiscardUnknown() {
+	xxx_messageInfo_DataconnRequestMetadata.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DataconnRequestMetadata proto.InternalMessageInfo
+
+func (m *DataconnRequestMetadata) GetInvocationID() string {
+	if m != nil {
+		return m.InvocationID
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*ListFilesystemReq)(nil), "ListFilesystemReq")
 	proto.RegisterType((*ListFilesystemRes)(nil), "ListFilesystemRes")
 	proto.RegisterType((*Filesystem)(nil), "Filesystem")
 	proto.RegisterType((*ListFilesystemVersionsReq)(nil), "ListFilesystemVersionsReq")
+	proto.RegisterType((*ListFilesystemVersionsSince)(nil), "ListFilesystemVersionsSince")
 	proto.RegisterType((*ListFilesystemVersionsRes)(nil), "ListFilesystemVersionsRes")
 	proto.RegisterType((*FilesystemVersion)(nil), "FilesystemVersion")
 	proto.RegisterType((*SendReq)(nil), "SendReq")
@@ -1226,10 +1791,20 @@ func init() {
 	proto.RegisterType((*DestroySnapshotsRes)(nil), "DestroySnapshotsRes")
 	proto.RegisterType((*ReplicationCursorReq)(nil), "ReplicationCursorReq")
 	proto.RegisterType((*ReplicationCursorRes)(nil), "ReplicationCursorRes")
+	proto.RegisterType((*ChecksumVersionReq)(nil), "ChecksumVersionReq")
+	proto.RegisterType((*ChecksumVersionRes)(nil), "ChecksumVersionRes")
+	proto.RegisterType((*RenameFilesystemReq)(nil), "RenameFilesystemReq")
+	proto.RegisterType((*RenameFilesystemRes)(nil), "RenameFilesystemRes")
+	proto.RegisterType((*RollbackReq)(nil), "RollbackReq")
+	proto.RegisterType((*RollbackRes)(nil), "RollbackRes")
+	proto.RegisterType((*DestroyFilesystemReq)(nil), "DestroyFilesystemReq")
+	proto.RegisterType((*DestroyFilesystemRes)(nil), "DestroyFilesystemRes")
 	proto.RegisterType((*PingReq)(nil), "PingReq")
 	proto.RegisterType((*PingRes)(nil), "PingRes")
+	proto.RegisterType((*DataconnRequestMetadata)(nil), "DataconnRequestMetadata")
 	proto.RegisterEnum("Tri", Tri_name, Tri_value)
 	proto.RegisterEnum("ReplicationGuaranteeKind", ReplicationGuaranteeKind_name, ReplicationGuaranteeKind_value)
+	proto.RegisterEnum("ChecksumMethod", ChecksumMethod_name, ChecksumMethod_value)
 	proto.RegisterEnum("FilesystemVersion_VersionType", FilesystemVersion_VersionType_name, FilesystemVersion_VersionType_value)
 }
 
@@ -1251,6 +1826,10 @@ type ReplicationClient interface {
 	DestroySnapshots(ctx context.Context, in *DestroySnapshotsReq, opts ...grpc.CallOption) (*DestroySnapshotsRes, error)
 	ReplicationCursor(ctx context.Context, in *ReplicationCursorReq, opts ...grpc.CallOption) (*ReplicationCursorRes, error)
 	SendCompleted(ctx context.Context, in *SendCompletedReq, opts ...grpc.CallOption) (*SendCompletedRes, error)
+	ChecksumVersion(ctx context.Context, in *ChecksumVersionReq, opts ...grpc.CallOption) (*ChecksumVersionRes, error)
+	RenameFilesystem(ctx context.Context, in *RenameFilesystemReq, opts ...grpc.CallOption) (*RenameFilesystemRes, error)
+	Rollback(ctx context.Context, in *RollbackReq, opts ...grpc.CallOption) (*RollbackRes, error)
+	DestroyFilesystem(ctx context.Context, in *DestroyFilesystemReq, opts ...grpc.CallOption) (*DestroyFilesystemRes, error)
 }
 
 type replicationClient struct {
@@ -1315,6 +1894,42 @@ func (c *replicationClient) SendCompleted(ctx context.Context, in *SendCompleted
 	return out, nil
 }
 
+func (c *replicationClient) ChecksumVersion(ctx context.Context, in *ChecksumVersionReq, opts ...grpc.CallOption) (*ChecksumVersionRes, error) {
+	out := new(ChecksumVersionRes)
+	err := c.cc.Invoke(ctx, "/Replication/ChecksumVersion", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicationClient) RenameFilesystem(ctx context.Context, in *RenameFilesystemReq, opts ...grpc.CallOption) (*RenameFilesystemRes, error) {
+	out := new(RenameFilesystemRes)
+	err := c.cc.Invoke(ctx, "/Replication/RenameFilesystem", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicationClient) Rollback(ctx context.Context, in *RollbackReq, opts ...grpc.CallOption) (*RollbackRes, error) {
+	out := new(RollbackRes)
+	err := c.cc.Invoke(ctx, "/Replication/Rollback", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicationClient) DestroyFilesystem(ctx context.Context, in *DestroyFilesystemReq, opts ...grpc.CallOption) (*DestroyFilesystemRes, error) {
+	out := new(DestroyFilesystemRes)
+	err := c.cc.Invoke(ctx, "/Replication/DestroyFilesystem", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ReplicationServer is the server API for Replication service.
 type ReplicationServer interface {
 	Ping(context.Context, *PingReq) (*PingRes, error)
@@ -1323,6 +1938,10 @@ type ReplicationServer interface {
 	DestroySnapshots(context.Context, *DestroySnapshotsReq) (*DestroySnapshotsRes, error)
 	ReplicationCursor(context.Context, *ReplicationCursorReq) (*ReplicationCursorRes, error)
 	SendCompleted(context.Context, *SendCompletedReq) (*SendCompletedRes, error)
+	ChecksumVersion(context.Context, *ChecksumVersionReq) (*ChecksumVersionRes, error)
+	RenameFilesystem(context.Context, *RenameFilesystemReq) (*RenameFilesystemRes, error)
+	Rollback(context.Context, *RollbackReq) (*RollbackRes, error)
+	DestroyFilesystem(context.Context, *DestroyFilesystemReq) (*DestroyFilesystemRes, error)
 }
 
 func RegisterReplicationServer(s *grpc.Server, srv ReplicationServer) {
@@ -1437,6 +2056,78 @@ func _Replication_SendCompleted_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Replication_ChecksumVersion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChecksumVersionReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).ChecksumVersion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Replication/ChecksumVersion",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).ChecksumVersion(ctx, req.(*ChecksumVersionReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replication_RenameFilesystem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenameFilesystemReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).RenameFilesystem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Replication/RenameFilesystem",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).RenameFilesystem(ctx, req.(*RenameFilesystemReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replication_Rollback_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RollbackReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).Rollback(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Replication/Rollback",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).Rollback(ctx, req.(*RollbackReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replication_DestroyFilesystem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DestroyFilesystemReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).DestroyFilesystem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Replication/DestroyFilesystem",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).DestroyFilesystem(ctx, req.(*DestroyFilesystemReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Replication_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "Replication",
 	HandlerType: (*ReplicationServer)(nil),
@@ -1465,76 +2156,118 @@ var _Replication_serviceDesc = grpc.ServiceDesc{
 			MethodName: "SendCompleted",
 			Handler:    _Replication_SendCompleted_Handler,
 		},
+		{
+			MethodName: "ChecksumVersion",
+			Handler:    _Replication_ChecksumVersion_Handler,
+		},
+		{
+			MethodName: "RenameFilesystem",
+			Handler:    _Replication_RenameFilesystem_Handler,
+		},
+		{
+			MethodName: "Rollback",
+			Handler:    _Replication_Rollback_Handler,
+		},
+		{
+			MethodName: "DestroyFilesystem",
+			Handler:    _Replication_DestroyFilesystem_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "pdu.proto",
 }
 
-func init() { proto.RegisterFile("pdu.proto", fileDescriptor_pdu_616c27178643eca4) }
-
-var fileDescriptor_pdu_616c27178643eca4 = []byte{
-	// 995 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x56, 0xcf, 0x6e, 0xdb, 0xc6,
-	0x13, 0x36, 0x25, 0xda, 0xa2, 0x46, 0xce, 0x2f, 0xf4, 0xd8, 0x09, 0x68, 0xfd, 0xd2, 0xd4, 0xd8,
-	0x14, 0x85, 0x63, 0xa0, 0x44, 0xe1, 0xb4, 0x05, 0x8a, 0x14, 0x41, 0xeb, 0xbf, 0x31, 0xd2, 0xba,
-	0xea, 0x5a, 0x0d, 0x8a, 0xdc, 0x18, 0x69, 0x2a, 0x2f, 0x4c, 0x71, 0xe9, 0x5d, 0x2a, 0x88, 0x7a,
-	0xec, 0xa1, 0x87, 0x5e, 0x7a, 0xea, 0xeb, 0xf4, 0x29, 0xfa, 0x20, 0x7d, 0x84, 0x82, 0x6b, 0x92,
-	0xa2, 0x44, 0xca, 0x70, 0x4f, 0xda, 0xf9, 0xe6, 0xdb, 0xd9, 0xd9, 0xd1, 0x37, 0xb3, 0x84, 0x76,
-	0x3c, 0x9c, 0xf8, 0xb1, 0x92, 0x89, 0x64, 0x9b, 0xb0, 0xf1, 0xad, 0xd0, 0xc9, 0x89, 0x08, 0x49,
-	0x4f, 0x75, 0x42, 0x63, 0x4e, 0xd7, 0xec, 0xa0, 0x0a, 0x6a, 0xfc, 0x04, 0x3a, 0x33, 0x40, 0x7b,
-	0xd6, 0x4e, 0x73, 0xb7, 0xb3, 0xdf, 0xf1, 0x4b, 0xa4, 0xb2, 0x9f, 0xfd, 0x6e, 0x01, 0xcc, 0x6c,
-	0x44, 0xb0, 0x7b, 0x41, 0x72, 0xe9, 0x59, 0x3b, 0xd6, 0x6e, 0x9b, 0x9b, 0x35, 0xee, 0x40, 0x87,
-	0x93, 0x9e, 0x8c, 0xa9, 0x2f, 0xaf, 0x28, 0xf2, 0x1a, 0xc6, 0x55, 0x86, 0xf0, 0x23, 0xb8, 0x77,
-	0xa6, 0x7b, 0x61, 0x30, 0xa0, 0x4b, 0x19, 0x0e, 0x49, 0x79, 0xcd, 0x1d, 0x6b, 0xd7, 0xe1, 0xf3,
-	0x60, 0x1a, 0xe7, 0x4c, 0x1f, 0x47, 0x03, 0x35, 0x8d, 0x13, 0x1a, 0x7a, 0xb6, 0xe1, 0x94, 0x21,
-	0xf6, 0x1c, 0xb6, 0xe7, 0x2f, 0xf4, 0x9a, 0x94, 0x16, 0x32, 0xd2, 0x9c, 0xae, 0xf1, 0x71, 0x39,
-	0xd1, 0x2c, 0xc1, 0x12, 0xc2, 0x5e, 0x2d, 0xdf, 0xac, 0xd1, 0x07, 0x27, 0x37, 0xb3, 0x92, 0xa0,
-	0x5f, 0x61, 0xf2, 0x82, 0xc3, 0xfe, 0xb6, 0x60, 0xa3, 0xe2, 0xc7, 0x7d, 0xb0, 0xfb, 0xd3, 0x98,
-	0xcc, 0xe1, 0xff, 0xdb, 0x7f, 0x5c, 0x8d, 0xe0, 0x67, 0xbf, 0x29, 0x8b, 0x1b, 0x6e, 0x5a, 0xd1,
-	0xf3, 0x60, 0x4c, 0x59, 0xd9, 0xcc, 0x3a, 0xc5, 0x4e, 0x27, 0x62, 0x68, 0xca, 0x64, 0x73, 0xb3,
-	0xc6, 0x47, 0xd0, 0x3e, 0x54, 0x14, 0x24, 0xd4, 0xff, 0xe9, 0xd4, 0xd4, 0xc6, 0xe6, 0x33, 0x00,
-	0xbb, 0xe0, 0x18, 0x43, 0xc8, 0xc8, 0x5b, 0x35, 0x91, 0x0a, 0x9b, 0x3d, 0x85, 0x4e, 0xe9, 0x58,
-	0x5c, 0x07, 0xe7, 0x22, 0x0a, 0x62, 0x7d, 0x29, 0x13, 0x77, 0x25, 0xb5, 0x0e, 0xa4, 0xbc, 0x1a,
-	0x07, 0xea, 0xca, 0xb5, 0xd8, 0x9f, 0x0d, 0x68, 0x5d, 0x50, 0x34, 0xbc, 0x43, 0x3d, 0xf1, 0x63,
-	0xb0, 0x4f, 0x94, 0x1c, 0x9b, 0xc4, 0xeb, 0xcb, 0x65, 0xfc, 0xc8, 0xa0, 0xd1, 0x97, 0xe6, 0x2a,
-	0xf5, 0xac, 0x46, 0x5f, 0x2e, 0x4a, 0xc8, 0xae, 0x4a, 0x88, 0x41, 0x7b, 0x26, 0x8d, 0x55, 0x53,
-	0x5f, 0xdb, 0xef, 0x2b, 0xc1, 0x67, 0x30, 0x3e, 0x84, 0xb5, 0x23, 0x35, 0xe5, 0x93, 0xc8, 0x5b,
-	0x33, 0xda, 0xc9, 0x2c, 0xfc, 0x1a, 0x36, 0x38, 0xc5, 0xa1, 0x18, 0x98, 0x7a, 0x1c, 0xca, 0xe8,
-	0x67, 0x31, 0xf2, 0x5a, 0x59, 0x42, 0x15, 0x0f, 0xaf, 0x92, 0xd9, 0x0f, 0x35, 0x11, 0xf0, 0x2b,
-	0x80, 0xb4, 0xf9, 0x68, 0x60, 0xaa, 0x6e, 0x99, 0x78, 0x8f, 0xaa, 0xf1, 0x7a, 0x05, 0x87, 0x97,
-	0xf8, 0xec, 0x0f, 0x0b, 0xfe, 0x7f, 0x0b, 0x17, 0x9f, 0x41, 0xeb, 0x2c, 0x12, 0x89, 0x08, 0xc2,
-	0x4c, 0x4e, 0xdb, 0xe5, 0xd0, 0xa7, 0x93, 0x40, 0x05, 0x51, 0x42, 0xf4, 0x4a, 0x44, 0x43, 0x9e,
-	0x33, 0xf1, 0x39, 0x74, 0xce, 0xa2, 0x81, 0xa2, 0x31, 0x45, 0x49, 0x10, 0x9a, 0xbf, 0xe6, 0xd6,
-	0x8d, 0x65, 0x36, 0xfb, 0x0c, 0x9c, 0x9e, 0x92, 0x31, 0xa9, 0x64, 0x5a, 0xa8, 0xd2, 0x2a, 0xa9,
-	0x72, 0x0b, 0x56, 0x5f, 0x07, 0xe1, 0x24, 0x97, 0xea, 0x8d, 0xc1, 0x7e, 0xb5, 0x72, 0xc9, 0x68,
-	0xdc, 0x85, 0xfb, 0x3f, 0x6a, 0x1a, 0x2e, 0x4e, 0x03, 0x87, 0x2f, 0xc2, 0xc8, 0x60, 0xfd, 0xf8,
-	0x7d, 0x4c, 0x83, 0x84, 0x86, 0x17, 0xe2, 0x17, 0x32, 0xf2, 0x68, 0xf2, 0x39, 0x0c, 0x9f, 0x02,
-	0x64, 0xf9, 0x08, 0xd2, 0x9e, 0x6d, 0xba, 0xb2, 0xed, 0xe7, 0x29, 0xf2, 0x92, 0x93, 0xbd, 0x00,
-	0x37, 0xcd, 0xe1, 0x50, 0x8e, 0xe3, 0x90, 0x12, 0x32, 0xfa, 0xdd, 0x83, 0xce, 0xf7, 0x4a, 0x8c,
-	0x44, 0x14, 0x84, 0x9c, 0xae, 0x33, 0x99, 0x3a, 0x7e, 0x26, 0x6f, 0x5e, 0x76, 0x32, 0xac, 0xec,
-	0xd7, 0xec, 0x2f, 0x0b, 0x80, 0xd3, 0x80, 0xc4, 0x3b, 0xba, 0x4b, 0x3b, 0xdc, 0xc8, 0xbc, 0x71,
-	0xab, 0xcc, 0xf7, 0xc0, 0x3d, 0x0c, 0x29, 0x50, 0xe5, 0x02, 0xdd, 0x8c, 0xc2, 0x0a, 0x5e, 0x2f,
-	0x5a, 0xfb, 0xbf, 0x88, 0x76, 0xbd, 0x94, 0xbf, 0x66, 0x23, 0xd8, 0x3c, 0x22, 0x9d, 0x28, 0x39,
-	0xcd, 0xbb, 0xff, 0x2e, 0x53, 0x13, 0x3f, 0x85, 0x76, 0xc1, 0xf7, 0x1a, 0x4b, 0x27, 0xe3, 0x8c,
-	0xc4, 0xde, 0x00, 0x2e, 0x1c, 0x94, 0x0d, 0xd8, 0xdc, 0xcc, 0x5a, 0xa5, 0x76, 0xc0, 0xe6, 0x9c,
-	0x54, 0x6c, 0xc7, 0x4a, 0x49, 0x95, 0x8b, 0xcd, 0x18, 0xec, 0xa8, 0xee, 0x12, 0xe9, 0x9b, 0xd6,
-	0x4a, 0x4b, 0x17, 0x26, 0xf9, 0xf0, 0xde, 0xf4, 0xab, 0x29, 0xf0, 0x9c, 0xc3, 0xbe, 0x80, 0xad,
-	0x72, 0xb5, 0x26, 0x4a, 0x4b, 0x75, 0x97, 0x17, 0xa4, 0x5f, 0xbb, 0x4f, 0xe3, 0x56, 0x36, 0xae,
-	0xd3, 0x1d, 0xf6, 0xcb, 0x95, 0x62, 0x60, 0x3b, 0xe7, 0x32, 0xa1, 0xf7, 0x42, 0x27, 0x37, 0x5d,
-	0xf0, 0x72, 0x85, 0x17, 0xc8, 0x81, 0x03, 0x6b, 0x37, 0xe9, 0xb0, 0x27, 0xd0, 0xea, 0x89, 0x68,
-	0x94, 0x26, 0xe0, 0x41, 0xeb, 0x3b, 0xd2, 0x3a, 0x18, 0xe5, 0x8d, 0x97, 0x9b, 0xec, 0x83, 0x9c,
-	0xa4, 0xd3, 0xd6, 0x3c, 0x1e, 0x5c, 0xca, 0xbc, 0x35, 0xd3, 0xf5, 0xde, 0x2e, 0x34, 0xfb, 0x4a,
-	0xa4, 0xc3, 0xfc, 0x48, 0x46, 0xc9, 0x61, 0xa0, 0xc8, 0x5d, 0xc1, 0x36, 0xac, 0x9e, 0x04, 0xa1,
-	0x26, 0xd7, 0x42, 0x07, 0xec, 0xbe, 0x9a, 0x90, 0xdb, 0xd8, 0xfb, 0xcd, 0x02, 0x6f, 0xd9, 0x38,
-	0xc0, 0x2d, 0x70, 0x0b, 0xe0, 0x2c, 0x7a, 0x17, 0x84, 0x62, 0xe8, 0xae, 0xe0, 0x36, 0x3c, 0x28,
-	0x50, 0xa3, 0xd0, 0xe0, 0xad, 0x08, 0x45, 0x32, 0x75, 0x2d, 0x7c, 0x02, 0x1f, 0x96, 0x36, 0x14,
-	0xa3, 0xa4, 0x74, 0x80, 0xdb, 0x98, 0x8b, 0x7a, 0x2e, 0x93, 0x4b, 0x11, 0x8d, 0xdc, 0xe6, 0xfe,
-	0x3f, 0x8d, 0x74, 0xe6, 0x17, 0x3c, 0xec, 0x82, 0x9d, 0xde, 0x10, 0x1d, 0x3f, 0xab, 0x46, 0x37,
-	0x5f, 0x69, 0xfc, 0x12, 0xee, 0xcf, 0x3f, 0xdd, 0x1a, 0xd1, 0xaf, 0x7c, 0xef, 0x74, 0xab, 0x98,
-	0xc6, 0x1e, 0x3c, 0xac, 0x7f, 0xf5, 0xb1, 0xeb, 0x2f, 0xfd, 0x96, 0xe8, 0x2e, 0xf7, 0x69, 0x7c,
-	0x01, 0xee, 0xa2, 0x06, 0x71, 0xcb, 0xaf, 0xe9, 0xad, 0x6e, 0x1d, 0xaa, 0xf1, 0x9b, 0xf9, 0xc6,
-	0x36, 0x2a, 0xc2, 0x07, 0x7e, 0x9d, 0x22, 0xbb, 0xb5, 0xb0, 0xc6, 0xcf, 0xe1, 0xde, 0xdc, 0xb8,
-	0xc2, 0x0d, 0x7f, 0x71, 0xfc, 0x75, 0x2b, 0x90, 0x3e, 0x58, 0x7d, 0xd3, 0x8c, 0x87, 0x93, 0xb7,
-	0x6b, 0xe6, 0x93, 0xf1, 0xd9, 0xbf, 0x01, 0x00, 0x00, 0xff, 0xff, 0x7e, 0xa4, 0xfb, 0xca, 0x3f,
-	0x0a, 0x00, 0x00,
+func init() { proto.RegisterFile("pdu.proto", fileDescriptor_pdu_0155b27082b2220f) }
+
+var fileDescriptor_pdu_0155b27082b2220f = []byte{
+	// 1422 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x58, 0xcf, 0x72, 0xdb, 0x36,
+	0x13, 0x37, 0x65, 0xca, 0xa2, 0x56, 0x76, 0x4c, 0xc3, 0x7f, 0x3e, 0x86, 0xc9, 0x97, 0xcf, 0x83,
+	0xaf, 0x93, 0x3a, 0x9e, 0x96, 0xcd, 0x28, 0x4d, 0x66, 0x3a, 0x69, 0x33, 0x4d, 0x6c, 0x27, 0x71,
+	0x1b, 0xbb, 0x2a, 0xac, 0x66, 0x3a, 0xe9, 0xf4, 0x80, 0x48, 0xa8, 0xc4, 0x31, 0x45, 0x28, 0x00,
+	0xe4, 0x5a, 0x7d, 0x80, 0x1e, 0xda, 0x43, 0xcf, 0x7d, 0x9c, 0xbe, 0x43, 0x0f, 0x3d, 0xf6, 0x25,
+	0x7a, 0xef, 0x10, 0x22, 0x29, 0x52, 0xa4, 0x14, 0xe7, 0x64, 0xee, 0x6f, 0x17, 0xc0, 0x62, 0xf7,
+	0xb7, 0xbb, 0x90, 0xa1, 0x3e, 0xec, 0x8e, 0xbc, 0xa1, 0xe0, 0x8a, 0xe3, 0x13, 0xd8, 0x78, 0xe1,
+	0x4b, 0xf5, 0xd4, 0x0f, 0x98, 0x1c, 0x4b, 0xc5, 0x06, 0x84, 0xbd, 0x41, 0x2e, 0x58, 0x2d, 0xda,
+	0x63, 0x67, 0xfe, 0x4f, 0xcc, 0x31, 0x76, 0x8d, 0xbd, 0x35, 0x92, 0xca, 0xe8, 0x26, 0xd4, 0xa3,
+	0xef, 0x36, 0x3f, 0x67, 0xa1, 0x53, 0xd9, 0x35, 0xf6, 0xea, 0x64, 0x0a, 0xe0, 0xbf, 0x8d, 0xe2,
+	0x7e, 0x12, 0x7d, 0x08, 0x8d, 0x29, 0x20, 0x1d, 0x63, 0x77, 0x79, 0xaf, 0xd1, 0x6c, 0x78, 0x19,
+	0xa3, 0xac, 0x1e, 0xbd, 0x07, 0x6b, 0xa7, 0xec, 0x52, 0xcd, 0x1e, 0x93, 0x07, 0xd1, 0x03, 0xd8,
+	0x69, 0x09, 0x26, 0x99, 0xb8, 0x60, 0xf2, 0xf1, 0xc1, 0x8b, 0x96, 0xe0, 0x43, 0x26, 0x94, 0xcf,
+	0xa4, 0xb3, 0xbc, 0x6b, 0xec, 0x59, 0x64, 0x8e, 0x16, 0x3d, 0x02, 0xf7, 0x2c, 0xa4, 0x43, 0xd9,
+	0xe7, 0x4a, 0x1e, 0x5d, 0x2a, 0x26, 0x42, 0x1a, 0x04, 0xe3, 0x13, 0x1a, 0xd2, 0x1e, 0xeb, 0x3a,
+	0xa6, 0x5e, 0xbb, 0xc0, 0x02, 0xff, 0x62, 0x00, 0x4c, 0xbd, 0x45, 0x08, 0xcc, 0x16, 0x55, 0x7d,
+	0x1d, 0xa7, 0x3a, 0xd1, 0xdf, 0x68, 0x17, 0x1a, 0x84, 0xc9, 0xd1, 0x20, 0xe7, 0x7e, 0x16, 0x8a,
+	0xae, 0x78, 0x2c, 0x5b, 0x01, 0xed, 0xb0, 0x3e, 0x0f, 0xba, 0x4c, 0xc4, 0x3e, 0xe7, 0xc1, 0x68,
+	0x9f, 0x63, 0x79, 0x14, 0x76, 0xc4, 0x78, 0xa8, 0x52, 0xdf, 0xb2, 0x10, 0xe6, 0x70, 0x3d, 0x1f,
+	0xee, 0x97, 0x4c, 0x48, 0x9f, 0x87, 0x32, 0x4a, 0xe3, 0xad, 0xac, 0xa3, 0xb1, 0x83, 0x59, 0xd7,
+	0x9b, 0x50, 0x3d, 0xf3, 0xc3, 0x0e, 0xd3, 0x0e, 0x36, 0x9a, 0x37, 0xbd, 0xf2, 0xad, 0xb4, 0x0d,
+	0x99, 0x98, 0xe2, 0x33, 0xb8, 0xb1, 0xc0, 0x2a, 0x62, 0xc7, 0x81, 0x60, 0x54, 0xb1, 0xf6, 0xb7,
+	0xcf, 0xf4, 0x89, 0x26, 0x99, 0x02, 0x68, 0x07, 0x56, 0x0e, 0xfd, 0x1e, 0x93, 0x4a, 0x9f, 0xb8,
+	0x4a, 0x62, 0x09, 0x0f, 0xe6, 0xdf, 0x42, 0x22, 0x0f, 0xac, 0x44, 0x8c, 0x99, 0x83, 0xbc, 0x82,
+	0x25, 0x49, 0x6d, 0x74, 0xd0, 0xc2, 0x8e, 0x60, 0x03, 0x16, 0x2a, 0x1a, 0x38, 0x95, 0x38, 0x68,
+	0x53, 0x08, 0xff, 0x69, 0xc0, 0x46, 0x61, 0x07, 0xd4, 0x04, 0xb3, 0x3d, 0x1e, 0x4e, 0x08, 0x7f,
+	0xad, 0x79, 0xab, 0x78, 0x86, 0x17, 0xff, 0x8d, 0xac, 0x88, 0xb6, 0x8d, 0x92, 0x7f, 0x4a, 0x07,
+	0x2c, 0xce, 0xb0, 0xfe, 0x8e, 0xb0, 0x67, 0x23, 0xbf, 0xab, 0x33, 0x6a, 0x12, 0xfd, 0x9d, 0x0f,
+	0x8b, 0x39, 0x1b, 0x16, 0x17, 0x2c, 0x2d, 0xf8, 0x3c, 0x74, 0xaa, 0x7a, 0xa7, 0x54, 0xc6, 0x77,
+	0xa0, 0x91, 0x39, 0x16, 0xad, 0x82, 0x95, 0x50, 0xd3, 0x5e, 0x8a, 0xa4, 0x27, 0x9c, 0x9f, 0x0f,
+	0xa8, 0x38, 0xb7, 0x0d, 0xfc, 0x47, 0x05, 0x6a, 0x67, 0x2c, 0xec, 0x5e, 0x25, 0xf5, 0xb7, 0xc1,
+	0x7c, 0x2a, 0xf8, 0x20, 0xce, 0x7c, 0x59, 0x40, 0xb5, 0x1e, 0x61, 0xa8, 0xb4, 0xb9, 0xb3, 0x3c,
+	0xd7, 0xaa, 0xd2, 0xe6, 0xb3, 0x6c, 0x37, 0x8b, 0x6c, 0xc7, 0x50, 0x9f, 0xb2, 0xb8, 0xaa, 0xe3,
+	0x6b, 0x7a, 0x6d, 0xe1, 0x93, 0x29, 0xac, 0xb9, 0x21, 0xc6, 0x64, 0x14, 0x3a, 0x2b, 0x3a, 0x63,
+	0xb1, 0x84, 0x3e, 0x87, 0x0d, 0xc2, 0x86, 0x81, 0xdf, 0xd1, 0xf1, 0x38, 0xe0, 0xe1, 0x0f, 0x7e,
+	0xcf, 0xa9, 0xc5, 0x0e, 0x15, 0x34, 0xa4, 0x68, 0x1c, 0xd5, 0x5a, 0xbe, 0x3f, 0x58, 0x93, 0x5a,
+	0xcb, 0x81, 0x5f, 0x98, 0x56, 0xd7, 0x66, 0xf8, 0xeb, 0x92, 0xd3, 0xd0, 0xa7, 0x00, 0x51, 0xb3,
+	0x64, 0x1d, 0x9d, 0x21, 0x23, 0x2e, 0x96, 0x82, 0x5d, 0x2b, 0xb5, 0x21, 0x19, 0x7b, 0xfc, 0x9b,
+	0x01, 0x37, 0x16, 0xd8, 0xa2, 0x7b, 0x50, 0x3b, 0x0e, 0x7d, 0xe5, 0xd3, 0x20, 0xa6, 0xde, 0xf5,
+	0xec, 0xd6, 0xcf, 0x46, 0x54, 0xd0, 0x50, 0x31, 0xf6, 0xa5, 0x1f, 0x76, 0x49, 0x62, 0x89, 0x1e,
+	0x16, 0x49, 0xbe, 0x70, 0x61, 0x8e, 0xff, 0x1f, 0x83, 0x15, 0x5f, 0x7c, 0x9c, 0x32, 0xd8, 0xc8,
+	0x30, 0x78, 0x0b, 0xaa, 0x2f, 0x69, 0x30, 0x4a, 0x68, 0x3d, 0x11, 0xf0, 0xef, 0x29, 0xbd, 0x24,
+	0xda, 0x83, 0xf5, 0x6f, 0x24, 0xeb, 0xce, 0x36, 0x39, 0x8b, 0xcc, 0xc2, 0x08, 0xc3, 0xea, 0xd1,
+	0xe5, 0x90, 0x75, 0x14, 0xeb, 0xea, 0x71, 0x12, 0x51, 0x69, 0x99, 0xe4, 0x30, 0x74, 0x07, 0x20,
+	0x93, 0x1d, 0x53, 0xd7, 0x78, 0xdd, 0x4b, 0x5c, 0x24, 0x19, 0x25, 0xba, 0x0b, 0x9b, 0xc9, 0xd2,
+	0x17, 0xbc, 0xe7, 0x77, 0x68, 0xa0, 0x77, 0xad, 0xea, 0x5d, 0xcb, 0x54, 0xa8, 0x09, 0x5b, 0x09,
+	0xdc, 0xea, 0x8f, 0x65, 0xba, 0x64, 0x45, 0x2f, 0x29, 0xd5, 0xa1, 0x8f, 0x66, 0x19, 0x53, 0x9b,
+	0xf5, 0x29, 0xaf, 0xc7, 0x8f, 0xc0, 0x8e, 0x42, 0x73, 0xc0, 0x07, 0xc3, 0x80, 0x29, 0xa6, 0x4b,
+	0x70, 0x1f, 0x1a, 0x5f, 0x09, 0xbf, 0xe7, 0x87, 0x34, 0x20, 0xec, 0x4d, 0x5c, 0x69, 0x96, 0x17,
+	0x57, 0x28, 0xc9, 0x2a, 0x31, 0x2a, 0xac, 0x97, 0xf8, 0x1f, 0x03, 0x80, 0xb0, 0x0e, 0xf3, 0x2f,
+	0xd8, 0x55, 0x2a, 0x7a, 0x52, 0xa9, 0x95, 0x85, 0x95, 0xba, 0x0f, 0xf6, 0x41, 0xc0, 0xa8, 0xc8,
+	0xe6, 0x6d, 0x32, 0x78, 0x0a, 0x78, 0x79, 0xdd, 0x99, 0xef, 0x52, 0x77, 0x85, 0x28, 0x56, 0x17,
+	0x47, 0x31, 0x2e, 0xc1, 0xd5, 0xcc, 0xb5, 0x25, 0xee, 0xc1, 0xe6, 0x21, 0x93, 0x4a, 0xf0, 0x71,
+	0x3a, 0x92, 0xaf, 0x12, 0x8d, 0xbb, 0x50, 0x4f, 0xed, 0x9d, 0xca, 0xdc, 0xa9, 0x31, 0x35, 0xc2,
+	0xaf, 0x00, 0xcd, 0x1c, 0x14, 0x0f, 0x9f, 0x44, 0x8c, 0x0b, 0xbf, 0x74, 0xf8, 0x24, 0x36, 0x51,
+	0xe9, 0x1c, 0x09, 0xc1, 0x45, 0x52, 0x3a, 0x5a, 0xc0, 0x87, 0x65, 0x97, 0x88, 0x9e, 0x45, 0xb5,
+	0x28, 0xe2, 0x81, 0x4a, 0x06, 0xdb, 0xa6, 0x57, 0x74, 0x81, 0x24, 0x36, 0xf8, 0x01, 0x6c, 0x65,
+	0x83, 0x3c, 0x12, 0x92, 0x8b, 0x2b, 0xc4, 0x02, 0xb7, 0x4b, 0xd7, 0x49, 0xb4, 0x15, 0x0f, 0x2a,
+	0x3d, 0xa6, 0x9f, 0x2f, 0xa5, 0xa3, 0xca, 0x3a, 0xe5, 0x8a, 0x5d, 0xfa, 0xf1, 0x94, 0xb6, 0x9e,
+	0x2f, 0x91, 0x14, 0x79, 0x62, 0xc1, 0xca, 0xc4, 0x1d, 0xfc, 0xab, 0x01, 0xe8, 0xa0, 0xcf, 0x3a,
+	0xe7, 0x72, 0x94, 0xc6, 0xe1, 0x0a, 0x89, 0xf9, 0x00, 0x6a, 0xb1, 0xf5, 0x02, 0xae, 0x26, 0x26,
+	0xe8, 0x7d, 0x58, 0x39, 0x61, 0xaa, 0xcf, 0x27, 0xd3, 0xf4, 0x5a, 0x73, 0xdd, 0x4b, 0x8e, 0x9c,
+	0xc0, 0x24, 0x56, 0xe3, 0xbb, 0x25, 0xce, 0x48, 0x3d, 0x58, 0x63, 0x34, 0x76, 0x25, 0x95, 0xf1,
+	0x77, 0xb0, 0x49, 0x58, 0x48, 0x07, 0x2c, 0xff, 0xf4, 0x7d, 0x9b, 0xff, 0xfa, 0x6d, 0xfa, 0x63,
+	0xc6, 0x24, 0x7d, 0x9b, 0x66, 0x40, 0xbc, 0x5d, 0xb6, 0xb9, 0xc4, 0xdf, 0x43, 0x83, 0xf0, 0x20,
+	0x78, 0x4d, 0x3b, 0xe7, 0x57, 0x39, 0x2b, 0x4b, 0xbe, 0xca, 0xdb, 0xc9, 0x87, 0xd7, 0xb2, 0xdb,
+	0x6b, 0xbe, 0xc4, 0x74, 0x7a, 0xa7, 0x2b, 0xe2, 0x9d, 0xd2, 0x75, 0x12, 0xdf, 0x81, 0x5a, 0xcb,
+	0x0f, 0x7b, 0xd1, 0x16, 0x0e, 0xd4, 0x4e, 0x98, 0x94, 0xb4, 0x97, 0x0c, 0x8e, 0x44, 0x8c, 0x6b,
+	0xf8, 0xbf, 0x89, 0xa9, 0x8c, 0x06, 0xcc, 0x51, 0xa7, 0xcf, 0x93, 0x01, 0x13, 0x7d, 0xe3, 0xcf,
+	0xe0, 0x3f, 0x87, 0x54, 0xd1, 0x0e, 0x0f, 0x23, 0xce, 0x8c, 0x98, 0x54, 0x27, 0x4c, 0xd1, 0x2e,
+	0x55, 0x34, 0x9a, 0x17, 0xc7, 0xe1, 0x05, 0x9f, 0x70, 0xf5, 0xf8, 0xd0, 0xe9, 0xea, 0x65, 0x39,
+	0x6c, 0x7f, 0x0f, 0x96, 0xdb, 0xc2, 0x8f, 0x5e, 0x3f, 0x87, 0x3c, 0x54, 0x07, 0x54, 0x30, 0x7b,
+	0x09, 0xd5, 0xa1, 0xfa, 0x94, 0x06, 0x92, 0xd9, 0x06, 0xb2, 0xc0, 0x6c, 0x8b, 0x11, 0xb3, 0x2b,
+	0xfb, 0x3f, 0x1b, 0xe0, 0xcc, 0x9b, 0x89, 0x68, 0x0b, 0xec, 0x14, 0x38, 0x0e, 0x2f, 0x68, 0xe0,
+	0x77, 0xed, 0x25, 0x74, 0x1d, 0xb6, 0x53, 0x54, 0xf7, 0x43, 0xfa, 0xda, 0x0f, 0x7c, 0x35, 0xb6,
+	0x0d, 0xf4, 0x7f, 0xf8, 0x5f, 0x66, 0x41, 0x3a, 0x4f, 0x33, 0x07, 0xd8, 0x95, 0xdc, 0xae, 0xa7,
+	0x5c, 0xf5, 0xfd, 0xb0, 0x67, 0x2f, 0xef, 0xfb, 0x70, 0x2d, 0xcf, 0xdc, 0xe8, 0x9c, 0x3c, 0x32,
+	0x75, 0xe1, 0x26, 0x38, 0x79, 0xd5, 0x99, 0x12, 0x8c, 0x0e, 0xa2, 0xd1, 0x64, 0x1b, 0xe8, 0x16,
+	0xb8, 0xa5, 0xda, 0xe7, 0x8f, 0x9b, 0xf7, 0x1f, 0xd8, 0x95, 0xe6, 0x5f, 0x26, 0x34, 0x32, 0x2e,
+	0x21, 0x17, 0xcc, 0x28, 0x17, 0xc8, 0xf2, 0xe2, 0xec, 0xb9, 0xc9, 0x97, 0x44, 0x9f, 0xc0, 0x7a,
+	0xfe, 0xe1, 0x2d, 0x11, 0xf2, 0x0a, 0xbf, 0x07, 0xdd, 0x22, 0x26, 0x51, 0x0b, 0x76, 0xca, 0xdf,
+	0xec, 0xc8, 0xf5, 0xe6, 0xfe, 0x24, 0x71, 0xe7, 0xeb, 0xa2, 0x1f, 0x66, 0xf6, 0x6c, 0x97, 0x44,
+	0x5b, 0x5e, 0x49, 0xf7, 0x77, 0xcb, 0x50, 0x89, 0x1e, 0xc3, 0x46, 0xa1, 0xcf, 0xa1, 0x6d, 0xaf,
+	0xac, 0x67, 0xba, 0xa5, 0xb0, 0x44, 0xf7, 0x61, 0x2d, 0x37, 0x87, 0xd1, 0x86, 0x37, 0x3b, 0xd7,
+	0xdd, 0x02, 0x24, 0xd1, 0x43, 0x58, 0x9f, 0xe9, 0x3e, 0x68, 0xd3, 0x2b, 0x36, 0x47, 0xb7, 0x04,
+	0xd4, 0xd7, 0x9e, 0xed, 0x15, 0x68, 0xcb, 0x2b, 0xe9, 0x4d, 0x6e, 0x19, 0x2a, 0xd1, 0x6d, 0xb0,
+	0x92, 0xaa, 0x47, 0xab, 0x5e, 0xa6, 0xbf, 0xb8, 0x59, 0x49, 0x87, 0xa7, 0x50, 0xd6, 0x68, 0xdb,
+	0x2b, 0x6b, 0x11, 0x6e, 0x29, 0x2c, 0x9f, 0x54, 0x5f, 0x2d, 0x0f, 0xbb, 0xa3, 0xd7, 0x2b, 0xfa,
+	0x5f, 0x07, 0xf7, 0xfe, 0x1d, 0x00, 0xc2, 0x71, 0xd8, 0xcd, 0x47, 0x10, 0x00, 0x00,
 }
@@ -0,0 +1,65 @@
+package pdu
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+)
+
+// FilesystemVersionsDigest returns a digest of the versions in vs with a createtxg <= maxCreateTXG.
+// The digest does not depend on the order of vs.
+func FilesystemVersionsDigest(vs []*FilesystemVersion, maxCreateTXG uint64) []byte {
+	covered := make([]*FilesystemVersion, 0, len(vs))
+	for _, v := range vs {
+		if v.GetCreateTXG() <= maxCreateTXG {
+			covered = append(covered, v)
+		}
+	}
+	sort.Slice(covered, func(i, j int) bool {
+		a, b := covered[i], covered[j]
+		if a.GetCreateTXG() != b.GetCreateTXG() {
+			return a.GetCreateTXG() < b.GetCreateTXG()
+		}
+		if a.GetType() != b.GetType() {
+			return a.GetType() < b.GetType()
+		}
+		return a.GetName() < b.GetName()
+	})
+	h := sha256.New()
+	for _, v := range covered {
+		fmt.Fprintf(h, "%d\x00%s\x00%d\x00%d\x00%s\n", v.GetType(), v.GetName(), v.GetGuid(), v.GetCreateTXG(), v.GetCreation())
+	}
+	return h.Sum(nil)
+}
+
+// NewListFilesystemVersionsSince returns the ListFilesystemVersionsReq.Since
+// for a client that knows the versions vs, or nil if vs is empty.
+func NewListFilesystemVersionsSince(vs []*FilesystemVersion) *ListFilesystemVersionsSince {
+	if len(vs) == 0 {
+		return nil
+	}
+	var max uint64
+	for _, v := range vs {
+		if v.GetCreateTXG() > max {
+			max = v.GetCreateTXG()
+		}
+	}
+	return &ListFilesystemVersionsSince{CreateTXG: max, Digest: FilesystemVersionsDigest(vs, max)}
+}
+
+// NewListFilesystemVersionsRes returns the response to a ListFilesystemVersionsReq
+// with the given Since for a filesystem whose versions are vs.
+// The response is incremental if the versions known to the client are unchanged.
+func NewListFilesystemVersionsRes(vs []*FilesystemVersion, since *ListFilesystemVersionsSince) *ListFilesystemVersionsRes {
+	if since == nil || !bytes.Equal(since.GetDigest(), FilesystemVersionsDigest(vs, since.GetCreateTXG())) {
+		return &ListFilesystemVersionsRes{Versions: vs}
+	}
+	newer := make([]*FilesystemVersion, 0)
+	for _, v := range vs {
+		if v.GetCreateTXG() > since.GetCreateTXG() {
+			newer = append(newer, v)
+		}
+	}
+	return &ListFilesystemVersionsRes{Versions: newer, Incremental: true}
+}
@@ -4,7 +4,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFilesystemVersion_RelName(t *testing.T) {
@@ -67,3 +69,75 @@ func TestFilesystemVersion_ZFSFilesystemVersion(t *testing.T) {
 	assert.Error(t, err)
 
 }
+
+func TestDataconnRequestMetadataIsCompatible(t *testing.T) {
+	req := &SendReq{Filesystem: "pool/foo", DryRun: true}
+	reqBytes, err := proto.Marshal(req)
+	require.NoError(t, err)
+	metaBytes, err := proto.Marshal(&DataconnRequestMetadata{InvocationID: "some-id"})
+	require.NoError(t, err)
+	combined := append(reqBytes, metaBytes...)
+
+	var meta DataconnRequestMetadata
+	require.NoError(t, proto.Unmarshal(combined, &meta))
+	assert.Equal(t, "some-id", meta.InvocationID)
+
+	// a peer that doesn't know about DataconnRequestMetadata only sees the request
+	var decoded SendReq
+	require.NoError(t, proto.Unmarshal(combined, &decoded))
+	assert.Equal(t, req.Filesystem, decoded.Filesystem)
+	assert.Equal(t, req.DryRun, decoded.DryRun)
+
+	// requests without metadata
+	require.NoError(t, proto.Unmarshal(reqBytes, &meta))
+	assert.Equal(t, "", meta.InvocationID)
+}
+
+func TestNewListFilesystemVersionsRes(t *testing.T) {
+	creat := FilesystemVersionCreation(time.Now())
+	vs := []*FilesystemVersion{
+		{Type: FilesystemVersion_Snapshot, Name: "a", Guid: 1, CreateTXG: 10, Creation: creat},
+		{Type: FilesystemVersion_Bookmark, Name: "a", Guid: 1, CreateTXG: 10, Creation: creat},
+		{Type: FilesystemVersion_Snapshot, Name: "b", Guid: 2, CreateTXG: 20, Creation: creat},
+	}
+
+	assert.Nil(t, NewListFilesystemVersionsSince(nil))
+	since := NewListFilesystemVersionsSince(vs[:2])
+	require.NotNil(t, since)
+	assert.Equal(t, uint64(10), since.GetCreateTXG())
+	assert.Equal(t, since.GetDigest(), FilesystemVersionsDigest([]*FilesystemVersion{vs[1], vs[0]}, 10), "digest must not depend on order")
+
+	res := NewListFilesystemVersionsRes(vs, since)
+	assert.True(t, res.GetIncremental())
+	assert.Equal(t, vs[2:], res.GetVersions())
+
+	res = NewListFilesystemVersionsRes(vs, nil)
+	assert.False(t, res.GetIncremental())
+	assert.Equal(t, vs, res.GetVersions())
+
+	// a bookmark created from a known snapshot shares its createtxg
+	res = NewListFilesystemVersionsRes(vs, NewListFilesystemVersionsSince(vs[:1]))
+	assert.False(t, res.GetIncremental())
+	assert.Equal(t, vs, res.GetVersions())
+
+	req := &ListFilesystemVersionsReq{Filesystem: "pool/a", Since: &ListFilesystemVersionsSince{CreateTXG: 10, Digest: []byte{1}}}
+	assert.Error(t, req.Validate())
+	req.Since = since
+	assert.NoError(t, req.Validate())
+}
+
+func TestTombstoneName(t *testing.T) {
+	deleted := time.Date(2020, 3, 4, 4, 6, 7, 0, time.UTC)
+	name := TombstoneName("pool/data", deleted.In(time.FixedZone("", 3600)))
+	assert.Equal(t, "pool/data_deleted_20200304_040607", name)
+
+	fs, parsed, ok := ParseTombstoneName(name)
+	require.True(t, ok)
+	assert.Equal(t, "pool/data", fs)
+	assert.True(t, deleted.Equal(parsed))
+
+	for _, name := range []string{"pool/data", "pool/data_deleted_", "pool/data_deleted_20200304", "pool/data_deleted_20201304_040607", "pool/data_deleted_20200304_040607/child"} {
+		_, _, ok := ParseTombstoneName(name)
+		assert.False(t, ok, name)
+	}
+}
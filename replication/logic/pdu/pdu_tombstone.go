@@ -0,0 +1,33 @@
+package pdu
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// A tombstone is a receiver filesystem whose sender filesystem was destroyed.
+// The planner renames such filesystems to TombstoneName, see DestroyFilesystemReq.
+
+const tombstoneTimeFormat = "20060102_150405"
+
+var tombstoneRE = regexp.MustCompile(`^(.+)_deleted_([0-9]{8}_[0-9]{6})$`)
+
+// TombstoneName returns the name of the tombstone of fs whose sender filesystem was found destroyed at deleted.
+func TombstoneName(fs string, deleted time.Time) string {
+	return fmt.Sprintf("%s_deleted_%s", fs, deleted.UTC().Format(tombstoneTimeFormat))
+}
+
+// ParseTombstoneName returns the original name of the tombstone and when it was created.
+// ok is false if name is not a tombstone name.
+func ParseTombstoneName(name string) (fs string, deleted time.Time, ok bool) {
+	m := tombstoneRE.FindStringSubmatch(name)
+	if m == nil {
+		return "", time.Time{}, false
+	}
+	deleted, err := time.ParseInLocation(tombstoneTimeFormat, m[2], time.UTC)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return m[1], deleted, true
+}
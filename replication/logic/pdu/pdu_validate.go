@@ -0,0 +1,176 @@
+package pdu
+
+import (
+	"crypto/sha256"
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// Validator is implemented by all request messages.
+//
+// Request messages arrive from untrusted RPC peers.
+// Servers must call Validate before handling a request so that malformed
+// requests are rejected before their fields are used to construct zfs commands.
+type Validator interface {
+	Validate() error
+}
+
+func validateFilesystem(field, fs string) error {
+	if fs == "" {
+		return errors.Errorf("`%s` must not be empty", field)
+	}
+	if _, err := zfs.NewDatasetPath(fs); err != nil {
+		return errors.Wrapf(err, "`%s` invalid", field)
+	}
+	return nil
+}
+
+// Validate checks that v has a valid type, name and creation time.
+func (v *FilesystemVersion) Validate() error {
+	if v == nil {
+		return errors.New("must not be nil")
+	}
+	if _, ok := FilesystemVersion_VersionType_name[int32(v.Type)]; !ok {
+		return errors.Errorf("invalid version type %d", v.Type)
+	}
+	if err := zfs.ComponentNamecheck(v.Name); err != nil {
+		return errors.Wrap(err, "invalid name")
+	}
+	if _, err := v.CreationAsTime(); err != nil {
+		return errors.Wrap(err, "invalid creation time")
+	}
+	return nil
+}
+
+func validateVersion(field string, v *FilesystemVersion, mustBeSnapshot bool) error {
+	if err := v.Validate(); err != nil {
+		return errors.Wrapf(err, "`%s` invalid", field)
+	}
+	if mustBeSnapshot && v.Type != FilesystemVersion_Snapshot {
+		return errors.Errorf("`%s` must be a snapshot", field)
+	}
+	return nil
+}
+
+func (c *ReplicationConfig) Validate() error {
+	if c == nil || c.Protection == nil {
+		return nil // the receiver rejects a missing protection if it needs one
+	}
+	if _, ok := ReplicationGuaranteeKind_name[int32(c.Protection.Initial)]; !ok {
+		return errors.Errorf("invalid initial replication guarantee kind %d", c.Protection.Initial)
+	}
+	if _, ok := ReplicationGuaranteeKind_name[int32(c.Protection.Incremental)]; !ok {
+		return errors.Errorf("invalid incremental replication guarantee kind %d", c.Protection.Incremental)
+	}
+	return nil
+}
+
+// e.g. 1-bf31b879a-b8-789c6360...
+var resumeTokenRegexp = regexp.MustCompile(`^[0-9]+-[0-9a-f]+-[0-9a-f]+-[0-9a-f]+$`)
+
+func (r *PingReq) Validate() error { return nil }
+
+func (r *ListFilesystemReq) Validate() error {
+	if r.GetPageToken() != "" {
+		return validateFilesystem("PageToken", r.GetPageToken())
+	}
+	return nil
+}
+
+func (r *ListFilesystemVersionsReq) Validate() error {
+	if err := validateFilesystem("Filesystem", r.GetFilesystem()); err != nil {
+		return err
+	}
+	if since := r.GetSince(); since != nil && len(since.GetDigest()) != sha256.Size {
+		return errors.Errorf("`Since.Digest` must have %d bytes, got %d", sha256.Size, len(since.GetDigest()))
+	}
+	return nil
+}
+
+func (r *SendReq) Validate() error {
+	if err := validateFilesystem("Filesystem", r.GetFilesystem()); err != nil {
+		return err
+	}
+	if r.GetFrom() != nil {
+		if err := validateVersion("From", r.GetFrom(), false); err != nil {
+			return err
+		}
+	}
+	if err := validateVersion("To", r.GetTo(), false); err != nil {
+		return err
+	}
+	if r.GetResumeToken() != "" && !resumeTokenRegexp.MatchString(r.GetResumeToken()) {
+		return errors.New("`ResumeToken` is not a resume token")
+	}
+	if _, ok := Tri_name[int32(r.GetEncrypted())]; !ok {
+		return errors.Errorf("invalid `Encrypted` value %d", r.GetEncrypted())
+	}
+	return errors.Wrap(r.GetReplicationConfig().Validate(), "`ReplicationConfig` invalid")
+}
+
+func (r *SendCompletedReq) Validate() error {
+	if r.GetOriginalReq() == nil {
+		return errors.New("`OriginalReq` must not be nil")
+	}
+	return errors.Wrap(r.GetOriginalReq().Validate(), "`OriginalReq` invalid")
+}
+
+func (r *ReceiveReq) Validate() error {
+	if err := validateFilesystem("Filesystem", r.GetFilesystem()); err != nil {
+		return err
+	}
+	if err := validateVersion("To", r.GetTo(), true); err != nil {
+		return err
+	}
+	return errors.Wrap(r.GetReplicationConfig().Validate(), "`ReplicationConfig` invalid")
+}
+
+func (r *DestroySnapshotsReq) Validate() error {
+	if err := validateFilesystem("Filesystem", r.GetFilesystem()); err != nil {
+		return err
+	}
+	for i, v := range r.GetSnapshots() {
+		if err := validateVersion("Snapshots", v, false); err != nil {
+			return errors.Wrapf(err, "version %d", i)
+		}
+	}
+	return nil
+}
+
+func (r *ReplicationCursorReq) Validate() error {
+	return validateFilesystem("Filesystem", r.GetFilesystem())
+}
+
+func (r *ChecksumVersionReq) Validate() error {
+	if err := validateFilesystem("Filesystem", r.GetFilesystem()); err != nil {
+		return err
+	}
+	if err := validateVersion("Version", r.GetVersion(), true); err != nil {
+		return err
+	}
+	if _, ok := ChecksumMethod_name[int32(r.GetMethod())]; !ok || r.GetMethod() == ChecksumMethod_ChecksumMethodInvalid {
+		return errors.Errorf("invalid `Method` %d", r.GetMethod())
+	}
+	return nil
+}
+
+func (r *RenameFilesystemReq) Validate() error {
+	if err := validateFilesystem("Filesystem", r.GetFilesystem()); err != nil {
+		return err
+	}
+	return validateFilesystem("NewFilesystem", r.GetNewFilesystem())
+}
+
+func (r *RollbackReq) Validate() error {
+	if err := validateFilesystem("Filesystem", r.GetFilesystem()); err != nil {
+		return err
+	}
+	return validateVersion("Snapshot", r.GetSnapshot(), true)
+}
+
+func (r *DestroyFilesystemReq) Validate() error {
+	return validateFilesystem("Filesystem", r.GetFilesystem())
+}
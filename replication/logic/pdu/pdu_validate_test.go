@@ -0,0 +1,131 @@
+package pdu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestValidate(t *testing.T) {
+	creat := FilesystemVersionCreation(time.Now())
+	snap := &FilesystemVersion{Type: FilesystemVersion_Snapshot, Name: "foo", Guid: 1, Creation: creat}
+	book := &FilesystemVersion{Type: FilesystemVersion_Bookmark, Name: "foo", Guid: 1, Creation: creat}
+
+	tcs := []struct {
+		name string
+		req  Validator
+		ok   bool
+	}{
+		{"ping", &PingReq{Message: "foo"}, true},
+		{"list", &ListFilesystemReq{}, true},
+		{"listversions", &ListFilesystemVersionsReq{Filesystem: "pool/foo"}, true},
+		{"listversions_empty_fs", &ListFilesystemVersionsReq{}, false},
+		{"listversions_snapshot_fs", &ListFilesystemVersionsReq{Filesystem: "pool/foo@bar"}, false},
+		{"send_full", &SendReq{Filesystem: "pool/foo", To: snap}, true},
+		{"send_incremental", &SendReq{Filesystem: "pool/foo", From: book, To: snap}, true},
+		{"send_no_to", &SendReq{Filesystem: "pool/foo"}, false},
+		{"send_resume_token", &SendReq{Filesystem: "pool/foo", To: snap, ResumeToken: "1-bf31b879a-b8-789c6360"}, true},
+		{"send_resume_token_option", &SendReq{Filesystem: "pool/foo", To: snap, ResumeToken: "-v"}, false},
+		{"send_invalid_tri", &SendReq{Filesystem: "pool/foo", To: snap, Encrypted: 23}, false},
+		{"send_invalid_guarantee", &SendReq{Filesystem: "pool/foo", To: snap, ReplicationConfig: &ReplicationConfig{
+			Protection: &ReplicationConfigProtection{Initial: 23},
+		}}, false},
+		{"send_invalid_version_type", &SendReq{Filesystem: "pool/foo", To: &FilesystemVersion{Type: 23, Name: "foo", Creation: creat}}, false},
+		{"send_invalid_version_name", &SendReq{Filesystem: "pool/foo", To: &FilesystemVersion{Name: "foo@bar", Creation: creat}}, false},
+		{"send_invalid_version_creation", &SendReq{Filesystem: "pool/foo", To: &FilesystemVersion{Name: "foo"}}, false},
+		{"sendcompleted", &SendCompletedReq{OriginalReq: &SendReq{Filesystem: "pool/foo", To: snap}}, true},
+		{"sendcompleted_no_original", &SendCompletedReq{}, false},
+		{"recv", &ReceiveReq{Filesystem: "pool/foo", To: snap}, true},
+		{"recv_bookmark", &ReceiveReq{Filesystem: "pool/foo", To: book}, false},
+		{"destroy", &DestroySnapshotsReq{Filesystem: "pool/foo", Snapshots: []*FilesystemVersion{snap, book}}, true},
+		{"destroy_nil_version", &DestroySnapshotsReq{Filesystem: "pool/foo", Snapshots: []*FilesystemVersion{snap, nil}}, false},
+		{"cursor", &ReplicationCursorReq{Filesystem: "pool/foo"}, true},
+		{"checksum", &ChecksumVersionReq{Filesystem: "pool/foo", Version: snap, Method: ChecksumMethod_ChecksumMethodStreamSize}, true},
+		{"checksum_invalid_method", &ChecksumVersionReq{Filesystem: "pool/foo", Version: snap}, false},
+		{"rename", &RenameFilesystemReq{Filesystem: "pool/foo", NewFilesystem: "pool/bar"}, true},
+		{"rename_empty_new", &RenameFilesystemReq{Filesystem: "pool/foo"}, false},
+		{"rollback", &RollbackReq{Filesystem: "pool/foo", Snapshot: snap}, true},
+		{"rollback_bookmark", &RollbackReq{Filesystem: "pool/foo", Snapshot: book}, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.req.Validate()
+			if tc.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func FuzzValidate(f *testing.F) {
+	creat := FilesystemVersionCreation(time.Unix(1234, 0))
+	snap := &FilesystemVersion{Type: FilesystemVersion_Snapshot, Name: "foo", Guid: 1, Creation: creat}
+	seeds := []proto.Message{
+		&SendReq{Filesystem: "pool/foo", From: snap, To: snap, ResumeToken: "1-a-b-c"},
+		&ReceiveReq{Filesystem: "pool/foo", To: snap},
+		&DestroySnapshotsReq{Filesystem: "pool/foo", Snapshots: []*FilesystemVersion{snap}},
+		&ChecksumVersionReq{Filesystem: "pool/foo", Version: snap, Method: ChecksumMethod_ChecksumMethodStreamSHA256},
+		&RenameFilesystemReq{Filesystem: "pool/foo", NewFilesystem: "pool/bar"},
+		&RollbackReq{Filesystem: "pool/foo", Snapshot: snap},
+	}
+	for _, seed := range seeds {
+		b, err := proto.Marshal(seed)
+		require.NoError(f, err)
+		f.Add(b)
+	}
+
+	checkFS := func(t *testing.T, fs string) {
+		_, err := zfs.NewDatasetPath(fs)
+		require.NoError(t, err)
+	}
+	checkVersion := func(t *testing.T, v *FilesystemVersion) {
+		_, err := v.ZFSFilesystemVersion()
+		require.NoError(t, err)
+		require.NotEmpty(t, v.RelName())
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var send SendReq
+		if proto.Unmarshal(b, &send) == nil && send.Validate() == nil {
+			checkFS(t, send.Filesystem)
+			checkVersion(t, send.To)
+			if send.From != nil {
+				checkVersion(t, send.From)
+			}
+		}
+		var recv ReceiveReq
+		if proto.Unmarshal(b, &recv) == nil && recv.Validate() == nil {
+			checkFS(t, recv.Filesystem)
+			checkVersion(t, recv.To)
+		}
+		var destroy DestroySnapshotsReq
+		if proto.Unmarshal(b, &destroy) == nil && destroy.Validate() == nil {
+			checkFS(t, destroy.Filesystem)
+			for _, v := range destroy.Snapshots {
+				checkVersion(t, v)
+			}
+		}
+		var checksum ChecksumVersionReq
+		if proto.Unmarshal(b, &checksum) == nil && checksum.Validate() == nil {
+			checkFS(t, checksum.Filesystem)
+			checkVersion(t, checksum.Version)
+		}
+		var rename RenameFilesystemReq
+		if proto.Unmarshal(b, &rename) == nil && rename.Validate() == nil {
+			checkFS(t, rename.Filesystem)
+			checkFS(t, rename.NewFilesystem)
+		}
+		var rollback RollbackReq
+		if proto.Unmarshal(b, &rollback) == nil && rollback.Validate() == nil {
+			checkFS(t, rollback.Filesystem)
+			checkVersion(t, rollback.Snapshot)
+		}
+	})
+}
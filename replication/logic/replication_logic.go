@@ -5,11 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/zrepl/zrepl/daemon/job/guardrails"
+	"github.com/zrepl/zrepl/daemon/job/pause"
 	"github.com/zrepl/zrepl/daemon/logging/trace"
 
 	"github.com/zrepl/zrepl/logger"
@@ -51,6 +56,9 @@ type Receiver interface {
 	// Receive sends r and sendStream (the latter containing a ZFS send stream)
 	// to the parent github.com/zrepl/zrepl/replication.Endpoint.
 	Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.ReadCloser) (*pdu.ReceiveRes, error)
+	RenameFilesystem(ctx context.Context, req *pdu.RenameFilesystemReq) (*pdu.RenameFilesystemRes, error)
+	Rollback(ctx context.Context, req *pdu.RollbackReq) (*pdu.RollbackRes, error)
+	DestroyFilesystem(ctx context.Context, req *pdu.DestroyFilesystemReq) (*pdu.DestroyFilesystemRes, error)
 }
 
 type Planner struct {
@@ -60,6 +68,21 @@ type Planner struct {
 
 	promSecsPerState    *prometheus.HistogramVec // labels: state
 	promBytesReplicated *prometheus.CounterVec   // labels: filesystem
+
+	orphansMtx sync.Mutex
+	orphans    []*report.OrphanedFilesystemReport // as of the last successful doPlanning
+
+	senderExternallyManagedMtx sync.Mutex
+	senderExternallyManaged    bool // as advertised in the sender's last filesystem listing
+}
+
+// SenderSnapshotsExternallyManaged returns true if PlannerPolicy.SenderSnapshotsExternallyManaged is set
+// or the sender advertised externally managed snapshots (pdu.ListFilesystemRes.SnapshotsExternallyManaged)
+// when its filesystems were last listed.
+func (p *Planner) SenderSnapshotsExternallyManaged() bool {
+	p.senderExternallyManagedMtx.Lock()
+	defer p.senderExternallyManagedMtx.Unlock()
+	return p.policy.SenderSnapshotsExternallyManaged || p.senderExternallyManaged
 }
 
 func (p *Planner) Plan(ctx context.Context) ([]driver.FS, error) {
@@ -124,6 +147,15 @@ type Filesystem struct {
 	promBytesReplicated  prometheus.Counter // compat
 
 	sizeEstimateRequestSem *semaphore.S
+
+	// if non-nil, the initial replication of the filesystem is refused with this error
+	fullSendRefused error
+
+	// whether the receiver preserves the sender's ACL properties, see pdu.SendReq.ACLProperties
+	aclProperties bool
+
+	// see OrderKey, set by Planner.doPlanning or Filesystem.doPlanning depending on policy.Ordering
+	orderKey int64
 }
 
 func (f *Filesystem) EqualToPreviousAttempt(other driver.FS) bool {
@@ -147,7 +179,103 @@ func (f *Filesystem) PlanFS(ctx context.Context) ([]driver.Step, error) {
 	return dsteps, nil
 }
 func (f *Filesystem) ReportInfo() *report.FilesystemInfo {
-	return &report.FilesystemInfo{Name: f.Path} // FIXME compat name
+	return &report.FilesystemInfo{Name: f.Path, IsNew: f.isNew()} // FIXME compat name
+}
+
+// A filesystem is new if it has not been replicated to the receiver yet.
+// Placeholders on the receiver do not count since they do not hold any replicated data.
+func (f *Filesystem) isNew() bool {
+	return f.receiverFS == nil || f.receiverFS.GetIsPlaceholder()
+}
+
+var _ driver.WeightedFS = (*Filesystem)(nil)
+
+func (f *Filesystem) Weight() int {
+	if f.policy.Weights == nil {
+		return 1
+	}
+	return f.policy.Weights(f.Path)
+}
+
+var _ driver.OrderedFS = (*Filesystem)(nil)
+
+func (f *Filesystem) OrderKey() int64 { return f.orderKey }
+
+var _ driver.VerifiableFS = (*Filesystem)(nil)
+
+func (f *Filesystem) Verify(ctx context.Context, steps []driver.Step) (*report.FilesystemVerificationReport, error) {
+	if !f.policy.Verify {
+		return nil, nil
+	}
+	intended := make([]*pdu.FilesystemVersion, len(steps))
+	for i := range steps {
+		intended[i] = steps[i].(*Step).to
+	}
+	return f.doVerify(ctx, intended)
+}
+
+// re-list versions on both sides and check that the receiver has every version in intended
+func (f *Filesystem) doVerify(ctx context.Context, intended []*pdu.FilesystemVersion) (*report.FilesystemVerificationReport, error) {
+
+	log := getLogger(ctx).WithField("filesystem", f.Path)
+
+	log.Debug("verify replicated versions")
+
+	sfsvsres, err := f.sender.ListFilesystemVersions(ctx, &pdu.ListFilesystemVersionsReq{Filesystem: f.Path})
+	if err != nil {
+		log.WithError(err).Error("cannot get sender filesystem versions for verification")
+		return nil, err
+	}
+	rfsvsres, err := f.receiver.ListFilesystemVersions(ctx, &pdu.ListFilesystemVersionsReq{Filesystem: f.Path})
+	if err != nil {
+		log.WithError(err).Error("cannot get receiver filesystem versions for verification")
+		return nil, err
+	}
+
+	missing := versionsMissingIn(intended, rfsvsres.GetVersions())
+	rep := &report.FilesystemVerificationReport{
+		Missing: make([]string, len(missing)),
+	}
+	for i, v := range missing {
+		rep.Missing[i] = v.RelName()
+	}
+	if len(missing) == 0 {
+		log.WithField("versions", len(intended)).Debug("verification successful")
+		return rep, nil
+	}
+
+	// a version that is gone on both sides was most likely destroyed on the sender concurrently
+	goneOnSender := versionsMissingIn(missing, sfsvsres.GetVersions())
+	log.WithField("missing", rep.Missing).
+		WithField("gone_on_sender", len(goneOnSender)).
+		Error("verification failed: receiver does not have all replicated versions")
+	return rep, fmt.Errorf("verification failed: receiver does not have replicated version(s) %s", strings.Join(rep.Missing, ", "))
+}
+
+// returns the versions in vs whose GUID does not appear in in
+func versionsMissingIn(vs, in []*pdu.FilesystemVersion) []*pdu.FilesystemVersion {
+	guids := make(map[uint64]bool, len(in))
+	for _, v := range in {
+		guids[v.GetGuid()] = true
+	}
+	var missing []*pdu.FilesystemVersion
+	for _, v := range vs {
+		if !guids[v.GetGuid()] {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
+
+// returns the snapshot in vs with the highest createtxg, nil if vs contains no snapshots
+func newestSnapshot(vs []*pdu.FilesystemVersion) *pdu.FilesystemVersion {
+	var newest *pdu.FilesystemVersion
+	for _, v := range vs {
+		if v.Type == pdu.FilesystemVersion_Snapshot && (newest == nil || v.CreateTXG > newest.CreateTXG) {
+			newest = v
+		}
+	}
+	return newest
 }
 
 type Step struct {
@@ -160,6 +288,10 @@ type Step struct {
 	resumeToken string // empty means no resume token shall be used
 
 	expectedSize int64 // 0 means no size estimate present / possible
+	// 0 means no prediction present / possible, see PlannerPolicy.DurationPredictor
+	predictedDuration time.Duration
+	// uncompressed and compressed size of the sent data, 0 means no size estimate present / possible
+	expectedLogicalSize, expectedPhysicalSize int64
 
 	// byteCounter is nil initially, and set later in Step.doReplication
 	// => concurrent read of that pointer from Step.ReportInfo must be protected
@@ -184,7 +316,32 @@ func (s *Step) TargetDate() time.Time {
 }
 
 func (s *Step) Step(ctx context.Context) error {
-	return s.doReplication(ctx)
+	return withStepTimeout(ctx, s.parent.policy.StepTimeout, s.doReplication)
+}
+
+// StepTimeoutError is returned by a step that was aborted because it exceeded PlannerPolicy.StepTimeout.
+type StepTimeoutError struct {
+	Timeout time.Duration
+	Cause   error
+}
+
+func (e *StepTimeoutError) Error() string {
+	return fmt.Sprintf("step aborted after exceeding the step timeout of %s: %s", e.Timeout, e.Cause)
+}
+
+// withStepTimeout runs do with a context that is cancelled after timeout (unless timeout is 0)
+// and returns a *StepTimeoutError if do fails after the timeout expired.
+func withStepTimeout(ctx context.Context, timeout time.Duration, do func(context.Context) error) error {
+	if timeout <= 0 {
+		return do(ctx)
+	}
+	stepCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := do(stepCtx)
+	if err != nil && stepCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return &StepTimeoutError{Timeout: timeout, Cause: err}
+	}
+	return err
 }
 
 func (s *Step) ReportInfo() *report.StepInfo {
@@ -219,6 +376,11 @@ func (s *Step) ReportInfo() *report.StepInfo {
 		Encrypted:       encrypted,
 		BytesExpected:   s.expectedSize,
 		BytesReplicated: byteCounter,
+
+		BytesExpectedLogical:  s.expectedLogicalSize,
+		BytesExpectedPhysical: s.expectedPhysicalSize,
+
+		PredictedDuration: s.predictedDuration,
 	}
 }
 
@@ -231,9 +393,24 @@ func NewPlanner(secsPerState *prometheus.HistogramVec, bytesReplicated *promethe
 		promBytesReplicated: bytesReplicated,
 	}
 }
-func resolveConflict(conflict error) (path []*pdu.FilesystemVersion, msg string) {
+
+// If splitInitial is true, the path for an initial replication starts at the oldest snapshot
+// and includes all newer snapshots.
+// Otherwise (and in the general case), the path's first element is the `to` version of a full send.
+func resolveConflict(conflict error, splitInitial bool) (path []*pdu.FilesystemVersion, msg string) {
 	if noCommonAncestor, ok := conflict.(*ConflictNoCommonAncestor); ok {
 		if len(noCommonAncestor.SortedReceiverVersions) == 0 {
+			if splitInitial {
+				for _, v := range noCommonAncestor.SortedSenderVersions {
+					if v.Type == pdu.FilesystemVersion_Snapshot {
+						path = append(path, v)
+					}
+				}
+				if len(path) == 0 {
+					return nil, "no snapshots available on sender side"
+				}
+				return path, fmt.Sprintf("start replication at oldest snapshot %s, followed by incremental steps to the most recent snapshot", path[0].RelName())
+			}
 			// TODO this is hard-coded replication policy: most recent snapshot as source
 			// NOTE: Keep in sync with listStaleFiltering, it depends on this hard-coded assumption
 			var mostRecentSnap *pdu.FilesystemVersion
@@ -265,6 +442,12 @@ func (p *Planner) doPlanning(ctx context.Context) ([]*Filesystem, error) {
 	}
 	sfss := slfssres.GetFilesystems()
 
+	p.senderExternallyManagedMtx.Lock()
+	p.senderExternallyManaged = slfssres.GetSnapshotsExternallyManaged()
+	p.senderExternallyManagedMtx.Unlock()
+	policy := p.policy
+	policy.SenderSnapshotsExternallyManaged = p.SenderSnapshotsExternallyManaged()
+
 	rlfssres, err := p.receiver.ListFilesystems(ctx, &pdu.ListFilesystemReq{})
 	if err != nil {
 		log.WithError(err).WithField("errType", fmt.Sprintf("%T", err)).Error("error listing receiver filesystems")
@@ -272,9 +455,22 @@ func (p *Planner) doPlanning(ctx context.Context) ([]*Filesystem, error) {
 	}
 	rfss := rlfssres.GetFilesystems()
 
+	if p.policy.DetectRenames {
+		rfss, err = p.followRenames(ctx, sfss, rfss)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rfss, err = p.handleDeletedFilesystems(ctx, sfss, rfss)
+	if err != nil {
+		return nil, err
+	}
+	p.updateOrphanedFilesystems(ctx, sfss, rfss)
+
 	sizeEstimateRequestSem := semaphore.New(envconst.Int64("ZREPL_REPLICATION_MAX_CONCURRENT_SIZE_ESTIMATE", 4))
 
 	q := make([]*Filesystem, 0, len(sfss))
+	var newFSs []string
 	for _, fs := range sfss {
 
 		var receiverFS *pdu.Filesystem
@@ -289,16 +485,50 @@ func (p *Planner) doPlanning(ctx context.Context) ([]*Filesystem, error) {
 			ctr = p.promBytesReplicated.WithLabelValues(fs.Path)
 		}
 
-		q = append(q, &Filesystem{
+		f := &Filesystem{
 			sender:                 p.sender,
 			receiver:               p.receiver,
-			policy:                 p.policy,
+			policy:                 policy,
 			Path:                   fs.Path,
 			senderFS:               fs,
 			receiverFS:             receiverFS,
 			promBytesReplicated:    ctr,
 			sizeEstimateRequestSem: sizeEstimateRequestSem,
-		})
+			aclProperties:          rlfssres.GetPreservesACLProperties(),
+		}
+		if f.isNew() {
+			newFSs = append(newFSs, f.Path)
+		}
+		q = append(q, f)
+	}
+
+	if p.policy.Ordering == OrderingAlphabetical {
+		sorted := make([]*Filesystem, len(q))
+		copy(sorted, q)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+		for i, f := range sorted {
+			f.orderKey = int64(i)
+		}
+	}
+
+	if len(newFSs) > 0 {
+		log.WithField("filesystems", newFSs).
+			WithField("confirmation_required", p.policy.NewFilesystemConfirmation != nil).
+			Info("new filesystems detected, planning initial replication")
+	}
+	if exceeded, overridden, err := checkFullSendLimit(p.policy, guardrails.FromContext(ctx), newFSs); err != nil {
+		log.WithError(err).WithField("filesystems", newFSs).Error("refusing initial replication of new filesystems")
+		for _, f := range q {
+			if f.isNew() {
+				f.fullSendRefused = err
+			}
+		}
+	} else if overridden {
+		log.WithField("filesystems", newFSs).WithField("limit", p.policy.MaxFullSends).
+			Warn("initial replication of new filesystems exceeds guardrails.max_full_sends, proceeding because the guardrails were overridden (the override is consumed)")
+	} else if exceeded {
+		log.WithField("filesystems", newFSs).WithField("limit", p.policy.MaxFullSends).
+			Warn("initial replication of new filesystems exceeds guardrails.max_full_sends")
 	}
 
 	return q, nil
@@ -316,6 +546,17 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 		return nil, fmt.Errorf("sender filesystem is not encrypted but policy mandates encrypted send")
 	}
 
+	if fs.isNew() && fs.fullSendRefused != nil {
+		return nil, fs.fullSendRefused
+	}
+
+	if fs.isNew() && fs.policy.NewFilesystemConfirmation != nil {
+		if !fs.policy.NewFilesystemConfirmation.confirmedOrPending(fs.Path) {
+			log(ctx).Info("new filesystem requires confirmation before initial replication")
+			return nil, errNewFilesystemUnconfirmed
+		}
+	}
+
 	sfsvsres, err := fs.sender.ListFilesystemVersions(ctx, &pdu.ListFilesystemVersionsReq{Filesystem: fs.Path})
 	if err != nil {
 		log(ctx).WithError(err).Error("cannot get remote filesystem versions")
@@ -325,6 +566,9 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 
 	if len(sfsvs) < 1 {
 		err := errors.New("sender does not have any versions")
+		if fs.isNew() {
+			err = errors.New("sender does not have any versions yet, initial replication will happen once the new filesystem has been snapshotted")
+		}
 		log(ctx).Error(err.Error())
 		return nil, err
 	}
@@ -340,6 +584,14 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 	} else {
 		rfsvs = []*pdu.FilesystemVersion{}
 	}
+	if fs.policy.ReplicatedSnapshotObserver != nil {
+		if newest := newestSnapshot(rfsvs); newest != nil {
+			fs.policy.ReplicatedSnapshotObserver.ObserveReplicatedSnapshot(fs.Path, newest)
+		}
+	}
+	if fs.policy.Ordering == OrderingOldestRPO {
+		fs.orderKey = oldestRPOOrderKey(newestSnapshot(rfsvs))
+	}
 
 	var resumeToken *zfs.ResumeToken
 	var resumeTokenRaw string
@@ -356,6 +608,22 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 			return nil, err
 		}
 		log(ctx).WithField("token", resumeToken).Debug("decode resume token")
+
+		if maxAge := fs.policy.AbortStalePartialReceivesAfter; maxAge > 0 || fs.policy.SenderSnapshotsExternallyManaged {
+			now := time.Now()
+			firstSeen := now
+			if fs.policy.PartialReceiveAges != nil {
+				firstSeen = fs.policy.PartialReceiveAges.observe(fs.Path, resumeToken, now)
+			}
+			if stale, reason := resumeTokenIsStale(sfsvs, resumeToken, maxAge, firstSeen, now); stale {
+				// the step will be planned without resume token, which makes the receiver discard the partial receive state
+				log(ctx).WithField("token", resumeToken).WithField("reason", reason).
+					Warn("discarding stale partial receive state, replication will start over")
+				resumeToken, resumeTokenRaw = nil, ""
+			}
+		}
+	} else if fs.policy.PartialReceiveAges != nil {
+		fs.policy.PartialReceiveAges.forget(fs.Path)
 	}
 
 	var steps []*Step
@@ -413,6 +681,8 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 		}
 		// fromVersion may be nil, toVersion is no nil, encryption matches
 		// good to go this one step!
+		log(ctx).WithField("to", toVersion.RelName()).WithField("incremental", fromVersion != nil).
+			Info("receiver has partial receive state, resuming interrupted step")
 		resumeStep := &Step{
 			parent:   fs,
 			sender:   fs.sender,
@@ -451,9 +721,40 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 		}
 	} else { // resumeToken == nil
 		path, conflict := IncrementalPath(rfsvs, sfsvs)
+		if recreated := senderRecreated(conflict); recreated != nil {
+			if fs.policy.SenderSnapshotsExternallyManaged && !fs.policy.ArchiveRecreatedFilesystems {
+				err := &NoCommonSnapshotError{Conflict: recreated.Conflict}
+				log(ctx).WithField("conflict", conflict).Error("no common snapshot with the externally managed sender")
+				return nil, err
+			}
+			if !fs.policy.ArchiveRecreatedFilesystems {
+				log(ctx).WithField("conflict", conflict).Error("sender filesystem was presumably destroyed and re-created")
+				return nil, recreated
+			}
+			archive, err := fs.archiveReceiverFS(ctx, time.Now())
+			if err != nil {
+				log(ctx).WithError(err).Error("sender filesystem was presumably destroyed and re-created")
+				return nil, err
+			}
+			log(ctx).WithField("conflict", conflict).WithField("archive", archive).
+				Warn("sender filesystem was presumably destroyed and re-created, archived receiver filesystem, replicating from scratch")
+			rfsvs = []*pdu.FilesystemVersion{}
+			path, conflict = IncrementalPath(rfsvs, sfsvs)
+		}
+		if diverged, ok := conflict.(*ConflictDiverged); ok && fs.policy.RollbackDivergedReceivers {
+			remaining, err := fs.rollbackDivergedReceiver(ctx, diverged)
+			if err != nil {
+				log(ctx).WithError(err).WithField("conflict", conflict).Error("receiver filesystem has diverged")
+				return nil, err
+			}
+			log(ctx).WithField("conflict", conflict).WithField("rollback_to", diverged.CommonAncestor.RelName()).
+				Warn("receiver filesystem had diverged, rolled it back to the most recent common snapshot")
+			rfsvs = remaining
+			path, conflict = IncrementalPath(rfsvs, sfsvs)
+		}
 		if conflict != nil {
 			var msg string
-			path, msg = resolveConflict(conflict) // no shadowing allowed!
+			path, msg = resolveConflict(conflict, fs.policy.InitialStepSizeLimit > 0) // no shadowing allowed!
 			if path != nil {
 				log(ctx).WithField("conflict", conflict).Info("conflict")
 				log(ctx).WithField("resolution", msg).Info("automatically resolved")
@@ -466,8 +767,23 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 			return nil, conflict
 		}
 
+		if conflict != nil && len(path) > 1 {
+			// the initial replication was split, but a single full send may be small enough
+			split, err := fs.splitInitialReplication(ctx, path[len(path)-1])
+			if err != nil {
+				log(ctx).WithError(err).Error("cannot decide whether to split initial replication")
+				return nil, err
+			}
+			if split {
+				log(ctx).WithField("steps", len(path)).Info("split initial replication into one step per snapshot")
+			} else {
+				path = path[len(path)-1:]
+			}
+		}
+
 		steps = make([]*Step, 0, len(path)) // shadow
-		if len(path) == 1 {
+		if conflict != nil {
+			// the conflict was resolved: path[0] is the `to` version of a full send
 			steps = append(steps, &Step{
 				parent:   fs,
 				sender:   fs.sender,
@@ -477,18 +793,17 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 				to:      path[0],
 				encrypt: fs.policy.EncryptedSend,
 			})
-		} else {
-			for i := 0; i < len(path)-1; i++ {
-				steps = append(steps, &Step{
-					parent:   fs,
-					sender:   fs.sender,
-					receiver: fs.receiver,
-
-					from:    path[i],
-					to:      path[i+1],
-					encrypt: fs.policy.EncryptedSend,
-				})
-			}
+		}
+		for i := 0; i < len(path)-1; i++ {
+			steps = append(steps, &Step{
+				parent:   fs,
+				sender:   fs.sender,
+				receiver: fs.receiver,
+
+				from:    path[i],
+				to:      path[i+1],
+				encrypt: fs.policy.EncryptedSend,
+			})
 		}
 	}
 
@@ -535,10 +850,63 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 		return nil, significantErr
 	}
 
+	if fs.policy.DurationPredictor != nil {
+		for _, s := range steps {
+			if s.expectedSize > 0 {
+				s.predictedDuration, _ = fs.policy.DurationPredictor.PredictDuration(fs.Path, s.expectedSize)
+			}
+		}
+	}
+
+	switch fs.policy.Ordering {
+	case OrderingSmallestFirst:
+		fs.orderKey = smallestFirstOrderKey(steps)
+	case OrderingLongestFirst:
+		fs.orderKey = longestFirstOrderKey(steps)
+	}
+
 	log(ctx).Debug("filesystem planning finished")
 	return steps, nil
 }
 
+// oldestRPOOrderKey orders filesystems by the creation of their newest snapshot on the receiver,
+// filesystems without snapshots on the receiver first.
+func oldestRPOOrderKey(newestOnReceiver *pdu.FilesystemVersion) int64 {
+	if newestOnReceiver == nil {
+		return math.MinInt64
+	}
+	creation, err := newestOnReceiver.CreationAsTime()
+	if err != nil {
+		return math.MinInt64
+	}
+	return creation.UnixNano()
+}
+
+// longestFirstOrderKey orders filesystems by the sum of the predicted durations of their steps, longest first.
+// Filesystems with steps without prediction go last.
+func longestFirstOrderKey(steps []*Step) int64 {
+	var sum time.Duration
+	for _, s := range steps {
+		if s.predictedDuration == 0 {
+			return math.MaxInt64
+		}
+		sum += s.predictedDuration
+	}
+	return -int64(sum)
+}
+
+// smallestFirstOrderKey orders filesystems by the sum of the size estimates of their steps.
+// Filesystems with steps without size estimate go last.
+func smallestFirstOrderKey(steps []*Step) (sum int64) {
+	for _, s := range steps {
+		if s.expectedSize == 0 {
+			return math.MaxInt64
+		}
+		sum += s.expectedSize
+	}
+	return sum
+}
+
 func (s *Step) updateSizeEstimate(ctx context.Context) error {
 
 	log := getLogger(ctx)
@@ -557,6 +925,8 @@ func (s *Step) updateSizeEstimate(ctx context.Context) error {
 		return err
 	}
 	s.expectedSize = sres.GetExpectedSize()
+	s.expectedLogicalSize = sres.GetExpectedLogicalSize()
+	s.expectedPhysicalSize = sres.GetExpectedPhysicalSize()
 	return nil
 }
 
@@ -570,6 +940,7 @@ func (s *Step) buildSendRequest(dryRun bool) (sr *pdu.SendReq) {
 		ResumeToken:       s.resumeToken,
 		DryRun:            dryRun,
 		ReplicationConfig: &s.parent.policy.ReplicationConfig,
+		ACLProperties:     s.parent.aclProperties && !dryRun,
 	}
 	return sr
 }
@@ -580,6 +951,7 @@ func (s *Step) doReplication(ctx context.Context) error {
 
 	log := getLogger(ctx).WithField("filesystem", fs)
 	sr := s.buildSendRequest(false)
+	begin := time.Now()
 
 	log.Debug("initiate send request")
 	sres, stream, err := s.sender.Send(ctx, sr)
@@ -615,9 +987,15 @@ func (s *Step) doReplication(ctx context.Context) error {
 		To:                sr.GetTo(),
 		ClearResumeToken:  !sres.UsedResumeToken,
 		ReplicationConfig: &s.parent.policy.ReplicationConfig,
+		ACLProperties:     sres.GetACLProperties(),
 	}
 	log.Debug("initiate receive request")
-	_, err = s.receiver.Receive(ctx, rr, byteCountingStream)
+	var recvStream io.ReadCloser = byteCountingStream
+	if l := s.parent.policy.BandwidthLimiter; l != nil {
+		recvStream = l.ReadCloser(ctx, recvStream, s.parent.Weight())
+		defer recvStream.Close()
+	}
+	_, err = s.receiver.Receive(ctx, rr, pause.ReadCloser(ctx, recvStream))
 	if err != nil {
 		log.
 			WithError(err).
@@ -641,6 +1019,13 @@ func (s *Step) doReplication(ctx context.Context) error {
 		return err
 	}
 
+	if s.parent.policy.StepRecorder != nil {
+		s.parent.policy.StepRecorder.RecordStep(ctx, fs, s.from, sr.GetTo(), byteCountingStream.Count(), time.Since(begin))
+	}
+	if s.parent.policy.ReplicatedSnapshotObserver != nil {
+		s.parent.policy.ReplicatedSnapshotObserver.ObserveReplicatedSnapshot(fs, sr.GetTo())
+	}
+
 	return err
 }
 
@@ -0,0 +1,43 @@
+package logic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// externallyManagedTestSender lists its filesystems with SnapshotsExternallyManaged set,
+// the Sender methods that are not overridden must not be called.
+type externallyManagedTestSender struct {
+	Sender
+	fss []string
+}
+
+func (s *externallyManagedTestSender) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+	res := &pdu.ListFilesystemRes{SnapshotsExternallyManaged: true}
+	for _, fs := range s.fss {
+		res.Filesystems = append(res.Filesystems, &pdu.Filesystem{Path: fs})
+	}
+	return res, nil
+}
+
+func TestPlanningAdoptsSenderSnapshotsExternallyManaged(t *testing.T) {
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	defer end()
+
+	s := &externallyManagedTestSender{fss: []string{"a"}}
+	r := &tombstoneTestReceiver{fss: []string{"a"}}
+	p := NewPlanner(nil, nil, s, r, PlannerPolicy{})
+	require.False(t, p.SenderSnapshotsExternallyManaged())
+
+	fss, err := p.doPlanning(ctx)
+	require.NoError(t, err)
+	assert.True(t, p.SenderSnapshotsExternallyManaged())
+	require.Len(t, fss, 1)
+	assert.True(t, fss[0].policy.SenderSnapshotsExternallyManaged)
+}
@@ -0,0 +1,34 @@
+package logic
+
+import (
+	"fmt"
+
+	"github.com/zrepl/zrepl/daemon/job/guardrails"
+)
+
+// FullSendLimitExceededError is the planning error of the new filesystems of a replication attempt
+// that would have started more initial replications (full sends) than permitted by PlannerPolicy.MaxFullSends.
+type FullSendLimitExceededError struct {
+	FullSends, Limit int
+}
+
+func (e *FullSendLimitExceededError) Error() string {
+	return fmt.Sprintf("refusing initial replication (full send) of %d new filesystems at once, the limit is %d (guardrails.max_full_sends): "+
+		"check the filesystems filter and the receiver, or run `zrepl signal override JOB` if the transfer is intended", e.FullSends, e.Limit)
+}
+
+// checkFullSendLimit returns exceeded = true if the initial replication of newFSs exceeds policy.MaxFullSends.
+// If policy.RefuseFullSends is set, it also returns a *FullSendLimitExceededError, unless override
+// is armed, in which case the override is consumed.
+func checkFullSendLimit(policy PlannerPolicy, override *guardrails.Override, newFSs []string) (exceeded, overridden bool, _ error) {
+	if policy.MaxFullSends <= 0 || len(newFSs) <= policy.MaxFullSends {
+		return false, false, nil
+	}
+	if !policy.RefuseFullSends {
+		return true, false, nil
+	}
+	if override.Consume() {
+		return true, true, nil
+	}
+	return true, false, &FullSendLimitExceededError{FullSends: len(newFSs), Limit: policy.MaxFullSends}
+}
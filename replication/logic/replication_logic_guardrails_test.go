@@ -0,0 +1,46 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/daemon/job/guardrails"
+)
+
+func TestCheckFullSendLimit(t *testing.T) {
+	newFSs := []string{"pool/a", "pool/b", "pool/c"}
+	override := guardrails.NewOverride()
+
+	exceeded, overridden, err := checkFullSendLimit(PlannerPolicy{}, override, newFSs)
+	assert.False(t, exceeded)
+	assert.False(t, overridden)
+	assert.NoError(t, err)
+
+	exceeded, _, err = checkFullSendLimit(PlannerPolicy{MaxFullSends: 3}, override, newFSs)
+	assert.False(t, exceeded)
+	assert.NoError(t, err)
+
+	// only a warning by default
+	exceeded, overridden, err = checkFullSendLimit(PlannerPolicy{MaxFullSends: 2}, override, newFSs)
+	assert.True(t, exceeded)
+	assert.False(t, overridden)
+	assert.NoError(t, err)
+
+	refuse := PlannerPolicy{MaxFullSends: 2, RefuseFullSends: true}
+	exceeded, _, err = checkFullSendLimit(refuse, override, newFSs)
+	assert.True(t, exceeded)
+	assert.Equal(t, &FullSendLimitExceededError{FullSends: 3, Limit: 2}, err)
+
+	// the override is consumed by the first replication attempt that exceeds the limit
+	override.Arm()
+	exceeded, overridden, err = checkFullSendLimit(refuse, override, newFSs)
+	assert.True(t, exceeded)
+	assert.True(t, overridden)
+	assert.NoError(t, err)
+	_, _, err = checkFullSendLimit(refuse, override, newFSs)
+	assert.Error(t, err)
+
+	_, _, err = checkFullSendLimit(refuse, nil, newFSs)
+	assert.Error(t, err)
+}
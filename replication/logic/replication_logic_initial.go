@@ -0,0 +1,37 @@
+package logic
+
+import (
+	"context"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// splitInitialReplication decides whether the initial replication of fs is split into
+// a full send of the oldest snapshot followed by one incremental step per snapshot pair.
+// It is split unless the full send of the most recent snapshot `to` is estimated
+// to fit into fs.policy.InitialStepSizeLimit.
+//
+// Consecutive snapshots are never combined into a single incremental step because
+// `zfs send -i` would skip the intermediate snapshots, which would then be missing
+// on the receiver.
+func (fs *Filesystem) splitInitialReplication(ctx context.Context, to *pdu.FilesystemVersion) (bool, error) {
+	full := &Step{
+		parent:   fs,
+		sender:   fs.sender,
+		receiver: fs.receiver,
+
+		from:    nil,
+		to:      to,
+		encrypt: fs.policy.EncryptedSend,
+	}
+	guard, err := fs.sizeEstimateRequestSem.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer guard.Release()
+	if err := full.updateSizeEstimate(ctx); err != nil {
+		return false, err
+	}
+	// 0 means no estimate
+	return full.expectedSize <= 0 || full.expectedSize > fs.policy.InitialStepSizeLimit, nil
+}
@@ -0,0 +1,88 @@
+package logic
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/replication/logic/diff"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/util/semaphore"
+)
+
+// initialSplitSender serves a fixed list of versions and dry-run size estimates.
+type initialSplitSender struct {
+	Sender       // nil, panics if other methods are used
+	versions     []*pdu.FilesystemVersion
+	fullSendSize int64
+}
+
+func (s *initialSplitSender) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+	return &pdu.ListFilesystemVersionsRes{Versions: s.versions}, nil
+}
+
+func (s *initialSplitSender) Send(ctx context.Context, req *pdu.SendReq) (*pdu.SendRes, io.ReadCloser, error) {
+	if !req.DryRun {
+		panic("initialSplitSender only supports dry run sends")
+	}
+	if req.From == nil {
+		return &pdu.SendRes{ExpectedSize: s.fullSendSize}, nil, nil
+	}
+	return &pdu.SendRes{ExpectedSize: 1}, nil, nil
+}
+
+func TestInitialReplicationSplitSendsEverySnapshot(t *testing.T) {
+	creation := pdu.FilesystemVersionCreation(time.Unix(0, 0))
+	snap := func(name string, txg uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: name, Guid: txg, CreateTXG: txg, Creation: creation}
+	}
+	versions := []*pdu.FilesystemVersion{snap("a", 1), snap("b", 2), snap("c", 3), snap("d", 4)}
+
+	type simpleStep struct{ From, To string }
+	plan := func(fullSendSize int64) (l []simpleStep) {
+		fs := &Filesystem{
+			Path:                   "pool/fs",
+			sender:                 &initialSplitSender{versions: versions, fullSendSize: fullSendSize},
+			senderFS:               &pdu.Filesystem{Path: "pool/fs"},
+			policy:                 PlannerPolicy{InitialStepSizeLimit: 100},
+			sizeEstimateRequestSem: semaphore.New(1),
+		}
+		ctx, end := trace.WithTaskFromStack(context.Background())
+		defer end()
+		steps, err := fs.doPlanning(ctx)
+		require.NoError(t, err)
+		for _, s := range steps {
+			l = append(l, simpleStep{s.from.GetName(), s.to.GetName()})
+		}
+		return l
+	}
+
+	// every snapshot is the `to` of a step, i.e., arrives on the receiver
+	assert.Equal(t, []simpleStep{{"", "a"}, {"a", "b"}, {"b", "c"}, {"c", "d"}}, plan(1000))
+	// no estimate: split
+	assert.Equal(t, []simpleStep{{"", "a"}, {"a", "b"}, {"b", "c"}, {"c", "d"}}, plan(0))
+	// the full send of the most recent snapshot fits into the limit: no split
+	assert.Equal(t, []simpleStep{{"", "d"}}, plan(50))
+}
+
+func TestResolveConflictSplitInitial(t *testing.T) {
+	creation := pdu.FilesystemVersionCreation(time.Unix(0, 0))
+	snap := func(name string, txg uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: name, Guid: txg, CreateTXG: txg, Creation: creation}
+	}
+	book := &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Bookmark, Name: "b", Guid: 2, CreateTXG: 2, Creation: creation}
+	conflict := &diff.ConflictNoCommonAncestor{
+		SortedSenderVersions: []*pdu.FilesystemVersion{snap("a", 1), book, snap("c", 3)},
+	}
+
+	path, _ := resolveConflict(conflict, false)
+	assert.Equal(t, []*pdu.FilesystemVersion{snap("c", 3)}, path)
+
+	path, _ = resolveConflict(conflict, true)
+	assert.Equal(t, []*pdu.FilesystemVersion{snap("a", 1), snap("c", 3)}, path)
+}
@@ -0,0 +1,76 @@
+package logic
+
+import (
+	"sort"
+	"sync"
+)
+
+// newFilesystemUnconfirmedError is not a replication failure:
+// its SkipFS method makes the replication driver report the filesystem as skipped.
+type newFilesystemUnconfirmedError struct{}
+
+func (newFilesystemUnconfirmedError) Error() string {
+	return "new filesystem awaits confirmation for initial replication, use `zrepl signal confirm JOB`"
+}
+
+func (newFilesystemUnconfirmedError) SkipFS() bool { return true }
+
+var errNewFilesystemUnconfirmed error = newFilesystemUnconfirmedError{}
+
+// NewFilesystemConfirmation tracks which new filesystems (i.e. filesystems that do not exist on the receiver yet)
+// have been confirmed for initial replication.
+// Unconfirmed new filesystems are recorded as pending when they are planned.
+//
+// Confirmations are not persisted: once the initial replication of a filesystem has succeeded,
+// it is no longer new and does not need to be confirmed again.
+type NewFilesystemConfirmation struct {
+	mtx       sync.Mutex
+	pending   map[string]bool
+	confirmed map[string]bool
+}
+
+func NewNewFilesystemConfirmation() *NewFilesystemConfirmation {
+	return &NewFilesystemConfirmation{
+		pending:   make(map[string]bool),
+		confirmed: make(map[string]bool),
+	}
+}
+
+// Returns true if fs has been confirmed, otherwise records fs as pending.
+func (c *NewFilesystemConfirmation) confirmedOrPending(fs string) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.confirmed[fs] {
+		return true
+	}
+	c.pending[fs] = true
+	return false
+}
+
+// Pending returns the sorted list of new filesystems that await confirmation.
+func (c *NewFilesystemConfirmation) Pending() []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return sortedKeys(c.pending)
+}
+
+// ConfirmPending confirms all pending filesystems and returns them.
+func (c *NewFilesystemConfirmation) ConfirmPending() []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	confirmed := sortedKeys(c.pending)
+	for fs := range c.pending {
+		c.confirmed[fs] = true
+	}
+	c.pending = make(map[string]bool)
+	return confirmed
+}
+
+func sortedKeys(m map[string]bool) []string {
+	l := make([]string, 0, len(m))
+	for k := range m {
+		l = append(l, k)
+	}
+	sort.Strings(l)
+	return l
+}
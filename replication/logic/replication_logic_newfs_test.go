@@ -0,0 +1,47 @@
+package logic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestFilesystemIsNew(t *testing.T) {
+	assert.True(t, (&Filesystem{}).isNew())
+	assert.True(t, (&Filesystem{receiverFS: &pdu.Filesystem{IsPlaceholder: true}}).isNew())
+	assert.False(t, (&Filesystem{receiverFS: &pdu.Filesystem{}}).isNew())
+}
+
+func TestNewFilesystemConfirmation(t *testing.T) {
+	c := NewNewFilesystemConfirmation()
+
+	assert.False(t, c.confirmedOrPending("pool/b"))
+	assert.False(t, c.confirmedOrPending("pool/a"))
+	assert.False(t, c.confirmedOrPending("pool/a"))
+	assert.Equal(t, []string{"pool/a", "pool/b"}, c.Pending())
+
+	assert.Equal(t, []string{"pool/a", "pool/b"}, c.ConfirmPending())
+	assert.Empty(t, c.Pending())
+	assert.Empty(t, c.ConfirmPending())
+
+	assert.True(t, c.confirmedOrPending("pool/a"))
+	assert.False(t, c.confirmedOrPending("pool/c"))
+	assert.Equal(t, []string{"pool/c"}, c.Pending())
+}
+
+func TestFilesystemPlanningRequiresConfirmation(t *testing.T) {
+	fs := &Filesystem{
+		Path:     "pool/new",
+		senderFS: &pdu.Filesystem{Path: "pool/new"},
+		policy:   PlannerPolicy{NewFilesystemConfirmation: NewNewFilesystemConfirmation()},
+	}
+	// sender and receiver are nil: planning must fail before using them
+	_, err := fs.doPlanning(context.Background())
+	require.Equal(t, errNewFilesystemUnconfirmed, err)
+	assert.True(t, err.(interface{ SkipFS() bool }).SkipFS(), "must be reported as skipped, not as an error")
+	assert.Equal(t, []string{"pool/new"}, fs.policy.NewFilesystemConfirmation.Pending())
+}
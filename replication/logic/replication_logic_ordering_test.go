@@ -0,0 +1,47 @@
+package logic
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestOrderingFromConfig(t *testing.T) {
+	for _, o := range []string{"oldest_snapshot", "oldest_rpo", "smallest_first", "longest_first", "alphabetical"} {
+		ordering, err := OrderingFromConfig(o)
+		require.NoError(t, err)
+		assert.Equal(t, Ordering(o), ordering)
+	}
+	_, err := OrderingFromConfig("largest_first")
+	assert.Error(t, err)
+}
+
+func TestOldestRPOOrderKey(t *testing.T) {
+	snap := func(creation time.Time) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Creation: pdu.FilesystemVersionCreation(creation)}
+	}
+	older := oldestRPOOrderKey(snap(time.Unix(1000, 0)))
+	newer := oldestRPOOrderKey(snap(time.Unix(2000, 0)))
+	assert.True(t, older < newer, "the most-behind filesystem must go first")
+	assert.Equal(t, int64(math.MinInt64), oldestRPOOrderKey(nil), "new filesystems must go first")
+}
+
+func TestSmallestFirstOrderKey(t *testing.T) {
+	assert.Equal(t, int64(0), smallestFirstOrderKey(nil))
+	assert.Equal(t, int64(300), smallestFirstOrderKey([]*Step{{expectedSize: 100}, {expectedSize: 200}}))
+	assert.Equal(t, int64(math.MaxInt64), smallestFirstOrderKey([]*Step{{expectedSize: 100}, {expectedSize: 0}}),
+		"filesystems with unknown sizes must go last")
+}
+
+func TestLongestFirstOrderKey(t *testing.T) {
+	short := longestFirstOrderKey([]*Step{{predictedDuration: time.Minute}})
+	long := longestFirstOrderKey([]*Step{{predictedDuration: time.Minute}, {predictedDuration: time.Hour}})
+	assert.True(t, long < short, "the longest filesystem must go first")
+	assert.Equal(t, int64(math.MaxInt64), longestFirstOrderKey([]*Step{{predictedDuration: time.Minute}, {}}),
+		"filesystems without predictions must go last")
+}
@@ -0,0 +1,195 @@
+package logic
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zrepl/zrepl/replication/driver"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/replication/report"
+	"github.com/zrepl/zrepl/util/envconst"
+)
+
+var _ driver.OrphanReportingPlanner = (*Planner)(nil)
+
+// OrphanedFilesystems implements driver.OrphanReportingPlanner.
+func (p *Planner) OrphanedFilesystems() []*report.OrphanedFilesystemReport {
+	p.orphansMtx.Lock()
+	defer p.orphansMtx.Unlock()
+	return p.orphans
+}
+
+// orphanedFilesystems returns the receiver filesystems rfss that have no corresponding filesystem in senderPaths, sorted by name.
+// Placeholders are not reported.
+// Tombstones and filesystems archived by archive_recreated_filesystems are reported as such, but their children are not.
+func orphanedFilesystems(senderPaths []string, rfss []*pdu.Filesystem) []*report.OrphanedFilesystemReport {
+	onSender := make(map[string]bool, len(senderPaths))
+	for _, sp := range senderPaths {
+		onSender[sp] = true
+	}
+
+	rps := make([]string, 0, len(rfss))
+	for _, fs := range rfss {
+		if !fs.GetIsPlaceholder() && !onSender[fs.GetPath()] {
+			rps = append(rps, fs.GetPath())
+		}
+	}
+	sort.Strings(rps) // parents before children
+
+	var orphans []*report.OrphanedFilesystemReport
+	var collapsed []string
+rps_loop:
+	for _, rp := range rps {
+		for _, c := range collapsed {
+			if strings.HasPrefix(rp, c+"/") {
+				continue rps_loop
+			}
+		}
+		kind := report.OrphanDeleted
+		if _, _, ok := pdu.ParseTombstoneName(rp); ok {
+			kind = report.OrphanTombstone
+		} else if archivedFilesystemRE.MatchString(rp) {
+			kind = report.OrphanArchived
+		}
+		if kind != report.OrphanDeleted {
+			collapsed = append(collapsed, rp)
+		}
+		orphans = append(orphans, &report.OrphanedFilesystemReport{Name: rp, Kind: kind})
+	}
+	return orphans
+}
+
+var (
+	// an orphan's newest snapshot is looked up again if it was looked up longer ago than this
+	orphanNewestSnapshotMaxAge = envconst.Duration("ZREPL_REPLICATION_ORPHAN_NEWEST_SNAPSHOT_MAX_AGE", 1*time.Hour)
+	// the maximum number of orphans whose newest snapshot is looked up per planning run
+	orphanNewestSnapshotLookupsPerPlanning = envconst.Int("ZREPL_REPLICATION_ORPHAN_NEWEST_SNAPSHOT_LOOKUPS_PER_PLANNING", 10)
+)
+
+// OrphanNewestSnapshots remembers the newest snapshots of orphaned receiver filesystems across planning runs,
+// so that each run only issues a bounded number of ListFilesystemVersions requests for orphans.
+// Orphans are not replicated to, so their newest snapshot rarely changes.
+type OrphanNewestSnapshots struct {
+	mtx    sync.Mutex
+	byName map[string]orphanNewestSnapshot
+}
+
+type orphanNewestSnapshot struct {
+	snapshot string
+	creation time.Time
+	lookedUp time.Time
+}
+
+func NewOrphanNewestSnapshots() *OrphanNewestSnapshots {
+	return &OrphanNewestSnapshots{byName: make(map[string]orphanNewestSnapshot)}
+}
+
+// get is nil-safe
+func (c *OrphanNewestSnapshots) get(fs string) (e orphanNewestSnapshot, ok bool) {
+	if c == nil {
+		return e, false
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	e, ok = c.byName[fs]
+	return e, ok
+}
+
+// put is nil-safe
+func (c *OrphanNewestSnapshots) put(fs string, e orphanNewestSnapshot) {
+	if c == nil {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.byName[fs] = e
+}
+
+// retain forgets the filesystems that are not orphans anymore, it is nil-safe.
+func (c *OrphanNewestSnapshots) retain(orphans []*report.OrphanedFilesystemReport) {
+	if c == nil {
+		return
+	}
+	keep := make(map[string]bool, len(orphans))
+	for _, o := range orphans {
+		keep[o.Name] = true
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for fs := range c.byName {
+		if !keep[fs] {
+			delete(c.byName, fs)
+		}
+	}
+}
+
+// updateOrphanedFilesystems determines the orphaned receiver filesystems and their newest snapshot
+// for OrphanedFilesystems.
+// The newest snapshots are remembered in PlannerPolicy.OrphanNewestSnapshots and looked up again
+// after orphanNewestSnapshotMaxAge, for at most orphanNewestSnapshotLookupsPerPlanning orphans per run.
+// The newest snapshot of the other orphans is reported as remembered, or empty, until a later run looks it up.
+// Errors listing an orphan's versions are logged and leave its newest snapshot empty.
+func (p *Planner) updateOrphanedFilesystems(ctx context.Context, sfss, rfss []*pdu.Filesystem) {
+	log := getLogger(ctx)
+
+	senderPaths := make([]string, len(sfss))
+	for i, fs := range sfss {
+		senderPaths[i] = fs.GetPath()
+	}
+	orphans := orphanedFilesystems(senderPaths, rfss)
+	cache := p.policy.OrphanNewestSnapshots
+	cache.retain(orphans)
+
+	now := time.Now()
+	lookups, deferred := 0, 0
+	for _, o := range orphans {
+		e, cached := cache.get(o.Name)
+		if (!cached || now.Sub(e.lookedUp) >= orphanNewestSnapshotMaxAge) && lookups < orphanNewestSnapshotLookupsPerPlanning {
+			lookups++
+			var err error
+			if e, err = p.lookupOrphanNewestSnapshot(ctx, o.Name, now); err != nil {
+				log.WithError(err).WithField("filesystem", o.Name).Warn("cannot list versions of orphaned receiver filesystem")
+				continue
+			}
+			cache.put(o.Name, e)
+		} else if !cached {
+			deferred++
+			continue
+		}
+		o.NewestSnapshot = e.snapshot
+		o.NewestSnapshotCreation = e.creation
+	}
+	if deferred > 0 {
+		log.WithField("deferred", deferred).WithField("limit", orphanNewestSnapshotLookupsPerPlanning).
+			Debug("deferred looking up the newest snapshot of orphaned receiver filesystems to later replication attempts")
+	}
+
+	p.orphansMtx.Lock()
+	defer p.orphansMtx.Unlock()
+	p.orphans = orphans
+}
+
+func (p *Planner) lookupOrphanNewestSnapshot(ctx context.Context, fs string, now time.Time) (e orphanNewestSnapshot, err error) {
+	res, err := p.receiver.ListFilesystemVersions(ctx, &pdu.ListFilesystemVersionsReq{Filesystem: fs})
+	if err != nil {
+		return e, err
+	}
+	e.lookedUp = now
+	var newest *pdu.FilesystemVersion
+	for _, v := range res.GetVersions() {
+		if v.GetType() == pdu.FilesystemVersion_Snapshot && (newest == nil || v.GetCreateTXG() > newest.GetCreateTXG()) {
+			newest = v
+		}
+	}
+	if newest == nil {
+		return e, nil
+	}
+	e.snapshot = newest.GetRelName()
+	if creation, err := newest.CreationAsTime(); err == nil {
+		e.creation = creation
+	}
+	return e, nil
+}
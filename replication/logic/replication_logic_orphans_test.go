@@ -0,0 +1,115 @@
+package logic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/replication/report"
+)
+
+func TestOrphanedFilesystems(t *testing.T) {
+
+	type orphan struct {
+		name string
+		kind report.OrphanKind
+	}
+
+	type testCase struct {
+		name     string
+		sender   []string
+		receiver []string
+		orphans  []orphan
+	}
+
+	tcs := []testCase{
+		{
+			name:     "no_orphans",
+			sender:   []string{"pool/a", "pool/a/b"},
+			receiver: []string{"pool/a", "pool/a/b"},
+		},
+		{
+			name:     "deleted",
+			sender:   []string{"pool/a"},
+			receiver: []string{"pool/a", "pool/b", "pool/b/c"},
+			orphans:  []orphan{{"pool/b", report.OrphanDeleted}, {"pool/b/c", report.OrphanDeleted}},
+		},
+		{
+			name:     "parent_of_sender_filesystem",
+			sender:   []string{"pool/a/b"},
+			receiver: []string{"pool/a", "pool/a/b"},
+			orphans:  []orphan{{"pool/a", report.OrphanDeleted}},
+		},
+		{
+			name:     "tombstones_and_archived_are_collapsed",
+			sender:   []string{"pool/a"},
+			receiver: []string{"pool/a", "pool/a_old_20200101_000000", "pool/a_old_20200101_000000/c", "pool/b_deleted_20200403_000000", "pool/b_deleted_20200403_000000/c"},
+			orphans:  []orphan{{"pool/a_old_20200101_000000", report.OrphanArchived}, {"pool/b_deleted_20200403_000000", report.OrphanTombstone}},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rfss := []*pdu.Filesystem{{Path: "pool", IsPlaceholder: true}}
+			for _, r := range tc.receiver {
+				rfss = append(rfss, &pdu.Filesystem{Path: r})
+			}
+			var orphans []orphan
+			for _, o := range orphanedFilesystems(tc.sender, rfss) {
+				orphans = append(orphans, orphan{o.Name, o.Kind})
+			}
+			assert.Equal(t, tc.orphans, orphans)
+		})
+	}
+}
+
+// orphansTestReceiver counts ListFilesystemVersions requests,
+// the Receiver methods that are not overridden must not be called.
+type orphansTestReceiver struct {
+	Receiver
+	lookups int
+}
+
+func (r *orphansTestReceiver) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+	r.lookups++
+	creation := pdu.FilesystemVersionCreation(time.Unix(0, 0))
+	return &pdu.ListFilesystemVersionsRes{Versions: []*pdu.FilesystemVersion{
+		{Type: pdu.FilesystemVersion_Snapshot, Name: "newest", CreateTXG: 2, Creation: creation},
+		{Type: pdu.FilesystemVersion_Snapshot, Name: "older", CreateTXG: 1, Creation: creation},
+	}}, nil
+}
+
+func TestUpdateOrphanedFilesystemsLimitsLookups(t *testing.T) {
+	defer func(n int) { orphanNewestSnapshotLookupsPerPlanning = n }(orphanNewestSnapshotLookupsPerPlanning)
+	orphanNewestSnapshotLookupsPerPlanning = 2
+
+	ctx := context.Background()
+	sfss := []*pdu.Filesystem{{Path: "a"}}
+	rfss := []*pdu.Filesystem{{Path: "a"}, {Path: "b"}, {Path: "c"}, {Path: "d"}}
+	r := &orphansTestReceiver{}
+	policy := PlannerPolicy{OrphanNewestSnapshots: NewOrphanNewestSnapshots()}
+	newest := func(p *Planner) (snaps []string) {
+		for _, o := range p.OrphanedFilesystems() {
+			snaps = append(snaps, o.NewestSnapshot)
+		}
+		return snaps
+	}
+
+	p := NewPlanner(nil, nil, nil, r, policy)
+	p.updateOrphanedFilesystems(ctx, sfss, rfss)
+	assert.Equal(t, 2, r.lookups)
+	assert.Equal(t, []string{"@newest", "@newest", ""}, newest(p))
+
+	// the next attempt looks up the remaining orphan and reuses the others
+	p = NewPlanner(nil, nil, nil, r, policy)
+	p.updateOrphanedFilesystems(ctx, sfss, rfss)
+	assert.Equal(t, 3, r.lookups)
+	assert.Equal(t, []string{"@newest", "@newest", "@newest"}, newest(p))
+
+	p = NewPlanner(nil, nil, nil, r, policy)
+	p.updateOrphanedFilesystems(ctx, sfss, rfss)
+	assert.Equal(t, 3, r.lookups)
+}
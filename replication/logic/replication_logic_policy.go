@@ -1,15 +1,121 @@
 package logic
 
 import (
+	"context"
+	"time"
+
 	"github.com/pkg/errors"
 
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/util/bandwidth"
 )
 
 type PlannerPolicy struct {
 	EncryptedSend     tri // all sends must be encrypted (send -w, and encryption!=off)
 	ReplicationConfig pdu.ReplicationConfig
+	Verify            bool // re-list versions after replication and check that the receiver has all replicated versions
+	// If non-nil, new filesystems are only replicated after they have been confirmed.
+	NewFilesystemConfirmation *NewFilesystemConfirmation
+	// Rename filesystems on the receiver that were renamed on the sender instead of replicating them from scratch.
+	DetectRenames bool
+	// Rename receiver filesystems whose sender filesystem was destroyed and re-created
+	// to <name>_old_<timestamp> and replicate them from scratch instead of failing with a *SenderRecreatedError.
+	ArchiveRecreatedFilesystems bool
+	// Roll back receiver filesystems that have diverged from the sender to the most recent common snapshot
+	// through the receiver's Rollback RPC instead of failing with a *ConflictDiverged.
+	RollbackDivergedReceivers bool
+	// If > 0, partial receive state is discarded if it has existed for longer than this
+	// (as tracked by PartialReceiveAges) or if the resume token's `to` snapshot no longer exists on the sender.
+	AbortStalePartialReceivesAfter time.Duration
+	// Tracks the age of partial receive state for AbortStalePartialReceivesAfter.
+	// If nil, partial receive state is never discarded because of its age.
+	PartialReceiveAges *PartialReceiveAges
+	// Remembers the newest snapshots of orphaned receiver filesystems across replication attempts.
+	// If nil, each attempt looks up the newest snapshots of a limited number of orphans.
+	OrphanNewestSnapshots *OrphanNewestSnapshots
+	// The sender's snapshots are managed by another tool that may destroy them at any time,
+	// and the sender creates no holds or bookmarks that protect them (see endpoint.SenderConfig).
+	// Partial receive state whose `to` snapshot no longer exists on the sender is discarded,
+	// and the sender filesystem is not presumed re-created if it has no version in common with the receiver.
+	// The planner also enables this if the sender advertises it, see Planner.SenderSnapshotsExternallyManaged.
+	SenderSnapshotsExternallyManaged bool
+	// If > 0 and the full send of the most recent snapshot is estimated to exceed this size (in bytes),
+	// the initial replication of a filesystem starts at its oldest snapshot, followed by one incremental step per snapshot.
+	InitialStepSizeLimit int64
+	// If > 0, a step that takes longer than this is aborted and fails with a *StepTimeoutError.
+	StepTimeout time.Duration
+	// If > 0, a warning is logged if a replication attempt would start the initial replication
+	// of more than this many new filesystems.
+	MaxFullSends int
+	// If MaxFullSends is exceeded, the initial replication of the new filesystems fails with a *FullSendLimitExceededError
+	// instead, unless the guardrails of the job are overridden (see package guardrails).
+	RefuseFullSends bool
+	// If non-nil, every step that completed successfully is recorded in StepRecorder.
+	StepRecorder StepRecorder
+	// If non-nil, the duration of each planned step is predicted by DurationPredictor.
+	DurationPredictor DurationPredictor
+	// If non-nil, ReplicatedSnapshotObserver is notified of the newest snapshot of each filesystem
+	// on the receiver when the filesystem is planned and after each step that completed successfully.
+	ReplicatedSnapshotObserver ReplicatedSnapshotObserver
+	// If non-nil, the combined throughput of the job's replication streams is limited by BandwidthLimiter.
+	BandwidthLimiter *bandwidth.Limiter
+	// The order in which filesystems of the same weight are replicated, OrderingOldestSnapshot if empty.
+	Ordering Ordering
+	// If non-nil, filesystems with a higher weight are replicated first
+	// and get a larger share of the BandwidthLimiter's limit. Otherwise, all filesystems have weight 1.
+	Weights FilesystemWeights
+	// How receiver filesystems whose sender filesystem no longer exists are handled, DeletedFilesystemsKeep if empty.
+	DeletedFilesystems DeletedFilesystemsAction
+	// If DeletedFilesystems is DeletedFilesystemsDestroy, tombstones older than this are destroyed.
+	DestroyTombstonesAfter time.Duration
+}
+
+// Ordering determines the order in which the filesystems of the same weight are replicated.
+type Ordering string
+
+const (
+	// The step with the oldest target snapshot of all filesystems is replicated first.
+	OrderingOldestSnapshot Ordering = "oldest_snapshot"
+	// The filesystem whose newest snapshot on the receiver is the oldest is replicated first.
+	// New filesystems go before all others.
+	OrderingOldestRPO Ordering = "oldest_rpo"
+	// The filesystem with the smallest sum of size estimates of its steps is replicated first.
+	OrderingSmallestFirst Ordering = "smallest_first"
+	// The filesystem with the longest sum of predicted step durations (see DurationPredictor) is replicated first.
+	OrderingLongestFirst Ordering = "longest_first"
+	// Filesystems are replicated in alphabetical order of their names.
+	OrderingAlphabetical Ordering = "alphabetical"
+)
+
+func OrderingFromConfig(in string) (Ordering, error) {
+	switch o := Ordering(in); o {
+	case OrderingOldestSnapshot, OrderingOldestRPO, OrderingSmallestFirst, OrderingLongestFirst, OrderingAlphabetical:
+		return o, nil
+	default:
+		return "", errors.Errorf("%q is not in oldest_snapshot, oldest_rpo, smallest_first, longest_first, alphabetical", in)
+	}
+}
+
+// FilesystemWeights returns the weight (>= 1) of the filesystem fs, named as on the sender.
+type FilesystemWeights func(fs string) int
+
+// StepRecorder records the replication steps that completed successfully.
+// RecordStep must not block replication for long and handles its errors itself.
+type StepRecorder interface {
+	RecordStep(ctx context.Context, fs string, from, to *pdu.FilesystemVersion, bytes int64, duration time.Duration)
+}
+
+// DurationPredictor predicts the duration of a step of filesystem fs that transfers bytes,
+// e.g., from the throughput of previous steps. Returns false if no prediction is possible.
+type DurationPredictor interface {
+	PredictDuration(fs string, bytes int64) (time.Duration, bool)
+}
+
+// ReplicatedSnapshotObserver observes the newest snapshot of a filesystem that is present on the receiver.
+// fs is the name of the filesystem on the sender.
+type ReplicatedSnapshotObserver interface {
+	ObserveReplicatedSnapshot(fs string, newest *pdu.FilesystemVersion)
 }
 
 func ReplicationConfigFromConfig(in *config.Replication) (*pdu.ReplicationConfig, error) {
@@ -0,0 +1,94 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/zrepl/zrepl/replication/logic/diff"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// SenderRecreatedError is returned by filesystem planning if the sender and the receiver both have versions
+// of the filesystem but none of the sender's versions is part of the receiver's history,
+// which is what happens if the sender filesystem is destroyed and re-created under the same name.
+type SenderRecreatedError struct {
+	Conflict *ConflictNoCommonAncestor
+}
+
+func (e *SenderRecreatedError) Error() string {
+	return fmt.Sprintf("sender filesystem was presumably destroyed and re-created: none of its versions exist on the receiver "+
+		"(rename or destroy the receiver filesystem or enable `archive_recreated_filesystems` to replicate it from scratch)\n%s", e.Conflict)
+}
+
+// senderRecreated returns a *SenderRecreatedError if conflict (as returned by IncrementalPath)
+// indicates that the sender filesystem was re-created, and nil otherwise.
+//
+// Having no version in common is not sufficient: the receiver may have diverged, or the common versions
+// may have been pruned. A re-created filesystem's snapshots are all taken after the original filesystem
+// was destroyed, i.e., after the receiver's newest version, and the receiver's history does not contain
+// the sender's oldest snapshot. If the sender has a snapshot that is older than the receiver's newest version,
+// the conflict is left to the caller's generic handling.
+func senderRecreated(conflict error) *SenderRecreatedError {
+	noCommonAncestor, ok := conflict.(*ConflictNoCommonAncestor)
+	if !ok {
+		return nil
+	}
+	var senderOldest *pdu.FilesystemVersion
+	for _, v := range noCommonAncestor.SortedSenderVersions {
+		if v.GetType() == pdu.FilesystemVersion_Snapshot {
+			senderOldest = v
+			break
+		}
+	}
+	rvs := noCommonAncestor.SortedReceiverVersions
+	if senderOldest == nil || len(rvs) == 0 {
+		return nil
+	}
+	for _, rv := range rvs {
+		if rv.GetGuid() == senderOldest.GetGuid() {
+			return nil
+		}
+	}
+	senderOldestCreation, err := senderOldest.CreationAsTime()
+	if err != nil {
+		return nil
+	}
+	receiverNewestCreation, err := rvs[len(rvs)-1].CreationAsTime()
+	if err != nil {
+		return nil
+	}
+	if !senderOldestCreation.After(receiverNewestCreation) {
+		return nil
+	}
+	return &SenderRecreatedError{Conflict: noCommonAncestor}
+}
+
+// NoCommonSnapshotError is returned instead of a *SenderRecreatedError if the sender's snapshots are
+// externally managed (PlannerPolicy.SenderSnapshotsExternallyManaged): without a replication cursor
+// or holds on the sender, the more likely cause is that the external tool destroyed
+// the snapshots that the receiver has.
+type NoCommonSnapshotError struct {
+	Conflict *ConflictNoCommonAncestor
+}
+
+func (e *NoCommonSnapshotError) Error() string {
+	return fmt.Sprintf("no common snapshot: the sender's snapshots are externally managed and none of them exist on the receiver, "+
+		"the tool that manages them must keep the most recent replicated snapshot "+
+		"(rename or destroy the receiver filesystem or enable `archive_recreated_filesystems` to replicate it from scratch)\n%s", e.Conflict)
+}
+
+func archivedFilesystemName(fs string, now time.Time) string {
+	return fmt.Sprintf("%s_old_%s", fs, now.UTC().Format("20060102_150405"))
+}
+
+// archiveReceiverFS renames the receiver filesystem (and thereby its children) out of the way
+// so that the filesystem can be replicated from scratch. It returns the new name.
+func (fs *Filesystem) archiveReceiverFS(ctx context.Context, now time.Time) (string, error) {
+	archive := archivedFilesystemName(fs.Path, now)
+	_, err := fs.receiver.RenameFilesystem(ctx, &pdu.RenameFilesystemReq{Filesystem: fs.Path, NewFilesystem: archive})
+	if err != nil {
+		return "", fmt.Errorf("cannot archive receiver filesystem %q as %q: %s", fs.Path, archive, err)
+	}
+	return archive, nil
+}
@@ -0,0 +1,51 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/diff"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestSenderRecreated(t *testing.T) {
+	// creation time and createtxg increase with the guid
+	snap := func(name string, guid uint64) *pdu.FilesystemVersion {
+		creation := pdu.FilesystemVersionCreation(time.Unix(int64(guid), 0))
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: name, Guid: guid, CreateTXG: guid, Creation: creation}
+	}
+
+	// the receiver has the history of the original filesystem, the re-created filesystem's snapshots are unrelated
+	_, conflict := diff.IncrementalPath([]*pdu.FilesystemVersion{snap("a", 1), snap("b", 2)}, []*pdu.FilesystemVersion{snap("c", 3)})
+	recreated := senderRecreated(conflict)
+	require.NotNil(t, recreated)
+	assert.Contains(t, recreated.Error(), "destroyed and re-created")
+	noCommon := &NoCommonSnapshotError{Conflict: recreated.Conflict}
+	assert.Contains(t, noCommon.Error(), "externally managed")
+
+	// initial replication
+	_, conflict = diff.IncrementalPath(nil, []*pdu.FilesystemVersion{snap("a", 1)})
+	require.Error(t, conflict)
+	assert.Nil(t, senderRecreated(conflict))
+
+	// diverged
+	_, conflict = diff.IncrementalPath([]*pdu.FilesystemVersion{snap("a", 1), snap("x", 4)}, []*pdu.FilesystemVersion{snap("a", 1), snap("b", 2)})
+	require.Error(t, conflict)
+	assert.Nil(t, senderRecreated(conflict))
+
+	// no common version, but the sender has a snapshot that is older than the receiver's newest snapshot:
+	// the receiver has diverged or the common snapshots were pruned, the filesystem was not re-created
+	_, conflict = diff.IncrementalPath([]*pdu.FilesystemVersion{snap("a", 1), snap("x", 4)}, []*pdu.FilesystemVersion{snap("b", 2), snap("c", 5)})
+	require.IsType(t, &diff.ConflictNoCommonAncestor{}, conflict)
+	assert.Nil(t, senderRecreated(conflict))
+
+	assert.Nil(t, senderRecreated(nil))
+}
+
+func TestArchivedFilesystemName(t *testing.T) {
+	now := time.Date(2020, 3, 4, 5, 6, 7, 0, time.FixedZone("CET", 3600))
+	assert.Equal(t, "pool/backup/data_old_20200304_040607", archivedFilesystemName("pool/backup/data", now))
+}
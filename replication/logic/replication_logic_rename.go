@@ -0,0 +1,162 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+type fsRename struct {
+	From, To string
+}
+
+// planRenames matches filesystems that only exist on the sender with filesystems that only exist on the receiver
+// by the GUIDs of their snapshots (renaming a filesystem preserves the snapshot GUIDs).
+// senderOnly and receiverOnly map filesystem paths to snapshot GUIDs.
+//
+// Renames are returned in the order in which they must be applied.
+// Renaming a filesystem also renames its children, so children that were renamed along with their parent
+// do not require a rename of their own.
+// Sender filesystems that match more than one receiver filesystem are returned as ambiguous and not renamed.
+func planRenames(senderOnly, receiverOnly map[string][]uint64) (renames []fsRename, ambiguous []string) {
+
+	byGUID := make(map[uint64]map[string]bool)
+	current := make(map[string]string, len(receiverOnly)) // original receiver path => path after the renames so far
+	for rp, guids := range receiverOnly {
+		current[rp] = rp
+		for _, g := range guids {
+			if byGUID[g] == nil {
+				byGUID[g] = make(map[string]bool)
+			}
+			byGUID[g][rp] = true
+		}
+	}
+
+	sps := make([]string, 0, len(senderOnly))
+	for sp := range senderOnly {
+		sps = append(sps, sp)
+	}
+	sort.Strings(sps) // parents before children
+
+	claimed := make(map[string]bool)
+	for _, sp := range sps {
+		candidates := make(map[string]bool)
+		for _, g := range senderOnly[sp] {
+			for rp := range byGUID[g] {
+				if !claimed[rp] {
+					candidates[rp] = true
+				}
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		if len(candidates) > 1 {
+			ambiguous = append(ambiguous, sp)
+			continue
+		}
+		var rp string
+		for rp = range candidates {
+		}
+		claimed[rp] = true
+
+		from := current[rp]
+		if from == sp {
+			continue // renamed along with its parent
+		}
+		renames = append(renames, fsRename{From: from, To: sp})
+		for orig, cur := range current {
+			if cur == from || strings.HasPrefix(cur, from+"/") {
+				current[orig] = sp + strings.TrimPrefix(cur, from)
+			}
+		}
+	}
+	return renames, ambiguous
+}
+
+// followRenames renames the receiver's counterparts of filesystems that were renamed on the sender
+// and returns the receiver's filesystems after the renames.
+func (p *Planner) followRenames(ctx context.Context, sfss, rfss []*pdu.Filesystem) ([]*pdu.Filesystem, error) {
+	log := getLogger(ctx)
+
+	senderPaths := make(map[string]bool, len(sfss))
+	for _, fs := range sfss {
+		senderPaths[fs.Path] = true
+	}
+	receiverPaths := make(map[string]bool, len(rfss))
+	for _, fs := range rfss {
+		receiverPaths[fs.Path] = true
+	}
+
+	snapshotGUIDs := func(ep Endpoint, fs string) ([]uint64, error) {
+		res, err := ep.ListFilesystemVersions(ctx, &pdu.ListFilesystemVersionsReq{Filesystem: fs})
+		if err != nil {
+			return nil, err
+		}
+		var guids []uint64
+		for _, v := range res.GetVersions() {
+			if v.GetType() == pdu.FilesystemVersion_Snapshot {
+				guids = append(guids, v.GetGuid())
+			}
+		}
+		return guids, nil
+	}
+
+	receiverOnly := make(map[string][]uint64)
+	for _, fs := range rfss {
+		if senderPaths[fs.Path] || fs.GetIsPlaceholder() {
+			continue
+		}
+		receiverOnly[fs.Path] = nil
+	}
+	senderOnly := make(map[string][]uint64)
+	for _, fs := range sfss {
+		if !receiverPaths[fs.Path] {
+			senderOnly[fs.Path] = nil
+		}
+	}
+	if len(receiverOnly) == 0 || len(senderOnly) == 0 {
+		return rfss, nil
+	}
+
+	for fs := range receiverOnly {
+		guids, err := snapshotGUIDs(p.receiver, fs)
+		if err != nil {
+			return nil, fmt.Errorf("rename detection: cannot list receiver filesystem versions of %q: %s", fs, err)
+		}
+		receiverOnly[fs] = guids
+	}
+	for fs := range senderOnly {
+		guids, err := snapshotGUIDs(p.sender, fs)
+		if err != nil {
+			return nil, fmt.Errorf("rename detection: cannot list sender filesystem versions of %q: %s", fs, err)
+		}
+		senderOnly[fs] = guids
+	}
+
+	renames, ambiguous := planRenames(senderOnly, receiverOnly)
+	for _, fs := range ambiguous {
+		log.WithField("filesystem", fs).Warn("rename detection: snapshots of filesystem match more than one receiver filesystem, treating it as a new filesystem")
+	}
+	if len(renames) == 0 {
+		return rfss, nil
+	}
+
+	for _, r := range renames {
+		log.WithField("from", r.From).WithField("to", r.To).Info("filesystem was renamed on sender, renaming it on receiver")
+		_, err := p.receiver.RenameFilesystem(ctx, &pdu.RenameFilesystemReq{Filesystem: r.From, NewFilesystem: r.To})
+		if err != nil {
+			return nil, fmt.Errorf("rename detection: cannot rename receiver filesystem %q to %q: %s", r.From, r.To, err)
+		}
+	}
+
+	rlfssres, err := p.receiver.ListFilesystems(ctx, &pdu.ListFilesystemReq{})
+	if err != nil {
+		log.WithError(err).WithField("errType", fmt.Sprintf("%T", err)).Error("error listing receiver filesystems")
+		return nil, err
+	}
+	return rlfssres.GetFilesystems(), nil
+}
@@ -0,0 +1,75 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanRenames(t *testing.T) {
+
+	type testCase struct {
+		name         string
+		senderOnly   map[string][]uint64
+		receiverOnly map[string][]uint64
+		renames      []fsRename
+		ambiguous    []string
+	}
+
+	tcs := []testCase{
+		{
+			name:         "simple",
+			senderOnly:   map[string][]uint64{"pool/b": {1, 2}},
+			receiverOnly: map[string][]uint64{"pool/a": {1}},
+			renames:      []fsRename{{"pool/a", "pool/b"}},
+		},
+		{
+			name:         "new_filesystem",
+			senderOnly:   map[string][]uint64{"pool/b": {3}},
+			receiverOnly: map[string][]uint64{"pool/a": {1}},
+		},
+		{
+			name:         "no_snapshots",
+			senderOnly:   map[string][]uint64{"pool/b": nil},
+			receiverOnly: map[string][]uint64{"pool/a": nil},
+		},
+		{
+			name:         "children_move_with_parent",
+			senderOnly:   map[string][]uint64{"pool/b": {1}, "pool/b/c": {2}, "pool/b/c/d": {3}},
+			receiverOnly: map[string][]uint64{"pool/a": {1}, "pool/a/c": {2}, "pool/a/c/d": {3}},
+			renames:      []fsRename{{"pool/a", "pool/b"}},
+		},
+		{
+			name:         "child_renamed_after_parent",
+			senderOnly:   map[string][]uint64{"pool/b": {1}, "pool/b/x": {2}},
+			receiverOnly: map[string][]uint64{"pool/a": {1}, "pool/a/c": {2}},
+			renames:      []fsRename{{"pool/a", "pool/b"}, {"pool/b/c", "pool/b/x"}},
+		},
+		{
+			name:         "moved_to_other_parent",
+			senderOnly:   map[string][]uint64{"pool/x/y/a": {1}},
+			receiverOnly: map[string][]uint64{"pool/a": {1}},
+			renames:      []fsRename{{"pool/a", "pool/x/y/a"}},
+		},
+		{
+			name:         "ambiguous",
+			senderOnly:   map[string][]uint64{"pool/b": {1, 2}},
+			receiverOnly: map[string][]uint64{"pool/a1": {1}, "pool/a2": {2}},
+			ambiguous:    []string{"pool/b"},
+		},
+		{
+			name:         "receiver_fs_claimed_once",
+			senderOnly:   map[string][]uint64{"pool/b1": {1}, "pool/b2": {1}},
+			receiverOnly: map[string][]uint64{"pool/a": {1}},
+			renames:      []fsRename{{"pool/a", "pool/b1"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			renames, ambiguous := planRenames(tc.senderOnly, tc.receiverOnly)
+			assert.Equal(t, tc.renames, renames)
+			assert.Equal(t, tc.ambiguous, ambiguous)
+		})
+	}
+}
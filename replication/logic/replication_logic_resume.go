@@ -0,0 +1,74 @@
+package logic
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// A resume token is stale if it cannot be resumed because its `to` snapshot no longer exists on the sender
+// (e.g., it was pruned) or if the partial receive state has existed for longer than maxAge (if maxAge > 0),
+// i.e., if it was first seen more than maxAge before now.
+func resumeTokenIsStale(sfsvs []*pdu.FilesystemVersion, token *zfs.ResumeToken, maxAge time.Duration, firstSeen, now time.Time) (stale bool, reason string) {
+	if !token.HasToGUID {
+		return false, ""
+	}
+	var to *pdu.FilesystemVersion
+	for _, v := range sfsvs {
+		if v.GetType() == pdu.FilesystemVersion_Snapshot && v.GetGuid() == token.ToGUID {
+			to = v
+			break
+		}
+	}
+	if to == nil {
+		return true, fmt.Sprintf("snapshot %q no longer exists on sender", token.ToName)
+	}
+	if age := now.Sub(firstSeen); maxAge > 0 && age > maxAge {
+		return true, fmt.Sprintf("partial receive of snapshot %q has existed for longer than %s", token.ToName, maxAge)
+	}
+	return false, ""
+}
+
+// PartialReceiveAges tracks when the partial receive state of each receiver filesystem was first seen.
+// ZFS does not record when a partial receive started, so this is the best approximation available
+// to the active side. The state does not survive daemon restarts, i.e., the age is counted from
+// the first replication attempt after a restart.
+type PartialReceiveAges struct {
+	mtx       sync.Mutex
+	firstSeen map[string]partialReceive
+}
+
+type partialReceive struct {
+	// the resume token's offsets change while the receive progresses, so the step is identified by its guids
+	fromGUID, toGUID uint64
+	firstSeen        time.Time
+}
+
+func NewPartialReceiveAges() *PartialReceiveAges {
+	return &PartialReceiveAges{
+		firstSeen: make(map[string]partialReceive),
+	}
+}
+
+// observe returns when the partial receive state of fs described by token was first seen,
+// which is now if token describes a different step than the one last observed for fs.
+func (a *PartialReceiveAges) observe(fs string, token *zfs.ResumeToken, now time.Time) time.Time {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	pr, ok := a.firstSeen[fs]
+	if !ok || pr.fromGUID != token.FromGUID || pr.toGUID != token.ToGUID {
+		pr = partialReceive{token.FromGUID, token.ToGUID, now}
+		a.firstSeen[fs] = pr
+	}
+	return pr.firstSeen
+}
+
+// forget is called for filesystems without partial receive state.
+func (a *PartialReceiveAges) forget(fs string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	delete(a.firstSeen, fs)
+}
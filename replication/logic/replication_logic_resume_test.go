@@ -0,0 +1,69 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestResumeTokenIsStale(t *testing.T) {
+
+	now := time.Unix(1000000, 0)
+	snap := func(guid uint64, age time.Duration) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{
+			Type:     pdu.FilesystemVersion_Snapshot,
+			Name:     "s",
+			Guid:     guid,
+			Creation: pdu.FilesystemVersionCreation(now.Add(-age)),
+		}
+	}
+	sfsvs := []*pdu.FilesystemVersion{snap(1, 48*time.Hour), snap(2, time.Hour)}
+
+	type testCase struct {
+		name     string
+		token    zfs.ResumeToken
+		tokenAge time.Duration
+		stale    bool
+	}
+	tcs := []testCase{
+		{"recent_snapshot_fresh_token", zfs.ResumeToken{HasToGUID: true, ToGUID: 2}, time.Hour, false},
+		{"old_snapshot_fresh_token", zfs.ResumeToken{HasToGUID: true, ToGUID: 1}, time.Hour, false},
+		{"old_token", zfs.ResumeToken{HasToGUID: true, ToGUID: 2}, 25 * time.Hour, true},
+		{"pruned_on_sender", zfs.ResumeToken{HasToGUID: true, ToGUID: 3}, time.Hour, true},
+		{"no_toguid", zfs.ResumeToken{}, 25 * time.Hour, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			stale, reason := resumeTokenIsStale(sfsvs, &tc.token, 24*time.Hour, now.Add(-tc.tokenAge), now)
+			assert.Equal(t, tc.stale, stale)
+			assert.Equal(t, tc.stale, reason != "")
+		})
+	}
+
+	// without maxAge, only tokens whose `to` snapshot no longer exists on the sender are stale
+	stale, _ := resumeTokenIsStale(sfsvs, &zfs.ResumeToken{HasToGUID: true, ToGUID: 2}, 0, now.Add(-48*time.Hour), now)
+	assert.False(t, stale)
+	stale, _ = resumeTokenIsStale(sfsvs, &zfs.ResumeToken{HasToGUID: true, ToGUID: 3}, 0, now, now)
+	assert.True(t, stale)
+}
+
+func TestPartialReceiveAges(t *testing.T) {
+	t0 := time.Unix(1000000, 0)
+	a := NewPartialReceiveAges()
+	step := &zfs.ResumeToken{HasFromGUID: true, FromGUID: 1, HasToGUID: true, ToGUID: 2}
+
+	assert.Equal(t, t0, a.observe("pool/a", step, t0))
+	// the same step observed later keeps its first-seen time, even if the token changed
+	assert.Equal(t, t0, a.observe("pool/a", &zfs.ResumeToken{HasFromGUID: true, FromGUID: 1, HasToGUID: true, ToGUID: 2, ToName: "pool/a@s2"}, t0.Add(time.Hour)))
+	// a different step restarts the clock
+	t1 := t0.Add(2 * time.Hour)
+	assert.Equal(t, t1, a.observe("pool/a", &zfs.ResumeToken{HasFromGUID: true, FromGUID: 2, HasToGUID: true, ToGUID: 3}, t1))
+	// so does a receive that completed in the meantime
+	a.forget("pool/a")
+	t2 := t0.Add(3 * time.Hour)
+	assert.Equal(t, t2, a.observe("pool/a", &zfs.ResumeToken{HasFromGUID: true, FromGUID: 2, HasToGUID: true, ToGUID: 3}, t2))
+}
@@ -0,0 +1,43 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/zrepl/zrepl/replication/logic/diff"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// rollbackTarget returns the receiver's snapshot of the most recent common ancestor of a diverged conflict,
+// and the receiver's versions that remain after rolling back to it.
+// It returns a nil target if the receiver only has a bookmark of the common ancestor.
+func rollbackTarget(conflict *ConflictDiverged) (target *pdu.FilesystemVersion, remaining []*pdu.FilesystemVersion) {
+	for _, v := range conflict.SortedReceiverVersions {
+		if v.GetGuid() == conflict.CommonAncestor.GetGuid() && v.Type == pdu.FilesystemVersion_Snapshot {
+			target = v
+		}
+	}
+	if target == nil {
+		return nil, nil
+	}
+	for _, v := range conflict.SortedReceiverVersions {
+		if v.CreateTXG <= target.CreateTXG {
+			remaining = append(remaining, v)
+		}
+	}
+	return target, remaining
+}
+
+// rollbackDivergedReceiver rolls the receiver filesystem back to the most recent common snapshot,
+// destroying the receiver-only versions, and returns the receiver's remaining versions.
+func (fs *Filesystem) rollbackDivergedReceiver(ctx context.Context, conflict *ConflictDiverged) ([]*pdu.FilesystemVersion, error) {
+	target, remaining := rollbackTarget(conflict)
+	if target == nil {
+		return nil, fmt.Errorf("cannot roll back receiver filesystem %q: the most recent common version %s is not a snapshot on the receiver", fs.Path, conflict.CommonAncestor.RelName())
+	}
+	_, err := fs.receiver.Rollback(ctx, &pdu.RollbackReq{Filesystem: fs.Path, Snapshot: target})
+	if err != nil {
+		return nil, fmt.Errorf("cannot roll back receiver filesystem %q to %s: %s", fs.Path, target.RelName(), err)
+	}
+	return remaining, nil
+}
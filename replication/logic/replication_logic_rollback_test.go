@@ -0,0 +1,48 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/zrepl/zrepl/replication/logic/diff"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestRollbackTarget(t *testing.T) {
+	creation := pdu.FilesystemVersionCreation(time.Unix(0, 0))
+	snap := func(name string, guid uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: name, Guid: guid, CreateTXG: guid, Creation: creation}
+	}
+	bookmark := func(name string, guid uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Bookmark, Name: name, Guid: guid, CreateTXG: guid, Creation: creation}
+	}
+
+	_, conflict := IncrementalPath(
+		[]*pdu.FilesystemVersion{snap("a", 1), snap("b", 2), snap("x", 4)},
+		[]*pdu.FilesystemVersion{snap("a", 1), snap("b", 2), snap("c", 3)},
+	)
+	diverged, ok := conflict.(*ConflictDiverged)
+	require.True(t, ok)
+	target, remaining := rollbackTarget(diverged)
+	require.NotNil(t, target)
+	assert.Equal(t, "b", target.Name)
+	assert.Equal(t, []*pdu.FilesystemVersion{snap("a", 1), snap("b", 2)}, remaining)
+
+	// after the rollback, the path is incremental from the common ancestor
+	path, conflict := IncrementalPath(remaining, []*pdu.FilesystemVersion{snap("a", 1), snap("b", 2), snap("c", 3)})
+	require.NoError(t, conflict)
+	assert.Equal(t, []string{"b", "c"}, []string{path[0].Name, path[1].Name})
+
+	// the receiver only has a bookmark of the common ancestor
+	_, conflict = IncrementalPath(
+		[]*pdu.FilesystemVersion{bookmark("b", 2), snap("x", 4)},
+		[]*pdu.FilesystemVersion{snap("b", 2), snap("c", 3)},
+	)
+	diverged, ok = conflict.(*ConflictDiverged)
+	require.True(t, ok)
+	target, _ = rollbackTarget(diverged)
+	assert.Nil(t, target)
+}
@@ -0,0 +1,38 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithStepTimeout(t *testing.T) {
+	blocking := func(ctx context.Context) error {
+		<-ctx.Done()
+		return errors.New("send aborted")
+	}
+
+	err := withStepTimeout(context.Background(), 10*time.Millisecond, blocking)
+	require.Error(t, err)
+	timeoutErr, ok := err.(*StepTimeoutError)
+	require.True(t, ok, "%T", err)
+	assert.Equal(t, 10*time.Millisecond, timeoutErr.Timeout)
+	assert.EqualError(t, timeoutErr.Cause, "send aborted")
+
+	// cancellation of the parent context is not a step timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	err = withStepTimeout(ctx, time.Hour, blocking)
+	_, ok = err.(*StepTimeoutError)
+	assert.False(t, ok, "%T", err)
+
+	assert.NoError(t, withStepTimeout(context.Background(), 0, func(ctx context.Context) error {
+		_, hasDeadline := ctx.Deadline()
+		assert.False(t, hasDeadline)
+		return nil
+	}))
+}
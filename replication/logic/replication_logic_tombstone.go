@@ -0,0 +1,161 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// DeletedFilesystemsAction determines how receiver filesystems whose sender filesystem no longer exists are handled.
+type DeletedFilesystemsAction string
+
+const (
+	// Receiver filesystems are left as they are.
+	DeletedFilesystemsKeep DeletedFilesystemsAction = "keep"
+	// Receiver filesystems are renamed to a tombstone (pdu.TombstoneName) and kept.
+	DeletedFilesystemsRename DeletedFilesystemsAction = "rename"
+	// Receiver filesystems are renamed to a tombstone, which is destroyed
+	// through the receiver's DestroyFilesystem RPC once it is older than PlannerPolicy.DestroyTombstonesAfter.
+	DeletedFilesystemsDestroy DeletedFilesystemsAction = "destroy"
+)
+
+func DeletedFilesystemsActionFromConfig(in string) (DeletedFilesystemsAction, error) {
+	switch a := DeletedFilesystemsAction(in); a {
+	case DeletedFilesystemsKeep, DeletedFilesystemsRename, DeletedFilesystemsDestroy:
+		return a, nil
+	default:
+		return "", errors.Errorf("%q is not in keep, rename, destroy", in)
+	}
+}
+
+// receiver filesystems archived by archive_recreated_filesystems, see archivedFilesystemName
+var archivedFilesystemRE = regexp.MustCompile(`_old_[0-9]{8}_[0-9]{6}$`)
+
+type tombstonePlan struct {
+	// receiver filesystems to rename to tombstones, parents before children
+	tombstones []fsRename
+	// tombstones that have expired
+	destroy []string
+	// receiver filesystems that only exist on the receiver but are not tombstoned
+	// because the sender still has some of their descendants, e.g., after a change of the sender's filesystem filter
+	kept []string
+}
+
+// planTombstones plans the tombstones of the receiver filesystems rfss that no longer exist on the sender (senderPaths)
+// and the destruction of expired tombstones.
+// Placeholders, filesystems archived by archive_recreated_filesystems and filesystems within a tombstone are left alone.
+// Renaming a filesystem to a tombstone also renames its children, so those are not tombstoned on their own.
+func planTombstones(senderPaths []string, rfss []*pdu.Filesystem, action DeletedFilesystemsAction, destroyAfter time.Duration, now time.Time) (plan tombstonePlan) {
+
+	isBelow := func(fs, ancestor string) bool { return strings.HasPrefix(fs, ancestor+"/") }
+
+	onSender := make(map[string]bool, len(senderPaths))
+	for _, sp := range senderPaths {
+		onSender[sp] = true
+	}
+
+	rps := make([]string, 0, len(rfss))
+	for _, fs := range rfss {
+		if !fs.GetIsPlaceholder() {
+			rps = append(rps, fs.GetPath())
+		}
+	}
+	sort.Strings(rps) // parents before children
+
+	var skipSubtrees []string
+rfss_loop:
+	for _, rp := range rps {
+		for _, st := range skipSubtrees {
+			if isBelow(rp, st) {
+				continue rfss_loop
+			}
+		}
+
+		// a sender filesystem may have a tombstone or archive name, too
+		if onSender[rp] {
+			continue
+		}
+		if _, deleted, ok := pdu.ParseTombstoneName(rp); ok {
+			skipSubtrees = append(skipSubtrees, rp)
+			if action == DeletedFilesystemsDestroy && now.Sub(deleted) >= destroyAfter {
+				plan.destroy = append(plan.destroy, rp)
+			}
+			continue
+		}
+		if archivedFilesystemRE.MatchString(rp) {
+			skipSubtrees = append(skipSubtrees, rp)
+			continue
+		}
+		for _, sp := range senderPaths {
+			if isBelow(sp, rp) {
+				plan.kept = append(plan.kept, rp)
+				continue rfss_loop
+			}
+		}
+
+		plan.tombstones = append(plan.tombstones, fsRename{From: rp, To: pdu.TombstoneName(rp, now)})
+		skipSubtrees = append(skipSubtrees, rp)
+	}
+	return plan
+}
+
+// handleDeletedFilesystems renames the receiver's counterparts of filesystems that no longer exist on the sender
+// to tombstones and destroys expired tombstones, according to PlannerPolicy.DeletedFilesystems.
+// Errors of individual renames and destroys are logged and do not affect the replication of the other filesystems.
+// If any receiver filesystem was renamed or destroyed, the receiver's filesystems are listed again and returned,
+// otherwise rfss is returned.
+func (p *Planner) handleDeletedFilesystems(ctx context.Context, sfss, rfss []*pdu.Filesystem) ([]*pdu.Filesystem, error) {
+	if p.policy.DeletedFilesystems == "" || p.policy.DeletedFilesystems == DeletedFilesystemsKeep {
+		return rfss, nil
+	}
+	log := getLogger(ctx)
+
+	if len(sfss) == 0 {
+		// more likely a misconfiguration or a pool that is not imported than the deletion of all filesystems
+		log.Warn("deleted filesystems: sender has no filesystems, not tombstoning any receiver filesystem")
+		return rfss, nil
+	}
+	senderPaths := make([]string, len(sfss))
+	for i, fs := range sfss {
+		senderPaths[i] = fs.GetPath()
+	}
+
+	plan := planTombstones(senderPaths, rfss, p.policy.DeletedFilesystems, p.policy.DestroyTombstonesAfter, time.Now())
+
+	for _, fs := range plan.kept {
+		log.WithField("filesystem", fs).
+			Warn("deleted filesystems: filesystem no longer exists on sender but some of its children do, not tombstoning it")
+	}
+	for _, r := range plan.tombstones {
+		log.WithField("filesystem", r.From).WithField("tombstone", r.To).
+			Warn("deleted filesystems: filesystem no longer exists on sender, renaming receiver filesystem to tombstone")
+		_, err := p.receiver.RenameFilesystem(ctx, &pdu.RenameFilesystemReq{Filesystem: r.From, NewFilesystem: r.To})
+		if err != nil {
+			log.WithError(err).WithField("filesystem", r.From).Error("deleted filesystems: cannot rename receiver filesystem to tombstone")
+		}
+	}
+	for _, fs := range plan.destroy {
+		log.WithField("tombstone", fs).Warn("deleted filesystems: destroying expired tombstone")
+		_, err := p.receiver.DestroyFilesystem(ctx, &pdu.DestroyFilesystemReq{Filesystem: fs})
+		if err != nil {
+			log.WithError(err).WithField("tombstone", fs).Error("deleted filesystems: cannot destroy tombstone")
+		}
+	}
+	if len(plan.tombstones) == 0 && len(plan.destroy) == 0 {
+		return rfss, nil
+	}
+
+	rlfssres, err := p.receiver.ListFilesystems(ctx, &pdu.ListFilesystemReq{})
+	if err != nil {
+		log.WithError(err).WithField("errType", fmt.Sprintf("%T", err)).Error("error listing receiver filesystems")
+		return nil, err
+	}
+	return rlfssres.GetFilesystems(), nil
+}
@@ -0,0 +1,155 @@
+package logic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestPlanTombstones(t *testing.T) {
+
+	now := time.Date(2020, 4, 4, 12, 0, 0, 0, time.UTC)
+	tombstone := func(fs string) string { return pdu.TombstoneName(fs, now) }
+
+	type testCase struct {
+		name       string
+		sender     []string
+		receiver   []string
+		action     DeletedFilesystemsAction
+		tombstones []fsRename
+		destroy    []string
+		kept       []string
+	}
+
+	tcs := []testCase{
+		{
+			name:     "nothing_deleted",
+			sender:   []string{"pool/a", "pool/a/b"},
+			receiver: []string{"pool/a", "pool/a/b"},
+			action:   DeletedFilesystemsRename,
+		},
+		{
+			name:       "deleted",
+			sender:     []string{"pool/a"},
+			receiver:   []string{"pool/a", "pool/b"},
+			action:     DeletedFilesystemsRename,
+			tombstones: []fsRename{{"pool/b", tombstone("pool/b")}},
+		},
+		{
+			name:       "children_move_with_parent",
+			sender:     []string{"pool/a"},
+			receiver:   []string{"pool/a", "pool/b", "pool/b/c", "pool/b/c/d"},
+			action:     DeletedFilesystemsRename,
+			tombstones: []fsRename{{"pool/b", tombstone("pool/b")}},
+		},
+		{
+			name:       "deleted_child",
+			sender:     []string{"pool/a"},
+			receiver:   []string{"pool/a", "pool/a/b"},
+			action:     DeletedFilesystemsRename,
+			tombstones: []fsRename{{"pool/a/b", tombstone("pool/a/b")}},
+		},
+		{
+			name:       "sender_has_descendants",
+			sender:     []string{"pool/a/b"},
+			receiver:   []string{"pool/a", "pool/a/b", "pool/a/c"},
+			action:     DeletedFilesystemsRename,
+			tombstones: []fsRename{{"pool/a/c", tombstone("pool/a/c")}},
+			kept:       []string{"pool/a"},
+		},
+		{
+			name:     "archived_and_tombstones_are_left_alone",
+			sender:   []string{"pool/a"},
+			receiver: []string{"pool/a", "pool/a_old_20200101_000000", "pool/a_old_20200101_000000/c", "pool/b_deleted_20200403_000000", "pool/b_deleted_20200403_000000/c"},
+			action:   DeletedFilesystemsRename,
+		},
+		{
+			name:     "destroy_expired",
+			sender:   []string{"pool/a"},
+			receiver: []string{"pool/a", "pool/b_deleted_20200301_000000", "pool/b_deleted_20200301_000000/c_deleted_20200201_000000", "pool/c_deleted_20200403_000000"},
+			action:   DeletedFilesystemsDestroy,
+			destroy:  []string{"pool/b_deleted_20200301_000000"},
+		},
+		{
+			name:     "sender_filesystems_with_tombstone_names_are_not_tombstones",
+			sender:   []string{"pool/a", "pool/b_deleted_20200301_000000", "pool/c_old_20200101_000000"},
+			receiver: []string{"pool/a", "pool/b_deleted_20200301_000000", "pool/b_deleted_20200301_000000/d", "pool/c_old_20200101_000000", "pool/c_old_20200101_000000/e"},
+			action:   DeletedFilesystemsDestroy,
+			tombstones: []fsRename{
+				{"pool/b_deleted_20200301_000000/d", tombstone("pool/b_deleted_20200301_000000/d")},
+				{"pool/c_old_20200101_000000/e", tombstone("pool/c_old_20200101_000000/e")},
+			},
+		},
+		{
+			name:     "rename_does_not_destroy",
+			sender:   []string{"pool/a"},
+			receiver: []string{"pool/a", "pool/b_deleted_20200301_000000"},
+			action:   DeletedFilesystemsRename,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rfss := []*pdu.Filesystem{{Path: "pool", IsPlaceholder: true}}
+			for _, r := range tc.receiver {
+				rfss = append(rfss, &pdu.Filesystem{Path: r})
+			}
+			plan := planTombstones(tc.sender, rfss, tc.action, 7*24*time.Hour, now)
+			assert.Equal(t, tc.tombstones, plan.tombstones)
+			assert.Equal(t, tc.destroy, plan.destroy)
+			assert.Equal(t, tc.kept, plan.kept)
+		})
+	}
+}
+
+// tombstoneTestReceiver keeps its filesystems in memory,
+// the Receiver methods that are not overridden must not be called.
+type tombstoneTestReceiver struct {
+	Receiver
+	fss   []string
+	lists int
+}
+
+func (r *tombstoneTestReceiver) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+	r.lists++
+	res := &pdu.ListFilesystemRes{}
+	for _, fs := range r.fss {
+		res.Filesystems = append(res.Filesystems, &pdu.Filesystem{Path: fs})
+	}
+	return res, nil
+}
+
+func (r *tombstoneTestReceiver) RenameFilesystem(ctx context.Context, req *pdu.RenameFilesystemReq) (*pdu.RenameFilesystemRes, error) {
+	for i, fs := range r.fss {
+		if fs == req.GetFilesystem() {
+			r.fss[i] = req.GetNewFilesystem()
+		}
+	}
+	return &pdu.RenameFilesystemRes{}, nil
+}
+
+func TestHandleDeletedFilesystemsListsReceiverAgain(t *testing.T) {
+	ctx := context.Background()
+	sfss := []*pdu.Filesystem{{Path: "a"}}
+
+	r := &tombstoneTestReceiver{fss: []string{"a", "b"}}
+	p := NewPlanner(nil, nil, nil, r, PlannerPolicy{DeletedFilesystems: DeletedFilesystemsRename})
+	rfss, err := p.handleDeletedFilesystems(ctx, sfss, []*pdu.Filesystem{{Path: "a"}, {Path: "b"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, r.lists, "the receiver is listed again after renames")
+	require.Len(t, rfss, 2)
+	assert.Equal(t, "a", rfss[0].GetPath())
+	_, _, ok := pdu.ParseTombstoneName(rfss[1].GetPath())
+	assert.True(t, ok, "b must have been renamed to a tombstone, got %q", rfss[1].GetPath())
+
+	// without changes, the listing is reused
+	rfss, err = p.handleDeletedFilesystems(ctx, sfss, rfss)
+	require.NoError(t, err)
+	assert.Equal(t, 1, r.lists)
+	assert.Len(t, rfss, 2)
+}
@@ -0,0 +1,42 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestVersionsMissingIn(t *testing.T) {
+
+	v := func(name string, guid uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: name, Guid: guid}
+	}
+
+	intended := []*pdu.FilesystemVersion{v("a", 1), v("b", 2), v("c", 3)}
+
+	assert.Empty(t, versionsMissingIn(intended, []*pdu.FilesystemVersion{v("x", 0), v("a", 1), v("b", 2), v("c", 3)}))
+	assert.Empty(t, versionsMissingIn(nil, []*pdu.FilesystemVersion{v("a", 1)}))
+
+	missing := versionsMissingIn(intended, []*pdu.FilesystemVersion{v("a", 1), v("c", 3)})
+	assert.Equal(t, []*pdu.FilesystemVersion{v("b", 2)}, missing)
+
+	// same name but different GUID must be considered missing
+	missing = versionsMissingIn(intended, []*pdu.FilesystemVersion{v("a", 1), v("b", 23), v("c", 3)})
+	assert.Equal(t, []*pdu.FilesystemVersion{v("b", 2)}, missing)
+
+	assert.Equal(t, intended, versionsMissingIn(intended, nil))
+}
+
+func TestNewestSnapshot(t *testing.T) {
+	v := func(t pdu.FilesystemVersion_VersionType, name string, txg uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: t, Name: name, CreateTXG: txg}
+	}
+	snap, book := pdu.FilesystemVersion_Snapshot, pdu.FilesystemVersion_Bookmark
+
+	assert.Nil(t, newestSnapshot(nil))
+	assert.Nil(t, newestSnapshot([]*pdu.FilesystemVersion{v(book, "a", 1)}))
+	vs := []*pdu.FilesystemVersion{v(snap, "a", 1), v(book, "c", 3), v(snap, "b", 2)}
+	assert.Equal(t, "b", newestSnapshot(vs).Name)
+}
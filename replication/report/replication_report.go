@@ -9,6 +9,7 @@ type Report struct {
 	StartAt, FinishAt                      time.Time
 	WaitReconnectSince, WaitReconnectUntil time.Time
 	WaitReconnectError                     *TimedError
+	WaitServerBusyUntil                    time.Time
 	Attempts                               []*AttemptReport
 }
 
@@ -40,6 +41,29 @@ type AttemptReport struct {
 	StartAt, FinishAt time.Time
 	PlanError         *TimedError
 	Filesystems       []*FilesystemReport
+	// Receiver filesystems without a corresponding sender filesystem, as of planning.
+	OrphanedFilesystems []*OrphanedFilesystemReport `json:",omitempty"`
+}
+
+type OrphanKind string
+
+const (
+	// The sender filesystem no longer exists or is no longer matched by the sender's filter.
+	OrphanDeleted OrphanKind = "deleted"
+	// A tombstone of replication.deleted_filesystems, see pdu.TombstoneName.
+	OrphanTombstone OrphanKind = "tombstone"
+	// Archived by replication.archive_recreated_filesystems.
+	OrphanArchived OrphanKind = "archived"
+)
+
+// OrphanedFilesystemReport describes a receiver filesystem that has no corresponding sender filesystem.
+// The children of tombstones and archived filesystems are not reported individually.
+type OrphanedFilesystemReport struct {
+	Name string // as presented by the receiver
+	Kind OrphanKind
+	// The receiver's most recent snapshot of the filesystem, empty if it has none or the versions could not be listed.
+	NewestSnapshot         string    `json:",omitempty"`
+	NewestSnapshotCreation time.Time `json:",omitempty"`
 }
 
 type AttemptState string
@@ -59,7 +83,10 @@ const (
 	FilesystemPlanningErrored FilesystemState = "planning-error"
 	FilesystemStepping        FilesystemState = "stepping"
 	FilesystemSteppingErrored FilesystemState = "step-error"
+	FilesystemVerifyErrored   FilesystemState = "verify-error"
 	FilesystemDone            FilesystemState = "done"
+	// The filesystem was deliberately not replicated in this attempt, which is not an error, see SkipReason.
+	FilesystemSkipped FilesystemState = "skipped"
 )
 
 type FilesystemReport struct {
@@ -71,14 +98,27 @@ type FilesystemReport struct {
 	PlanError *TimedError
 	// Valid in State = FilesystemSteppingErrored
 	StepError *TimedError
+	// Valid in State = FilesystemVerifyErrored
+	VerifyError *TimedError
+	// Valid in State = FilesystemSkipped
+	SkipReason string `json:",omitempty"`
 
 	// Valid in State = FilesystemStepping
 	CurrentStep int
 	Steps       []*StepReport
+
+	// nil if verification is disabled or has not completed yet
+	Verification *FilesystemVerificationReport
+}
+
+type FilesystemVerificationReport struct {
+	// Versions that were replicated according to the plan but are not present on the receiver.
+	Missing []string
 }
 
 type FilesystemInfo struct {
-	Name string
+	Name  string
+	IsNew bool // the filesystem has not been replicated to the receiver yet
 }
 
 type StepReport struct {
@@ -99,6 +139,11 @@ type StepInfo struct {
 	Encrypted       EncryptedEnum
 	BytesExpected   int64
 	BytesReplicated int64
+	// Estimated size of the sent data uncompressed and as stored on the sender, 0 if unknown.
+	// BytesExpected is the size of the stream, which is either of the two, depending on whether the send is raw.
+	BytesExpectedLogical, BytesExpectedPhysical int64 `json:",omitempty"`
+	// Predicted duration of the step based on the replication history, 0 if unknown.
+	PredictedDuration time.Duration `json:",omitempty"`
 }
 
 func (a *AttemptReport) BytesSum() (expected, replicated int64, containsInvalidSizeEstimates bool) {
@@ -111,6 +156,21 @@ func (a *AttemptReport) BytesSum() (expected, replicated int64, containsInvalidS
 	return expected, replicated, containsInvalidSizeEstimates
 }
 
+// PredictedRemaining returns the sum of the predicted durations of the steps that have not completed yet,
+// false if any of them lacks a prediction.
+func (f *FilesystemReport) PredictedRemaining() (d time.Duration, ok bool) {
+	for i, step := range f.Steps {
+		if i < f.CurrentStep {
+			continue
+		}
+		if step.Info.PredictedDuration == 0 {
+			return 0, false
+		}
+		d += step.Info.PredictedDuration
+	}
+	return d, true
+}
+
 func (f *FilesystemReport) BytesSum() (expected, replicated int64, containsInvalidSizeEstimates bool) {
 	for _, step := range f.Steps {
 		expected += step.Info.BytesExpected
@@ -136,6 +196,8 @@ func (f *FilesystemReport) Error() *TimedError {
 		return f.PlanError
 	case FilesystemSteppingErrored:
 		return f.StepError
+	case FilesystemVerifyErrored:
+		return f.VerifyError
 	}
 	return nil
 }
@@ -149,6 +211,8 @@ func (f *FilesystemReport) NextStep() *StepReport {
 		return nil
 	case FilesystemSteppingErrored:
 		return nil
+	case FilesystemVerifyErrored:
+		return nil
 	case FilesystemPlanning:
 		return nil
 	case FilesystemStepping:
@@ -5,7 +5,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 
@@ -15,14 +17,21 @@ import (
 )
 
 type Client struct {
-	log Logger
-	cn  transport.Connecter
+	log          Logger
+	cn           transport.Connecter
+	invocationID InvocationIDFunc
 }
 
-func NewClient(connecter transport.Connecter, log Logger) *Client {
+// InvocationIDFunc returns the invocation ID that is sent along with a request made with ctx.
+// An empty string means that no invocation ID is sent.
+type InvocationIDFunc = func(ctx context.Context) string
+
+// invocationID may be nil
+func NewClient(connecter transport.Connecter, invocationID InvocationIDFunc, log Logger) *Client {
 	return &Client{
-		log: log,
-		cn:  connecter,
+		log:          log,
+		cn:           connecter,
+		invocationID: invocationID,
 	}
 }
 
@@ -41,6 +50,16 @@ func (c *Client) send(ctx context.Context, conn *stream.Conn, endpoint string, r
 	if err != nil {
 		return err
 	}
+	if c.invocationID != nil {
+		if id := c.invocationID(ctx); id != "" {
+			// see the comment on pdu.DataconnRequestMetadata
+			metaBytes, err := proto.Marshal(&pdu.DataconnRequestMetadata{InvocationID: id})
+			if err != nil {
+				return err
+			}
+			protobufBytes = append(protobufBytes, metaBytes...)
+		}
+	}
 	protobuf := bytes.NewBuffer(protobufBytes)
 	if err := conn.WriteStreamedMessage(ctx, protobuf, ReqStructured); err != nil {
 		return err
@@ -61,6 +80,41 @@ func (e *RemoteHandlerError) Error() string {
 	return fmt.Sprintf("server error: %s", e.msg)
 }
 
+// ServerBusyError is returned if the server rejected the request because it is at its connection limits.
+// The request can be retried later.
+type ServerBusyError struct {
+	msg        string
+	retryAfter time.Duration
+}
+
+func parseServerBusyError(s string) *ServerBusyError {
+	e := &ServerBusyError{msg: s}
+	if !strings.HasPrefix(s, responseHeaderServerBusyRetryAfterPrefix) {
+		return e
+	}
+	line := strings.SplitN(strings.TrimPrefix(s, responseHeaderServerBusyRetryAfterPrefix), "\n", 2)
+	secs, err := strconv.ParseUint(line[0], 10, 32)
+	if err != nil || len(line) != 2 {
+		return e // keep the malformed hint in msg
+	}
+	e.msg = line[1]
+	e.retryAfter = time.Duration(secs) * time.Second
+	return e
+}
+
+func (e *ServerBusyError) Error() string {
+	if e.retryAfter > 0 {
+		return fmt.Sprintf("server busy: %s (retry after %s)", e.msg, e.retryAfter)
+	}
+	return fmt.Sprintf("server busy: %s", e.msg)
+}
+
+// ServerBusy marks the error as temporary to the replication driver.
+func (e *ServerBusyError) ServerBusy() bool { return true }
+
+// RetryAfter returns the time after which the server suggests to retry, or zero if it did not send a hint.
+func (e *ServerBusyError) RetryAfter() time.Duration { return e.retryAfter }
+
 type ProtocolError struct {
 	cause error
 }
@@ -80,6 +134,9 @@ func (c *Client) recv(ctx context.Context, conn *stream.Conn, res proto.Message)
 		// FIXME distinguishable error type
 		return &RemoteHandlerError{strings.TrimPrefix(header, responseHeaderHandlerErrorPrefix)}
 	}
+	if strings.HasPrefix(header, responseHeaderServerBusyPrefix) {
+		return parseServerBusyError(strings.TrimPrefix(header, responseHeaderServerBusyPrefix))
+	}
 	if !strings.HasPrefix(header, responseHeaderHandlerOk) {
 		return &ProtocolError{fmt.Errorf("invalid header: %q", header)}
 	}
@@ -133,7 +190,7 @@ func (c *Client) ReqSend(ctx context.Context, req *pdu.SendReq) (*pdu.SendRes, i
 	var stream io.ReadCloser
 	if !req.DryRun {
 		putWireOnReturn = false
-		stream, err = conn.ReadStream(ZFSStream, true) // no shadow
+		stream, err = conn.ReadStream(ctx, ZFSStream, true) // no shadow
 		if err != nil {
 			return nil, nil, err
 		}
@@ -206,11 +263,12 @@ func (c *Client) ReqRecv(ctx context.Context, req *pdu.ReceiveReq, stream io.Rea
 		c.putWire(conn)
 	}
 
-	// if receive failed with a RemoteHandlerError, we know the transport was not broken
+	// if receive failed with a RemoteHandlerError or ServerBusyError, we know the transport was not broken
 	// => take the remote error as cause for the operation to fail
 	// TODO combine errors if send also failed
 	//      (after all, send could have crashed on our side, rendering res.err a mere symptom of the cause)
-	if _, ok := res.err.(*RemoteHandlerError); ok {
+	switch res.err.(type) {
+	case *RemoteHandlerError, *ServerBusyError:
 		cause = res.err
 	}
 
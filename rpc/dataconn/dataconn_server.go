@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/zrepl/zrepl/replication/logic/pdu"
 	"github.com/zrepl/zrepl/rpc/dataconn/stream"
 	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/util/envconst"
 )
 
 // WireInterceptor has a chance to exchange the context and connection on each client connection.
@@ -36,6 +38,8 @@ type Logger = logger.Logger
 type ContextInterceptorData interface {
 	FullMethod() string
 	ClientIdentity() string
+	// InvocationID is the ID of the client's job invocation that made the request, or "" if the client did not send it.
+	InvocationID() string
 }
 
 type ContextInterceptor = func(ctx context.Context, data ContextInterceptorData, handler func(ctx context.Context))
@@ -45,8 +49,28 @@ type Server struct {
 	wi  WireInterceptor
 	ci  ContextInterceptor
 	log Logger
+
+	drainTimeout time.Duration
+
+	activeMtx sync.Mutex
+	active    map[*transport.AuthConn]context.CancelFunc
+
+	maxTransfers, maxTransfersPerClient int
+	transfersMtx                        sync.Mutex
+	transfers                           int
+	transfersByClient                   map[string]int
+	recentRejections                    []time.Time // within busyRetryAfter, ascending
 }
 
+// The retry-after hint for a client whose request is rejected while no other
+// request has been rejected recently. Each rejection within this period adds
+// a quarter of it to the hints of subsequent rejections, up to busyRetryAfterMax,
+// which spreads the retries of many clients over time.
+var (
+	busyRetryAfter    = envconst.Duration("ZREPL_DATACONN_BUSY_RETRY_AFTER", 30*time.Second)
+	busyRetryAfterMax = envconst.Duration("ZREPL_DATACONN_BUSY_RETRY_AFTER_MAX", 10*time.Minute)
+)
+
 var noopContextInteceptor = func(ctx context.Context, _ ContextInterceptorData, handler func(context.Context)) {
 	handler(ctx)
 }
@@ -57,16 +81,79 @@ func NewServer(wi WireInterceptor, ci ContextInterceptor, logger Logger, handler
 		ci = noopContextInteceptor
 	}
 	return &Server{
-		h:   handler,
-		wi:  wi,
-		ci:  ci,
-		log: logger,
+		h:      handler,
+		wi:     wi,
+		ci:     ci,
+		log:    logger,
+		active: make(map[*transport.AuthConn]context.CancelFunc),
+
+		transfersByClient: make(map[string]int),
+	}
+}
+
+// SetDrainTimeout sets the time that Serve waits for active connections
+// to finish after its context is done. Connections that are still active
+// after the drain timeout are aborted. The default is zero, i.e., abort immediately.
+// Must be called before Serve.
+func (s *Server) SetDrainTimeout(d time.Duration) {
+	s.drainTimeout = d
+}
+
+// SetConnectionLimits limits the number of send and receive requests that are
+// served concurrently, in total and per client identity. Zero means no limit.
+// Ping requests do not count towards the limits.
+// Requests that would exceed a limit are rejected with a response that
+// the client returns as a *ServerBusyError.
+// Must be called before Serve.
+func (s *Server) SetConnectionLimits(max, maxPerClient int) {
+	s.maxTransfers = max
+	s.maxTransfersPerClient = maxPerClient
+}
+
+// acquireTransfer returns a non-nil release func if the request of clientIdentity
+// can be served within the connection limits. Otherwise, it returns a description
+// of the exceeded limit and the time after which the client should retry.
+func (s *Server) acquireTransfer(clientIdentity string, now time.Time) (release func(), busy string, retryAfter time.Duration) {
+	s.transfersMtx.Lock()
+	defer s.transfersMtx.Unlock()
+	if s.maxTransfers > 0 && s.transfers >= s.maxTransfers {
+		return nil, fmt.Sprintf("all %d connections are in use", s.maxTransfers), s.rejectLocked(now)
+	}
+	if s.maxTransfersPerClient > 0 && s.transfersByClient[clientIdentity] >= s.maxTransfersPerClient {
+		return nil, fmt.Sprintf("all %d connections of client %q are in use", s.maxTransfersPerClient, clientIdentity), s.rejectLocked(now)
+	}
+	s.transfers++
+	s.transfersByClient[clientIdentity]++
+	return func() {
+		s.transfersMtx.Lock()
+		defer s.transfersMtx.Unlock()
+		s.transfers--
+		if s.transfersByClient[clientIdentity]--; s.transfersByClient[clientIdentity] == 0 {
+			delete(s.transfersByClient, clientIdentity)
+		}
+	}, "", 0
+}
+
+// rejectLocked records a rejection at now and returns its retry-after hint.
+func (s *Server) rejectLocked(now time.Time) time.Duration {
+	i := 0
+	for ; i < len(s.recentRejections) && now.Sub(s.recentRejections[i]) >= busyRetryAfter; i++ {
 	}
+	s.recentRejections = append(s.recentRejections[i:], now)
+	retryAfter := busyRetryAfter + time.Duration(len(s.recentRejections)-1)*(busyRetryAfter/4)
+	if retryAfter > busyRetryAfterMax {
+		retryAfter = busyRetryAfterMax
+	}
+	return retryAfter
 }
 
 // Serve consumes the listener, closes it as soon as ctx is closed.
 // No accept errors are returned: they are logged to the Logger passed
 // to the constructor.
+//
+// After ctx is closed, Serve waits for the active connections to finish
+// for up to the drain timeout (see SetDrainTimeout), aborts the remaining ones,
+// and logs the number of drained and aborted connections.
 func (s *Server) Serve(ctx context.Context, l transport.AuthenticatedListener) {
 	var wg sync.WaitGroup
 	defer wg.Wait()
@@ -101,28 +188,85 @@ func (s *Server) Serve(ctx context.Context, l transport.AuthenticatedListener) {
 			conns <- conn
 		}
 	}()
+	var connWg sync.WaitGroup
 	for conn := range conns {
-		wg.Add(1)
+		// register the connection before drain can run
+		connCtx, connCancel := context.WithCancel(context.Background())
+		s.activeMtx.Lock()
+		s.active[conn] = connCancel
+		s.activeMtx.Unlock()
+		connWg.Add(1)
 		go func(conn *transport.AuthConn) {
-			defer wg.Done()
-			s.serveConn(conn)
+			defer connWg.Done()
+			defer func() {
+				s.activeMtx.Lock()
+				delete(s.active, conn)
+				s.activeMtx.Unlock()
+				connCancel()
+			}()
+			s.serveConn(connCtx, conn)
 		}(conn)
 	}
+	s.drain(&connWg)
+}
+
+func (s *Server) drain(connWg *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		connWg.Wait()
+		close(done)
+	}()
+
+	s.activeMtx.Lock()
+	active := len(s.active)
+	s.activeMtx.Unlock()
+	if active == 0 {
+		<-done
+		return
+	}
+	log := s.log.WithField("active", active).WithField("drain_timeout", s.drainTimeout)
+	log.Info("stopped accepting connections, waiting for active connections to finish")
+
+	timer := time.NewTimer(s.drainTimeout)
+	defer timer.Stop()
+	aborted := 0
+	select {
+	case <-done:
+	case <-timer.C:
+		s.activeMtx.Lock()
+		for conn, cancel := range s.active {
+			cancel()
+			if err := conn.Close(); err != nil {
+				s.log.WithError(err).Error("cannot close connection while aborting it")
+			}
+			aborted++
+		}
+		s.activeMtx.Unlock()
+		<-done
+	}
+	log = log.WithField("drained", active-aborted).WithField("aborted", aborted)
+	if aborted > 0 {
+		log.Warn("drain timeout expired, aborted active connections")
+	} else {
+		log.Info("all active connections finished")
+	}
 }
 
 type contextInterceptorData struct {
 	fullMethod     string
 	clientIdentity string
+	invocationID   string
 }
 
 func (d contextInterceptorData) FullMethod() string     { return d.fullMethod }
 func (d contextInterceptorData) ClientIdentity() string { return d.clientIdentity }
+func (d contextInterceptorData) InvocationID() string   { return d.invocationID }
 
-func (s *Server) serveConn(nc *transport.AuthConn) {
+// ctx is cancelled if the connection is aborted, see drain
+func (s *Server) serveConn(ctx context.Context, nc *transport.AuthConn) {
 	s.log.Debug("serveConn begin")
 	defer s.log.Debug("serveConn done")
 
-	ctx := context.Background()
 	if s.wi != nil {
 		ctx, nc = s.wi(ctx, nc)
 	}
@@ -142,21 +286,46 @@ func (s *Server) serveConn(nc *transport.AuthConn) {
 	}
 	endpoint := string(header)
 
+	reqStructured, err := c.ReadStreamedMessage(ctx, RequestStructuredMaxSize, ReqStructured)
+	if err != nil {
+		s.log.WithError(err).Error("error reading structured part")
+		return
+	}
+
+	// see the comment on pdu.DataconnRequestMetadata
+	var meta pdu.DataconnRequestMetadata
+	if err := proto.Unmarshal(reqStructured, &meta); err != nil {
+		s.log.WithError(err).Error("cannot unmarshal request metadata")
+		return
+	}
+
 	data := contextInterceptorData{
 		fullMethod:     endpoint,
 		clientIdentity: nc.ClientIdentity(),
+		invocationID:   meta.InvocationID,
 	}
 	s.ci(ctx, data, func(ctx context.Context) {
-		s.serveConnRequest(ctx, endpoint, c)
+		s.serveConnRequest(ctx, endpoint, nc.ClientIdentity(), reqStructured, c)
 	})
 }
 
-func (s *Server) serveConnRequest(ctx context.Context, endpoint string, c *stream.Conn) {
+func (s *Server) serveConnRequest(ctx context.Context, endpoint, clientIdentity string, reqStructured []byte, c *stream.Conn) {
 
-	reqStructured, err := c.ReadStreamedMessage(ctx, RequestStructuredMaxSize, ReqStructured)
-	if err != nil {
-		s.log.WithError(err).Error("error reading structured part")
-		return
+	if endpoint == EndpointSend || endpoint == EndpointRecv {
+		release, busy, retryAfter := s.acquireTransfer(clientIdentity, time.Now())
+		if release == nil {
+			s.log.WithField("endpoint", endpoint).WithField("client", clientIdentity).WithField("reason", busy).
+				WithField("retry_after", retryAfter).Warn("rejecting request, connection limit reached")
+			var resHeaderBuf bytes.Buffer
+			resHeaderBuf.WriteString(responseHeaderServerBusyPrefix)
+			fmt.Fprintf(&resHeaderBuf, "%s%d\n", responseHeaderServerBusyRetryAfterPrefix, int64(retryAfter.Seconds()))
+			resHeaderBuf.WriteString(busy)
+			if err := c.WriteStreamedMessage(ctx, &resHeaderBuf, ResHeader); err != nil {
+				s.log.WithError(err).Error("cannot write response header")
+			}
+			return
+		}
+		defer release()
 	}
 
 	s.log.WithField("endpoint", endpoint).Debug("calling handler")
@@ -178,7 +347,7 @@ func (s *Server) serveConnRequest(ctx context.Context, endpoint string, c *strea
 			s.log.WithError(err).Error("cannot unmarshal receive request")
 			return
 		}
-		stream, err := c.ReadStream(ZFSStream, false)
+		stream, err := c.ReadStream(ctx, ZFSStream, false)
 		if err != nil {
 			s.log.WithError(err).Error("cannot open stream in receive request")
 			return
@@ -204,7 +373,7 @@ func (s *Server) serveConnRequest(ctx context.Context, endpoint string, c *strea
 	if handlerErr == nil {
 		if res == nil {
 			handlerErr = fmt.Errorf("implementation error: handler for endpoint %q returns nil error and nil result", endpoint)
-			s.log.WithError(err).Error("handle implementation error")
+			s.log.WithError(handlerErr).Error("handle implementation error")
 		} else {
 			protobufBytes, err := proto.Marshal(res)
 			if err != nil {
@@ -33,4 +33,7 @@ const (
 const (
 	responseHeaderHandlerOk          = "HANDLER OK\n"
 	responseHeaderHandlerErrorPrefix = "HANDLER ERROR:\n"
+	responseHeaderServerBusyPrefix   = "SERVER BUSY:\n"
+	// optional first line after responseHeaderServerBusyPrefix, followed by the hint in seconds
+	responseHeaderServerBusyRetryAfterPrefix = "RETRY AFTER: "
 )
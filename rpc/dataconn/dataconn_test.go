@@ -1 +1,220 @@
 package dataconn
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/util/socketpair"
+)
+
+// accepts a single connection
+type singleConnListener struct {
+	conn   chan *transport.AuthConn
+	closed chan struct{}
+}
+
+func (l *singleConnListener) Addr() net.Addr { return &net.UnixAddr{Net: "unix", Name: "test"} }
+
+func (l *singleConnListener) Accept(ctx context.Context) (*transport.AuthConn, error) {
+	select {
+	case c := <-l.conn:
+		return c, nil
+	case <-l.closed:
+		return nil, errors.New("closed")
+	}
+}
+
+func (l *singleConnListener) Close() error {
+	close(l.closed)
+	return nil
+}
+
+type singleConnConnecter struct{ conn transport.Wire }
+
+func (c singleConnConnecter) Connect(ctx context.Context) (transport.Wire, error) { return c.conn, nil }
+
+// PingDataconn blocks until release is closed or ctx is done
+type blockingPingHandler struct {
+	entered chan struct{}
+	release chan struct{}
+	aborted chan struct{}
+}
+
+func (h *blockingPingHandler) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.ReadCloser, error) {
+	return nil, nil, errors.New("not implemented")
+}
+
+func (h *blockingPingHandler) Receive(ctx context.Context, r *pdu.ReceiveReq, receive io.ReadCloser) (*pdu.ReceiveRes, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (h *blockingPingHandler) PingDataconn(ctx context.Context, r *pdu.PingReq) (*pdu.PingRes, error) {
+	close(h.entered)
+	select {
+	case <-h.release:
+		return &pdu.PingRes{Echo: r.Message}, nil
+	case <-ctx.Done():
+		close(h.aborted)
+		return nil, ctx.Err()
+	}
+}
+
+func TestServeDrainsActiveConnections(t *testing.T) {
+	tcs := []struct {
+		name         string
+		drainTimeout time.Duration
+		release      bool
+	}{
+		{"drained", 10 * time.Second, true},
+		{"aborted", 50 * time.Millisecond, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			serverConn, clientConn, err := socketpair.SocketPair()
+			require.NoError(t, err)
+			l := &singleConnListener{make(chan *transport.AuthConn, 1), make(chan struct{})}
+			l.conn <- transport.NewAuthConn(serverConn, "client")
+
+			h := &blockingPingHandler{make(chan struct{}), make(chan struct{}), make(chan struct{})}
+			srv := NewServer(nil, nil, logger.NewNullLogger(), h)
+			srv.SetDrainTimeout(tc.drainTimeout)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			served := make(chan struct{})
+			go func() {
+				srv.Serve(ctx, l)
+				close(served)
+			}()
+
+			client := NewClient(singleConnConnecter{clientConn}, nil, logger.NewNullLogger())
+			pingErr := make(chan error)
+			go func() {
+				_, err := client.ReqPing(context.Background(), &pdu.PingReq{Message: "foo"})
+				pingErr <- err
+			}()
+
+			<-h.entered
+			cancel()
+			select {
+			case <-served:
+				t.Fatal("Serve must wait for the active connection")
+			case <-time.After(10 * time.Millisecond):
+			}
+
+			if tc.release {
+				close(h.release)
+				assert.NoError(t, <-pingErr)
+			} else {
+				<-h.aborted
+				assert.Error(t, <-pingErr)
+			}
+			<-served
+		})
+	}
+}
+
+// Send blocks until release is closed
+type blockingSendHandler struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (h *blockingSendHandler) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.ReadCloser, error) {
+	h.entered <- struct{}{}
+	<-h.release
+	return &pdu.SendRes{}, nil, nil
+}
+
+func (h *blockingSendHandler) Receive(ctx context.Context, r *pdu.ReceiveReq, receive io.ReadCloser) (*pdu.ReceiveRes, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (h *blockingSendHandler) PingDataconn(ctx context.Context, r *pdu.PingReq) (*pdu.PingRes, error) {
+	return &pdu.PingRes{Echo: r.Message}, nil
+}
+
+func TestServeConnectionLimits(t *testing.T) {
+	l := &singleConnListener{make(chan *transport.AuthConn, 5), make(chan struct{})}
+	h := &blockingSendHandler{make(chan struct{}), make(chan struct{})}
+	srv := NewServer(nil, nil, logger.NewNullLogger(), h)
+	srv.SetConnectionLimits(2, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, l)
+
+	connect := func(clientIdentity string) *Client {
+		serverConn, clientConn, err := socketpair.SocketPair()
+		require.NoError(t, err)
+		l.conn <- transport.NewAuthConn(serverConn, clientIdentity)
+		return NewClient(singleConnConnecter{clientConn}, nil, logger.NewNullLogger())
+	}
+	send := func(clientIdentity string) chan error {
+		errs := make(chan error, 1)
+		client := connect(clientIdentity)
+		go func() {
+			_, _, err := client.ReqSend(context.Background(), &pdu.SendReq{DryRun: true})
+			errs <- err
+		}()
+		return errs
+	}
+	requireBusy := func(errs chan error) {
+		err := <-errs
+		require.Error(t, err)
+		busyErr, ok := err.(*ServerBusyError)
+		require.True(t, ok, "%T: %s", err, err)
+		assert.True(t, busyErr.RetryAfter() >= busyRetryAfter, "%s", busyErr.RetryAfter())
+	}
+
+	first := send("a")
+	<-h.entered
+	requireBusy(send("a")) // per-client limit
+	second := send("b")
+	<-h.entered
+	requireBusy(send("c")) // global limit
+
+	// pings do not count towards the limits
+	_, err := connect("c").ReqPing(context.Background(), &pdu.PingReq{Message: "foo"})
+	require.NoError(t, err)
+
+	close(h.release)
+	assert.NoError(t, <-first)
+	assert.NoError(t, <-second)
+}
+
+func TestServerBusyRetryAfter(t *testing.T) {
+	srv := NewServer(nil, nil, logger.NewNullLogger(), nil)
+	now := time.Now()
+	assert.Equal(t, busyRetryAfter, srv.rejectLocked(now))
+	assert.Equal(t, busyRetryAfter+busyRetryAfter/4, srv.rejectLocked(now))
+	assert.Equal(t, busyRetryAfter+2*(busyRetryAfter/4), srv.rejectLocked(now.Add(busyRetryAfter/2)))
+	// the first two rejections are forgotten
+	assert.Equal(t, busyRetryAfter+busyRetryAfter/4, srv.rejectLocked(now.Add(busyRetryAfter)))
+	for i := 0; i < 100; i++ {
+		srv.rejectLocked(now.Add(busyRetryAfter))
+	}
+	assert.Equal(t, busyRetryAfterMax, srv.rejectLocked(now.Add(busyRetryAfter)))
+}
+
+func TestParseServerBusyError(t *testing.T) {
+	e := parseServerBusyError("RETRY AFTER: 42\nall 2 connections are in use")
+	assert.Equal(t, 42*time.Second, e.RetryAfter())
+	assert.Equal(t, "server busy: all 2 connections are in use (retry after 42s)", e.Error())
+
+	e = parseServerBusyError("all 2 connections are in use")
+	assert.Equal(t, time.Duration(0), e.RetryAfter())
+	assert.Equal(t, "server busy: all 2 connections are in use", e.Error())
+
+	e = parseServerBusyError("RETRY AFTER: soon\nall 2 connections are in use")
+	assert.Equal(t, time.Duration(0), e.RetryAfter())
+}
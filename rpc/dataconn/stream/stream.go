@@ -9,6 +9,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unicode/utf8"
 
 	"github.com/zrepl/zrepl/logger"
@@ -23,6 +24,8 @@ type contextKey int
 
 const (
 	contextKeyLogger contextKey = 1 + iota
+	contextKeyMetricLabels
+	contextKeyChunkSizeLimits
 )
 
 func WithLogger(ctx context.Context, log Logger) context.Context {
@@ -55,13 +58,12 @@ func IsPublicFrameType(ft uint32) bool {
 	return frameconn.IsPublicFrameType(ft) && heartbeatconn.IsPublicFrameType(ft) && ((0xf<<16)&ft == 0)
 }
 
-const FramePayloadShift = 19
-
-var bufpool = base2bufpool.New(FramePayloadShift, FramePayloadShift, base2bufpool.Panic)
+var bufpool = base2bufpool.New(log2(MinChunkSize), log2(MaxChunkSize), base2bufpool.Panic)
 
 // if sendStream returns an error, that error will be sent as a trailer to the client
 // ok will return nil, though.
-func writeStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader, stype uint32) (errStream, errConn error) {
+// m may be nil.
+func writeStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader, stype uint32, m *streamMetrics) (errStream, errConn error) {
 	debug("writeStream: enter stype=%v", stype)
 	defer debug("writeStream: return")
 	if stype == 0 {
@@ -70,10 +72,10 @@ func writeStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader, s
 	if !IsPublicFrameType(stype) {
 		panic(fmt.Sprintf("stype %v is not public", stype))
 	}
-	return doWriteStream(ctx, c, stream, stype)
+	return doWriteStream(ctx, c, stream, stype, m)
 }
 
-func doWriteStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader, stype uint32) (errStream, errConn error) {
+func doWriteStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader, stype uint32, m *streamMetrics) (errStream, errConn error) {
 
 	// RULE1 (buf == <zero>) XOR (err == nil)
 	type read struct {
@@ -81,6 +83,9 @@ func doWriteStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader,
 		err error
 	}
 
+	sizer := newChunkSizer(getChunkSizeLimits(ctx))
+	chunkSize := uint32(sizer.size()) // written by the writer, read by the reader goroutine
+
 	var wg sync.WaitGroup
 	defer wg.Wait()
 	reads := make(chan read, 5)
@@ -90,9 +95,11 @@ func doWriteStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader,
 		defer wg.Done()
 		defer close(reads)
 		for atomic.LoadUint32(&stopReading) == 0 {
-			buffer := bufpool.Get(1 << FramePayloadShift)
+			buffer := bufpool.Get(uint(atomic.LoadUint32(&chunkSize)))
 			bufferBytes := buffer.Bytes()
+			readStart := time.Now()
 			n, err := io.ReadFull(stream, bufferBytes)
+			m.sourceRead(time.Since(readStart))
 			buffer.Shrink(uint(n))
 			// if we received anything, send one read without an error (RULE 1)
 			if n > 0 {
@@ -123,7 +130,12 @@ func doWriteStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader,
 		if read.err == nil {
 			// RULE 1: read.buf is valid
 			// next line is the hot path...
+			writeStart := time.Now()
 			writeErr := c.WriteFrame(read.buf.Bytes(), stype)
+			writeDuration := time.Since(writeStart)
+			m.chunkWritten(len(read.buf.Bytes()), writeDuration)
+			sizer.observe(len(read.buf.Bytes()), writeDuration)
+			atomic.StoreUint32(&chunkSize, uint32(sizer.size()))
 			read.buf.Free()
 			if writeErr != nil {
 				return nil, writeErr
@@ -136,7 +148,7 @@ func doWriteStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader,
 			break
 		} else {
 			errReader := strings.NewReader(read.err.Error())
-			errReadErrReader, errConnWrite := doWriteStream(ctx, c, errReader, StreamErrTrailer)
+			errReadErrReader, errConnWrite := doWriteStream(ctx, c, errReader, StreamErrTrailer, nil)
 			if errReadErrReader != nil {
 				panic(errReadErrReader) // in-memory, cannot happen
 			}
@@ -239,7 +251,8 @@ func readFrames(reads chan<- readFrameResult, noMoreReads chan<- struct{}, c *he
 //
 // readStream calls itself recursively to read multi-frame error trailers
 // Thus, the reads channel needs to be a parameter.
-func readStream(reads <-chan readFrameResult, c *heartbeatconn.Conn, receiver io.Writer, stype uint32) *ReadStreamError {
+// m may be nil.
+func readStream(reads <-chan readFrameResult, c *heartbeatconn.Conn, receiver io.Writer, stype uint32, m *streamMetrics) *ReadStreamError {
 
 	var f frameconn.Frame
 	for read := range reads {
@@ -252,7 +265,9 @@ func readStream(reads <-chan readFrameResult, c *heartbeatconn.Conn, receiver io
 			break
 		}
 
+		writeStart := time.Now()
 		n, err := receiver.Write(f.Buffer.Bytes())
+		m.receiverWritten(n, time.Since(writeStart))
 		if err != nil {
 			f.Buffer.Free()
 			return &ReadStreamError{ReadStreamErrorKindWrite, err} // FIXME wrap as writer error
@@ -276,7 +291,7 @@ func readStream(reads <-chan readFrameResult, c *heartbeatconn.Conn, receiver io
 			panic(fmt.Sprintf("unexpected bytes.Buffer write error: %v %v", n, err))
 		}
 		// recursion ftw! we won't enter this if stmt because stype == StreamErrTrailer in the following call
-		rserr := readStream(reads, c, &errBuf, StreamErrTrailer)
+		rserr := readStream(reads, c, &errBuf, StreamErrTrailer, nil)
 		if rserr != nil && rserr.Kind == ReadStreamErrorKindWrite {
 			panic(fmt.Sprintf("unexpected bytes.Buffer write error: %s", rserr))
 		} else if rserr != nil {
@@ -0,0 +1,111 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+	"time"
+)
+
+// The chunk sizes supported by writeStream.
+// Chunks up to 1<<22 bytes fit into the buffer pool of the receiving frameconn.Conn.
+const (
+	MinChunkSize = 1 << 12
+	MaxChunkSize = 1 << 22
+)
+
+// The default limits of the chunk size.
+const (
+	DefaultMinChunkSize = 1 << 15
+	DefaultMaxChunkSize = 1 << 22
+)
+
+// writeStream aims for chunks that take this long to be written to the connection.
+// Short chunk write times keep the connection responsive on slow links
+// (e.g., the heartbeats are not delayed by large chunks),
+// whereas large chunks reduce the per-chunk overhead on fast links.
+const targetChunkWriteDuration = 50 * time.Millisecond
+
+// ChunkSizeLimits limits the size of the chunks that writeStream splits a stream into.
+// Both limits are rounded down to a power of two.
+// If Min equals Max, the chunk size is fixed.
+type ChunkSizeLimits struct {
+	Min, Max uint
+}
+
+func DefaultChunkSizeLimits() ChunkSizeLimits {
+	return ChunkSizeLimits{Min: DefaultMinChunkSize, Max: DefaultMaxChunkSize}
+}
+
+func (l ChunkSizeLimits) Validate() error {
+	if l.Min < MinChunkSize || l.Max > MaxChunkSize {
+		return fmt.Errorf("chunk size limits must be between %d and %d bytes", MinChunkSize, MaxChunkSize)
+	}
+	if l.Min > l.Max {
+		return fmt.Errorf("minimum chunk size %d exceeds maximum chunk size %d", l.Min, l.Max)
+	}
+	return nil
+}
+
+// WithChunkSizeLimits sets the limits of the chunk size for streams that are sent with ctx
+// or a context derived from it. The limits must be valid.
+func WithChunkSizeLimits(ctx context.Context, l ChunkSizeLimits) context.Context {
+	if err := l.Validate(); err != nil {
+		panic(err)
+	}
+	return context.WithValue(ctx, contextKeyChunkSizeLimits, l)
+}
+
+func getChunkSizeLimits(ctx context.Context) ChunkSizeLimits {
+	l, ok := ctx.Value(contextKeyChunkSizeLimits).(ChunkSizeLimits)
+	if !ok {
+		return DefaultChunkSizeLimits()
+	}
+	return l
+}
+
+func log2(n uint) uint { return uint(bits.Len(n)) - 1 }
+
+// chunkSizer adapts the chunk size to the observed throughput of the connection.
+// It is not safe for concurrent use.
+type chunkSizer struct {
+	minShift, maxShift uint
+	shift              uint
+	// exponentially weighted moving average of the write throughput in bytes per second, 0 if unknown
+	throughput float64
+}
+
+func newChunkSizer(l ChunkSizeLimits) *chunkSizer {
+	s := &chunkSizer{minShift: log2(l.Min), maxShift: log2(l.Max)}
+	// Start small: a stream might be short or the link might be slow.
+	s.shift = s.minShift
+	return s
+}
+
+func (s *chunkSizer) size() uint { return 1 << s.shift }
+
+// observe records that writing a chunk of n bytes took d and updates the chunk size.
+func (s *chunkSizer) observe(n int, d time.Duration) {
+	if s.minShift == s.maxShift || n == 0 {
+		return
+	}
+	if d <= 0 {
+		d = time.Microsecond
+	}
+	t := float64(n) / d.Seconds()
+	if s.throughput == 0 {
+		s.throughput = t
+	} else {
+		const alpha = 0.25
+		s.throughput = alpha*t + (1-alpha)*s.throughput
+	}
+	target := s.throughput * targetChunkWriteDuration.Seconds()
+	switch {
+	case target >= float64(uint(1)<<s.maxShift):
+		s.shift = s.maxShift
+	case target <= float64(uint(1)<<s.minShift):
+		s.shift = s.minShift
+	default:
+		s.shift = log2(uint(target))
+	}
+}
@@ -0,0 +1,44 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkSizer(t *testing.T) {
+	s := newChunkSizer(ChunkSizeLimits{Min: 1 << 15, Max: 1 << 22})
+	assert.Equal(t, uint(1<<15), s.size())
+
+	// LAN: 1 GB/s => 50MB per targetChunkWriteDuration => clamped to max
+	for i := 0; i < 10; i++ {
+		s.observe(int(s.size()), time.Duration(float64(s.size())/1e9*float64(time.Second)))
+	}
+	assert.Equal(t, uint(1<<22), s.size())
+
+	// slow link: 1 MB/s => 50kB per targetChunkWriteDuration => 32 KiB
+	for i := 0; i < 30; i++ {
+		s.observe(int(s.size()), time.Duration(float64(s.size())/1e6*float64(time.Second)))
+	}
+	assert.Equal(t, uint(1<<15), s.size())
+
+	// 10 MB/s => 500kB => 256 KiB
+	for i := 0; i < 30; i++ {
+		s.observe(int(s.size()), time.Duration(float64(s.size())/1e7*float64(time.Second)))
+	}
+	assert.Equal(t, uint(1<<18), s.size())
+}
+
+func TestChunkSizerFixed(t *testing.T) {
+	s := newChunkSizer(ChunkSizeLimits{Min: 1 << 19, Max: 1 << 19})
+	s.observe(1<<19, time.Nanosecond)
+	assert.Equal(t, uint(1<<19), s.size())
+}
+
+func TestChunkSizeLimitsValidate(t *testing.T) {
+	assert.NoError(t, DefaultChunkSizeLimits().Validate())
+	assert.Error(t, ChunkSizeLimits{Min: 1 << 10, Max: 1 << 20}.Validate())
+	assert.Error(t, ChunkSizeLimits{Min: 1 << 15, Max: 1 << 23}.Validate())
+	assert.Error(t, ChunkSizeLimits{Min: 1 << 20, Max: 1 << 15}.Validate())
+}
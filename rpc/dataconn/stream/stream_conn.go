@@ -103,7 +103,7 @@ func (c *Conn) ReadStreamedMessage(ctx context.Context, maxSize uint32, frameTyp
 			panic(err)
 		}
 	}()
-	err = readStream(c.frameReads, c.hc, w, frameType)
+	err = readStream(c.frameReads, c.hc, w, frameType, nil)
 	c.readClean = isConnCleanAfterRead(err)
 	_ = w.CloseWithError(readMessageSentinel) // always returns nil
 	wg.Wait()
@@ -128,8 +128,9 @@ func (r *StreamReader) Close() error {
 	return err
 }
 
-// WriteStreamTo reads a stream from Conn and writes it to w.
-func (c *Conn) ReadStream(frameType uint32, closeConnOnClose bool) (_ *StreamReader, err error) {
+// ReadStream returns a reader for the stream from Conn.
+// ctx is only used for metrics (see WithMetricLabels).
+func (c *Conn) ReadStream(ctx context.Context, frameType uint32, closeConnOnClose bool) (_ *StreamReader, err error) {
 
 	// if we are closed while writing, return that as an error
 	if closeGuard, cse := c.closeState.RWEntry(); cse != nil {
@@ -148,9 +149,10 @@ func (c *Conn) ReadStream(frameType uint32, closeConnOnClose bool) (_ *StreamRea
 	}
 
 	r, w := io.Pipe()
+	m := newStreamMetrics(ctx)
 	go func() {
 		defer c.readMtx.Unlock()
-		var err *ReadStreamError = readStream(c.frameReads, c.hc, w, frameType)
+		var err *ReadStreamError = readStream(c.frameReads, c.hc, w, frameType, m)
 		if err != nil {
 			_ = w.CloseWithError(err) // doc guarantees that error will always be nil
 		} else {
@@ -180,7 +182,7 @@ func (c *Conn) WriteStreamedMessage(ctx context.Context, buf io.Reader, frameTyp
 	if !c.writeClean {
 		return fmt.Errorf("dataconn write message: connection is in unknown state")
 	}
-	errBuf, errConn := writeStream(ctx, c.hc, buf, frameType)
+	errBuf, errConn := writeStream(ctx, c.hc, buf, frameType, nil)
 	if errBuf != nil {
 		panic(errBuf)
 	}
@@ -207,7 +209,7 @@ func (c *Conn) SendStream(ctx context.Context, stream io.ReadCloser, frameType u
 		return fmt.Errorf("dataconn send stream: connection is in unknown state")
 	}
 
-	errStream, errConn := writeStream(ctx, c.hc, stream, frameType)
+	errStream, errConn := writeStream(ctx, c.hc, stream, frameType, newStreamMetrics(ctx))
 
 	c.writeClean = isConnCleanAfterWrite(errConn) // TODO correct?
 
@@ -0,0 +1,130 @@
+package stream
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var prom struct {
+	ChunkWriteSeconds            *prometheus.HistogramVec
+	ChunkWriteThroughput         *prometheus.HistogramVec
+	ChunkSourceReadSeconds       *prometheus.HistogramVec
+	ChunkReceiverWriteSeconds    *prometheus.HistogramVec
+	ChunkReceiverWriteThroughput *prometheus.HistogramVec
+}
+
+var metricLabels = []string{"zrepl_job", "transport"}
+
+func init() {
+	latencyBuckets := prometheus.ExponentialBuckets(0.0001, 4, 10)   // 100us .. ~26s
+	throughputBuckets := prometheus.ExponentialBuckets(1<<16, 4, 10) // 64 KiB/s .. 16 GiB/s
+	prom.ChunkWriteSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "zrepl",
+		Subsystem: "stream",
+		Name:      "chunk_write_seconds",
+		Help:      "Seconds it took to write a chunk of a zfs send stream to the connection (high values indicate a slow network)",
+		Buckets:   latencyBuckets,
+	}, metricLabels)
+	prom.ChunkWriteThroughput = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "zrepl",
+		Subsystem: "stream",
+		Name:      "chunk_write_throughput_bytes_per_second",
+		Help:      "Throughput of writing a chunk of a zfs send stream to the connection",
+		Buckets:   throughputBuckets,
+	}, metricLabels)
+	prom.ChunkSourceReadSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "zrepl",
+		Subsystem: "stream",
+		Name:      "chunk_source_read_seconds",
+		Help:      "Seconds it took to read a chunk from the stream source, e.g., zfs send (high values indicate a slow sender)",
+		Buckets:   latencyBuckets,
+	}, metricLabels)
+	prom.ChunkReceiverWriteSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "zrepl",
+		Subsystem: "stream",
+		Name:      "chunk_receiver_write_seconds",
+		Help:      "Seconds it took to write a received chunk to the stream consumer, e.g., zfs recv (high values indicate a slow receiver)",
+		Buckets:   latencyBuckets,
+	}, metricLabels)
+	prom.ChunkReceiverWriteThroughput = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "zrepl",
+		Subsystem: "stream",
+		Name:      "chunk_receiver_write_throughput_bytes_per_second",
+		Help:      "Throughput of writing a received chunk to the stream consumer",
+		Buckets:   throughputBuckets,
+	}, metricLabels)
+}
+
+func PrometheusRegister(registry prometheus.Registerer) error {
+	if err := registry.Register(prom.ChunkWriteSeconds); err != nil {
+		return err
+	}
+	if err := registry.Register(prom.ChunkWriteThroughput); err != nil {
+		return err
+	}
+	if err := registry.Register(prom.ChunkSourceReadSeconds); err != nil {
+		return err
+	}
+	if err := registry.Register(prom.ChunkReceiverWriteSeconds); err != nil {
+		return err
+	}
+	if err := registry.Register(prom.ChunkReceiverWriteThroughput); err != nil {
+		return err
+	}
+	return nil
+}
+
+type metricLabelValues struct {
+	job, transport string
+}
+
+// WithMetricLabels sets the labels of the metrics recorded for streams
+// that are sent or received with ctx or a context derived from it.
+func WithMetricLabels(ctx context.Context, job, transport string) context.Context {
+	return context.WithValue(ctx, contextKeyMetricLabels, metricLabelValues{job, transport})
+}
+
+// Records the metrics of a single stream.
+// A nil *streamMetrics records nothing, which is used for messages.
+type streamMetrics struct {
+	chunkWriteSeconds, chunkWriteThroughput, sourceReadSeconds prometheus.Observer
+	receiverWriteSeconds, receiverWriteThroughput              prometheus.Observer
+}
+
+func newStreamMetrics(ctx context.Context) *streamMetrics {
+	l, _ := ctx.Value(contextKeyMetricLabels).(metricLabelValues)
+	return &streamMetrics{
+		chunkWriteSeconds:       prom.ChunkWriteSeconds.WithLabelValues(l.job, l.transport),
+		chunkWriteThroughput:    prom.ChunkWriteThroughput.WithLabelValues(l.job, l.transport),
+		sourceReadSeconds:       prom.ChunkSourceReadSeconds.WithLabelValues(l.job, l.transport),
+		receiverWriteSeconds:    prom.ChunkReceiverWriteSeconds.WithLabelValues(l.job, l.transport),
+		receiverWriteThroughput: prom.ChunkReceiverWriteThroughput.WithLabelValues(l.job, l.transport),
+	}
+}
+
+func observeChunk(seconds, throughput prometheus.Observer, n int, d time.Duration) {
+	seconds.Observe(d.Seconds())
+	if d > 0 {
+		throughput.Observe(float64(n) / d.Seconds())
+	}
+}
+
+func (m *streamMetrics) sourceRead(d time.Duration) {
+	if m != nil {
+		m.sourceReadSeconds.Observe(d.Seconds())
+	}
+}
+
+func (m *streamMetrics) chunkWritten(n int, d time.Duration) {
+	if m != nil {
+		observeChunk(m.chunkWriteSeconds, m.chunkWriteThroughput, n, d)
+	}
+}
+
+func (m *streamMetrics) receiverWritten(n int, d time.Duration) {
+	if m != nil {
+		observeChunk(m.receiverWriteSeconds, m.receiverWriteThroughput, n, d)
+	}
+}
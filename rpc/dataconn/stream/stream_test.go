@@ -9,6 +9,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -34,6 +36,9 @@ func TestStreamer(t *testing.T) {
 
 	log := logger.NewStderrDebugLogger()
 	ctx := WithLogger(context.Background(), log)
+	ctx = WithMetricLabels(ctx, "TestStreamer", "socketpair")
+	const chunkShift = 19
+	ctx = WithChunkSizeLimits(ctx, ChunkSizeLimits{Min: 1 << chunkShift, Max: 1 << chunkShift})
 
 	stype := uint32(0x23)
 
@@ -45,7 +50,7 @@ func TestStreamer(t *testing.T) {
 		buf.Write(
 			bytes.Repeat([]byte{1, 2}, 1<<25),
 		)
-		writeStream(ctx, a, &buf, stype)
+		writeStream(ctx, a, &buf, stype, newStreamMetrics(ctx))
 		log.Debug("WriteStream returned")
 		a.Shutdown()
 	}()
@@ -59,7 +64,7 @@ func TestStreamer(t *testing.T) {
 			defer wg.Done()
 			readFrames(ch, nil, b)
 		}()
-		err := readStream(ch, b, &buf, stype)
+		err := readStream(ch, b, &buf, stype, newStreamMetrics(ctx))
 		log.WithField("errType", fmt.Sprintf("%T %v", err, err)).Debug("ReadStream returned")
 		assert.Nil(t, err)
 		expected := bytes.Repeat([]byte{1, 2}, 1<<25)
@@ -69,6 +74,18 @@ func TestStreamer(t *testing.T) {
 
 	wg.Wait()
 
+	// 1<<26 bytes in chunks of 1<<chunkShift
+	chunks := uint64(1 << (26 - chunkShift))
+	assert.Equal(t, chunks, histogramSampleCount(t, prom.ChunkWriteSeconds, "TestStreamer", "socketpair"))
+	assert.Equal(t, chunks, histogramSampleCount(t, prom.ChunkReceiverWriteSeconds, "TestStreamer", "socketpair"))
+	assert.True(t, histogramSampleCount(t, prom.ChunkSourceReadSeconds, "TestStreamer", "socketpair") > chunks)
+
+}
+
+func histogramSampleCount(t *testing.T, h *prometheus.HistogramVec, labels ...string) uint64 {
+	var m dto.Metric
+	require.NoError(t, h.WithLabelValues(labels...).(prometheus.Histogram).Write(&m))
+	return m.GetHistogram().GetSampleCount()
 }
 
 type errReader struct {
@@ -101,7 +118,7 @@ func TestMultiFrameStreamErrTraileror(t *testing.T) {
 	go func() {
 		defer wg.Done()
 		r := errReader{t, longErr}
-		writeStream(ctx, a, &r, stype)
+		writeStream(ctx, a, &r, stype, nil)
 		a.Shutdown()
 	}()
 
@@ -115,7 +132,7 @@ func TestMultiFrameStreamErrTraileror(t *testing.T) {
 			defer wg.Done()
 			readFrames(ch, nil, b)
 		}()
-		err := readStream(ch, b, &buf, stype)
+		err := readStream(ch, b, &buf, stype, nil)
 		t.Logf("%s", err)
 		require.NotNil(t, err)
 		assert.True(t, buf.Len() == 0)
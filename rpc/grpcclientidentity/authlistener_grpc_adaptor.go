@@ -20,6 +20,7 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 
 	"github.com/zrepl/zrepl/logger"
@@ -102,15 +103,49 @@ func (*transportCredentials) OverrideServerName(string) error {
 type ContextInterceptorData interface {
 	FullMethod() string
 	ClientIdentity() string
+	// InvocationID is the ID of the client's job invocation that made the request, or "" if the client did not send it.
+	InvocationID() string
 }
 
 type contextInterceptorData struct {
 	fullMethod     string
 	clientIdentity string
+	invocationID   string
 }
 
 func (d contextInterceptorData) FullMethod() string     { return d.fullMethod }
 func (d contextInterceptorData) ClientIdentity() string { return d.clientIdentity }
+func (d contextInterceptorData) InvocationID() string   { return d.invocationID }
+
+// gRPC metadata key that carries the client's invocation ID.
+// This is a protocol constant.
+const invocationIDMetadataKey = "zrepl-invocation-id"
+
+// InvocationIDFunc returns the invocation ID that is sent along with a request made with ctx.
+// An empty string means that no invocation ID is sent.
+type InvocationIDFunc = func(ctx context.Context) string
+
+// NewClientInterceptor returns an interceptor for gRPC clients that sends the invocation ID
+// returned by invocationID to the server, where it is exposed as ContextInterceptorData.InvocationID.
+func NewClientInterceptor(invocationID InvocationIDFunc) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if id := invocationID(ctx); id != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, invocationIDMetadataKey, id)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func invocationIDFromIncomingContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if ids := md.Get(invocationIDMetadataKey); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
 
 type Interceptor = func(ctx context.Context, data ContextInterceptorData, handler func(ctx context.Context))
 
@@ -131,6 +166,7 @@ func NewInterceptors(logger Logger, clientIdentityKey interface{}, interceptor I
 		data := contextInterceptorData{
 			fullMethod:     info.FullMethod,
 			clientIdentity: a.clientIdentity,
+			invocationID:   invocationIDFromIncomingContext(ctx),
 		}
 		var (
 			resp interface{}
@@ -54,7 +54,7 @@ func client() {
 		onErr(err, "build connecter error")
 	}
 
-	clientConn := grpchelper.ClientConn(cn, log)
+	clientConn := grpchelper.ClientConn(cn, log, nil)
 	defer clientConn.Close()
 
 	// normal usage from here on
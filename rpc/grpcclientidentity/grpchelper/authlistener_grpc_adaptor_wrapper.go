@@ -27,8 +27,9 @@ const (
 type Logger = logger.Logger
 
 // ClientConn is an easy-to-use wrapper around the Dialer and TransportCredentials interface
-// to produce a grpc.ClientConn
-func ClientConn(cn transport.Connecter, log Logger) *grpc.ClientConn {
+// to produce a grpc.ClientConn.
+// invocationID may be nil, see grpcclientidentity.NewClientInterceptor.
+func ClientConn(cn transport.Connecter, log Logger, invocationID grpcclientidentity.InvocationIDFunc) *grpc.ClientConn {
 	ka := grpc.WithKeepaliveParams(keepalive.ClientParameters{
 		Time:                StartKeepalivesAfterInactivityDuration,
 		Timeout:             KeepalivePeerTimeout,
@@ -36,7 +37,11 @@ func ClientConn(cn transport.Connecter, log Logger) *grpc.ClientConn {
 	})
 	dialerOption := grpc.WithDialer(grpcclientidentity.NewDialer(log, cn))
 	cred := grpc.WithTransportCredentials(grpcclientidentity.NewTransportCredentials(log))
-	cc, err := grpc.DialContext(context.Background(), "doesn't matter done by dialer", dialerOption, cred, ka)
+	opts := []grpc.DialOption{dialerOption, cred, ka}
+	if invocationID != nil {
+		opts = append(opts, grpc.WithUnaryInterceptor(grpcclientidentity.NewClientInterceptor(invocationID)))
+	}
+	cc, err := grpc.DialContext(context.Background(), "doesn't matter done by dialer", opts...)
 	if err != nil {
 		log.WithError(err).Error("cannot create gRPC client conn (non-blocking)")
 		// It's ok to panic here: the we call grpc.DialContext without the
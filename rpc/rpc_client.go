@@ -12,6 +12,7 @@ import (
 
 	"google.golang.org/grpc"
 
+	"github.com/zrepl/zrepl/daemon/logging"
 	"github.com/zrepl/zrepl/daemon/logging/trace"
 
 	"github.com/google/uuid"
@@ -33,6 +34,7 @@ type Client struct {
 	controlConn   *grpc.ClientConn
 	loggers       Loggers
 	closed        chan struct{}
+	versions      *VersionsCache // nil if not set, see SetVersionsCache
 }
 
 var _ logic.Endpoint = &Client{}
@@ -52,7 +54,7 @@ func NewClient(cn transport.Connecter, loggers Loggers) *Client {
 		loggers: loggers,
 		closed:  make(chan struct{}),
 	}
-	grpcConn := grpchelper.ClientConn(muxedConnecter.control, loggers.Control)
+	grpcConn := grpchelper.ClientConn(muxedConnecter.control, loggers.Control, logging.GetInvocationID)
 
 	go func() {
 		ctx, cancel := context.WithCancel(context.Background())
@@ -70,7 +72,7 @@ func NewClient(cn transport.Connecter, loggers Loggers) *Client {
 	c.controlClient = pdu.NewReplicationClient(grpcConn)
 	c.controlConn = grpcConn
 
-	c.dataClient = dataconn.NewClient(muxedConnecter.data, loggers.Data)
+	c.dataClient = dataconn.NewClient(muxedConnecter.data, logging.GetInvocationID, loggers.Data)
 	return c
 }
 
@@ -108,17 +110,55 @@ func (c *Client) Receive(ctx context.Context, req *pdu.ReceiveReq, stream io.Rea
 	return c.dataClient.ReqRecv(ctx, req, stream)
 }
 
+var listFilesystemsPageSize = envconst.Int("ZREPL_RPC_CLIENT_LIST_FILESYSTEMS_PAGE_SIZE", 1000)
+
+// ListFilesystems requests the filesystems in pages of listFilesystemsPageSize
+// and returns all of them, unless in requests a specific page.
 func (c *Client) ListFilesystems(ctx context.Context, in *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
 	ctx, endSpan := trace.WithSpan(ctx, "rpc.client.ListFilesystems")
 	defer endSpan()
 
-	return c.controlClient.ListFilesystems(ctx, in)
+	if in.GetPageSize() != 0 || in.GetPageToken() != "" {
+		return c.controlClient.ListFilesystems(ctx, in)
+	}
+	return listFilesystemsPaginated(ctx, listFilesystemsPageSize, func(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+		return c.controlClient.ListFilesystems(ctx, req)
+	})
+}
+
+func listFilesystemsPaginated(ctx context.Context, pageSize int, list func(context.Context, *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error)) (*pdu.ListFilesystemRes, error) {
+	if pageSize < 0 {
+		pageSize = 0
+	}
+	req := &pdu.ListFilesystemReq{PageSize: uint32(pageSize)}
+	res := &pdu.ListFilesystemRes{}
+	for {
+		page, err := list(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		res.Filesystems = append(res.Filesystems, page.GetFilesystems()...)
+		res.PreservesACLProperties = page.GetPreservesACLProperties()
+		res.SnapshotsExternallyManaged = page.GetSnapshotsExternallyManaged()
+		if page.GetNextPageToken() == "" {
+			return res, nil
+		}
+		if page.GetNextPageToken() <= req.PageToken {
+			return nil, fmt.Errorf("server returned non-increasing page token %q after %q", page.GetNextPageToken(), req.PageToken)
+		}
+		req.PageToken = page.GetNextPageToken()
+	}
 }
 
 func (c *Client) ListFilesystemVersions(ctx context.Context, in *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
 	ctx, endSpan := trace.WithSpan(ctx, "rpc.client.ListFilesystemVersions")
 	defer endSpan()
 
+	if c.versions != nil && in.GetSince() == nil {
+		return c.versions.listFilesystemVersions(ctx, in, func(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+			return c.controlClient.ListFilesystemVersions(ctx, req)
+		})
+	}
 	return c.controlClient.ListFilesystemVersions(ctx, in)
 }
 
@@ -143,6 +183,34 @@ func (c *Client) SendCompleted(ctx context.Context, in *pdu.SendCompletedReq) (*
 	return c.controlClient.SendCompleted(ctx, in)
 }
 
+func (c *Client) ChecksumVersion(ctx context.Context, in *pdu.ChecksumVersionReq) (*pdu.ChecksumVersionRes, error) {
+	ctx, endSpan := trace.WithSpan(ctx, "rpc.client.ChecksumVersion")
+	defer endSpan()
+
+	return c.controlClient.ChecksumVersion(ctx, in)
+}
+
+func (c *Client) RenameFilesystem(ctx context.Context, in *pdu.RenameFilesystemReq) (*pdu.RenameFilesystemRes, error) {
+	ctx, endSpan := trace.WithSpan(ctx, "rpc.client.RenameFilesystem")
+	defer endSpan()
+
+	return c.controlClient.RenameFilesystem(ctx, in)
+}
+
+func (c *Client) Rollback(ctx context.Context, in *pdu.RollbackReq) (*pdu.RollbackRes, error) {
+	ctx, endSpan := trace.WithSpan(ctx, "rpc.client.Rollback")
+	defer endSpan()
+
+	return c.controlClient.Rollback(ctx, in)
+}
+
+func (c *Client) DestroyFilesystem(ctx context.Context, in *pdu.DestroyFilesystemReq) (*pdu.DestroyFilesystemRes, error) {
+	ctx, endSpan := trace.WithSpan(ctx, "rpc.client.DestroyFilesystem")
+	defer endSpan()
+
+	return c.controlClient.DestroyFilesystem(ctx, in)
+}
+
 func (c *Client) WaitForConnectivity(ctx context.Context) error {
 	ctx, endSpan := trace.WithSpan(ctx, "rpc.client.WaitForConnectivity")
 	defer endSpan()
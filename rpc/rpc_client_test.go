@@ -0,0 +1,55 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestListFilesystemsPaginated(t *testing.T) {
+	ctx := context.Background()
+	var all []*pdu.Filesystem
+	for i := 0; i < 5; i++ {
+		all = append(all, &pdu.Filesystem{Path: fmt.Sprintf("pool/%d", i)})
+	}
+	var requests int
+	list := func(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+		requests++
+		var start int
+		for start < len(all) && all[start].Path <= req.GetPageToken() {
+			start++
+		}
+		end := start + int(req.GetPageSize())
+		if req.GetPageSize() == 0 || end >= len(all) {
+			return &pdu.ListFilesystemRes{Filesystems: all[start:], PreservesACLProperties: true, SnapshotsExternallyManaged: true}, nil
+		}
+		return &pdu.ListFilesystemRes{Filesystems: all[start:end], NextPageToken: all[end-1].Path, PreservesACLProperties: true, SnapshotsExternallyManaged: true}, nil
+	}
+
+	res, err := listFilesystemsPaginated(ctx, 2, list)
+	require.NoError(t, err)
+	assert.Equal(t, all, res.GetFilesystems())
+	assert.True(t, res.GetPreservesACLProperties())
+	assert.True(t, res.GetSnapshotsExternallyManaged())
+	assert.Equal(t, 3, requests)
+
+	// servers that do not support pagination return everything at once
+	requests = 0
+	res, err = listFilesystemsPaginated(ctx, 2, func(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+		requests++
+		return &pdu.ListFilesystemRes{Filesystems: all}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, all, res.GetFilesystems())
+	assert.Equal(t, 1, requests)
+
+	_, err = listFilesystemsPaginated(ctx, 2, func(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+		return &pdu.ListFilesystemRes{NextPageToken: "pool/0"}, nil
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,72 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// VersionsCache remembers the versions returned by ListFilesystemVersions per filesystem
+// so that the Clients that use it only request the versions that are newer than the known ones
+// (see pdu.ListFilesystemVersionsReq.Since).
+// A VersionsCache outlives Clients, e.g., it is shared by all invocations of a job.
+type VersionsCache struct {
+	mtx  sync.Mutex
+	byFS map[string][]*pdu.FilesystemVersion
+}
+
+func NewVersionsCache() *VersionsCache {
+	return &VersionsCache{byFS: make(map[string][]*pdu.FilesystemVersion)}
+}
+
+// SetVersionsCache makes c use vc for ListFilesystemVersions. vc may be nil.
+func (c *Client) SetVersionsCache(vc *VersionsCache) {
+	c.versions = vc
+}
+
+func (vc *VersionsCache) get(fs string) []*pdu.FilesystemVersion {
+	vc.mtx.Lock()
+	defer vc.mtx.Unlock()
+	return vc.byFS[fs]
+}
+
+func (vc *VersionsCache) put(fs string, vs []*pdu.FilesystemVersion) {
+	vc.mtx.Lock()
+	defer vc.mtx.Unlock()
+	vc.byFS[fs] = vs
+}
+
+type listFilesystemVersionsFunc func(ctx context.Context, in *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error)
+
+func (vc *VersionsCache) listFilesystemVersions(ctx context.Context, in *pdu.ListFilesystemVersionsReq, list listFilesystemVersionsFunc) (*pdu.ListFilesystemVersionsRes, error) {
+	known := vc.get(in.GetFilesystem())
+	req := &pdu.ListFilesystemVersionsReq{
+		Filesystem: in.GetFilesystem(),
+		Since:      pdu.NewListFilesystemVersionsSince(known),
+	}
+	res, err := list(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var vs []*pdu.FilesystemVersion
+	if res.GetIncremental() {
+		vs = make([]*pdu.FilesystemVersion, 0, len(known)+len(res.GetVersions()))
+		vs = append(vs, known...)
+	}
+	vs = append(vs, res.GetVersions()...)
+	vc.put(in.GetFilesystem(), vs)
+
+	// callers may modify the returned versions
+	ret := make([]*pdu.FilesystemVersion, len(vs))
+	for i, v := range vs {
+		ret[i] = &pdu.FilesystemVersion{
+			Type:      v.GetType(),
+			Name:      v.GetName(),
+			Guid:      v.GetGuid(),
+			CreateTXG: v.GetCreateTXG(),
+			Creation:  v.GetCreation(),
+		}
+	}
+	return &pdu.ListFilesystemVersionsRes{Versions: ret}, nil
+}
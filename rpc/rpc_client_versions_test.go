@@ -0,0 +1,63 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestVersionsCache(t *testing.T) {
+	ctx := context.Background()
+	snap := func(name string, txg uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: name, Guid: txg, CreateTXG: txg, Creation: "2020-01-01T00:00:00Z"}
+	}
+
+	var server []*pdu.FilesystemVersion
+	var lastRes *pdu.ListFilesystemVersionsRes
+	list := func(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+		require.NoError(t, req.Validate())
+		lastRes = pdu.NewListFilesystemVersionsRes(server, req.GetSince())
+		return lastRes, nil
+	}
+	names := func(res *pdu.ListFilesystemVersionsRes) (ns []string) {
+		for _, v := range res.GetVersions() {
+			ns = append(ns, v.GetName())
+		}
+		return ns
+	}
+
+	vc := NewVersionsCache()
+	req := &pdu.ListFilesystemVersionsReq{Filesystem: "pool/a"}
+
+	server = []*pdu.FilesystemVersion{snap("a", 1), snap("b", 2)}
+	res, err := vc.listFilesystemVersions(ctx, req, list)
+	require.NoError(t, err)
+	assert.False(t, lastRes.GetIncremental())
+	assert.Equal(t, []string{"a", "b"}, names(res))
+
+	server = append(server, snap("c", 3))
+	res, err = vc.listFilesystemVersions(ctx, req, list)
+	require.NoError(t, err)
+	assert.True(t, lastRes.GetIncremental())
+	assert.Equal(t, []string{"c"}, names(lastRes))
+	assert.Equal(t, []string{"a", "b", "c"}, names(res))
+
+	res.Versions[0].Name = "modified by caller"
+
+	// pruning changes the known versions
+	server = server[1:]
+	res, err = vc.listFilesystemVersions(ctx, req, list)
+	require.NoError(t, err)
+	assert.False(t, lastRes.GetIncremental())
+	assert.Equal(t, []string{"b", "c"}, names(res))
+
+	res, err = vc.listFilesystemVersions(ctx, req, list)
+	require.NoError(t, err)
+	assert.True(t, lastRes.GetIncremental())
+	assert.Empty(t, lastRes.GetVersions())
+	assert.Equal(t, []string{"b", "c"}, names(res))
+}
@@ -0,0 +1,494 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/rpc/versionhandshake"
+)
+
+// Golden exchanges guard the compatibility of the RPC protocol across zrepl versions.
+//
+// testdata/golden/vN contains the wire encoding of a request and a response
+// for each RPC, recorded with protocol version N (versionhandshake.CurrentProtocolVersion).
+// The test decodes every exchange of every version with the current pdu types and
+// replays the request against the server's Handler stack, so that changes
+// which break peers running an older zrepl version with the same protocol
+// version are caught, e.g., a renumbered or retyped field, or stricter validation.
+//
+// If the change is intended, increment versionhandshake.CurrentProtocolVersion
+// and record the exchanges of the new version with
+//
+//	go test ./rpc -run TestGoldenExchanges -update-golden
+//
+// The exchanges of older versions must not be modified.
+var updateGolden = flag.Bool("update-golden", false, "record the golden exchanges of the current protocol version")
+
+const goldenDir = "testdata/golden"
+
+const goldenInvocationID = "c0ffee42"
+
+type compatExchange struct {
+	rpc string
+	// Whether the request is sent over dataconn, which appends pdu.DataconnRequestMetadata.
+	dataconn bool
+	req, res proto.Message
+}
+
+func compatVersion(typ pdu.FilesystemVersion_VersionType, name string, guid, txg uint64) *pdu.FilesystemVersion {
+	return &pdu.FilesystemVersion{Type: typ, Name: name, Guid: guid, CreateTXG: txg, Creation: "2020-04-04T12:34:56+02:00"}
+}
+
+// compatExchanges returns the exchanges that are recorded for the current protocol version.
+// All fields should be set so that a change to any of them is detected.
+func compatExchanges() []compatExchange {
+	from := compatVersion(pdu.FilesystemVersion_Bookmark, "zrepl_CURSOR_G_00000000000004d2_J_push", 1234, 100)
+	to := compatVersion(pdu.FilesystemVersion_Snapshot, "zrepl_20200404_103456_000", 5678, 200)
+	replicationConfig := &pdu.ReplicationConfig{
+		Protection: &pdu.ReplicationConfigProtection{
+			Initial:     pdu.ReplicationGuaranteeKind_GuaranteeResumability,
+			Incremental: pdu.ReplicationGuaranteeKind_GuaranteeIncrementalReplication,
+		},
+	}
+	aclProps := []*pdu.Property{{Name: "acltype", Value: "posix"}, {Name: "aclinherit", Value: "restricted"}}
+	sendReq := &pdu.SendReq{
+		Filesystem:        "pool/data",
+		From:              from,
+		To:                to,
+		ResumeToken:       "1-bf31b879a-b8-789c636064000310a500c4ec50360710e72765a5269740",
+		Encrypted:         pdu.Tri_True,
+		DryRun:            true,
+		ReplicationConfig: replicationConfig,
+	}
+	return []compatExchange{
+		{rpc: "Ping", req: &pdu.PingReq{Message: "ping"}, res: &pdu.PingRes{Echo: "ping"}},
+		{
+			rpc: "ListFilesystems",
+			req: &pdu.ListFilesystemReq{PageSize: 100, PageToken: "pool/a"},
+			res: &pdu.ListFilesystemRes{
+				Filesystems: []*pdu.Filesystem{
+					{Path: "pool/b", ResumeToken: "1-abc-def-123", IsPlaceholder: true, IsEncrypted: true},
+					{Path: "pool/c"},
+				},
+				NextPageToken: "pool/c",
+			},
+		},
+		{
+			rpc: "ListFilesystemVersions",
+			req: &pdu.ListFilesystemVersionsReq{
+				Filesystem: "pool/data",
+				Since:      &pdu.ListFilesystemVersionsSince{CreateTXG: 100, Digest: bytes.Repeat([]byte{0xab}, 32)},
+			},
+			res: &pdu.ListFilesystemVersionsRes{Versions: []*pdu.FilesystemVersion{from, to}, Incremental: true},
+		},
+		{
+			rpc: "DestroySnapshots",
+			req: &pdu.DestroySnapshotsReq{Filesystem: "pool/data", Snapshots: []*pdu.FilesystemVersion{from, to}},
+			res: &pdu.DestroySnapshotsRes{Results: []*pdu.DestroySnapshotRes{{Snapshot: from}, {Snapshot: to, Error: "dataset is busy"}}},
+		},
+		{
+			rpc: "ReplicationCursor",
+			req: &pdu.ReplicationCursorReq{Filesystem: "pool/data"},
+			res: &pdu.ReplicationCursorRes{Result: &pdu.ReplicationCursorRes_Guid{Guid: 1234}},
+		},
+		{
+			rpc: "SendCompleted",
+			req: &pdu.SendCompletedReq{OriginalReq: sendReq},
+			res: &pdu.SendCompletedRes{},
+		},
+		{
+			rpc: "ChecksumVersion",
+			req: &pdu.ChecksumVersionReq{Filesystem: "pool/data", Version: to, Method: pdu.ChecksumMethod_ChecksumMethodStreamSHA256},
+			res: &pdu.ChecksumVersionRes{Checksum: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		},
+		{
+			rpc: "RenameFilesystem",
+			req: &pdu.RenameFilesystemReq{Filesystem: "pool/sink/a", NewFilesystem: "pool/sink/b"},
+			res: &pdu.RenameFilesystemRes{},
+		},
+		{
+			rpc: "Rollback",
+			req: &pdu.RollbackReq{Filesystem: "pool/sink/a", Snapshot: to},
+			res: &pdu.RollbackRes{},
+		},
+		{
+			rpc: "DestroyFilesystem",
+			req: &pdu.DestroyFilesystemReq{Filesystem: "pool/sink/a_deleted_20200404_123456"},
+			res: &pdu.DestroyFilesystemRes{},
+		},
+		{
+			rpc:      "Send",
+			dataconn: true,
+			req:      sendReq,
+			res: &pdu.SendRes{
+				UsedResumeToken:      true,
+				ExpectedSize:         1 << 30,
+				Properties:           []*pdu.Property{{Name: "compression", Value: "lz4"}},
+				ExpectedLogicalSize:  2 << 30,
+				ExpectedPhysicalSize: 1 << 29,
+				ACLProperties:        aclProps,
+			},
+		},
+		{
+			rpc:      "Receive",
+			dataconn: true,
+			req: &pdu.ReceiveReq{
+				Filesystem:        "pool/sink/data",
+				To:                to,
+				ClearResumeToken:  true,
+				ReplicationConfig: replicationConfig,
+				ACLProperties:     aclProps,
+			},
+			res: &pdu.ReceiveRes{},
+		},
+		{rpc: "PingDataconn", dataconn: true, req: &pdu.PingReq{Message: "ping"}, res: &pdu.PingRes{Echo: "ping"}},
+	}
+}
+
+// newCompatMessages returns new instances of the current request and response types of rpc.
+func newCompatMessages(rpc string) (req, res proto.Message) {
+	switch rpc {
+	case "Ping", "PingDataconn":
+		return &pdu.PingReq{}, &pdu.PingRes{}
+	case "ListFilesystems":
+		return &pdu.ListFilesystemReq{}, &pdu.ListFilesystemRes{}
+	case "ListFilesystemVersions":
+		return &pdu.ListFilesystemVersionsReq{}, &pdu.ListFilesystemVersionsRes{}
+	case "DestroySnapshots":
+		return &pdu.DestroySnapshotsReq{}, &pdu.DestroySnapshotsRes{}
+	case "ReplicationCursor":
+		return &pdu.ReplicationCursorReq{}, &pdu.ReplicationCursorRes{}
+	case "SendCompleted":
+		return &pdu.SendCompletedReq{}, &pdu.SendCompletedRes{}
+	case "ChecksumVersion":
+		return &pdu.ChecksumVersionReq{}, &pdu.ChecksumVersionRes{}
+	case "RenameFilesystem":
+		return &pdu.RenameFilesystemReq{}, &pdu.RenameFilesystemRes{}
+	case "Rollback":
+		return &pdu.RollbackReq{}, &pdu.RollbackRes{}
+	case "DestroyFilesystem":
+		return &pdu.DestroyFilesystemReq{}, &pdu.DestroyFilesystemRes{}
+	case "Send":
+		return &pdu.SendReq{}, &pdu.SendRes{}
+	case "Receive":
+		return &pdu.ReceiveReq{}, &pdu.ReceiveRes{}
+	default:
+		return nil, nil
+	}
+}
+
+// compatHandler records the request it received and returns res.
+type compatHandler struct {
+	got proto.Message
+	res proto.Message
+}
+
+var _ Handler = (*compatHandler)(nil)
+
+func (h *compatHandler) Ping(ctx context.Context, r *pdu.PingReq) (*pdu.PingRes, error) {
+	h.got = r
+	return h.res.(*pdu.PingRes), nil
+}
+
+func (h *compatHandler) ListFilesystems(ctx context.Context, r *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+	h.got = r
+	return h.res.(*pdu.ListFilesystemRes), nil
+}
+
+func (h *compatHandler) ListFilesystemVersions(ctx context.Context, r *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+	h.got = r
+	return h.res.(*pdu.ListFilesystemVersionsRes), nil
+}
+
+func (h *compatHandler) DestroySnapshots(ctx context.Context, r *pdu.DestroySnapshotsReq) (*pdu.DestroySnapshotsRes, error) {
+	h.got = r
+	return h.res.(*pdu.DestroySnapshotsRes), nil
+}
+
+func (h *compatHandler) ReplicationCursor(ctx context.Context, r *pdu.ReplicationCursorReq) (*pdu.ReplicationCursorRes, error) {
+	h.got = r
+	return h.res.(*pdu.ReplicationCursorRes), nil
+}
+
+func (h *compatHandler) SendCompleted(ctx context.Context, r *pdu.SendCompletedReq) (*pdu.SendCompletedRes, error) {
+	h.got = r
+	return h.res.(*pdu.SendCompletedRes), nil
+}
+
+func (h *compatHandler) ChecksumVersion(ctx context.Context, r *pdu.ChecksumVersionReq) (*pdu.ChecksumVersionRes, error) {
+	h.got = r
+	return h.res.(*pdu.ChecksumVersionRes), nil
+}
+
+func (h *compatHandler) RenameFilesystem(ctx context.Context, r *pdu.RenameFilesystemReq) (*pdu.RenameFilesystemRes, error) {
+	h.got = r
+	return h.res.(*pdu.RenameFilesystemRes), nil
+}
+
+func (h *compatHandler) Rollback(ctx context.Context, r *pdu.RollbackReq) (*pdu.RollbackRes, error) {
+	h.got = r
+	return h.res.(*pdu.RollbackRes), nil
+}
+
+func (h *compatHandler) DestroyFilesystem(ctx context.Context, r *pdu.DestroyFilesystemReq) (*pdu.DestroyFilesystemRes, error) {
+	h.got = r
+	return h.res.(*pdu.DestroyFilesystemRes), nil
+}
+
+func (h *compatHandler) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.ReadCloser, error) {
+	h.got = r
+	return h.res.(*pdu.SendRes), nil, nil
+}
+
+func (h *compatHandler) Receive(ctx context.Context, r *pdu.ReceiveReq, receive io.ReadCloser) (*pdu.ReceiveRes, error) {
+	h.got = r
+	return h.res.(*pdu.ReceiveRes), nil
+}
+
+func (h *compatHandler) PingDataconn(ctx context.Context, r *pdu.PingReq) (*pdu.PingRes, error) {
+	h.got = r
+	return h.res.(*pdu.PingRes), nil
+}
+
+// replayCompat invokes rpc on the Handler stack of the server (see NewServer) with req.
+func replayCompat(ctx context.Context, h Handler, rpc string, req proto.Message) (res proto.Message, err error) {
+	h = validatingHandler{h}
+	switch rpc {
+	case "Ping":
+		return h.Ping(ctx, req.(*pdu.PingReq))
+	case "ListFilesystems":
+		return h.ListFilesystems(ctx, req.(*pdu.ListFilesystemReq))
+	case "ListFilesystemVersions":
+		return h.ListFilesystemVersions(ctx, req.(*pdu.ListFilesystemVersionsReq))
+	case "DestroySnapshots":
+		return h.DestroySnapshots(ctx, req.(*pdu.DestroySnapshotsReq))
+	case "ReplicationCursor":
+		return h.ReplicationCursor(ctx, req.(*pdu.ReplicationCursorReq))
+	case "SendCompleted":
+		return h.SendCompleted(ctx, req.(*pdu.SendCompletedReq))
+	case "ChecksumVersion":
+		return h.ChecksumVersion(ctx, req.(*pdu.ChecksumVersionReq))
+	case "RenameFilesystem":
+		return h.RenameFilesystem(ctx, req.(*pdu.RenameFilesystemReq))
+	case "Rollback":
+		return h.Rollback(ctx, req.(*pdu.RollbackReq))
+	case "DestroyFilesystem":
+		return h.DestroyFilesystem(ctx, req.(*pdu.DestroyFilesystemReq))
+	case "Send":
+		res, _, err := h.Send(ctx, req.(*pdu.SendReq))
+		return res, err
+	case "Receive":
+		return h.Receive(ctx, req.(*pdu.ReceiveReq), ioutil.NopCloser(bytes.NewReader(nil)))
+	case "PingDataconn":
+		return h.PingDataconn(ctx, req.(*pdu.PingReq))
+	default:
+		panic(rpc)
+	}
+}
+
+type goldenExchange struct {
+	rpc      string
+	req, res []byte // wire encoding
+}
+
+// The golden file format is line-based: comments start with #,
+// and the fields rpc, request and response are hex-encoded protobuf messages.
+func readGolden(path string) (*goldenExchange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var g goldenExchange
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, ": ", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		switch kv[0] {
+		case "rpc":
+			g.rpc = kv[1]
+		case "request":
+			g.req, err = hex.DecodeString(kv[1])
+		case "response":
+			g.res, err = hex.DecodeString(kv[1])
+		default:
+			return nil, fmt.Errorf("unknown field %q", kv[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %s", kv[0], err)
+		}
+	}
+	return &g, s.Err()
+}
+
+func writeGolden(path string, version int, g *goldenExchange) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# golden RPC exchange of protocol version %d, do not edit, see rpc_compat_test.go\n", version)
+	fmt.Fprintf(&buf, "rpc: %s\n", g.rpc)
+	fmt.Fprintf(&buf, "request: %x\n", g.req)
+	fmt.Fprintf(&buf, "response: %x\n", g.res)
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func recordGoldenExchanges(t *testing.T) {
+	dir := filepath.Join(goldenDir, fmt.Sprintf("v%d", versionhandshake.CurrentProtocolVersion))
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	for _, e := range compatExchanges() {
+		req, err := proto.Marshal(e.req)
+		require.NoError(t, err)
+		if e.dataconn {
+			// like dataconn.Client
+			meta, err := proto.Marshal(&pdu.DataconnRequestMetadata{InvocationID: goldenInvocationID})
+			require.NoError(t, err)
+			req = append(req, meta...)
+		}
+		res, err := proto.Marshal(e.res)
+		require.NoError(t, err)
+		require.NoError(t, writeGolden(filepath.Join(dir, e.rpc+".golden"), versionhandshake.CurrentProtocolVersion, &goldenExchange{e.rpc, req, res}))
+	}
+}
+
+// decodeGolden decodes buf into m and fails if buf contains fields that m does not know,
+// or if m's encoding differs from buf.
+func decodeGolden(t *testing.T, buf []byte, m proto.Message, dataconn bool) {
+	require.NoError(t, proto.Unmarshal(buf, m))
+	if dataconn {
+		var meta pdu.DataconnRequestMetadata
+		require.NoError(t, proto.Unmarshal(buf, &meta))
+		assert.Equal(t, goldenInvocationID, meta.GetInvocationID())
+	}
+	proto.DiscardUnknown(m) // the metadata fields of dataconn requests, see below
+	enc, err := proto.Marshal(m)
+	require.NoError(t, err)
+	if dataconn {
+		meta, err := proto.Marshal(&pdu.DataconnRequestMetadata{InvocationID: goldenInvocationID})
+		require.NoError(t, err)
+		enc = append(enc, meta...)
+	}
+	assert.Equal(t, hex.EncodeToString(buf), hex.EncodeToString(enc),
+		"the current encoding differs, a field of the golden message was removed, renumbered or retyped")
+}
+
+func goldenVersionDirs(t *testing.T) []string {
+	dirs, err := filepath.Glob(filepath.Join(goldenDir, "v*"))
+	require.NoError(t, err)
+	sort.Strings(dirs)
+	return dirs
+}
+
+func TestGoldenExchanges(t *testing.T) {
+	if *updateGolden {
+		recordGoldenExchanges(t)
+	}
+
+	current := filepath.Join(goldenDir, fmt.Sprintf("v%d", versionhandshake.CurrentProtocolVersion))
+	dirs := goldenVersionDirs(t)
+	require.Contains(t, dirs, current, "no golden exchanges for the current protocol version, record them with -update-golden")
+
+	for _, dir := range dirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.golden"))
+		require.NoError(t, err)
+		require.NotEmpty(t, files)
+		if dir == current {
+			require.Len(t, files, len(compatExchanges()), "every RPC must have a golden exchange")
+		}
+		for _, path := range files {
+			path := path
+			t.Run(filepath.Join(filepath.Base(dir), filepath.Base(path)), func(t *testing.T) {
+				g, err := readGolden(path)
+				require.NoError(t, err)
+				req, res := newCompatMessages(g.rpc)
+				require.NotNil(t, req, "unknown RPC %q, RPCs must not be removed", g.rpc)
+				dataconn := g.rpc == "Send" || g.rpc == "Receive" || g.rpc == "PingDataconn"
+
+				decodeGolden(t, g.req, req, dataconn)
+				decodeGolden(t, g.res, res, false)
+
+				// the current Handler stack must accept requests of peers with the same protocol version
+				h := &compatHandler{res: res}
+				replayed, err := replayCompat(context.Background(), h, g.rpc, req)
+				require.NoError(t, err)
+				assert.True(t, proto.Equal(req, h.got), "the handler must receive the request unchanged")
+				assert.True(t, proto.Equal(res, replayed))
+			})
+		}
+	}
+}
+
+// The recorded exchanges of the current protocol version must match compatExchanges,
+// otherwise the wire format changed without re-recording (and possibly incrementing the version).
+func TestGoldenExchangesCurrent(t *testing.T) {
+	dir := filepath.Join(goldenDir, fmt.Sprintf("v%d", versionhandshake.CurrentProtocolVersion))
+	for _, e := range compatExchanges() {
+		g, err := readGolden(filepath.Join(dir, e.rpc+".golden"))
+		require.NoError(t, err, "record the golden exchanges with -update-golden")
+		req, res := newCompatMessages(e.rpc)
+		require.NoError(t, proto.Unmarshal(g.req, req))
+		require.NoError(t, proto.Unmarshal(g.res, res))
+		proto.DiscardUnknown(req)
+		assert.True(t, proto.Equal(e.req, req), "%s request: golden %s, current %s", e.rpc, req, e.req)
+		assert.True(t, proto.Equal(e.res, res), "%s response: golden %s, current %s", e.rpc, res, e.res)
+	}
+}
+
+// Mutations of the golden requests, as sent by a buggy or malicious peer,
+// must not crash the Handler stack: they either fail to decode, are rejected
+// by validation, or reach the handler.
+func TestGoldenExchangesMutated(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, dir := range goldenVersionDirs(t) {
+		files, err := filepath.Glob(filepath.Join(dir, "*.golden"))
+		require.NoError(t, err)
+		for _, path := range files {
+			g, err := readGolden(path)
+			require.NoError(t, err)
+			for i := 0; i < 200; i++ {
+				buf := append([]byte(nil), g.req...)
+				switch rng.Intn(3) {
+				case 0: // truncate
+					buf = buf[:rng.Intn(len(buf)+1)]
+				case 1: // flip bits
+					for n := rng.Intn(4) + 1; n > 0 && len(buf) > 0; n-- {
+						buf[rng.Intn(len(buf))] ^= byte(1 << uint(rng.Intn(8)))
+					}
+				case 2: // random bytes
+					if len(buf) > 0 {
+						pos := rng.Intn(len(buf))
+						rng.Read(buf[pos:])
+					}
+				}
+				req, res := newCompatMessages(g.rpc)
+				if proto.Unmarshal(buf, req) != nil {
+					continue
+				}
+				require.NotPanics(t, func() {
+					replayCompat(context.Background(), &compatHandler{res: res}, g.rpc, req) // nolint: errcheck
+				}, "%s: mutated request %x", path, buf)
+			}
+		}
+	}
+}
@@ -108,6 +108,13 @@
 //                    +------------+
 //           (usually endpoint.{Sender,Receiver})
 //
+// Protocol Compatibility
+//
+// The golden exchanges in testdata/golden record the wire encoding of each RPC
+// per protocol version (versionhandshake.CurrentProtocolVersion) and are replayed
+// against the Handler stack by the tests (see rpc_compat_test.go).
+// Incompatible changes require incrementing the protocol version and recording
+// the exchanges of the new version; those of older versions must be kept unmodified.
 //
 package rpc
 
@@ -9,6 +9,7 @@ import (
 	"github.com/zrepl/zrepl/rpc/dataconn"
 	"github.com/zrepl/zrepl/rpc/grpcclientidentity"
 	"github.com/zrepl/zrepl/rpc/grpcclientidentity/grpchelper"
+	"github.com/zrepl/zrepl/rpc/streammux"
 	"github.com/zrepl/zrepl/rpc/versionhandshake"
 	"github.com/zrepl/zrepl/transport"
 	"github.com/zrepl/zrepl/util/envconst"
@@ -34,6 +35,8 @@ type Server struct {
 type HandlerContextInterceptorData interface {
 	FullMethod() string
 	ClientIdentity() string
+	// InvocationID is the ID of the client's job invocation that made the request, or "" if the client did not send it.
+	InvocationID() string
 }
 
 type interceptorData struct {
@@ -43,11 +46,18 @@ type interceptorData struct {
 
 func (d interceptorData) ClientIdentity() string { return d.wrapped.ClientIdentity() }
 func (d interceptorData) FullMethod() string     { return d.prefixMethod + d.wrapped.FullMethod() }
+func (d interceptorData) InvocationID() string   { return d.wrapped.InvocationID() }
 
 type HandlerContextInterceptor func(ctx context.Context, data HandlerContextInterceptorData, handler func(ctx context.Context))
 
 // config must be valid (use its Validate function).
-func NewServer(handler Handler, loggers Loggers, ctxInterceptor HandlerContextInterceptor) *Server {
+//
+// When the context passed to Serve is done, the server stops accepting new connections
+// and aborts the requests that are still active after drainTimeout.
+func NewServer(handler Handler, loggers Loggers, ctxInterceptor HandlerContextInterceptor, drainTimeout time.Duration) *Server {
+
+	// reject malformed requests from peers before they reach handler
+	handler = validatingHandler{handler}
 
 	// setup control server
 	controlServerServe := func(ctx context.Context, controlListener transport.AuthenticatedListener, errOut chan<- error) {
@@ -58,12 +68,14 @@ func NewServer(handler Handler, loggers Loggers, ctxInterceptor HandlerContextIn
 		controlServer, serve := grpchelper.NewServer(controlListener, endpoint.ClientIdentityKey, loggers.Control, controlCtxInterceptor)
 		pdu.RegisterReplicationServer(controlServer, handler)
 
-		// give time for graceful stop until deadline expires, then hard stop
+		// give time for graceful stop until the drain timeout expires, then hard stop
 		go func() {
 			<-ctx.Done()
-			if dl, ok := ctx.Deadline(); ok {
-				go time.AfterFunc(dl.Sub(dl), controlServer.Stop)
-			}
+			hardStop := time.AfterFunc(drainTimeout, func() {
+				loggers.Control.Warn("drain timeout expired, aborting active control RPCs")
+				controlServer.Stop()
+			})
+			defer hardStop.Stop()
 			loggers.Control.Debug("gracefully shutting down control server")
 			controlServer.GracefulStop()
 			loggers.Control.Debug("gracdeful shut down of control server complete")
@@ -82,6 +94,7 @@ func NewServer(handler Handler, loggers Loggers, ctxInterceptor HandlerContextIn
 		ctxInterceptor(ctx, interceptorData{"data://", data}, handler)
 	}
 	dataServer := dataconn.NewServer(dataServerClientIdentitySetter, dataCtxInterceptor, loggers.Data, handler)
+	dataServer.SetDrainTimeout(drainTimeout)
 	dataServerServe := func(ctx context.Context, dataListener transport.AuthenticatedListener, errOut chan<- error) {
 		dataServer.Serve(ctx, dataListener)
 		errOut <- nil // TODO bad design of dataServer?
@@ -98,6 +111,12 @@ func NewServer(handler Handler, loggers Loggers, ctxInterceptor HandlerContextIn
 	return server
 }
 
+// SetConnectionLimits limits the number of concurrent sends and receives, see dataconn.Server.SetConnectionLimits.
+// Must be called before Serve.
+func (s *Server) SetConnectionLimits(max, maxPerClient int) {
+	s.dataServer.SetConnectionLimits(max, maxPerClient)
+}
+
 // The context is used for cancellation only.
 // Serve never returns an error, it logs them to the Server's logger.
 func (s *Server) Serve(ctx context.Context, l transport.AuthenticatedListener) {
@@ -105,6 +124,8 @@ func (s *Server) Serve(ctx context.Context, l transport.AuthenticatedListener) {
 	defer cancel()
 	defer s.logger.Debug("rpc.(*Server).Serve done")
 
+	// serves clients with and without connection multiplexing, see package streammux
+	l = streammux.Listener(l, envconst.Duration("ZREPL_TRANSPORT_STREAMMUX_TIMEOUT", 10*time.Second))
 	l = versionhandshake.Listener(l, envconst.Duration("ZREPL_RPC_SERVER_VERSIONHANDSHAKE_TIMEOUT", 10*time.Second))
 
 	// it is important that demux's context is cancelled,
@@ -0,0 +1,117 @@
+package rpc
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// validatingHandler rejects requests that fail pdu.Validator.Validate
+// before dispatching them to the wrapped Handler.
+type validatingHandler struct {
+	h Handler
+}
+
+var _ Handler = validatingHandler{}
+
+func validateRequest(req pdu.Validator) error {
+	if err := req.Validate(); err != nil {
+		return errors.Wrap(err, "invalid request")
+	}
+	return nil
+}
+
+func (v validatingHandler) Ping(ctx context.Context, r *pdu.PingReq) (*pdu.PingRes, error) {
+	if err := validateRequest(r); err != nil {
+		return nil, err
+	}
+	return v.h.Ping(ctx, r)
+}
+
+func (v validatingHandler) ListFilesystems(ctx context.Context, r *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+	if err := validateRequest(r); err != nil {
+		return nil, err
+	}
+	return v.h.ListFilesystems(ctx, r)
+}
+
+func (v validatingHandler) ListFilesystemVersions(ctx context.Context, r *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+	if err := validateRequest(r); err != nil {
+		return nil, err
+	}
+	return v.h.ListFilesystemVersions(ctx, r)
+}
+
+func (v validatingHandler) DestroySnapshots(ctx context.Context, r *pdu.DestroySnapshotsReq) (*pdu.DestroySnapshotsRes, error) {
+	if err := validateRequest(r); err != nil {
+		return nil, err
+	}
+	return v.h.DestroySnapshots(ctx, r)
+}
+
+func (v validatingHandler) ReplicationCursor(ctx context.Context, r *pdu.ReplicationCursorReq) (*pdu.ReplicationCursorRes, error) {
+	if err := validateRequest(r); err != nil {
+		return nil, err
+	}
+	return v.h.ReplicationCursor(ctx, r)
+}
+
+func (v validatingHandler) SendCompleted(ctx context.Context, r *pdu.SendCompletedReq) (*pdu.SendCompletedRes, error) {
+	if err := validateRequest(r); err != nil {
+		return nil, err
+	}
+	return v.h.SendCompleted(ctx, r)
+}
+
+func (v validatingHandler) ChecksumVersion(ctx context.Context, r *pdu.ChecksumVersionReq) (*pdu.ChecksumVersionRes, error) {
+	if err := validateRequest(r); err != nil {
+		return nil, err
+	}
+	return v.h.ChecksumVersion(ctx, r)
+}
+
+func (v validatingHandler) RenameFilesystem(ctx context.Context, r *pdu.RenameFilesystemReq) (*pdu.RenameFilesystemRes, error) {
+	if err := validateRequest(r); err != nil {
+		return nil, err
+	}
+	return v.h.RenameFilesystem(ctx, r)
+}
+
+func (v validatingHandler) Rollback(ctx context.Context, r *pdu.RollbackReq) (*pdu.RollbackRes, error) {
+	if err := validateRequest(r); err != nil {
+		return nil, err
+	}
+	return v.h.Rollback(ctx, r)
+}
+
+func (v validatingHandler) DestroyFilesystem(ctx context.Context, r *pdu.DestroyFilesystemReq) (*pdu.DestroyFilesystemRes, error) {
+	if err := validateRequest(r); err != nil {
+		return nil, err
+	}
+	return v.h.DestroyFilesystem(ctx, r)
+}
+
+func (v validatingHandler) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.ReadCloser, error) {
+	if err := validateRequest(r); err != nil {
+		return nil, nil, err
+	}
+	return v.h.Send(ctx, r)
+}
+
+func (v validatingHandler) Receive(ctx context.Context, r *pdu.ReceiveReq, receive io.ReadCloser) (*pdu.ReceiveRes, error) {
+	if err := validateRequest(r); err != nil {
+		receive.Close()
+		return nil, err
+	}
+	return v.h.Receive(ctx, r, receive)
+}
+
+func (v validatingHandler) PingDataconn(ctx context.Context, r *pdu.PingReq) (*pdu.PingRes, error) {
+	if err := validateRequest(r); err != nil {
+		return nil, err
+	}
+	return v.h.PingDataconn(ctx, r)
+}
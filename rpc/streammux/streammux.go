@@ -0,0 +1,308 @@
+// Package streammux wraps a transport.{Connecter,AuthenticatedListener}
+// to multiplex several concurrent connections (streams) over a single
+// connection of the underlying transport.
+//
+// Without multiplexing, every replication stream and the control connection
+// use a connection of their own, i.e., parallel replication of N filesystems
+// requires N+1 TCP connections or SSH sessions, which restrictive firewalls
+// or sshd's MaxSessions / MaxStartups settings may not allow.
+//
+// Multiplexing is enabled by the connecting side. The connecting side sends
+// a preamble at the start of the underlying connection, which the listening
+// side detects and acknowledges. Connections without the preamble are passed
+// through unchanged, i.e., the listening side serves both kinds of clients.
+//
+// After the preamble, both sides exchange frames with a fixed-size header
+// (type, stream ID, length), followed by length bytes of payload for data frames.
+// Only the connecting side opens streams. Each stream has a flow control window
+// of streamWindow bytes in each direction, so that a stream whose reader is slow
+// (e.g. a zfs recv that waits for the disk) does not block the other streams.
+package streammux
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/util/envconst"
+)
+
+type Logger = logger.Logger
+
+func getLog(ctx context.Context) Logger {
+	return logging.GetLogger(ctx, logging.SubsysTransportMux)
+}
+
+// The preamble sent by the connecting side and echoed by the listening side.
+// It has the length of the versionhandshake banner's length prefix and,
+// unlike that prefix, does not start with a digit, so that the listening side
+// can distinguish multiplexed from regular connections by reading preambleLen bytes.
+// This is a protocol constant, changing it breaks the wire protocol.
+const preamble = "ZREPL_MUX1\n"
+
+const preambleLen = len(preamble)
+
+type frameType uint8
+
+const (
+	frameOpen       frameType = 1 + iota // the connecting side opened the stream
+	frameData                            // followed by length bytes of payload
+	frameWindow                          // the receiver consumed length bytes, the sender may send as many more
+	frameCloseWrite                      // the sender will not send more data on the stream
+	frameClose                           // the sender neither reads from nor writes to the stream anymore
+)
+
+func (t frameType) String() string {
+	switch t {
+	case frameOpen:
+		return "open"
+	case frameData:
+		return "data"
+	case frameWindow:
+		return "window"
+	case frameCloseWrite:
+		return "closewrite"
+	case frameClose:
+		return "close"
+	default:
+		return fmt.Sprintf("frameType(%d)", uint8(t))
+	}
+}
+
+// Protocol constants, changing them breaks the wire protocol.
+const (
+	headerLen     = 1 + 4 + 4 // type, stream ID, length
+	maxPayloadLen = 1 << 18
+	streamWindow  = 1 << 22
+)
+
+var sessionIdleTimeout = envconst.Duration("ZREPL_TRANSPORT_STREAMMUX_IDLE_TIMEOUT", 30*time.Second)
+
+var errSessionIdle = errors.New("multiplexed connection closed after idle timeout")
+
+// The maximum time a frame may take to be written to the underlying connection.
+// The default matches the heartbeat peer timeout of package dataconn: if a frame takes longer,
+// the peers of the streams consider their connections dead anyway.
+var sessionWriteTimeout = envconst.Duration("ZREPL_TRANSPORT_STREAMMUX_WRITE_TIMEOUT", 10*time.Second)
+
+// A session multiplexes streams over one connection of the underlying transport.
+type session struct {
+	conn   transport.Wire
+	log    Logger
+	client bool
+	onOpen func(*stream) // listening side only, must not block
+
+	writeMtx sync.Mutex
+
+	mtx       sync.Mutex
+	streams   map[uint32]*stream
+	nextID    uint32
+	err       error // non-nil once the session is closed
+	idleTimer *time.Timer
+}
+
+func newSession(conn transport.Wire, client bool, log Logger, onOpen func(*stream)) *session {
+	s := &session{
+		conn:    conn,
+		log:     log,
+		client:  client,
+		onOpen:  onOpen,
+		streams: make(map[uint32]*stream),
+	}
+	go s.recvLoop()
+	return s
+}
+
+// open opens a new stream, only the connecting side may open streams.
+func (s *session) open() (*stream, error) {
+	if !s.client {
+		panic("implementation error: only the connecting side may open streams")
+	}
+	s.mtx.Lock()
+	if s.err != nil {
+		s.mtx.Unlock()
+		return nil, s.err
+	}
+	s.nextID++
+	if s.nextID == 0 {
+		s.mtx.Unlock()
+		s.close(errors.New("stream IDs of multiplexed connection exhausted"), false)
+		return nil, s.err
+	}
+	st := newStream(s, s.nextID)
+	s.streams[st.id] = st
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleTimer = nil
+	}
+	s.mtx.Unlock()
+
+	if err := s.writeFrame(frameOpen, st.id, 0, nil, time.Time{}); err != nil {
+		st.Close()
+		return nil, err
+	}
+	return st, nil
+}
+
+func (s *session) removeStream(id uint32) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.streams, id)
+	if s.client && s.err == nil && len(s.streams) == 0 && s.idleTimer == nil {
+		s.idleTimer = time.AfterFunc(sessionIdleTimeout, func() {
+			s.close(errSessionIdle, true)
+		})
+	}
+}
+
+// close closes the session and fails its streams.
+// If onlyIfIdle is true, the session is only closed if it has no streams.
+func (s *session) close(err error, onlyIfIdle bool) {
+	s.mtx.Lock()
+	if s.err != nil || (onlyIfIdle && len(s.streams) > 0) {
+		s.mtx.Unlock()
+		return
+	}
+	s.err = err
+	streams := s.streams
+	s.streams = make(map[uint32]*stream)
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleTimer = nil
+	}
+	s.mtx.Unlock()
+
+	if err == errSessionIdle {
+		s.log.Debug("closing idle multiplexed connection")
+	} else if err == io.EOF {
+		s.log.WithField("streams", len(streams)).Debug("multiplexed connection closed by peer")
+	} else {
+		s.log.WithError(err).WithField("streams", len(streams)).Info("multiplexed connection failed")
+	}
+	if cerr := s.conn.Close(); cerr != nil {
+		s.log.WithError(cerr).Debug("cannot close multiplexed connection")
+	}
+	for _, st := range streams {
+		st.sessionFailed(errors.Wrap(err, "multiplexed connection failed"))
+	}
+}
+
+// writeFrame writes a frame to the underlying connection.
+//
+// If deadline is not zero and has expired when it is the frame's turn to be written,
+// writeFrame returns timeoutError{} without writing the frame.
+// Otherwise, the write must complete within sessionWriteTimeout or the session fails:
+// the frame might have been written partially, and a peer that does not read
+// must not block the other streams indefinitely.
+// Thus, a stream's deadline is honored at frame granularity, as the streams share the connection
+// and a frame that is interrupted by one stream's deadline would break all of them.
+func (s *session) writeFrame(t frameType, id uint32, length uint32, payload []byte, deadline time.Time) error {
+	var hdr [headerLen]byte
+	hdr[0] = byte(t)
+	binary.BigEndian.PutUint32(hdr[1:5], id)
+	binary.BigEndian.PutUint32(hdr[5:9], length)
+	bufs := net.Buffers{hdr[:], payload}
+
+	s.writeMtx.Lock()
+	now := time.Now()
+	if !deadline.IsZero() && !deadline.After(now) {
+		s.writeMtx.Unlock()
+		return timeoutError{}
+	}
+	err := s.conn.SetWriteDeadline(now.Add(sessionWriteTimeout))
+	if err == nil {
+		_, err = bufs.WriteTo(s.conn)
+	}
+	s.writeMtx.Unlock()
+	if err != nil {
+		s.close(err, false)
+		return errors.Wrap(err, "multiplexed connection failed")
+	}
+	return nil
+}
+
+func (s *session) recvLoop() {
+	var hdr [headerLen]byte
+	for {
+		if _, err := io.ReadFull(s.conn, hdr[:]); err != nil {
+			s.close(err, false)
+			return
+		}
+		t := frameType(hdr[0])
+		id := binary.BigEndian.Uint32(hdr[1:5])
+		length := binary.BigEndian.Uint32(hdr[5:9])
+		if err := s.handleFrame(t, id, length); err != nil {
+			s.close(err, false)
+			return
+		}
+	}
+}
+
+func (s *session) getStream(id uint32) *stream {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.streams[id]
+}
+
+// Streams that are not found have been closed by our side, frames for them are dropped.
+func (s *session) handleFrame(t frameType, id uint32, length uint32) error {
+	switch t {
+	case frameOpen:
+		if s.client {
+			return errors.Errorf("protocol error: peer opened stream %d", id)
+		}
+		s.mtx.Lock()
+		if _, ok := s.streams[id]; ok {
+			s.mtx.Unlock()
+			return errors.Errorf("protocol error: peer opened stream %d twice", id)
+		}
+		st := newStream(s, id)
+		s.streams[id] = st
+		s.mtx.Unlock()
+		s.onOpen(st)
+		return nil
+
+	case frameData:
+		if length > maxPayloadLen {
+			return errors.Errorf("protocol error: data frame of %d bytes exceeds maximum of %d bytes", length, maxPayloadLen)
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(s.conn, buf); err != nil {
+			return err
+		}
+		if st := s.getStream(id); st != nil {
+			return st.receive(buf)
+		}
+		return nil
+
+	case frameWindow:
+		if st := s.getStream(id); st != nil {
+			st.addSendWindow(length)
+		}
+		return nil
+
+	case frameCloseWrite:
+		if st := s.getStream(id); st != nil {
+			st.receiveCloseWrite()
+		}
+		return nil
+
+	case frameClose:
+		if st := s.getStream(id); st != nil {
+			st.receiveClose()
+		}
+		return nil
+
+	default:
+		return errors.Errorf("protocol error: unknown frame type %s", t)
+	}
+}
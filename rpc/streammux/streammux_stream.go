@@ -0,0 +1,334 @@
+package streammux
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/transport"
+)
+
+var (
+	errStreamClosed      = errors.New("use of closed multiplexed stream")
+	errStreamWriteClosed = errors.New("write to multiplexed stream after CloseWrite")
+	errStreamPeerClosed  = errors.New("multiplexed stream closed by peer")
+)
+
+type timeoutError struct{}
+
+var _ net.Error = timeoutError{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// deadline implements the deadline semantics of net.Conn for a stream.
+type deadline struct {
+	mtx     sync.Mutex
+	t       time.Time // zero if no deadline is set
+	timer   *time.Timer
+	expired chan struct{} // closed when the deadline expires
+}
+
+func newDeadline() *deadline {
+	return &deadline{expired: make(chan struct{})}
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func (d *deadline) set(t time.Time) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.expired // the timer fired, wait for it to close the channel
+	}
+	d.timer = nil
+	d.t = t
+
+	expired := isClosedChan(d.expired)
+	if t.IsZero() {
+		if expired {
+			d.expired = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if expired {
+			d.expired = make(chan struct{})
+		}
+		c := d.expired
+		d.timer = time.AfterFunc(dur, func() { close(c) })
+		return
+	}
+	if !expired {
+		close(d.expired)
+	}
+}
+
+func (d *deadline) wait() <-chan struct{} {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.expired
+}
+
+func (d *deadline) get() time.Time {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.t
+}
+
+// A stream is a connection multiplexed over a session.
+// It implements transport.Wire.
+type stream struct {
+	s  *session
+	id uint32
+
+	mtx             sync.Mutex
+	readBuf         bytes.Buffer
+	consumed        uint32 // bytes read from readBuf since the last window update
+	sendWindow      uint32
+	closedWrite     bool
+	closed          bool
+	peerClosedWrite bool
+	peerClosed      bool
+	sessionErr      error
+
+	// buffered with capacity 1, signaled when the respective state changed
+	readNotify, writeNotify chan struct{}
+
+	readDeadline, writeDeadline *deadline
+}
+
+var _ transport.Wire = (*stream)(nil)
+
+func newStream(s *session, id uint32) *stream {
+	return &stream{
+		s:             s,
+		id:            id,
+		sendWindow:    streamWindow,
+		readNotify:    make(chan struct{}, 1),
+		writeNotify:   make(chan struct{}, 1),
+		readDeadline:  newDeadline(),
+		writeDeadline: newDeadline(),
+	}
+}
+
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+func (st *stream) Read(p []byte) (int, error) {
+	for {
+		// like net.Conn, fail reads after the deadline even if data is buffered
+		select {
+		case <-st.readDeadline.wait():
+			return 0, timeoutError{}
+		default:
+		}
+
+		st.mtx.Lock()
+		if st.closed {
+			st.mtx.Unlock()
+			return 0, errStreamClosed
+		}
+		if st.readBuf.Len() > 0 {
+			n, _ := st.readBuf.Read(p)
+			st.consumed += uint32(n)
+			var update uint32
+			if st.consumed >= streamWindow/2 {
+				update, st.consumed = st.consumed, 0
+			}
+			st.mtx.Unlock()
+			if update > 0 {
+				// errors are reported by subsequent reads and writes
+				_ = st.s.writeFrame(frameWindow, st.id, update, nil, time.Time{})
+			}
+			return n, nil
+		}
+		if st.peerClosedWrite || st.peerClosed {
+			st.mtx.Unlock()
+			return 0, io.EOF
+		}
+		if st.sessionErr != nil {
+			st.mtx.Unlock()
+			return 0, st.sessionErr
+		}
+		st.mtx.Unlock()
+
+		select {
+		case <-st.readNotify:
+		case <-st.readDeadline.wait():
+			return 0, timeoutError{}
+		}
+	}
+}
+
+func (st *stream) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		select {
+		case <-st.writeDeadline.wait():
+			return n, timeoutError{}
+		default:
+		}
+
+		st.mtx.Lock()
+		switch {
+		case st.closed:
+			err = errStreamClosed
+		case st.closedWrite:
+			err = errStreamWriteClosed
+		case st.peerClosed:
+			err = errStreamPeerClosed
+		case st.sessionErr != nil:
+			err = st.sessionErr
+		}
+		if err != nil {
+			st.mtx.Unlock()
+			return n, err
+		}
+		if st.sendWindow == 0 {
+			st.mtx.Unlock()
+			select {
+			case <-st.writeNotify:
+			case <-st.writeDeadline.wait():
+				return n, timeoutError{}
+			}
+			continue
+		}
+		chunk := len(p)
+		if chunk > int(st.sendWindow) {
+			chunk = int(st.sendWindow)
+		}
+		if chunk > maxPayloadLen {
+			chunk = maxPayloadLen
+		}
+		st.sendWindow -= uint32(chunk)
+		st.mtx.Unlock()
+
+		if err := st.s.writeFrame(frameData, st.id, uint32(chunk), p[:chunk], st.writeDeadline.get()); err != nil {
+			if _, ok := err.(timeoutError); ok {
+				// the frame was not written
+				st.mtx.Lock()
+				st.sendWindow += uint32(chunk)
+				st.mtx.Unlock()
+			}
+			return n, err
+		}
+		n += chunk
+		p = p[chunk:]
+	}
+	return n, nil
+}
+
+func (st *stream) CloseWrite() error {
+	st.mtx.Lock()
+	if st.closed {
+		st.mtx.Unlock()
+		return errStreamClosed
+	}
+	if st.closedWrite {
+		st.mtx.Unlock()
+		return nil
+	}
+	st.closedWrite = true
+	st.mtx.Unlock()
+	return st.s.writeFrame(frameCloseWrite, st.id, 0, nil, time.Time{})
+}
+
+func (st *stream) Close() error {
+	st.mtx.Lock()
+	if st.closed {
+		st.mtx.Unlock()
+		return nil
+	}
+	st.closed = true
+	sessionFailed := st.sessionErr != nil
+	st.mtx.Unlock()
+	notify(st.readNotify)
+	notify(st.writeNotify)
+
+	st.s.removeStream(st.id)
+	if sessionFailed {
+		return nil
+	}
+	return st.s.writeFrame(frameClose, st.id, 0, nil, time.Time{})
+}
+
+func (st *stream) receive(b []byte) error {
+	st.mtx.Lock()
+	if st.closed {
+		st.mtx.Unlock()
+		return nil
+	}
+	if st.readBuf.Len()+int(st.consumed)+len(b) > streamWindow {
+		st.mtx.Unlock()
+		return errors.Errorf("protocol error: peer exceeded flow control window of stream %d", st.id)
+	}
+	st.readBuf.Write(b)
+	st.mtx.Unlock()
+	notify(st.readNotify)
+	return nil
+}
+
+func (st *stream) addSendWindow(n uint32) {
+	st.mtx.Lock()
+	st.sendWindow += n
+	st.mtx.Unlock()
+	notify(st.writeNotify)
+}
+
+func (st *stream) receiveCloseWrite() {
+	st.mtx.Lock()
+	st.peerClosedWrite = true
+	st.mtx.Unlock()
+	notify(st.readNotify)
+}
+
+func (st *stream) receiveClose() {
+	st.mtx.Lock()
+	st.peerClosed = true
+	st.mtx.Unlock()
+	notify(st.readNotify)
+	notify(st.writeNotify)
+}
+
+func (st *stream) sessionFailed(err error) {
+	st.mtx.Lock()
+	st.sessionErr = err
+	st.mtx.Unlock()
+	notify(st.readNotify)
+	notify(st.writeNotify)
+}
+
+func (st *stream) LocalAddr() net.Addr  { return st.s.conn.LocalAddr() }
+func (st *stream) RemoteAddr() net.Addr { return st.s.conn.RemoteAddr() }
+
+func (st *stream) SetDeadline(t time.Time) error {
+	st.readDeadline.set(t)
+	st.writeDeadline.set(t)
+	return nil
+}
+
+func (st *stream) SetReadDeadline(t time.Time) error {
+	st.readDeadline.set(t)
+	return nil
+}
+
+func (st *stream) SetWriteDeadline(t time.Time) error {
+	st.writeDeadline.set(t)
+	return nil
+}
@@ -0,0 +1,279 @@
+package streammux
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/util/socketpair"
+)
+
+type testListener struct {
+	conns  chan *transport.AuthConn
+	closed chan struct{}
+}
+
+func (l *testListener) Addr() net.Addr { return nil }
+
+func (l *testListener) Close() error {
+	close(l.closed)
+	return nil
+}
+
+func (l *testListener) Accept(ctx context.Context) (*transport.AuthConn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+
+// testConnecter connects to l through a socketpair.
+type testConnecter struct {
+	l        *testListener
+	mtx      sync.Mutex
+	connects int
+}
+
+func (c *testConnecter) Connect(ctx context.Context) (transport.Wire, error) {
+	a, b, err := socketpair.SocketPair()
+	if err != nil {
+		return nil, err
+	}
+	c.mtx.Lock()
+	c.connects++
+	c.mtx.Unlock()
+	c.l.conns <- transport.NewAuthConn(b, "client")
+	return a, nil
+}
+
+// The caller must close the returned listener.
+func setup() (*testConnecter, *MultiplexingListener) {
+	tl := &testListener{conns: make(chan *transport.AuthConn, 10), closed: make(chan struct{})}
+	return &testConnecter{l: tl}, Listener(tl, 5*time.Second)
+}
+
+// serveEcho echoes each accepted connection until the client calls CloseWrite.
+func serveEcho(l transport.AuthenticatedListener) {
+	for {
+		conn, err := l.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			io.Copy(conn, conn)
+			conn.CloseWrite()
+		}()
+	}
+}
+
+func TestMultiplexedStreams(t *testing.T) {
+	tc, l := setup()
+	defer l.Close()
+	go serveEcho(l)
+	cn := Connecter(tc, 5*time.Second)
+
+	const numStreams = 4
+	const size = 3*streamWindow + 12345 // exceeds the flow control window
+	var wg sync.WaitGroup
+	for i := 0; i < numStreams; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := cn.Connect(context.Background())
+			require.NoError(t, err)
+			defer conn.Close()
+
+			data := make([]byte, size)
+			_, err = rand.Read(data)
+			require.NoError(t, err)
+			go func() {
+				_, err := conn.Write(data)
+				assert.NoError(t, err)
+				assert.NoError(t, conn.CloseWrite())
+			}()
+			echoed, err := ioutil.ReadAll(conn)
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(data, echoed), "stream %d", i)
+		}(i)
+	}
+	wg.Wait()
+
+	tc.mtx.Lock()
+	defer tc.mtx.Unlock()
+	assert.Equal(t, 1, tc.connects, "all streams must share one connection")
+}
+
+func TestListenerPassesThroughRegularConnections(t *testing.T) {
+	tc, l := setup()
+	defer l.Close()
+	go serveEcho(l)
+
+	conn, err := tc.Connect(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	// looks like the start of a versionhandshake banner, shorter than the preamble in one write
+	msg := "0000000042 not multiplexed"
+	_, err = io.WriteString(conn, msg[:5])
+	require.NoError(t, err)
+	_, err = io.WriteString(conn, msg[5:])
+	require.NoError(t, err)
+	require.NoError(t, conn.CloseWrite())
+	echoed, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, msg, string(echoed))
+}
+
+func TestConnecterDetectsPeerWithoutMultiplexing(t *testing.T) {
+	tc, l := setup()
+	defer l.Close()
+	tl := tc.l
+	go func() {
+		conn := <-tl.conns
+		defer conn.Close()
+		// an older peer starts with its versionhandshake banner
+		fmt.Fprintf(conn, "%010d ", 42)
+		ioutil.ReadAll(conn)
+	}()
+
+	cn := Connecter(tc, 5*time.Second)
+	_, err := cn.Connect(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "peer does not support connection multiplexing")
+}
+
+func TestStreamDeadlines(t *testing.T) {
+	tc, l := setup()
+	defer l.Close()
+	accepted := make(chan *transport.AuthConn, 1)
+	go func() {
+		conn, err := l.Accept(context.Background())
+		require.NoError(t, err)
+		accepted <- conn
+	}()
+	cn := Connecter(tc, 5*time.Second)
+	conn, err := cn.Connect(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	server := <-accepted
+	defer server.Close()
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = conn.Read(make([]byte, 1))
+	netErr, ok := err.(net.Error)
+	require.True(t, ok, "%T %s", err, err)
+	assert.True(t, netErr.Timeout())
+
+	// the server does not read, so the writer runs out of window
+	n, err := conn.Write(make([]byte, streamWindow))
+	require.NoError(t, err)
+	assert.Equal(t, streamWindow, n)
+	require.NoError(t, conn.SetWriteDeadline(time.Now().Add(50*time.Millisecond)))
+	n, err = conn.Write(make([]byte, 1))
+	assert.Equal(t, 0, n)
+	netErr, ok = err.(net.Error)
+	require.True(t, ok, "%T %s", err, err)
+	assert.True(t, netErr.Timeout())
+
+	// reset deadlines, reading frees the window
+	require.NoError(t, conn.SetDeadline(time.Time{}))
+	go io.Copy(ioutil.Discard, server)
+	_, err = conn.Write(make([]byte, 2*streamWindow))
+	assert.NoError(t, err)
+}
+
+func TestStreamCloseIsSeenByPeer(t *testing.T) {
+	tc, l := setup()
+	defer l.Close()
+	accepted := make(chan *transport.AuthConn, 1)
+	go func() {
+		conn, err := l.Accept(context.Background())
+		require.NoError(t, err)
+		accepted <- conn
+	}()
+	cn := Connecter(tc, 5*time.Second)
+	conn, err := cn.Connect(context.Background())
+	require.NoError(t, err)
+	server := <-accepted
+	defer server.Close()
+
+	_, err = io.WriteString(conn, "last words")
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	got, err := ioutil.ReadAll(server)
+	require.NoError(t, err)
+	assert.Equal(t, "last words", string(got))
+	_, err = server.Write([]byte("x"))
+	assert.Equal(t, errStreamPeerClosed, err)
+}
+
+func TestStreamReadFailsAfterDeadlineWithBufferedData(t *testing.T) {
+	tc, l := setup()
+	defer l.Close()
+	accepted := make(chan *transport.AuthConn, 1)
+	go func() {
+		conn, err := l.Accept(context.Background())
+		require.NoError(t, err)
+		accepted <- conn
+	}()
+	cn := Connecter(tc, 5*time.Second)
+	conn, err := cn.Connect(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	server := <-accepted
+	defer server.Close()
+
+	_, err = io.WriteString(server, "buffered")
+	require.NoError(t, err)
+	buf := make([]byte, 1)
+	_, err = io.ReadFull(conn, buf) // wait until the data has arrived
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(-time.Second)))
+	_, err = conn.Read(buf)
+	netErr, ok := err.(net.Error)
+	require.True(t, ok, "%T %s", err, err)
+	assert.True(t, netErr.Timeout())
+}
+
+func TestSessionFailsIfPeerStallsWrites(t *testing.T) {
+	defer func(d time.Duration) { sessionWriteTimeout = d }(sessionWriteTimeout)
+	sessionWriteTimeout = 100 * time.Millisecond
+
+	a, b, err := socketpair.SocketPair()
+	require.NoError(t, err)
+	defer b.Close() // the peer never reads
+	s := newSession(a, true, logger.NewNullLogger(), nil)
+	stalled, err := s.open()
+	require.NoError(t, err)
+	other, err := s.open()
+	require.NoError(t, err)
+
+	// the window permits more data than the socket buffers can hold
+	begin := time.Now()
+	_, err = stalled.Write(make([]byte, streamWindow))
+	assert.Error(t, err)
+	assert.True(t, time.Since(begin) < 5*time.Second)
+
+	// the other streams are not blocked by the stalled write
+	begin = time.Now()
+	_, err = other.Write([]byte("x"))
+	assert.Error(t, err)
+	assert.NoError(t, other.Close())
+	assert.True(t, time.Since(begin) < time.Second)
+}
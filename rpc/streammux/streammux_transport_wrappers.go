@@ -0,0 +1,235 @@
+package streammux
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/rpc/dataconn/timeoutconn"
+	"github.com/zrepl/zrepl/transport"
+)
+
+// MultiplexingConnecter returns the connections of Connect as streams of a
+// single connection of the wrapped connecter.
+// The connection is established by the first call to Connect and re-established
+// by the first call after it failed or was closed because it had no streams
+// for ZREPL_TRANSPORT_STREAMMUX_IDLE_TIMEOUT.
+type MultiplexingConnecter struct {
+	connecter transport.Connecter
+	timeout   time.Duration
+
+	mtx     sync.Mutex
+	session *session // nil until the first call to Connect
+}
+
+func Connecter(connecter transport.Connecter, timeout time.Duration) *MultiplexingConnecter {
+	return &MultiplexingConnecter{
+		connecter: connecter,
+		timeout:   timeout,
+	}
+}
+
+func (c *MultiplexingConnecter) Connect(ctx context.Context) (transport.Wire, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.session != nil {
+		st, err := c.session.open()
+		if err == nil {
+			return st, nil
+		}
+		getLog(ctx).WithError(err).Debug("re-establishing multiplexed connection")
+		c.session = nil
+	}
+
+	conn, err := c.connecter.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dl, ok := ctx.Deadline()
+	if !ok {
+		dl = time.Now().Add(c.timeout)
+	}
+	if err := clientPreamble(conn, dl); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// the session outlives ctx, it keeps logging with the fields of the Connect call that established it
+	c.session = newSession(conn, true, getLog(ctx), nil)
+	getLog(ctx).Debug("established multiplexed connection")
+	return c.session.open()
+}
+
+func clientPreamble(conn transport.Wire, deadline time.Time) error {
+	if err := conn.SetDeadline(deadline); err != nil {
+		return errors.Wrap(err, "cannot set deadline for multiplexing preamble")
+	}
+	if _, err := io.WriteString(conn, preamble); err != nil {
+		return errors.Wrap(err, "cannot send multiplexing preamble")
+	}
+	var theirs [preambleLen]byte
+	if _, err := io.ReadFull(conn, theirs[:]); err != nil {
+		return errors.Wrap(err, "cannot read multiplexing preamble acknowledgement")
+	}
+	if string(theirs[:]) != preamble {
+		return errors.New("peer does not support connection multiplexing (it must run a zrepl version that does), or disable `multiplex` in the `connect` section")
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return errors.Wrap(err, "cannot reset deadline after multiplexing preamble")
+	}
+	return nil
+}
+
+type acceptRes struct {
+	conn *transport.AuthConn
+	err  error
+}
+
+// MultiplexingListener accepts both multiplexed and regular connections of
+// the wrapped listener. Each stream of a multiplexed connection is returned
+// by Accept as a connection of its own with the client identity of the
+// multiplexed connection.
+type MultiplexingListener struct {
+	l       transport.AuthenticatedListener
+	timeout time.Duration
+
+	startOnce sync.Once
+	accepted  chan acceptRes
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func Listener(l transport.AuthenticatedListener, timeout time.Duration) *MultiplexingListener {
+	return &MultiplexingListener{
+		l:        l,
+		timeout:  timeout,
+		accepted: make(chan acceptRes),
+		closed:   make(chan struct{}),
+	}
+}
+
+var errListenerClosed = errors.New("listener closed")
+
+func (l *MultiplexingListener) Addr() net.Addr { return l.l.Addr() }
+
+func (l *MultiplexingListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		err = l.l.Close()
+	})
+	return err
+}
+
+// The accept loop of the wrapped listener is started by the first call to Accept and uses its context.
+func (l *MultiplexingListener) Accept(ctx context.Context) (*transport.AuthConn, error) {
+	l.startOnce.Do(func() {
+		go l.acceptLoop(ctx)
+	})
+	select {
+	case res := <-l.accepted:
+		return res.conn, res.err
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *MultiplexingListener) acceptLoop(ctx context.Context) {
+	for {
+		conn, err := l.l.Accept(ctx)
+		if err != nil {
+			if !l.deliver(acceptRes{nil, err}) {
+				return
+			}
+			continue
+		}
+		// detect concurrently so that a slow client does not block the others
+		go l.detect(ctx, conn)
+	}
+}
+
+// deliver returns false if the listener was closed.
+func (l *MultiplexingListener) deliver(res acceptRes) bool {
+	select {
+	case l.accepted <- res:
+		return true
+	case <-l.closed:
+		if res.conn != nil {
+			res.conn.Close()
+		}
+		return false
+	}
+}
+
+func (l *MultiplexingListener) detect(ctx context.Context, conn *transport.AuthConn) {
+	log := getLog(ctx).WithField("client_identity", conn.ClientIdentity())
+
+	var start [preambleLen]byte
+	err := conn.SetDeadline(time.Now().Add(l.timeout))
+	if err == nil {
+		_, err = io.ReadFull(conn, start[:])
+	}
+	if err == nil {
+		err = conn.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		log.WithError(err).Error("cannot read start of connection")
+		conn.Close()
+		return
+	}
+
+	if string(start[:]) != preamble {
+		wire := &prefixWire{Wire: conn, prefix: start[:]}
+		l.deliver(acceptRes{transport.NewAuthConn(wire, conn.ClientIdentity()), nil})
+		return
+	}
+
+	if _, err := io.WriteString(conn, preamble); err != nil {
+		log.WithError(err).Error("cannot acknowledge multiplexing preamble")
+		conn.Close()
+		return
+	}
+	log.Debug("accepted multiplexed connection")
+	newSession(conn, false, log, func(st *stream) {
+		go l.deliver(acceptRes{transport.NewAuthConn(st, conn.ClientIdentity()), nil})
+	})
+}
+
+// prefixWire returns the bytes of prefix before those of Wire,
+// i.e., it puts back the bytes that were read to detect a multiplexed connection.
+type prefixWire struct {
+	transport.Wire
+	mtx    sync.Mutex
+	prefix []byte
+}
+
+var _ timeoutconn.SyscallConner = (*prefixWire)(nil)
+
+func (w *prefixWire) Read(p []byte) (int, error) {
+	w.mtx.Lock()
+	if len(w.prefix) > 0 {
+		n := copy(p, w.prefix)
+		w.prefix = w.prefix[n:]
+		w.mtx.Unlock()
+		return n, nil
+	}
+	w.mtx.Unlock()
+	return w.Wire.Read(p)
+}
+
+// Reads via the raw connection would skip the prefix, hence they are only
+// supported after the prefix was read, i.e., after the version handshake.
+func (w *prefixWire) SyscallConn() (syscall.RawConn, error) {
+	w.mtx.Lock()
+	prefixLeft := len(w.prefix) > 0
+	w.mtx.Unlock()
+	scc, ok := w.Wire.(timeoutconn.SyscallConner)
+	if prefixLeft || !ok {
+		return nil, timeoutconn.SyscallConnNotSupported
+	}
+	return scc.SyscallConn()
+}
@@ -150,9 +150,13 @@ func (m *HandshakeMessage) DecodeReader(r io.Reader, maxLen int) error {
 	return nil
 }
 
+// CurrentProtocolVersion is the protocol version of this zrepl version.
+// It must be incremented on incompatible changes to the RPC protocol,
+// see the golden exchanges in package rpc.
+const CurrentProtocolVersion = 5
+
 func DoHandshakeCurrentVersion(conn net.Conn, deadline time.Time) *HandshakeError {
-	// current protocol version is hardcoded here
-	return DoHandshakeVersion(conn, deadline, 5)
+	return DoHandshakeVersion(conn, deadline, CurrentProtocolVersion)
 }
 
 const HandshakeMessageMaxLen = 16 * 4096
@@ -0,0 +1,161 @@
+// Package streamarchive stores zfs send streams as objects instead of receiving them into a pool.
+//
+// An archive consists of the stream objects and a manifest (ManifestObjectName)
+// that records, per filesystem, the chain of streams starting with a full send followed by incrementals.
+// Receiver implements the receiving side of replication on top of an archive,
+// Import replays the chains into a pool.
+//
+// The objects are kept in a Storage, e.g., a directory (DirStorage).
+package streamarchive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// Storage stores the objects of an archive.
+type Storage interface {
+	// Put stores the data read from r as object name, replacing an existing object.
+	// If Put fails, the object must be unchanged, i.e., it must not be partially written.
+	Put(ctx context.Context, name string, r io.Reader) error
+	// Get returns os.ErrNotExist (possibly wrapped) if the object does not exist.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	Delete(ctx context.Context, name string) error
+	// Check returns an error if the storage is not accessible.
+	Check(ctx context.Context) error
+	String() string
+}
+
+const (
+	ManifestObjectName = "manifest.json"
+	manifestVersion    = 1
+)
+
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+)
+
+func (c Compression) Validate() error {
+	switch c {
+	case CompressionNone, CompressionGzip:
+		return nil
+	default:
+		return errors.Errorf("unknown compression %q", c)
+	}
+}
+
+type Manifest struct {
+	Version int
+	// by filesystem name on the sending side
+	Filesystems map[string]*ManifestFilesystem
+}
+
+type ManifestFilesystem struct {
+	// The first stream is a full send, the following streams are incrementals
+	// from their predecessor's To.
+	Streams []*ManifestStream
+}
+
+type ManifestStream struct {
+	Object string
+	// nil for a full send
+	From        *ManifestVersion `json:",omitempty"`
+	To          ManifestVersion
+	Compression Compression
+	// size and SHA-256 checksum of the object
+	Size     int64
+	SHA256   string
+	Archived time.Time
+}
+
+type ManifestVersion struct {
+	Name      string // without @
+	Guid      uint64
+	CreateTXG uint64
+	Creation  time.Time
+}
+
+func manifestVersionFromPDU(v *pdu.FilesystemVersion) (ManifestVersion, error) {
+	creation, err := v.CreationAsTime()
+	if err != nil {
+		return ManifestVersion{}, errors.Wrap(err, "invalid creation time")
+	}
+	return ManifestVersion{
+		Name:      v.GetName(),
+		Guid:      v.GetGuid(),
+		CreateTXG: v.GetCreateTXG(),
+		Creation:  creation,
+	}, nil
+}
+
+func (v ManifestVersion) ToPDU() *pdu.FilesystemVersion {
+	return &pdu.FilesystemVersion{
+		Type:      pdu.FilesystemVersion_Snapshot,
+		Name:      v.Name,
+		Guid:      v.Guid,
+		CreateTXG: v.CreateTXG,
+		Creation:  v.Creation.Format(time.RFC3339),
+	}
+}
+
+func (f *ManifestFilesystem) tip() *ManifestStream {
+	if len(f.Streams) == 0 {
+		return nil
+	}
+	return f.Streams[len(f.Streams)-1]
+}
+
+// objectName returns the name of the n-th stream object of fs.
+func objectName(fs string, n int, to string, c Compression) string {
+	name := fmt.Sprintf("streams/%s/%06d_%s.zfs", url.PathEscape(fs), n, url.PathEscape(to))
+	if c == CompressionGzip {
+		name += ".gz"
+	}
+	return name
+}
+
+// LoadManifest returns an empty manifest if the archive does not have a manifest yet.
+func LoadManifest(ctx context.Context, s Storage) (*Manifest, error) {
+	r, err := s.Get(ctx, ManifestObjectName)
+	if os.IsNotExist(errors.Cause(err)) {
+		return &Manifest{Version: manifestVersion, Filesystems: make(map[string]*ManifestFilesystem)}, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "cannot read manifest")
+	}
+	defer r.Close()
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, errors.Wrap(err, "cannot decode manifest")
+	}
+	if m.Version != manifestVersion {
+		return nil, errors.Errorf("unsupported manifest version %d", m.Version)
+	}
+	if m.Filesystems == nil {
+		m.Filesystems = make(map[string]*ManifestFilesystem)
+	}
+	return &m, nil
+}
+
+func storeManifest(ctx context.Context, s Storage, m *Manifest) error {
+	buf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, ManifestObjectName, bytes.NewReader(buf)); err != nil {
+		return errors.Wrap(err, "cannot write manifest")
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package streamarchive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// DirStorage stores the objects of an archive as files below a directory,
+// e.g., on removable media.
+type DirStorage struct {
+	Path string
+}
+
+var _ Storage = (*DirStorage)(nil)
+
+func (s *DirStorage) String() string { return fmt.Sprintf("directory %q", s.Path) }
+
+func (s *DirStorage) path(name string) string { return filepath.Join(s.Path, filepath.FromSlash(name)) }
+
+func (s *DirStorage) Check(ctx context.Context) error {
+	st, err := os.Stat(s.Path)
+	if err != nil {
+		return err
+	}
+	if !st.IsDir() {
+		return errors.Errorf("%q is not a directory", s.Path)
+	}
+	return nil
+}
+
+// Put writes to a temporary file that is renamed to the object's file name on success.
+func (s *DirStorage) Put(ctx context.Context, name string, r io.Reader) error {
+	p := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no-op after successful rename
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+func (s *DirStorage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(s.path(name))
+}
+
+func (s *DirStorage) Delete(ctx context.Context, name string) error {
+	return os.Remove(s.path(name))
+}
@@ -0,0 +1,73 @@
+package streamarchive
+
+import (
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+// IsArchiveConnect returns true if in configures a stream archive instead of a transport.
+func IsArchiveConnect(in config.ConnectEnum) bool {
+	switch in.Ret.(type) {
+	case *config.ExportConnect, *config.S3Connect:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReceiverFromConfig builds the receiver for a connect configuration for which IsArchiveConnect is true.
+func ReceiverFromConfig(in config.ConnectEnum) (*Receiver, error) {
+	var (
+		storage     Storage
+		compression string
+	)
+	switch v := in.Ret.(type) {
+	case *config.ExportConnect:
+		storage = &DirStorage{Path: v.Path}
+		compression = v.Compression
+	case *config.S3Connect:
+		s, err := S3StorageFromConfig(v)
+		if err != nil {
+			return nil, err
+		}
+		storage = s
+		compression = v.Compression
+	default:
+		return nil, errors.Errorf("implementation error: connect type %T is not a stream archive", v)
+	}
+	return NewReceiver(storage, Compression(compression))
+}
+
+func S3StorageFromConfig(in *config.S3Connect) (*S3Storage, error) {
+	endpoint, err := url.Parse(in.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid endpoint")
+	}
+	if endpoint.Scheme != "https" && endpoint.Scheme != "http" {
+		return nil, errors.Errorf("endpoint must be an http or https URL, got %q", in.Endpoint)
+	}
+	if in.Bucket == "" {
+		return nil, errors.New("bucket must not be empty")
+	}
+	secret, err := ioutil.ReadFile(in.SecretAccessKeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read secret access key file")
+	}
+	if in.PartSize != 0 && in.PartSize < S3MinPartSize {
+		return nil, errors.Errorf("part_size must be at least %d bytes", S3MinPartSize)
+	}
+	return &S3Storage{
+		Endpoint:        endpoint,
+		Region:          in.Region,
+		Bucket:          in.Bucket,
+		Prefix:          in.Prefix,
+		AccessKeyID:     in.AccessKeyID,
+		SecretAccessKey: strings.TrimSpace(string(secret)),
+		PartSize:        int64(in.PartSize),
+	}, nil
+}
@@ -0,0 +1,59 @@
+package streamarchive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// The leading DRR_BEGIN record of a (non-compound) zfs send stream, see dmu_replay_record in zfs_ioctl.h:
+//
+//	uint32 drr_type, uint32 drr_payloadlen,
+//	uint64 drr_magic, uint64 drr_versioninfo, uint64 drr_creation_time,
+//	uint32 drr_type (objset type), uint32 drr_flags,
+//	uint64 drr_toguid, uint64 drr_fromguid, char drr_toname[256]
+const (
+	streamHeaderLen            = 312
+	streamHeaderRecordBegin    = 0
+	streamHeaderMagic          = 0x2F5bacbac
+	streamHeaderMagicOffset    = 8
+	streamHeaderToGUIDOffset   = 40
+	streamHeaderFromGUIDOffset = 48
+)
+
+// streamHeader is the part of a send stream's DRR_BEGIN record that identifies the step it was created for.
+type streamHeader struct {
+	// 0 for a full send
+	FromGUID uint64
+	ToGUID   uint64
+}
+
+// readStreamHeader reads the DRR_BEGIN record from stream and returns it together with
+// a reader that yields the complete stream, i.e., including the header.
+func readStreamHeader(stream io.Reader) (streamHeader, io.Reader, error) {
+	buf := make([]byte, streamHeaderLen)
+	n, err := io.ReadFull(stream, buf)
+	if err != nil {
+		return streamHeader{}, nil, errors.Wrapf(err, "cannot read send stream header (got %d bytes)", n)
+	}
+	// the stream is in the byte order of the sending host
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint64(buf[streamHeaderMagicOffset:]) == streamHeaderMagic:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint64(buf[streamHeaderMagicOffset:]) == streamHeaderMagic:
+		order = binary.BigEndian
+	default:
+		return streamHeader{}, nil, errors.New("send stream does not start with a DRR_BEGIN record (bad magic)")
+	}
+	if t := order.Uint32(buf); t != streamHeaderRecordBegin {
+		return streamHeader{}, nil, errors.Errorf("send stream does not start with a DRR_BEGIN record (record type %d)", t)
+	}
+	hdr := streamHeader{
+		FromGUID: order.Uint64(buf[streamHeaderFromGUIDOffset:]),
+		ToGUID:   order.Uint64(buf[streamHeaderToGUIDOffset:]),
+	}
+	return hdr, io.MultiReader(bytes.NewReader(buf), stream), nil
+}
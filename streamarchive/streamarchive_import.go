@@ -0,0 +1,220 @@
+package streamarchive
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+type ImportOptions struct {
+	// The archived filesystem fs is imported as RootFS/fs. RootFS must exist.
+	RootFS *zfs.DatasetPath
+	// Only import the archived filesystems that pass the filter. nil imports all filesystems.
+	Filesystems zfs.DatasetFilter
+	// Only determine and report the streams that would be imported.
+	DryRun bool
+	// Called before a stream is imported (or would be imported if DryRun is set).
+	OnStream func(fs string, target *zfs.DatasetPath, s *ManifestStream)
+}
+
+// Import replays the archived stream chains into the pool.
+// Streams whose To snapshot already exists in the target filesystem are skipped,
+// i.e., Import can be used repeatedly to apply the streams that were archived since the last import.
+// Filesystems are imported in lexicographical order, which ensures that parents are imported before their children.
+// Missing parents of the target filesystems below RootFS are created as placeholders.
+func Import(ctx context.Context, storage Storage, opts ImportOptions) error {
+	m, err := LoadManifest(ctx, storage)
+	if err != nil {
+		return err
+	}
+	fss := make([]string, 0, len(m.Filesystems))
+	for fs := range m.Filesystems {
+		fss = append(fss, fs)
+	}
+	sort.Strings(fss)
+
+	for _, fs := range fss {
+		fsPath, err := zfs.NewDatasetPath(fs)
+		if err != nil {
+			return errors.Wrapf(err, "invalid filesystem name %q in manifest", fs)
+		}
+		if opts.Filesystems != nil {
+			pass, err := zfs.FilterContext(ctx, opts.Filesystems, fsPath)
+			if err != nil {
+				return errors.Wrapf(err, "cannot apply filesystem filter to %q", fs)
+			}
+			if !pass {
+				continue
+			}
+		}
+		target := opts.RootFS.Copy()
+		target.Extend(fsPath)
+		if err := importFilesystem(ctx, storage, m.Filesystems[fs], fs, target, opts); err != nil {
+			return errors.Wrapf(err, "import %q into %q", fs, target.ToString())
+		}
+	}
+	return nil
+}
+
+func importFilesystem(ctx context.Context, storage Storage, mfs *ManifestFilesystem, fs string, target *zfs.DatasetPath, opts ImportOptions) error {
+	ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, target)
+	if err != nil {
+		return errors.Wrap(err, "cannot get placeholder state of target")
+	}
+	existing := make(map[uint64]bool)
+	if ph.FSExists {
+		versions, err := zfs.ZFSListFilesystemVersions(ctx, target, zfs.ListFilesystemVersionsOptions{Types: zfs.Snapshots})
+		if err != nil {
+			return errors.Wrap(err, "cannot list snapshots of target")
+		}
+		for _, v := range versions {
+			existing[v.Guid] = true
+		}
+	}
+
+	streams, err := importPlan(mfs, existing, ph.FSExists && !ph.IsPlaceholder)
+	if err != nil {
+		return err
+	}
+	if len(streams) > 0 && !ph.FSExists && !opts.DryRun {
+		if err := importCreatePlaceholderParents(ctx, opts.RootFS, target); err != nil {
+			return err
+		}
+	}
+
+	for i, s := range streams {
+		if opts.OnStream != nil {
+			opts.OnStream(fs, target, s)
+		}
+		if opts.DryRun {
+			continue
+		}
+		if err := verifyObject(ctx, storage, s); err != nil {
+			return err
+		}
+		var recvOpts zfs.RecvOptions
+		replacePlaceholder := i == 0 && ph.FSExists && ph.IsPlaceholder
+		if replacePlaceholder {
+			recvOpts.RollbackAndForceRecv = true
+		}
+		if err := importStream(ctx, storage, s, target, recvOpts); err != nil {
+			return err
+		}
+		if replacePlaceholder {
+			if err := zfs.ZFSSetPlaceholder(ctx, target, false); err != nil {
+				return errors.Wrap(err, "cannot clear placeholder property")
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the streams of mfs that need to be received into a filesystem with the snapshots in existing.
+// targetHasData must be true if the filesystem exists and is not a placeholder.
+func importPlan(mfs *ManifestFilesystem, existing map[uint64]bool, targetHasData bool) ([]*ManifestStream, error) {
+	for i := len(mfs.Streams) - 1; i >= 0; i-- {
+		if existing[mfs.Streams[i].To.Guid] {
+			return mfs.Streams[i+1:], nil
+		}
+	}
+	if targetHasData {
+		return nil, errors.New("target filesystem exists but has none of the archived snapshots")
+	}
+	if len(mfs.Streams) > 0 && mfs.Streams[0].From != nil {
+		return nil, errors.Errorf("archive is incomplete: first stream %q is not a full send", mfs.Streams[0].Object)
+	}
+	return mfs.Streams, nil
+}
+
+func importCreatePlaceholderParents(ctx context.Context, root, target *zfs.DatasetPath) error {
+	comps := strings.Split(target.ToString(), "/")
+	for l := root.Length() + 1; l < len(comps); l++ {
+		parent, err := zfs.NewDatasetPath(strings.Join(comps[:l-1], "/"))
+		if err != nil {
+			return err
+		}
+		p, err := zfs.NewDatasetPath(strings.Join(comps[:l], "/"))
+		if err != nil {
+			return err
+		}
+		ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, p)
+		if err != nil {
+			return errors.Wrapf(err, "cannot get placeholder state of %q", p.ToString())
+		}
+		if ph.FSExists {
+			continue
+		}
+		if err := zfs.ZFSCreatePlaceholderFilesystem(ctx, p, parent); err != nil {
+			return errors.Wrapf(err, "cannot create placeholder filesystem %q", p.ToString())
+		}
+	}
+	return nil
+}
+
+func openObject(ctx context.Context, storage Storage, s *ManifestStream) (io.ReadCloser, error) {
+	r, err := storage.Get(ctx, s.Object)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read %q", s.Object)
+	}
+	return r, nil
+}
+
+// verifyObject reads the object of s and compares its checksum with the manifest
+// so that a damaged stream is detected before it is received.
+func verifyObject(ctx context.Context, storage Storage, s *ManifestStream) error {
+	r, err := openObject(ctx, storage, s)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return errors.Wrapf(err, "cannot read %q", s.Object)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != s.SHA256 {
+		return errors.Errorf("checksum mismatch for %q: manifest has %s, object has %s", s.Object, s.SHA256, sum)
+	}
+	return nil
+}
+
+func importStream(ctx context.Context, storage Storage, s *ManifestStream, target *zfs.DatasetPath, recvOpts zfs.RecvOptions) error {
+	r, err := openObject(ctx, storage, s)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	var stream io.ReadCloser = r
+	switch s.Compression {
+	case CompressionGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return errors.Wrapf(err, "cannot decompress %q", s.Object)
+		}
+		stream = ioutil.NopCloser(zr)
+	case CompressionNone, "":
+	default:
+		return errors.Errorf("unknown compression %q of %q", s.Compression, s.Object)
+	}
+	to := &zfs.ZFSSendArgVersion{RelName: "@" + s.To.Name, GUID: s.To.Guid}
+	if err := zfs.ZFSRecv(ctx, target.ToString(), to, stream, recvOpts); err != nil {
+		return errors.Wrapf(err, "cannot receive %q", s.Object)
+	}
+	return nil
+}
+
+func (s *ManifestStream) String() string {
+	if s.From == nil {
+		return fmt.Sprintf("full @%s (%s)", s.To.Name, s.Object)
+	}
+	return fmt.Sprintf("@%s -> @%s (%s)", s.From.Name, s.To.Name, s.Object)
+}
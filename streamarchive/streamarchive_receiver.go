@@ -0,0 +1,266 @@
+package streamarchive
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/replication/logic"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// Receiver implements the receiving side of replication by appending the received streams
+// to the archive in storage.
+//
+// The receiver presents the To snapshots of the archived streams as the versions of the filesystem.
+// Since the replication planner only sends incrementals from the newest version on the receiving side,
+// each received stream is an incremental from the current tip of the filesystem's chain (or a full send
+// for a filesystem that is not in the archive yet).
+//
+// Archived streams cannot be destroyed because that would break the chains.
+// Interrupted receives are not resumable, the stream is sent again.
+type Receiver struct {
+	storage     Storage
+	compression Compression
+
+	// protects the manifest in storage
+	mtx sync.Mutex
+}
+
+var _ logic.Receiver = (*Receiver)(nil)
+
+func NewReceiver(storage Storage, compression Compression) (*Receiver, error) {
+	if err := compression.Validate(); err != nil {
+		return nil, err
+	}
+	return &Receiver{storage: storage, compression: compression}, nil
+}
+
+func getLogger(ctx context.Context) logger.Logger {
+	return logging.GetLogger(ctx, logging.SubsysEndpoint)
+}
+
+func (r *Receiver) WaitForConnectivity(ctx context.Context) error {
+	if err := r.storage.Check(ctx); err != nil {
+		return errors.Wrapf(err, "archive storage %s is not accessible", r.storage)
+	}
+	return nil
+}
+
+func (r *Receiver) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	m, err := LoadManifest(ctx, r.storage)
+	if err != nil {
+		return nil, err
+	}
+	res := &pdu.ListFilesystemRes{}
+	for fs, mfs := range m.Filesystems {
+		if len(mfs.Streams) == 0 {
+			continue
+		}
+		res.Filesystems = append(res.Filesystems, &pdu.Filesystem{Path: fs})
+	}
+	sort.Slice(res.Filesystems, func(i, j int) bool { return res.Filesystems[i].Path < res.Filesystems[j].Path })
+	return res, nil
+}
+
+func (r *Receiver) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	m, err := LoadManifest(ctx, r.storage)
+	if err != nil {
+		return nil, err
+	}
+	mfs, ok := m.Filesystems[req.GetFilesystem()]
+	if !ok {
+		return nil, errors.Errorf("filesystem %q is not in the archive", req.GetFilesystem())
+	}
+	res := &pdu.ListFilesystemVersionsRes{}
+	for _, s := range mfs.Streams {
+		res.Versions = append(res.Versions, s.To.ToPDU())
+	}
+	return res, nil
+}
+
+func (r *Receiver) DestroySnapshots(ctx context.Context, req *pdu.DestroySnapshotsReq) (*pdu.DestroySnapshotsRes, error) {
+	res := &pdu.DestroySnapshotsRes{}
+	for _, s := range req.GetSnapshots() {
+		res.Results = append(res.Results, &pdu.DestroySnapshotRes{
+			Snapshot: s,
+			Error:    "archived streams cannot be destroyed, configure keep_receiver to keep all snapshots",
+		})
+	}
+	return res, nil
+}
+
+func (r *Receiver) RenameFilesystem(ctx context.Context, req *pdu.RenameFilesystemReq) (*pdu.RenameFilesystemRes, error) {
+	return nil, errors.New("archived filesystems cannot be renamed")
+}
+
+func (r *Receiver) Rollback(ctx context.Context, req *pdu.RollbackReq) (*pdu.RollbackRes, error) {
+	return nil, errors.New("archived filesystems cannot be rolled back")
+}
+
+func (r *Receiver) DestroyFilesystem(ctx context.Context, req *pdu.DestroyFilesystemReq) (*pdu.DestroyFilesystemRes, error) {
+	return nil, errors.New("archived filesystems cannot be destroyed")
+}
+
+func (r *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, stream io.ReadCloser) (*pdu.ReceiveRes, error) {
+	defer stream.Close()
+
+	if _, err := zfs.NewDatasetPath(req.GetFilesystem()); err != nil {
+		return nil, errors.Wrap(err, "`Filesystem` invalid")
+	}
+	if req.GetTo() == nil || req.GetTo().GetType() != pdu.FilesystemVersion_Snapshot {
+		return nil, errors.New("`To` must be a snapshot")
+	}
+	to, err := manifestVersionFromPDU(req.GetTo())
+	if err != nil {
+		return nil, errors.Wrap(err, "`To` invalid")
+	}
+
+	// Determine the object name up front, the manifest is updated after the upload.
+	// Concurrent receives for the same filesystem do not happen because the
+	// replication driver replicates the steps of a filesystem sequentially.
+	r.mtx.Lock()
+	m, err := LoadManifest(ctx, r.storage)
+	r.mtx.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	hdr, body, err := readStreamHeader(stream)
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	mfs := m.Filesystems[req.GetFilesystem()]
+	if mfs != nil {
+		n = len(mfs.Streams)
+	}
+	if _, err := chainLink(mfs, hdr, to); err != nil {
+		return nil, err
+	}
+	object := objectName(req.GetFilesystem(), n, to.Name, r.compression)
+
+	log := getLogger(ctx).WithField("fs", req.GetFilesystem()).WithField("object", object)
+	log.Info("archiving stream")
+
+	stored, err := r.put(ctx, object, body)
+	if err != nil {
+		log.WithError(err).Error("cannot archive stream")
+		return nil, errors.Wrapf(err, "cannot archive stream to %s", r.storage)
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	m, err = LoadManifest(ctx, r.storage)
+	if err != nil {
+		return nil, err
+	}
+	mfs = m.Filesystems[req.GetFilesystem()]
+	from, err := chainLink(mfs, hdr, to)
+	if err != nil {
+		// the manifest changed during the upload, the stored object must not remain unreferenced
+		if delErr := r.storage.Delete(ctx, object); delErr != nil {
+			log.WithError(delErr).Error("cannot delete stream object that does not extend the chain")
+		}
+		return nil, err
+	}
+	if mfs == nil {
+		mfs = &ManifestFilesystem{}
+		m.Filesystems[req.GetFilesystem()] = mfs
+	}
+	s := &ManifestStream{
+		Object:      object,
+		To:          to,
+		Compression: r.compression,
+		Size:        stored.size,
+		SHA256:      stored.sha256,
+		Archived:    time.Now(),
+		From:        from,
+	}
+	mfs.Streams = append(mfs.Streams, s)
+	if err := storeManifest(ctx, r.storage, m); err != nil {
+		log.WithError(err).Error("cannot update manifest after archiving stream")
+		return nil, err
+	}
+	log.WithField("size", stored.size).Info("archived stream")
+	return &pdu.ReceiveRes{}, nil
+}
+
+// chainLink checks that a stream with header hdr for snapshot to extends the chain of archived streams mfs
+// (nil if there are none) and returns the stream's `from` version (nil for a full send).
+func chainLink(mfs *ManifestFilesystem, hdr streamHeader, to ManifestVersion) (*ManifestVersion, error) {
+	if hdr.ToGUID != to.Guid {
+		return nil, errors.Errorf("send stream is for snapshot with guid %d, expected @%s (guid %d)", hdr.ToGUID, to.Name, to.Guid)
+	}
+	var tip *ManifestStream
+	if mfs != nil {
+		tip = mfs.tip()
+	}
+	switch {
+	case tip == nil && hdr.FromGUID == 0:
+		return nil, nil
+	case tip == nil:
+		return nil, errors.Errorf("incremental send stream (from guid %d) cannot start a chain of archived streams", hdr.FromGUID)
+	case hdr.FromGUID == 0:
+		return nil, errors.Errorf("full send stream cannot extend the chain of archived streams ending at @%s", tip.To.Name)
+	case hdr.FromGUID != tip.To.Guid:
+		return nil, errors.Errorf("incremental send stream is from guid %d, but the chain of archived streams ends at @%s (guid %d)", hdr.FromGUID, tip.To.Name, tip.To.Guid)
+	}
+	from := tip.To
+	return &from, nil
+}
+
+type storedObject struct {
+	size   int64
+	sha256 string
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// put compresses stream as configured and stores it as object.
+// The returned size and checksum are those of the stored object.
+func (r *Receiver) put(ctx context.Context, object string, stream io.Reader) (storedObject, error) {
+	pr, pw := io.Pipe()
+	h := sha256.New()
+	var size countingWriter
+	go func() {
+		var err error
+		switch r.compression {
+		case CompressionGzip:
+			zw := gzip.NewWriter(pw)
+			_, err = io.Copy(zw, stream)
+			if closeErr := zw.Close(); err == nil {
+				err = closeErr
+			}
+		default:
+			_, err = io.Copy(pw, stream)
+		}
+		pw.CloseWithError(err)
+	}()
+	err := r.storage.Put(ctx, object, io.TeeReader(pr, io.MultiWriter(h, &size)))
+	pr.CloseWithError(err) // unblock the goroutine if Put returned early
+	if err != nil {
+		return storedObject{}, err
+	}
+	return storedObject{size: size.n, sha256: hex.EncodeToString(h.Sum(nil))}, nil
+}
@@ -0,0 +1,357 @@
+package streamarchive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	S3MinPartSize     = 5 << 20
+	S3DefaultPartSize = 64 << 20
+	s3MaxParts        = 10000
+)
+
+// S3Storage stores the objects of an archive in a bucket of an S3-compatible object storage.
+//
+// Requests use path-style addressing (Endpoint/Bucket/Key) and are signed with AWS Signature Version 4.
+// Objects larger than PartSize are uploaded using multipart uploads, which only become visible
+// when the upload is completed, i.e., Put is atomic.
+// A part is buffered in memory before it is uploaded, and an object can have at most 10000 parts.
+type S3Storage struct {
+	Endpoint        *url.URL // e.g. https://s3.eu-central-1.amazonaws.com
+	Region          string
+	Bucket          string
+	Prefix          string // the objects are stored below this key prefix, e.g. `host1`, a trailing slash is optional
+	AccessKeyID     string
+	SecretAccessKey string
+	PartSize        int64 // zero means S3DefaultPartSize
+
+	Client *http.Client // nil means http.DefaultClient
+}
+
+var _ Storage = (*S3Storage)(nil)
+
+func (s *S3Storage) String() string {
+	return fmt.Sprintf("s3 bucket %q (prefix %q) at %s", s.Bucket, s.Prefix, s.Endpoint)
+}
+
+func (s *S3Storage) partSize() int64 {
+	if s.PartSize == 0 {
+		return S3DefaultPartSize
+	}
+	return s.PartSize
+}
+
+// key returns the object key of the archive object name.
+func (s *S3Storage) key(name string) string {
+	return path.Join(s.Prefix, name)
+}
+
+func (s *S3Storage) Check(ctx context.Context) error {
+	res, err := s.do(ctx, http.MethodHead, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	res, err := s.do(ctx, http.MethodGet, s.key(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, name string) error {
+	res, err := s.do(ctx, http.MethodDelete, s.key(name), nil, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, name string, r io.Reader) error {
+	key := s.key(name)
+	buf := make([]byte, s.partSize())
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		res, err := s.do(ctx, http.MethodPut, key, nil, buf[:n])
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return s.putMultipart(ctx, key, buf, r)
+}
+
+type s3InitiateMultipartUploadResult struct {
+	UploadId string
+}
+
+type s3CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+// putMultipart uploads first, which must be a full part, followed by the data read from r.
+func (s *S3Storage) putMultipart(ctx context.Context, key string, first []byte, r io.Reader) (err error) {
+	res, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return errors.Wrap(err, "cannot initiate multipart upload")
+	}
+	var initiated s3InitiateMultipartUploadResult
+	err = xml.NewDecoder(res.Body).Decode(&initiated)
+	res.Body.Close()
+	if err != nil {
+		return errors.Wrap(err, "cannot decode multipart upload initiation response")
+	}
+	uploadID := url.Values{"uploadId": {initiated.UploadId}}
+	defer func() {
+		if err == nil {
+			return
+		}
+		// don't use ctx, it might be the reason for the failure
+		abortCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if res, abortErr := s.do(abortCtx, http.MethodDelete, key, uploadID, nil); abortErr == nil {
+			res.Body.Close()
+		}
+	}()
+
+	var complete s3CompleteMultipartUpload
+	buf, n := first, len(first)
+	for {
+		partNumber := len(complete.Parts) + 1
+		if partNumber > s3MaxParts {
+			return errors.Errorf("object exceeds the maximum of %d parts of %d bytes", s3MaxParts, s.partSize())
+		}
+		q := url.Values{
+			"partNumber": {strconv.Itoa(partNumber)},
+			"uploadId":   {initiated.UploadId},
+		}
+		res, err := s.do(ctx, http.MethodPut, key, q, buf[:n])
+		if err != nil {
+			return errors.Wrapf(err, "cannot upload part %d", partNumber)
+		}
+		res.Body.Close()
+		complete.Parts = append(complete.Parts, s3CompletedPart{PartNumber: partNumber, ETag: res.Header.Get("ETag")})
+
+		n, err = io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	res, err = s.do(ctx, http.MethodPost, key, uploadID, body)
+	if err != nil {
+		return errors.Wrap(err, "cannot complete multipart upload")
+	}
+	defer res.Body.Close()
+	// CompleteMultipartUpload may fail after the response status has been sent
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrap(err, "cannot read multipart upload completion response")
+	}
+	if err := s3ErrorFromBody(resBody); err != nil {
+		return errors.Wrap(err, "cannot complete multipart upload")
+	}
+	return nil
+}
+
+type S3Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3 request failed: %s", http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("s3 request failed: %s: %s", e.Code, e.Message)
+}
+
+// returns nil if body is not an S3 error document
+func s3ErrorFromBody(body []byte) *S3Error {
+	var doc struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if err := xml.Unmarshal(body, &doc); err != nil || doc.XMLName.Local != "Error" {
+		return nil
+	}
+	return &S3Error{Code: doc.Code, Message: doc.Message}
+}
+
+// do sends a signed request for key (the bucket if key is empty).
+// Responses with a status other than 2xx are returned as *S3Error,
+// and os.ErrNotExist if the key does not exist.
+func (s *S3Storage) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := *s.Endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = s3CanonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = int64(len(body))
+	s3Sign(req, body, s.AccessKeyID, s.SecretAccessKey, s.Region, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 == 2 {
+		return res, nil
+	}
+	defer res.Body.Close()
+	resBody, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1<<16))
+	s3Err := s3ErrorFromBody(resBody)
+	if s3Err == nil {
+		s3Err = &S3Error{}
+	}
+	s3Err.StatusCode = res.StatusCode
+	if res.StatusCode == http.StatusNotFound && key != "" && s3Err.Code != "NoSuchBucket" {
+		return nil, errors.Wrapf(os.ErrNotExist, "object %q", key)
+	}
+	return nil, s3Err
+}
+
+// s3Escape URI-encodes s as required by AWS Signature Version 4.
+// The slash is only encoded if encodeSlash is true.
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			pairs = append(pairs, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Sign adds the AWS Signature Version 4 authorization header to req.
+// The host and all headers in req.Header are signed.
+func s3Sign(req *http.Request, body []byte, accessKeyID, secretAccessKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, vs := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(vs, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, headers[k])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, false),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature))
+}
@@ -0,0 +1,205 @@
+package streamarchive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func testVersion(name string, guid uint64) *pdu.FilesystemVersion {
+	return &pdu.FilesystemVersion{
+		Type:      pdu.FilesystemVersion_Snapshot,
+		Name:      name,
+		Guid:      guid,
+		CreateTXG: guid,
+		Creation:  time.Date(2020, 1, 1, 0, 0, int(guid), 0, time.UTC).Format(time.RFC3339),
+	}
+}
+
+// testStream returns a send stream with a DRR_BEGIN record for the step from -> to (from = 0 for a full send).
+func testStream(from, to uint64, payload string) []byte {
+	hdr := make([]byte, streamHeaderLen)
+	binary.LittleEndian.PutUint32(hdr, streamHeaderRecordBegin)
+	binary.LittleEndian.PutUint64(hdr[streamHeaderMagicOffset:], streamHeaderMagic)
+	binary.LittleEndian.PutUint64(hdr[streamHeaderToGUIDOffset:], to)
+	binary.LittleEndian.PutUint64(hdr[streamHeaderFromGUIDOffset:], from)
+	return append(hdr, payload...)
+}
+
+func TestReceiverArchivesChain(t *testing.T) {
+	for _, c := range []Compression{CompressionNone, CompressionGzip} {
+		t.Run(string(c), func(t *testing.T) {
+			ctx := context.Background()
+			dir, err := ioutil.TempDir("", "zrepl-streamarchive-")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			storage := &DirStorage{Path: dir}
+
+			r, err := NewReceiver(storage, c)
+			require.NoError(t, err)
+			require.NoError(t, r.WaitForConnectivity(ctx))
+
+			payloads := [][]byte{testStream(0, 1, "full stream"), testStream(1, 2, "incremental stream")}
+			for i, p := range payloads {
+				req := &pdu.ReceiveReq{Filesystem: "pool/data", To: testVersion("s"+string('a'+rune(i)), uint64(i+1))}
+				_, err := r.Receive(ctx, req, ioutil.NopCloser(bytes.NewReader(p)))
+				require.NoError(t, err)
+			}
+
+			fss, err := r.ListFilesystems(ctx, &pdu.ListFilesystemReq{})
+			require.NoError(t, err)
+			require.Len(t, fss.Filesystems, 1)
+			assert.Equal(t, "pool/data", fss.Filesystems[0].Path)
+
+			vs, err := r.ListFilesystemVersions(ctx, &pdu.ListFilesystemVersionsReq{Filesystem: "pool/data"})
+			require.NoError(t, err)
+			require.Len(t, vs.Versions, 2)
+			assert.Equal(t, "sa", vs.Versions[0].Name)
+			assert.Equal(t, "sb", vs.Versions[1].Name)
+
+			m, err := LoadManifest(ctx, storage)
+			require.NoError(t, err)
+			streams := m.Filesystems["pool/data"].Streams
+			require.Len(t, streams, 2)
+			assert.Nil(t, streams[0].From)
+			require.NotNil(t, streams[1].From)
+			assert.Equal(t, uint64(1), streams[1].From.Guid)
+			assert.Equal(t, uint64(2), streams[1].To.Guid)
+
+			for i, s := range streams {
+				assert.Equal(t, c, s.Compression)
+				require.NoError(t, verifyObject(ctx, storage, s))
+				obj, err := storage.Get(ctx, s.Object)
+				require.NoError(t, err)
+				var data []byte
+				if c == CompressionGzip {
+					zr, err := gzip.NewReader(obj)
+					require.NoError(t, err)
+					data, err = ioutil.ReadAll(zr)
+					require.NoError(t, err)
+				} else {
+					data, err = ioutil.ReadAll(obj)
+					require.NoError(t, err)
+				}
+				obj.Close()
+				assert.Equal(t, payloads[i], data)
+			}
+
+			destroyRes, err := r.DestroySnapshots(ctx, &pdu.DestroySnapshotsReq{Filesystem: "pool/data", Snapshots: vs.Versions[:1]})
+			require.NoError(t, err)
+			require.Len(t, destroyRes.Results, 1)
+			assert.NotEmpty(t, destroyRes.Results[0].Error)
+		})
+	}
+}
+
+func TestReceiverRejectsStreamsThatDoNotExtendTheChain(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "zrepl-streamarchive-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	storage := &DirStorage{Path: dir}
+	r, err := NewReceiver(storage, CompressionNone)
+	require.NoError(t, err)
+
+	receive := func(to *pdu.FilesystemVersion, stream []byte) error {
+		req := &pdu.ReceiveReq{Filesystem: "pool/data", To: to}
+		_, err := r.Receive(ctx, req, ioutil.NopCloser(bytes.NewReader(stream)))
+		return err
+	}
+
+	assert.Error(t, receive(testVersion("sa", 1), []byte("no header")))
+	assert.Error(t, receive(testVersion("sa", 1), testStream(0, 2, "stream for another snapshot")))
+	assert.Error(t, receive(testVersion("sb", 2), testStream(1, 2, "incremental without chain")))
+	require.NoError(t, receive(testVersion("sa", 1), testStream(0, 1, "full")))
+	assert.Error(t, receive(testVersion("sc", 3), testStream(2, 3, "incremental from another base")))
+	assert.Error(t, receive(testVersion("sc", 3), testStream(0, 3, "full after chain")))
+	require.NoError(t, receive(testVersion("sb", 2), testStream(1, 2, "incremental")))
+
+	m, err := LoadManifest(ctx, storage)
+	require.NoError(t, err)
+	require.Len(t, m.Filesystems["pool/data"].Streams, 2)
+
+	// big-endian senders
+	be := testStream(2, 3, "big-endian incremental")
+	binary.BigEndian.PutUint32(be, streamHeaderRecordBegin)
+	binary.BigEndian.PutUint64(be[streamHeaderMagicOffset:], streamHeaderMagic)
+	binary.BigEndian.PutUint64(be[streamHeaderToGUIDOffset:], 3)
+	binary.BigEndian.PutUint64(be[streamHeaderFromGUIDOffset:], 2)
+	require.NoError(t, receive(testVersion("sc", 3), be))
+}
+
+func TestVerifyObjectDetectsCorruption(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "zrepl-streamarchive-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	storage := &DirStorage{Path: dir}
+
+	r, err := NewReceiver(storage, CompressionNone)
+	require.NoError(t, err)
+	_, err = r.Receive(ctx, &pdu.ReceiveReq{Filesystem: "pool/data", To: testVersion("a", 1)}, ioutil.NopCloser(bytes.NewReader(testStream(0, 1, "data"))))
+	require.NoError(t, err)
+
+	m, err := LoadManifest(ctx, storage)
+	require.NoError(t, err)
+	s := m.Filesystems["pool/data"].Streams[0]
+	require.NoError(t, storage.Put(ctx, s.Object, bytes.NewReader([]byte("dat4"))))
+	assert.Error(t, verifyObject(ctx, storage, s))
+}
+
+func TestImportPlan(t *testing.T) {
+	v := func(guid uint64) ManifestVersion { return ManifestVersion{Name: "s", Guid: guid} }
+	vp := func(guid uint64) *ManifestVersion { x := v(guid); return &x }
+	chain := &ManifestFilesystem{Streams: []*ManifestStream{
+		{Object: "0", To: v(1)},
+		{Object: "1", From: vp(1), To: v(2)},
+		{Object: "2", From: vp(2), To: v(3)},
+	}}
+	incomplete := &ManifestFilesystem{Streams: chain.Streams[1:]}
+
+	tcs := []struct {
+		name          string
+		mfs           *ManifestFilesystem
+		existing      []uint64
+		targetHasData bool
+		expect        []string // objects
+		expectErr     bool
+	}{
+		{name: "new target", mfs: chain, expect: []string{"0", "1", "2"}},
+		{name: "partially imported", mfs: chain, existing: []uint64{1}, targetHasData: true, expect: []string{"1", "2"}},
+		{name: "up to date", mfs: chain, existing: []uint64{1, 2, 3}, targetHasData: true, expect: []string{}},
+		{name: "unrelated data", mfs: chain, existing: []uint64{42}, targetHasData: true, expectErr: true},
+		{name: "incomplete chain", mfs: incomplete, expectErr: true},
+		{name: "incomplete chain partially imported", mfs: incomplete, existing: []uint64{2}, targetHasData: true, expect: []string{"2"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			existing := make(map[uint64]bool)
+			for _, g := range tc.existing {
+				existing[g] = true
+			}
+			streams, err := importPlan(tc.mfs, existing, tc.targetHasData)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			objects := []string{}
+			for _, s := range streams {
+				objects = append(objects, s.Object)
+			}
+			assert.Equal(t, tc.expect, objects)
+		})
+	}
+}
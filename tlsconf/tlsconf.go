@@ -1,6 +1,7 @@
 package tlsconf
 
 import (
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
@@ -9,6 +10,7 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -30,23 +32,52 @@ type ClientAuthListener struct {
 	handshakeTimeout time.Duration
 }
 
+// NewClientAuthListener returns a listener that authenticates clients using the certificates in certs.
+// Each handshake uses the certificates currently loaded in certs, i.e., reloading certs does not require a new listener.
+//
+// If sessionTickets is true, clients can resume TLS sessions using session tickets.
+// Session tickets issued before certs was reloaded are not accepted afterwards,
+// so that clients whose certificates are no longer trusted cannot resume their sessions.
 func NewClientAuthListener(
-	l *net.TCPListener, ca *x509.CertPool, serverCert tls.Certificate,
-	handshakeTimeout time.Duration) *ClientAuthListener {
+	l *net.TCPListener, certs *ReloadableCertificates,
+	handshakeTimeout time.Duration, sessionTickets bool) *ClientAuthListener {
 
-	if ca == nil {
-		panic(ca)
-	}
-	if serverCert.Certificate == nil || serverCert.PrivateKey == nil {
-		panic(serverCert)
+	if certs == nil {
+		panic(certs)
 	}
 
-	tlsConf := &tls.Config{
-		Certificates:             []tls.Certificate{serverCert},
-		ClientCAs:                ca,
-		ClientAuth:               tls.RequireAndVerifyClientCert,
-		PreferServerCipherSuites: true,
-		KeyLogWriter:             keylogFromEnv(),
+	var (
+		keyLog     = keylogFromEnv()
+		tlsConf    = &tls.Config{SessionTicketsDisabled: !sessionTickets}
+		ticketsMtx sync.Mutex
+		ticketsGen uint64
+	)
+	_, _, ticketsGen = certs.current()
+	tlsConf.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		ca, serverCert, gen := certs.current()
+		if sessionTickets {
+			ticketsMtx.Lock()
+			if gen != ticketsGen {
+				var key [32]byte
+				if _, err := rand.Read(key[:]); err != nil {
+					ticketsMtx.Unlock()
+					return nil, err
+				}
+				// the config returned below uses the ticket keys of tlsConf
+				tlsConf.SetSessionTicketKeys([][32]byte{key})
+				ticketsGen = gen
+			}
+			ticketsMtx.Unlock()
+		}
+		return &tls.Config{
+			Certificates:             []tls.Certificate{serverCert},
+			ClientCAs:                ca,
+			ClientAuth:               tls.RequireAndVerifyClientCert,
+			PreferServerCipherSuites: true,
+			KeyLogWriter:             keyLog,
+			SessionTicketsDisabled:   !sessionTickets,
+			VerifyConnection:         certs.verifyConnection,
+		}, nil
 	}
 	return &ClientAuthListener{
 		l,
@@ -124,6 +155,49 @@ func ClientAuthClient(serverName string, rootCA *x509.CertPool, clientCert tls.C
 	return tlsConfig, nil
 }
 
+// The client session cache is keyed by server name,
+// and the configs returned by ReloadableClientAuthClient share a single server name.
+const clientSessionCacheSize = 4
+
+// ReloadableClientAuthClient returns a function that returns a client config
+// with the certificates currently loaded in certs.
+//
+// If sessionResumption is true, the returned configs share a TLS session cache
+// that allows resuming sessions with the server.
+// The cache is cleared whenever certs is reloaded.
+func ReloadableClientAuthClient(serverName string, certs *ReloadableCertificates, sessionResumption bool) func() *tls.Config {
+	if serverName == "" {
+		panic(serverName)
+	}
+	if certs == nil {
+		panic(certs)
+	}
+	var (
+		keyLog   = keylogFromEnv()
+		mtx      sync.Mutex
+		cache    tls.ClientSessionCache
+		cacheGen uint64
+	)
+	return func() *tls.Config {
+		ca, clientCert, gen := certs.current()
+		mtx.Lock()
+		if sessionResumption && (cache == nil || gen != cacheGen) {
+			cache = tls.NewLRUClientSessionCache(clientSessionCacheSize)
+			cacheGen = gen
+		}
+		sessionCache := cache
+		mtx.Unlock()
+		return &tls.Config{
+			Certificates:       []tls.Certificate{clientCert},
+			RootCAs:            ca,
+			ServerName:         serverName,
+			KeyLogWriter:       keyLog,
+			ClientSessionCache: sessionCache,
+			VerifyConnection:   certs.verifyConnection,
+		}
+	}
+}
+
 func keylogFromEnv() io.Writer {
 	var keyLog io.Writer = nil
 	if outfile := os.Getenv("ZREPL_KEYLOG_FILE"); outfile != "" {
@@ -0,0 +1,104 @@
+package tlsconf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type CertificateFiles struct {
+	CA, Cert, Key string
+	// optional, certificate revocation lists that are checked for the peer's certificate chain
+	CRL string
+}
+
+// ReloadableCertificates holds a CA pool, a certificate / key pair and optional CRLs
+// that are loaded from files and can be reloaded from these files at runtime,
+// e.g., to pick up certificates that were renewed by an internal CA.
+//
+// All ReloadableCertificates created by LoadReloadableCertificates are reloaded by ReloadAll.
+type ReloadableCertificates struct {
+	files CertificateFiles
+	pins  Pins
+
+	mtx  sync.RWMutex
+	ca   *x509.CertPool
+	cert tls.Certificate
+	crls []revocationList
+	gen  uint64 // incremented by each successful Reload
+}
+
+var reloadables struct {
+	mtx sync.Mutex
+	all []*ReloadableCertificates
+}
+
+// LoadReloadableCertificates loads the certificates from files.
+// Connections whose peer certificate does not match pins (if any) are rejected.
+func LoadReloadableCertificates(files CertificateFiles, pins Pins) (*ReloadableCertificates, error) {
+	c := &ReloadableCertificates{files: files, pins: pins}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	reloadables.mtx.Lock()
+	defer reloadables.mtx.Unlock()
+	reloadables.all = append(reloadables.all, c)
+	return c, nil
+}
+
+// Reload re-reads the files.
+// If an error occurs, the previously loaded certificates remain in use.
+func (c *ReloadableCertificates) Reload() error {
+	f := c.files
+	ca, err := ParseCAFile(f.CA)
+	if err != nil {
+		return errors.Wrapf(err, "cannot parse ca file %q", f.CA)
+	}
+	cert, err := tls.LoadX509KeyPair(f.Cert, f.Key)
+	if err != nil {
+		return errors.Wrapf(err, "cannot parse cert/key pair %q / %q", f.Cert, f.Key)
+	}
+	var crls []revocationList
+	if f.CRL != "" {
+		if crls, err = parseCRLFile(f.CRL, f.CA); err != nil {
+			return errors.Wrapf(err, "cannot parse crl file %q", f.CRL)
+		}
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.ca, c.cert, c.crls = ca, cert, crls
+	c.gen++
+	return nil
+}
+
+func (c *ReloadableCertificates) current() (ca *x509.CertPool, cert tls.Certificate, gen uint64) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.ca, c.cert, c.gen
+}
+
+// ReloadAll reloads all ReloadableCertificates created by LoadReloadableCertificates.
+// It returns the number of reloaded ReloadableCertificates and an error
+// describing the ReloadableCertificates that could not be reloaded.
+func ReloadAll() (reloaded int, err error) {
+	reloadables.mtx.Lock()
+	all := append([]*ReloadableCertificates(nil), reloadables.all...)
+	reloadables.mtx.Unlock()
+
+	var msgs []string
+	for _, c := range all {
+		if err := c.Reload(); err != nil {
+			msgs = append(msgs, err.Error())
+			continue
+		}
+		reloaded++
+	}
+	if len(msgs) > 0 {
+		return reloaded, fmt.Errorf("cannot reload %d certificate(s): %s", len(msgs), strings.Join(msgs, "; "))
+	}
+	return reloaded, nil
+}
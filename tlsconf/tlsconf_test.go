@@ -0,0 +1,293 @@
+package tlsconf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert, key, der}
+}
+
+// writes the CA certificate and a certificate / key pair for cn signed by the CA to dir
+func (ca *testCA) writeFiles(t *testing.T, dir, cn string) CertificateFiles {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	write := func(name, typ string, der []byte) string {
+		p := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600))
+		return p
+	}
+	return CertificateFiles{
+		CA:   write("ca.crt", "CERTIFICATE", ca.der),
+		Cert: write(cn+".crt", "CERTIFICATE", der),
+		Key:  write(cn+".key", "EC PRIVATE KEY", keyDER),
+	}
+}
+
+// writes a CRL that revokes the certificate in certFile to dir
+func (ca *testCA) writeCRL(t *testing.T, dir string, nextUpdate time.Time, certFile string) string {
+	var revoked []x509.RevocationListEntry
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, strings.TrimSuffix(certFile, ".crt")+".key")
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		revoked = append(revoked, x509.RevocationListEntry{SerialNumber: leaf.SerialNumber, RevocationTime: time.Now()})
+	}
+	tmpl := &x509.RevocationList{
+		Number:                    big.NewInt(time.Now().UnixNano()),
+		ThisUpdate:                time.Now().Add(-2 * time.Hour),
+		NextUpdate:                nextUpdate,
+		RevokedCertificateEntries: revoked,
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, tmpl, ca.cert, ca.key)
+	require.NoError(t, err)
+	p := filepath.Join(dir, "ca.crl")
+	require.NoError(t, ioutil.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0600))
+	return p
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "zrepl-tlsconf-")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+type testConnectResult struct {
+	cn        string
+	didResume bool
+}
+
+// returns a function that establishes a connection between a server and a client
+// that use the given certificates and reports the client CN seen by the server,
+// or the error that the client or server encountered as the CN
+func newTestConnect(t *testing.T, serverCerts, clientCerts *ReloadableCertificates) func() testConnectResult {
+	tcpL, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	l := NewClientAuthListener(tcpL, serverCerts, 10*time.Second, true)
+	t.Cleanup(func() { l.Close() })
+
+	clientConfig := ReloadableClientAuthClient("server", clientCerts, true)
+
+	return func() testConnectResult {
+		accepted := make(chan string, 1)
+		go func() {
+			_, tlsConn, cn, err := l.Accept()
+			if err != nil {
+				accepted <- "server error"
+				return
+			}
+			defer tlsConn.Close()
+			// the client reads this byte, which makes it process the session tickets that follow the handshake
+			_, _ = tlsConn.Write([]byte{1})
+			accepted <- cn
+		}()
+		conn, err := tls.Dial("tcp", tcpL.Addr().String(), clientConfig())
+		if err != nil {
+			<-accepted
+			return testConnectResult{"client error", false}
+		}
+		defer conn.Close()
+		_, err = conn.Read(make([]byte, 1))
+		cn := <-accepted
+		if err != nil && cn != "server error" {
+			return testConnectResult{"client error", false}
+		}
+		return testConnectResult{cn, conn.ConnectionState().DidResume}
+	}
+}
+
+func TestReloadAndSessionResumption(t *testing.T) {
+	ca := newTestCA(t)
+	serverDir, clientDir := tempDir(t), tempDir(t)
+
+	serverCerts, err := LoadReloadableCertificates(ca.writeFiles(t, serverDir, "server"), Pins{})
+	require.NoError(t, err)
+	clientCerts, err := LoadReloadableCertificates(ca.writeFiles(t, clientDir, "client"), Pins{})
+	require.NoError(t, err)
+
+	connect := newTestConnect(t, serverCerts, clientCerts)
+
+	assert.Equal(t, testConnectResult{"client", false}, connect())
+	assert.Equal(t, testConnectResult{"client", true}, connect())
+
+	// reloading the client certificate clears the client's session cache
+	ca.writeFiles(t, clientDir, "client2")
+	clientCerts.files.Cert = filepath.Join(clientDir, "client2.crt")
+	clientCerts.files.Key = filepath.Join(clientDir, "client2.key")
+	require.NoError(t, clientCerts.Reload())
+	assert.Equal(t, testConnectResult{"client2", false}, connect())
+	assert.Equal(t, testConnectResult{"client2", true}, connect())
+
+	// reloading the server certificate invalidates the session tickets issued before
+	require.NoError(t, serverCerts.Reload())
+	assert.Equal(t, testConnectResult{"client2", false}, connect())
+	assert.Equal(t, testConnectResult{"client2", true}, connect())
+}
+
+func TestReloadKeepsCertificatesOnError(t *testing.T) {
+	ca := newTestCA(t)
+	dir := tempDir(t)
+	files := ca.writeFiles(t, dir, "client")
+	c, err := LoadReloadableCertificates(files, Pins{})
+	require.NoError(t, err)
+	_, before, gen := c.current()
+
+	require.NoError(t, ioutil.WriteFile(files.Cert, []byte("garbage"), 0600))
+	assert.Error(t, c.Reload())
+
+	_, after, genAfter := c.current()
+	assert.Equal(t, before.Certificate, after.Certificate)
+	assert.Equal(t, gen, genAfter)
+}
+
+func TestPins(t *testing.T) {
+	ca := newTestCA(t)
+	serverDir, clientDir := tempDir(t), tempDir(t)
+	serverFiles, clientFiles := ca.writeFiles(t, serverDir, "server"), ca.writeFiles(t, clientDir, "client")
+
+	leaf := func(f CertificateFiles) *x509.Certificate {
+		cert, err := tls.LoadX509KeyPair(f.Cert, f.Key)
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return leaf
+	}
+	serverCertPin := sha256.Sum256(leaf(serverFiles).Raw)
+	clientSPKIPin := sha256.Sum256(leaf(clientFiles).RawSubjectPublicKeyInfo)
+	otherPin := sha256.Sum256([]byte("other"))
+
+	tcs := []struct {
+		name                   string
+		serverPins, clientPins Pins
+		expect                 string
+	}{
+		{"matching pins", Pins{SPKISHA256: [][32]byte{clientSPKIPin}}, Pins{CertSHA256: [][32]byte{otherPin, serverCertPin}}, "client"},
+		{"client rejects server", Pins{}, Pins{CertSHA256: [][32]byte{otherPin}}, "client error"},
+		{"server rejects client", Pins{CertSHA256: [][32]byte{otherPin}}, Pins{}, "server error"},
+		{"spki pin does not match cert", Pins{}, Pins{SPKISHA256: [][32]byte{serverCertPin}}, "client error"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			serverCerts, err := LoadReloadableCertificates(serverFiles, tc.serverPins)
+			require.NoError(t, err)
+			clientCerts, err := LoadReloadableCertificates(clientFiles, tc.clientPins)
+			require.NoError(t, err)
+			connect := newTestConnect(t, serverCerts, clientCerts)
+			res := connect()
+			assert.Equal(t, tc.expect, res.cn)
+			if res.cn == "client" {
+				assert.Equal(t, testConnectResult{"client", true}, connect(), "pins are checked for resumed sessions")
+			}
+		})
+	}
+}
+
+func TestCRL(t *testing.T) {
+	ca := newTestCA(t)
+	serverDir, clientDir := tempDir(t), tempDir(t)
+	serverFiles, clientFiles := ca.writeFiles(t, serverDir, "server"), ca.writeFiles(t, clientDir, "client")
+
+	serverFiles.CRL = ca.writeCRL(t, serverDir, time.Now().Add(time.Hour), "")
+	serverCerts, err := LoadReloadableCertificates(serverFiles, Pins{})
+	require.NoError(t, err)
+	clientCerts, err := LoadReloadableCertificates(clientFiles, Pins{})
+	require.NoError(t, err)
+	connect := newTestConnect(t, serverCerts, clientCerts)
+	assert.Equal(t, testConnectResult{"client", false}, connect())
+	assert.Equal(t, testConnectResult{"client", true}, connect())
+
+	// revoke the client certificate
+	ca.writeCRL(t, serverDir, time.Now().Add(time.Hour), clientFiles.Cert)
+	require.NoError(t, serverCerts.Reload())
+	assert.Equal(t, "server error", connect().cn)
+
+	// expired CRL
+	ca.writeCRL(t, serverDir, time.Now().Add(-time.Hour), "")
+	require.NoError(t, serverCerts.Reload())
+	assert.Equal(t, "server error", connect().cn)
+
+	// CRL signed by an unknown CA
+	newTestCA(t).writeCRL(t, serverDir, time.Now().Add(time.Hour), "")
+	assert.Error(t, serverCerts.Reload())
+}
+
+func TestParsePin(t *testing.T) {
+	want := sha256.Sum256([]byte("foo"))
+	hexPin := strings.ToUpper(hex.EncodeToString(want[:]))
+	var colonPin []string
+	for i := 0; i < len(hexPin); i += 2 {
+		colonPin = append(colonPin, hexPin[i:i+2])
+	}
+	for _, s := range []string{
+		hex.EncodeToString(want[:]),
+		strings.Join(colonPin, ":"),
+		base64.StdEncoding.EncodeToString(want[:]),
+	} {
+		pin, err := ParsePin(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, pin, s)
+	}
+	for _, s := range []string{"", "abcd", base64.StdEncoding.EncodeToString([]byte("too short"))} {
+		_, err := ParsePin(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,186 @@
+package tlsconf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Pins restrict the peer certificates that are accepted in addition to the verification against the CA.
+// If any pins are specified, the peer's leaf certificate must match at least one of them.
+type Pins struct {
+	// SHA-256 hashes of the DER-encoded peer certificate
+	CertSHA256 [][sha256.Size]byte
+	// SHA-256 hashes of the DER-encoded SubjectPublicKeyInfo of the peer certificate
+	SPKISHA256 [][sha256.Size]byte
+}
+
+func (p Pins) empty() bool { return len(p.CertSHA256) == 0 && len(p.SPKISHA256) == 0 }
+
+func (p Pins) match(leaf *x509.Certificate) bool {
+	certHash, spkiHash := sha256.Sum256(leaf.Raw), sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	for _, h := range p.CertSHA256 {
+		if h == certHash {
+			return true
+		}
+	}
+	for _, h := range p.SPKISHA256 {
+		if h == spkiHash {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePin parses a SHA-256 hash that is encoded either in hex, optionally separated by colons
+// (as printed by openssl x509 -fingerprint -sha256), or in base64 (as used by HPKP and curl --pinnedpubkey).
+func ParsePin(s string) (pin [sha256.Size]byte, err error) {
+	if h, err := hex.DecodeString(strings.Replace(s, ":", "", -1)); err == nil && len(h) == sha256.Size {
+		copy(pin[:], h)
+		return pin, nil
+	}
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) == sha256.Size {
+		copy(pin[:], b)
+		return pin, nil
+	}
+	return pin, fmt.Errorf("pin %q is not a hex- or base64-encoded SHA-256 hash", s)
+}
+
+// ParsePins parses the pins of certificates and SPKIs using ParsePin.
+func ParsePins(certSHA256, spkiSHA256 []string) (pins Pins, err error) {
+	for _, s := range certSHA256 {
+		pin, err := ParsePin(s)
+		if err != nil {
+			return Pins{}, err
+		}
+		pins.CertSHA256 = append(pins.CertSHA256, pin)
+	}
+	for _, s := range spkiSHA256 {
+		pin, err := ParsePin(s)
+		if err != nil {
+			return Pins{}, err
+		}
+		pins.SPKISHA256 = append(pins.SPKISHA256, pin)
+	}
+	return pins, nil
+}
+
+type revocationList struct {
+	rawIssuer  []byte
+	nextUpdate time.Time
+	revoked    map[string]struct{} // by serial number
+}
+
+// parseCRLFile parses the PEM- or DER-encoded certificate revocation lists in crlFile.
+// Each CRL must be signed by one of the CA certificates in caFile.
+func parseCRLFile(crlFile, caFile string) ([]revocationList, error) {
+	data, err := ioutil.ReadFile(crlFile)
+	if err != nil {
+		return nil, err
+	}
+	var ders [][]byte
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "X509 CRL" {
+			ders = append(ders, block.Bytes)
+		}
+	}
+	if len(ders) == 0 {
+		ders = [][]byte{data}
+	}
+
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	var cas []*x509.Certificate
+	for rest := caPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		ca, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot parse ca certificate")
+		}
+		cas = append(cas, ca)
+	}
+
+	crls := make([]revocationList, 0, len(ders))
+	for i, der := range ders {
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot parse CRL #%d", i)
+		}
+		signed := false
+		for _, ca := range cas {
+			if bytes.Equal(ca.RawSubject, crl.RawIssuer) && crl.CheckSignatureFrom(ca) == nil {
+				signed = true
+				break
+			}
+		}
+		if !signed {
+			return nil, errors.Errorf("CRL #%d of %q is not signed by a certificate in the ca file", i, crl.Issuer)
+		}
+		l := revocationList{
+			rawIssuer:  crl.RawIssuer,
+			nextUpdate: crl.NextUpdate,
+			revoked:    make(map[string]struct{}, len(crl.RevokedCertificateEntries)),
+		}
+		for _, e := range crl.RevokedCertificateEntries {
+			l.revoked[e.SerialNumber.String()] = struct{}{}
+		}
+		crls = append(crls, l)
+	}
+	return crls, nil
+}
+
+func checkRevocation(crls []revocationList, certs []*x509.Certificate, now time.Time) error {
+	for _, cert := range certs {
+		for _, crl := range crls {
+			if !bytes.Equal(crl.rawIssuer, cert.RawIssuer) {
+				continue
+			}
+			if !crl.nextUpdate.IsZero() && now.After(crl.nextUpdate) {
+				return errors.Errorf("CRL of %q expired at %s", cert.Issuer, crl.nextUpdate)
+			}
+			if _, ok := crl.revoked[cert.SerialNumber.String()]; ok {
+				return errors.Errorf("certificate %q (serial %s) has been revoked", cert.Subject, cert.SerialNumber)
+			}
+		}
+	}
+	return nil
+}
+
+// verifyConnection is used as tls.Config.VerifyConnection, i.e.,
+// it runs after the peer certificate chain has been verified, including for resumed sessions.
+func (c *ReloadableCertificates) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("peer did not present a certificate")
+	}
+	if !c.pins.empty() && !c.pins.match(cs.PeerCertificates[0]) {
+		return errors.Errorf("peer certificate %q does not match any pin", cs.PeerCertificates[0].Subject)
+	}
+	c.mtx.RLock()
+	crls := c.crls
+	c.mtx.RUnlock()
+	return checkRevocation(crls, cs.PeerCertificates, time.Now())
+}
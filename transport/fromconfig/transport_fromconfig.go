@@ -4,15 +4,20 @@ package fromconfig
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/rpc/dataconn/stream"
+	"github.com/zrepl/zrepl/rpc/streammux"
 	"github.com/zrepl/zrepl/transport"
 	"github.com/zrepl/zrepl/transport/local"
 	"github.com/zrepl/zrepl/transport/ssh"
 	"github.com/zrepl/zrepl/transport/tcp"
 	"github.com/zrepl/zrepl/transport/tls"
+	"github.com/zrepl/zrepl/transport/unix"
+	"github.com/zrepl/zrepl/util/envconst"
 )
 
 func ListenerFactoryFromConfig(g *config.Global, in config.ServeEnum) (transport.AuthenticatedListenerFactory, error) {
@@ -30,6 +35,8 @@ func ListenerFactoryFromConfig(g *config.Global, in config.ServeEnum) (transport
 		l, err = ssh.MultiStdinserverListenerFactoryFromConfig(g, v)
 	case *config.LocalServe:
 		l, err = local.LocalListenerFactoryFromConfig(g, v)
+	case *config.UnixServe:
+		l, err = unix.UnixListenerFactoryFromConfig(g, v)
 	default:
 		return nil, errors.Errorf("internal error: unknown serve type %T", v)
 	}
@@ -51,9 +58,114 @@ func ConnecterFromConfig(g *config.Global, in config.ConnectEnum) (transport.Con
 		connecter, err = tls.TLSConnecterFromConfig(v)
 	case *config.LocalConnect:
 		connecter, err = local.LocalConnecterFromConfig(v)
+	case *config.UnixConnect:
+		connecter, err = unix.UnixConnecterFromConfig(v)
+	case *config.ExportConnect:
+		return nil, errors.Errorf("connect type %q does not use a transport", v.Type)
+	case *config.S3Connect:
+		return nil, errors.Errorf("connect type %q does not use a transport", v.Type)
 	default:
 		panic(fmt.Sprintf("implementation error: unknown connecter type %T", v))
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	if in.Ret.(multiplexConfig).GetMultiplex() {
+		connecter = streammux.Connecter(connecter, envconst.Duration("ZREPL_TRANSPORT_STREAMMUX_TIMEOUT", 10*time.Second))
+	}
+	return connecter, nil
+}
+
+type multiplexConfig interface {
+	GetMultiplex() bool
+}
+
+// Returns the configured type of the listener, e.g. `tls`, for use in metric labels.
+func ServeTypeName(in config.ServeEnum) string {
+	switch v := in.Ret.(type) {
+	case *config.TCPServe:
+		return v.Type
+	case *config.TLSServe:
+		return v.Type
+	case *config.StdinserverServer:
+		return v.Type
+	case *config.LocalServe:
+		return v.Type
+	case *config.UnixServe:
+		return v.Type
+	default:
+		panic(fmt.Sprintf("implementation error: unknown serve type %T", v))
+	}
+}
+
+type chunkSizeConfig interface {
+	GetChunkSize() *config.StreamChunkSize
+}
+
+// Returns the chunk size limits configured for the listener or connecter in.Ret,
+// which must be the Ret of a config.ServeEnum or config.ConnectEnum.
+func ChunkSizeLimitsFromConfig(in interface{}) (stream.ChunkSizeLimits, error) {
+	l := stream.DefaultChunkSizeLimits()
+	c, ok := in.(chunkSizeConfig)
+	if !ok {
+		panic(fmt.Sprintf("implementation error: %T has no chunk size config", in))
+	}
+	if cs := c.GetChunkSize(); cs != nil {
+		if cs.Min != 0 {
+			l.Min = uint(cs.Min)
+		}
+		if cs.Max != 0 {
+			l.Max = uint(cs.Max)
+		}
+	}
+	if err := l.Validate(); err != nil {
+		return l, errors.Wrap(err, "field `chunk_size`")
+	}
+	return l, nil
+}
+
+// Returns the configured type of the connecter, e.g. `tls`, for use in metric labels.
+func ConnectTypeName(in config.ConnectEnum) string {
+	switch v := in.Ret.(type) {
+	case *config.SSHStdinserverConnect:
+		return v.Type
+	case *config.TCPConnect:
+		return v.Type
+	case *config.TLSConnect:
+		return v.Type
+	case *config.LocalConnect:
+		return v.Type
+	case *config.UnixConnect:
+		return v.Type
+	case *config.ExportConnect:
+		return v.Type
+	case *config.S3Connect:
+		return v.Type
+	default:
+		panic(fmt.Sprintf("implementation error: unknown connecter type %T", v))
+	}
+}
 
-	return connecter, err
+// Returns a human-readable description of the configured peer of the connecter,
+// e.g. the address of a `tls` connecter.
+func ConnectPeerName(in config.ConnectEnum) string {
+	switch v := in.Ret.(type) {
+	case *config.SSHStdinserverConnect:
+		return fmt.Sprintf("%s@%s:%d", v.User, v.Host, v.Port)
+	case *config.TCPConnect:
+		return v.Address
+	case *config.TLSConnect:
+		return v.Address
+	case *config.LocalConnect:
+		return v.ListenerName
+	case *config.UnixConnect:
+		return v.Path
+	case *config.ExportConnect:
+		return v.Path
+	case *config.S3Connect:
+		return fmt.Sprintf("s3://%s/%s", v.Bucket, v.Prefix)
+	default:
+		panic(fmt.Sprintf("implementation error: unknown connecter type %T", v))
+	}
 }
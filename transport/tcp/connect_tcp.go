@@ -2,19 +2,19 @@ package tcp
 
 import (
 	"context"
-	"net"
 
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/util/tcpsock"
 )
 
 type TCPConnecter struct {
 	Address string
-	dialer  net.Dialer
+	dialer  tcpsock.Dialer
 }
 
 func TCPConnecterFromConfig(in *config.TCPConnect) (*TCPConnecter, error) {
-	dialer := net.Dialer{
+	dialer := tcpsock.Dialer{
 		Timeout: in.DialTimeout,
 	}
 
@@ -22,9 +22,5 @@ func TCPConnecterFromConfig(in *config.TCPConnect) (*TCPConnecter, error) {
 }
 
 func (c *TCPConnecter) Connect(dialCtx context.Context) (transport.Wire, error) {
-	conn, err := c.dialer.DialContext(dialCtx, "tcp", c.Address)
-	if err != nil {
-		return nil, err
-	}
-	return conn.(*net.TCPConn), nil
+	return c.dialer.DialContext(dialCtx, c.Address)
 }
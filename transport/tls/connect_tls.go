@@ -3,23 +3,21 @@ package tls
 import (
 	"context"
 	"crypto/tls"
-	"net"
-
-	"github.com/pkg/errors"
 
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/tlsconf"
 	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/util/tcpsock"
 )
 
 type TLSConnecter struct {
 	Address   string
-	dialer    net.Dialer
-	tlsConfig *tls.Config
+	dialer    tcpsock.Dialer
+	tlsConfig func() *tls.Config
 }
 
 func TLSConnecterFromConfig(in *config.TLSConnect) (*TLSConnecter, error) {
-	dialer := net.Dialer{
+	dialer := tcpsock.Dialer{
 		Timeout: in.DialTimeout,
 	}
 
@@ -27,30 +25,20 @@ func TLSConnecterFromConfig(in *config.TLSConnect) (*TLSConnecter, error) {
 		return &TLSConnecter{in.Address, dialer, nil}, nil
 	}
 
-	ca, err := tlsconf.ParseCAFile(in.Ca)
-	if err != nil {
-		return nil, errors.Wrap(err, "cannot parse ca file")
-	}
-
-	cert, err := tls.LoadX509KeyPair(in.Cert, in.Key)
+	certs, err := loadCertificates(in.Ca, in.Cert, in.Key, in.TLSPeerVerification)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot parse cert/key pair")
-	}
-
-	tlsConfig, err := tlsconf.ClientAuthClient(in.ServerCN, ca, cert)
-	if err != nil {
-		return nil, errors.Wrap(err, "cannot build tls config")
+		return nil, err
 	}
+	tlsConfig := tlsconf.ReloadableClientAuthClient(in.ServerCN, certs, in.SessionResumption)
 
 	return &TLSConnecter{in.Address, dialer, tlsConfig}, nil
 }
 
 func (c *TLSConnecter) Connect(dialCtx context.Context) (transport.Wire, error) {
-	conn, err := c.dialer.DialContext(dialCtx, "tcp", c.Address)
+	tcpConn, err := c.dialer.DialContext(dialCtx, c.Address)
 	if err != nil {
 		return nil, err
 	}
-	tcpConn := conn.(*net.TCPConn)
-	tlsConn := tls.Client(conn, c.tlsConfig)
+	tlsConn := tls.Client(tcpConn, c.tlsConfig())
 	return newWireAdaptor(tlsConn, tcpConn), nil
 }
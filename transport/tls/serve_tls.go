@@ -2,7 +2,6 @@ package tls
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"time"
 
@@ -29,14 +28,9 @@ func TLSListenerFactoryFromConfig(c *config.Global, in *config.TLSServe) (transp
 		return func() (transport.AuthenticatedListener, error) { return nil, nil }, nil
 	}
 
-	clientCA, err := tlsconf.ParseCAFile(in.Ca)
+	certs, err := loadCertificates(in.Ca, in.Cert, in.Key, in.TLSPeerVerification)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot parse ca file")
-	}
-
-	serverCert, err := tls.LoadX509KeyPair(in.Cert, in.Key)
-	if err != nil {
-		return nil, errors.Wrap(err, "cannot parse cert/key pair")
+		return nil, err
 	}
 
 	clientCNs := make(map[string]struct{}, len(in.ClientCNs))
@@ -53,7 +47,7 @@ func TLSListenerFactoryFromConfig(c *config.Global, in *config.TLSServe) (transp
 		if err != nil {
 			return nil, err
 		}
-		tl := tlsconf.NewClientAuthListener(l, clientCA, serverCert, handshakeTimeout)
+		tl := tlsconf.NewClientAuthListener(l, certs, handshakeTimeout, in.SessionResumption)
 		return &tlsAuthListener{tl, clientCNs}, nil
 	}
 
@@ -0,0 +1,17 @@
+package tls
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/tlsconf"
+)
+
+func loadCertificates(ca, cert, key string, v config.TLSPeerVerification) (*tlsconf.ReloadableCertificates, error) {
+	pins, err := tlsconf.ParsePins(v.PinnedCertSHA256, v.PinnedSPKISHA256)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid pin")
+	}
+	files := tlsconf.CertificateFiles{CA: ca, Cert: cert, Key: key, CRL: v.CRL}
+	return tlsconf.LoadReloadableCertificates(files, pins)
+}
@@ -0,0 +1,116 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+)
+
+// MultiListenerFactory returns a factory for a listener that accepts the connections of the listeners of all factories,
+// e.g., to serve clients that use different transports from a single job.
+func MultiListenerFactory(factories []AuthenticatedListenerFactory) AuthenticatedListenerFactory {
+	if len(factories) == 1 {
+		return factories[0]
+	}
+	return func() (AuthenticatedListener, error) {
+		listeners := make([]AuthenticatedListener, 0, len(factories))
+		for _, f := range factories {
+			l, err := f()
+			if err != nil {
+				for _, l := range listeners {
+					l.Close()
+				}
+				return nil, err
+			}
+			listeners = append(listeners, l)
+		}
+		return newMultiListener(listeners), nil
+	}
+}
+
+type multiAcceptResult struct {
+	conn *AuthConn
+	err  error
+}
+
+type multiListener struct {
+	listeners []AuthenticatedListener
+	startOnce sync.Once
+	accepted  chan multiAcceptResult
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newMultiListener(listeners []AuthenticatedListener) *multiListener {
+	return &multiListener{
+		listeners: listeners,
+		accepted:  make(chan multiAcceptResult),
+		closed:    make(chan struct{}),
+	}
+}
+
+var errMultiListenerClosed = errors.New("listener closed")
+
+// The accept loops of the listeners are started by the first call to Accept and use its context.
+func (m *multiListener) Accept(ctx context.Context) (*AuthConn, error) {
+	m.startOnce.Do(func() {
+		for _, l := range m.listeners {
+			go m.acceptLoop(ctx, l)
+		}
+	})
+	select {
+	case res := <-m.accepted:
+		return res.conn, res.err
+	case <-m.closed:
+		return nil, errMultiListenerClosed
+	}
+}
+
+func (m *multiListener) acceptLoop(ctx context.Context, l AuthenticatedListener) {
+	for {
+		conn, err := l.Accept(ctx)
+		select {
+		case m.accepted <- multiAcceptResult{conn, err}:
+		case <-m.closed:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+	}
+}
+
+func (m *multiListener) Addr() net.Addr {
+	addrs := make(multiAddr, len(m.listeners))
+	for i, l := range m.listeners {
+		addrs[i] = l.Addr()
+	}
+	return addrs
+}
+
+func (m *multiListener) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.closed)
+		for _, l := range m.listeners {
+			if closeErr := l.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
+
+type multiAddr []net.Addr
+
+func (a multiAddr) Network() string { return "multi" }
+
+func (a multiAddr) String() string {
+	s := make([]string, len(a))
+	for i, addr := range a {
+		s[i] = addr.Network() + "://" + addr.String()
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeListener struct {
+	name   string
+	conns  chan *AuthConn
+	closed chan struct{}
+}
+
+func newFakeListener(name string) *fakeListener {
+	return &fakeListener{name, make(chan *AuthConn), make(chan struct{})}
+}
+
+func (l *fakeListener) Addr() net.Addr { return &net.UnixAddr{Name: l.name, Net: "unix"} }
+
+func (l *fakeListener) Accept(ctx context.Context) (*AuthConn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, errors.New("closed")
+	}
+}
+
+func (l *fakeListener) Close() error {
+	close(l.closed)
+	return nil
+}
+
+func TestMultiListener(t *testing.T) {
+	a, b := newFakeListener("a"), newFakeListener("b")
+	factory := func(l AuthenticatedListener) AuthenticatedListenerFactory {
+		return func() (AuthenticatedListener, error) { return l, nil }
+	}
+	l, err := MultiListenerFactory([]AuthenticatedListenerFactory{factory(a), factory(b)})()
+	require.NoError(t, err)
+	assert.Equal(t, "unix://a,unix://b", l.Addr().String())
+
+	ctx := context.Background()
+	for _, tc := range []struct {
+		l     *fakeListener
+		ident string
+	}{{a, "client-a"}, {b, "client-b"}, {a, "client-c"}} {
+		go func(l *fakeListener, ident string) { l.conns <- NewAuthConn(nil, ident) }(tc.l, tc.ident)
+		conn, err := l.Accept(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, tc.ident, conn.ClientIdentity())
+	}
+
+	require.NoError(t, l.Close())
+	<-a.closed
+	<-b.closed
+	_, err = l.Accept(ctx)
+	assert.Error(t, err)
+}
+
+func TestMultiListenerFactoryError(t *testing.T) {
+	a := newFakeListener("a")
+	_, err := MultiListenerFactory([]AuthenticatedListenerFactory{
+		func() (AuthenticatedListener, error) { return a, nil },
+		func() (AuthenticatedListener, error) { return nil, errors.New("cannot listen") },
+	})()
+	assert.Error(t, err)
+	select {
+	case <-a.closed:
+	default:
+		t.Fatal("listeners created before the error must be closed")
+	}
+}
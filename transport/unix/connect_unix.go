@@ -0,0 +1,29 @@
+package unix
+
+import (
+	"context"
+	"net"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/transport"
+)
+
+type UnixConnecter struct {
+	Path   string
+	dialer net.Dialer
+}
+
+func UnixConnecterFromConfig(in *config.UnixConnect) (*UnixConnecter, error) {
+	dialer := net.Dialer{
+		Timeout: in.DialTimeout,
+	}
+	return &UnixConnecter{in.Path, dialer}, nil
+}
+
+func (c *UnixConnecter) Connect(dialCtx context.Context) (transport.Wire, error) {
+	conn, err := c.dialer.DialContext(dialCtx, "unix", c.Path)
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UnixConn), nil
+}
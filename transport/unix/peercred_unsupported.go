@@ -0,0 +1,12 @@
+// +build !linux
+
+package unix
+
+import (
+	"fmt"
+	"net"
+)
+
+func peerUID(c *net.UnixConn) (uint32, error) {
+	return 0, fmt.Errorf("peer credentials are not supported on this platform")
+}
@@ -0,0 +1,142 @@
+package unix
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/transport"
+)
+
+func UnixListenerFactoryFromConfig(g *config.Global, in *config.UnixServe) (transport.AuthenticatedListenerFactory, error) {
+	if in.Path == "" {
+		return nil, errors.New("field 'path' must be specified")
+	}
+	mode, err := strconv.ParseUint(in.Mode, 8, 32)
+	if err != nil || mode&^0777 != 0 {
+		return nil, errors.Errorf("field 'mode' must be octal permission bits, got %q", in.Mode)
+	}
+	gid := -1
+	if in.Group != "" {
+		if gid, err = lookupID(in.Group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "cannot resolve group %q", in.Group)
+		}
+	}
+	clients, err := clientMapFromConfig(in.Clients)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse client map")
+	}
+
+	lf := func() (transport.AuthenticatedListener, error) {
+		if err := removeStaleSocket(in.Path); err != nil {
+			return nil, err
+		}
+		l, err := net.ListenUnix("unix", &net.UnixAddr{Name: in.Path, Net: "unix"})
+		if err != nil {
+			return nil, err
+		}
+		// Connections that are accepted before the permissions are set are still authenticated by their peer credentials.
+		if err := os.Chmod(in.Path, os.FileMode(mode)); err != nil {
+			l.Close()
+			return nil, errors.Wrap(err, "cannot set socket permissions")
+		}
+		if gid != -1 {
+			if err := os.Chown(in.Path, -1, gid); err != nil {
+				l.Close()
+				return nil, errors.Wrap(err, "cannot set socket group")
+			}
+		}
+		return &UnixAuthListener{l, clients}, nil
+	}
+	return lf, nil
+}
+
+// lookupID returns nameOrID if it is numeric, and the id that lookup returns for it otherwise.
+func lookupID(nameOrID string, lookup func(name string) (string, error)) (int, error) {
+	if id, err := strconv.ParseUint(nameOrID, 10, 32); err == nil {
+		return int(id), nil
+	}
+	idStr, err := lookup(nameOrID)
+	if err != nil {
+		return -1, err
+	}
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		return -1, errors.Errorf("non-numeric id %q", idStr)
+	}
+	return int(id), nil
+}
+
+func clientMapFromConfig(in map[string]string) (map[uint32]string, error) {
+	clients := make(map[uint32]string, len(in))
+	for userOrUID, ident := range in {
+		uid, err := lookupID(userOrUID, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot resolve user %q", userOrUID)
+		}
+		if err := transport.ValidateClientIdentity(ident); err != nil {
+			return nil, errors.Wrapf(err, "invalid client identity %q for user %q", ident, userOrUID)
+		}
+		if other, ok := clients[uint32(uid)]; ok {
+			return nil, errors.Errorf("uid %d is mapped to both %q and %q", uid, other, ident)
+		}
+		clients[uint32(uid)] = ident
+	}
+	return clients, nil
+}
+
+func removeStaleSocket(path string) error {
+	s, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.Mode()&os.ModeSocket == 0 {
+		return errors.Errorf("unexpected file type at path %q", path)
+	}
+	return errors.Wrapf(os.Remove(path), "cannot remove presumably stale socket %q", path)
+}
+
+type UnixAuthListener struct {
+	*net.UnixListener
+	clients map[uint32]string // by uid
+}
+
+func (l *UnixAuthListener) Accept(ctx context.Context) (*transport.AuthConn, error) {
+	nc, err := l.UnixListener.AcceptUnix()
+	if err != nil {
+		return nil, err
+	}
+	uid, err := peerUID(nc)
+	if err != nil {
+		nc.Close()
+		return nil, errors.Wrap(err, "cannot get peer credentials")
+	}
+	ident, ok := l.clients[uid]
+	if !ok {
+		transport.GetLogger(ctx).WithField("uid", uid).Error("peer uid not in client map")
+		nc.Close()
+		return nil, fmt.Errorf("unauthorized peer uid %d", uid)
+	}
+	return transport.NewAuthConn(nc, ident), nil
+}
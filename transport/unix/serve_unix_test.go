@@ -0,0 +1,77 @@
+// +build linux
+
+package unix
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func TestUnixTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-transport-unix-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sock")
+
+	uid := strconv.Itoa(os.Getuid())
+	otherUID := strconv.Itoa(os.Getuid() + 1)
+
+	ctx := context.Background()
+	tcs := []struct {
+		clients map[string]string
+		ident   string // empty if the connection must be rejected
+	}{
+		{map[string]string{uid: "myself"}, "myself"},
+		{map[string]string{otherUID: "someone-else"}, ""},
+	}
+	for _, tc := range tcs {
+		lf, err := UnixListenerFactoryFromConfig(nil, &config.UnixServe{Path: path, Mode: "0600", Clients: tc.clients})
+		require.NoError(t, err)
+		l, err := lf()
+		require.NoError(t, err)
+
+		fi, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+		cn, err := UnixConnecterFromConfig(&config.UnixConnect{Path: path, DialTimeout: time.Second})
+		require.NoError(t, err)
+		w, err := cn.Connect(ctx)
+		require.NoError(t, err)
+
+		conn, err := l.Accept(ctx)
+		if tc.ident == "" {
+			assert.Error(t, err)
+		} else {
+			require.NoError(t, err)
+			assert.Equal(t, tc.ident, conn.ClientIdentity())
+			conn.Close()
+		}
+		w.Close()
+		// the next listener replaces the socket
+		require.NoError(t, l.Close())
+	}
+}
+
+func TestUnixListenerFactoryFromConfigErrors(t *testing.T) {
+	for _, in := range []*config.UnixServe{
+		{Path: "/tmp/sock", Mode: "0x1ff", Clients: map[string]string{"0": "root"}},
+		{Path: "/tmp/sock", Mode: "1777", Clients: map[string]string{"0": "root"}},
+		{Path: "/tmp/sock", Mode: "0600", Clients: map[string]string{"0": "invalid/identity"}},
+		{Path: "/tmp/sock", Mode: "0600", Clients: map[string]string{"0": "a", "root": "b"}},
+		{Path: "/tmp/sock", Mode: "0600", Group: "zrepl-nonexistent-group"},
+	} {
+		_, err := UnixListenerFactoryFromConfig(nil, in)
+		assert.Error(t, err, "%#v", in)
+	}
+}
@@ -0,0 +1,123 @@
+// Package bandwidth limits the combined throughput of concurrent streams.
+//
+// The limit is shared among the streams that are open at a time
+// in proportion to their weights, i.e., a stream with weight 3 may use
+// three times the throughput of a concurrent stream with weight 1.
+// The share of each stream is re-evaluated on every read, so the remaining
+// streams take over the bandwidth of a stream that is closed.
+package bandwidth
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// The minimum number of bytes that a stream may read at once.
+// Larger than the allowance of slow streams so that they do not read byte by byte.
+const minBurst = 32 << 10
+
+// The time span whose worth of bytes a stream may read at once.
+const burstDuration = 100 * time.Millisecond
+
+type Limiter struct {
+	bytesPerSecond float64
+
+	mtx       sync.Mutex
+	weightSum int
+}
+
+// NewLimiter panics if bytesPerSecond is not positive.
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		panic("bytesPerSecond must be positive")
+	}
+	return &Limiter{bytesPerSecond: float64(bytesPerSecond)}
+}
+
+func (l *Limiter) register(weight int) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.weightSum += weight
+}
+
+func (l *Limiter) unregister(weight int) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.weightSum -= weight
+}
+
+// share returns the throughput of a stream with weight in bytes per second.
+func (l *Limiter) share(weight int) float64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.bytesPerSecond * float64(weight) / float64(l.weightSum)
+}
+
+type readCloser struct {
+	ctx    context.Context
+	l      *Limiter
+	rc     io.ReadCloser
+	weight int
+	closed bool
+
+	// bytes that may be read without waiting, negative if the stream is ahead of its share
+	allowance float64
+	last      time.Time
+}
+
+// ReadCloser returns a stream that reads from rc at no more than its share of the limit.
+// Weights smaller than 1 are treated as 1.
+// Waiting for the share is interrupted by the cancellation of ctx.
+// The returned stream must be closed to return its share to the other streams.
+func (l *Limiter) ReadCloser(ctx context.Context, rc io.ReadCloser, weight int) io.ReadCloser {
+	if weight < 1 {
+		weight = 1
+	}
+	l.register(weight)
+	return &readCloser{ctx: ctx, l: l, rc: rc, weight: weight, last: time.Now()}
+}
+
+func (r *readCloser) Read(b []byte) (int, error) {
+	rate := r.l.share(r.weight)
+	burst := rate * burstDuration.Seconds()
+	if burst < minBurst {
+		burst = minBurst
+	}
+
+	now := time.Now()
+	r.allowance += now.Sub(r.last).Seconds() * rate
+	r.last = now
+	if r.allowance > burst {
+		r.allowance = burst
+	}
+	if r.allowance < 0 {
+		wait := time.Duration(-r.allowance / rate * float64(time.Second))
+		t := time.NewTimer(wait)
+		select {
+		case <-r.ctx.Done():
+			t.Stop()
+			return 0, r.ctx.Err()
+		case <-t.C:
+		}
+		now := time.Now()
+		r.allowance += now.Sub(r.last).Seconds() * rate
+		r.last = now
+	}
+
+	if len(b) > int(burst) {
+		b = b[:int(burst)]
+	}
+	n, err := r.rc.Read(b)
+	r.allowance -= float64(n)
+	return n, err
+}
+
+func (r *readCloser) Close() error {
+	if !r.closed {
+		r.closed = true
+		r.l.unregister(r.weight)
+	}
+	return r.rc.Close()
+}
@@ -0,0 +1,70 @@
+package bandwidth
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type infiniteReader struct{}
+
+func (infiniteReader) Read(b []byte) (int, error) { return len(b), nil }
+
+func TestLimiterSingleStream(t *testing.T) {
+	const rate = 1 << 20
+	l := NewLimiter(rate)
+	rc := l.ReadCloser(context.Background(), ioutil.NopCloser(bytes.NewReader(make([]byte, rate/2))), 1)
+	defer rc.Close()
+
+	begin := time.Now()
+	n, err := io.Copy(ioutil.Discard, rc)
+	require.NoError(t, err)
+	assert.Equal(t, int64(rate/2), n)
+	took := time.Since(begin)
+	// the first burst is free, the rest takes ~0.4s
+	assert.True(t, took > 300*time.Millisecond, "took %s", took)
+	assert.True(t, took < 2*time.Second, "took %s", took)
+}
+
+func TestLimiterWeights(t *testing.T) {
+	const rate = 4 << 20
+	l := NewLimiter(rate)
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	counts := make([]int64, 2)
+	for i, weight := range []int{3, 1} {
+		rc := l.ReadCloser(ctx, ioutil.NopCloser(infiniteReader{}), weight)
+		wg.Add(1)
+		go func(i int, rc io.ReadCloser) {
+			defer wg.Done()
+			defer rc.Close()
+			counts[i], _ = io.Copy(ioutil.Discard, rc)
+		}(i, rc)
+	}
+	wg.Wait()
+
+	ratio := float64(counts[0]) / float64(counts[1])
+	assert.True(t, ratio > 2 && ratio < 4, "counts %v", counts)
+	total := counts[0] + counts[1]
+	assert.True(t, total < 2*rate, "counts %v", counts)
+}
+
+func TestLimiterCloseReturnsShare(t *testing.T) {
+	l := NewLimiter(1000)
+	a := l.ReadCloser(context.Background(), ioutil.NopCloser(infiniteReader{}), 1)
+	b := l.ReadCloser(context.Background(), ioutil.NopCloser(infiniteReader{}), 3)
+	assert.Equal(t, 250.0, l.share(1))
+	require.NoError(t, b.Close())
+	require.NoError(t, b.Close())
+	assert.Equal(t, 1000.0, l.share(1))
+	require.NoError(t, a.Close())
+}
@@ -0,0 +1,66 @@
+// Package sdnotify implements the client side of systemd's service notification
+// protocol, see sd_notify(3) and sd_watchdog_enabled(3).
+//
+// The functions are no-ops if the process is not run by systemd with
+// Type=notify or WatchdogSec= configured.
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Notify sends state, e.g. Ready, to the service manager via $NOTIFY_SOCKET.
+// It returns false and no error if $NOTIFY_SOCKET is not set.
+func Notify(state string) (sent bool, err error) {
+	sockpath := os.Getenv("NOTIFY_SOCKET")
+	if sockpath == "" {
+		return false, nil
+	}
+	if sockpath[0] == '@' {
+		sockpath = "\x00" + sockpath[1:] // abstract socket
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: sockpath, Net: "unixgram"})
+	if err != nil {
+		return false, errors.Wrap(err, "cannot connect to systemd notification socket")
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, errors.Wrap(err, "cannot send systemd notification")
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the interval within which the service manager
+// expects a Watchdog notification, or 0 if the watchdog is disabled or
+// enabled for a different process.
+func WatchdogInterval() (time.Duration, error) {
+	usecStr := os.Getenv("WATCHDOG_USEC")
+	if usecStr == "" {
+		return 0, nil
+	}
+	usec, err := strconv.ParseUint(usecStr, 10, 63)
+	if err != nil || usec == 0 {
+		return 0, errors.Errorf("invalid WATCHDOG_USEC %q", usecStr)
+	}
+	if pidStr := os.Getenv("WATCHDOG_PID"); pidStr != "" {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			return 0, errors.Errorf("invalid WATCHDOG_PID %q", pidStr)
+		}
+		if pid != os.Getpid() {
+			return 0, nil
+		}
+	}
+	return time.Duration(usec) * time.Microsecond, nil
+}
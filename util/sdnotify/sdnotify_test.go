@@ -0,0 +1,79 @@
+package sdnotify
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setenv(t *testing.T, key, val string) func() {
+	old, had := os.LookupEnv(key)
+	require.NoError(t, os.Setenv(key, val))
+	return func() {
+		if had {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	defer setenv(t, "NOTIFY_SOCKET", "")()
+	sent, err := Notify(Ready)
+	require.NoError(t, err)
+	assert.False(t, sent)
+
+	dir, err := ioutil.TempDir("", "zrepl-sdnotify-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	defer setenv(t, "NOTIFY_SOCKET", path)()
+	sent, err = Notify(Ready)
+	require.NoError(t, err)
+	assert.True(t, sent)
+	buf := make([]byte, 64)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, Ready, string(buf[:n]))
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer setenv(t, "WATCHDOG_USEC", "")()
+	defer setenv(t, "WATCHDOG_PID", "")()
+	d, err := WatchdogInterval()
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), d)
+
+	os.Setenv("WATCHDOG_USEC", "30000000")
+	d, err = WatchdogInterval()
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, d)
+
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	d, err = WatchdogInterval()
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, d)
+
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	d, err = WatchdogInterval()
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), d)
+
+	os.Setenv("WATCHDOG_PID", "")
+	os.Setenv("WATCHDOG_USEC", "forever")
+	_, err = WatchdogInterval()
+	assert.Error(t, err)
+}
@@ -1,35 +1,160 @@
+// Package semaphore provides a weighted semaphore with priority classes.
+//
+// Acquisitions are weighted, e.g., a full send may weigh more than a listing,
+// so that expensive and cheap operations can share one concurrency budget.
+// Waiters of a higher priority class are served before waiters of a lower one,
+// so that, e.g., metadata operations are not starved behind long-running sends.
+// Within a priority class, waiters are served in FIFO order, and a waiter that
+// does not fit yet blocks the waiters behind it and those of lower classes,
+// i.e., heavy acquisitions are not starved by a stream of light ones.
 package semaphore
 
 import (
+	"container/list"
 	"context"
-
-	wsemaphore "golang.org/x/sync/semaphore"
+	"fmt"
+	"sync"
 
 	"github.com/zrepl/zrepl/daemon/logging/trace"
 )
 
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+
+	numPriorities = int(PriorityHigh) + 1
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return fmt.Sprintf("Priority(%d)", int(p))
+	}
+}
+
+type waiter struct {
+	n     int64
+	ready chan struct{} // closed when the semaphore is acquired
+}
+
 type S struct {
-	ws *wsemaphore.Weighted
+	size int64
+
+	mtx     sync.Mutex
+	cur     int64
+	waiters [numPriorities]list.List // of waiter
 }
 
 func New(max int64) *S {
-	return &S{wsemaphore.NewWeighted(max)}
+	return &S{size: max}
 }
 
 type AcquireGuard struct {
 	s        *S
+	n        int64
 	released bool
 }
 
+// Acquire is equivalent to AcquireWeighted(ctx, 1, PriorityNormal).
+//
 // The returned AcquireGuard is not goroutine-safe.
 func (s *S) Acquire(ctx context.Context) (*AcquireGuard, error) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
-	if err := s.ws.Acquire(ctx, 1); err != nil {
-		return nil, err
-	} else if err := ctx.Err(); err != nil {
+	return s.acquire(ctx, 1, PriorityNormal)
+}
+
+// AcquireWeighted acquires the semaphore with weight n in priority class p,
+// blocking until the weight is available or ctx is done.
+// Weights larger than the semaphore's size are reduced to its size,
+// i.e., the acquisition waits until it is the only one.
+// AcquireWeighted panics if n is not positive or p is not a valid priority class.
+//
+// The returned AcquireGuard is not goroutine-safe.
+func (s *S) AcquireWeighted(ctx context.Context, n int64, p Priority) (*AcquireGuard, error) {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+	return s.acquire(ctx, n, p)
+}
+
+func (s *S) acquire(ctx context.Context, n int64, p Priority) (*AcquireGuard, error) {
+	if n <= 0 {
+		panic(fmt.Sprintf("semaphore weight must be positive, got %d", n))
+	}
+	if p < 0 || int(p) >= numPriorities {
+		panic(fmt.Sprintf("invalid semaphore priority %s", p))
+	}
+	if n > s.size {
+		n = s.size
+	}
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-	return &AcquireGuard{s, false}, nil
+
+	s.mtx.Lock()
+	if s.size-s.cur >= n && s.noWaitersFrom(p) {
+		s.cur += n
+		s.mtx.Unlock()
+		return &AcquireGuard{s: s, n: n}, nil
+	}
+	w := waiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters[p].PushBack(w)
+	s.mtx.Unlock()
+
+	select {
+	case <-w.ready:
+		return &AcquireGuard{s: s, n: n}, nil
+	case <-ctx.Done():
+		s.mtx.Lock()
+		select {
+		case <-w.ready:
+			// acquired concurrently with the cancellation, give it back
+			s.cur -= n
+		default:
+			s.waiters[p].Remove(elem)
+		}
+		// we may have been blocking the waiters behind us
+		s.notifyWaiters()
+		s.mtx.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// noWaitersFrom returns true if no waiter of priority class p or higher is queued,
+// i.e., an acquisition in class p may proceed without overtaking them.
+// s.mtx must be held.
+func (s *S) noWaitersFrom(p Priority) bool {
+	for i := int(p); i < numPriorities; i++ {
+		if s.waiters[i].Len() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// notifyWaiters serves queued waiters in priority and FIFO order as long as their weight fits.
+// s.mtx must be held.
+func (s *S) notifyWaiters() {
+	for i := numPriorities - 1; i >= 0; i-- {
+		q := &s.waiters[i]
+		for q.Len() > 0 {
+			front := q.Front()
+			w := front.Value.(waiter)
+			if s.size-s.cur < w.n {
+				return
+			}
+			s.cur += w.n
+			q.Remove(front)
+			close(w.ready)
+		}
+	}
 }
 
 func (g *AcquireGuard) Release() {
@@ -37,5 +162,11 @@ func (g *AcquireGuard) Release() {
 		return
 	}
 	g.released = true
-	g.s.ws.Release(1)
+	g.s.mtx.Lock()
+	defer g.s.mtx.Unlock()
+	g.s.cur -= g.n
+	if g.s.cur < 0 {
+		panic("semaphore: released more than held")
+	}
+	g.s.notifyWaiters()
 }
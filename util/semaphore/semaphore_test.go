@@ -54,3 +54,118 @@ func TestSemaphore(t *testing.T) {
 	assert.True(t, acquisitions.afterT == numGoroutines-concurrentSemaphore)
 
 }
+
+func TestSemaphoreWeighted(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	sem := New(4)
+	heavy, err := sem.AcquireWeighted(ctx, 3, PriorityNormal)
+	require.NoError(t, err)
+	light, err := sem.AcquireWeighted(ctx, 1, PriorityNormal)
+	require.NoError(t, err)
+
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = sem.AcquireWeighted(tctx, 1, PriorityHigh)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	heavy.Release()
+	heavy.Release() // idempotent
+	g, err := sem.AcquireWeighted(ctx, 3, PriorityNormal)
+	require.NoError(t, err)
+	g.Release()
+	light.Release()
+
+	// weights larger than the size wait until they are the only acquisition
+	g, err = sem.AcquireWeighted(ctx, 10, PriorityNormal)
+	require.NoError(t, err)
+	g.Release()
+}
+
+func TestSemaphorePriorities(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	sem := New(2)
+	held, err := sem.AcquireWeighted(ctx, 2, PriorityNormal)
+	require.NoError(t, err)
+
+	var mtx sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	acquire := func(name string, n int64, p Priority) {
+		ctx, end := trace.WithTaskFromStack(ctx)
+		defer end()
+		defer wg.Done()
+		g, err := sem.AcquireWeighted(ctx, n, p)
+		require.NoError(t, err)
+		mtx.Lock()
+		order = append(order, name)
+		mtx.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		g.Release()
+	}
+	// enqueue one after another so that the FIFO order within a class is defined
+	for _, w := range []struct {
+		name string
+		n    int64
+		p    Priority
+	}{
+		{"send1", 2, PriorityLow},
+		{"send2", 2, PriorityLow},
+		{"list1", 1, PriorityHigh},
+		{"list2", 1, PriorityHigh},
+		{"other", 1, PriorityNormal},
+	} {
+		wg.Add(1)
+		go acquire(w.name, w.n, w.p)
+		time.Sleep(10 * time.Millisecond)
+	}
+	held.Release()
+	wg.Wait()
+
+	// list1 and list2 fit concurrently, so their relative order is undefined
+	require.Len(t, order, 5)
+	assert.ElementsMatch(t, []string{"list1", "list2"}, order[0:2])
+	assert.Equal(t, []string{"other", "send1", "send2"}, order[2:])
+}
+
+func TestSemaphoreCancelledWaiterUnblocksOthers(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	sem := New(2)
+	held, err := sem.AcquireWeighted(ctx, 1, PriorityNormal)
+	require.NoError(t, err)
+	defer held.Release()
+
+	// the heavy waiter blocks the light one behind it until it gives up
+	heavyCtx, cancelHeavy := context.WithCancel(ctx)
+	heavyDone := make(chan error)
+	go func() {
+		ctx, end := trace.WithTaskFromStack(heavyCtx)
+		defer end()
+		_, err := sem.AcquireWeighted(ctx, 2, PriorityNormal)
+		heavyDone <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	lightDone := make(chan error)
+	go func() {
+		ctx, end := trace.WithTaskFromStack(ctx)
+		defer end()
+		g, err := sem.AcquireWeighted(ctx, 1, PriorityNormal)
+		g.Release()
+		lightDone <- err
+	}()
+	select {
+	case <-lightDone:
+		t.Fatal("light waiter must not overtake the heavy waiter of the same class")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancelHeavy()
+	assert.Equal(t, context.Canceled, <-heavyDone)
+	assert.NoError(t, <-lightDone)
+}
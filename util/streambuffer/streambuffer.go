@@ -0,0 +1,193 @@
+// Package streambuffer decouples the reader and the writer of a stream using an in-memory ring buffer,
+// similar to mbuffer(1).
+package streambuffer
+
+import (
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type Config struct {
+	// Capacity of the buffer in bytes.
+	Size int
+	// If the buffer is full, reading from the input resumes once the buffer has drained to LowWatermark bytes.
+	// LowWatermark >= Size resumes reading as soon as there is free space.
+	LowWatermark int
+	// If the buffer has run empty, the output resumes once the buffer has been filled to HighWatermark bytes
+	// or the input has ended. Zero resumes the output as soon as there is data.
+	HighWatermark int
+}
+
+func (c Config) Validate() error {
+	if c.Size <= 0 {
+		return errors.New("buffer size must be positive")
+	}
+	if c.LowWatermark < 0 || c.HighWatermark < 0 {
+		return errors.New("watermarks must not be negative")
+	}
+	if c.HighWatermark > c.Size {
+		return errors.New("high watermark must not exceed the buffer size")
+	}
+	return nil
+}
+
+// Metrics are updated with the number of bytes buffered and the capacity of the buffer.
+// They can be shared by multiple buffers. Both fields may be nil.
+type Metrics struct {
+	Buffered prometheus.Gauge
+	Capacity prometheus.Gauge
+}
+
+type buffer struct {
+	conf    Config
+	metrics Metrics
+	in      io.ReadCloser
+
+	mtx  sync.Mutex
+	cond *sync.Cond
+	buf  []byte
+	r, n int // read position and fill level
+
+	inputPaused, outputPaused bool
+	inDone                    bool
+	inErr                     error
+	closed                    bool
+}
+
+// New returns a stream that reads from in through a buffer.
+// A goroutine reads from in into the buffer until in returns an error (including io.EOF),
+// which is returned by the returned stream once the buffer has been drained.
+// Closing the returned stream closes in and discards the buffered data.
+func New(in io.ReadCloser, conf Config, metrics Metrics) (io.ReadCloser, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	b := &buffer{
+		conf:         conf,
+		metrics:      metrics,
+		in:           in,
+		buf:          make([]byte, conf.Size),
+		outputPaused: conf.HighWatermark > 0,
+	}
+	b.cond = sync.NewCond(&b.mtx)
+	if b.metrics.Capacity != nil {
+		b.metrics.Capacity.Add(float64(conf.Size))
+	}
+	go b.fill()
+	return b, nil
+}
+
+// must hold mtx
+func (b *buffer) addBuffered(delta int) {
+	b.n += delta
+	if b.metrics.Buffered != nil {
+		b.metrics.Buffered.Add(float64(delta))
+	}
+}
+
+func (b *buffer) fill() {
+	for {
+		b.mtx.Lock()
+		for !b.closed {
+			if b.inputPaused && b.n <= b.conf.LowWatermark {
+				b.inputPaused = false
+			}
+			if !b.inputPaused && b.n < len(b.buf) {
+				break
+			}
+			b.cond.Wait()
+		}
+		if b.closed {
+			b.mtx.Unlock()
+			return
+		}
+		// the free region does not change except for growing while we read into it
+		w := (b.r + b.n) % len(b.buf)
+		free := b.buf[w:]
+		if w < b.r {
+			free = b.buf[w:b.r]
+		}
+		b.mtx.Unlock()
+
+		n, err := b.in.Read(free)
+
+		b.mtx.Lock()
+		if b.closed {
+			b.mtx.Unlock()
+			return
+		}
+		b.addBuffered(n)
+		if b.n == len(b.buf) {
+			b.inputPaused = true
+		}
+		if err != nil {
+			b.inDone = true
+			if err != io.EOF {
+				b.inErr = err
+			}
+		}
+		b.cond.Broadcast()
+		b.mtx.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (b *buffer) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for {
+		if b.closed {
+			return 0, errors.New("read from closed stream buffer")
+		}
+		if b.outputPaused && (b.n >= b.conf.HighWatermark || b.inDone) {
+			b.outputPaused = false
+		}
+		if !b.outputPaused && b.n > 0 {
+			break
+		}
+		if b.n == 0 && b.inDone {
+			if b.inErr != nil {
+				return 0, b.inErr
+			}
+			return 0, io.EOF
+		}
+		b.cond.Wait()
+	}
+	end := b.r + b.n
+	if end > len(b.buf) {
+		end = len(b.buf)
+	}
+	n := copy(p, b.buf[b.r:end])
+	b.r = (b.r + n) % len(b.buf)
+	b.addBuffered(-n)
+	if b.n == 0 && !b.inDone && b.conf.HighWatermark > 0 {
+		b.outputPaused = true
+	}
+	b.cond.Broadcast()
+	return n, nil
+}
+
+func (b *buffer) Close() error {
+	b.mtx.Lock()
+	if b.closed {
+		b.mtx.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.addBuffered(-b.n)
+	if b.metrics.Capacity != nil {
+		b.metrics.Capacity.Sub(float64(b.conf.Size))
+	}
+	b.cond.Broadcast()
+	b.mtx.Unlock()
+	// unblocks fill if it is blocked in in.Read
+	return b.in.Close()
+}
@@ -0,0 +1,82 @@
+package streambuffer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferPassesThroughData(t *testing.T) {
+	data := make([]byte, 256<<10)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	tcs := []Config{
+		{Size: 1},
+		{Size: 1000, LowWatermark: 1000},
+		{Size: 4096, LowWatermark: 100, HighWatermark: 3000},
+		{Size: 2 << 20, LowWatermark: 1 << 20, HighWatermark: 2 << 20},
+	}
+	for _, conf := range tcs {
+		metrics := Metrics{
+			Buffered: prometheus.NewGauge(prometheus.GaugeOpts{Name: "buffered"}),
+			Capacity: prometheus.NewGauge(prometheus.GaugeOpts{Name: "capacity"}),
+		}
+		// small, odd-sized reads on both sides exercise the wrap-around
+		in := ioutil.NopCloser(iotest.HalfReader(bytes.NewReader(data)))
+		b, err := New(in, conf, metrics)
+		require.NoError(t, err)
+		var out bytes.Buffer
+		_, err = io.CopyBuffer(&out, iotest.OneByteReader(io.LimitReader(b, 1)), make([]byte, 1))
+		require.NoError(t, err)
+		_, err = io.CopyBuffer(&out, b, make([]byte, 777))
+		require.NoError(t, err)
+		assert.True(t, bytes.Equal(data, out.Bytes()), "%#v", conf)
+		assert.Equal(t, float64(conf.Size), testutil.ToFloat64(metrics.Capacity))
+		assert.Equal(t, float64(0), testutil.ToFloat64(metrics.Buffered))
+		require.NoError(t, b.Close())
+		assert.Equal(t, float64(0), testutil.ToFloat64(metrics.Capacity))
+	}
+}
+
+func TestBufferReturnsInputError(t *testing.T) {
+	r, w := io.Pipe()
+	b, err := New(r, Config{Size: 10, HighWatermark: 10}, Metrics{})
+	require.NoError(t, err)
+	go func() {
+		w.Write([]byte("abc"))
+		w.CloseWithError(assert.AnError)
+	}()
+	data, err := ioutil.ReadAll(b)
+	assert.Equal(t, assert.AnError, err)
+	assert.Equal(t, "abc", string(data))
+}
+
+func TestBufferCloseUnblocks(t *testing.T) {
+	r, _ := io.Pipe()
+	metrics := Metrics{Buffered: prometheus.NewGauge(prometheus.GaugeOpts{Name: "buffered"})}
+	b, err := New(r, Config{Size: 10}, metrics)
+	require.NoError(t, err)
+	done := make(chan error)
+	go func() {
+		_, err := b.Read(make([]byte, 1))
+		done <- err
+	}()
+	require.NoError(t, b.Close())
+	assert.Error(t, <-done)
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.Buffered))
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.Error(t, Config{}.Validate())
+	assert.Error(t, Config{Size: 10, HighWatermark: 11}.Validate())
+	assert.Error(t, Config{Size: 10, LowWatermark: -1}.Validate())
+	assert.NoError(t, Config{Size: 10, LowWatermark: 5, HighWatermark: 10}.Validate())
+}
@@ -0,0 +1,98 @@
+// Package streampipe runs a stream through an external command, e.g., to encrypt or compress it.
+package streampipe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/util/circlog"
+)
+
+// the amount of stderr output of the command that is included in error messages
+const stderrBufSize = 4 << 10
+
+type Error struct {
+	Argv    []string
+	WaitErr error
+	Stderr  string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("stream pipe command %q failed: %s", strings.Join(e.Argv, " "), e.WaitErr)
+	if e.Stderr != "" {
+		msg += fmt.Sprintf("\nstderr:\n%s", e.Stderr)
+	}
+	return msg
+}
+
+type pipe struct {
+	argv   []string
+	in     io.ReadCloser
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr *circlog.CircularLog
+
+	waitOnce sync.Once
+	waitErr  error
+}
+
+// Run starts argv with in as its standard input and returns its standard output.
+//
+// Reading the returned stream returns an *Error instead of io.EOF if the command exits unsuccessfully
+// or if reading from in failed.
+// Closing the returned stream closes in and kills the command if it is still running.
+func Run(ctx context.Context, argv []string, in io.ReadCloser) (io.ReadCloser, error) {
+	if len(argv) == 0 {
+		return nil, errors.New("stream pipe command must not be empty")
+	}
+	p := &pipe{
+		argv:   argv,
+		in:     in,
+		cmd:    exec.CommandContext(ctx, argv[0], argv[1:]...),
+		stderr: circlog.MustNewCircularLog(stderrBufSize),
+	}
+	p.cmd.Stdin = in
+	p.cmd.Stderr = p.stderr
+	var err error
+	if p.stdout, err = p.cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err := p.cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "cannot start stream pipe command %q", argv[0])
+	}
+	return p, nil
+}
+
+func (p *pipe) wait() error {
+	p.waitOnce.Do(func() {
+		// if in is not an *os.File, Wait also returns the error of copying from in to the command
+		if err := p.cmd.Wait(); err != nil {
+			p.waitErr = &Error{Argv: p.argv, WaitErr: err, Stderr: p.stderr.String()}
+		}
+	})
+	return p.waitErr
+}
+
+func (p *pipe) Read(buf []byte) (int, error) {
+	n, err := p.stdout.Read(buf)
+	if err == io.EOF {
+		if waitErr := p.wait(); waitErr != nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+func (p *pipe) Close() error {
+	// unblock the goroutine that copies from in to the command
+	closeErr := p.in.Close()
+	_ = p.cmd.Process.Kill() // no-op if the command has already been waited for
+	_ = p.wait()
+	return closeErr
+}
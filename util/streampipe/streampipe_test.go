@@ -0,0 +1,63 @@
+package streampipe
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("transforms", func(t *testing.T) {
+		in := ioutil.NopCloser(bytes.NewReader([]byte("some stream")))
+		out, err := Run(ctx, []string{"tr", "a-z", "A-Z"}, in)
+		require.NoError(t, err)
+		defer out.Close()
+		data, err := ioutil.ReadAll(out)
+		require.NoError(t, err)
+		assert.Equal(t, "SOME STREAM", string(data))
+	})
+
+	t.Run("command fails", func(t *testing.T) {
+		in := ioutil.NopCloser(bytes.NewReader([]byte("some stream")))
+		out, err := Run(ctx, []string{"sh", "-c", "cat >/dev/null; echo oops >&2; exit 3"}, in)
+		require.NoError(t, err)
+		defer out.Close()
+		_, err = ioutil.ReadAll(out)
+		require.Error(t, err)
+		pipeErr, ok := err.(*Error)
+		require.True(t, ok, "%T", err)
+		assert.Equal(t, "oops\n", pipeErr.Stderr)
+	})
+
+	t.Run("input fails", func(t *testing.T) {
+		r, w := io.Pipe()
+		go func() {
+			w.Write([]byte("partial"))
+			w.CloseWithError(assert.AnError)
+		}()
+		out, err := Run(ctx, []string{"cat"}, r)
+		require.NoError(t, err)
+		defer out.Close()
+		_, err = ioutil.ReadAll(out)
+		assert.Error(t, err)
+	})
+
+	t.Run("close while input blocks", func(t *testing.T) {
+		r, _ := io.Pipe()
+		out, err := Run(ctx, []string{"cat"}, r)
+		require.NoError(t, err)
+		assert.NoError(t, out.Close())
+	})
+
+	t.Run("empty command", func(t *testing.T) {
+		_, err := Run(ctx, nil, ioutil.NopCloser(bytes.NewReader(nil)))
+		assert.Error(t, err)
+	})
+}
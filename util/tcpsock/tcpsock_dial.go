@@ -0,0 +1,203 @@
+package tcpsock
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/zrepl/zrepl/util/envconst"
+)
+
+// The delay between the start of two connection attempts to different addresses of the same host,
+// see RFC 8305 "Connection Attempt Delay".
+var connectionAttemptDelay = envconst.Duration("ZREPL_TCP_CONNECTION_ATTEMPT_DELAY", 250*time.Millisecond)
+
+// AddrError is the error of a single connection attempt of a Dialer.
+type AddrError struct {
+	Addr string
+	Err  error
+}
+
+// DialError is returned by Dialer if all connection attempts have failed.
+type DialError struct {
+	Address string
+	// The errors of the individual connection attempts, in the order in which they failed.
+	// Empty if address resolution failed.
+	Attempts []AddrError
+	// The error of address resolution, if any.
+	ResolveErr error
+}
+
+func (e *DialError) Error() string {
+	if e.ResolveErr != nil {
+		return fmt.Sprintf("cannot resolve %s: %s", e.Address, e.ResolveErr)
+	}
+	msgs := make([]string, len(e.Attempts))
+	for i, a := range e.Attempts {
+		msgs[i] = fmt.Sprintf("%s: %s", a.Addr, a.Err)
+	}
+	return fmt.Sprintf("cannot connect to %s: %s", e.Address, strings.Join(msgs, "; "))
+}
+
+func (e *DialError) Timeout() bool {
+	for _, a := range e.Attempts {
+		if ne, ok := a.Err.(net.Error); ok && ne.Timeout() {
+			return true
+		}
+	}
+	return false
+}
+
+// Dialer connects to hosts with multiple IPv6 and IPv4 addresses using Happy Eyeballs (RFC 8305):
+// the addresses are tried in an order that alternates between the address families, starting with IPv6,
+// and a connection attempt is started every connectionAttemptDelay or as soon as the previous attempt has failed,
+// until one of the attempts succeeds.
+//
+// Unlike net.Dialer, Dialer reports the errors of all attempts if none succeeds.
+type Dialer struct {
+	// The maximum time for resolving the address and connecting, zero for no timeout.
+	Timeout time.Duration
+
+	// for testing
+	lookupIPAddr func(ctx context.Context, host string) ([]net.IPAddr, error)
+	dial         func(ctx context.Context, addr string) (net.Conn, error)
+}
+
+// DialContext connects to address, which is of the form host:port.
+// If all connection attempts fail, the returned error is a *DialError.
+func (d *Dialer) DialContext(ctx context.Context, address string) (*net.TCPConn, error) {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, &DialError{Address: address, ResolveErr: err}
+	}
+	var ips []net.IPAddr
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IPAddr{{IP: ip}}
+	} else {
+		lookup := net.DefaultResolver.LookupIPAddr
+		if d.lookupIPAddr != nil {
+			lookup = d.lookupIPAddr
+		}
+		if ips, err = lookup(ctx, host); err != nil {
+			return nil, &DialError{Address: address, ResolveErr: err}
+		}
+		if len(ips) == 0 {
+			return nil, &DialError{Address: address, ResolveErr: fmt.Errorf("no addresses found for %q", host)}
+		}
+	}
+	addrs := sortHappyEyeballs(ips)
+	for i := range addrs {
+		addrs[i] = net.JoinHostPort(addrs[i], port)
+	}
+
+	conn, attempts := d.race(ctx, addrs)
+	if conn == nil {
+		return nil, &DialError{Address: address, Attempts: attempts}
+	}
+	return conn.(*net.TCPConn), nil
+}
+
+// sortHappyEyeballs returns the addresses of ips, alternating between IPv6 and IPv4 addresses, starting with IPv6.
+// Within each family, the order of ips is preserved.
+func sortHappyEyeballs(ips []net.IPAddr) []string {
+	var v6, v4 []string
+	for _, ip := range ips {
+		s := ip.IP.String()
+		if ip.Zone != "" {
+			s += "%" + ip.Zone
+		}
+		if ip.IP.To4() != nil {
+			v4 = append(v4, s)
+		} else {
+			v6 = append(v6, s)
+		}
+	}
+	addrs := make([]string, 0, len(ips))
+	for i := 0; i < len(v6) || i < len(v4); i++ {
+		if i < len(v6) {
+			addrs = append(addrs, v6[i])
+		}
+		if i < len(v4) {
+			addrs = append(addrs, v4[i])
+		}
+	}
+	return addrs
+}
+
+type attemptResult struct {
+	addr string
+	conn net.Conn
+	err  error
+}
+
+func (d *Dialer) race(ctx context.Context, addrs []string) (net.Conn, []AddrError) {
+	dial := d.dial
+	if dial == nil {
+		var nd net.Dialer
+		dial = func(ctx context.Context, addr string) (net.Conn, error) {
+			return nd.DialContext(ctx, "tcp", addr)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attemptResult, len(addrs))
+	started, pending := 0, 0
+	startNext := func() {
+		addr := addrs[started]
+		started++
+		pending++
+		go func() {
+			conn, err := dial(ctx, addr)
+			results <- attemptResult{addr, conn, err}
+		}()
+	}
+
+	var failed []AddrError
+	timer := time.NewTimer(connectionAttemptDelay)
+	defer timer.Stop()
+	startNext()
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if started < len(addrs) {
+				startNext()
+				timer.Reset(connectionAttemptDelay)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				// the remaining attempts are aborted by cancel, close the connections of those that succeed anyway
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
+						}
+					}
+				}(pending)
+				return res.conn, nil
+			}
+			failed = append(failed, AddrError{res.addr, res.err})
+			if started < len(addrs) {
+				startNext()
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(connectionAttemptDelay)
+			}
+		}
+	}
+	return nil, failed
+}
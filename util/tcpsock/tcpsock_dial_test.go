@@ -0,0 +1,93 @@
+package tcpsock
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortHappyEyeballs(t *testing.T) {
+	ips := []net.IPAddr{
+		{IP: net.ParseIP("192.0.2.1")},
+		{IP: net.ParseIP("192.0.2.2")},
+		{IP: net.ParseIP("192.0.2.3")},
+		{IP: net.ParseIP("2001:db8::1")},
+		{IP: net.ParseIP("fe80::1"), Zone: "eth0"},
+	}
+	assert.Equal(t,
+		[]string{"2001:db8::1", "192.0.2.1", "fe80::1%eth0", "192.0.2.2", "192.0.2.3"},
+		sortHappyEyeballs(ips))
+}
+
+func TestDialerRace(t *testing.T) {
+	defer func(d time.Duration) { connectionAttemptDelay = d }(connectionAttemptDelay)
+	connectionAttemptDelay = 10 * time.Millisecond
+
+	t.Run("falls back to the next address if an attempt hangs", func(t *testing.T) {
+		d := Dialer{
+			dial: func(ctx context.Context, addr string) (net.Conn, error) {
+				if addr == "[2001:db8::1]:1" {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}
+				c, _ := net.Pipe()
+				return c, nil
+			},
+		}
+		conn, failed := d.race(context.Background(), []string{"[2001:db8::1]:1", "192.0.2.1:1"})
+		require.NotNil(t, conn)
+		conn.Close()
+		assert.Empty(t, failed)
+	})
+
+	t.Run("reports the errors of all attempts", func(t *testing.T) {
+		errRefused := errors.New("connection refused")
+		d := Dialer{
+			dial: func(ctx context.Context, addr string) (net.Conn, error) {
+				return nil, errRefused
+			},
+		}
+		start := time.Now()
+		conn, failed := d.race(context.Background(), []string{"[2001:db8::1]:1", "192.0.2.1:1", "192.0.2.2:1"})
+		assert.Nil(t, conn)
+		assert.Equal(t, []AddrError{
+			{"[2001:db8::1]:1", errRefused},
+			{"192.0.2.1:1", errRefused},
+			{"192.0.2.2:1", errRefused},
+		}, failed)
+		assert.True(t, time.Since(start) < connectionAttemptDelay, "failed attempts start the next attempt immediately")
+	})
+}
+
+func TestDialerDialContext(t *testing.T) {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer l.Close()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+
+	d := Dialer{
+		Timeout: 10 * time.Second,
+		lookupIPAddr: func(ctx context.Context, host string) ([]net.IPAddr, error) {
+			// 192.0.2.0/24 is reserved for documentation, the connection attempt is expected to fail or hang
+			return []net.IPAddr{{IP: net.ParseIP("192.0.2.1")}, {IP: net.IPv4(127, 0, 0, 1)}}, nil
+		},
+	}
+	conn, err := d.DialContext(context.Background(), net.JoinHostPort("backup.example", port))
+	require.NoError(t, err)
+	conn.Close()
+
+	d.lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return nil, errors.New("no such host")
+	}
+	_, err = d.DialContext(context.Background(), net.JoinHostPort("backup.example", port))
+	require.Error(t, err)
+	dialErr, ok := err.(*DialError)
+	require.True(t, ok, "%T", err)
+	assert.Error(t, dialErr.ResolveErr)
+}
@@ -0,0 +1,53 @@
+package zfs
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// ACLProperties are the properties that govern how the file ownership and ACLs
+// stored in a filesystem are interpreted. They are not part of a send stream
+// unless it includes properties, which zrepl's sends do not.
+// Not every platform supports every property, e.g., aclmode is a no-op on Linux
+// and older releases of ZFS on Linux do not know it at all.
+var ACLProperties = []string{"acltype", "aclinherit", "aclmode"}
+
+// ZFSGetACLProperties returns the values of the ACLProperties of fs,
+// omitting properties that the platform does not support.
+func ZFSGetACLProperties(ctx context.Context, fs string) (map[string]string, error) {
+	if err := validateZFSFilesystem(fs); err != nil {
+		return nil, err
+	}
+	res := make(map[string]string, len(ACLProperties))
+	props, err := zfsGet(ctx, fs, ACLProperties, sourceAny)
+	if err == nil {
+		for _, p := range ACLProperties {
+			setACLProperty(res, p, props.Get(p))
+		}
+		return res, nil
+	}
+	if _, ok := err.(*ZFSError); !ok {
+		return nil, errors.Wrap(err, "cannot get ACL properties")
+	}
+	// zfs get fails as a whole if one of the properties is unknown, retry them one by one
+	debug(ctx, "zfs get of ACL properties failed, retrying one by one: %s", err)
+	for _, p := range ACLProperties {
+		props, err := zfsGet(ctx, fs, []string{p}, sourceAny)
+		if _, ok := err.(*ZFSError); ok {
+			debug(ctx, "skipping ACL property %q: %s", p, err)
+			continue
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "cannot get ACL property %q", p)
+		}
+		setACLProperty(res, p, props.Get(p))
+	}
+	return res, nil
+}
+
+// "-" is the value of properties that do not apply to the dataset.
+func setACLProperty(m map[string]string, prop, val string) {
+	if val != "" && val != "-" {
+		m[prop] = val
+	}
+}
@@ -0,0 +1,93 @@
+package zfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+type ChecksumMethod string
+
+const (
+	// size of the full send stream as estimated by `zfs send -nvP`
+	ChecksumMethodStreamSize ChecksumMethod = "stream_size"
+	// SHA256 of the full send stream's records, excluding those that depend on the dataset name (reads the entire snapshot)
+	ChecksumMethodStreamSHA256 ChecksumMethod = "stream_sha256"
+)
+
+func ChecksumMethodFromString(s string) (ChecksumMethod, error) {
+	switch s {
+	case string(ChecksumMethodStreamSize):
+		return ChecksumMethodStreamSize, nil
+	case string(ChecksumMethodStreamSHA256):
+		return ChecksumMethodStreamSHA256, nil
+	default:
+		return "", fmt.Errorf("unknown checksum method %q", s)
+	}
+}
+
+// ZFSChecksumVersion computes a checksum of snapshot v of filesystem fs
+// that can be compared with the checksum of the same snapshot on another pool.
+//
+// The checksum is computed over the full (non-incremental) send stream of v.
+// For ChecksumMethodStreamSHA256, the parts of the stream that embed the dataset name
+// are excluded, see hashSendStreamRecords.
+// If fs is encrypted, the raw send stream is used, which means that checksums
+// are only comparable between two datasets that are either both encrypted or both unencrypted.
+func ZFSChecksumVersion(ctx context.Context, fs string, v FilesystemVersion, method ChecksumMethod) (string, error) {
+
+	if !v.IsSnapshot() {
+		return "", errors.Errorf("version %q is not a snapshot", v.RelName())
+	}
+
+	encrypted, err := ZFSGetEncryptionEnabled(ctx, fs)
+	if err != nil {
+		return "", err
+	}
+
+	to := v.ToSendArgVersion()
+	sendArgs := ZFSSendArgsValidated{
+		ZFSSendArgsUnvalidated: ZFSSendArgsUnvalidated{
+			FS:        fs,
+			To:        &to,
+			Encrypted: &NilBool{B: encrypted},
+		},
+		ToVersion: v,
+	}
+
+	switch method {
+	case ChecksumMethodStreamSize:
+		si, err := ZFSSendDry(ctx, sendArgs)
+		if err != nil {
+			return "", err
+		}
+		if si.SizeEstimate <= 0 {
+			return "", errors.Errorf("zfs send dry run did not produce a size estimate for %q", v.FullPath(fs))
+		}
+		return strconv.FormatInt(si.SizeEstimate, 10), nil
+
+	case ChecksumMethodStreamSHA256:
+		stream, err := ZFSSend(ctx, sendArgs)
+		if err != nil {
+			return "", err
+		}
+		h := sha256.New()
+		copyErr := hashSendStreamRecords(h, stream)
+		closeErr := stream.Close()
+		if copyErr != nil {
+			return "", copyErr
+		}
+		if closeErr != nil && closeErr != io.EOF { // EOF: stream was read to completion
+			return "", closeErr
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+
+	default:
+		return "", errors.Errorf("unknown checksum method %q", method)
+	}
+}
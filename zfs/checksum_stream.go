@@ -0,0 +1,135 @@
+package zfs
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// Layout of dmu_replay_record_t, see include/sys/zfs_ioctl.h in OpenZFS.
+const (
+	sendStreamRecordSize = 312
+	// offset of the drr_u union
+	sendStreamRecordUnionOffset = 8
+	// offset of drr_checksum.drr_checksum, the running checksum of the stream up to this record
+	sendStreamRecordChecksumOffset = 280
+	// DMU_BACKUP_MAGIC, stored in drr_begin.drr_magic
+	sendStreamBackupMagic uint64 = 0x2F5bacbac
+)
+
+const (
+	drrBegin uint32 = iota
+	drrObject
+	drrFreeObjects
+	drrWrite
+	drrFree
+	drrEnd
+	drrWriteByRef
+	drrSpill
+	drrWriteEmbedded
+	drrObjectRange
+	drrRedact
+)
+
+// hashSendStreamRecords writes the records of the (non-compound) send stream r to w,
+// excluding everything that depends on the name of the sending dataset:
+//
+//   - the BEGIN record and its payload, which contain the dataset name (drr_toname),
+//   - the END record, which contains the checksum of the entire stream,
+//   - the running checksum at the end of every other record.
+//
+// Thereby, the output is identical for the same snapshot on the sender and the receiver.
+func hashSendStreamRecords(w io.Writer, r io.Reader) error {
+	var order binary.ByteOrder
+	rec := make([]byte, sendStreamRecordSize)
+	for {
+		if _, err := io.ReadFull(r, rec); err != nil {
+			if err == io.EOF && order != nil {
+				return errors.New("send stream ended without END record")
+			}
+			return errors.Wrap(err, "read send stream record")
+		}
+
+		if order == nil {
+			order = sendStreamByteOrder(rec)
+			if order == nil {
+				return errors.New("send stream does not start with a BEGIN record")
+			}
+		}
+		typ := order.Uint32(rec[0:4])
+		u := rec[sendStreamRecordUnionOffset:]
+
+		var payloadLen uint64
+		switch typ {
+		case drrBegin:
+			payloadLen = uint64(order.Uint32(rec[4:8])) // drr_payloadlen
+		case drrObject:
+			bonuslen := uint64(order.Uint32(u[20:24]))
+			rawBonuslen := uint64(order.Uint32(u[28:32]))
+			payloadLen = roundUp8(bonuslen)
+			if rawBonuslen != 0 {
+				payloadLen = rawBonuslen
+			}
+		case drrWrite:
+			payloadLen = order.Uint64(u[24:32]) // drr_logical_size
+			if compressed := order.Uint64(u[88:96]); compressed != 0 {
+				payloadLen = compressed
+			}
+		case drrSpill:
+			payloadLen = order.Uint64(u[8:16]) // drr_length
+			if compressed := order.Uint64(u[32:40]); compressed != 0 {
+				payloadLen = compressed
+			}
+		case drrWriteEmbedded:
+			payloadLen = roundUp8(uint64(order.Uint32(u[44:48]))) // drr_psize
+		case drrFreeObjects, drrFree, drrWriteByRef, drrObjectRange, drrRedact, drrEnd:
+			payloadLen = 0
+		default:
+			return errors.Errorf("unknown send stream record type %d", typ)
+		}
+
+		if typ == drrBegin {
+			if _, err := io.CopyN(ioutil.Discard, r, int64(payloadLen)); err != nil {
+				return errors.Wrap(err, "read BEGIN record payload")
+			}
+			continue
+		}
+		if typ == drrEnd {
+			n, err := io.Copy(ioutil.Discard, r)
+			if err != nil {
+				return errors.Wrap(err, "read send stream after END record")
+			}
+			if n > 0 {
+				return errors.Errorf("send stream has %d bytes after END record", n)
+			}
+			return nil
+		}
+
+		for i := sendStreamRecordChecksumOffset; i < len(rec); i++ {
+			rec[i] = 0
+		}
+		if _, err := w.Write(rec); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, r, int64(payloadLen)); err != nil {
+			return errors.Wrapf(err, "read payload of send stream record type %d", typ)
+		}
+	}
+}
+
+// returns nil if rec is not a BEGIN record
+func sendStreamByteOrder(rec []byte) binary.ByteOrder {
+	magic := rec[sendStreamRecordUnionOffset : sendStreamRecordUnionOffset+8]
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		if order.Uint32(rec[0:4]) == drrBegin && order.Uint64(magic) == sendStreamBackupMagic {
+			return order
+		}
+	}
+	return nil
+}
+
+func roundUp8(n uint64) uint64 {
+	return (n + 7) &^ 7
+}
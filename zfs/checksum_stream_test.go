@@ -0,0 +1,105 @@
+package zfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSendStream struct {
+	order binary.ByteOrder
+	buf   bytes.Buffer
+	// stand-in for the running checksum, which depends on the BEGIN record
+	cksum byte
+}
+
+func (s *testSendStream) record(typ uint32, fill func(u []byte), payload []byte) {
+	rec := make([]byte, sendStreamRecordSize)
+	s.order.PutUint32(rec[0:4], typ)
+	if fill != nil {
+		fill(rec[sendStreamRecordUnionOffset:])
+	}
+	for i := sendStreamRecordChecksumOffset; i < len(rec); i++ {
+		rec[i] = s.cksum
+	}
+	s.buf.Write(rec)
+	s.buf.Write(payload)
+}
+
+func (s *testSendStream) begin(toname string, nvlist []byte) {
+	s.cksum = byte(len(toname))
+	rec := make([]byte, sendStreamRecordSize)
+	s.order.PutUint32(rec[0:4], drrBegin)
+	s.order.PutUint32(rec[4:8], uint32(len(nvlist)))
+	s.order.PutUint64(rec[8:16], sendStreamBackupMagic)
+	copy(rec[8+48:], toname) // drr_toname
+	s.buf.Write(rec)
+	s.buf.Write(nvlist)
+}
+
+func (s *testSendStream) object(bonus []byte) {
+	s.record(drrObject, func(u []byte) {
+		s.order.PutUint32(u[20:24], uint32(len(bonus)))
+	}, append(bonus, make([]byte, roundUp8(uint64(len(bonus)))-uint64(len(bonus)))...))
+}
+
+func (s *testSendStream) write(data []byte) {
+	s.record(drrWrite, func(u []byte) {
+		s.order.PutUint64(u[24:32], uint64(len(data)))
+	}, data)
+}
+
+func (s *testSendStream) end() {
+	s.record(drrEnd, func(u []byte) {
+		u[0] = s.cksum // drr_end.drr_checksum
+	}, nil)
+}
+
+func hashTestSendStream(t *testing.T, s *testSendStream) []byte {
+	h := sha256.New()
+	require.NoError(t, hashSendStreamRecords(h, &s.buf))
+	return h.Sum(nil)
+}
+
+func TestHashSendStreamRecordsIgnoresDatasetName(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		stream := func(toname string, data []byte) *testSendStream {
+			s := &testSendStream{order: order}
+			s.begin(toname, []byte("nvlist--"))
+			s.object([]byte("bonus"))
+			s.write(data)
+			s.end()
+			return s
+		}
+
+		sender := hashTestSendStream(t, stream("pool/sender/fs@snap", []byte("data")))
+		receiver := hashTestSendStream(t, stream("backup/mapped/receiver/fs@snap", []byte("data")))
+		assert.Equal(t, sender, receiver, "%s", order)
+
+		differentData := hashTestSendStream(t, stream("backup/mapped/receiver/fs@snap", []byte("DATA")))
+		assert.NotEqual(t, sender, differentData, "%s", order)
+	}
+}
+
+func TestHashSendStreamRecordsErrors(t *testing.T) {
+	var h bytes.Buffer
+
+	noBegin := &testSendStream{order: binary.LittleEndian}
+	noBegin.write([]byte("data"))
+	assert.Error(t, hashSendStreamRecords(&h, &noBegin.buf))
+
+	noEnd := &testSendStream{order: binary.LittleEndian}
+	noEnd.begin("pool/fs@snap", nil)
+	noEnd.write([]byte("data"))
+	assert.Error(t, hashSendStreamRecords(&h, &noEnd.buf))
+
+	trailingData := &testSendStream{order: binary.LittleEndian}
+	trailingData.begin("pool/fs@snap", nil)
+	trailingData.end()
+	trailingData.buf.WriteString("garbage")
+	assert.Error(t, hashSendStreamRecords(&h, &trailingData.buf))
+}
@@ -0,0 +1,135 @@
+package zfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type DatasetPath struct {
+	comps []string
+}
+
+func (p *DatasetPath) ToString() string {
+	return strings.Join(p.comps, "/")
+}
+
+func (p *DatasetPath) Empty() bool {
+	return len(p.comps) == 0
+}
+
+func (p *DatasetPath) Extend(extend *DatasetPath) {
+	p.comps = append(p.comps, extend.comps...)
+}
+
+func (p *DatasetPath) HasPrefix(prefix *DatasetPath) bool {
+	if len(prefix.comps) > len(p.comps) {
+		return false
+	}
+	for i := range prefix.comps {
+		if prefix.comps[i] != p.comps[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *DatasetPath) TrimPrefix(prefix *DatasetPath) {
+	if !p.HasPrefix(prefix) {
+		return
+	}
+	prelen := len(prefix.comps)
+	newlen := len(p.comps) - prelen
+	oldcomps := p.comps
+	p.comps = make([]string, newlen)
+	for i := 0; i < newlen; i++ {
+		p.comps[i] = oldcomps[prelen+i]
+	}
+}
+
+func (p *DatasetPath) TrimNPrefixComps(n int) {
+	if len(p.comps) < n {
+		n = len(p.comps)
+	}
+	if n == 0 {
+		return
+	}
+	p.comps = p.comps[n:]
+
+}
+
+func (p DatasetPath) Equal(q *DatasetPath) bool {
+	if len(p.comps) != len(q.comps) {
+		return false
+	}
+	for i := range p.comps {
+		if p.comps[i] != q.comps[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *DatasetPath) Length() int {
+	return len(p.comps)
+}
+
+func (p *DatasetPath) Copy() (c *DatasetPath) {
+	c = &DatasetPath{}
+	c.comps = make([]string, len(p.comps))
+	copy(c.comps, p.comps)
+	return
+}
+
+func (p *DatasetPath) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.comps)
+}
+
+func (p *DatasetPath) UnmarshalJSON(b []byte) error {
+	var comps []string
+	if err := json.Unmarshal(b, &comps); err != nil {
+		return err
+	}
+	q, err := NewDatasetPath(strings.Join(comps, "/"))
+	if err != nil {
+		return err
+	}
+	if len(q.comps) != len(comps) {
+		return fmt.Errorf("invalid dataset path components %q", comps)
+	}
+	*p = *q
+	return nil
+}
+
+func (p *DatasetPath) Pool() (string, error) {
+	if len(p.comps) < 1 {
+		return "", fmt.Errorf("dataset path does not have a pool component")
+	}
+	return p.comps[0], nil
+
+}
+
+// NewDatasetPath parses s as the name of a filesystem or volume.
+//
+// Since dataset paths arrive from RPC peers, s is checked against the ZFS
+// naming rules (see EntityNamecheck), i.e., among others, the allowed
+// characters, the maximum name length and nesting depth, and the absence
+// of the snapshot and bookmark delimiters '@' and '#'.
+// The empty string is the empty dataset path.
+func NewDatasetPath(s string) (p *DatasetPath, err error) {
+	if s == "" {
+		return &DatasetPath{comps: make([]string, 0)}, nil // the empty dataset path
+	}
+	if pve := EntityNamecheck(s, EntityTypeFilesystem); pve != nil {
+		return nil, pve
+	}
+	return &DatasetPath{comps: strings.Split(s, "/")}, nil
+}
+
+func toDatasetPath(s string) *DatasetPath {
+	p, err := NewDatasetPath(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
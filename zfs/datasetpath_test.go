@@ -0,0 +1,91 @@
+package zfs
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDatasetPath(t *testing.T) {
+	tcs := []struct {
+		input string
+		ok    bool
+	}{
+		{"", true},
+		{"pool", true},
+		{"pool/foo bar/baz-1_2.3:4", true},
+		{"pool/", false},
+		{"/pool", false},
+		{"pool//foo", false},
+		{"pool/foo@snap", false},
+		{"pool/foo#book", false},
+		{"pool/%recv", false},
+		{"pool/foo|bar", false},
+		{"pool/foo*", false},
+		{"pool/<foo>", false},
+		{"pool/foo\tbar", false},
+		{"pool/..", false},
+		{"pool/./foo", false},
+		{"pool/bår", false},
+		{strings.Repeat("a", MaxDatasetNameLen), true},
+		{strings.Repeat("a", MaxDatasetNameLen+1), false},
+		{"pool" + strings.Repeat("/a", MaxDatasetNestingDepth-1), true},
+		{"pool" + strings.Repeat("/a", MaxDatasetNestingDepth), false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.input, func(t *testing.T) {
+			p, err := NewDatasetPath(tc.input)
+			if !tc.ok {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.input, p.ToString())
+		})
+	}
+}
+
+func TestDatasetPathUnmarshalJSON(t *testing.T) {
+	var p DatasetPath
+	require.NoError(t, json.Unmarshal([]byte(`["pool","foo"]`), &p))
+	assert.True(t, p.Equal(toDatasetPath("pool/foo")))
+
+	require.NoError(t, json.Unmarshal([]byte(`[]`), &p))
+	assert.True(t, p.Empty())
+
+	for _, invalid := range []string{`["pool/foo"]`, `[""]`, `["pool",""]`, `["pool@snap"]`} {
+		assert.Error(t, json.Unmarshal([]byte(invalid), &p), invalid)
+	}
+}
+
+func FuzzNewDatasetPath(f *testing.F) {
+	for _, seed := range []string{"", "pool", "pool/foo bar", "pool/foo@snap", "pool//foo", "pool/.."} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		p, err := NewDatasetPath(s)
+		if err != nil {
+			return
+		}
+		if s == "" {
+			require.True(t, p.Empty())
+			return
+		}
+		require.Equal(t, s, p.ToString())
+		require.False(t, strings.ContainsAny(s, "@#%"))
+		require.True(t, len(s) <= MaxDatasetNameLen)
+		require.True(t, p.Length() <= MaxDatasetNestingDepth)
+		for _, c := range p.comps {
+			require.NoError(t, ComponentNamecheck(c))
+		}
+
+		b, err := json.Marshal(p)
+		require.NoError(t, err)
+		var q DatasetPath
+		require.NoError(t, json.Unmarshal(b, &q))
+		require.True(t, p.Equal(&q))
+	})
+}
@@ -29,7 +29,7 @@ func EncryptionCLISupported(ctx context.Context) (bool, error) {
 		}
 		def := strings.Contains(string(output), "load-key") && strings.Contains(string(output), "keylocation")
 		encryptionCLISupport.supported = envconst.Bool("ZREPL_EXPERIMENTAL_ZFS_ENCRYPTION_CLI_SUPPORTED", def)
-		debug("encryption cli feature check complete %#v", &encryptionCLISupport)
+		debug(ctx, "encryption cli feature check complete %#v", &encryptionCLISupport)
 	})
 	return encryptionCLISupport.supported, encryptionCLISupport.err
 }
@@ -43,7 +43,11 @@ func ZFSHold(ctx context.Context, fs string, v FilesystemVersion, tag string) er
 		return err
 	}
 	fullPath := v.FullPath(fs)
-	output, err := zfscmd.CommandContext(ctx, "zfs", "hold", tag, fullPath).CombinedOutput()
+	args, err := newZFSArgs("hold").Operand(tag).Dataset(fullPath, EntityTypeSnapshot).Argv()
+	if err != nil {
+		return err
+	}
+	output, err := zfscmd.CommandContext(ctx, "zfs", args...).CombinedOutput()
 	if err != nil {
 		if bytes.Contains(output, []byte("tag already exists on this dataset")) {
 			goto success
@@ -62,7 +66,11 @@ func ZFSHolds(ctx context.Context, fs, snap string) ([]string, error) {
 		return nil, fmt.Errorf("`snap` must not be empty")
 	}
 	dp := fmt.Sprintf("%s@%s", fs, snap)
-	output, err := zfscmd.CommandContext(ctx, "zfs", "holds", "-H", dp).CombinedOutput()
+	args, err := newZFSArgs("holds").Flags("-H").Dataset(dp, EntityTypeSnapshot).Argv()
+	if err != nil {
+		return nil, err
+	}
+	output, err := zfscmd.CommandContext(ctx, "zfs", args...).CombinedOutput()
 	if err != nil {
 		return nil, &ZFSError{output, errors.Wrap(err, "zfs holds failed")}
 	}
@@ -97,8 +105,14 @@ func ZFSRelease(ctx context.Context, tag string, snaps ...string) error {
 				break
 			}
 		}
-		args := []string{"release", tag}
-		args = append(args, snaps[i:j]...)
+		releaseArgs := newZFSArgs("release").Operand(tag)
+		for _, snap := range snaps[i:j] {
+			releaseArgs.Dataset(snap, EntityTypeSnapshot)
+		}
+		args, err := releaseArgs.Argv()
+		if err != nil {
+			return err
+		}
 		output, err := zfscmd.CommandContext(ctx, "zfs", args...).CombinedOutput()
 		if pe, ok := err.(*os.PathError); err != nil && ok && pe.Err == syscall.E2BIG {
 			maxInvocationLen = maxInvocationLen / 2
@@ -124,9 +138,7 @@ func ZFSRelease(ctx context.Context, tag string, snaps ...string) error {
 		}
 
 	}
-	if debugEnabled {
-		debug("zfs release: no such tag lines=%v otherLines=%v", noSuchTagLines, otherLines)
-	}
+	debug(ctx, "zfs release: no such tag lines=%v otherLines=%v", noSuchTagLines, otherLines)
 	if len(otherLines) > 0 {
 		return fmt.Errorf("unknown zfs error while releasing hold with tag %q:\n%s", tag, strings.Join(otherLines, "\n"))
 	}
@@ -20,6 +20,61 @@ var _ DatasetFilter = noFilter{}
 
 func (noFilter) Filter(p *DatasetPath) (pass bool, err error) { return true, nil }
 
+// A DatasetFilter that decides based on the values of ZFS properties.
+// ZFSListMappingProperties lists the properties together with the datasets
+// and calls FilterWithProperties instead of Filter.
+type DatasetPropertyFilter interface {
+	DatasetFilter
+	// Must not contain 'name'
+	FilterProperties() []string
+	// props contains the values of the properties returned by FilterProperties
+	FilterWithProperties(p *DatasetPath, props map[string]string) (pass bool, err error)
+}
+
+// A DatasetFilter whose decision requires zfs commands.
+// Filter should only be used by callers that do not have a context.
+type DatasetContextFilter interface {
+	DatasetFilter
+	FilterContext(ctx context.Context, p *DatasetPath) (pass bool, err error)
+}
+
+// FilterContext is filter.FilterContext if filter is a DatasetContextFilter, and filter.Filter otherwise.
+func FilterContext(ctx context.Context, filter DatasetFilter, p *DatasetPath) (pass bool, err error) {
+	if cf, ok := filter.(DatasetContextFilter); ok {
+		return cf.FilterContext(ctx, p)
+	}
+	return filter.Filter(p)
+}
+
+// FilterAll evaluates filter for each path in ps, i.e. pass[i] is the result for ps[i].
+// If filter is a DatasetPropertyFilter, the properties of all paths are fetched with a single zfs command.
+func FilterAll(ctx context.Context, filter DatasetFilter, ps []*DatasetPath) (pass []bool, err error) {
+	pass = make([]bool, len(ps))
+	propFilter, isPropFilter := filter.(DatasetPropertyFilter)
+	if !isPropFilter {
+		for i, p := range ps {
+			if pass[i], err = FilterContext(ctx, filter, p); err != nil {
+				return nil, err
+			}
+		}
+		return pass, nil
+	}
+	props, err := ZFSGetRecursive(ctx, ps, propFilter.FilterProperties())
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range ps {
+		pprops, ok := props[p.ToString()]
+		if !ok {
+			return nil, fmt.Errorf("zfs get did not return properties for %q", p.ToString())
+		}
+		if pass[i], err = propFilter.FilterWithProperties(p, pprops); err != nil {
+			return nil, err
+		}
+	}
+	return pass, nil
+}
+
 func ZFSListMapping(ctx context.Context, filter DatasetFilter) (datasets []*DatasetPath, err error) {
 	res, err := ZFSListMappingProperties(ctx, filter, nil)
 	if err != nil {
@@ -50,9 +105,16 @@ func ZFSListMappingProperties(ctx context.Context, filter DatasetFilter, propert
 			panic("properties must not contain 'name'")
 		}
 	}
-	newProps := make([]string, len(properties)+1)
-	newProps[0] = "name"
-	copy(newProps[1:], properties)
+	var filterProps []string
+	propFilter, isPropFilter := filter.(DatasetPropertyFilter)
+	if isPropFilter {
+		filterProps = propFilter.FilterProperties()
+	}
+	newProps := make([]string, 0, len(properties)+len(filterProps)+1)
+	newProps = append(newProps, "name")
+	newProps = append(newProps, properties...)
+	newProps = append(newProps, filterProps...)
+	callerFieldsEnd := len(properties) + 1
 	properties = newProps
 
 	ctx, cancel := context.WithCancel(ctx)
@@ -74,14 +136,24 @@ func ZFSListMappingProperties(ctx context.Context, filter DatasetFilter, propert
 			return
 		}
 
-		pass, filterErr := filter.Filter(path)
+		var pass bool
+		var filterErr error
+		if isPropFilter {
+			props := make(map[string]string, len(filterProps))
+			for i, p := range filterProps {
+				props[p] = r.Fields[callerFieldsEnd+i]
+			}
+			pass, filterErr = propFilter.FilterWithProperties(path, props)
+		} else {
+			pass, filterErr = filter.Filter(path)
+		}
 		if filterErr != nil {
 			return nil, fmt.Errorf("error calling filter: %s", filterErr)
 		}
 		if pass {
 			datasets = append(datasets, ZFSListMappingPropertiesResult{
 				Path:   path,
-				Fields: r.Fields[1:],
+				Fields: r.Fields[1:callerFieldsEnd],
 			})
 		}
 
@@ -10,6 +10,9 @@ import (
 
 const MaxDatasetNameLen = 256 - 1
 
+// MaxDatasetNestingDepth is the default of the ZFS module parameter zfs_max_dataset_nesting.
+const MaxDatasetNestingDepth = 50
+
 type EntityType string
 
 const (
@@ -136,6 +139,15 @@ func EntityNamecheck(path string, t EntityType) (err *PathValidationError) {
 		return pve("must be ASCII")
 	}
 
+	// mimic module/zcommon/zfs_namecheck.c: dataset_nestcheck
+	depth := strings.Count(path, "/")
+	if strings.ContainsAny(path, "@#") {
+		depth++
+	}
+	if depth >= MaxDatasetNestingDepth {
+		return pve(fmt.Sprintf("nesting depth must be less than %d", MaxDatasetNestingDepth))
+	}
+
 	slashComps := bytes.Split([]byte(path), []byte("/"))
 	bookmarkOrSnapshotDelims := 0
 	for compI, comp := range slashComps {
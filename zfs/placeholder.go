@@ -5,6 +5,7 @@ import (
 	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
+	"strconv"
 
 	"github.com/pkg/errors"
 
@@ -85,17 +86,18 @@ func ZFSCreatePlaceholderFilesystem(ctx context.Context, fs *DatasetPath, parent
 		return fmt.Errorf("cannot create %q: pools cannot be created with zfs create", fs.ToString())
 	}
 
-	cmdline := []string{
-		"create",
-		"-o", fmt.Sprintf("%s=%s", PlaceholderPropertyName, placeholderPropertyOn),
-		"-o", "mountpoint=none",
-	}
+	args := newZFSArgs("create").
+		Option("-o", fmt.Sprintf("%s=%s", PlaceholderPropertyName, placeholderPropertyOn)).
+		Option("-o", "mountpoint=none")
 	if parentEncrypted, err := ZFSGetEncryptionEnabled(ctx, parent.ToString()); err != nil {
 		return errors.Wrap(err, "cannot determine encryption support")
 	} else if parentEncrypted {
-		cmdline = append(cmdline, "-o", "encryption=off")
+		args.Option("-o", "encryption=off")
+	}
+	cmdline, err := args.Dataset(fs.ToString(), EntityTypeFilesystem).Argv()
+	if err != nil {
+		return err
 	}
-	cmdline = append(cmdline, fs.ToString())
 	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, cmdline...)
 
 	stdio, err := cmd.CombinedOutput()
@@ -149,3 +151,50 @@ func ZFSMigrateHashBasedPlaceholderToCurrent(ctx context.Context, fs *DatasetPat
 	}
 	return &report, nil
 }
+
+// PlaceholderContents describes what a forced receive into an existing placeholder filesystem would discard.
+type PlaceholderContents struct {
+	UsedByDataset uint64 // bytes
+	Snapshots     int
+	Children      int // filesystems and volumes
+}
+
+// HoldsData returns true if the placeholder has snapshots or uses more than threshold bytes,
+// i.e., contains more than an empty filesystem created by ZFSCreatePlaceholderFilesystem.
+func (c *PlaceholderContents) HoldsData(threshold uint64) bool {
+	return c.Snapshots > 0 || c.UsedByDataset > threshold
+}
+
+func ZFSGetPlaceholderContents(ctx context.Context, p *DatasetPath) (*PlaceholderContents, error) {
+	if err := validateDatasetOperand(p.ToString(), EntityTypeFilesystem); err != nil {
+		return nil, err
+	}
+	rows, err := ZFSList(ctx, []string{"name", "type", "usedbydataset"},
+		"-r", "-d", "1", "-t", "filesystem,volume,snapshot", p.ToString())
+	if err != nil {
+		return nil, err
+	}
+	return placeholderContentsFromList(p.ToString(), rows)
+}
+
+func placeholderContentsFromList(fs string, rows [][]string) (*PlaceholderContents, error) {
+	var c PlaceholderContents
+	for _, row := range rows {
+		if len(row) != 3 {
+			return nil, fmt.Errorf("unexpected zfs list output: %q", row)
+		}
+		switch {
+		case row[0] == fs:
+			used, err := strconv.ParseUint(row[2], 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "cannot parse usedbydataset of %q", fs)
+			}
+			c.UsedByDataset = used
+		case row[1] == "snapshot":
+			c.Snapshots++
+		default:
+			c.Children++
+		}
+	}
+	return &c, nil
+}
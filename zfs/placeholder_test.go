@@ -0,0 +1,33 @@
+package zfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaceholderContentsFromList(t *testing.T) {
+	c, err := placeholderContentsFromList("pool/ph", [][]string{
+		{"pool/ph", "filesystem", "24576"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, PlaceholderContents{UsedByDataset: 24576}, *c)
+	assert.False(t, c.HoldsData(1<<20))
+
+	c, err = placeholderContentsFromList("pool/ph", [][]string{
+		{"pool/ph", "filesystem", "5368709120"},
+		{"pool/ph@manual", "snapshot", "0"},
+		{"pool/ph/child", "filesystem", "24576"},
+		{"pool/ph/vol", "volume", "24576"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, PlaceholderContents{UsedByDataset: 5368709120, Snapshots: 1, Children: 2}, *c)
+	assert.True(t, c.HoldsData(1<<20))
+
+	c = &PlaceholderContents{UsedByDataset: 24576, Snapshots: 1}
+	assert.True(t, c.HoldsData(1<<20), "snapshots count as data")
+
+	_, err = placeholderContentsFromList("pool/ph", [][]string{{"pool/ph", "filesystem", "-"}})
+	assert.Error(t, err)
+}
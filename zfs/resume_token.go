@@ -50,7 +50,7 @@ func ResumeSendSupported(ctx context.Context) (bool, error) {
 		}
 		def := strings.Contains(string(output), "receive_resume_token")
 		resumeSendSupportedCheck.supported = envconst.Bool("ZREPL_EXPERIMENTAL_ZFS_SEND_RESUME_SUPPORTED", def)
-		debug("resume send feature check complete %#v", &resumeSendSupportedCheck)
+		debug(ctx, "resume send feature check complete %#v", &resumeSendSupportedCheck)
 	})
 	return resumeSendSupportedCheck.supported, resumeSendSupportedCheck.err
 }
@@ -95,7 +95,7 @@ func ResumeRecvSupported(ctx context.Context, fs *DatasetPath) (bool, error) {
 			} else {
 				sup.flagSupport.supported = strings.Contains(string(output), "-A <filesystem|volume>")
 			}
-			debug("resume recv cli flag feature check result: %#v", sup.flagSupport)
+			debug(ctx, "resume recv cli flag feature check result: %#v", sup.flagSupport)
 		})
 		// fallthrough
 	}
@@ -113,6 +113,9 @@ func ResumeRecvSupported(ctx context.Context, fs *DatasetPath) (bool, error) {
 	if err != nil {
 		return false, errors.Wrap(err, "resume recv check requires pool of dataset")
 	}
+	if err := validateDatasetOperand(pool, EntityTypeFilesystem); err != nil {
+		return false, errors.Wrap(err, "invalid pool name")
+	}
 
 	if sup.poolSupported == nil {
 		upgradeWhile(func() {
@@ -127,7 +130,7 @@ func ResumeRecvSupported(ctx context.Context, fs *DatasetPath) (bool, error) {
 
 		output, err := zfscmd.CommandContext(ctx, "zpool", "get", "-H", "-p", "-o", "value", "feature@extensible_dataset", pool).CombinedOutput()
 		if err != nil {
-			debug("resume recv pool support check result: %#v", sup.flagSupport)
+			debug(ctx, "resume recv pool support check result: %#v", sup.flagSupport)
 			poolSup.supported = false
 			poolSup.err = err
 		} else {
@@ -182,7 +185,11 @@ func ParseResumeToken(ctx context.Context, token string) (*ResumeToken, error) {
 	//	toname = pool1/test@b
 	//cannot resume send: 'pool1/test@b' used in the initial send no longer exists
 
-	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "send", "-nvt", string(token))
+	args, err := newZFSArgs("send").Flags("-n", "-v").Option("-t", token).Argv()
+	if err != nil {
+		return nil, err
+	}
+	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
@@ -264,7 +271,7 @@ func ZFSGetReceiveResumeTokenOrEmptyStringIfNotSupported(ctx context.Context, fs
 		return "", err
 	}
 	res := props.Get(prop_receive_resume_token)
-	debug("%q receive_resume_token=%q", fs.ToString(), res)
+	debug(ctx, "%q receive_resume_token=%q", fs.ToString(), res)
 	if res == "-" {
 		return "", nil
 	} else {
@@ -0,0 +1,32 @@
+package zfs
+
+import "context"
+
+const (
+	// The user property that marks a filesystem as a tombstone, i.e., a received filesystem
+	// that was renamed because its sender filesystem was destroyed.
+	// Like PlaceholderPropertyName, the property source must be local.
+	TombstonePropertyName string = "zrepl:tombstone"
+	tombstonePropertyOn   string = "on"
+	tombstonePropertyOff  string = "off"
+)
+
+func ZFSSetTombstone(ctx context.Context, p *DatasetPath, isTombstone bool) error {
+	props := NewZFSProperties()
+	prop := tombstonePropertyOff
+	if isTombstone {
+		prop = tombstonePropertyOn
+	}
+	props.Set(TombstonePropertyName, prop)
+	return zfsSet(ctx, p.ToString(), props)
+}
+
+// ZFSIsTombstone returns true if p has the TombstonePropertyName property set locally.
+// It returns a *DatasetDoesNotExist error if p does not exist.
+func ZFSIsTombstone(ctx context.Context, p *DatasetPath) (bool, error) {
+	props, err := zfsGet(ctx, p.ToString(), []string{TombstonePropertyName}, sourceLocal)
+	if err != nil {
+		return false, err
+	}
+	return props.Get(TombstonePropertyName) == tombstonePropertyOn, nil
+}
@@ -216,6 +216,9 @@ func (o *ListFilesystemVersionsOptions) matches(v FilesystemVersion) bool {
 
 // returned versions are sorted by createtxg FIXME drop sort by createtxg requirement
 func ZFSListFilesystemVersions(ctx context.Context, fs *DatasetPath, options ListFilesystemVersionsOptions) (res []FilesystemVersion, err error) {
+	if err := validateDatasetOperand(fs.ToString(), EntityTypeFilesystem); err != nil {
+		return nil, err
+	}
 	listResults := make(chan ZFSListResult)
 
 	promTimer := prometheus.NewTimer(prom.ZFSListFilesystemVersionDuration.WithLabelValues(fs.ToString()))
@@ -266,6 +269,67 @@ func ZFSListFilesystemVersions(ctx context.Context, fs *DatasetPath, options Lis
 	return
 }
 
+// ZFSListFilesystemVersionsRecursive lists the versions of root and all filesystems and volumes below it
+// with a single `zfs list` invocation.
+// The result has an entry for each of these datasets, including those without versions,
+// and each entry is sorted by createtxg.
+func ZFSListFilesystemVersionsRecursive(ctx context.Context, root *DatasetPath, options ListFilesystemVersionsOptions) (map[string][]FilesystemVersion, error) {
+	if err := validateDatasetOperand(root.ToString(), EntityTypeFilesystem); err != nil {
+		return nil, err
+	}
+	listResults := make(chan ZFSListResult)
+
+	promTimer := prometheus.NewTimer(prom.ZFSListFilesystemVersionDuration.WithLabelValues(root.ToString()))
+	defer promTimer.ObserveDuration()
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	defer wg.Wait()
+	defer cancel()
+	go func() {
+		defer wg.Done()
+		ZFSListChan(ctx, listResults,
+			[]string{"name", "guid", "createtxg", "creation", "userrefs"},
+			root,
+			"-r",
+			"-t", "filesystem,volume,"+options.typesFlagArgs(),
+			"-s", "createtxg", root.ToString())
+	}()
+
+	res := make(map[string][]FilesystemVersion)
+	for listResult := range listResults {
+		if listResult.Err != nil {
+			return nil, listResult.Err
+		}
+		line := listResult.Fields
+		if !strings.ContainsAny(line[0], "@#") {
+			if _, ok := res[line[0]]; !ok {
+				res[line[0]] = make([]FilesystemVersion, 0)
+			}
+			continue
+		}
+		fs, _, _, err := DecomposeVersionString(line[0])
+		if err != nil {
+			return nil, err
+		}
+		v, err := ParseFilesystemVersion(ParseFilesystemVersionArgs{
+			fullname:  line[0],
+			guid:      line[1],
+			createtxg: line[2],
+			creation:  line[3],
+			userrefs:  line[4],
+		})
+		if err != nil {
+			return nil, err
+		}
+		if options.matches(v) {
+			res[fs] = append(res[fs], v)
+		}
+	}
+	return res, nil
+}
+
 func ZFSGetFilesystemVersion(ctx context.Context, ds string) (v FilesystemVersion, _ error) {
 	props, err := zfsGet(ctx, ds, []string{"createtxg", "guid", "creation", "userrefs"}, sourceAny)
 	if err != nil {
@@ -72,7 +72,7 @@ func doDestroy(ctx context.Context, reqs []*DestroySnapOp, e destroyer) {
 
 	commaSupported, err := e.DestroySnapshotsCommaSyntaxSupported(ctx)
 	if err != nil {
-		debug("destroy: comma syntax support detection failed: %s", err)
+		debug(ctx, "destroy: comma syntax support detection failed: %s", err)
 		setDestroySnapOpErr(reqs, err)
 		return
 	}
@@ -159,7 +159,7 @@ func doDestroyBatchedRec(ctx context.Context, fsbatch []*DestroySnapOp, d destro
 	if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.E2BIG {
 		// see TestExcessiveArgumentsResultInE2BIG
 		// try halving batch size, assuming snapshots names are roughly the same length
-		debug("batch destroy: E2BIG encountered: %s", err)
+		debug(ctx, "batch destroy: E2BIG encountered: %s", err)
 		doDestroyBatchedRec(ctx, fsbatch[0:len(fsbatch)/2], d)
 		doDestroyBatchedRec(ctx, fsbatch[len(fsbatch)/2:], d)
 		return
@@ -228,12 +228,12 @@ func (d destroyerImpl) DestroySnapshotsCommaSyntaxSupported(ctx context.Context)
 		cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "destroy")
 		output, err := cmd.CombinedOutput()
 		if _, ok := err.(*exec.ExitError); !ok {
-			debug("destroy feature check failed: %T %s", err, err)
+			debug(ctx, "destroy feature check failed: %T %s", err, err)
 			batchDestroyFeatureCheck.err = err
 		}
 		def := strings.Contains(string(output), "<filesystem|volume>@<snap>[%<snap>][,...]")
 		batchDestroyFeatureCheck.enable = envconst.Bool("ZREPL_EXPERIMENTAL_ZFS_COMMA_SYNTAX_SUPPORTED", def)
-		debug("destroy feature check complete %#v", &batchDestroyFeatureCheck)
+		debug(ctx, "destroy feature check complete %#v", &batchDestroyFeatureCheck)
 	})
 	return batchDestroyFeatureCheck.enable, batchDestroyFeatureCheck.err
 }
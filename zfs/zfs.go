@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -29,131 +28,6 @@ var (
 	ZFSRecvPipeCapacityHint = int(envconst.Int64("ZFS_RECV_PIPE_CAPACITY_HINT", 1<<25))
 )
 
-type DatasetPath struct {
-	comps []string
-}
-
-func (p *DatasetPath) ToString() string {
-	return strings.Join(p.comps, "/")
-}
-
-func (p *DatasetPath) Empty() bool {
-	return len(p.comps) == 0
-}
-
-func (p *DatasetPath) Extend(extend *DatasetPath) {
-	p.comps = append(p.comps, extend.comps...)
-}
-
-func (p *DatasetPath) HasPrefix(prefix *DatasetPath) bool {
-	if len(prefix.comps) > len(p.comps) {
-		return false
-	}
-	for i := range prefix.comps {
-		if prefix.comps[i] != p.comps[i] {
-			return false
-		}
-	}
-	return true
-}
-
-func (p *DatasetPath) TrimPrefix(prefix *DatasetPath) {
-	if !p.HasPrefix(prefix) {
-		return
-	}
-	prelen := len(prefix.comps)
-	newlen := len(p.comps) - prelen
-	oldcomps := p.comps
-	p.comps = make([]string, newlen)
-	for i := 0; i < newlen; i++ {
-		p.comps[i] = oldcomps[prelen+i]
-	}
-}
-
-func (p *DatasetPath) TrimNPrefixComps(n int) {
-	if len(p.comps) < n {
-		n = len(p.comps)
-	}
-	if n == 0 {
-		return
-	}
-	p.comps = p.comps[n:]
-
-}
-
-func (p DatasetPath) Equal(q *DatasetPath) bool {
-	if len(p.comps) != len(q.comps) {
-		return false
-	}
-	for i := range p.comps {
-		if p.comps[i] != q.comps[i] {
-			return false
-		}
-	}
-	return true
-}
-
-func (p *DatasetPath) Length() int {
-	return len(p.comps)
-}
-
-func (p *DatasetPath) Copy() (c *DatasetPath) {
-	c = &DatasetPath{}
-	c.comps = make([]string, len(p.comps))
-	copy(c.comps, p.comps)
-	return
-}
-
-func (p *DatasetPath) MarshalJSON() ([]byte, error) {
-	return json.Marshal(p.comps)
-}
-
-func (p *DatasetPath) UnmarshalJSON(b []byte) error {
-	p.comps = make([]string, 0)
-	return json.Unmarshal(b, &p.comps)
-}
-
-func (p *DatasetPath) Pool() (string, error) {
-	if len(p.comps) < 1 {
-		return "", fmt.Errorf("dataset path does not have a pool component")
-	}
-	return p.comps[0], nil
-
-}
-
-func NewDatasetPath(s string) (p *DatasetPath, err error) {
-	p = &DatasetPath{}
-	if s == "" {
-		p.comps = make([]string, 0)
-		return p, nil // the empty dataset path
-	}
-	const FORBIDDEN = "@#|\t<>*"
-	/* Documentation of allowed characters in zfs names:
-	https://docs.oracle.com/cd/E19253-01/819-5461/gbcpt/index.html
-	Space is missing in the oracle list, but according to
-	https://github.com/zfsonlinux/zfs/issues/439
-	there is evidence that it was intentionally allowed
-	*/
-	if strings.ContainsAny(s, FORBIDDEN) {
-		err = fmt.Errorf("contains forbidden characters (any of '%s')", FORBIDDEN)
-		return
-	}
-	p.comps = strings.Split(s, "/")
-	if p.comps[len(p.comps)-1] == "" {
-		err = fmt.Errorf("must not end with a '/'")
-		return
-	}
-	return
-}
-
-func toDatasetPath(s string) *DatasetPath {
-	p, err := NewDatasetPath(s)
-	if err != nil {
-		panic(err)
-	}
-	return p
-}
-
 type ZFSError struct {
 	Stderr  []byte
 	WaitErr error
@@ -165,12 +39,17 @@ func (e *ZFSError) Error() string {
 
 var ZFS_BINARY string = "zfs"
 
+// zfsArgs are appended to the zfs list command line as is,
+// callers must validate dataset operands using validateDatasetOperand.
 func ZFSList(ctx context.Context, properties []string, zfsArgs ...string) (res [][]string, err error) {
 
-	args := make([]string, 0, 4+len(zfsArgs))
-	args = append(args,
-		"list", "-H", "-p",
-		"-o", strings.Join(properties, ","))
+	args, err := newZFSArgs("list").
+		Flags("-H", "-p").
+		Option("-o", strings.Join(properties, ",")).
+		Argv()
+	if err != nil {
+		return nil, err
+	}
 	args = append(args, zfsArgs...)
 
 	ctx, cancel := context.WithCancel(ctx)
@@ -233,15 +112,11 @@ type ZFSListResult struct {
 //
 // However, if callers do not drain `out` or cancel via `ctx`, the process will leak either running because
 // IO is pending or as a zombie.
+//
+// As for ZFSList, callers must validate dataset operands in zfsArgs using validateDatasetOperand.
 func ZFSListChan(ctx context.Context, out chan ZFSListResult, properties []string, notExistHint *DatasetPath, zfsArgs ...string) {
 	defer close(out)
 
-	args := make([]string, 0, 4+len(zfsArgs))
-	args = append(args,
-		"list", "-H", "-p",
-		"-o", strings.Join(properties, ","))
-	args = append(args, zfsArgs...)
-
 	sendResult := func(fields []string, err error) (done bool) {
 		select {
 		case <-ctx.Done():
@@ -251,6 +126,16 @@ func ZFSListChan(ctx context.Context, out chan ZFSListResult, properties []strin
 		}
 	}
 
+	args, err := newZFSArgs("list").
+		Flags("-H", "-p").
+		Option("-o", strings.Join(properties, ",")).
+		Argv()
+	if err != nil {
+		sendResult(nil, err)
+		return
+	}
+	args = append(args, zfsArgs...)
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
@@ -329,42 +214,36 @@ func absVersion(fs string, v *ZFSSendArgVersion) (full string, err error) {
 // a must already be validated
 //
 // SECURITY SENSITIVE because Raw must be handled correctly
-func (a ZFSSendArgsUnvalidated) buildCommonSendArgs() ([]string, error) {
+func (a ZFSSendArgsUnvalidated) buildCommonSendArgs(args *zfsArgs) error {
 
-	args := make([]string, 0, 3)
 	// ResumeToken takes precedence, we assume that it has been validated to reflect
 	// what is described by the other fields in ZFSSendArgs
 	if a.ResumeToken != "" {
-		args = append(args, "-t", a.ResumeToken)
-		return args, nil
+		args.Option("-t", a.ResumeToken)
+		return nil
 	}
 
 	if a.Encrypted.B {
-		args = append(args, "-w")
+		args.Flags("-w")
 	}
 
 	toV, err := absVersion(a.FS, a.To)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	fromV := ""
 	if a.From != nil {
-		fromV, err = absVersion(a.FS, a.From)
+		fromV, err := absVersion(a.FS, a.From)
 		if err != nil {
-			return nil, err
+			return err
 		}
+		args.Option("-i", fromV)
 	}
-
-	if fromV == "" { // Initial
-		args = append(args, toV)
-	} else {
-		args = append(args, "-i", fromV, toV)
-	}
-	return args, nil
+	args.Dataset(toV, entityTypeOfName(toV))
+	return nil
 }
 
-func pipeWithCapacityHint(capacity int) (r, w *os.File, err error) {
+func pipeWithCapacityHint(ctx context.Context, capacity int) (r, w *os.File, err error) {
 	if capacity <= 0 {
 		panic(fmt.Sprintf("capacity must be positive %v", capacity))
 	}
@@ -372,11 +251,12 @@ func pipeWithCapacityHint(capacity int) (r, w *os.File, err error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	trySetPipeCapacity(stdoutWriter, capacity)
+	trySetPipeCapacity(ctx, stdoutWriter, capacity)
 	return stdoutReader, stdoutWriter, nil
 }
 
 type SendStream struct {
+	ctx  context.Context // for logging
 	cmd  *zfscmd.Cmd
 	kill context.CancelFunc
 
@@ -396,11 +276,11 @@ func (s *SendStream) Read(p []byte) (n int, err error) {
 
 	n, err = s.stdoutReader.Read(p)
 	if err != nil {
-		debug("sendStream: read err: %T %s", err, err)
+		debug(s.ctx, "sendStream: read err: %T %s", err, err)
 		// TODO we assume here that any read error is permanent
 		// which is most likely the case for a local zfs send
 		kwerr := s.killAndWait(err)
-		debug("sendStream: killAndWait n=%v err= %T %s", n, kwerr, kwerr)
+		debug(s.ctx, "sendStream: killAndWait n=%v err= %T %s", n, kwerr, kwerr)
 		// TODO we assume here that any read error is permanent
 		return n, kwerr
 	}
@@ -408,14 +288,14 @@ func (s *SendStream) Read(p []byte) (n int, err error) {
 }
 
 func (s *SendStream) Close() error {
-	debug("sendStream: close called")
+	debug(s.ctx, "sendStream: close called")
 	return s.killAndWait(nil)
 }
 
 func (s *SendStream) killAndWait(precedingReadErr error) error {
 
-	debug("sendStream: killAndWait enter")
-	defer debug("sendStream: killAndWait leave")
+	debug(s.ctx, "sendStream: killAndWait enter")
+	defer debug(s.ctx, "sendStream: killAndWait leave")
 	if precedingReadErr == io.EOF {
 		// give the zfs process a little bit of time to terminate itself
 		// if it holds this deadline, exitErr will be nil
@@ -716,9 +596,9 @@ func (a ZFSSendArgsUnvalidated) validateCorrespondsToResumeToken(ctx context.Con
 		return nil // nothing to do
 	}
 
-	debug("decoding resume token %q", a.ResumeToken)
+	debug(ctx, "decoding resume token %q", a.ResumeToken)
 	t, err := ParseResumeToken(ctx, a.ResumeToken)
-	debug("decode resume token result: %#v %T %v", t, err, err)
+	debug(ctx, "decode resume token result: %#v %T %v", t, err, err)
 	if err != nil {
 		return err
 	}
@@ -785,9 +665,6 @@ var ErrEncryptedSendNotSupported = fmt.Errorf("raw sends which are required for
 // Returns ErrEncryptedSendNotSupported if encrypted send is requested but not supported by CLI
 func ZFSSend(ctx context.Context, sendArgs ZFSSendArgsValidated) (*SendStream, error) {
 
-	args := make([]string, 0)
-	args = append(args, "send")
-
 	// pre-validation of sendArgs for plain ErrEncryptedSendNotSupported error
 	// TODO go1.13: push this down to sendArgs.Validate
 	if encryptedSendValid := sendArgs.Encrypted.Validate(); encryptedSendValid == nil && sendArgs.Encrypted.B {
@@ -800,23 +677,26 @@ func ZFSSend(ctx context.Context, sendArgs ZFSSendArgsValidated) (*SendStream, e
 		}
 	}
 
-	sargs, err := sendArgs.buildCommonSendArgs()
+	sargs := newZFSArgs("send")
+	if err := sendArgs.buildCommonSendArgs(sargs); err != nil {
+		return nil, err
+	}
+	args, err := sargs.Argv()
 	if err != nil {
 		return nil, err
 	}
-	args = append(args, sargs...)
 
 	ctx, cancel := context.WithCancel(ctx)
 
 	// setup stdout with an os.Pipe to control pipe buffer size
-	stdoutReader, stdoutWriter, err := pipeWithCapacityHint(ZFSSendPipeCapacityHint)
+	stdoutReader, stdoutWriter, err := pipeWithCapacityHint(ctx, ZFSSendPipeCapacityHint)
 	if err != nil {
 		cancel()
 		return nil, err
 	}
 	stderrBuf := circlog.MustNewCircularLog(zfsSendStderrCaptureMaxSize)
 
-	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
+	cmd := zfscmd.PrioritizedCommandContext(ctx, ZFS_BINARY, args...)
 	cmd.SetStdio(zfscmd.Stdio{
 		Stdin:  nil,
 		Stdout: stdoutWriter,
@@ -833,6 +713,7 @@ func ZFSSend(ctx context.Context, sendArgs ZFSSendArgsValidated) (*SendStream, e
 	stdoutWriter.Close()
 
 	stream := &SendStream{
+		ctx:          ctx,
 		cmd:          cmd,
 		kill:         cancel,
 		stdoutReader: stdoutReader,
@@ -864,7 +745,10 @@ type DrySendInfo struct {
 	Type         DrySendType
 	Filesystem   string // parsed from To field
 	From, To     string // direct copy from ZFS output
-	SizeEstimate int64  // -1 if size estimate is not possible
+	SizeEstimate int64  // size of the send stream, -1 if size estimate is not possible
+	// Size of the sent data uncompressed (logical) and as stored with the compression of To (physical).
+	// -1 if the estimate is not possible.
+	LogicalSizeEstimate, PhysicalSizeEstimate int64
 }
 
 var (
@@ -873,23 +757,61 @@ var (
 	sendDryRunInfoLineRegexFull = regexp.MustCompile(`^(?P<type>full)\t()(?P<to>[^\t]+@[^\t]+)(\t(?P<size>[0-9]+))?$`)
 	// cannot enforce '[#@]' in incremental source, see test cases
 	sendDryRunInfoLineRegexIncremental = regexp.MustCompile(`^(?P<type>incremental)\t(?P<from>[^\t]+)\t(?P<to>[^\t]+@[^\t]+)(\t(?P<size>[0-9]+))?$`)
+	// total size of all streams, printed after the info lines
+	sendDryRunSizeLineRegex = regexp.MustCompile(`^size\t([0-9]+)$`)
 )
 
 // see test cases for example output
 func (s *DrySendInfo) unmarshalZFSOutput(output []byte) (err error) {
-	debug("DrySendInfo.unmarshalZFSOutput: output=%q", output)
 	lines := strings.Split(string(output), "\n")
+	infoLineMatched := false
 	for _, l := range lines {
+		if infoLineMatched {
+			if m := sendDryRunSizeLineRegex.FindStringSubmatch(l); m != nil {
+				// the total is authoritative, e.g., if a resume token's stream is smaller than the info line says
+				if s.SizeEstimate, err = strconv.ParseInt(m[1], 10, 64); err != nil {
+					return fmt.Errorf("line %q: cannot parse size: %s", l, err)
+				}
+			}
+			continue
+		}
 		regexMatched, err := s.unmarshalInfoLine(l)
 		if err != nil {
 			return fmt.Errorf("line %q: %s", l, err)
 		}
-		if !regexMatched {
-			continue
+		infoLineMatched = regexMatched
+	}
+	if !infoLineMatched {
+		return fmt.Errorf("no match for info line (regex1 %s) (regex2 %s)", sendDryRunInfoLineRegexFull, sendDryRunInfoLineRegexIncremental)
+	}
+	return nil
+}
+
+// setLogicalAndPhysicalSizeEstimates derives the logical and physical size estimates from the stream size estimate.
+// Raw sends transfer blocks as they are stored on disk, i.e., the stream size is the physical size,
+// other sends transfer uncompressed blocks, i.e., the stream size is the logical size.
+// compressRatio <= 0 means that the compression ratio is unknown.
+func (s *DrySendInfo) setLogicalAndPhysicalSizeEstimates(raw bool, compressRatio float64) {
+	s.LogicalSizeEstimate, s.PhysicalSizeEstimate = -1, -1
+	if s.SizeEstimate < 0 {
+		return
+	}
+	if raw {
+		s.PhysicalSizeEstimate = s.SizeEstimate
+		if compressRatio > 0 {
+			s.LogicalSizeEstimate = int64(float64(s.SizeEstimate) * compressRatio)
+		}
+	} else {
+		s.LogicalSizeEstimate = s.SizeEstimate
+		if compressRatio > 0 {
+			s.PhysicalSizeEstimate = int64(float64(s.SizeEstimate) / compressRatio)
 		}
-		return nil
 	}
-	return fmt.Errorf("no match for info line (regex1 %s) (regex2 %s)", sendDryRunInfoLineRegexFull, sendDryRunInfoLineRegexIncremental)
+}
+
+// parseCompressRatio parses the value of the compressratio property, e.g., "1.50" or "1.50x".
+func parseCompressRatio(value string) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
 }
 
 // unmarshal info line, looks like this:
@@ -965,30 +887,44 @@ func ZFSSendDry(ctx context.Context, sendArgs ZFSSendArgsValidated) (_ *DrySendI
 			return nil, fmt.Errorf("error building abs version for 'to': %s", err)
 		}
 		return &DrySendInfo{
-			Type:         DrySendTypeIncremental,
-			Filesystem:   sendArgs.FS,
-			From:         fromAbs,
-			To:           toAbs,
-			SizeEstimate: -1}, nil
+			Type:                 DrySendTypeIncremental,
+			Filesystem:           sendArgs.FS,
+			From:                 fromAbs,
+			To:                   toAbs,
+			SizeEstimate:         -1,
+			LogicalSizeEstimate:  -1,
+			PhysicalSizeEstimate: -1}, nil
 	}
 
-	args := make([]string, 0)
-	args = append(args, "send", "-n", "-v", "-P")
-	sargs, err := sendArgs.buildCommonSendArgs()
+	sargs := newZFSArgs("send").Flags("-n", "-v", "-P")
+	if err := sendArgs.buildCommonSendArgs(sargs); err != nil {
+		return nil, err
+	}
+	args, err := sargs.Argv()
 	if err != nil {
 		return nil, err
 	}
-	args = append(args, sargs...)
 
 	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return nil, &ZFSError{output, err}
 	}
+	debug(ctx, "ZFSSendDry: output=%q", output)
 	var si DrySendInfo
 	if err := si.unmarshalZFSOutput(output); err != nil {
 		return nil, fmt.Errorf("could not parse zfs send -n output: %s", err)
 	}
+
+	// the size estimates are informational, an unknown compression ratio must not fail the send
+	var compressRatio float64
+	if props, err := zfsGet(ctx, si.To, []string{"compressratio"}, sourceAny); err != nil {
+		debug(ctx, "ZFSSendDry: cannot get compressratio of %q: %s", si.To, err)
+	} else if compressRatio, err = parseCompressRatio(props.Get("compressratio")); err != nil {
+		debug(ctx, "ZFSSendDry: cannot parse compressratio of %q: %s", si.To, err)
+		compressRatio = 0
+	}
+	si.setLogicalAndPhysicalSizeEstimates(sendArgs.Encrypted.B, compressRatio)
 	return &si, nil
 }
 
@@ -1053,33 +989,35 @@ func ZFSRecv(ctx context.Context, fs string, v *ZFSSendArgVersion, stream io.Rea
 			// afterwards, `recv -F` will work
 			rollbackTarget := snaps[0]
 			rollbackTargetAbs := rollbackTarget.ToAbsPath(fsdp)
-			debug("recv: rollback to %q", rollbackTargetAbs)
+			debug(ctx, "recv: rollback to %q", rollbackTargetAbs)
 			if err := ZFSRollback(ctx, fsdp, rollbackTarget, "-r"); err != nil {
 				return fmt.Errorf("cannot rollback %s to %s for forced receive: %s", fsdp.ToString(), rollbackTarget, err)
 			}
-			debug("recv: destroy %q", rollbackTargetAbs)
+			debug(ctx, "recv: destroy %q", rollbackTargetAbs)
 			if err := ZFSDestroy(ctx, rollbackTargetAbs); err != nil {
 				return fmt.Errorf("cannot destroy %s for forced receive: %s", rollbackTargetAbs, err)
 			}
 		}
 	}
 
-	args := make([]string, 0)
-	args = append(args, "recv")
+	recvArgs := newZFSArgs("recv")
 	if opts.RollbackAndForceRecv {
-		args = append(args, "-F")
+		recvArgs.Flags("-F")
 	}
 	if opts.SavePartialRecvState {
 		if supported, err := ResumeRecvSupported(ctx, fsdp); err != nil || !supported {
 			return &ErrRecvResumeNotSupported{FS: fs, CheckErr: err}
 		}
-		args = append(args, "-s")
+		recvArgs.Flags("-s")
+	}
+	args, err := recvArgs.Dataset(v.FullPath(fs), EntityTypeSnapshot).Argv()
+	if err != nil {
+		return err
 	}
-	args = append(args, v.FullPath(fs))
 
 	ctx, cancelCmd := context.WithCancel(ctx)
 	defer cancelCmd()
-	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
+	cmd := zfscmd.PrioritizedCommandContext(ctx, ZFS_BINARY, args...)
 
 	// TODO report bug upstream
 	// Setup an unused stdout buffer.
@@ -1089,7 +1027,7 @@ func ZFSRecv(ctx context.Context, fs string, v *ZFSSendArgVersion, stream io.Rea
 
 	stderr := bytes.NewBuffer(make([]byte, 0, RecvStderrBufSiz))
 
-	stdin, stdinWriter, err := pipeWithCapacityHint(ZFSRecvPipeCapacityHint)
+	stdin, stdinWriter, err := pipeWithCapacityHint(ctx, ZFSRecvPipeCapacityHint)
 	if err != nil {
 		return err
 	}
@@ -1110,7 +1048,7 @@ func ZFSRecv(ctx context.Context, fs string, v *ZFSSendArgVersion, stream io.Rea
 
 	pid := cmd.Process().Pid
 	debug := func(format string, args ...interface{}) {
-		debug("recv: pid=%v: %s", pid, fmt.Sprintf(format, args...))
+		debug(ctx, "recv: pid=%v: %s", pid, fmt.Sprintf(format, args...))
 	}
 
 	debug("started")
@@ -1125,6 +1063,7 @@ func ZFSRecv(ctx context.Context, fs string, v *ZFSSendArgVersion, stream io.Rea
 	go func() {
 		defer close(waitErrChan)
 		if err = cmd.Wait(); err != nil {
+			debug("wait error: %s: stderr: %q", err, stderr.String())
 			if rtErr := tryRecvErrorWithResumeToken(ctx, stderr.String()); rtErr != nil {
 				waitErrChan <- rtErr
 			} else if owErr := tryRecvDestroyOrOverwriteEncryptedErr(stderr.Bytes()); owErr != nil {
@@ -1198,7 +1137,6 @@ func (e *RecvDestroyOrOverwriteEncryptedErr) Error() string {
 var recvDestroyOrOverwriteEncryptedErrRe = regexp.MustCompile(`^(cannot receive new filesystem stream: zfs receive -F cannot be used to destroy an encrypted filesystem or overwrite an unencrypted one with an encrypted one)`)
 
 func tryRecvDestroyOrOverwriteEncryptedErr(stderr []byte) *RecvDestroyOrOverwriteEncryptedErr {
-	debug("tryRecvDestroyOrOverwriteEncryptedErr: %v", stderr)
 	m := recvDestroyOrOverwriteEncryptedErrRe.FindSubmatch(stderr)
 	if m == nil {
 		return nil
@@ -1239,7 +1177,11 @@ func ZFSRecvClearResumeToken(ctx context.Context, fs string) (err error) {
 		return err
 	}
 
-	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "recv", "-A", fs)
+	args, err := newZFSArgs("recv").Flags("-A").Dataset(fs, EntityTypeFilesystem).Argv()
+	if err != nil {
+		return err
+	}
+	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
 	o, err := cmd.CombinedOutput()
 	if err != nil {
 		if bytes.Contains(o, []byte("does not have any resumable receive state to abort")) {
@@ -1266,12 +1208,12 @@ func (p *ZFSProperties) Get(key string) string {
 	return p.m[key]
 }
 
-func (p *ZFSProperties) appendArgs(args *[]string) (err error) {
+func (p *ZFSProperties) appendArgs(args *zfsArgs) (err error) {
 	for prop, val := range p.m {
 		if strings.Contains(prop, "=") {
 			return errors.New("prop contains rune '=' which is the delimiter between property name and value")
 		}
-		*args = append(*args, fmt.Sprintf("%s=%s", prop, val))
+		args.Operand(fmt.Sprintf("%s=%s", prop, val))
 	}
 	return nil
 }
@@ -1281,13 +1223,15 @@ func ZFSSet(ctx context.Context, fs *DatasetPath, props *ZFSProperties) (err err
 }
 
 func zfsSet(ctx context.Context, path string, props *ZFSProperties) (err error) {
-	args := make([]string, 0)
-	args = append(args, "set")
-	err = props.appendArgs(&args)
+	setArgs := newZFSArgs("set")
+	err = props.appendArgs(setArgs)
+	if err != nil {
+		return err
+	}
+	args, err := setArgs.Dataset(path, entityTypeOfName(path)).Argv()
 	if err != nil {
 		return err
 	}
-	args = append(args, path)
 
 	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
 	stdio, err := cmd.CombinedOutput()
@@ -1329,6 +1273,24 @@ func ZFSGetGUID(ctx context.Context, fs string, version string) (g uint64, err e
 	return strconv.ParseUint(props.Get("guid"), 10, 64)
 }
 
+// ZFSGetSnapshotWritten returns the snapshot's `written` property,
+// i.e., the amount of referenced data written to fs between the previous snapshot and fs@snapshot.
+func ZFSGetSnapshotWritten(ctx context.Context, fs string, snapshot string) (uint64, error) {
+	if err := validateZFSFilesystem(fs); err != nil {
+		return 0, err
+	}
+	path := fmt.Sprintf("%s@%s", fs, snapshot)
+	props, err := zfsGet(ctx, path, []string{"written"}, sourceAny)
+	if err != nil {
+		return 0, err
+	}
+	written, err := strconv.ParseUint(props.Get("written"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("zfs get written %q: %s", path, err)
+	}
+	return written, nil
+}
+
 type GetMountpointOutput struct {
 	Mounted    bool
 	Mountpoint string
@@ -1415,7 +1377,15 @@ func (s zfsPropertySource) zfsGetSourceFieldPrefixes() []string {
 }
 
 func zfsGet(ctx context.Context, path string, props []string, allowedSources zfsPropertySource) (*ZFSProperties, error) {
-	args := []string{"get", "-Hp", "-o", "property,value,source", strings.Join(props, ","), path}
+	args, err := newZFSArgs("get").
+		Flags("-Hp").
+		Option("-o", "property,value,source").
+		Operand(strings.Join(props, ",")).
+		Dataset(path, entityTypeOfName(path)).
+		Argv()
+	if err != nil {
+		return nil, err
+	}
 	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
 	stdout, err := cmd.Output()
 	if err != nil {
@@ -1460,6 +1430,74 @@ func zfsGet(ctx context.Context, path string, props []string, allowedSources zfs
 	return res, nil
 }
 
+// ZFSGetRecursive returns the effective values of props for roots and all their descendant filesystems and volumes,
+// indexed by dataset name and property, using a single zfs get -r invocation.
+// Roots that are descendants of other roots are redundant and not passed to zfs get.
+func ZFSGetRecursive(ctx context.Context, roots []*DatasetPath, props []string) (map[string]map[string]string, error) {
+	res := make(map[string]map[string]string)
+	roots = minimalRoots(roots)
+	if len(roots) == 0 {
+		return res, nil
+	}
+	b := newZFSArgs("get").
+		Flags("-Hpr").
+		Option("-t", "filesystem,volume").
+		Option("-o", "name,property,value").
+		Operand(strings.Join(props, ","))
+	for _, r := range roots {
+		b = b.Dataset(r.ToString(), EntityTypeFilesystem)
+	}
+	args, err := b.Argv()
+	if err != nil {
+		return nil, err
+	}
+	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
+	stdout, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, &ZFSError{
+				Stderr:  exitErr.Stderr,
+				WaitErr: exitErr,
+			}
+		}
+		return nil, err
+	}
+	for _, line := range strings.Split(string(stdout), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("zfs get did not return name,property,value tuples")
+		}
+		m, ok := res[fields[0]]
+		if !ok {
+			m = make(map[string]string, len(props))
+			res[fields[0]] = m
+		}
+		m[fields[1]] = fields[2]
+	}
+	return res, nil
+}
+
+// minimalRoots returns the paths in ps that are not descendants of (or equal to) another path in ps.
+func minimalRoots(ps []*DatasetPath) []*DatasetPath {
+	sorted := make([]*DatasetPath, len(ps))
+	copy(sorted, ps)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Length() < sorted[j].Length() })
+	var roots []*DatasetPath
+outer:
+	for _, p := range sorted {
+		for _, r := range roots {
+			if p.HasPrefix(r) {
+				continue outer
+			}
+		}
+		roots = append(roots, p)
+	}
+	return roots
+}
+
 type DestroySnapshotsError struct {
 	RawLines      []string
 	Filesystem    string
@@ -1524,6 +1562,21 @@ func tryParseDestroySnapshotsError(arg string, stderr []byte) *DestroySnapshotsE
 	}
 }
 
+// destroyArgs returns the arguments of zfs destroy for arg, which is the name of a dataset
+// or a snapshot list in comma syntax (pool/fs@snap1,snap2), see doDestroyBatched.
+func destroyArgs(arg string) ([]string, error) {
+	idx := strings.IndexByte(arg, '@')
+	if idx == -1 {
+		return newZFSArgs("destroy").Dataset(arg, entityTypeOfName(arg)).Argv()
+	}
+	for _, snap := range strings.Split(arg[idx+1:], ",") {
+		if err := validateDatasetOperand(arg[:idx+1]+snap, EntityTypeSnapshot); err != nil {
+			return nil, fmt.Errorf("invalid argument %q for zfs destroy: %s", arg, err)
+		}
+	}
+	return newZFSArgs("destroy").Operand(arg).Argv()
+}
+
 func ZFSDestroy(ctx context.Context, arg string) (err error) {
 
 	var dstype, filesystem string
@@ -1543,7 +1596,11 @@ func ZFSDestroy(ctx context.Context, arg string) (err error) {
 
 	defer prometheus.NewTimer(prom.ZFSDestroyDuration.WithLabelValues(dstype, filesystem))
 
-	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "destroy", arg)
+	args, err := destroyArgs(arg)
+	if err != nil {
+		return err
+	}
+	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
 	stdio, err := cmd.CombinedOutput()
 	if err != nil {
 		err = &ZFSError{
@@ -1575,6 +1632,26 @@ func ZFSDestroyIdempotent(ctx context.Context, path string) error {
 	return err
 }
 
+// ZFSDestroyFilesystemRecursive destroys fs, its children and all their snapshots and bookmarks (zfs destroy -r).
+// Snapshots with holds make it fail.
+func ZFSDestroyFilesystemRecursive(ctx context.Context, fs *DatasetPath) error {
+	defer prometheus.NewTimer(prom.ZFSDestroyDuration.WithLabelValues("filesystem", fs.ToString())).ObserveDuration()
+
+	args, err := newZFSArgs("destroy").Flags("-r").Dataset(fs.ToString(), EntityTypeFilesystem).Argv()
+	if err != nil {
+		return err
+	}
+	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
+	stdio, err := cmd.CombinedOutput()
+	if err != nil {
+		if ddne := tryDatasetDoesNotExist(fs.ToString(), stdio); ddne != nil {
+			return ddne
+		}
+		return &ZFSError{Stderr: stdio, WaitErr: err}
+	}
+	return nil
+}
+
 func ZFSSnapshot(ctx context.Context, fs *DatasetPath, name string, recursive bool) (err error) {
 
 	promTimer := prometheus.NewTimer(prom.ZFSSnapshotDuration.WithLabelValues(fs.ToString()))
@@ -1585,7 +1662,11 @@ func ZFSSnapshot(ctx context.Context, fs *DatasetPath, name string, recursive bo
 		return errors.Wrap(err, "zfs snapshot")
 	}
 
-	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "snapshot", snapname)
+	args, err := newZFSArgs("snapshot").Dataset(snapname, EntityTypeSnapshot).Argv()
+	if err != nil {
+		return err
+	}
+	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
 	stdio, err := cmd.CombinedOutput()
 	if err != nil {
 		err = &ZFSError{
@@ -1660,7 +1741,14 @@ func ZFSBookmark(ctx context.Context, fs string, v FilesystemVersion, bookmark s
 		return bm, err
 	}
 
-	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "bookmark", snapname, bookmarkname)
+	args, err := newZFSArgs("bookmark").
+		Dataset(snapname, EntityTypeSnapshot).
+		Dataset(bookmarkname, EntityTypeBookmark).
+		Argv()
+	if err != nil {
+		return bm, err
+	}
+	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
 	stdio, err := cmd.CombinedOutput()
 	if err != nil {
 		if ddne := tryDatasetDoesNotExist(snapname, stdio); ddne != nil {
@@ -1674,7 +1762,7 @@ func ZFSBookmark(ctx context.Context, fs string, v FilesystemVersion, bookmark s
 			}
 
 			if v.Guid == bookGuid {
-				debug("bookmark: %q %q was idempotent: {snap,book}guid %d == %d", snapname, bookmarkname, v.Guid, bookGuid)
+				debug(ctx, "bookmark: %q %q was idempotent: {snap,book}guid %d == %d", snapname, bookmarkname, v.Guid, bookGuid)
 				return bm, nil
 			}
 			return bm, &BookmarkExists{
@@ -1702,9 +1790,10 @@ func ZFSRollback(ctx context.Context, fs *DatasetPath, snapshot FilesystemVersio
 		return fmt.Errorf("can only rollback to snapshots, got %s", snapabs)
 	}
 
-	args := []string{"rollback"}
-	args = append(args, rollbackArgs...)
-	args = append(args, snapabs)
+	args, err := newZFSArgs("rollback").Flags(rollbackArgs...).Dataset(snapabs, EntityTypeSnapshot).Argv()
+	if err != nil {
+		return err
+	}
 
 	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
 	stdio, err := cmd.CombinedOutput()
@@ -1717,3 +1806,28 @@ func ZFSRollback(ctx context.Context, fs *DatasetPath, snapshot FilesystemVersio
 
 	return err
 }
+
+// ZFSRename renames filesystem from to to. The parent of to must exist.
+func ZFSRename(ctx context.Context, from, to *DatasetPath) (err error) {
+	if from.Empty() || to.Empty() {
+		return fmt.Errorf("cannot rename from or to empty path")
+	}
+
+	args, err := newZFSArgs("rename").
+		Dataset(from.ToString(), EntityTypeFilesystem).
+		Dataset(to.ToString(), EntityTypeFilesystem).
+		Argv()
+	if err != nil {
+		return err
+	}
+	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
+	stdio, err := cmd.CombinedOutput()
+	if err != nil {
+		err = &ZFSError{
+			Stderr:  stdio,
+			WaitErr: err,
+		}
+	}
+
+	return err
+}
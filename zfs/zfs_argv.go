@@ -0,0 +1,132 @@
+package zfs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// zfsArgs builds the argument vector of a zfs command.
+//
+// zfs parses its arguments with getopt(3), which, on glibc, also parses
+// arguments after the first operand as options. An operand that starts
+// with '-', e.g. a snapshot named `-r` sent by an RPC peer, would thus
+// change the semantics of the command. Hence, zfsArgs distinguishes
+//
+//   - flags, which must be string literals in zrepl's code (misuse panics),
+//   - option arguments, which getopt never parses as options,
+//   - operands, which are validated so that they cannot be parsed as options.
+//
+// Each argument is passed to the command as a single argv element,
+// it is never split at whitespace (which is valid in ZFS names).
+// The first validation error is returned by Argv.
+type zfsArgs struct {
+	subcommand string
+	argv       []string
+	err        error
+}
+
+func newZFSArgs(subcommand string) *zfsArgs {
+	return &zfsArgs{subcommand: subcommand, argv: []string{subcommand}}
+}
+
+func (a *zfsArgs) fail(arg string, err error) {
+	if a.err == nil {
+		a.err = fmt.Errorf("invalid argument %q for zfs %s: %s", arg, a.subcommand, err)
+	}
+}
+
+func mustBeFlag(f string) {
+	if len(f) < 2 || f[0] != '-' || strings.ContainsAny(f, " \t\n\x00") {
+		panic(fmt.Sprintf("implementation error: %q is not a flag", f))
+	}
+}
+
+// Flags appends flags such as `-r` or `-Hp`.
+func (a *zfsArgs) Flags(flags ...string) *zfsArgs {
+	for _, f := range flags {
+		mustBeFlag(f)
+	}
+	a.argv = append(a.argv, flags...)
+	return a
+}
+
+// Option appends flag and its argument value, e.g. `-o name=value` or `-t TOKEN`.
+func (a *zfsArgs) Option(flag, value string) *zfsArgs {
+	mustBeFlag(flag)
+	if err := validateArgChars(value); err != nil {
+		a.fail(value, err)
+	}
+	a.argv = append(a.argv, flag, value)
+	return a
+}
+
+// Operand appends an operand that is not a dataset name, e.g. a hold tag.
+func (a *zfsArgs) Operand(op string) *zfsArgs {
+	if err := validateOperand(op); err != nil {
+		a.fail(op, err)
+	}
+	a.argv = append(a.argv, op)
+	return a
+}
+
+// Dataset appends the name of a dataset of type t as an operand.
+func (a *zfsArgs) Dataset(name string, t EntityType) *zfsArgs {
+	if err := validateDatasetOperand(name, t); err != nil {
+		a.fail(name, err)
+	}
+	a.argv = append(a.argv, name)
+	return a
+}
+
+// Argv returns the arguments appended so far or the first validation error.
+func (a *zfsArgs) Argv() ([]string, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	return a.argv, nil
+}
+
+func validateArgChars(arg string) error {
+	if arg == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	if strings.IndexByte(arg, 0) != -1 {
+		return fmt.Errorf("must not contain NUL bytes")
+	}
+	return nil
+}
+
+func validateOperand(op string) error {
+	if err := validateArgChars(op); err != nil {
+		return err
+	}
+	if op[0] == '-' {
+		return fmt.Errorf("must not start with '-'")
+	}
+	return nil
+}
+
+// validateDatasetOperand validates name for use as an operand of a zfs command.
+// Callers that pass operands to ZFSList or ZFSListChan must validate them with this function.
+func validateDatasetOperand(name string, t EntityType) error {
+	if err := validateOperand(name); err != nil {
+		return err
+	}
+	if err := EntityNamecheck(name, t); err != nil {
+		return err
+	}
+	return nil
+}
+
+// entityTypeOfName returns the EntityType indicated by the delimiter in name.
+// Filesystems and volumes are not distinguished.
+func entityTypeOfName(name string) EntityType {
+	switch {
+	case strings.Contains(name, "@"):
+		return EntityTypeSnapshot
+	case strings.Contains(name, "#"):
+		return EntityTypeBookmark
+	default:
+		return EntityTypeFilesystem
+	}
+}
@@ -0,0 +1,94 @@
+package zfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZFSArgsRejectsOperandsThatLookLikeFlags(t *testing.T) {
+	_, err := newZFSArgs("hold").Operand("-r").Dataset("pool/foo@snap", EntityTypeSnapshot).Argv()
+	assert.Error(t, err)
+
+	_, err = newZFSArgs("rename").Dataset("-p", EntityTypeFilesystem).Dataset("pool/bar", EntityTypeFilesystem).Argv()
+	assert.Error(t, err)
+
+	_, err = newZFSArgs("rollback").Dataset("-r@snap", EntityTypeSnapshot).Argv()
+	assert.Error(t, err)
+
+	_, err = newZFSArgs("get").Operand("").Argv()
+	assert.Error(t, err)
+
+	_, err = newZFSArgs("get").Operand("foo\x00bar").Argv()
+	assert.Error(t, err)
+
+	// option arguments are never parsed as flags
+	argv, err := newZFSArgs("send").Option("-t", "-R").Argv()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"send", "-t", "-R"}, argv)
+}
+
+func TestZFSArgsFlagsMustBeLiterals(t *testing.T) {
+	assert.Panics(t, func() { newZFSArgs("rollback").Flags("r") })
+	assert.Panics(t, func() { newZFSArgs("rollback").Flags("-r -R") })
+	assert.Panics(t, func() { newZFSArgs("rollback").Flags("-") })
+	assert.Panics(t, func() { newZFSArgs("get").Option("o", "name") })
+}
+
+func TestZFSArgsDoNotSplitWhitespace(t *testing.T) {
+	argv, err := newZFSArgs("snapshot").Dataset("pool/foo bar@-r -R", EntityTypeSnapshot).Argv()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"snapshot", "pool/foo bar@-r -R"}, argv)
+}
+
+func TestZFSArgsHostileNamesInCommands(t *testing.T) {
+	t.Run("destroy", func(t *testing.T) {
+		argv, err := destroyArgs("pool/foo@-R")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"destroy", "pool/foo@-R"}, argv)
+
+		argv, err = destroyArgs("pool/foo@a,-R,b")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"destroy", "pool/foo@a,-R,b"}, argv)
+
+		for _, hostile := range []string{"-R", "-r pool", "pool/foo@a,b/c", "pool/foo@a,,b", "pool/foo@a,b@c", "pool/foo@a%b"} {
+			_, err := destroyArgs(hostile)
+			assert.Error(t, err, hostile)
+		}
+	})
+
+	t.Run("send", func(t *testing.T) {
+		sendArgs := ZFSSendArgsUnvalidated{
+			FS:        "pool/foo",
+			From:      &ZFSSendArgVersion{RelName: "#-R"},
+			To:        &ZFSSendArgVersion{RelName: "@-D"},
+			Encrypted: &NilBool{B: true},
+		}
+		args := newZFSArgs("send")
+		require.NoError(t, sendArgs.buildCommonSendArgs(args))
+		argv, err := args.Argv()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"send", "-w", "-i", "pool/foo#-R", "pool/foo@-D"}, argv)
+
+		sendArgs.FS = "-R"
+		args = newZFSArgs("send")
+		require.NoError(t, sendArgs.buildCommonSendArgs(args))
+		_, err = args.Argv()
+		assert.Error(t, err)
+	})
+}
+
+func TestCloneArgs(t *testing.T) {
+	clone, err := NewDatasetPath("pool/restore/a")
+	require.NoError(t, err)
+	props := NewZFSProperties()
+	props.Set("readonly", "on")
+	props.Set("canmount", "noauto")
+	argv, err := cloneArgs("pool/a@snap", clone, props)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"clone", "-p", "-o", "canmount=noauto", "-o", "readonly=on", "pool/a@snap", "pool/restore/a"}, argv)
+
+	_, err = cloneArgs("pool/a", clone, nil)
+	assert.Error(t, err, "origin must be a snapshot")
+}
@@ -0,0 +1,48 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/zfs/zfscmd"
+)
+
+func cloneArgs(snapshot string, clone *DatasetPath, props *ZFSProperties) ([]string, error) {
+	args := newZFSArgs("clone").Flags("-p")
+	if props != nil {
+		names := make([]string, 0, len(props.m))
+		for prop := range props.m {
+			names = append(names, prop)
+		}
+		sort.Strings(names)
+		for _, prop := range names {
+			if strings.Contains(prop, "=") {
+				return nil, errors.New("prop contains rune '=' which is the delimiter between property name and value")
+			}
+			args.Option("-o", fmt.Sprintf("%s=%s", prop, props.m[prop]))
+		}
+	}
+	return args.Dataset(snapshot, EntityTypeSnapshot).Dataset(clone.ToString(), EntityTypeFilesystem).Argv()
+}
+
+// ZFSClone creates clone from snapshot with `zfs clone -p`, i.e., including missing parent filesystems.
+// props may be nil.
+func ZFSClone(ctx context.Context, snapshot string, clone *DatasetPath, props *ZFSProperties) error {
+	args, err := cloneArgs(snapshot, clone, props)
+	if err != nil {
+		return err
+	}
+	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
+	stdio, err := cmd.CombinedOutput()
+	if err != nil {
+		return &ZFSError{
+			Stderr:  stdio,
+			WaitErr: err,
+		}
+	}
+	return nil
+}
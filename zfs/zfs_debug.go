@@ -1,8 +1,12 @@
 package zfs
 
 import (
+	"context"
 	"fmt"
 	"os"
+
+	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/logger"
 )
 
 var debugEnabled bool = false
@@ -13,9 +17,18 @@ func init() {
 	}
 }
 
-//nolint[:deadcode,unused]
-func debug(format string, args ...interface{}) {
+func getLogger(ctx context.Context) logger.Logger {
+	return logging.GetLogger(ctx, logging.SubsysZFS)
+}
+
+// debug logs to the zfs subsystem of the logger in ctx at debug level,
+// i.e., with the job and span fields of the caller.
+// If ZREPL_ZFS_DEBUG is set, the message is also printed to stderr,
+// e.g., for callers that run outside the daemon and have no logger in ctx.
+func debug(ctx context.Context, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	getLogger(ctx).Debug(msg)
 	if debugEnabled {
-		fmt.Fprintf(os.Stderr, "zfs: %s\n", fmt.Sprintf(format, args...))
+		fmt.Fprintf(os.Stderr, "zfs: %s\n", msg)
 	}
 }
@@ -0,0 +1,42 @@
+package zfs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/logger"
+)
+
+type recordingOutlet struct {
+	entries []logger.Entry
+}
+
+func (o *recordingOutlet) WriteEntry(e logger.Entry) error {
+	o.entries = append(o.entries, e)
+	return nil
+}
+
+func TestDebugLogsToContextLogger(t *testing.T) {
+	o := &recordingOutlet{}
+	outlets := logger.NewOutlets()
+	outlets.Add(o, logger.Debug)
+	l := logger.NewLogger(outlets, 1*time.Second).WithField(logging.JobField, "myjob")
+	ctx := logging.WithLoggers(context.Background(), logging.SubsystemLoggersWithUniversalLogger(l))
+
+	debug(ctx, "destroy %q", "pool/fs@snap")
+
+	require.Len(t, o.entries, 1)
+	e := o.entries[0]
+	assert.Equal(t, logger.Debug, e.Level)
+	assert.Equal(t, `destroy "pool/fs@snap"`, e.Message)
+	assert.Equal(t, logging.SubsysZFS, e.Fields[logging.SubsysField])
+	assert.Equal(t, "myjob", e.Fields[logging.JobField])
+
+	// no logger in ctx, e.g., outside the daemon
+	debug(context.Background(), "must not panic")
+}
@@ -3,16 +3,15 @@
 package zfs
 
 import (
+	"context"
 	"os"
 	"sync"
 )
 
 var zfsPipeCapacityNotSupported sync.Once
 
-func trySetPipeCapacity(p *os.File, capacity int) {
-	if debugEnabled {
-		zfsPipeCapacityNotSupported.Do(func() {
-			debug("trySetPipeCapacity error: OS does not support setting pipe capacity")
-		})
-	}
+func trySetPipeCapacity(ctx context.Context, p *os.File, capacity int) {
+	zfsPipeCapacityNotSupported.Do(func() {
+		debug(ctx, "trySetPipeCapacity error: OS does not support setting pipe capacity")
+	})
 }
@@ -1,6 +1,7 @@
 package zfs
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -8,14 +9,14 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-func trySetPipeCapacity(p *os.File, capacity int) {
+func trySetPipeCapacity(ctx context.Context, p *os.File, capacity int) {
 	res, err := unix.FcntlInt(p.Fd(), unix.F_SETPIPE_SZ, capacity)
 	if err != nil {
 		err = fmt.Errorf("cannot set pipe capacity to %v", capacity)
 	} else if res == -1 {
 		err = errors.New("cannot set pipe capacity: fcntl returned -1")
 	}
-	if debugEnabled && err != nil {
-		debug("trySetPipeCapacity error: %s\n", err)
+	if err != nil {
+		debug(ctx, "trySetPipeCapacity error: %s", err)
 	}
 }
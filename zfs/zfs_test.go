@@ -152,6 +152,8 @@ full	p1 with/ spaces d1@2 with space
 
 	fullWithSpaces := "\nfull\tpool1/otherjob/ds with spaces@blaffoo\t12912\nsize\t12912\n"
 	fullWithSpacesInIntermediateComponent := "\nfull\tpool1/otherjob/another ds with spaces/childfs@blaffoo\t12912\nsize\t12912\n"
+	// the total in the size line takes precedence over the info line
+	incWithDifferingTotal := "\nincremental\tzroot/test/a@1\tzroot/test/a@2\t5383936\nsize\t1048576\n"
 	incrementalWithSpaces := "\nincremental\tblaffoo\tpool1/otherjob/another ds with spaces@blaffoo2\t624\nsize\t624\n"
 	incrementalWithSpacesInIntermediateComponent := "\nincremental\tblaffoo\tpool1/otherjob/another ds with spaces/childfs@blaffoo2\t624\nsize\t624\n"
 
@@ -215,6 +217,16 @@ full	p1 with/ spaces d1@2 with space
 				SizeEstimate: 10518512,
 			},
 		},
+		{
+			name: "incWithDifferingTotal", in: incWithDifferingTotal,
+			exp: &DrySendInfo{
+				Type:         DrySendTypeIncremental,
+				Filesystem:   "zroot/test/a",
+				From:         "zroot/test/a@1",
+				To:           "zroot/test/a@2",
+				SizeEstimate: 1048576,
+			},
+		},
 		{
 			name: "fullWithSpaces", in: fullWithSpaces,
 			exp: &DrySendInfo{
@@ -296,6 +308,35 @@ full	p1 with/ spaces d1@2 with space
 	}
 }
 
+func TestDrySendInfoLogicalAndPhysicalSizeEstimates(t *testing.T) {
+	ratio, err := parseCompressRatio("2.00x")
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, ratio)
+	ratio, err = parseCompressRatio("1.50")
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, ratio)
+	_, err = parseCompressRatio("-")
+	assert.Error(t, err)
+
+	si := DrySendInfo{SizeEstimate: 1000}
+	si.setLogicalAndPhysicalSizeEstimates(false, 2)
+	assert.Equal(t, int64(1000), si.LogicalSizeEstimate)
+	assert.Equal(t, int64(500), si.PhysicalSizeEstimate)
+
+	si.setLogicalAndPhysicalSizeEstimates(true, 2)
+	assert.Equal(t, int64(2000), si.LogicalSizeEstimate)
+	assert.Equal(t, int64(1000), si.PhysicalSizeEstimate)
+
+	si.setLogicalAndPhysicalSizeEstimates(false, 0)
+	assert.Equal(t, int64(1000), si.LogicalSizeEstimate)
+	assert.Equal(t, int64(-1), si.PhysicalSizeEstimate)
+
+	si = DrySendInfo{SizeEstimate: -1}
+	si.setLogicalAndPhysicalSizeEstimates(true, 2)
+	assert.Equal(t, int64(-1), si.LogicalSizeEstimate)
+	assert.Equal(t, int64(-1), si.PhysicalSizeEstimate)
+}
+
 func TestTryRecvDestroyOrOverwriteEncryptedErr(t *testing.T) {
 	msg := "cannot receive new filesystem stream: zfs receive -F cannot be used to destroy an encrypted filesystem or overwrite an unencrypted one with an encrypted one\n"
 	assert.GreaterOrEqual(t, RecvStderrBufSiz, len(msg))
@@ -304,3 +345,17 @@ func TestTryRecvDestroyOrOverwriteEncryptedErr(t *testing.T) {
 	require.NotNil(t, err)
 	assert.EqualError(t, err, strings.TrimSpace(msg))
 }
+
+func TestMinimalRoots(t *testing.T) {
+	var ps []*DatasetPath
+	for _, s := range []string{"pool/a/b", "pool/c", "pool/a", "pool/a/b/c", "pool/c", "pool/cd"} {
+		p, err := NewDatasetPath(s)
+		require.NoError(t, err)
+		ps = append(ps, p)
+	}
+	var roots []string
+	for _, r := range minimalRoots(ps) {
+		roots = append(roots, r.ToString())
+	}
+	assert.ElementsMatch(t, []string{"pool/a", "pool/c", "pool/cd"}, roots)
+}
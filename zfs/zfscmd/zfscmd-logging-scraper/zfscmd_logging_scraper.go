@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,6 +21,8 @@ type RuntimeLine struct {
 	LogTime                      time.Time
 	Cmd                          string
 	TotalTime, Usertime, Systime time.Duration
+	MaxRSS                       int64 // bytes, -1 if unknown, 0 if the log line predates the field
+	ExitStatus                   int   // -1 if unknown, 0 if the log line predates the field
 	Error                        string
 }
 
@@ -53,6 +56,10 @@ func parseHumanFormatterNodate(line string) (l RuntimeLine, err error) {
 				l.Usertime, err = parseSecs(v)
 			case "systemtime_s":
 				l.Systime, err = parseSecs(v)
+			case "maxrss_bytes":
+				l.MaxRSS, err = strconv.ParseInt(v, 10, 64)
+			case "exit_status":
+				l.ExitStatus, err = strconv.Atoi(v)
 			case "err":
 				l.Error = v
 			case "invocation":
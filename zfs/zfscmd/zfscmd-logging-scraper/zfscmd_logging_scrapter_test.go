@@ -52,6 +52,33 @@ func TestParseHumanFormatter(t *testing.T) {
 				LogTime:   logTime,
 			},
 		},
+		{
+			Name:  "human-formatter-maxrss",
+			Input: `2020-04-04T00:00:05+02:00 [DEBG][jobname][zfs.cmd][task$stack$span.stack]: command exited without error usertime_s="0.008445" cmd="zfs list -H -p -o name -r -t filesystem,volume" systemtime_s="0.033783" maxrss_bytes="4194304" invocation="84" total_time_s="0.037828619"`,
+			Expect: &RuntimeLine{
+				Cmd:       "zfs list -H -p -o name -r -t filesystem,volume",
+				TotalTime: secs("0.037828619"),
+				Usertime:  secs("0.008445"),
+				Systime:   secs("0.033783"),
+				MaxRSS:    4194304,
+				Error:     "",
+				LogTime:   logTime,
+			},
+		},
+		{
+			Name:  "human-formatter-exit-status",
+			Input: `2020-04-04T00:00:05+02:00 [DEBG][jobname][zfs.cmd][task$stack$span.stack]: command exited with error usertime_s="0.008445" cmd="zfs list -H -p -o name -r -t filesystem,volume" systemtime_s="0.033783" maxrss_bytes="4194304" exit_status="1" invocation="84" total_time_s="0.037828619" err="exit status 1"`,
+			Expect: &RuntimeLine{
+				Cmd:        "zfs list -H -p -o name -r -t filesystem,volume",
+				TotalTime:  secs("0.037828619"),
+				Usertime:   secs("0.008445"),
+				Systime:    secs("0.033783"),
+				MaxRSS:     4194304,
+				ExitStatus: 1,
+				Error:      "exit status 1",
+				LogTime:    logTime,
+			},
+		},
 		{
 			Name:  "from graylog",
 			Input: `2020-04-04T00:00:05+02:00 [DEBG][csnas][zfs.cmd][task$stack$span.stack]:  command  exited  without  error  usertime_s="0"  cmd="zfs  send  -i  zroot/ezjail/synapse-12@zrepl_20200329_095518_000  zroot/ezjail/synapse-12@zrepl_20200329_102454_000"  total_time_s="0.101598591"  invocation="85"  systemtime_s="0.041581"`,
@@ -12,6 +12,7 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/zrepl/zrepl/daemon/logging/trace"
@@ -27,6 +28,11 @@ type Cmd struct {
 }
 
 func CommandContext(ctx context.Context, name string, arg ...string) *Cmd {
+	name, arg = wrapCommand(name, arg)
+	return commandContext(ctx, name, arg...)
+}
+
+func commandContext(ctx context.Context, name string, arg ...string) *Cmd {
 	cmd := exec.CommandContext(ctx, name, arg...)
 	return &Cmd{cmd: cmd, ctx: ctx}
 }
@@ -155,6 +161,8 @@ func (c *Cmd) waitPre() {
 
 type usage struct {
 	total_secs, system_secs, user_secs float64
+	maxrss_bytes                       int64 // -1 if unknown
+	exit_status                        int   // -1 if unknown or terminated by a signal
 }
 
 func (c *Cmd) waitPost(err error) {
@@ -181,15 +189,22 @@ func (c *Cmd) waitPost(err error) {
 
 		if s == nil {
 			u = usage{
-				total_secs:  c.Runtime().Seconds(),
-				system_secs: -1,
-				user_secs:   -1,
+				total_secs:   c.Runtime().Seconds(),
+				system_secs:  -1,
+				user_secs:    -1,
+				maxrss_bytes: -1,
+				exit_status:  -1,
 			}
 		} else {
 			u = usage{
-				total_secs:  c.Runtime().Seconds(),
-				system_secs: s.SystemTime().Seconds(),
-				user_secs:   s.UserTime().Seconds(),
+				total_secs:   c.Runtime().Seconds(),
+				system_secs:  s.SystemTime().Seconds(),
+				user_secs:    s.UserTime().Seconds(),
+				maxrss_bytes: -1,
+				exit_status:  s.ExitCode(),
+			}
+			if ru, ok := s.SysUsage().(*syscall.Rusage); ok {
+				u.maxrss_bytes = int64(ru.Maxrss) * rusageMaxrssUnit
 			}
 		}
 	}
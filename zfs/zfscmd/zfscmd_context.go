@@ -11,6 +11,7 @@ type contextKey int
 
 const (
 	contextKeyJobID contextKey = 1 + iota
+	contextKeyPriority
 )
 
 type Logger = logger.Logger
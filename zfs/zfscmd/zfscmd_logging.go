@@ -32,7 +32,9 @@ func waitPostLogging(c *Cmd, u usage, err error, now time.Time) {
 	log := c.log().
 		WithField("total_time_s", u.total_secs).
 		WithField("systemtime_s", u.system_secs).
-		WithField("usertime_s", u.user_secs)
+		WithField("usertime_s", u.user_secs).
+		WithField("maxrss_bytes", u.maxrss_bytes).
+		WithField("exit_status", u.exit_status)
 
 	if err == nil {
 		log.Info("command exited without error")
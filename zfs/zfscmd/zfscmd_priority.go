@@ -0,0 +1,99 @@
+package zfscmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Priority controls the CPU and I/O scheduling priority of data-moving child processes (zfs send, zfs recv).
+// It is applied by wrapping the command in nice(1), ionice(1) and systemd-run(1), which must be in $PATH.
+// The zero value does not change the priority.
+type Priority struct {
+	Nice        int    // niceness adjustment, -20 to 19, 0 leaves it unchanged
+	IONiceClass string // "", "idle", "best-effort" or "realtime"
+	IONiceLevel int    // 0 (highest) to 7 (lowest), for classes best-effort and realtime
+	Slice       string // systemd slice, "" means the slice of the zrepl daemon
+}
+
+var ioniceClasses = map[string]string{
+	"realtime":    "1",
+	"best-effort": "2",
+	"idle":        "3",
+}
+
+// ParseIONice parses an ionice specification of the form `class[:level]`, e.g. `best-effort:7` or `idle`.
+func ParseIONice(spec string) (class string, level int, err error) {
+	comps := strings.SplitN(spec, ":", 2)
+	class = comps[0]
+	if _, ok := ioniceClasses[class]; !ok {
+		return "", 0, fmt.Errorf("invalid ionice class %q, must be one of idle, best-effort, realtime", class)
+	}
+	if len(comps) == 2 {
+		if class == "idle" {
+			return "", 0, fmt.Errorf("ionice class idle does not have levels")
+		}
+		level, err = strconv.Atoi(comps[1])
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid ionice level %q: %s", comps[1], err)
+		}
+	}
+	return class, level, nil
+}
+
+func (p *Priority) Validate() error {
+	if p.Nice < -20 || p.Nice > 19 {
+		return fmt.Errorf("nice value must be in [-20, 19], got %d", p.Nice)
+	}
+	if p.IONiceClass != "" {
+		if _, ok := ioniceClasses[p.IONiceClass]; !ok {
+			return fmt.Errorf("invalid ionice class %q", p.IONiceClass)
+		}
+	}
+	if p.IONiceLevel < 0 || p.IONiceLevel > 7 {
+		return fmt.Errorf("ionice level must be in [0, 7], got %d", p.IONiceLevel)
+	}
+	if p.Slice != "" && !strings.HasSuffix(p.Slice, ".slice") {
+		return fmt.Errorf("systemd slice name must end in .slice, got %q", p.Slice)
+	}
+	return nil
+}
+
+// Returns the argv that runs name with args at priority p.
+func (p *Priority) wrap(name string, args []string) (string, []string) {
+	argv := []string{}
+	if p.Slice != "" {
+		argv = append(argv, "systemd-run", "--quiet", "--scope", "--slice="+p.Slice, "--")
+	}
+	if p.Nice != 0 {
+		argv = append(argv, "nice", "-n", strconv.Itoa(p.Nice))
+	}
+	if p.IONiceClass != "" {
+		argv = append(argv, "ionice", "-c", ioniceClasses[p.IONiceClass])
+		if p.IONiceClass != "idle" {
+			argv = append(argv, "-n", strconv.Itoa(p.IONiceLevel))
+		}
+	}
+	if len(argv) == 0 {
+		return name, args
+	}
+	argv = append(argv, name)
+	argv = append(argv, args...)
+	return argv[0], argv[1:]
+}
+
+func WithPriority(ctx context.Context, p *Priority) context.Context {
+	return context.WithValue(ctx, contextKeyPriority, p)
+}
+
+// PrioritizedCommandContext is like CommandContext, but runs the command at the Priority attached to ctx, if any.
+// Use it for commands that move data, not for short-running ones.
+// The priority wrappers are placed in front of the command wrapper (see SetCommandWrapper).
+func PrioritizedCommandContext(ctx context.Context, name string, arg ...string) *Cmd {
+	name, arg = wrapCommand(name, arg)
+	if p, ok := ctx.Value(contextKeyPriority).(*Priority); ok && p != nil {
+		name, arg = p.wrap(name, arg)
+	}
+	return commandContext(ctx, name, arg...)
+}
@@ -0,0 +1,55 @@
+package zfscmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIONice(t *testing.T) {
+	class, level, err := ParseIONice("best-effort:7")
+	require.NoError(t, err)
+	assert.Equal(t, "best-effort", class)
+	assert.Equal(t, 7, level)
+
+	class, _, err = ParseIONice("idle")
+	require.NoError(t, err)
+	assert.Equal(t, "idle", class)
+
+	for _, invalid := range []string{"", "foo", "idle:3", "realtime:x"} {
+		_, _, err := ParseIONice(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPriorityWrap(t *testing.T) {
+	type testCase struct {
+		name   string
+		p      Priority
+		expect []string
+	}
+	tcs := []testCase{
+		{"unchanged", Priority{}, []string{"zfs", "send", "a@b"}},
+		{"nice", Priority{Nice: 10}, []string{"nice", "-n", "10", "zfs", "send", "a@b"}},
+		{"ionice_idle", Priority{IONiceClass: "idle"}, []string{"ionice", "-c", "3", "zfs", "send", "a@b"}},
+		{
+			"all",
+			Priority{Nice: 5, IONiceClass: "best-effort", IONiceLevel: 7, Slice: "zrepl.slice"},
+			[]string{"systemd-run", "--quiet", "--scope", "--slice=zrepl.slice", "--", "nice", "-n", "5", "ionice", "-c", "2", "-n", "7", "zfs", "send", "a@b"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, tc.p.Validate())
+			name, args := tc.p.wrap("zfs", []string{"send", "a@b"})
+			assert.Equal(t, tc.expect, append([]string{name}, args...))
+		})
+	}
+}
+
+func TestPriorityValidate(t *testing.T) {
+	assert.Error(t, (&Priority{Nice: 20}).Validate())
+	assert.Error(t, (&Priority{IONiceClass: "best-effort", IONiceLevel: 8}).Validate())
+	assert.Error(t, (&Priority{Slice: "zrepl"}).Validate())
+}
@@ -10,6 +10,7 @@ var metrics struct {
 	totaltime  *prometheus.HistogramVec
 	systemtime *prometheus.HistogramVec
 	usertime   *prometheus.HistogramVec
+	maxrss     *prometheus.HistogramVec
 }
 
 var timeLabels = []string{"jobid", "zfsbinary", "zfsverb"}
@@ -37,6 +38,13 @@ func init() {
 		Help:      "https://golang.org/pkg/os/#ProcessState.UserTime",
 		Buckets:   timeBuckets,
 	}, timeLabels)
+	metrics.maxrss = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "zrepl",
+		Subsystem: "zfscmd",
+		Name:      "maxrss_bytes",
+		Help:      "maximum resident set size of the command, see getrusage(2)",
+		Buckets:   prometheus.ExponentialBuckets(1<<20, 4, 8),
+	}, timeLabels)
 
 }
 
@@ -44,6 +52,7 @@ func RegisterMetrics(r prometheus.Registerer) {
 	r.MustRegister(metrics.totaltime)
 	r.MustRegister(metrics.systemtime)
 	r.MustRegister(metrics.usertime)
+	r.MustRegister(metrics.maxrss)
 }
 
 func waitPostPrometheus(c *Cmd, u usage, err error, now time.Time) {
@@ -69,5 +78,9 @@ func waitPostPrometheus(c *Cmd, u usage, err error, now time.Time) {
 		Observe(u.system_secs)
 	metrics.usertime.WithLabelValues(labelValues...).
 		Observe(u.user_secs)
+	if u.maxrss_bytes >= 0 {
+		metrics.maxrss.WithLabelValues(labelValues...).
+			Observe(float64(u.maxrss_bytes))
+	}
 
 }
@@ -4,10 +4,14 @@ import (
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/zrepl/zrepl/util/envconst"
 )
 
 type Report struct {
 	Active []ActiveCommand
+	// The most recently exited commands, oldest first.
+	Recent []ExitedCommand
 }
 
 type ActiveCommand struct {
@@ -16,6 +20,18 @@ type ActiveCommand struct {
 	StartedAt time.Time
 }
 
+// ExitedCommand is the resource usage of an exited command.
+// UserTime, SystemTime and MaxRSS are -1 if unknown.
+type ExitedCommand struct {
+	Path       string
+	Args       []string
+	StartedAt  time.Time
+	Runtime    time.Duration
+	UserTime   time.Duration
+	SystemTime time.Duration
+	MaxRSS     int64 // bytes
+}
+
 func GetReport() *Report {
 	active.mtx.RLock()
 	defer active.mtx.RUnlock()
@@ -29,8 +45,14 @@ func GetReport() *Report {
 		})
 		c.mtx.RUnlock()
 	}
+	recent.mtx.Lock()
+	recentCommands := make([]ExitedCommand, 0, len(recent.cmds))
+	recentCommands = append(recentCommands, recent.cmds[recent.next:]...)
+	recentCommands = append(recentCommands, recent.cmds[:recent.next]...)
+	recent.mtx.Unlock()
 	return &Report{
 		Active: activeCommands,
+		Recent: recentCommands,
 	}
 }
 
@@ -43,6 +65,22 @@ func init() {
 	active.cmds = make(map[*Cmd]bool)
 }
 
+// ring buffer of the most recently exited commands
+var recent struct {
+	mtx  sync.Mutex
+	cmds []ExitedCommand
+	next int // index of the oldest entry once cmds is full
+}
+
+var recentMax = envconst.Int("ZREPL_ZFSCMD_REPORT_RECENT", 32)
+
+func secsToDuration(secs float64) time.Duration {
+	if secs < 0 {
+		return -1
+	}
+	return time.Duration(secs * float64(time.Second))
+}
+
 func startPostReport(c *Cmd, err error, now time.Time) {
 	if err != nil {
 		return
@@ -57,12 +95,34 @@ func startPostReport(c *Cmd, err error, now time.Time) {
 	active.mtx.Unlock()
 }
 
-func waitPostReport(c *Cmd, _ usage, now time.Time) {
+func waitPostReport(c *Cmd, u usage, now time.Time) {
 	active.mtx.Lock()
-	defer active.mtx.Unlock()
 	prev := active.cmds[c]
 	if !prev {
+		active.mtx.Unlock()
 		panic(fmt.Sprintf("impl error: onWaitDone must only be called on an active command: %s", c))
 	}
 	delete(active.cmds, c)
+	active.mtx.Unlock()
+
+	if recentMax <= 0 {
+		return
+	}
+	e := ExitedCommand{
+		Path:       c.cmd.Path,
+		Args:       c.cmd.Args,
+		StartedAt:  c.startedAt,
+		Runtime:    c.Runtime(),
+		UserTime:   secsToDuration(u.user_secs),
+		SystemTime: secsToDuration(u.system_secs),
+		MaxRSS:     u.maxrss_bytes,
+	}
+	recent.mtx.Lock()
+	defer recent.mtx.Unlock()
+	if len(recent.cmds) < recentMax {
+		recent.cmds = append(recent.cmds, e)
+		return
+	}
+	recent.cmds[recent.next] = e
+	recent.next = (recent.next + 1) % len(recent.cmds)
 }
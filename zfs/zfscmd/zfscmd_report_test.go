@@ -0,0 +1,45 @@
+package zfscmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+)
+
+func TestReportRecentCommands(t *testing.T) {
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	defer end()
+	_, err := CommandContext(ctx, testBin, "0").CombinedOutput()
+	require.NoError(t, err)
+	_, err = CommandContext(ctx, testBin, "1").CombinedOutput()
+	require.Error(t, err)
+
+	r := GetReport()
+	require.True(t, len(r.Recent) >= 2)
+	for i, arg := range []string{"0", "1"} {
+		e := r.Recent[len(r.Recent)-2+i]
+		assert.Equal(t, []string{testBin, arg}, e.Args)
+		assert.True(t, e.Runtime > 0)
+		assert.True(t, e.UserTime >= 0)
+		assert.True(t, e.SystemTime >= 0)
+		assert.True(t, e.MaxRSS > 0)
+	}
+}
+
+func TestReportRecentCommandsRingBuffer(t *testing.T) {
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	defer end()
+	for i := 0; i < recentMax+3; i++ {
+		_, err := CommandContext(ctx, testBin, "0").CombinedOutput()
+		require.NoError(t, err)
+	}
+	r := GetReport()
+	require.Len(t, r.Recent, recentMax)
+	for i := 1; i < len(r.Recent); i++ {
+		assert.False(t, r.Recent[i].StartedAt.Before(r.Recent[i-1].StartedAt), "must be ordered oldest first")
+	}
+}
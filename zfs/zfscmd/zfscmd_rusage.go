@@ -0,0 +1,6 @@
+// +build !darwin
+
+package zfscmd
+
+// unit of syscall.Rusage.Maxrss in bytes: getrusage(2) reports kilobytes on Linux, FreeBSD and illumos
+const rusageMaxrssUnit = 1024
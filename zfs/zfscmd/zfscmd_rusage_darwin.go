@@ -0,0 +1,4 @@
+package zfscmd
+
+// unit of syscall.Rusage.Maxrss in bytes: getrusage(2) reports bytes on macOS
+const rusageMaxrssUnit = 1
@@ -0,0 +1,30 @@
+package zfscmd
+
+import "sync"
+
+var commandWrapper struct {
+	mtx  sync.RWMutex
+	argv []string
+}
+
+// SetCommandWrapper sets a command that all commands are prefixed with,
+// e.g., `sudo -n` if zrepl runs unprivileged and the zfs commands must be run through sudo.
+// An empty argv disables the wrapper.
+func SetCommandWrapper(argv []string) {
+	commandWrapper.mtx.Lock()
+	defer commandWrapper.mtx.Unlock()
+	commandWrapper.argv = append([]string{}, argv...)
+}
+
+func wrapCommand(name string, args []string) (string, []string) {
+	commandWrapper.mtx.RLock()
+	defer commandWrapper.mtx.RUnlock()
+	if len(commandWrapper.argv) == 0 {
+		return name, args
+	}
+	wrapped := make([]string, 0, len(commandWrapper.argv)+len(args))
+	wrapped = append(wrapped, commandWrapper.argv[1:]...)
+	wrapped = append(wrapped, name)
+	wrapped = append(wrapped, args...)
+	return commandWrapper.argv[0], wrapped
+}
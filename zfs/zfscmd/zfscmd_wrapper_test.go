@@ -0,0 +1,24 @@
+package zfscmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandWrapper(t *testing.T) {
+	SetCommandWrapper([]string{"sudo", "-n"})
+	defer SetCommandWrapper(nil)
+
+	cmd := CommandContext(context.Background(), "zfs", "list")
+	assert.Equal(t, "sudo -n zfs list", cmd.String())
+
+	ctx := WithPriority(context.Background(), &Priority{Nice: 10})
+	cmd = PrioritizedCommandContext(ctx, "zfs", "send", "a@b")
+	assert.Equal(t, "nice -n 10 sudo -n zfs send a@b", cmd.String())
+
+	SetCommandWrapper(nil)
+	cmd = CommandContext(context.Background(), "zfs", "list")
+	assert.Equal(t, "zfs list", cmd.String())
+}